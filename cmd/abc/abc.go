@@ -16,17 +16,35 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/commands/audit"
+	"github.com/abcxyz/abc/templates/commands/clean"
 	"github.com/abcxyz/abc/templates/commands/describe"
 	"github.com/abcxyz/abc/templates/commands/goldentest"
+	"github.com/abcxyz/abc/templates/commands/graph"
+	"github.com/abcxyz/abc/templates/commands/importer"
+	"github.com/abcxyz/abc/templates/commands/inputs"
+	"github.com/abcxyz/abc/templates/commands/lint"
+	"github.com/abcxyz/abc/templates/commands/lsp"
+	"github.com/abcxyz/abc/templates/commands/manifest"
+	"github.com/abcxyz/abc/templates/commands/packager"
 	"github.com/abcxyz/abc/templates/commands/render"
+	"github.com/abcxyz/abc/templates/commands/report"
+	"github.com/abcxyz/abc/templates/commands/server"
+	"github.com/abcxyz/abc/templates/commands/testmatrix"
 	"github.com/abcxyz/abc/templates/commands/upgrade"
+	"github.com/abcxyz/abc/templates/commands/vendorer"
+	"github.com/abcxyz/abc/templates/commands/versions"
+	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
 )
@@ -41,11 +59,34 @@ var rootCmd = func() *cli.RootCommand {
 		Name:    version.Name,
 		Version: version.HumanVersion,
 		Commands: map[string]cli.CommandFactory{
+			"lsp": func() cli.Command {
+				return &lsp.Command{}
+			},
+			"server": func() cli.Command {
+				return &server.Command{}
+			},
 			"templates": func() cli.Command {
 				return &cli.RootCommand{
 					Name:        "templates",
 					Description: "subcommands for rendering templates and related things",
 					Commands: map[string]cli.CommandFactory{
+						"adopt": func() cli.Command {
+							return &manifest.AdoptCommand{}
+						},
+						"audit": func() cli.Command {
+							return &cli.RootCommand{
+								Name:        "audit",
+								Description: "subcommands for reading the audit log of renders and upgrades",
+								Commands: map[string]cli.CommandFactory{
+									"list": func() cli.Command {
+										return &audit.ListCommand{}
+									},
+								},
+							}
+						},
+						"clean": func() cli.Command {
+							return &clean.Command{}
+						},
 						"describe": func() cli.Command {
 							return &describe.Command{}
 						},
@@ -66,12 +107,64 @@ var rootCmd = func() *cli.RootCommand {
 								},
 							}
 						},
+						"inputs": func() cli.Command {
+							return &cli.RootCommand{
+								Name:        "inputs",
+								Description: "subcommands for working with template inputs",
+								Commands: map[string]cli.CommandFactory{
+									"validate": func() cli.Command {
+										return &inputs.ValidateCommand{}
+									},
+								},
+							}
+						},
+						"graph": func() cli.Command {
+							return &graph.Command{}
+						},
+						"import": func() cli.Command {
+							return &importer.Command{}
+						},
+						"lint": func() cli.Command {
+							return &lint.Command{}
+						},
+						"manifest": func() cli.Command {
+							return &cli.RootCommand{
+								Name:        "manifest",
+								Description: "subcommands for working with the manifests of rendered templates",
+								Commands: map[string]cli.CommandFactory{
+									"gc": func() cli.Command {
+										return &manifest.GCCommand{}
+									},
+									"rewrite-source": func() cli.Command {
+										return &manifest.RewriteSourceCommand{}
+									},
+								},
+							}
+						},
+						"package": func() cli.Command {
+							return &packager.Command{}
+						},
+						"publish": func() cli.Command {
+							return &packager.PublishCommand{}
+						},
 						"render": func() cli.Command {
 							return &render.Command{}
 						},
+						"report": func() cli.Command {
+							return &report.Command{}
+						},
+						"test-matrix": func() cli.Command {
+							return &testmatrix.Command{}
+						},
 						"upgrade": func() cli.Command {
 							return &upgrade.Command{}
 						},
+						"vendor": func() cli.Command {
+							return &vendorer.Command{}
+						},
+						"versions": func() cli.Command {
+							return &versions.Command{}
+						},
 					},
 				}
 			},
@@ -90,7 +183,7 @@ func main() {
 	if err := realMain(ctx); err != nil {
 		done()
 		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		os.Exit(errs.ExitCode(err))
 	}
 }
 
@@ -108,5 +201,59 @@ func realMain(ctx context.Context) error {
 	if runtime.GOOS == "windows" {
 		return fmt.Errorf("windows os is not supported in abc cli")
 	}
-	return rootCmd().Run(ctx, os.Args[1:]) //nolint:wrapcheck
+	return run(ctx, os.Args[1:])
+}
+
+// run runs the root command with args, after handling the global flags that
+// come before the subcommand name.
+func run(ctx context.Context, args []string) error {
+	timeout, args, err := parseTimeout(args)
+	if err != nil {
+		return err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err = rootCmd().Run(ctx, args)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("the command didn't finish within %s, which is the limit set by --timeout: %w", timeout, err)
+	}
+	return err //nolint:wrapcheck
+}
+
+// parseTimeout removes the global --timeout flag from the beginning of args,
+// as in "abc --timeout=5m templates render ...", and returns its value and
+// the remaining args. The timeout bounds the whole command, including
+// downloading the template and running its steps. A timeout of zero, the
+// default, means there's no limit.
+//
+// This is parsed by hand because subcommands can't see the flags of their
+// parent commands.
+func parseTimeout(args []string) (time.Duration, []string, error) {
+	var timeout time.Duration
+	for len(args) > 0 {
+		name, val, hasVal := strings.Cut(args[0], "=")
+		if name != "--timeout" && name != "-timeout" {
+			break
+		}
+		args = args[1:]
+		if !hasVal {
+			if len(args) == 0 {
+				return 0, nil, fmt.Errorf("flag --timeout needs a value, like --timeout=10m")
+			}
+			val, args = args[0], args[1:]
+		}
+		var err error
+		timeout, err = time.ParseDuration(val)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid value %q for --timeout, it must be a duration like 30s or 10m: %w", val, err)
+		}
+		if timeout < 0 {
+			return 0, nil, fmt.Errorf("invalid value %q for --timeout, it can't be negative", val)
+		}
+	}
+	return timeout, args, nil
 }
@@ -18,6 +18,7 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -78,3 +79,84 @@ func TestRootCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTimeout(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		args        []string
+		wantTimeout time.Duration
+		wantArgs    []string
+		wantErr     string
+	}{
+		{
+			name:     "no_timeout",
+			args:     []string{"templates", "render", "foo"},
+			wantArgs: []string{"templates", "render", "foo"},
+		},
+		{
+			name:        "equals_sign",
+			args:        []string{"--timeout=5m", "templates", "render", "foo"},
+			wantTimeout: 5 * time.Minute,
+			wantArgs:    []string{"templates", "render", "foo"},
+		},
+		{
+			name:        "separate_value",
+			args:        []string{"-timeout", "30s", "templates"},
+			wantTimeout: 30 * time.Second,
+			wantArgs:    []string{"templates"},
+		},
+		{
+			name:     "after_subcommand_is_not_global",
+			args:     []string{"templates", "--timeout=5m"},
+			wantArgs: []string{"templates", "--timeout=5m"},
+		},
+		{
+			name:    "missing_value",
+			args:    []string{"--timeout"},
+			wantErr: "flag --timeout needs a value",
+		},
+		{
+			name:    "invalid_duration",
+			args:    []string{"--timeout=soon", "templates"},
+			wantErr: `invalid value "soon" for --timeout`,
+		},
+		{
+			name:    "negative_duration",
+			args:    []string{"--timeout=-1s", "templates"},
+			wantErr: "can't be negative",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotTimeout, gotArgs, err := parseTimeout(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if gotTimeout != tc.wantTimeout {
+				t.Errorf("got timeout %s, want %s", gotTimeout, tc.wantTimeout)
+			}
+			if diff := cmp.Diff(gotArgs, tc.wantArgs); diff != "" {
+				t.Errorf("remaining args were not as expected (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	t.Parallel()
+
+	err := run(context.Background(), []string{
+		"--timeout=1ns", "templates", "render", "--input=person_name=Bob", "--dest=" + t.TempDir(),
+		"../../examples/templates/render/print",
+	})
+	if diff := testutil.DiffErrString(err, "the command didn't finish within 1ns, which is the limit set by --timeout"); diff != "" {
+		t.Error(diff)
+	}
+}
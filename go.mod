@@ -9,6 +9,7 @@ require (
 	github.com/fatih/color v1.16.0
 	github.com/google/cel-go v0.19.0
 	github.com/google/go-cmp v0.6.0
+	github.com/hashicorp/hcl/v2 v2.19.1
 	github.com/jinzhu/copier v0.4.0
 	github.com/mattn/go-isatty v0.0.20
 	github.com/posener/complete/v2 v2.1.0
@@ -19,14 +20,18 @@ require (
 )
 
 require (
+	github.com/agext/levenshtein v1.2.3 // indirect
 	github.com/antlr4-go/antlr/v4 v4.13.0 // indirect
+	github.com/apparentlymart/go-textseg/v15 v15.0.0 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mitchellh/go-wordwrap v1.0.1 // indirect
 	github.com/posener/script v1.2.0 // indirect
 	github.com/rogpeppe/go-internal v1.11.0 // indirect
 	github.com/stoewer/go-strcase v1.3.0 // indirect
+	github.com/zclconf/go-cty v1.14.2 // indirect
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
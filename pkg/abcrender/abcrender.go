@@ -0,0 +1,395 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package abcrender is the public Go API for rendering abc templates. It lets
+// other Go programs embed template rendering without shelling out to the abc
+// CLI.
+//
+// Unlike the packages under templates/, which may change at any time, the
+// exported identifiers in this package follow semantic versioning: fields may
+// be added to Options and Result, but existing fields will not be removed or
+// change meaning within a major version. Options doesn't expose any types from
+// templates/; MemFS, Prompter, and PromptRequest are defined here instead.
+//
+// Example:
+//
+//	res, err := abcrender.Render(ctx, &abcrender.Options{
+//		Source: "github.com/abcxyz/abc/t/rest_server@latest",
+//		Inputs: map[string]string{"service_name": "my-service"},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	for path, contents := range res.Files {
+//		...
+//	}
+package abcrender
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+)
+
+// Options configures a call to Render. Only Source is required.
+type Options struct {
+	// AllowExec lets the template run external programs, like the "command"
+	// of a "format" action.
+	AllowExec bool
+
+	// BackupDir is the directory where destination files will be backed up
+	// before being overwritten. If empty, no backups are made.
+	BackupDir string
+
+	// Cwd is the directory that relative paths, like a relative Source or
+	// DestDir, are resolved against. Required if any such paths are relative.
+	Cwd string
+
+	// DestDir is the directory where the output files are written. It's OK
+	// for it to already exist or not. If empty, nothing is written to a
+	// destination directory, and the output files are instead returned in
+	// Result.Files.
+	DestDir string
+
+	// ForceOverwrite lets existing files in DestDir be overwritten with the
+	// output of the template.
+	ForceOverwrite bool
+
+	// FS, if non-nil, is used for all file operations instead of the real
+	// filesystem, to render entirely in memory. In that case, local template
+	// sources and DestDir refer to paths inside the MemFS. Templates from
+	// remote git repos are cloned on the real filesystem, then copied into
+	// FS.
+	FS *MemFS
+
+	// GitProtocol is either "https" or "ssh", and controls how remote git
+	// templates are downloaded. Defaults to "https".
+	GitProtocol string
+
+	// InputFiles is a list of YAML files defining template input values.
+	// Later files override earlier ones, and values in Inputs take precedence
+	// over values in any of these files.
+	InputFiles []string
+
+	// Inputs is the template input values, keyed by input name.
+	Inputs map[string]string
+
+	// KeepTempDirs prevents the removal of the temporary directories created
+	// during rendering, for debugging.
+	KeepTempDirs bool
+
+	// LineEndings converts the line endings of text files in the output, like
+	// the --line-endings flag: one of "preserve", "lf", or "crlf". Defaults to
+	// the template's line_endings setting.
+	LineEndings string
+
+	// MaxBytes, MaxFiles, and MaxPathDepth limit the size of the template and
+	// of its output, like the --max-bytes, --max-files, and --max-path-depth
+	// flags. Unlike the flags, they default to zero, which means no limit.
+	MaxBytes     int64
+	MaxFiles     int
+	MaxPathDepth int
+
+	// LookupEnv reads the environment variables that the template declares
+	// in its env_vars, like os.LookupEnv. If nil, they're empty, as if unset;
+	// pass os.LookupEnv to give the template the process environment.
+	LookupEnv func(string) (string, bool)
+
+	// Manifest enables writing a manifest file into DestDir, which is needed
+	// for future template upgrades.
+	Manifest bool
+
+	// HashAlgorithm is the hash algorithm for the manifest, like the
+	// --hash-algorithm flag: "sha256" or "sha512". Defaults to "sha256".
+	HashAlgorithm string
+
+	// OnFile, if non-nil, is called with the contents of each output file as
+	// it's written, instead of the file being added to Result.Files, so that
+	// the output doesn't all have to be held in memory at once. It's only
+	// used when DestDir is empty. Files are passed in order of their
+	// slash-separated path relative to the destination. If OnFile returns an
+	// error, it isn't called again, and Render returns that error.
+	OnFile func(path string, contents []byte) error
+
+	// Now returns the current time, for timestamps in the manifest. Defaults
+	// to time.Now.
+	Now func() time.Time
+
+	// Prompter, if non-nil, is asked for the values of any inputs that aren't
+	// in Inputs or InputFiles, like through a web form. If nil, missing
+	// inputs are an error.
+	Prompter Prompter
+
+	// PromptBatch asks the Prompter for all the missing inputs at once,
+	// rather than one at a time. That's fewer round trips for a remote
+	// prompter, but an input whose default is computed from other inputs
+	// doesn't have a default in the request.
+	PromptBatch bool
+
+	// SetVars overrides the values of the template's vars, which are normally
+	// computed by the template, like the --set flag.
+	SetVars map[string]string
+
+	// SkipInputValidation skips the input validation rules declared by the
+	// template.
+	SkipInputValidation bool
+
+	// Source is the location of the template to render, in any form
+	// accepted by the "abc templates render" command, like a local directory
+	// or "github.com/abcxyz/abc/t/rest_server@latest".
+	Source string
+
+	// Stdout receives the output of "print" actions in the template. Defaults
+	// to discarding it.
+	Stdout io.Writer
+
+	// StripBOM removes the UTF-8 byte order mark from the start of text files
+	// in the output, like the --strip-bom flag.
+	StripBOM bool
+
+	// Symlinks is what to do with symlinks in the template and its output,
+	// like the --symlinks flag: one of "follow", "preserve", or "reject".
+	// Defaults to "follow".
+	Symlinks string
+
+	// TempDirBase is the directory under which temporary directories are
+	// created. Defaults to the OS temp directory.
+	TempDirBase string
+}
+
+// Result is the outcome of a successful Render.
+type Result struct {
+	// Files holds the contents of every output file, keyed by its
+	// slash-separated path relative to the destination. It's only populated
+	// when Options.DestDir and Options.OnFile are empty.
+	Files map[string][]byte
+
+	// Symlinks holds the target of every output symlink, keyed like Files.
+	// Symlinks are only output when Options.Symlinks is "preserve", and they
+	// aren't in Files. It's only populated when Options.DestDir is empty.
+	Symlinks map[string]string
+}
+
+// Render downloads the template at opts.Source, runs it with the given
+// inputs, and writes the output to opts.DestDir or returns it in memory.
+//
+// Missing inputs are only prompted for if opts.Prompter is set; otherwise, all
+// required inputs must be provided in opts.Inputs or opts.InputFiles.
+func Render(ctx context.Context, opts *Options) (_ *Result, rErr error) {
+	if opts.Source == "" {
+		return nil, fmt.Errorf("Options.Source is required")
+	}
+
+	var rfs common.FS = &common.RealFS{}
+	if opts.FS != nil {
+		rfs = &opts.FS.mfs
+	}
+	var clk clock.Clock = clock.New()
+	if opts.Now != nil {
+		clk = &nowClock{Clock: clk, now: opts.Now}
+	}
+	var prompter input.InputPrompter
+	if opts.Prompter != nil {
+		prompter = &inputPrompter{p: opts.Prompter}
+	}
+	stdout := opts.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	gitProtocol := opts.GitProtocol
+	if gitProtocol == "" {
+		gitProtocol = "https"
+	}
+	symlinks, err := common.ParseSymlinkMode(opts.Symlinks)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Options.Symlinks: %w", err)
+	}
+	if _, err := common.ParseLineEndings(opts.LineEndings); err != nil {
+		return nil, fmt.Errorf("invalid Options.LineEndings: %w", err)
+	}
+	hashAlg, err := hashalg.ByName(opts.HashAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Options.HashAlgorithm: %w", err)
+	}
+	if opts.MaxBytes < 0 || opts.MaxFiles < 0 || opts.MaxPathDepth < 0 {
+		return nil, fmt.Errorf("Options.MaxBytes, Options.MaxFiles, and Options.MaxPathDepth must not be negative")
+	}
+	limits := &common.Limits{
+		MaxFiles:     opts.MaxFiles,
+		MaxBytes:     opts.MaxBytes,
+		MaxPathDepth: opts.MaxPathDepth,
+	}
+
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:         opts.Cwd,
+		Source:      opts.Source,
+		GitProtocol: gitProtocol,
+		FS:          rfs,
+		Limits:      limits,
+		Symlinks:    symlinks,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	destDir := opts.DestDir
+	inMemory := destDir == ""
+	if inMemory {
+		tempTracker := tempdir.NewDirTracker(rfs, opts.KeepTempDirs)
+		defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+		destDir, err = tempTracker.MkdirTempTracked(opts.TempDirBase, tempdir.ArchiveDirNamePart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory for the render output: %w", err)
+		}
+	} else if !filepath.IsAbs(destDir) {
+		destDir = filepath.Join(opts.Cwd, destDir)
+	}
+
+	// When streaming files to opts.OnFile, each one is read back from the
+	// in-memory destination as soon as render.Render reports writing it.
+	var onEvent func(*render.Event)
+	var streamSymlinks map[string]string
+	var streamErr error
+	if inMemory && opts.OnFile != nil {
+		onEvent = func(e *render.Event) {
+			if e.Type != render.EventFileWritten || streamErr != nil {
+				return
+			}
+			streamErr = streamFile(rfs, destDir, e.Path, opts.OnFile, &streamSymlinks)
+		}
+	}
+
+	if err := render.Render(ctx, &render.Params{
+		AllowExec:           opts.AllowExec,
+		BackupDir:           opts.BackupDir,
+		Backups:             opts.BackupDir != "",
+		Clock:               clk,
+		Cwd:                 opts.Cwd,
+		DestDir:             destDir,
+		Downloader:          downloader,
+		ForceOverwrite:      opts.ForceOverwrite,
+		FS:                  rfs,
+		GitProtocol:         gitProtocol,
+		HashAlgorithm:       hashAlg,
+		InputFiles:          opts.InputFiles,
+		InputPrompter:       prompter,
+		Inputs:              opts.Inputs,
+		KeepTempDirs:        opts.KeepTempDirs,
+		LineEndings:         common.LineEndings(opts.LineEndings),
+		Limits:              limits,
+		LookupEnv:           opts.LookupEnv,
+		Manifest:            opts.Manifest,
+		OnEvent:             onEvent,
+		Prompt:              opts.Prompter != nil,
+		PromptBatch:         opts.PromptBatch,
+		SetVars:             opts.SetVars,
+		SkipInputValidation: opts.SkipInputValidation,
+		SourceForMessages:   opts.Source,
+		Stdout:              stdout,
+		StripBOM:            opts.StripBOM,
+		Symlinks:            symlinks,
+		TempDirBase:         opts.TempDirBase,
+	}); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if !inMemory {
+		return &Result{}, nil
+	}
+	if opts.OnFile != nil {
+		if streamErr != nil {
+			return nil, streamErr
+		}
+		return &Result{Symlinks: streamSymlinks}, nil
+	}
+
+	files, outSymlinks, err := readAll(rfs, destDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Files: files, Symlinks: outSymlinks}, nil
+}
+
+// streamFile passes the output file at the given slash-separated path under
+// dir to onFile. If it's a symlink, its target is added to *symlinks instead.
+func streamFile(rfs common.FS, dir, relPath string, onFile func(string, []byte) error, symlinks *map[string]string) error {
+	path := filepath.Join(dir, filepath.FromSlash(relPath))
+	target, isSymlink, err := common.ReadlinkIfSymlink(rfs, path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if isSymlink {
+		if *symlinks == nil {
+			*symlinks = map[string]string{}
+		}
+		(*symlinks)[relPath] = filepath.ToSlash(target)
+		return nil
+	}
+	buf, err := rfs.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("ReadFile(%s): %w", path, err)
+	}
+	return onFile(relPath, buf)
+}
+
+// readAll returns the contents of every file under dir, and the target of
+// every symlink, keyed by slash-separated relative path.
+func readAll(rfs common.FS, dir string) (_ map[string][]byte, symlinks map[string]string, _ error) {
+	out := map[string][]byte{}
+	err := fs.WalkDir(rfs, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err // There was some filesystem error. Give up.
+		}
+		if de.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", dir, path, err)
+		}
+		if de.Type()&fs.ModeSymlink != 0 {
+			target, _, err := common.ReadlinkIfSymlink(rfs, path)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+			if symlinks == nil {
+				symlinks = map[string]string{}
+			}
+			symlinks[filepath.ToSlash(rel)] = filepath.ToSlash(target)
+			return nil
+		}
+		buf, err := rfs.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("ReadFile(%s): %w", path, err)
+		}
+		out[filepath.ToSlash(rel)] = buf
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading rendered output: %w", err)
+	}
+	return out, symlinks, nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abcrender
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const specContents = `
+api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+desc: 'A template for the ages'
+inputs:
+- name: 'person'
+  desc: 'The name of a person'
+steps:
+- desc: 'Include some files'
+  action: 'include'
+  params:
+    paths: ['greeting.txt', 'dir']
+- desc: 'Replace "Alice" with [input]'
+  action: 'string_replace'
+  params:
+    paths: ['.']
+    replacements:
+    - to_replace: 'Alice'
+      with: '{{.person}}'
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'rendered for {{.person}}'
+`
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	templateContents := map[string]string{
+		"spec.yaml":      specContents,
+		"greeting.txt":   "hello Alice",
+		"dir/other.txt":  "other contents",
+		"not_included.x": "nope",
+	}
+
+	cases := []struct {
+		name       string
+		opts       *Options
+		toDestDir  bool
+		wantFiles  map[string][]byte
+		wantDest   map[string]string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name: "in_memory",
+			opts: &Options{
+				Inputs: map[string]string{"person": "Bob"},
+			},
+			wantFiles: map[string][]byte{
+				"greeting.txt":  []byte("hello Bob"),
+				"dir/other.txt": []byte("other contents"),
+			},
+			wantStdout: "rendered for Bob\n",
+		},
+		{
+			name: "to_dest_dir",
+			opts: &Options{
+				Inputs: map[string]string{"person": "Carol"},
+			},
+			toDestDir: true,
+			wantDest: map[string]string{
+				"greeting.txt":  "hello Carol",
+				"dir/other.txt": "other contents",
+			},
+			wantStdout: "rendered for Carol\n",
+		},
+		{
+			name:    "missing_input",
+			opts:    &Options{},
+			wantErr: "missing input(s): person",
+		},
+		{
+			name: "missing_input_from_prompter",
+			opts: &Options{
+				Prompter: PrompterFunc(func(ctx context.Context, reqs []*PromptRequest) (map[string]string, error) {
+					want := []*PromptRequest{{Name: "person", Desc: "The name of a person", Type: "string"}}
+					if diff := cmp.Diff(reqs, want); diff != "" {
+						return nil, fmt.Errorf("prompt requests were not as expected (-got,+want): %s", diff)
+					}
+					return map[string]string{"person": "Dave"}, nil
+				}),
+				PromptBatch: true,
+			},
+			wantFiles: map[string][]byte{
+				"greeting.txt":  []byte("hello Dave"),
+				"dir/other.txt": []byte("other contents"),
+			},
+			wantStdout: "rendered for Dave\n",
+		},
+		{
+			name: "template_exceeds_max_files",
+			opts: &Options{
+				Inputs:   map[string]string{"person": "Bob"},
+				MaxFiles: 3,
+			},
+			wantErr: "there are more than 3 files, which is the limit set by --max-files",
+		},
+		{
+			name: "unknown_hash_algorithm",
+			opts: &Options{
+				Inputs:        map[string]string{"person": "Bob"},
+				HashAlgorithm: "md5",
+			},
+			wantErr: `invalid Options.HashAlgorithm: unknown hash algorithm "md5"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, filepath.Join(tempDir, "template"), templateContents)
+
+			stdout := &bytes.Buffer{}
+			opts := *tc.opts
+			opts.Cwd = tempDir
+			opts.Source = "./template"
+			opts.Stdout = stdout
+			opts.TempDirBase = tempDir
+			if tc.toDestDir {
+				opts.DestDir = "dest"
+			}
+
+			res, err := Render(ctx, &opts)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(res.Files, tc.wantFiles); diff != "" {
+				t.Errorf("rendered files were not as expected (-got,+want): %s", diff)
+			}
+			if tc.toDestDir {
+				got := abctestutil.LoadDirWithoutMode(t, filepath.Join(tempDir, "dest"))
+				if diff := cmp.Diff(got, tc.wantDest); diff != "" {
+					t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
+				}
+			}
+			if got := stdout.String(); got != tc.wantStdout {
+				t.Errorf("stdout was %q, want %q", got, tc.wantStdout)
+			}
+		})
+	}
+}
+
+func TestRender_MissingSource(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	_, err := Render(ctx, &Options{})
+	if diff := testutil.DiffErrString(err, "Options.Source is required"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRender_OnFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	tempDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, filepath.Join(tempDir, "template"), map[string]string{
+		"spec.yaml":     specContents,
+		"greeting.txt":  "hello Alice",
+		"dir/other.txt": "other contents",
+	})
+
+	var gotPaths []string
+	gotFiles := map[string][]byte{}
+	res, err := Render(ctx, &Options{
+		Cwd:    tempDir,
+		Inputs: map[string]string{"person": "Erin"},
+		OnFile: func(path string, contents []byte) error {
+			gotPaths = append(gotPaths, path)
+			gotFiles[path] = contents
+			return nil
+		},
+		Source:      "./template",
+		TempDirBase: tempDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(gotPaths, []string{"dir/other.txt", "greeting.txt"}); diff != "" {
+		t.Errorf("OnFile paths were not as expected (-got,+want): %s", diff)
+	}
+	wantFiles := map[string][]byte{
+		"greeting.txt":  []byte("hello Erin"),
+		"dir/other.txt": []byte("other contents"),
+	}
+	if diff := cmp.Diff(gotFiles, wantFiles); diff != "" {
+		t.Errorf("OnFile contents were not as expected (-got,+want): %s", diff)
+	}
+	if res.Files != nil {
+		t.Errorf("got Result.Files %v, want nil when OnFile is set", res.Files)
+	}
+
+	_, err = Render(ctx, &Options{
+		Cwd:    tempDir,
+		Inputs: map[string]string{"person": "Erin"},
+		OnFile: func(path string, contents []byte) error {
+			return fmt.Errorf("client went away")
+		},
+		Source:      "./template",
+		TempDirBase: tempDir,
+	})
+	if diff := testutil.DiffErrString(err, "client went away"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRender_MemFS(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	mfs := &MemFS{}
+	for name, contents := range map[string]string{
+		"spec.yaml":     specContents,
+		"greeting.txt":  "hello Alice",
+		"dir/other.txt": "other contents",
+	} {
+		if err := mfs.WriteFile(filepath.Join("/template", name), []byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Render(ctx, &Options{
+		Cwd:     "/",
+		DestDir: "/dest",
+		FS:      mfs,
+		Inputs:  map[string]string{"person": "Dana"},
+		Source:  "/template",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := mfs.ReadFile("/dest/greeting.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello Dana"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The temp directories used during rendering should have been cleaned up.
+	entries, err := mfs.ReadDir("/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d leftover temp dirs, want 0", len(entries))
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abcrender
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/input"
+)
+
+// The types in this file are owned by this package, rather than being aliases
+// of types under templates/, so that the internal packages can change without
+// breaking the stability promise of this package.
+
+// MemFS is an in-memory filesystem for Options.FS. The zero value is an empty
+// filesystem that's ready to use. A MemFS is safe for concurrent use.
+type MemFS struct {
+	mfs common.MemFS
+}
+
+// WriteFile creates or overwrites the file at the given absolute path,
+// creating its parent directories if needed.
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	if err := m.mfs.MkdirAll(filepath.Dir(name), common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("MkdirAll(%s): %w", filepath.Dir(name), err)
+	}
+	if err := m.mfs.WriteFile(name, data, common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("WriteFile(%s): %w", name, err)
+	}
+	return nil
+}
+
+// ReadFile returns the contents of the file at the given absolute path.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	return m.mfs.ReadFile(name) //nolint:wrapcheck
+}
+
+// ReadDir returns the entries of the directory at the given absolute path,
+// sorted by name.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return m.mfs.ReadDir(name) //nolint:wrapcheck
+}
+
+// Prompter is asked for the values of inputs that weren't provided, like
+// through a web form or an RPC.
+type Prompter interface {
+	// PromptInputs returns the answers to the given requests, keyed by input
+	// name. An empty or missing answer means the input's default, if it has
+	// one.
+	PromptInputs(ctx context.Context, reqs []*PromptRequest) (map[string]string, error)
+}
+
+// PrompterFunc is a Prompter that's a plain function.
+type PrompterFunc func(ctx context.Context, reqs []*PromptRequest) (map[string]string, error)
+
+// PromptInputs implements Prompter.
+func (f PrompterFunc) PromptInputs(ctx context.Context, reqs []*PromptRequest) (map[string]string, error) {
+	return f(ctx, reqs)
+}
+
+// PromptRequest describes an input that's being asked for.
+type PromptRequest struct {
+	// Name and Desc are from the template's spec.
+	Name string
+	Desc string
+
+	// Type is the input's type, like "string" or "bool". Answers are written
+	// the way a user would type them on the command line, so a list is
+	// comma-separated.
+	Type string
+
+	// Rules are the input's validation rules from the spec, for display. The
+	// answers are validated after all the inputs are known.
+	Rules []*PromptRule
+
+	// Default is the value used if the answer is empty, if HasDefault is
+	// true.
+	Default    string
+	HasDefault bool
+
+	// InferredFrom is the file in the destination that Default was inferred
+	// from, if it was.
+	InferredFrom string
+
+	// Invalid is set when the input is asked for again because the previous
+	// answer couldn't be converted to Type. It says what was wrong with it.
+	Invalid string
+}
+
+// PromptRule is one of an input's validation rules.
+type PromptRule struct {
+	// Rule is the CEL expression that must be true for the input to be
+	// valid.
+	Rule string
+
+	// Message is the optional explanation shown when the rule fails.
+	Message string
+}
+
+// inputPrompter adapts a Prompter to the interface used by the render
+// package.
+type inputPrompter struct {
+	p Prompter
+}
+
+// PromptInputs implements input.InputPrompter.
+func (i *inputPrompter) PromptInputs(ctx context.Context, reqs []*input.PromptRequest) (map[string]string, error) {
+	out := make([]*PromptRequest, 0, len(reqs))
+	for _, req := range reqs {
+		var rules []*PromptRule
+		for _, r := range req.Rules {
+			rules = append(rules, &PromptRule{Rule: r.Rule.Val, Message: r.Message.Val})
+		}
+		out = append(out, &PromptRequest{
+			Name:         req.Name,
+			Desc:         req.Desc,
+			Type:         string(req.Type),
+			Rules:        rules,
+			Default:      req.Default,
+			HasDefault:   req.HasDefault,
+			InferredFrom: req.InferredFrom,
+			Invalid:      req.Invalid,
+		})
+	}
+	return i.p.PromptInputs(ctx, out) //nolint:wrapcheck
+}
+
+// nowClock is the real clock, except that Now is overridden.
+type nowClock struct {
+	clock.Clock
+	now func() time.Time
+}
+
+// Now implements clock.Clock.
+func (n *nowClock) Now() time.Time {
+	return n.now()
+}
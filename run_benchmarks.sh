@@ -0,0 +1,32 @@
+#!/usr/bin/env bash
+
+# This script runs the benchmarks of the render pipeline and saves the results
+# in the standard Go benchmark format, which benchstat can compare. See
+# BENCHMARKING.md.
+#
+# Usage: ./run_benchmarks.sh [output_file]
+#
+# Environment variables:
+#   BENCH        a regex selecting the benchmarks to run (default: all)
+#   BENCH_COUNT  how many times to run each benchmark (default: 6)
+
+set -eEuo pipefail
+
+out="${1:-bench-$(git rev-parse --short HEAD).txt}"
+case "$out" in
+  /*) ;;
+  *) out="$PWD/$out" ;;
+esac
+
+cd "$(dirname "$0")/templates"
+{
+  echo "commit: $(git rev-parse HEAD)"
+  echo "go: $(go env GOVERSION)"
+  go test ./common/ ./common/render/ \
+    -run '^$' \
+    -bench "${BENCH:-.}" \
+    -benchmem \
+    -count "${BENCH_COUNT:-6}"
+} | tee "$out"
+
+echo "Wrote $out; compare it with another run using: benchstat old.txt $out"
@@ -6,7 +6,9 @@
 set -eEuo pipefail
 
 exit_status=0
-for template_dir in $(find . -name 'testdata' | grep -v '/.git/' | xargs dirname) ; do
+# Only testdata directories with golden tests in them belong to templates; Go
+# packages also use testdata, e.g. for fuzzing corpora.
+for template_dir in $(find . -path '*/testdata/golden' -type d | grep -v '/.git/' | xargs dirname | xargs dirname) ; do
     echo "Running golden tests for $template_dir"
     go run cmd/abc/abc.go templates golden-test verify $template_dir
     if [[ $? != "0" ]]; then
@@ -0,0 +1,83 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// formats is the list of every supported output format, with the default
+// first.
+var formats = []string{formatText, formatJSON}
+
+// ListFlags describes which audit log to read and which entries to print.
+type ListFlags struct {
+	// See common/flags.AuditLog().
+	AuditLog string
+
+	// Dest, if set, only lists the entries whose destination is this
+	// directory.
+	Dest string
+
+	// Format is one of the formats in the formats list.
+	Format string
+}
+
+func (r *ListFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("AUDIT OPTIONS")
+
+	f.StringVar(flags.AuditLog(&r.AuditLog))
+
+	f.StringVar(&cli.StringVar{
+		Name:    "dest",
+		Aliases: []string{"d"},
+		Example: "/my/git/dir",
+		Target:  &r.Dest,
+		Predict: predict.Dirs("*"),
+		Usage:   "Only list the renders and upgrades whose destination was this directory.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "format",
+		Example: "json",
+		Target:  &r.Format,
+		Default: formatText,
+		Predict: predict.Set(formats),
+		Usage: fmt.Sprintf(`The output format, one of %s. "json" prints each entry as a line of JSON, like the audit log itself.`,
+			strings.Join(formats, ", ")),
+	})
+
+	set.AfterParse(func(existingErr error) error {
+		if r.AuditLog == "" {
+			return fmt.Errorf("missing --audit-log; it may also be set with the ABC_AUDIT_LOG environment variable")
+		}
+		if !slices.Contains(formats, r.Format) {
+			return fmt.Errorf("--format must be one of %s, but got %q", strings.Join(formats, ", "), r.Format)
+		}
+		return nil
+	})
+}
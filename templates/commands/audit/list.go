@@ -0,0 +1,145 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit implements the audit log related subcommands.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/audit"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type ListCommand struct {
+	cli.BaseCommand
+	flags ListFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *ListCommand) Desc() string {
+	return "list the renders and upgrades recorded in the audit log"
+}
+
+func (c *ListCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+The {{ COMMAND }} command prints the renders and upgrades that were recorded in
+the audit log given by --audit-log or ABC_AUDIT_LOG, oldest first. Each one
+has the time, the command, whether it succeeded, the user, the template source
+and version, and the destination directory.
+`
+}
+
+func (c *ListCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type runParams struct {
+	cwd    string
+	fs     common.FS
+	stdout io.Writer
+}
+
+func (c *ListCommand) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		cwd:    wd,
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *ListCommand) realRun(_ context.Context, rp *runParams) error {
+	entries, err := audit.Read(rp.fs, absPath(rp.cwd, c.flags.AuditLog))
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return fmt.Errorf("there's no audit log at %q; nothing has been recorded yet", c.flags.AuditLog)
+		}
+		return err //nolint:wrapcheck
+	}
+
+	if c.flags.Dest != "" {
+		dest := absPath(rp.cwd, c.flags.Dest)
+		filtered := entries[:0]
+		for _, e := range entries {
+			if filepath.Clean(e.Dest) == dest {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+
+	if c.flags.Format == formatJSON {
+		enc := json.NewEncoder(rp.stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return fmt.Errorf("failed writing audit log entries: %w", err)
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(rp.stdout, 8, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tCOMMAND\tOUTCOME\tUSER\tSOURCE\tVERSION\tDEST")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.UTC().Format(time.RFC3339), e.Command, e.Outcome, orDash(e.User),
+			orDash(e.Source), orDash(e.Version), e.Dest)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed writing audit log entries: %w", err)
+	}
+	return nil
+}
+
+// absPath returns path as a clean absolute path, relative to cwd if it's
+// relative.
+func absPath(cwd, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(cwd, path)
+}
+
+// orDash returns s, or "-" if s is empty, so the columns line up.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/audit"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestListCommand(t *testing.T) {
+	t.Parallel()
+
+	entries := []*audit.Entry{
+		{
+			Time:            time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Command:         audit.CommandRender,
+			User:            "alice",
+			Source:          "github.com/foo/bar@latest",
+			CanonicalSource: "github.com/foo/bar",
+			Version:         "v1.2.3",
+			Dest:            "/work/one",
+			Outcome:         audit.OutcomeSuccess,
+		},
+		{
+			Time:    time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC),
+			Command: audit.CommandRender,
+			User:    "bob",
+			Source:  "./local",
+			Dest:    "/work/two",
+			Outcome: audit.OutcomeFailure,
+			Error:   "missing input(s): name",
+		},
+	}
+
+	cases := []struct {
+		name    string
+		args    []string
+		noLog   bool
+		want    string
+		wantErr string
+	}{
+		{
+			name: "text",
+			want: `TIME                  COMMAND  OUTCOME  USER    SOURCE                     VERSION  DEST
+2024-01-02T03:04:05Z  render   success  alice   github.com/foo/bar@latest  v1.2.3   /work/one
+2024-01-03T03:04:05Z  render   failure  bob     ./local                    -        /work/two
+`,
+		},
+		{
+			name: "json_with_dest",
+			args: []string{"--format=json", "--dest=/work/two/"},
+			want: `{"time":"2024-01-03T03:04:05Z","command":"render","user":"bob","source":"./local","dest":"/work/two","outcome":"failure","error":"missing input(s): name","abc_version":""}
+`,
+		},
+		{
+			name:    "no_log_yet",
+			noLog:   true,
+			wantErr: "there's no audit log at",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "audit.jsonl")
+			if !tc.noLog {
+				for _, e := range entries {
+					if err := audit.Append(&common.RealFS{}, path, e); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			c := &ListCommand{}
+			c.SetLookupEnv(cli.MapLookuper(nil))
+			if err := c.Flags().Parse(append([]string{"--audit-log=" + path}, tc.args...)); err != nil {
+				t.Fatal(err)
+			}
+			stdout := &bytes.Buffer{}
+			err := c.realRun(context.Background(), &runParams{
+				cwd:    dir,
+				fs:     &common.RealFS{},
+				stdout: stdout,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(stdout.String(), tc.want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestListFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "missing_audit_log",
+			args:    []string{},
+			wantErr: "missing --audit-log",
+		},
+		{
+			name:    "bad_format",
+			args:    []string{"--audit-log=a.jsonl", "--format=xml"},
+			wantErr: `--format must be one of text, json, but got "xml"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd ListCommand
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
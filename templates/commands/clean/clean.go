@@ -0,0 +1,429 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clean implements the template clean subcommand, which removes the
+// files that abc leaves behind outside of destination directories.
+package clean
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// The kinds of things that are cleaned up.
+const (
+	kindTempDir = "temp dir"
+	kindLock    = "lock"
+	kindBackup  = "backup"
+	kindCache   = "cache entry"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "remove leftover temporary directories, stale locks, old backups, and cache entries"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] [<dest>...]
+
+The {{ COMMAND }} command removes the files that abc leaves behind:
+
+  - temporary directories that weren't removed because of --keep-temp-dirs or a
+    crash, once they haven't been written to for --max-age;
+  - the lock file in each <dest> directory (default: the current directory), if
+    the render that created it is no longer running on this host, or it was
+    created on another host more than --max-age ago;
+  - backups of overwritten files in ~/.abc/backups that are older than
+    --max-age;
+  - entries in ~/.abc/cache that are older than --max-age, and then the oldest
+    of the rest until the cache is no bigger than --max-cache-size.
+
+Use --dry-run to list what would be removed without removing anything.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type runParams struct {
+	clock   clock.Clock
+	cwd     string
+	fs      common.FS
+	homeDir string
+	host    string
+	stdout  io.Writer
+	tempDir string
+
+	// processExists reports whether a process with the given ID is running
+	// on this host.
+	processExists func(pid int) bool
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home dir: %w", err)
+	}
+	host, _ := os.Hostname()
+
+	return c.realRun(ctx, &runParams{
+		clock:         clock.New(),
+		cwd:           wd,
+		fs:            fSys,
+		homeDir:       homeDir,
+		host:          host,
+		processExists: processExists,
+		stdout:        c.Stdout(),
+		tempDir:       os.TempDir(),
+	})
+}
+
+// item is something to remove.
+type item struct {
+	kind   string
+	path   string
+	size   int64
+	reason string
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(_ context.Context, rp *runParams) error {
+	now := rp.clock.Now()
+
+	var items []*item
+	var merr error
+	add := func(found []*item, err error) {
+		items = append(items, found...)
+		merr = errors.Join(merr, err)
+	}
+	add(c.findTempDirs(rp, now))
+	add(c.findStaleLocks(rp, now))
+	add(c.findBackups(rp, now))
+	add(c.findCacheEntries(rp, now))
+
+	verb := "removed"
+	if c.flags.DryRun {
+		verb = "would remove"
+	}
+	var removed int
+	var freed int64
+	for _, it := range items {
+		if !c.flags.DryRun {
+			if err := rp.fs.RemoveAll(it.path); err != nil {
+				merr = errors.Join(merr, fmt.Errorf("failed removing %s %q: %w", it.kind, it.path, err))
+				continue
+			}
+		}
+		removed++
+		freed += it.size
+		fmt.Fprintf(rp.stdout, "%s %s %s (%s): %s\n", verb, it.kind, it.path, common.FormatBytes(it.size), it.reason)
+	}
+
+	if removed == 0 {
+		fmt.Fprintln(rp.stdout, "nothing to clean up")
+	} else {
+		fmt.Fprintf(rp.stdout, "%s %d item(s), freeing %s\n", verb, removed, common.FormatBytes(freed))
+	}
+	return merr
+}
+
+// findTempDirs returns the temporary directories that abc created, and that
+// haven't been modified for --max-age, so they're not in use by a render
+// that's still running.
+func (c *Command) findTempDirs(rp *runParams, now time.Time) ([]*item, error) {
+	entries, err := fs.ReadDir(rp.fs, rp.tempDir)
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed reading the temporary directory %q: %w", rp.tempDir, err)
+	}
+	var out []*item
+	for _, e := range entries {
+		if !e.IsDir() || !tempdir.IsTempDirName(e.Name()) {
+			continue
+		}
+		path := filepath.Join(rp.tempDir, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed getting the info of %q: %w", path, err)
+		}
+		age := now.Sub(info.ModTime())
+		if age < c.flags.MaxAge {
+			continue
+		}
+		size, err := dirSize(rp.fs, path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &item{
+			kind:   kindTempDir,
+			path:   path,
+			size:   size,
+			reason: "last modified " + formatAge(age) + " ago",
+		})
+	}
+	return out, nil
+}
+
+// findStaleLocks returns the lock files in the --dest directories whose
+// holder is no longer running. If the holder is on another host, there's no
+// way to check that, so it's stale if it's older than --max-age.
+func (c *Command) findStaleLocks(rp *runParams, now time.Time) ([]*item, error) {
+	var out []*item
+	for _, dest := range c.flags.Dests {
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(rp.cwd, dest)
+		}
+		path := filepath.Join(dest, common.ABCInternalDir, common.ABCLockFile)
+		info, err := rp.fs.Stat(path)
+		if err != nil {
+			if common.IsStatNotExistErr(err) {
+				continue
+			}
+			return nil, fmt.Errorf("Stat(): %w", err)
+		}
+		buf, err := rp.fs.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading lock file %q: %w", path, err)
+		}
+
+		since := info.ModTime()
+		holder, ok := common.ParseLockHolder(string(buf))
+		if ok {
+			if holder.Host == rp.host {
+				if rp.processExists(holder.PID) {
+					continue
+				}
+				out = append(out, &item{
+					kind:   kindLock,
+					path:   path,
+					size:   info.Size(),
+					reason: fmt.Sprintf("process %d that held it is no longer running", holder.PID),
+				})
+				continue
+			}
+			since = holder.Since
+		}
+		age := now.Sub(since)
+		if age < c.flags.MaxAge {
+			continue
+		}
+		out = append(out, &item{
+			kind:   kindLock,
+			path:   path,
+			size:   info.Size(),
+			reason: "held for " + formatAge(age),
+		})
+	}
+	return out, nil
+}
+
+// findBackups returns the backup directories in ~/.abc/backups that are older
+// than --max-age. Each one is named after the Unix time of the render that
+// created it.
+func (c *Command) findBackups(rp *runParams, now time.Time) ([]*item, error) {
+	backupsDir := filepath.Join(rp.homeDir, ".abc", "backups")
+	entries, err := fs.ReadDir(rp.fs, backupsDir)
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed reading the backups directory %q: %w", backupsDir, err)
+	}
+	var out []*item
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		path := filepath.Join(backupsDir, e.Name())
+		var created time.Time
+		if secs, err := strconv.ParseInt(e.Name(), 10, 64); err == nil {
+			created = time.Unix(secs, 0)
+		} else {
+			info, err := e.Info()
+			if err != nil {
+				return nil, fmt.Errorf("failed getting the info of %q: %w", path, err)
+			}
+			created = info.ModTime()
+		}
+		age := now.Sub(created)
+		if age < c.flags.MaxAge {
+			continue
+		}
+		size, err := dirSize(rp.fs, path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &item{
+			kind:   kindBackup,
+			path:   path,
+			size:   size,
+			reason: "created " + formatAge(age) + " ago",
+		})
+	}
+	return out, nil
+}
+
+// cacheFile is a file in the cache.
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// findCacheEntries returns the files in ~/.abc/cache that are older than
+// --max-age, and then the oldest of the rest until the total size of what's
+// left is within --max-cache-size.
+func (c *Command) findCacheEntries(rp *runParams, now time.Time) ([]*item, error) {
+	cacheDir := filepath.Join(rp.homeDir, ".abc", "cache")
+	var files []*cacheFile
+	err := fs.WalkDir(rp.fs, cacheDir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if path == cacheDir && common.IsStatNotExistErr(err) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return fmt.Errorf("failed getting the info of %q: %w", path, err)
+		}
+		files = append(files, &cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading the cache directory %q: %w", cacheDir, err)
+	}
+
+	// Newest first, so the ones that are kept are the most recently written.
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.After(files[j].modTime)
+		}
+		return files[i].path < files[j].path
+	})
+
+	var out []*item
+	var kept int64
+	for _, f := range files {
+		age := now.Sub(f.modTime)
+		var reason string
+		switch {
+		case age >= c.flags.MaxAge:
+			reason = "last written " + formatAge(age) + " ago"
+		case kept+f.size > c.flags.MaxCacheSize:
+			reason = fmt.Sprintf("the cache is bigger than %s", common.FormatBytes(c.flags.MaxCacheSize))
+		default:
+			kept += f.size
+			continue
+		}
+		out = append(out, &item{kind: kindCache, path: f.path, size: f.size, reason: reason})
+	}
+	return out, nil
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(rfs common.FS, dir string) (int64, error) {
+	var size int64
+	err := fs.WalkDir(rfs, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed getting the size of %q: %w", dir, err)
+	}
+	return size, nil
+}
+
+// formatAge formats d in the largest whole unit, like "3 days" or "5 hours".
+func formatAge(d time.Duration) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case d >= 24*time.Hour:
+		return plural(int64(d/(24*time.Hour)), "day")
+	case d >= time.Hour:
+		return plural(int64(d/time.Hour), "hour")
+	default:
+		return plural(int64(d/time.Minute), "minute")
+	}
+}
+
+// processExists reports whether a process with the given ID is running on this
+// host. Signal 0 checks that the process exists without signaling it; a
+// permission error means that it exists but belongs to another user.
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
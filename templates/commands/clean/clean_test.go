@@ -0,0 +1,307 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clean
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-10 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	// The files to create, relative to the root of the test, and their
+	// modification times.
+	files := map[string]time.Time{
+		// Temp dirs.
+		"tmp/scratch-123/a.txt":       old,
+		"tmp/template-copy-456/b.txt": recent,
+		"tmp/scratch-notabc/c.txt":    old,
+		"tmp/unrelated/d.txt":         old,
+
+		// Backups, named after the Unix time they were created.
+		fmt.Sprintf("home/.abc/backups/%d/a.txt", old.Unix()):    recent,
+		fmt.Sprintf("home/.abc/backups/%d/b.txt", recent.Unix()): recent,
+
+		// Cache entries of 10 bytes each.
+		"home/.abc/cache/github-tags/old.json":     old,
+		"home/.abc/cache/github-tags/newest.json":  recent,
+		"home/.abc/cache/github-tags/newer.json":   recent.Add(-time.Minute),
+		"home/.abc/cache/github-tags/over.json":    recent.Add(-2 * time.Minute),
+		"home/.abc/cache/github-tags/another.json": recent.Add(-3 * time.Minute),
+
+		"dest/README.md": recent,
+	}
+
+	cases := []struct {
+		name      string
+		args      []string
+		lock      string
+		processes []int
+		want      []string
+		wantGone  []string
+	}{
+		{
+			name: "nothing_to_clean",
+			args: []string{"--max-age=1000h", "--max-cache-size=1000"},
+			want: []string{"nothing to clean up"},
+		},
+		{
+			name: "removes_old_things",
+			args: []string{"--max-cache-size=25"},
+			want: []string{
+				"removed temp dir ROOT/tmp/scratch-123 (4 B): last modified 10 days ago",
+				fmt.Sprintf("removed backup ROOT/home/.abc/backups/%d (4 B): created 10 days ago", old.Unix()),
+				"removed cache entry ROOT/home/.abc/cache/github-tags/over.json (10 B): the cache is bigger than 25 B",
+				"removed cache entry ROOT/home/.abc/cache/github-tags/another.json (10 B): the cache is bigger than 25 B",
+				"removed cache entry ROOT/home/.abc/cache/github-tags/old.json (10 B): last written 10 days ago",
+				"removed 5 item(s), freeing 38 B",
+			},
+			wantGone: []string{
+				"tmp/scratch-123",
+				fmt.Sprintf("home/.abc/backups/%d", old.Unix()),
+				"home/.abc/cache/github-tags/over.json",
+				"home/.abc/cache/github-tags/another.json",
+				"home/.abc/cache/github-tags/old.json",
+			},
+		},
+		{
+			name: "dry_run",
+			args: []string{"--dry-run", "--max-cache-size=1000"},
+			want: []string{
+				"would remove temp dir ROOT/tmp/scratch-123 (4 B): last modified 10 days ago",
+				fmt.Sprintf("would remove backup ROOT/home/.abc/backups/%d (4 B): created 10 days ago", old.Unix()),
+				"would remove cache entry ROOT/home/.abc/cache/github-tags/old.json (10 B): last written 10 days ago",
+				"would remove 3 item(s), freeing 18 B",
+			},
+		},
+		{
+			name: "lock_of_dead_process",
+			args: []string{"--max-age=1000h", "--max-cache-size=1000", "dest"},
+			lock: fmt.Sprintf("pid 1234 on host %q since %s\n", "this-host", recent.Format(time.RFC3339)),
+			want: []string{
+				"removed lock ROOT/dest/.abc/lock (LOCKSIZE): process 1234 that held it is no longer running",
+				"removed 1 item(s), freeing LOCKSIZE",
+			},
+			wantGone: []string{"dest/.abc/lock"},
+		},
+		{
+			name:      "lock_of_running_process",
+			args:      []string{"--max-age=1000h", "--max-cache-size=1000", "dest"},
+			lock:      fmt.Sprintf("pid 1234 on host %q since %s\n", "this-host", old.Format(time.RFC3339)),
+			processes: []int{1234},
+			want:      []string{"nothing to clean up"},
+		},
+		{
+			name: "old_lock_on_another_host",
+			args: []string{"--max-cache-size=1000", "dest"},
+			lock: fmt.Sprintf("pid 1234 on host %q since %s\n", "other-host", old.Format(time.RFC3339)),
+			want: []string{
+				"removed temp dir ROOT/tmp/scratch-123 (4 B): last modified 10 days ago",
+				"removed lock ROOT/dest/.abc/lock (LOCKSIZE): held for 10 days",
+				fmt.Sprintf("removed backup ROOT/home/.abc/backups/%d (4 B): created 10 days ago", old.Unix()),
+				"removed cache entry ROOT/home/.abc/cache/github-tags/old.json (10 B): last written 10 days ago",
+				"removed 4 item(s), freeing 75 B",
+			},
+			wantGone: []string{
+				"tmp/scratch-123",
+				fmt.Sprintf("home/.abc/backups/%d", old.Unix()),
+				"home/.abc/cache/github-tags/old.json",
+				"dest/.abc/lock",
+			},
+		},
+		{
+			name: "recent_lock_on_another_host",
+			args: []string{"--max-age=100h", "--max-cache-size=1000", "dest"},
+			lock: fmt.Sprintf("pid 1234 on host %q since %s\n", "other-host", recent.Format(time.RFC3339)),
+			want: []string{
+				"removed temp dir ROOT/tmp/scratch-123 (4 B): last modified 10 days ago",
+				fmt.Sprintf("removed backup ROOT/home/.abc/backups/%d (4 B): created 10 days ago", old.Unix()),
+				"removed cache entry ROOT/home/.abc/cache/github-tags/old.json (10 B): last written 10 days ago",
+				"removed 3 item(s), freeing 18 B",
+			},
+			wantGone: []string{
+				"tmp/scratch-123",
+				fmt.Sprintf("home/.abc/backups/%d", old.Unix()),
+				"home/.abc/cache/github-tags/old.json",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			contents := make(map[string]string, len(files))
+			for path := range files {
+				contents[path] = "abcd"
+				if strings.HasSuffix(path, ".json") {
+					contents[path] = "0123456789"
+				}
+			}
+			if tc.lock != "" {
+				contents["dest/.abc/lock"] = tc.lock
+			}
+			abctestutil.WriteAllDefaultMode(t, root, contents)
+			for path, mtime := range files {
+				if err := os.Chtimes(filepath.Join(root, path), mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// The directories' modification times are what count for temp dirs.
+			for _, dir := range []string{"tmp/scratch-123", "tmp/scratch-notabc", "tmp/unrelated"} {
+				if err := os.Chtimes(filepath.Join(root, dir), old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Chtimes(filepath.Join(root, "tmp/template-copy-456"), recent, recent); err != nil {
+				t.Fatal(err)
+			}
+
+			c := &Command{}
+			c.SetLookupEnv(cli.MapLookuper(nil))
+			if err := c.Flags().Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			clk := clock.NewMock()
+			clk.Set(now)
+			stdout := &strings.Builder{}
+			err := c.realRun(context.Background(), &runParams{
+				clock:   clk,
+				cwd:     root,
+				fs:      &common.RealFS{},
+				homeDir: filepath.Join(root, "home"),
+				host:    "this-host",
+				processExists: func(pid int) bool {
+					for _, p := range tc.processes {
+						if p == pid {
+							return true
+						}
+					}
+					return false
+				},
+				stdout:  stdout,
+				tempDir: filepath.Join(root, "tmp"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := strings.Join(tc.want, "\n") + "\n"
+			want = strings.ReplaceAll(want, "ROOT", root)
+			want = strings.ReplaceAll(want, "LOCKSIZE", common.FormatBytes(int64(len(tc.lock))))
+			if diff := cmp.Diff(stdout.String(), want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+
+			isGone := make(map[string]bool)
+			for _, path := range tc.wantGone {
+				isGone[path] = true
+			}
+			for path := range contents {
+				dir := path
+				gone := false
+				for ; dir != "."; dir = filepath.Dir(dir) {
+					gone = gone || isGone[dir]
+				}
+				_, err := os.Stat(filepath.Join(root, path))
+				if exists := err == nil; exists == gone {
+					t.Errorf("%s exists is %t, want %t", path, exists, !gone)
+				}
+			}
+		})
+	}
+}
+
+func TestFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    Flags
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: Flags{
+				Dests:        []string{"."},
+				MaxAge:       defaultMaxAge,
+				MaxCacheSize: defaultMaxCacheSize,
+			},
+		},
+		{
+			name: "all_flags",
+			args: []string{"--dry-run", "--max-age=24h", "--max-cache-size=1024", "a", "b"},
+			want: Flags{
+				Dests:        []string{"a", "b"},
+				DryRun:       true,
+				MaxAge:       24 * time.Hour,
+				MaxCacheSize: 1024,
+			},
+		},
+		{
+			name:    "negative_max_age",
+			args:    []string{"--max-age=-1h"},
+			wantErr: "--max-age must not be negative",
+		},
+		{
+			name:    "negative_max_cache_size",
+			args:    []string{"--max-cache-size=-1"},
+			wantErr: "--max-cache-size must not be negative",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := &Command{}
+			c.SetLookupEnv(cli.MapLookuper(nil))
+			err := c.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(c.flags, tc.want); diff != "" {
+				t.Errorf("flags were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clean
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/abcxyz/pkg/cli"
+)
+
+// These are the defaults of --max-age and --max-cache-size.
+const (
+	defaultMaxAge       = 7 * 24 * time.Hour
+	defaultMaxCacheSize = 100 * 1024 * 1024
+)
+
+// Flags describes what to clean up.
+type Flags struct {
+	// Positional arguments:
+
+	// Dests are the destination directories to look for stale locks in.
+	// Defaults to the current directory.
+	Dests []string
+
+	// Flag arguments (--foo):
+
+	// DryRun lists what would be removed, without removing anything.
+	DryRun bool
+
+	// MaxAge is how old a temporary directory, backup, or cache entry must be
+	// before it's removed, and how long a lock may be held by a process on
+	// another host before it's considered stale.
+	MaxAge time.Duration
+
+	// MaxCacheSize is the total size in bytes that the cache is trimmed to,
+	// by removing the least recently written entries.
+	MaxCacheSize int64
+}
+
+func (r *Flags) Register(set *cli.FlagSet) {
+	f := set.NewSection("CLEAN OPTIONS")
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "dry-run",
+		Target:  &r.DryRun,
+		Default: false,
+		Usage:   "List what would be removed, and how much space it would free, without removing anything.",
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "max-age",
+		Example: "24h",
+		Target:  &r.MaxAge,
+		Default: defaultMaxAge,
+		Usage: "Remove temporary directories, backups, and cache entries that haven't been written to for this long, " +
+			"and locks that have been held this long by a process on another host.",
+	})
+
+	f.Int64Var(&cli.Int64Var{
+		Name:    "max-cache-size",
+		Example: "1048576",
+		Target:  &r.MaxCacheSize,
+		Default: defaultMaxCacheSize,
+		Usage:   "The size in bytes to trim the cache to, by removing the oldest entries.",
+	})
+
+	set.AfterParse(func(existingErr error) error {
+		if r.MaxAge < 0 {
+			return fmt.Errorf("--max-age must not be negative, but got %s", r.MaxAge)
+		}
+		if r.MaxCacheSize < 0 {
+			return fmt.Errorf("--max-cache-size must not be negative, but got %d", r.MaxCacheSize)
+		}
+		r.Dests = set.Args()
+		if len(r.Dests) == 0 {
+			r.Dests = []string{"."}
+		}
+		return nil
+	})
+}
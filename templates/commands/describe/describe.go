@@ -22,6 +22,8 @@ import (
 	"os"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/diagnostic"
+	"github.com/abcxyz/abc/templates/common/extends"
 	"github.com/abcxyz/abc/templates/common/specutil"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
@@ -58,6 +60,10 @@ are accepted:
 - (Deprecated) A go-getter-style location, with or without ?ref=foo. Examples:
     - github.com/abcxyz/abc.git//t/react_template?ref=latest
 	- github.com/abcxyz/abc.git//t/react_template
+
+With --format=json, the description and inputs are printed as a JSON report,
+along with any problems that were found loading the template, with the file,
+line, column, severity, and code of each one, for editors and other tools.
 `
 }
 
@@ -87,39 +93,119 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 }
 
 // realRun provides a fakeable interface to test Run.
-func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
+func (c *Command) realRun(ctx context.Context, rp *runParams) error {
+	if c.flags.Format != diagnostic.FormatJSON {
+		_, merged, err := c.load(ctx, rp)
+		if err != nil {
+			return err
+		}
+		specutil.FormatAttrs(c.Stdout(), c.specFieldsForDescribe(merged))
+		return nil
+	}
+
+	report := diagnostic.NewReport("describe", c.flags.Source)
+	own, merged, err := c.load(ctx, rp)
+	if err != nil {
+		report.AddError(specutil.SpecFileName, err)
+	} else {
+		report.Template = describeTemplate(own, merged)
+	}
+	if err := report.Write(rp.stdout); err != nil {
+		return err //nolint:wrapcheck
+	}
+	if n := report.ErrorCount(); n > 0 {
+		return fmt.Errorf("found %d problem(s) in the template", n)
+	}
+	return nil
+}
+
+// load downloads the template and its base templates, and returns its own
+// spec and the spec merged with those of the bases. The errors are marked
+// with diagnostic codes.
+func (c *Command) load(ctx context.Context, rp *runParams) (_, _ *spec.Spec, rErr error) {
 	tempTracker := tempdir.NewDirTracker(rp.fs, false)
 	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
 
 	cwd, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("os.Getwd(): %w", err)
+		return nil, nil, fmt.Errorf("os.Getwd(): %w", err)
 	}
 
 	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
 	if err != nil {
-		return fmt.Errorf("failed to create temporary directory to use as template directory: %w", err)
+		return nil, nil, fmt.Errorf("failed to create temporary directory to use as template directory: %w", err)
 	}
 	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
 		CWD:         cwd,
 		Source:      c.flags.Source,
 		GitProtocol: c.flags.GitProtocol,
+		FS:          rp.fs,
 	})
 	if err != nil {
-		return err //nolint:wrapcheck
+		return nil, nil, diagnostic.WithCode(diagnostic.CodeDownloadFailed, err)
 	}
 
 	if _, err = downloader.Download(ctx, cwd, templateDir); err != nil {
-		return fmt.Errorf("failed to download/copy template: %w", err)
+		return nil, nil, diagnostic.WithCode(diagnostic.CodeDownloadFailed, fmt.Errorf("failed to download/copy template: %w", err))
 	}
 
 	spec, err := specutil.Load(ctx, rp.fs, templateDir, c.flags.Source)
 	if err != nil {
-		return err //nolint:wrapcheck
+		return nil, nil, diagnostic.WithCode(diagnostic.CodeSpecInvalid, err)
 	}
 
-	specutil.FormatAttrs(c.Stdout(), c.specFieldsForDescribe(spec))
-	return nil
+	// Describe the inputs inherited from base templates too, since they're
+	// all needed to render the template.
+	bases, err := extends.Resolve(ctx, &extends.ResolveParams{
+		Cwd:         cwd,
+		Downloader:  downloader,
+		FS:          rp.fs,
+		GitProtocol: c.flags.GitProtocol,
+		Spec:        spec,
+		TemplateDir: templateDir,
+		Tracker:     tempTracker,
+	})
+	if err != nil {
+		return nil, nil, diagnostic.WithCode(diagnostic.CodeBaseTemplateFailed, err)
+	}
+	return spec, extends.Merge(bases, spec), nil
+}
+
+// describeTemplate describes the merged spec for the JSON report. Only the
+// inputs that are in own, the template's own spec, have positions, since the
+// others are in the spec files of base templates.
+func describeTemplate(own, merged *spec.Spec) *diagnostic.Template {
+	ownInputs := make(map[*spec.Input]struct{}, len(own.Inputs))
+	for _, in := range own.Inputs {
+		ownInputs[in] = struct{}{}
+	}
+
+	out := &diagnostic.Template{
+		Description: merged.Desc.Val,
+		Inputs:      make([]*diagnostic.Input, 0, len(merged.Inputs)),
+	}
+	for _, in := range merged.Inputs {
+		d := &diagnostic.Input{
+			Name:        in.Name.Val,
+			Description: in.Desc.Val,
+			Type:        in.Type.Val,
+			DefaultFrom: in.DefaultFrom.Val,
+		}
+		if d.Type == "" {
+			d.Type = "string"
+		}
+		if in.Default != nil {
+			d.Default = &in.Default.Val
+		}
+		for _, r := range in.Rules {
+			d.Rules = append(d.Rules, &diagnostic.Rule{Rule: r.Rule.Val, Message: r.Message.Val})
+		}
+		if _, ok := ownInputs[in]; ok {
+			d.Line, d.Column = in.Pos.Line, in.Pos.Column
+		}
+		out.Inputs = append(out.Inputs, d)
+	}
+	return out
 }
 
 // specFieldsForDescribe get Description and Inputs fields for spec.
@@ -44,11 +44,13 @@ func TestDescribeFlags_Parse(t *testing.T) {
 			name: "all_flags_present",
 			args: []string{
 				"--git-protocol", "https",
+				"--format", "json",
 				"helloworld@v1",
 			},
 			want: DescribeFlags{
 				Source:      "helloworld@v1",
 				GitProtocol: "https",
+				Format:      "json",
 			},
 		},
 		{
@@ -59,6 +61,7 @@ func TestDescribeFlags_Parse(t *testing.T) {
 			want: DescribeFlags{
 				Source:      "helloworld@v1",
 				GitProtocol: "https",
+				Format:      "text",
 			},
 		},
 		{
@@ -66,6 +69,11 @@ func TestDescribeFlags_Parse(t *testing.T) {
 			args:    []string{},
 			wantErr: "missing <source> file",
 		},
+		{
+			name:    "invalid_format",
+			args:    []string{"--format", "yaml", "helloworld@v1"},
+			wantErr: `invalid --format: invalid format "yaml", must be one of text, json`,
+		},
 	}
 
 	for _, tc := range cases {
@@ -119,7 +127,9 @@ steps:
 	cases := []struct {
 		name             string
 		templateContents map[string]string
+		format           string
 		wantAttrList     [][]string
+		wantJSON         string
 		wantErr          string
 	}{
 		{
@@ -139,6 +149,93 @@ steps:
 				{"Description", "desc2"},
 			},
 		},
+		{
+			name:   "json_with_extends",
+			format: "json",
+			templateContents: map[string]string{
+				"base/spec.yaml": specContents,
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'Derived Description'
+extends: './base'
+inputs:
+  - name: 'name2'
+    desc: 'desc2 overridden'
+    type: 'int'
+    default_from: 'size(name1)'
+steps:
+  - desc: 'Print a message'
+    action: 'print'
+    params:
+      message: 'hello'
+`,
+			},
+			wantJSON: `{
+  "schema_version": 1,
+  "command": "describe",
+  "source": "SOURCE",
+  "diagnostics": [],
+  "template": {
+    "description": "Derived Description",
+    "inputs": [
+      {
+        "name": "name1",
+        "description": "desc1",
+        "type": "string",
+        "default": ".",
+        "rules": [
+          {
+            "rule": "test rule 0",
+            "message": "test rule 0 message"
+          },
+          {
+            "rule": "test rule 1"
+          }
+        ]
+      },
+      {
+        "name": "name2",
+        "description": "desc2 overridden",
+        "type": "int",
+        "default_from": "size(name1)",
+        "line": 6,
+        "column": 5
+      }
+    ]
+  }
+}
+`,
+		},
+		{
+			name:   "json_invalid_spec",
+			format: "json",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Print a message'
+    action: 'print'
+`,
+			},
+			wantJSON: `{
+  "schema_version": 1,
+  "command": "describe",
+  "source": "SOURCE",
+  "diagnostics": [
+    {
+      "file": "spec.yaml",
+      "line": 5,
+      "column": 5,
+      "severity": "error",
+      "code": "spec_invalid",
+      "message": "error reading template spec file: validation failed in spec.yaml: field \"message\" is required"
+    }
+  ]
+}
+`,
+			wantErr: "found 1 problem(s) in the template",
+		},
 		{
 			name: "failed to read spec file",
 			templateContents: map[string]string{
@@ -167,6 +264,7 @@ steps:
 			r := &Command{
 				flags: DescribeFlags{
 					Source: sourceDir,
+					Format: tc.format,
 				},
 			}
 
@@ -182,6 +280,12 @@ steps:
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Error(diff)
 			}
+			if tc.format == "json" {
+				wantJSON := strings.ReplaceAll(tc.wantJSON, "SOURCE", sourceDir)
+				if diff := cmp.Diff(stdoutBuf.String(), wantJSON); diff != "" {
+					t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+				}
+			}
 		})
 	}
 }
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/abcxyz/abc/templates/common/diagnostic"
 	"github.com/abcxyz/abc/templates/common/flags"
 	"github.com/abcxyz/pkg/cli"
 )
@@ -31,9 +32,15 @@ type DescribeFlags struct {
 
 	// GitProtocol either https or ssh.
 	GitProtocol string
+
+	// See common/flags.DiagnosticFormat().
+	Format string
 }
 
 func (r *DescribeFlags) Register(set *cli.FlagSet) {
+	o := set.NewSection("OUTPUT OPTIONS")
+	o.StringVar(flags.DiagnosticFormat(&r.Format))
+
 	g := set.NewSection("GIT OPTIONS")
 	g.StringVar(flags.GitProtocol(&r.GitProtocol))
 
@@ -43,6 +50,9 @@ func (r *DescribeFlags) Register(set *cli.FlagSet) {
 		if r.Source == "" {
 			return fmt.Errorf("missing <source> file")
 		}
+		if err := diagnostic.ValidateFormat(r.Format); err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
 
 		return nil
 	})
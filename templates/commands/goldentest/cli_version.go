@@ -0,0 +1,121 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+// This file implements the --cli-version flag of "templates golden-test verify".
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/clirelease"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+)
+
+// fetchCLI returns the path of the abc binary of a released version, which is
+// downloaded into ~/.abc/cache/cli the first time.
+func fetchCLI(ctx context.Context, rfs common.FS, version string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home dir: %w", err)
+	}
+	return clirelease.Fetch(ctx, &clirelease.FetchParams{ //nolint:wrapcheck
+		Version:  version,
+		CacheDir: filepath.Join(homeDir, ".abc", "cache", "cli"),
+		FS:       rfs,
+	})
+}
+
+// checkGoldenDirFlag returns an error if the released abc at bin doesn't have
+// the --golden-dir flag of "golden-test record", which recordWithRelease needs.
+// Releases from before --golden-dir was added don't know it, so they'd fail
+// with a confusing usage error.
+func checkGoldenDirFlag(ctx context.Context, bin, version string) error {
+	// Help is printed to stderr.
+	out, err := exec.CommandContext(ctx, bin, "templates", "golden-test", "record", "-help").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed running abc %s: %w\n%s", version, err, out)
+	}
+	if !bytes.Contains(out, []byte("-golden-dir=")) {
+		return fmt.Errorf("abc %s is too old for --cli-version, which needs a release that has the --golden-dir flag of "+
+			`"golden-test record"; that's the same release that added --cli-version`, version)
+	}
+	return nil
+}
+
+// recordWithRelease records the test cases with the released abc of
+// --cli-version, into a new temporary directory with the same layout as the
+// one that renderTestCases returns. Only the test.yaml of each test case is
+// copied there, and the released abc is run with its --golden-dir pointing to
+// it, so the template and its recorded files aren't touched.
+func (c *VerifyCommand) recordWithRelease(ctx context.Context, rfs common.FS, tempTracker *tempdir.DirTracker, testCases []*TestCase) (string, error) {
+	fetch := c.testFetchCLI
+	if fetch == nil {
+		fetch = fetchCLI
+	}
+	bin, err := fetch(ctx, rfs, c.flags.CLIVersion)
+	if err != nil {
+		return "", fmt.Errorf("failed to get abc %s: %w", c.flags.CLIVersion, err)
+	}
+	if err := checkGoldenDirFlag(ctx, bin, c.flags.CLIVersion); err != nil {
+		return "", err
+	}
+
+	tempDir, err := tempTracker.MkdirTempTracked("", tempdir.GoldenTestRenderNamePart)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	goldenDir := filepath.Join(tempDir, goldenTestDir)
+
+	names := make([]string, 0, len(testCases))
+	for _, tc := range testCases {
+		buf, err := rfs.ReadFile(filepath.Join(c.flags.GoldenDir, tc.TestName, configName))
+		if err != nil {
+			return "", fmt.Errorf("failed reading test config: %w", err)
+		}
+		testDir := filepath.Join(goldenDir, tc.TestName)
+		if err := rfs.MkdirAll(testDir, common.OwnerRWXPerms); err != nil {
+			return "", fmt.Errorf("MkdirAll(): %w", err)
+		}
+		if err := rfs.WriteFile(filepath.Join(testDir, configName), buf, common.OwnerRWPerms); err != nil {
+			return "", fmt.Errorf("failed writing test config: %w", err)
+		}
+		names = append(names, tc.TestName)
+	}
+	if len(names) == 0 {
+		return tempDir, nil
+	}
+
+	args := []string{
+		"templates", "golden-test", "record",
+		"--golden-dir=" + goldenDir,
+		"--test-name=" + strings.Join(names, ","),
+		c.flags.Location,
+	}
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("abc %s failed to record the tests: %w\n%s", c.flags.CLIVersion, err, out.String())
+	}
+	return tempDir, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/render"
+)
+
+// coverageReport summarizes which spec steps ran during the golden tests, for
+// --coverage. It lists the steps that never ran, and the steps whose "if"
+// condition was always true or always false, since these are the conditional
+// paths that the tests don't exercise.
+func coverageReport(steps []*render.StepCoverage) string {
+	var ran int
+	var gaps []string
+	for _, s := range steps {
+		if s.Ran > 0 {
+			ran++
+		}
+
+		var gap string
+		switch {
+		case s.Ran == 0 && s.SkippedByIf > 0:
+			gap = `never ran, because its "if" condition was always false`
+		case s.Ran == 0:
+			gap = "never ran"
+		case s.HasIf && s.SkippedByIf == 0:
+			gap = `was never skipped, because its "if" condition was always true`
+		default:
+			continue
+		}
+
+		where := "spec.yaml"
+		if s.Template != "" {
+			where = fmt.Sprintf("base template %q", s.Template)
+		}
+		gaps = append(gaps, fmt.Sprintf("  %s line %d: step %q (action %s) %s",
+			where, s.Line, s.Desc, s.Action, gap))
+	}
+
+	sb := &strings.Builder{}
+	pct := 100
+	if len(steps) > 0 {
+		pct = ran * 100 / len(steps)
+	}
+	fmt.Fprintf(sb, "\nStep Coverage: %d of %d steps ran in at least one test (%d%%)\n", ran, len(steps), pct)
+	for _, g := range gaps {
+		fmt.Fprintln(sb, g)
+	}
+	return sb.String()
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common/render"
+)
+
+func TestCoverageReport(t *testing.T) {
+	t.Parallel()
+
+	steps := []*render.StepCoverage{
+		{Template: "../base", Line: 5, Action: "include", Desc: "Base step", Ran: 1},
+		{Line: 10, Action: "print", Desc: "Covered", HasIf: true, Ran: 1, SkippedByIf: 1},
+		{Line: 15, Action: "print", Desc: "Always true", HasIf: true, Ran: 2},
+		{Line: 20, Action: "print", Desc: "Always false", HasIf: true, SkippedByIf: 2},
+		{Line: 25, Action: "print", Desc: "Unreached"},
+	}
+
+	got := coverageReport(steps)
+	want := `
+Step Coverage: 3 of 5 steps ran in at least one test (60%)
+  spec.yaml line 15: step "Always true" (action print) was never skipped, because its "if" condition was always true
+  spec.yaml line 20: step "Always false" (action print) never ran, because its "if" condition was always false
+  spec.yaml line 25: step "Unreached" (action print) never ran
+`
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("coverage report was not as expected (-got,+want): %s", diff)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffOptions controls how file content mismatches are shown by the verify
+// subcommand.
+type diffOptions struct {
+	// contextLines is the number of unchanged lines to show around each
+	// changed line.
+	contextLines int
+
+	// maxLines is the maximum number of lines of diff to show for a single
+	// file. Zero means no limit.
+	maxLines int
+
+	// red and green color removed and added lines. They may be fmt.Sprint if
+	// color isn't wanted.
+	red, green func(a ...any) string
+}
+
+// diffLine is one line of a line-oriented diff.
+type diffLine struct {
+	op   diffmatchpatch.Operation
+	text string // without the trailing newline, if any
+	// noNewline is true for the last line of a file that doesn't end in a
+	// newline.
+	noNewline bool
+}
+
+// lineDiff returns the line-by-line differences between the recorded golden
+// content and the actual content.
+func lineDiff(dmp *diffmatchpatch.DiffMatchPatch, golden, actual string) []diffLine {
+	goldenChars, actualChars, lines := dmp.DiffLinesToChars(golden, actual)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(goldenChars, actualChars, false), lines)
+
+	var out []diffLine
+	for _, d := range diffs {
+		text := d.Text
+		for text != "" {
+			line, rest, found := strings.Cut(text, "\n")
+			out = append(out, diffLine{op: d.Type, text: line, noNewline: !found})
+			text = rest
+		}
+	}
+	return out
+}
+
+// formatDiff renders the given line diff like a unified diff, with lines only
+// in the golden content prefixed with "-" and lines only in the actual content
+// prefixed with "+". Runs of unchanged lines far away from any change are
+// elided, and the output is truncated after opts.maxLines lines.
+func formatDiff(lines []diffLine, opts *diffOptions) string {
+	// Decide which lines to show: every changed line, plus unchanged lines
+	// within contextLines of a changed line.
+	show := make([]bool, len(lines))
+	for i, l := range lines {
+		if l.op == diffmatchpatch.DiffEqual {
+			continue
+		}
+		lo := max(0, i-opts.contextLines)
+		hi := min(len(lines)-1, i+opts.contextLines)
+		for j := lo; j <= hi; j++ {
+			show[j] = true
+		}
+	}
+
+	var out []string
+	for i, l := range lines {
+		if !show[i] {
+			// Show a single marker for each run of hidden lines.
+			if i == 0 || show[i-1] {
+				out = append(out, "  ...")
+			}
+			continue
+		}
+
+		var formatted string
+		switch l.op {
+		case diffmatchpatch.DiffDelete:
+			formatted = opts.red("-" + l.text)
+		case diffmatchpatch.DiffInsert:
+			formatted = opts.green("+" + l.text)
+		case diffmatchpatch.DiffEqual:
+			formatted = " " + l.text
+		}
+		out = append(out, formatted)
+		if l.noNewline {
+			out = append(out, `\ No newline at end of file`)
+		}
+	}
+
+	if opts.maxLines > 0 && len(out) > opts.maxLines {
+		remaining := len(out) - opts.maxLines
+		out = append(out[:opts.maxLines], fmt.Sprintf("… %d more lines", remaining))
+	}
+	return strings.Join(out, "\n")
+}
+
+// hasLineDiff returns whether the line diff contains any changes.
+func hasLineDiff(lines []diffLine) bool {
+	for _, l := range lines {
+		if l.op != diffmatchpatch.DiffEqual {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func TestFormatDiff(t *testing.T) {
+	t.Parallel()
+
+	numberedLines := func(from, to int) string {
+		var sb strings.Builder
+		for i := from; i <= to; i++ {
+			fmt.Fprintf(&sb, "line %d\n", i)
+		}
+		return sb.String()
+	}
+
+	cases := []struct {
+		name         string
+		golden       string
+		actual       string
+		contextLines int
+		maxLines     int
+		want         string
+	}{
+		{
+			name:         "whole_file_in_context",
+			golden:       "a\nb\nc\n",
+			actual:       "a\nB\nc\n",
+			contextLines: 3,
+			want:         " a\n-b\n+B\n c",
+		},
+		{
+			name:         "distant_lines_are_elided",
+			golden:       numberedLines(1, 10),
+			actual:       strings.Replace(numberedLines(1, 10), "line 5\n", "line five\n", 1),
+			contextLines: 1,
+			want:         "  ...\n line 4\n-line 5\n+line five\n line 6\n  ...",
+		},
+		{
+			name:         "zero_context",
+			golden:       "a\nb\nc\n",
+			actual:       "a\nc\n",
+			contextLines: 0,
+			want:         "  ...\n-b\n  ...",
+		},
+		{
+			name:         "truncated",
+			golden:       "",
+			actual:       numberedLines(1, 5),
+			contextLines: 3,
+			maxLines:     2,
+			want:         "+line 1\n+line 2\n… 3 more lines",
+		},
+		{
+			name:         "missing_final_newline",
+			golden:       "a\n",
+			actual:       "a",
+			contextLines: 3,
+			want:         "-a\n+a\n\\ No newline at end of file",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			lines := lineDiff(diffmatchpatch.New(), tc.golden, tc.actual)
+			if !hasLineDiff(lines) {
+				t.Fatal("hasLineDiff() = false, want true")
+			}
+			got := formatDiff(lines, &diffOptions{
+				contextLines: tc.contextLines,
+				maxLines:     tc.maxLines,
+				red:          fmt.Sprint,
+				green:        fmt.Sprint,
+			})
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("diff output was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestHasLineDiff_Equal(t *testing.T) {
+	t.Parallel()
+
+	if hasLineDiff(lineDiff(diffmatchpatch.New(), "a\nb\n", "a\nb\n")) {
+		t.Errorf("hasLineDiff() = true for identical contents, want false")
+	}
+}
@@ -16,8 +16,13 @@
 package goldentest
 
 import (
+	"fmt"
+	"path/filepath"
 	"strings"
 
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/abc/templates/common/redact"
+	"github.com/abcxyz/abc/templates/common/ui"
 	"github.com/abcxyz/pkg/cli"
 )
 
@@ -37,6 +42,40 @@ type Flags struct {
 	//
 	// Optional.
 	TestNames []string
+
+	// GoldenDir is the directory containing the golden test cases, one
+	// subdirectory per test. Defaults to testdata/golden under Location.
+	//
+	// Optional.
+	GoldenDir string
+
+	// ShardIndex and ShardCount split the test cases into ShardCount groups,
+	// and only the test cases in group number ShardIndex (from 0) are run.
+	// This lets a large set of golden tests be split across parallel CI jobs.
+	//
+	// Optional. The default is a single shard containing every test case.
+	ShardIndex int
+	ShardCount int
+
+	// Coverage prints a summary of which spec steps ran during the tests.
+	//
+	// Optional.
+	Coverage bool
+
+	// See common/flags.DownloadRetries(). Only tests with a phase that
+	// renders a remote template download anything.
+	DownloadRetries int
+
+	// See common/flags.AllowDirtyTemplate().
+	AllowDirtyTemplate bool
+
+	// See common/flags.StrictAPIVersion(). Templates rendered by earlier
+	// phases of a test aren't checked.
+	StrictAPIVersion bool
+
+	// See common/flags.Redact(). The values of the matching inputs are also
+	// replaced in the recorded files.
+	Redact []string
 }
 
 func (r *Flags) Register(set *cli.FlagSet) {
@@ -50,6 +89,55 @@ func (r *Flags) Register(set *cli.FlagSet) {
 		Usage:   "The name of the test cases to record or verify.",
 	})
 
+	f.StringVar(goldenDirVar(&r.GoldenDir))
+
+	f.IntVar(&cli.IntVar{
+		Name:    "shard-index",
+		Example: "0",
+		Default: 0,
+		Target:  &r.ShardIndex,
+		Usage:   "Which of the --shard-count groups of test cases to run, starting from 0.",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "shard-count",
+		Example: "4",
+		Default: 1,
+		Target:  &r.ShardCount,
+		Usage: "The number of groups to split the test cases into, so they can " +
+			"run in parallel jobs. Each job should have a different --shard-index.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "coverage",
+		Default: false,
+		Target:  &r.Coverage,
+		Usage: "Print a summary of which steps in spec.yaml ran during the tests, " +
+			"to find steps and \"if\" conditions that no test exercises.",
+	})
+
+	f.IntVar(flags.DownloadRetries(&r.DownloadRetries))
+	f.BoolVar(flags.AllowDirtyTemplate(&r.AllowDirtyTemplate))
+	f.BoolVar(flags.StrictAPIVersion(&r.StrictAPIVersion))
+	f.StringSliceVar(flags.Redact(&r.Redact))
+
+	set.AfterParse(func(existingErr error) error {
+		if err := redact.ValidatePatterns(r.Redact); err != nil {
+			return fmt.Errorf("invalid --redact: %w", err)
+		}
+		if r.DownloadRetries < 0 {
+			return fmt.Errorf("--download-retries must not be negative, but got %d", r.DownloadRetries)
+		}
+		if r.ShardCount < 1 {
+			return fmt.Errorf("--shard-count must be at least 1, but got %d", r.ShardCount)
+		}
+		if r.ShardIndex < 0 || r.ShardIndex >= r.ShardCount {
+			return fmt.Errorf("--shard-index must be between 0 and %d (one less than --shard-count), but got %d",
+				r.ShardCount-1, r.ShardIndex)
+		}
+		return nil
+	})
+
 	// Default template location to the first CLI argument, if given.
 	// If not given, default to current directory.
 	set.AfterParse(func(existingErr error) error {
@@ -59,6 +147,138 @@ func (r *Flags) Register(set *cli.FlagSet) {
 			// make current directory the default location
 			r.Location = "."
 		}
+		r.GoldenDir = defaultGoldenDir(r.GoldenDir, r.Location)
+		return nil
+	})
+}
+
+// goldenDirVar returns the --golden-dir flag, which is shared by all the
+// golden-test subcommands.
+func goldenDirVar(target *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "golden-dir",
+		Example: "../my-template-goldens",
+		EnvVar:  "ABC_GOLDEN_DIR",
+		Target:  target,
+		Usage: "The directory containing the golden test cases, if they're " +
+			"not in the template's testdata/golden directory. This lets large " +
+			"recorded outputs live outside of the template, even in a " +
+			"different repo.",
+	}
+}
+
+// defaultGoldenDir returns goldenDir, or the default golden test directory
+// inside the template if goldenDir is empty.
+func defaultGoldenDir(goldenDir, location string) string {
+	if goldenDir != "" {
+		return goldenDir
+	}
+	return filepath.Join(location, goldenTestDir)
+}
+
+// VerifyFlags describes the flags of the verify subcommand, which has options
+// for showing mismatches in addition to the common Flags.
+type VerifyFlags struct {
+	Flags
+
+	// ContextLines is the number of unchanged lines to show around each changed
+	// line of a mismatched file.
+	ContextLines int
+
+	// MaxDiffLines is the maximum number of lines of diff to show for each
+	// mismatched file. Zero means no limit.
+	MaxDiffLines int
+
+	// NameOnly lists the mismatched files without showing their contents.
+	NameOnly bool
+
+	// NormalizeLineEndings ignores differences in line endings and leading
+	// byte order marks when comparing text files, like those introduced by
+	// git's autocrlf setting on Windows.
+	NormalizeLineEndings bool
+
+	// See common/flags.Color().
+	Color string
+
+	// AllowExec allows the verify steps of the tests to run external
+	// programs, like "go build".
+	AllowExec bool
+
+	// CLIVersion is a released version of abc, like "v0.9.0", to record the
+	// tests with instead of this one.
+	CLIVersion string
+}
+
+func (r *VerifyFlags) Register(set *cli.FlagSet) {
+	r.Flags.Register(set)
+
+	e := set.NewSection("EXEC OPTIONS")
+
+	e.BoolVar(&cli.BoolVar{
+		Name:    "allow-exec",
+		Default: false,
+		Target:  &r.AllowExec,
+		Usage: "Allow the \"verify\" steps in test.yaml to run external programs on this machine, like \"go build\", " +
+			"in a copy of each test's output. Tests that have verify steps fail without it.",
+	})
+
+	e.StringVar(&cli.StringVar{
+		Name:    "cli-version",
+		Example: "v0.9.0",
+		Target:  &r.CLIVersion,
+		Usage: "Download this released version of abc, and compare the recorded files with its output instead of " +
+			"this version's, to check that the tests still pass with it before upgrading. Verify steps aren't run. " +
+			"Releases older than the one that added this flag can't be used.",
+	})
+
+	f := set.NewSection("DIFF OPTIONS")
+
+	f.IntVar(&cli.IntVar{
+		Name:    "context-lines",
+		Example: "3",
+		Default: 3,
+		Target:  &r.ContextLines,
+		Usage:   "The number of unchanged lines to show around each changed line of a mismatched file.",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "max-diff-lines",
+		Example: "100",
+		Default: 100,
+		Target:  &r.MaxDiffLines,
+		Usage:   "The maximum number of lines of diff to show for each mismatched file; 0 means no limit.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "name-only",
+		Default: false,
+		Target:  &r.NameOnly,
+		Usage:   "List the mismatched files without showing how their contents differ.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "normalize-line-endings",
+		Default: false,
+		Target:  &r.NormalizeLineEndings,
+		Usage: "Before comparing text files, convert CRLF line endings to LF and remove a leading " +
+			"UTF-8 byte order mark, so that files checked out with different line endings still match.",
+	})
+
+	f.StringVar(flags.Color(&r.Color))
+
+	set.AfterParse(func(existingErr error) error {
+		if r.ContextLines < 0 {
+			return fmt.Errorf("--context-lines must not be negative, but got %d", r.ContextLines)
+		}
+		if r.MaxDiffLines < 0 {
+			return fmt.Errorf("--max-diff-lines must not be negative, but got %d", r.MaxDiffLines)
+		}
+		if _, err := ui.ParseColorMode(r.Color); err != nil {
+			return fmt.Errorf("invalid --color: %w", err)
+		}
+		if r.CLIVersion != "" && r.Coverage {
+			return fmt.Errorf("--coverage can't be combined with --cli-version, since the tests are rendered by another abc")
+		}
 		return nil
 	})
 }
@@ -46,6 +46,10 @@ type NewTestCommand struct {
 
 	// used in prompt UT.
 	skipPromptTTYCheck bool
+
+	// testFS allows filesystem interaction to be faked for testing. If nil,
+	// the real filesystem is used.
+	testFS common.FS
 }
 
 func (c *NewTestCommand) Desc() string {
@@ -76,7 +80,10 @@ func (c *NewTestCommand) Run(ctx context.Context, args []string) (rErr error) {
 	if err := c.Flags().Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
-	fs := &common.RealFS{}
+	var fs common.FS = &common.RealFS{}
+	if c.testFS != nil {
+		fs = c.testFS
+	}
 
 	spec, err := specutil.Load(ctx, fs, c.flags.Location, c.flags.Location)
 	if err != nil {
@@ -100,7 +107,7 @@ func (c *NewTestCommand) Run(ctx context.Context, args []string) (rErr error) {
 	for k := range c.flags.BuiltinVars {
 		builtinVarsKeys = append(builtinVarsKeys, k)
 	}
-	if err = builtinvar.Validate(spec.Features, builtinVarsKeys); err != nil {
+	if err = builtinvar.Validate(spec.Features, spec.EnvVarNames(), builtinVarsKeys); err != nil {
 		return err //nolint:wrapcheck
 	}
 
@@ -109,7 +116,7 @@ func (c *NewTestCommand) Run(ctx context.Context, args []string) (rErr error) {
 		return fmt.Errorf("failed to marshal test config data: %w", err)
 	}
 
-	testDir := filepath.Join(c.flags.Location, goldenTestDir, c.flags.NewTestName)
+	testDir := filepath.Join(c.flags.GoldenDir, c.flags.NewTestName)
 	testConfigFile := filepath.Join(testDir, configName)
 
 	if err = fs.MkdirAll(testDir, common.OwnerRWXPerms); err != nil {
@@ -272,12 +272,14 @@ func TestNewTestFlags_Parse(t *testing.T) {
 				"--builtin-var", "_git_tag=my-cool-tag",
 				"--force-overwrite",
 				"--prompt",
+				"--golden-dir", "/d/e",
 				"new-test",
 				"/a/b/c",
 			},
 			want: NewTestFlags{
 				NewTestName:    "new-test",
 				Location:       "/a/b/c",
+				GoldenDir:      "/d/e",
 				Inputs:         map[string]string{"x": "y"},
 				BuiltinVars:    map[string]string{"_git_tag": "my-cool-tag"},
 				ForceOverwrite: true,
@@ -296,6 +298,7 @@ func TestNewTestFlags_Parse(t *testing.T) {
 			want: NewTestFlags{
 				NewTestName:    "new-test",
 				Location:       ".",
+				GoldenDir:      "testdata/golden",
 				Inputs:         map[string]string{"x": "y"},
 				BuiltinVars:    map[string]string{"_git_tag": "my-cool-tag"},
 				ForceOverwrite: true,
@@ -46,6 +46,10 @@ type NewTestFlags struct {
 
 	// ForceOverwrite lets existing test config file be overwritten.
 	ForceOverwrite bool
+
+	// GoldenDir is the directory containing the golden test cases. Defaults
+	// to testdata/golden under Location.
+	GoldenDir string
 }
 
 func (r *NewTestFlags) Register(set *cli.FlagSet) {
@@ -87,6 +91,8 @@ func (r *NewTestFlags) Register(set *cli.FlagSet) {
 		Usage:   "The key=val pairs of builtin_vars; may be repeated.",
 	})
 
+	f.StringVar(goldenDirVar(&r.GoldenDir))
+
 	// Default NewTestName to the first CLI argument, if given
 	set.AfterParse(func(existingErr error) error {
 		r.NewTestName = set.Arg(0)
@@ -110,6 +116,7 @@ func (r *NewTestFlags) Register(set *cli.FlagSet) {
 			// make current directory the default location
 			r.Location = "."
 		}
+		r.GoldenDir = defaultGoldenDir(r.GoldenDir, r.Location)
 		return nil
 	})
 }
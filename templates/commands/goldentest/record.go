@@ -22,11 +22,12 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
-	"os"
 	"path/filepath"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/render"
 	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
 )
@@ -35,6 +36,10 @@ type RecordCommand struct {
 	flags Flags
 
 	cli.BaseCommand
+
+	// testFS allows filesystem interaction to be faked for testing. If nil,
+	// the real filesystem is used.
+	testFS common.FS
 }
 
 func (c *RecordCommand) Desc() string {
@@ -58,7 +63,10 @@ If no "<location>" is given, default to current directory.
 For every test case, it is expected that
   - a testdata/golden/<test_name> folder exists to host test results.
   - a testdata/golden/<test_name>/test.yaml exists to define
-template input params.`
+template input params.
+
+If --golden-dir is given, the test cases are in <golden-dir>/<test_name>
+instead of testdata/golden/<test_name>.`
 }
 
 func (c *RecordCommand) Flags() *cli.FlagSet {
@@ -72,12 +80,16 @@ func (c *RecordCommand) Run(ctx context.Context, args []string) (rErr error) {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
 
-	testCases, err := parseTestCases(ctx, c.flags.Location, c.flags.TestNames)
+	rfs := c.testFS
+	if rfs == nil {
+		rfs = &common.RealFS{}
+	}
+
+	testCases, err := parseTestCases(ctx, rfs, c.flags.Location, c.flags.GoldenDir, c.flags.TestNames)
 	if err != nil {
 		return fmt.Errorf("failed to parse golden test: %w", err)
 	}
-
-	rfs := &common.RealFS{}
+	testCases = shardTestCases(testCases, c.flags.ShardIndex, c.flags.ShardCount)
 
 	tempTracker := tempdir.NewDirTracker(rfs, false)
 	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
@@ -85,13 +97,26 @@ func (c *RecordCommand) Run(ctx context.Context, args []string) (rErr error) {
 	// Create a temporary directory to validate golden tests rendered with no
 	// error. If any test fails, no data should be written to file system
 	// for atomicity purpose.
-	tempDir, err := renderTestCases(ctx, testCases, c.flags.Location)
+	var cov *render.Coverage
+	if c.flags.Coverage {
+		cov = render.NewCoverage()
+	}
+	stats := &templatesource.DownloadStats{}
+	tempDir, err := renderTestCases(ctx, rfs, testCases, c.flags.Location, &renderOptions{
+		cov:        cov,
+		retry:      &templatesource.RetryPolicy{MaxRetries: c.flags.DownloadRetries},
+		stats:      stats,
+		allowDirty: c.flags.AllowDirtyTemplate,
+		redact:     c.flags.Redact,
+
+		strictAPIVersion: c.flags.StrictAPIVersion,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to render test cases: %w", err)
 	}
 	tempTracker.Track(tempDir)
 
-	if err := renameGitDirsAndFiles(tempDir); err != nil {
+	if err := renameGitDirsAndFiles(rfs, tempDir); err != nil {
 		return fmt.Errorf("failed renaming git related dirs and files: %w", err)
 	}
 
@@ -100,8 +125,8 @@ func (c *RecordCommand) Run(ctx context.Context, args []string) (rErr error) {
 
 	// Recursively copy files from tempDir to template golden test directory.
 	for _, tc := range testCases {
-		testDir := filepath.Join(c.flags.Location, goldenTestDir, tc.TestName, testDataDir)
-		if err := os.RemoveAll(testDir); err != nil {
+		testDir := filepath.Join(c.flags.GoldenDir, tc.TestName, testDataDir)
+		if err := rfs.RemoveAll(testDir); err != nil {
 			return fmt.Errorf("failed to clear test directory: %w", err)
 		}
 
@@ -119,17 +144,20 @@ func (c *RecordCommand) Run(ctx context.Context, args []string) (rErr error) {
 			DstRoot: testDir,
 			SrcRoot: filepath.Join(tempDir, goldenTestDir, tc.TestName, testDataDir),
 			FS:      rfs,
-			Visitor: visitor,
+			// Any symlinks in the rendered output were created by the
+			// template, so they're recorded as symlinks.
+			Symlinks: common.SymlinksPreserve,
+			Visitor:  visitor,
 		}
 		merr = errors.Join(merr, common.CopyRecursive(ctx, nil, params))
 
 		abcInternal := filepath.Join(testDir, common.ABCInternalDir)
-		if err := os.MkdirAll(abcInternal, common.OwnerRWXPerms); err != nil {
+		if err := rfs.MkdirAll(abcInternal, common.OwnerRWXPerms); err != nil {
 			return fmt.Errorf("failed to create dir %q: %w", abcInternal, err)
 		}
 		// git won't commit an empty directory, so add a placeholder file.
 		gitKeep := filepath.Join(abcInternal, ".gitkeep")
-		if err := os.WriteFile(gitKeep, []byte{}, common.OwnerRWPerms); err != nil {
+		if err := rfs.WriteFile(gitKeep, []byte{}, common.OwnerRWPerms); err != nil {
 			return fmt.Errorf("failed creating %q: %w", gitKeep, err)
 		}
 	}
@@ -137,5 +165,12 @@ func (c *RecordCommand) Run(ctx context.Context, args []string) (rErr error) {
 		return fmt.Errorf("failed to write golden test data: %w", merr)
 	}
 
+	if cov != nil {
+		fmt.Fprint(c.Stdout(), coverageReport(cov.Steps()))
+	}
+	if stats.Downloads() > 0 {
+		fmt.Fprintln(c.Stdout(), stats.String())
+	}
+
 	return nil
 }
@@ -49,9 +49,16 @@ kind: 'GoldenTest'`
 	cases := []struct {
 		name                  string
 		testNames             []string
+		location              string // relative to the temp dir
+		goldenDir             string // relative to the temp dir
 		filesContent          map[string]string
+		symlinks              map[string]string
+		emptyDirs             []string
 		expectedGoldenContent map[string]string
-		wantErr               string
+		// Symlinks in the golden directory also appear in
+		// expectedGoldenContent, with the contents of their targets.
+		expectedGoldenSymlinks map[string]string
+		wantErr                string
 	}{
 		{
 			name: "simple_test_succeeds",
@@ -216,6 +223,59 @@ steps:
 				"test/data/.gitfoo.abc_renamed/file1.txt": "file1",
 			},
 		},
+		{
+			name:      "golden_dir_outside_template",
+			location:  "template",
+			goldenDir: "goldens",
+			filesContent: map[string]string{
+				"template/spec.yaml":     specYaml,
+				"template/a.txt":         "file A content",
+				"goldens/test/test.yaml": testYaml,
+			},
+			expectedGoldenContent: map[string]string{
+				"test/test.yaml":          testYaml,
+				"test/data/.abc/.gitkeep": "",
+				"test/data/a.txt":         "file A content",
+			},
+		},
+		{
+			name: "symlinks_are_recorded",
+			filesContent: map[string]string{
+				"spec.yaml": specYaml,
+				"a.txt":     "file A content",
+				"testdata/golden/test/test.yaml": testYaml + `
+symlinks: 'preserve'`,
+			},
+			symlinks: map[string]string{
+				"link.txt": "a.txt",
+			},
+			expectedGoldenContent: map[string]string{
+				"test/test.yaml": testYaml + `
+symlinks: 'preserve'`,
+				"test/data/.abc/.gitkeep": "",
+				"test/data/a.txt":         "file A content",
+				"test/data/link.txt":      "file A content",
+			},
+			expectedGoldenSymlinks: map[string]string{
+				"test/data/link.txt": "a.txt",
+			},
+		},
+		{
+			name: "empty_dirs_are_recorded_with_marker",
+			filesContent: map[string]string{
+				"spec.yaml":                      specYaml,
+				"a.txt":                          "file A content",
+				"testdata/golden/test/test.yaml": testYaml,
+			},
+			emptyDirs: []string{"empty", "nested/empty"},
+			expectedGoldenContent: map[string]string{
+				"test/test.yaml":                   testYaml,
+				"test/data/.abc/.gitkeep":          "",
+				"test/data/a.txt":                  "file A content",
+				"test/data/empty/.abc_keep":        "",
+				"test/data/nested/empty/.abc_keep": "",
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -227,6 +287,8 @@ steps:
 			tempDir := t.TempDir()
 
 			abctestutil.WriteAllDefaultMode(t, tempDir, tc.filesContent)
+			abctestutil.WriteSymlinks(t, tempDir, tc.symlinks)
+			abctestutil.WriteEmptyDirs(t, tempDir, tc.emptyDirs)
 
 			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
 
@@ -234,7 +296,12 @@ steps:
 			if len(tc.testNames) > 0 {
 				args = append(args, "--test-name", strings.Join(tc.testNames, ","))
 			}
-			args = append(args, tempDir)
+			goldenDir := filepath.Join(tempDir, "testdata/golden")
+			if tc.goldenDir != "" {
+				goldenDir = filepath.Join(tempDir, tc.goldenDir)
+				args = append(args, "--golden-dir", goldenDir)
+			}
+			args = append(args, filepath.Join(tempDir, tc.location))
 
 			r := &RecordCommand{}
 			if err := r.Run(ctx, args); err != nil {
@@ -243,10 +310,14 @@ steps:
 				}
 			}
 
-			gotDestContents := abctestutil.LoadDirWithoutMode(t, filepath.Join(tempDir, "testdata/golden"))
+			gotDestContents := abctestutil.LoadDirWithoutMode(t, goldenDir)
 			if diff := cmp.Diff(gotDestContents, tc.expectedGoldenContent); diff != "" {
 				t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
 			}
+			gotSymlinks := abctestutil.LoadSymlinks(t, goldenDir)
+			if diff := cmp.Diff(gotSymlinks, tc.expectedGoldenSymlinks); diff != "" {
+				t.Errorf("dest directory symlinks were not as expected (-got,+want): %s", diff)
+			}
 		})
 	}
 }
@@ -264,11 +335,22 @@ func TestNewRecordFlags_Parse(t *testing.T) {
 			name: "all_flags_present",
 			args: []string{
 				"--test-name=test1",
+				"--golden-dir=/d/e",
+				"--coverage",
+				"--download-retries=0",
+				"--allow-dirty-template",
+				"--strict-api-version",
 				"/a/b/c",
 			},
 			want: Flags{
-				TestNames: []string{"test1"},
-				Location:  "/a/b/c",
+				TestNames:          []string{"test1"},
+				Location:           "/a/b/c",
+				GoldenDir:          "/d/e",
+				Coverage:           true,
+				ShardCount:         1,
+				DownloadRetries:    0,
+				AllowDirtyTemplate: true,
+				StrictAPIVersion:   true,
 			},
 		},
 		{
@@ -277,8 +359,59 @@ func TestNewRecordFlags_Parse(t *testing.T) {
 				"--test-name=test1",
 			},
 			want: Flags{
-				TestNames: []string{"test1"},
-				Location:  ".",
+				TestNames:       []string{"test1"},
+				Location:        ".",
+				GoldenDir:       "testdata/golden",
+				ShardCount:      1,
+				DownloadRetries: 3,
+			},
+		},
+		{
+			name: "shard_flags",
+			args: []string{
+				"--shard-index=2",
+				"--shard-count=3",
+			},
+			want: Flags{
+				Location:        ".",
+				GoldenDir:       "testdata/golden",
+				ShardIndex:      2,
+				ShardCount:      3,
+				DownloadRetries: 3,
+			},
+		},
+		{
+			name: "shard_index_out_of_range",
+			args: []string{
+				"--shard-index=3",
+				"--shard-count=3",
+			},
+			wantErr: "--shard-index must be between 0 and 2 (one less than --shard-count), but got 3",
+		},
+		{
+			name: "shard_count_zero",
+			args: []string{
+				"--shard-count=0",
+			},
+			wantErr: "--shard-count must be at least 1, but got 0",
+		},
+		{
+			name: "negative_download_retries",
+			args: []string{
+				"--download-retries=-1",
+			},
+			wantErr: "--download-retries must not be negative, but got -1",
+		},
+		{
+			name: "default_golden_dir_is_in_template",
+			args: []string{
+				"/a/b/c",
+			},
+			want: Flags{
+				Location:        "/a/b/c",
+				GoldenDir:       "/a/b/c/testdata/golden",
+				ShardCount:      1,
+				DownloadRetries: 3,
 			},
 		},
 	}
@@ -296,6 +429,9 @@ func TestNewRecordFlags_Parse(t *testing.T) {
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
+			if err != nil {
+				return
+			}
 			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
 				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
 			}
@@ -19,16 +19,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
 
 	"github.com/benbjohnson/clock"
+	"golang.org/x/exp/maps"
 
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/redact"
 	"github.com/abcxyz/abc/templates/common/render"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
@@ -65,21 +69,27 @@ const (
 
 	// the suffix of abc renamed directories and files.
 	abcRenameSuffix = ".abc_renamed"
+
+	// The name of the placeholder file that's added to each empty directory
+	// in the test output, since git won't commit an empty directory.
+	emptyDirMarker = ".abc_keep"
 )
 
-// parseTestCases returns a list of test cases to record or verify.
-func parseTestCases(ctx context.Context, location string, testNames []string) ([]*TestCase, error) {
-	if _, err := os.Stat(location); err != nil {
+// parseTestCases returns a list of test cases to record or verify. goldenDir
+// is the directory containing the test cases, normally testdata/golden inside
+// the template at location.
+func parseTestCases(ctx context.Context, rfs common.FS, location, goldenDir string, testNames []string) ([]*TestCase, error) {
+	if _, err := rfs.Stat(location); err != nil {
 		return nil, fmt.Errorf("error reading template directory (%s): %w", location, err)
 	}
 
-	testDir := filepath.Join(location, goldenTestDir)
+	testDir := goldenDir
 
 	testCases := []*TestCase{}
 
 	if len(testNames) > 0 {
 		for _, testName := range testNames {
-			testCase, err := buildTestCase(ctx, testDir, testName)
+			testCase, err := buildTestCase(ctx, rfs, testDir, testName)
 			if err != nil {
 				return nil, err
 			}
@@ -89,7 +99,7 @@ func parseTestCases(ctx context.Context, location string, testNames []string) ([
 		return testCases, nil
 	}
 
-	entries, err := os.ReadDir(testDir)
+	entries, err := fs.ReadDir(rfs, testDir)
 	if err != nil {
 		return nil, fmt.Errorf("error reading golden test directory (%s): %w", testDir, err)
 	}
@@ -99,7 +109,7 @@ func parseTestCases(ctx context.Context, location string, testNames []string) ([
 			return nil, fmt.Errorf("unexpected file entry under golden test directory: %s", entry.Name())
 		}
 
-		testCase, err := buildTestCase(ctx, testDir, entry.Name())
+		testCase, err := buildTestCase(ctx, rfs, testDir, entry.Name())
 		if err != nil {
 			return nil, err
 		}
@@ -110,10 +120,34 @@ func parseTestCases(ctx context.Context, location string, testNames []string) ([
 	return testCases, nil
 }
 
+// shardTestCases returns the test cases that belong to the given shard. The
+// test cases are sorted by name and dealt out to the shards in turn, so every
+// test case is in exactly one shard, and the shards differ in size by at most
+// one. The partitioning only depends on the test names, so separate CI jobs
+// agree on it.
+func shardTestCases(testCases []*TestCase, shardIndex, shardCount int) []*TestCase {
+	if shardCount <= 1 {
+		return testCases
+	}
+
+	sorted := slices.Clone(testCases)
+	slices.SortFunc(sorted, func(a, b *TestCase) int {
+		return strings.Compare(a.TestName, b.TestName)
+	})
+
+	var out []*TestCase
+	for i, tc := range sorted {
+		if i%shardCount == shardIndex {
+			out = append(out, tc)
+		}
+	}
+	return out
+}
+
 // buildtestCases builds the name and config of a test case.
-func buildTestCase(ctx context.Context, testDir, testName string) (*TestCase, error) {
+func buildTestCase(ctx context.Context, rfs common.FS, testDir, testName string) (*TestCase, error) {
 	testConfig := filepath.Join(testDir, testName, configName)
-	test, err := parseTestConfig(ctx, testConfig)
+	test, err := parseTestConfig(ctx, rfs, testConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -125,8 +159,8 @@ func buildTestCase(ctx context.Context, testDir, testName string) (*TestCase, er
 }
 
 // parseTestConfig reads a configuration yaml and returns the result.
-func parseTestConfig(ctx context.Context, path string) (*goldentest.Test, error) {
-	f, err := os.Open(path)
+func parseTestConfig(ctx context.Context, rfs common.FS, path string) (*goldentest.Test, error) {
+	f, err := rfs.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("error opening test config (%s): %w", path, err)
 	}
@@ -144,16 +178,40 @@ func parseTestConfig(ctx context.Context, path string) (*goldentest.Test, error)
 	return out, nil
 }
 
+// renderOptions are the options for rendering test cases that come from the
+// command's flags.
+type renderOptions struct {
+	// cov is optional, and if non-nil, records which steps ran.
+	cov *render.Coverage
+
+	// retry controls how downloads of remote templates are retried. If nil,
+	// templatesource.DefaultRetryPolicy is used.
+	retry *templatesource.RetryPolicy
+
+	// stats is optional, and if non-nil, adds up the downloads of remote
+	// templates across all test cases.
+	stats *templatesource.DownloadStats
+
+	// allowDirty is the value of --allow-dirty-template.
+	allowDirty bool
+
+	// strictAPIVersion is the value of --strict-api-version.
+	strictAPIVersion bool
+
+	// redact is the value of --redact.
+	redact []string
+}
+
 // renderTestCases render all test cases into a temporary directory.
-func renderTestCases(ctx context.Context, testCases []*TestCase, location string) (string, error) {
-	tempDir, err := os.MkdirTemp("", tempdir.GoldenTestRenderNamePart)
+func renderTestCases(ctx context.Context, rfs common.FS, testCases []*TestCase, location string, opts *renderOptions) (string, error) {
+	tempDir, err := rfs.MkdirTemp("", tempdir.GoldenTestRenderNamePart)
 	if err != nil {
 		return "", fmt.Errorf("failed to create temporary directory: %w", err)
 	}
 
 	var merr error
 	for _, tc := range testCases {
-		merr = errors.Join(merr, renderTestCase(ctx, location, tempDir, tc))
+		merr = errors.Join(merr, renderTestCase(ctx, rfs, location, tempDir, tc, opts))
 	}
 	if merr != nil {
 		return "", fmt.Errorf("failed to render golden tests: %w", merr)
@@ -162,7 +220,10 @@ func renderTestCases(ctx context.Context, testCases []*TestCase, location string
 }
 
 // renderTestCase executes the "template render" command based upon test config.
-func renderTestCase(ctx context.Context, templateDir, outputDir string, tc *TestCase) error {
+func renderTestCase(ctx context.Context, rfs common.FS, templateDir, outputDir string, tc *TestCase, opts *renderOptions) error {
+	if opts == nil {
+		opts = &renderOptions{}
+	}
 	testDir := filepath.Join(outputDir, goldenTestDir, tc.TestName, testDataDir)
 
 	cwd, err := os.Getwd()
@@ -170,41 +231,272 @@ func renderTestCase(ctx context.Context, templateDir, outputDir string, tc *Test
 		return fmt.Errorf("os.Getwd(): %w", err)
 	}
 
+	if err := writeDestContents(rfs, testDir, tc.TestConfig.DestContents); err != nil {
+		return err
+	}
+
+	inputs := varValuesToMap(tc.TestConfig.Inputs)
+	redactor, err := redact.New(opts.redact, inputs)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	builtinVars := varValuesToMap(tc.TestConfig.BuiltinVars)
+	symlinks, err := common.ParseSymlinkMode(tc.TestConfig.Symlinks.Val)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	for i, phase := range tc.TestConfig.Phases {
+		phaseInputs := maps.Clone(inputs)
+		maps.Copy(phaseInputs, varValuesToMap(phase.Inputs))
+		redactor.AddInputs(phaseInputs)
+
+		downloader := templatesource.Downloader(&templatesource.LocalDownloader{
+			SrcPath:    templateDir,
+			FS:         rfs,
+			Symlinks:   symlinks,
+			AllowDirty: opts.allowDirty,
+		})
+		source := templateDir
+		phaseCov := opts.cov
+		if phase.Template.Val != "" {
+			downloader, err = templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+				CWD:         templateDir,
+				Source:      phase.Template.Val,
+				GitProtocol: "https",
+				FS:          rfs,
+				Symlinks:    symlinks,
+				Retry:       opts.retry,
+				Stats:       opts.stats,
+				AllowDirty:  opts.allowDirty,
+			})
+			if err != nil {
+				return phase.Template.Pos.Errorf("invalid phase template: %w", err)
+			}
+			source = phase.Template.Val
+			// Coverage is only about the template being tested.
+			phaseCov = nil
+		}
+
+		err = render.Render(ctx, &render.Params{
+			Clock:               clock.New(),
+			Coverage:            phaseCov,
+			Cwd:                 cwd,
+			DestDir:             testDir,
+			Downloader:          downloader,
+			DownloadRetry:       opts.retry,
+			DownloadStats:       opts.stats,
+			ForceOverwrite:      phase.ForceOverwrite.Val,
+			FS:                  rfs,
+			Inputs:              phaseInputs,
+			OverrideBuiltinVars: builtinVars,
+			Redact:              opts.redact,
+			SourceForMessages:   source,
+			Stdout:              io.Discard, // only the test's own render is recorded
+			Symlinks:            symlinks,
+		})
+		if err != nil {
+			return fmt.Errorf("in phase %d: %w", i, renderErr(err))
+		}
+	}
+
 	stdoutBuf := &strings.Builder{}
 
 	err = render.Render(ctx, &render.Params{
-		Clock:               clock.New(),
-		Cwd:                 cwd,
-		DestDir:             testDir,
-		Downloader:          &templatesource.LocalDownloader{SrcPath: templateDir},
-		FS:                  &common.RealFS{},
-		Inputs:              varValuesToMap(tc.TestConfig.Inputs),
-		OverrideBuiltinVars: varValuesToMap(tc.TestConfig.BuiltinVars),
+		Clock:    clock.New(),
+		Coverage: opts.cov,
+		Cwd:      cwd,
+		DestDir:  testDir,
+		Downloader: &templatesource.LocalDownloader{
+			SrcPath:    templateDir,
+			FS:         rfs,
+			Symlinks:   symlinks,
+			AllowDirty: opts.allowDirty,
+		},
+		DownloadRetry:       opts.retry,
+		DownloadStats:       opts.stats,
+		ForceOverwrite:      tc.TestConfig.ForceOverwrite.Val,
+		FS:                  rfs,
+		Inputs:              inputs,
+		OverrideBuiltinVars: builtinVars,
+		Redact:              opts.redact,
 		SourceForMessages:   templateDir,
+		StrictAPIVersion:    opts.strictAPIVersion,
 		Stdout:              stdoutBuf,
+		Symlinks:            symlinks,
 	})
 	if err != nil {
-		var uve *errs.UnknownVarError
-		if errors.As(err, &uve) && strings.HasPrefix(uve.VarName, "_") {
-			return fmt.Errorf("you may need to provide a value for %q in the builtin_vars section of test.yaml: %w", uve.VarName, err)
-		}
-		return err //nolint:wrapcheck
+		return renderErr(err)
 	}
 
 	// write stdout to ".abc/.stdout".
-	if stdoutBuf.Len() > 0 {
+	stdout, err := normalizeStdout(stdoutBuf.String(), tc.TestConfig.Stdout)
+	if err != nil {
+		return err
+	}
+	if len(stdout) > 0 {
 		abcInternal := filepath.Join(testDir, common.ABCInternalDir)
-		if err := os.MkdirAll(abcInternal, common.OwnerRWXPerms); err != nil {
+		if err := rfs.MkdirAll(abcInternal, common.OwnerRWXPerms); err != nil {
 			return fmt.Errorf("failed to create dir %q: %w", abcInternal, err)
 		}
 		stdoutFile := filepath.Join(abcInternal, common.ABCInternalStdout)
-		if err := os.WriteFile(stdoutFile, []byte(stdoutBuf.String()), common.OwnerRWPerms); err != nil {
+		if err := rfs.WriteFile(stdoutFile, []byte(stdout), common.OwnerRWPerms); err != nil {
 			return fmt.Errorf("failed creating %q: %w", stdoutFile, err)
 		}
 	}
+	if err := redactFiles(rfs, testDir, redactor); err != nil {
+		return err
+	}
+	return markEmptyDirs(rfs, testDir)
+}
+
+// redactFiles replaces the sensitive values in the contents of the files under
+// dir, so they aren't recorded in the golden data.
+func redactFiles(rfs common.FS, dir string, r *redact.Redactor) error {
+	if r == nil {
+		return nil
+	}
+	err := fs.WalkDir(rfs, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		buf, err := rfs.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed reading %q: %w", path, err)
+		}
+		redacted := r.String(string(buf))
+		if redacted == string(buf) {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return fmt.Errorf("failed getting the info of %q: %w", path, err)
+		}
+		if err := rfs.WriteFile(path, []byte(redacted), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed writing %q: %w", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed redacting the rendered files: %w", err)
+	}
+	return nil
+}
+
+// markEmptyDirs adds an emptyDirMarker file to each empty directory under dir,
+// so that the empty directories created by a template are recorded in the
+// golden data and compared by verify. The .abc directory is excluded.
+func markEmptyDirs(rfs common.FS, dir string) error {
+	var emptyDirs []string
+	err := fs.WalkDir(rfs, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !de.IsDir() || path == dir {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", dir, path, err)
+		}
+		if common.IsReservedInDest(relPath) {
+			return fs.SkipDir
+		}
+		entries, err := fs.ReadDir(rfs, path)
+		if err != nil {
+			return fmt.Errorf("ReadDir(%s): %w", path, err)
+		}
+		if len(entries) == 0 {
+			emptyDirs = append(emptyDirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("WalkDir: %w", err)
+	}
+
+	for _, emptyDir := range emptyDirs {
+		marker := filepath.Join(emptyDir, emptyDirMarker)
+		if err := rfs.WriteFile(marker, []byte{}, common.OwnerRWPerms); err != nil {
+			return fmt.Errorf("failed creating %q: %w", marker, err)
+		}
+	}
 	return nil
 }
 
+// renderErr adds a hint to an error from rendering a test case, if the error
+// is about a missing builtin var.
+func renderErr(err error) error {
+	var uve *errs.UnknownVarError
+	if errors.As(err, &uve) && strings.HasPrefix(uve.VarName, "_") {
+		return fmt.Errorf("you may need to provide a value for %q in the builtin_vars section of test.yaml: %w", uve.VarName, err)
+	}
+	return err
+}
+
+// writeDestContents creates the files from the "dest_contents" section of
+// test.yaml in the destination directory, before the template is rendered.
+func writeDestContents(rfs common.FS, destDir string, files []*goldentest.DestFile) error {
+	for _, f := range files {
+		relPath, err := common.SafeRelPath(f.Path.Pos, filepath.FromSlash(f.Path.Val))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		path := filepath.Join(destDir, relPath)
+		if err := rfs.MkdirAll(filepath.Dir(path), common.OwnerRWXPerms); err != nil {
+			return fmt.Errorf("failed to create dir %q: %w", filepath.Dir(path), err)
+		}
+		if err := rfs.WriteFile(path, []byte(f.Contents.Val), common.OwnerRWPerms); err != nil {
+			return fmt.Errorf("failed creating dest_contents file %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// normalizeStdout applies the normalizations from the "stdout" section of
+// test.yaml to the messages printed by a template, so that messages that vary
+// from one run to the next can still be compared. If opts is nil, the
+// messages are returned unchanged.
+func normalizeStdout(stdout string, opts *goldentest.Stdout) (string, error) {
+	if opts == nil || stdout == "" {
+		return stdout, nil
+	}
+
+	for _, r := range opts.Replacements {
+		re, err := regexp.Compile(r.Regex.Val)
+		if err != nil {
+			// This should have been caught when validating test.yaml.
+			return "", r.Regex.Pos.Errorf("invalid regex %q: %w", r.Regex.Val, err)
+		}
+		stdout = re.ReplaceAllString(stdout, r.With.Val)
+	}
+
+	if !opts.TrimTrailingWhitespace.Val && !opts.SortLines.Val {
+		return stdout, nil
+	}
+
+	// Keep track of the final newline separately, so sorting doesn't move an
+	// empty line to the top.
+	hasFinalNewline := strings.HasSuffix(stdout, "\n")
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if opts.TrimTrailingWhitespace.Val {
+		for i, l := range lines {
+			lines[i] = strings.TrimRight(l, " \t\r")
+		}
+	}
+	if opts.SortLines.Val {
+		slices.Sort(lines)
+	}
+	out := strings.Join(lines, "\n")
+	if hasFinalNewline {
+		out += "\n"
+	}
+	return out, nil
+}
+
 func varValuesToMap(vvs []*goldentest.VarValue) map[string]string {
 	out := make(map[string]string, len(vvs))
 	for _, vv := range vvs {
@@ -213,21 +505,26 @@ func varValuesToMap(vvs []*goldentest.VarValue) map[string]string {
 	return out
 }
 
+// mapToVarValues converts a map of names to values into a list sorted by name,
+// so that the test.yaml files that it's written to don't change from run to
+// run.
 func mapToVarValues(m map[string]string) []*goldentest.VarValue {
+	names := maps.Keys(m)
+	slices.Sort(names)
 	out := make([]*goldentest.VarValue, 0, len(m))
-	for k, v := range m {
+	for _, k := range names {
 		out = append(out, &goldentest.VarValue{
 			Name:  model.String{Val: k},
-			Value: model.String{Val: v},
+			Value: model.String{Val: m[k]},
 		})
 	}
 	return out
 }
 
-func renameGitDirsAndFiles(dir string) error {
+func renameGitDirsAndFiles(rfs common.FS, dir string) error {
 	// including path of git related directories and files.
 	var gitPaths []string
-	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(rfs, dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -245,7 +542,7 @@ func renameGitDirsAndFiles(dir string) error {
 	slices.Reverse(gitPaths)
 	for _, gitPath := range gitPaths {
 		newPath := gitPath + abcRenameSuffix
-		if err := os.Rename(gitPath, newPath); err != nil {
+		if err := rfs.Rename(gitPath, newPath); err != nil {
 			return fmt.Errorf("error renaming directory or file %s: %w", gitPath, err)
 		}
 	}
@@ -23,6 +23,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 
+	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/model"
 	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta4"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
@@ -188,7 +189,7 @@ builtin_vars:
 			abctestutil.WriteAllDefaultMode(t, tempDir, tc.filesContent)
 
 			ctx := context.Background()
-			got, err := parseTestCases(ctx, tempDir, tc.testNames)
+			got, err := parseTestCases(ctx, &common.RealFS{}, tempDir, filepath.Join(tempDir, goldenTestDir), tc.testNames)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
@@ -204,6 +205,63 @@ builtin_vars:
 	}
 }
 
+func TestShardTestCases(t *testing.T) {
+	t.Parallel()
+
+	var testCases []*TestCase
+	for _, name := range []string{"e", "b", "d", "a", "c"} {
+		testCases = append(testCases, &TestCase{TestName: name})
+	}
+
+	cases := []struct {
+		name       string
+		shardIndex int
+		shardCount int
+		want       []string
+	}{
+		{
+			name:       "single_shard",
+			shardIndex: 0,
+			shardCount: 1,
+			want:       []string{"e", "b", "d", "a", "c"},
+		},
+		{
+			name:       "first_of_two",
+			shardIndex: 0,
+			shardCount: 2,
+			want:       []string{"a", "c", "e"},
+		},
+		{
+			name:       "second_of_two",
+			shardIndex: 1,
+			shardCount: 2,
+			want:       []string{"b", "d"},
+		},
+		{
+			name:       "more_shards_than_tests",
+			shardIndex: 6,
+			shardCount: 7,
+			want:       nil,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, testCase := range shardTestCases(testCases, tc.shardIndex, tc.shardCount) {
+				got = append(got, testCase.TestName)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("sharded test cases were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
 func TestRenderTestCase(t *testing.T) {
 	t.Parallel()
 
@@ -303,6 +361,178 @@ steps:
 				"data/.abc/stdout": "Hello\n",
 			},
 		},
+		{
+			name: "dest_contents_are_modified",
+			testCase: &TestCase{
+				TestName: "test",
+				TestConfig: &goldentest.Test{
+					DestContents: []*goldentest.DestFile{
+						{
+							Path:     model.String{Val: "existing.txt"},
+							Contents: model.String{Val: "existing line\n"},
+						},
+						{
+							Path:     model.String{Val: "dir/untouched.txt"},
+							Contents: model.String{Val: "untouched"},
+						},
+					},
+				},
+			},
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template that modifies an existing file'
+steps:
+  - desc: 'Include the existing file from the destination'
+    action: 'include'
+    params:
+      from: 'destination'
+      paths: ['existing.txt']
+  - desc: 'Append to the existing file'
+    action: 'append'
+    params:
+      paths: ['existing.txt']
+      with: 'appended line'`,
+			},
+			expectedGoldenContent: map[string]string{
+				"data/existing.txt":      "existing line\nappended line\n",
+				"data/dir/untouched.txt": "untouched",
+			},
+		},
+		{
+			name: "phases_inherit_and_override_inputs",
+			testCase: &TestCase{
+				TestName: "test",
+				TestConfig: &goldentest.Test{
+					Inputs: []*goldentest.VarValue{
+						{Name: model.String{Val: "input_a"}, Value: model.String{Val: "second"}},
+						{Name: model.String{Val: "input_b"}, Value: model.String{Val: "b"}},
+					},
+					Phases: []*goldentest.Phase{
+						{
+							Inputs: []*goldentest.VarValue{
+								{Name: model.String{Val: "input_a"}, Value: model.String{Val: "first"}},
+							},
+						},
+					},
+				},
+			},
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template whose output file name depends on inputs'
+inputs:
+  - name: 'input_a'
+    desc: 'input of A'
+  - name: 'input_b'
+    desc: 'input of B'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['file.txt']
+      as: ['{{.input_a}}_{{.input_b}}.txt']`,
+				"file.txt": "file contents",
+			},
+			expectedGoldenContent: map[string]string{
+				"data/first_b.txt":  "file contents",
+				"data/second_b.txt": "file contents",
+			},
+		},
+		{
+			name: "phases_upgrade_from_other_template",
+			testCase: &TestCase{
+				TestName: "test",
+				TestConfig: &goldentest.Test{
+					Phases: []*goldentest.Phase{
+						{Template: model.String{Val: "v1"}},
+					},
+					ForceOverwrite: model.Bool{Val: true},
+				},
+			},
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'Version 2 of a template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['shared.txt']`,
+				"shared.txt": "v2 shared",
+				"v1/spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'Version 1 of a template'
+steps:
+  - desc: 'Include files'
+    action: 'include'
+    params:
+      paths: ['old.txt', 'shared.txt']`,
+				"v1/old.txt":    "from v1",
+				"v1/shared.txt": "v1 shared",
+			},
+			expectedGoldenContent: map[string]string{
+				"data/old.txt":    "from v1",
+				"data/shared.txt": "v2 shared",
+			},
+		},
+		{
+			name: "phase_output_conflicts_without_force_overwrite",
+			testCase: &TestCase{
+				TestName: "test",
+				TestConfig: &goldentest.Test{
+					Phases: []*goldentest.Phase{{}},
+				},
+			},
+			filesContent: map[string]string{
+				"spec.yaml": specYaml,
+				"a.txt":     "file A content",
+			},
+			wantErr: "overwrite",
+		},
+		{
+			name: "stdout_is_normalized",
+			testCase: &TestCase{
+				TestName: "test",
+				TestConfig: &goldentest.Test{
+					Stdout: &goldentest.Stdout{
+						SortLines:              model.Bool{Val: true},
+						TrimTrailingWhitespace: model.Bool{Val: true},
+						Replacements: []*goldentest.StdoutReplacement{
+							{
+								Regex: model.String{Val: "took [0-9]+ms"},
+								With:  model.String{Val: "took <duration>"},
+							},
+						},
+					},
+				},
+			},
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+
+desc: 'A template that prints in an arbitrary order'
+steps:
+  - desc: 'Print some messages'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'env'
+        values: ['prod', 'dev']
+      steps:
+        - desc: 'Print a message'
+          action: 'print'
+          params:
+            message: '{{.env}} took 123ms  '`,
+			},
+			expectedGoldenContent: map[string]string{
+				"data/.abc/stdout": "dev took <duration>\nprod took <duration>\n",
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -316,7 +546,7 @@ steps:
 			abctestutil.WriteAllDefaultMode(t, tempDir, tc.filesContent)
 
 			ctx := context.Background()
-			err := renderTestCase(ctx, tempDir, tempDir, tc.testCase)
+			err := renderTestCase(ctx, &common.RealFS{}, tempDir, tempDir, tc.testCase, nil)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
@@ -332,6 +562,91 @@ steps:
 	}
 }
 
+func TestMapToVarValues(t *testing.T) {
+	t.Parallel()
+
+	got := mapToVarValues(map[string]string{"zone": "z", "app": "a", "env": "e", "_git_tag": "t"})
+	want := []*goldentest.VarValue{
+		{Name: model.String{Val: "_git_tag"}, Value: model.String{Val: "t"}},
+		{Name: model.String{Val: "app"}, Value: model.String{Val: "a"}},
+		{Name: model.String{Val: "env"}, Value: model.String{Val: "e"}},
+		{Name: model.String{Val: "zone"}, Value: model.String{Val: "z"}},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("mapToVarValues() was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestNormalizeStdout(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+		opts *goldentest.Stdout
+		want string
+	}{
+		{
+			name: "no_options",
+			in:   "b  \na\n",
+			want: "b  \na\n",
+		},
+		{
+			name: "sort_keeps_final_newline_last",
+			in:   "c\na\nb\n",
+			opts: &goldentest.Stdout{SortLines: model.Bool{Val: true}},
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "sort_without_final_newline",
+			in:   "c\na\nb",
+			opts: &goldentest.Stdout{SortLines: model.Bool{Val: true}},
+			want: "a\nb\nc",
+		},
+		{
+			name: "trim_trailing_whitespace",
+			in:   "a \t\nb\r\n",
+			opts: &goldentest.Stdout{TrimTrailingWhitespace: model.Bool{Val: true}},
+			want: "a\nb\n",
+		},
+		{
+			name: "replacements_use_subgroups",
+			in:   "created at 2024-01-02\n",
+			opts: &goldentest.Stdout{
+				Replacements: []*goldentest.StdoutReplacement{
+					{
+						Regex: model.String{Val: `at (\d+)-\d+-\d+`},
+						With:  model.String{Val: "in year $1"},
+					},
+				},
+			},
+			want: "created in year 2024\n",
+		},
+		{
+			name: "empty",
+			in:   "",
+			opts: &goldentest.Stdout{SortLines: model.Bool{Val: true}},
+			want: "",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := normalizeStdout(tc.in, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("normalized stdout was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
 func TestBuiltIns(t *testing.T) {
 	t.Parallel()
 
@@ -575,7 +890,7 @@ steps:
 			abctestutil.WriteAllDefaultMode(t, tempDir, tc.filesContent)
 
 			ctx := context.Background()
-			err := renderTestCase(ctx, tempDir, tempDir, tc.testCase)
+			err := renderTestCase(ctx, &common.RealFS{}, tempDir, tempDir, tc.testCase, nil)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
@@ -657,7 +972,7 @@ func TestRenameGitDirsAndFiles(t *testing.T) {
 
 			abctestutil.WriteAllDefaultMode(t, tempDir, tc.filesContent)
 
-			err := renameGitDirsAndFiles(tempDir)
+			err := renameGitDirsAndFiles(&common.RealFS{}, tempDir)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
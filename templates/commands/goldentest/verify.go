@@ -27,19 +27,30 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/fatih/color"
-	"github.com/mattn/go-isatty"
 	"github.com/sergi/go-diff/diffmatchpatch"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/render"
 	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/common/ui"
+	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta4"
 	"github.com/abcxyz/pkg/cli"
 )
 
 type VerifyCommand struct {
-	flags Flags
+	flags VerifyFlags
 
 	cli.BaseCommand
+
+	// testFS allows filesystem interaction to be faked for testing. If nil,
+	// the real filesystem is used.
+	testFS common.FS
+
+	// testFetchCLI replaces fetchCLI in tests, to use a fake abc binary for
+	// --cli-version.
+	testFetchCLI func(ctx context.Context, rfs common.FS, version string) (string, error)
 }
 
 func (c *VerifyCommand) Desc() string {
@@ -52,6 +63,10 @@ Usage: {{ COMMAND }} [--test-name=<test-name-1>,<test-name-2>] [<location>]
 
 The {{ COMMAND }} verifies the template golden tests.
 
+Mismatched files are shown as a line diff, where lines that were recorded but
+not generated begin with "-", and lines that were generated but not recorded
+begin with "+".
+
 The "<test_name>" is the name of the test. If no <test_name> is specified,
 all tests will be run against.
 
@@ -61,7 +76,19 @@ If no "<location>" is given, default to current directory.
 For every test case, it is expected that
   - a testdata/golden/<test_name> folder exists to host test results.
   - a testdata/golden/<test_name>/test.yaml exists to define
-template input params.`
+template input params.
+
+If --golden-dir is given, the test cases are in <golden-dir>/<test_name>
+instead of testdata/golden/<test_name>.
+
+If a test.yaml has "verify" steps, like "go build ./...", they're run in a
+copy of the test's output after it's rendered. This requires --allow-exec.
+
+With --cli-version, the tests are recorded by that released version of abc,
+which is downloaded, instead of being rendered by this one. This shows whether
+the recorded output stays the same with another version of abc before
+upgrading to it. The verify steps aren't run, since they check the template
+rather than abc.`
 }
 
 func (c *VerifyCommand) Flags() *cli.FlagSet {
@@ -75,54 +102,92 @@ func (c *VerifyCommand) Run(ctx context.Context, args []string) (rErr error) {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
 
-	testCases, err := parseTestCases(ctx, c.flags.Location, c.flags.TestNames)
+	rfs := c.testFS
+	if rfs == nil {
+		rfs = &common.RealFS{}
+	}
+
+	testCases, err := parseTestCases(ctx, rfs, c.flags.Location, c.flags.GoldenDir, c.flags.TestNames)
 	if err != nil {
 		return fmt.Errorf("failed to parse golden tests: %w", err)
 	}
+	testCases = shardTestCases(testCases, c.flags.ShardIndex, c.flags.ShardCount)
+	if c.flags.CLIVersion == "" {
+		if err := checkAllowExec(testCases, c.flags.AllowExec); err != nil {
+			return err
+		}
+	}
 
-	fs := &common.RealFS{}
-
-	tempTracker := tempdir.NewDirTracker(fs, false)
+	tempTracker := tempdir.NewDirTracker(rfs, false)
 	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
 
 	// Create a temporary directory to render golden tests
-	tempDir, err := renderTestCases(ctx, testCases, c.flags.Location)
-	if err != nil {
-		return fmt.Errorf("failed to render test cases: %w", err)
+	var cov *render.Coverage
+	if c.flags.Coverage {
+		cov = render.NewCoverage()
 	}
-	tempTracker.Track(tempDir)
+	stats := &templatesource.DownloadStats{}
+	verifyStepErrs := make(map[string]error, len(testCases))
+	var tempDir string
+	if c.flags.CLIVersion != "" {
+		// The released abc renames the git files itself when it records.
+		tempDir, err = c.recordWithRelease(ctx, rfs, tempTracker, testCases)
+		if err != nil {
+			return err
+		}
+	} else {
+		tempDir, err = renderTestCases(ctx, rfs, testCases, c.flags.Location, &renderOptions{
+			cov:        cov,
+			retry:      &templatesource.RetryPolicy{MaxRetries: c.flags.DownloadRetries},
+			stats:      stats,
+			allowDirty: c.flags.AllowDirtyTemplate,
+			redact:     c.flags.Redact,
+
+			strictAPIVersion: c.flags.StrictAPIVersion,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to render test cases: %w", err)
+		}
+		tempTracker.Track(tempDir)
 
-	if err := renameGitDirsAndFiles(tempDir); err != nil {
-		return fmt.Errorf("failed renaming git related dirs and files: %w", err)
+		// The verify steps run before the git files are renamed, so they see
+		// the output as it was rendered.
+		for _, tc := range testCases {
+			tempDataDir := filepath.Join(tempDir, goldenTestDir, tc.TestName, testDataDir)
+			verifyStepErrs[tc.TestName] = runVerifySteps(ctx, rfs, tempDataDir, tc.TestConfig.Verify, c.LookupEnv)
+		}
+
+		if err := renameGitDirsAndFiles(rfs, tempDir); err != nil {
+			return fmt.Errorf("failed renaming git related dirs and files: %w", err)
+		}
 	}
 
 	var merr error
 
 	// Highlight error message color, given diff text might be hundreds lines long.
-	// Only color the text when the result is to displayed at a terminal
-	var red, green func(a ...interface{}) string
-	useColor := c.Stdout() == os.Stdout && isatty.IsTerminal(os.Stdout.Fd())
-	if useColor {
-		red = color.New(color.FgRed).SprintFunc()
-		green = color.New(color.FgGreen).SprintFunc()
-	} else {
-		red = fmt.Sprint
-		green = fmt.Sprint
-	}
+	colors := ui.NewColors(ui.ColorMode(c.flags.Color), c.Stdout(), c.LookupEnv)
+	red, green := colors.Red, colors.Green
+
+	resultReport := "\n" + ui.Msg(ui.MsgVerifyReportHeader) + "\n"
 
-	resultReport := "\nTest Report:\n"
+	diffOpts := &diffOptions{
+		contextLines: c.flags.ContextLines,
+		maxLines:     c.flags.MaxDiffLines,
+		red:          red,
+		green:        green,
+	}
 
 	for _, tc := range testCases {
-		goldenDataDir := filepath.Join(c.flags.Location, goldenTestDir, tc.TestName, testDataDir)
+		goldenDataDir := filepath.Join(c.flags.GoldenDir, tc.TestName, testDataDir)
 		tempDataDir := filepath.Join(tempDir, goldenTestDir, tc.TestName, testDataDir)
 		goldenStdoutFile := filepath.Join(goldenDataDir, common.ABCInternalDir, common.ABCInternalStdout)
 		tempStdoutFile := filepath.Join(tempDataDir, common.ABCInternalDir, common.ABCInternalStdout)
 
 		fileSet := make(map[string]struct{})
-		if err := addTestFiles(fileSet, goldenDataDir); err != nil {
+		if err := addTestFiles(ctx, rfs, fileSet, goldenDataDir); err != nil {
 			return err
 		}
-		if err := addTestFiles(fileSet, tempDataDir); err != nil {
+		if err := addTestFiles(ctx, rfs, fileSet, tempDataDir); err != nil {
 			return err
 		}
 
@@ -143,10 +208,10 @@ func (c *VerifyCommand) Run(ctx context.Context, args []string) (rErr error) {
 			abcRenameTrimedGoldenFile := strings.TrimSuffix(goldenFile, abcRenameSuffix)
 			abcRenameTrimedTempFile := strings.TrimSuffix(tempFile, abcRenameSuffix)
 
-			goldenContent, err := os.ReadFile(goldenFile)
+			goldenContent, goldenIsLink, err := readTestFile(rfs, goldenFile)
 			if err != nil {
 				if errors.Is(err, os.ErrNotExist) {
-					failureText := red(fmt.Sprintf("-- [%s] generated, however not recorded in test data", abcRenameTrimedGoldenFile))
+					failureText := red(ui.Msg(ui.MsgVerifyNotRecorded, abcRenameTrimedGoldenFile))
 					err := fmt.Errorf(failureText)
 					tcErr = errors.Join(tcErr, err)
 					outputMismatch = true
@@ -155,10 +220,10 @@ func (c *VerifyCommand) Run(ctx context.Context, args []string) (rErr error) {
 				return fmt.Errorf("failed to read (%s): %w", abcRenameTrimedGoldenFile, err)
 			}
 
-			tempContent, err := os.ReadFile(tempFile)
+			tempContent, tempIsLink, err := readTestFile(rfs, tempFile)
 			if err != nil {
 				if errors.Is(err, os.ErrNotExist) {
-					failureText := red(fmt.Sprintf("-- [%s] expected, however missing", abcRenameTrimedGoldenFile))
+					failureText := red(ui.Msg(ui.MsgVerifyMissing, abcRenameTrimedGoldenFile))
 					err := fmt.Errorf(failureText)
 					tcErr = errors.Join(tcErr, err)
 					continue
@@ -166,64 +231,96 @@ func (c *VerifyCommand) Run(ctx context.Context, args []string) (rErr error) {
 				return fmt.Errorf("failed to read (%s): %w", abcRenameTrimedTempFile, err)
 			}
 
-			// Set checklines to false: avoid a line-level diff which is faster
-			// however less optimal.
-			diffs := dmp.DiffMain(string(tempContent), string(goldenContent), false)
+			if goldenIsLink || tempIsLink {
+				if mismatch := symlinkMismatch(goldenContent, goldenIsLink, tempContent, tempIsLink); mismatch != "" {
+					failureText := red(ui.Msg(ui.MsgVerifySymlinkMismatch, abcRenameTrimedGoldenFile, mismatch))
+					tcErr = errors.Join(tcErr, fmt.Errorf("%s", failureText))
+					outputMismatch = true
+				}
+				continue
+			}
+
+			if c.flags.NormalizeLineEndings {
+				goldenContent = string(common.NormalizeText([]byte(goldenContent), common.LineEndingsLF, true))
+				tempContent = string(common.NormalizeText([]byte(tempContent), common.LineEndingsLF, true))
+			}
+
+			diffs := lineDiff(dmp, goldenContent, tempContent)
 
-			if hasDiff(diffs) {
-				failureText := red(fmt.Sprintf("-- [%s] file content mismatch", abcRenameTrimedGoldenFile))
-				err := fmt.Errorf("%s:\n%s", failureText, dmp.DiffPrettyText(diffs))
+			if hasLineDiff(diffs) {
+				failureText := red(ui.Msg(ui.MsgVerifyContentMismatch, abcRenameTrimedGoldenFile))
+				err := fmt.Errorf("%s", failureText)
+				if !c.flags.NameOnly {
+					err = fmt.Errorf("%s:\n%s", failureText, formatDiff(diffs, diffOpts))
+				}
 				tcErr = errors.Join(tcErr, err)
 				outputMismatch = true
 			}
 		}
 
-		stdoutDiff, err := getStdoutDiff(goldenStdoutFile, tempStdoutFile, dmp)
+		stdoutDiff, err := getStdoutDiff(rfs, goldenStdoutFile, tempStdoutFile, tc.TestConfig.Stdout, dmp)
 		if err != nil {
 			return fmt.Errorf("failed to compare stdout:%w", err)
 		}
-		if hasDiff(stdoutDiff) {
-			failureText := red("the printed messages differ between the recorded golden output and the actual output")
-			err := fmt.Errorf("%s:\n%s", failureText, dmp.DiffPrettyText(stdoutDiff))
+		if hasLineDiff(stdoutDiff) {
+			failureText := red(ui.Msg(ui.MsgVerifyStdoutMismatch))
+			err := fmt.Errorf("%s", failureText)
+			if !c.flags.NameOnly {
+				err = fmt.Errorf("%s:\n%s", failureText, formatDiff(stdoutDiff, diffOpts))
+			}
 			tcErr = errors.Join(tcErr, err)
 			outputMismatch = true
 		}
 
 		if outputMismatch {
-			failureText := red(fmt.Sprintf("golden test [%s] didn't match actual output, you might "+
-				"need to run 'record' command to capture it as the new expected output", tc.TestName))
+			failureText := red(ui.Msg(ui.MsgVerifyRecordHint, tc.TestName))
 			err := fmt.Errorf(failureText)
 			tcErr = errors.Join(tcErr, err)
 		}
 
+		if err := verifyStepErrs[tc.TestName]; err != nil {
+			tcErr = errors.Join(tcErr, fmt.Errorf("%s", red(err.Error())))
+		}
+
 		if tcErr != nil {
-			result := red(fmt.Sprintf("[x] golden test %s fails", tc.TestName))
+			result := red(ui.Msg(ui.MsgVerifyTestFails, tc.TestName))
 			tcErr := fmt.Errorf("%s:\n %w", result, tcErr)
 			merr = errors.Join(merr, tcErr)
 			resultReport += result
 		} else {
-			resultReport += green(fmt.Sprintf("[✓] golden test %s succeeds", tc.TestName))
+			resultReport += green(ui.Msg(ui.MsgVerifyTestSucceeds, tc.TestName))
 		}
 
 		resultReport += "\n"
 	}
 
+	if cov != nil {
+		resultReport += coverageReport(cov.Steps())
+	}
+	if stats.Downloads() > 0 {
+		resultReport += "\n" + stats.String() + "\n"
+	}
+
 	// Print test result report.
-	fmt.Println(resultReport)
+	fmt.Fprintln(c.Stdout(), resultReport)
 
 	if merr != nil {
-		return fmt.Errorf("golden test verification failure:\n %w", merr)
+		return errs.Wrap(errs.ErrGoldenMismatch, fmt.Errorf("golden test verification failure:\n %w", merr))
 	}
 
 	return nil
 }
 
-// addTestFiles collects file paths generated in a golden test.
-func addTestFiles(fileSet map[string]struct{}, testDataDir string) error {
-	err := fs.WalkDir(&common.RealFS{}, testDataDir, func(path string, de fs.DirEntry, err error) error {
+// addTestFiles collects file paths generated in a golden test. It stops with
+// an error once ctx is canceled.
+func addTestFiles(ctx context.Context, rfs common.FS, fileSet map[string]struct{}, testDataDir string) error {
+	err := fs.WalkDir(rfs, testDataDir, func(path string, de fs.DirEntry, err error) error {
 		if err != nil {
 			return fmt.Errorf("fs.WalkDir(%s): %w", path, err)
 		}
+		if err := ctx.Err(); err != nil {
+			return err //nolint:wrapcheck
+		}
 
 		relToSrc, err := filepath.Rel(testDataDir, path)
 		if err != nil {
@@ -252,35 +349,64 @@ func addTestFiles(fileSet map[string]struct{}, testDataDir string) error {
 	return nil
 }
 
-// hasDiff returns whether file content mismatch exits.
-func hasDiff(diffs []diffmatchpatch.Diff) bool {
-	for _, diff := range diffs {
-		if diff.Type != diffmatchpatch.DiffEqual {
-			return true
+// readTestFile returns the contents of a file in a golden test's data
+// directory. If the file is a symlink, it returns the symlink's target instead,
+// and isLink is true, so symlinks are compared by their targets.
+func readTestFile(rfs common.FS, path string) (_ string, isLink bool, _ error) {
+	target, isLink, err := common.ReadlinkIfSymlink(rfs, path)
+	if err != nil {
+		return "", false, err //nolint:wrapcheck
+	}
+	if isLink {
+		return target, true, nil
+	}
+	buf, err := rfs.ReadFile(path)
+	if err != nil {
+		return "", false, err //nolint:wrapcheck
+	}
+	return string(buf), false, nil
+}
+
+// symlinkMismatch describes the difference between a recorded file and a
+// generated file, at least one of which is a symlink. For a symlink, the
+// contents are its target. It returns "" if they're the same.
+func symlinkMismatch(golden string, goldenIsLink bool, actual string, actualIsLink bool) string {
+	switch {
+	case goldenIsLink && actualIsLink:
+		if golden == actual {
+			return ""
 		}
+		return fmt.Sprintf("symlink target mismatch: recorded as a symlink to %q, but generated as a symlink to %q", golden, actual)
+	case goldenIsLink:
+		return fmt.Sprintf("recorded as a symlink to %q, but generated as a regular file", golden)
+	default:
+		return fmt.Sprintf("recorded as a regular file, but generated as a symlink to %q", actual)
 	}
-	return false
 }
 
-func getStdoutDiff(goldenStdoutPath, tempStdoutPath string, dmp *diffmatchpatch.DiffMatchPatch) ([]diffmatchpatch.Diff, error) {
-	goldenStdout, err := os.ReadFile(goldenStdoutPath)
+// getStdoutDiff compares the recorded and actual messages printed by a
+// template. The actual messages were already normalized when the test case was
+// rendered. The recorded messages are normalized too, so a test that was
+// recorded before normalization was configured doesn't have to be re-recorded.
+func getStdoutDiff(rfs common.FS, goldenStdoutPath, tempStdoutPath string, opts *goldentest.Stdout, dmp *diffmatchpatch.DiffMatchPatch) ([]diffLine, error) {
+	goldenStdout, err := rfs.ReadFile(goldenStdoutPath)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("failed to read (%s): %w", tempStdoutPath, err)
 		}
 		goldenStdout = []byte("")
 	}
+	normalizedGolden, err := normalizeStdout(string(goldenStdout), opts)
+	if err != nil {
+		return nil, err
+	}
 
-	tempStdout, err := os.ReadFile(tempStdoutPath)
+	tempStdout, err := rfs.ReadFile(tempStdoutPath)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("failed to read (%s): %w", tempStdoutPath, err)
 		}
 		tempStdout = []byte("")
 	}
-	// Set checklines to false: avoid a line-level diff which is faster
-	// however less optimal.
-	diffs := dmp.DiffMain(string(tempStdout), string(goldenStdout), false)
-
-	return diffs, nil
+	return lineDiff(dmp, normalizedGolden, string(tempStdout)), nil
 }
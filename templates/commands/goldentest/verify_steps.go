@@ -0,0 +1,110 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+// This file runs the "verify" steps of golden tests, which are commands like
+// "go build ./..." that check that a template's output actually works.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/ui"
+	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta4"
+)
+
+// passedEnvVars are the environment variables that every verify step sees, if
+// they're set, since most programs need them to work at all. Other variables
+// must be named in the step's "env".
+var passedEnvVars = []string{"PATH", "HOME", "TMPDIR", "TEMP", "TMP", "SYSTEMROOT", "USERPROFILE"}
+
+// checkAllowExec returns an error if any of the test cases has verify steps
+// and allowExec is false.
+func checkAllowExec(testCases []*TestCase, allowExec bool) error {
+	if allowExec {
+		return nil
+	}
+	for _, tc := range testCases {
+		if len(tc.TestConfig.Verify) > 0 {
+			return fmt.Errorf("golden test %q has verify steps, which run external programs and require the --allow-exec flag", tc.TestName)
+		}
+	}
+	return nil
+}
+
+// runVerifySteps runs the verify steps of a test case, in order, in a copy of
+// its output in testDataDir, so the steps can't change the output that's
+// compared with the recorded files. It stops at the first step that fails, and
+// returns an error saying which one. The copy is removed afterward.
+func runVerifySteps(ctx context.Context, rfs common.FS, testDataDir string, steps []*goldentest.VerifyStep, lookupEnv func(string) (string, bool)) (rErr error) {
+	if len(steps) == 0 {
+		return nil
+	}
+
+	tempTracker := tempdir.NewDirTracker(rfs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+	workDir, err := tempTracker.MkdirTempTracked("", tempdir.GoldenTestVerifyNamePart)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory for verify steps: %w", err)
+	}
+	if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+		DstRoot:  workDir,
+		SrcRoot:  testDataDir,
+		FS:       rfs,
+		Symlinks: common.SymlinksPreserve,
+		Visitor: func(relPath string, de fs.DirEntry) (common.CopyHint, error) {
+			// The .abc directory isn't part of the template's output.
+			return common.CopyHint{Skip: common.IsReservedInDest(relPath)}, nil
+		},
+	}); err != nil {
+		return fmt.Errorf("failed copying the test output for verify steps: %w", err)
+	}
+
+	for _, step := range steps {
+		args := make([]string, 0, len(step.Command))
+		for _, c := range step.Command {
+			args = append(args, c.Val)
+		}
+		desc := step.Desc.Val
+		if desc == "" {
+			desc = strings.Join(args, " ")
+		}
+
+		env := make([]string, 0, len(passedEnvVars)+len(step.Env))
+		for _, name := range passedEnvVars {
+			if val, ok := lookupEnv(name); ok {
+				env = append(env, name+"="+val)
+			}
+		}
+		for _, name := range step.Env {
+			if val, ok := lookupEnv(name.Val); ok {
+				env = append(env, name.Val+"="+val)
+			}
+		}
+
+		stepCtx, cancel := context.WithTimeout(ctx, step.TimeoutOrDefault(common.DefaultRunTimeout))
+		_, _, err := common.RunInDir(stepCtx, workDir, env, args...)
+		cancel()
+		if err != nil {
+			return errors.New(ui.Msg(ui.MsgVerifyStepFailed, desc, step.Pos.Errorf("%w", err).Error()))
+		}
+	}
+	return nil
+}
@@ -17,10 +17,17 @@ package goldentest
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/testutil"
 )
@@ -53,11 +60,20 @@ steps:
 `
 	testYaml := `api_version: 'cli.abcxyz.dev/v1beta5'
 kind: 'GoldenTest'`
+	testYamlWithVerify := func(command string) string {
+		return testYaml + `
+verify:
+  - desc: 'Check the output'
+    command: ` + command
+	}
 
 	cases := []struct {
 		name         string
 		testNames    []string
+		flagArgs     []string
 		filesContent map[string]string
+		symlinks     map[string]string
+		emptyDirs    []string
 		wantErrs     []string
 	}{
 		{
@@ -311,6 +327,32 @@ kind: 'GoldenTest'`
 				".gitignore] file content mismatch",
 			},
 		},
+		{
+			name:     "long_diff_is_truncated",
+			flagArgs: []string{"--max-diff-lines=2"},
+			filesContent: map[string]string{
+				"spec.yaml":                        specYaml,
+				"a.txt":                            "1\n2\n3\n4\n",
+				"testdata/golden/test1/test.yaml":  testYaml,
+				"testdata/golden/test1/data/a.txt": "",
+			},
+			wantErrs: []string{
+				"a.txt] file content mismatch:\n+1\n+2\n… 2 more lines",
+			},
+		},
+		{
+			name:     "name_only",
+			flagArgs: []string{"--name-only"},
+			filesContent: map[string]string{
+				"spec.yaml":                        specYaml,
+				"a.txt":                            "file A content",
+				"testdata/golden/test1/test.yaml":  testYaml,
+				"testdata/golden/test1/data/a.txt": "recorded content",
+			},
+			wantErrs: []string{
+				"a.txt] file content mismatch\n",
+			},
+		},
 		{
 			name: "simple_test_without_dot_abc_directory_succeeeds",
 			filesContent: map[string]string{
@@ -322,6 +364,149 @@ kind: 'GoldenTest'`
 				"testdata/golden/test1/data/b.txt": "file B content",
 			},
 		},
+		{
+			name: "empty_dir_verify_succeeds",
+			filesContent: map[string]string{
+				"spec.yaml":                      specYaml,
+				"a.txt":                          "file A content",
+				"testdata/golden/test/test.yaml": testYaml,
+				"testdata/golden/test/data/.abc/.gitkeep":   "",
+				"testdata/golden/test/data/a.txt":           "file A content",
+				"testdata/golden/test/data/empty/.abc_keep": "",
+			},
+			emptyDirs: []string{"empty"},
+		},
+		{
+			name: "empty_dir_missing",
+			filesContent: map[string]string{
+				"spec.yaml":                      specYaml,
+				"a.txt":                          "file A content",
+				"testdata/golden/test/test.yaml": testYaml,
+				"testdata/golden/test/data/.abc/.gitkeep":   "",
+				"testdata/golden/test/data/a.txt":           "file A content",
+				"testdata/golden/test/data/empty/.abc_keep": "",
+			},
+			wantErrs: []string{"empty/.abc_keep] expected, however missing"},
+		},
+		{
+			name: "symlink_verify_succeeds",
+			filesContent: map[string]string{
+				"spec.yaml":                      specYaml,
+				"a.txt":                          "file A content",
+				"testdata/golden/test/test.yaml": testYaml + "\nsymlinks: 'preserve'",
+				"testdata/golden/test/data/.abc/.gitkeep": "",
+				"testdata/golden/test/data/a.txt":         "file A content",
+			},
+			symlinks: map[string]string{
+				"link.txt":                           "a.txt",
+				"testdata/golden/test/data/link.txt": "a.txt",
+			},
+		},
+		{
+			name: "symlink_target_mismatch",
+			filesContent: map[string]string{
+				"spec.yaml":                      specYaml,
+				"a.txt":                          "file A content",
+				"b.txt":                          "file B content",
+				"testdata/golden/test/test.yaml": testYaml + "\nsymlinks: 'preserve'",
+				"testdata/golden/test/data/.abc/.gitkeep": "",
+				"testdata/golden/test/data/a.txt":         "file A content",
+				"testdata/golden/test/data/b.txt":         "file B content",
+			},
+			symlinks: map[string]string{
+				"link.txt":                           "a.txt",
+				"testdata/golden/test/data/link.txt": "b.txt",
+			},
+			wantErrs: []string{
+				`link.txt] symlink target mismatch`,
+			},
+		},
+		{
+			name: "symlink_recorded_as_regular_file",
+			filesContent: map[string]string{
+				"spec.yaml":                      specYaml,
+				"a.txt":                          "file A content",
+				"testdata/golden/test/test.yaml": testYaml + "\nsymlinks: 'preserve'",
+				"testdata/golden/test/data/.abc/.gitkeep": "",
+				"testdata/golden/test/data/a.txt":         "file A content",
+				"testdata/golden/test/data/link.txt":      "file A content",
+			},
+			symlinks: map[string]string{
+				"link.txt": "a.txt",
+			},
+			wantErrs: []string{
+				`link.txt] recorded as a regular file, but generated as a symlink to "a.txt"`,
+			},
+		},
+		{
+			name: "crlf_golden_data_mismatch",
+			filesContent: map[string]string{
+				"spec.yaml":                      specYaml,
+				"a.txt":                          "line 1\nline 2\n",
+				"testdata/golden/test/test.yaml": testYaml,
+				"testdata/golden/test/data/.abc/.gitkeep": "",
+				"testdata/golden/test/data/a.txt":         "\xef\xbb\xbfline 1\r\nline 2\r\n",
+			},
+			wantErrs: []string{"a.txt] file content mismatch"},
+		},
+		{
+			name:     "crlf_golden_data_with_normalize_line_endings_succeeds",
+			flagArgs: []string{"--normalize-line-endings"},
+			filesContent: map[string]string{
+				"spec.yaml":                      specYaml,
+				"a.txt":                          "line 1\nline 2\n",
+				"testdata/golden/test/test.yaml": testYaml,
+				"testdata/golden/test/data/.abc/.gitkeep": "",
+				"testdata/golden/test/data/a.txt":         "\xef\xbb\xbfline 1\r\nline 2\r\n",
+			},
+		},
+		{
+			name:     "verify_step_succeeds",
+			flagArgs: []string{"--allow-exec"},
+			filesContent: map[string]string{
+				"spec.yaml":                       specYaml,
+				"a.txt":                           "file A content",
+				"testdata/golden/test/test.yaml":  testYamlWithVerify(`['sh', '-c', 'grep -q "file A" a.txt && test ! -e .abc']`),
+				"testdata/golden/test/data/a.txt": "file A content",
+			},
+		},
+		{
+			// The step runs in a copy of the output, so its changes aren't
+			// compared with the recorded files.
+			name:     "verify_step_changes_are_not_compared",
+			flagArgs: []string{"--allow-exec"},
+			filesContent: map[string]string{
+				"spec.yaml":                       specYaml,
+				"a.txt":                           "file A content",
+				"testdata/golden/test/test.yaml":  testYamlWithVerify(`['sh', '-c', 'echo changed > a.txt && touch new.txt']`),
+				"testdata/golden/test/data/a.txt": "file A content",
+			},
+		},
+		{
+			name:     "verify_step_fails",
+			flagArgs: []string{"--allow-exec"},
+			filesContent: map[string]string{
+				"spec.yaml":                       specYaml,
+				"a.txt":                           "file A content",
+				"testdata/golden/test/test.yaml":  testYamlWithVerify(`['sh', '-c', 'echo oops >&2; exit 3']`),
+				"testdata/golden/test/data/a.txt": "file A content",
+			},
+			wantErrs: []string{
+				"[x] golden test test fails",
+				"-- verify step [Check the output] failed",
+				"stderr: oops",
+			},
+		},
+		{
+			name: "verify_step_needs_allow_exec",
+			filesContent: map[string]string{
+				"spec.yaml":                       specYaml,
+				"a.txt":                           "file A content",
+				"testdata/golden/test/test.yaml":  testYamlWithVerify(`['true']`),
+				"testdata/golden/test/data/a.txt": "file A content",
+			},
+			wantErrs: []string{`golden test "test" has verify steps, which run external programs and require the --allow-exec flag`},
+		},
 	}
 
 	for _, tc := range cases {
@@ -333,6 +518,8 @@ kind: 'GoldenTest'`
 			tempDir := t.TempDir()
 
 			abctestutil.WriteAllDefaultMode(t, tempDir, tc.filesContent)
+			abctestutil.WriteSymlinks(t, tempDir, tc.symlinks)
+			abctestutil.WriteEmptyDirs(t, tempDir, tc.emptyDirs)
 
 			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
 
@@ -340,6 +527,7 @@ kind: 'GoldenTest'`
 			if len(tc.testNames) > 0 {
 				args = append(args, "--test-name", strings.Join(tc.testNames, ","))
 			}
+			args = append(args, tc.flagArgs...)
 			args = append(args, tempDir)
 
 			r := &VerifyCommand{}
@@ -355,3 +543,219 @@ kind: 'GoldenTest'`
 		})
 	}
 }
+
+func TestVerifyFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    VerifyFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--test-name=test1",
+				"--context-lines=1",
+				"--max-diff-lines=0",
+				"--name-only",
+				"--normalize-line-endings",
+				"--color=never",
+				"--allow-exec",
+				"--cli-version=v0.9.0",
+				"/a/b/c",
+			},
+			want: VerifyFlags{
+				Flags: Flags{
+					TestNames:       []string{"test1"},
+					Location:        "/a/b/c",
+					GoldenDir:       "/a/b/c/testdata/golden",
+					ShardCount:      1,
+					DownloadRetries: 3,
+				},
+				ContextLines:         1,
+				MaxDiffLines:         0,
+				NameOnly:             true,
+				NormalizeLineEndings: true,
+				Color:                "never",
+				AllowExec:            true,
+				CLIVersion:           "v0.9.0",
+			},
+		},
+		{
+			name: "defaults",
+			args: []string{},
+			want: VerifyFlags{
+				Flags: Flags{
+					Location:        ".",
+					GoldenDir:       "testdata/golden",
+					ShardCount:      1,
+					DownloadRetries: 3,
+				},
+				ContextLines: 3,
+				MaxDiffLines: 100,
+				Color:        "auto",
+			},
+		},
+		{
+			name:    "negative_context_lines",
+			args:    []string{"--context-lines=-1"},
+			wantErr: "--context-lines must not be negative",
+		},
+		{
+			name:    "invalid_color",
+			args:    []string{"--color=sometimes"},
+			wantErr: `invalid --color: invalid color mode "sometimes"`,
+		},
+		{
+			name:    "cli_version_with_coverage",
+			args:    []string{"--cli-version=v0.9.0", "--coverage"},
+			wantErr: "--coverage can't be combined with --cli-version",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd VerifyCommand
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestVerifyCommand_CLIVersion(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake abc binary is a shell script")
+	}
+
+	// fakeABC is a stand-in for a released abc. It records every test case
+	// under --golden-dir with the same output.
+	const fakeABC = `#!/bin/sh
+for arg in "$@"; do
+  case "$arg" in
+    -help) [ -n "$OLD" ] || echo '    -golden-dir="../my-template-goldens"' >&2; exit 0 ;;
+    --golden-dir=*) golden="${arg#--golden-dir=}" ;;
+  esac
+done
+[ -n "$FAIL" ] && { echo "failed to render" >&2; exit 1; }
+for dir in "$golden"/*/; do
+  mkdir -p "$dir/data/.abc"
+  printf 'released output' > "$dir/data/a.txt"
+  printf 'Hello\n' > "$dir/data/.abc/stdout"
+done
+`
+	testYaml := `api_version: 'cli.abcxyz.dev/v1beta5'
+kind: 'GoldenTest'
+verify:
+  - desc: 'Check the output'
+    command: ['false']
+`
+
+	cases := []struct {
+		name     string
+		recorded string
+		fail     bool
+		old      bool
+		wantErrs []string
+	}{
+		{
+			name:     "same_output",
+			recorded: "released output",
+		},
+		{
+			name:     "different_output",
+			recorded: "this version's output",
+			wantErrs: []string{
+				"[x] golden test test fails",
+				"testdata/golden/test/data/a.txt] file content mismatch",
+			},
+		},
+		{
+			name:     "release_fails",
+			recorded: "released output",
+			fail:     true,
+			wantErrs: []string{
+				"abc v0.9.0 failed to record the tests: exit status 1",
+				"failed to render",
+			},
+		},
+		{
+			name:     "release_too_old",
+			recorded: "released output",
+			old:      true,
+			wantErrs: []string{
+				"abc v0.9.0 is too old for --cli-version",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+				"template/spec.yaml":                             "not used",
+				"template/testdata/golden/test/test.yaml":        testYaml,
+				"template/testdata/golden/test/data/a.txt":       tc.recorded,
+				"template/testdata/golden/test/data/.abc/stdout": "Hello\n",
+			})
+			bin := filepath.Join(tempDir, "bin", "abc")
+			script := fakeABC
+			if tc.fail {
+				script = strings.Replace(script, `[ -n "$FAIL" ]`, "true", 1)
+			}
+			if tc.old {
+				script = strings.Replace(script, `[ -n "$OLD" ]`, "true", 1)
+			}
+			abctestutil.WriteAllDefaultMode(t, filepath.Dir(bin), map[string]string{"abc": script})
+			if err := os.Chmod(bin, 0o700); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			r := &VerifyCommand{
+				testFetchCLI: func(ctx context.Context, rfs common.FS, version string) (string, error) {
+					if version != "v0.9.0" {
+						t.Errorf("got version %q, want v0.9.0", version)
+					}
+					return bin, nil
+				},
+			}
+			err := r.Run(ctx, []string{"--cli-version=v0.9.0", filepath.Join(tempDir, "template")})
+			if err != nil && len(tc.wantErrs) == 0 {
+				t.Fatalf("got unexpected error %s", err)
+			}
+			for _, wantErr := range tc.wantErrs {
+				if diff := testutil.DiffErrString(err, wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+			}
+
+			// The recorded files are untouched.
+			got := abctestutil.LoadDirWithoutMode(t, filepath.Join(tempDir, "template", "testdata"))
+			if got["golden/test/data/a.txt"] != tc.recorded {
+				t.Errorf("the recorded file was changed to %q", got["golden/test/data/a.txt"])
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+const (
+	formatDOT  = "dot"
+	formatJSON = "json"
+)
+
+// formats is the list of every supported output format, with the default
+// first.
+var formats = []string{formatDOT, formatJSON}
+
+// GraphFlags describes which templates to graph and how to print the graph.
+type GraphFlags struct {
+	// Sources are the locations of the templates to graph.
+	//
+	// Example: ./t/my-template
+	Sources []string
+
+	// Format is one of the formats in the formats list.
+	Format string
+
+	// GitProtocol either https or ssh.
+	GitProtocol string
+}
+
+func (r *GraphFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("GRAPH OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "format",
+		Example: "json",
+		Target:  &r.Format,
+		Default: formatDOT,
+		Predict: predict.Set(formats),
+		Usage: fmt.Sprintf(`The output format, one of %s. "dot" is the Graphviz DOT language, which can be drawn with a command like "dot -Tsvg".`,
+			strings.Join(formats, ", ")),
+	})
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	// The sources are the CLI arguments.
+	set.AfterParse(func(existingErr error) error {
+		for _, arg := range set.Args() {
+			if source := strings.TrimSpace(arg); source != "" {
+				r.Sources = append(r.Sources, source)
+			}
+		}
+		if len(r.Sources) == 0 {
+			return fmt.Errorf("missing <source> file")
+		}
+
+		if !slices.Contains(formats, r.Format) {
+			return fmt.Errorf("--format must be one of %s, but got %q", strings.Join(formats, ", "), r.Format)
+		}
+
+		return nil
+	})
+}
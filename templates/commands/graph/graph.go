@@ -0,0 +1,140 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graph implements the "templates graph" subcommand, which prints the
+// dependency graph between templates.
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/extends"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags GraphFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "print the dependency graph between templates"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <source> [<source>...]
+
+The {{ COMMAND }} command downloads each template <source>, and every template
+that they're composed from with "extends", and prints the dependency graph
+between them.
+
+Each template is shown once. A template at a canonical location, like a remote
+git repo, is identified by its location and the version that was downloaded,
+so "@latest" shows the actual version. A local template is identified by its
+path relative to the current directory.
+
+The command fails, after printing the graph, if the templates depend on each
+other in a cycle, or if more than one version of the same template is used. In
+the "dot" format, those templates are colored red.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type runParams struct {
+	cwd    string
+	fs     common.FS
+	stdout io.Writer
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		cwd:    wd,
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
+	tempTracker := tempdir.NewDirTracker(rp.fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	g, err := extends.BuildGraph(ctx, &extends.GraphParams{
+		Cwd:         rp.cwd,
+		Sources:     c.flags.Sources,
+		FS:          rp.fs,
+		GitProtocol: c.flags.GitProtocol,
+		Tracker:     tempTracker,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	switch c.flags.Format {
+	case formatJSON:
+		enc := json.NewEncoder(rp.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(g); err != nil {
+			return fmt.Errorf("failed writing graph: %w", err)
+		}
+	default:
+		if err := g.WriteDOT(rp.stdout); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return graphProblems(g)
+}
+
+// graphProblems returns an error describing the cycles and version conflicts
+// in g, or nil if there aren't any.
+func graphProblems(g *extends.Graph) error {
+	var problems []string
+	for _, c := range g.Cycles {
+		problems = append(problems, fmt.Sprintf("cycle: %s -> %s", strings.Join(c, " -> "), c[0]))
+	}
+	for _, c := range g.Conflicts {
+		problems = append(problems, fmt.Sprintf("version conflict: %s is used at versions %s", c.CanonicalSource, strings.Join(c.Versions, ", ")))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the template dependency graph has problems:\n  %s", strings.Join(problems, "\n  "))
+}
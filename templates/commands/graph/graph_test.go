@@ -0,0 +1,200 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestGraphFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    GraphFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--format", "json",
+				"--git-protocol", "ssh",
+				"t/a", "t/b",
+			},
+			want: GraphFlags{
+				Sources:     []string{"t/a", "t/b"},
+				Format:      "json",
+				GitProtocol: "ssh",
+			},
+		},
+		{
+			name: "defaults",
+			args: []string{"t/a"},
+			want: GraphFlags{
+				Sources:     []string{"t/a"},
+				Format:      "dot",
+				GitProtocol: "https",
+			},
+		},
+		{
+			name:    "missing_source",
+			args:    []string{},
+			wantErr: "missing <source> file",
+		},
+		{
+			name:    "bad_format",
+			args:    []string{"--format", "svg", "t/a"},
+			wantErr: `--format must be one of dot, json, but got "svg"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd Command
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	spec := func(desc, extends string) string {
+		out := "api_version: 'cli.abcxyz.dev/v1beta4'\nkind: 'Template'\ndesc: '" + desc + "'\n"
+		if extends != "" {
+			out += "extends: '" + extends + "'\n"
+		}
+		return out + "steps:\n  - desc: 'greet'\n    action: 'print'\n    params:\n      message: 'hi'\n"
+	}
+
+	cases := []struct {
+		name       string
+		files      map[string]string
+		flags      GraphFlags
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name: "dot",
+			files: map[string]string{
+				"a/spec.yaml":    spec("a", "../base"),
+				"base/spec.yaml": spec("base", ""),
+			},
+			flags: GraphFlags{Sources: []string{"a"}, Format: formatDOT},
+			wantStdout: `digraph templates {
+  "a" [label="a", shape=box];
+  "base" [label="base"];
+  "a" -> "base" [label="extends"];
+}
+`,
+		},
+		{
+			name: "json",
+			files: map[string]string{
+				"a/spec.yaml":    spec("a", "../base"),
+				"base/spec.yaml": spec("base", ""),
+			},
+			flags: GraphFlags{Sources: []string{"a"}, Format: formatJSON},
+			wantStdout: `{
+  "nodes": [
+    {
+      "id": "a",
+      "source": "a",
+      "desc": "a",
+      "root": true
+    },
+    {
+      "id": "base",
+      "source": "../base",
+      "desc": "base"
+    }
+  ],
+  "edges": [
+    {
+      "from": "a",
+      "to": "base",
+      "kind": "extends"
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "cycle_is_printed_then_fails",
+			files: map[string]string{
+				"a/spec.yaml": spec("a", "../b"),
+				"b/spec.yaml": spec("b", "../a"),
+			},
+			flags: GraphFlags{Sources: []string{"a"}, Format: formatDOT},
+			wantStdout: `digraph templates {
+  "a" [label="a", shape=box, color=red];
+  "b" [label="b", color=red];
+  "a" -> "b" [label="extends", color=red];
+  "b" -> "a" [label="extends", color=red];
+}
+`,
+			wantErr: "cycle: a -> b -> a",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tempDir, tc.files)
+
+			cmd := &Command{flags: tc.flags}
+			stdout := &strings.Builder{}
+			err := cmd.realRun(ctx, &runParams{
+				cwd:    tempDir,
+				fs:     &common.RealFS{},
+				stdout: stdout,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(stdout.String(), tc.wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
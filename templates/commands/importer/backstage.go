@@ -0,0 +1,324 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+const (
+	formatBackstage = "backstage"
+
+	// backstageFile is the name of the file containing a Backstage software
+	// template.
+	backstageFile = "template.yaml"
+
+	backstageAPIVersion = "scaffolder.backstage.io/v1beta3"
+)
+
+// backstageTemplate is the subset of a Backstage scaffolder template.yaml
+// that we know how to convert.
+//
+// See https://backstage.io/docs/features/software-templates/writing-templates.
+type backstageTemplate struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name        string `yaml:"name"`
+		Title       string `yaml:"title"`
+		Description string `yaml:"description"`
+	} `yaml:"metadata"`
+	Spec struct {
+		// Parameters is either a single parameter page or a list of them, so
+		// it's decoded later.
+		Parameters yaml.Node        `yaml:"parameters"`
+		Steps      []*backstageStep `yaml:"steps"`
+	} `yaml:"spec"`
+}
+
+// backstagePage is one page of the parameters form, which is a JSON schema
+// object.
+type backstagePage struct {
+	Title    string   `yaml:"title"`
+	Required []string `yaml:"required"`
+
+	// Properties is a mapping node, so the order of the parameters is kept.
+	Properties yaml.Node `yaml:"properties"`
+}
+
+type backstageProperty struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+	Default     any    `yaml:"default"`
+	Pattern     string `yaml:"pattern"`
+	Enum        []any  `yaml:"enum"`
+	MinLength   *int   `yaml:"minLength"`
+	MaxLength   *int   `yaml:"maxLength"`
+}
+
+type backstageStep struct {
+	ID     string    `yaml:"id"`
+	Name   string    `yaml:"name"`
+	Action string    `yaml:"action"`
+	Input  yaml.Node `yaml:"input"`
+}
+
+// backstageFetchInput is the input of the fetch:template and fetch:plain
+// actions.
+type backstageFetchInput struct {
+	URL        string `yaml:"url"`
+	TargetPath string `yaml:"targetPath"`
+
+	// Values is a mapping node, so the generated replacements are in the same
+	// order as the template.
+	Values yaml.Node `yaml:"values"`
+}
+
+var (
+	// backstageParamRef matches a value that is exactly a reference to a
+	// parameter, like "${{ parameters.name }}".
+	backstageParamRef = regexp.MustCompile(`^\$\{\{\s*parameters\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}$`)
+
+	// backstageExpr matches a value containing any template expression.
+	backstageExpr = regexp.MustCompile(`\$\{\{.*\}\}`)
+)
+
+// convertBackstage converts the Backstage template.yaml in dir.
+func convertBackstage(ctx context.Context, rfs common.FS, dir string) (*conversion, error) {
+	filename := filepath.Join(dir, backstageFile)
+	buf, err := rfs.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile(%s): %w", filename, err)
+	}
+
+	var bt backstageTemplate
+	if err := yaml.Unmarshal(buf, &bt); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filename, err)
+	}
+	if bt.Kind != "Template" || bt.APIVersion != backstageAPIVersion {
+		return nil, fmt.Errorf("%s is not a Backstage template: want apiVersion %q and kind %q, got %q and %q",
+			filename, backstageAPIVersion, "Template", bt.APIVersion, bt.Kind)
+	}
+
+	conv := &conversion{spec: &specForMarshaling{}}
+	conv.spec.Desc = firstNonEmpty(bt.Metadata.Description, bt.Metadata.Title, bt.Metadata.Name)
+
+	if err := conv.addBackstageInputs(&bt.Spec.Parameters); err != nil {
+		return nil, fmt.Errorf("error parsing parameters in %s: %w", filename, err)
+	}
+	for i, step := range bt.Spec.Steps {
+		if err := conv.addBackstageStep(step); err != nil {
+			return nil, fmt.Errorf("error converting step %d (%q) in %s: %w", i, step.ID, filename, err)
+		}
+	}
+
+	if len(conv.spec.Steps) == 0 {
+		return nil, fmt.Errorf("%s has no steps that could be converted", filename)
+	}
+	return conv, nil
+}
+
+// addBackstageInputs adds an input for each property of each parameter page.
+func (c *conversion) addBackstageInputs(params *yaml.Node) error {
+	var pages []*backstagePage
+	switch params.Kind {
+	case 0:
+		return nil // no parameters
+	case yaml.MappingNode:
+		var p backstagePage
+		if err := params.Decode(&p); err != nil {
+			return fmt.Errorf("Decode(): %w", err)
+		}
+		pages = []*backstagePage{&p}
+	default:
+		if err := params.Decode(&pages); err != nil {
+			return fmt.Errorf("Decode(): %w", err)
+		}
+	}
+
+	for _, page := range pages {
+		if page.Properties.Kind != yaml.MappingNode {
+			continue
+		}
+		content := page.Properties.Content
+		for i := 0; i+1 < len(content); i += 2 {
+			name := content[i].Value
+			var prop backstageProperty
+			if err := content[i+1].Decode(&prop); err != nil {
+				return fmt.Errorf("Decode(%s): %w", name, err)
+			}
+			c.addBackstageInput(name, &prop, slices.Contains(page.Required, name))
+		}
+	}
+	return nil
+}
+
+func (c *conversion) addBackstageInput(name string, prop *backstageProperty, required bool) {
+	in := &inputForMarshaling{
+		Name: name,
+		Desc: firstNonEmpty(prop.Description, prop.Title, name),
+	}
+
+	switch {
+	case prop.Default != nil:
+		d := fmt.Sprint(prop.Default)
+		in.Default = &d
+	case !required:
+		// Backstage lets optional parameters be omitted, whereas abc requires
+		// every input without a default.
+		d := ""
+		in.Default = &d
+	}
+
+	if prop.Type != "" && prop.Type != "string" {
+		c.warnf("parameter %q has type %q; abc inputs are always strings", name, prop.Type)
+	}
+
+	if prop.Pattern != "" {
+		in.Rules = append(in.Rules, &ruleForMarshaling{
+			Rule:    fmt.Sprintf("%s.matches(%s)", name, strconv.Quote(prop.Pattern)),
+			Message: fmt.Sprintf("must match the pattern %s", prop.Pattern),
+		})
+	}
+	if len(prop.Enum) > 0 {
+		vals := make([]string, 0, len(prop.Enum))
+		for _, v := range prop.Enum {
+			vals = append(vals, strconv.Quote(fmt.Sprint(v)))
+		}
+		in.Rules = append(in.Rules, &ruleForMarshaling{
+			Rule:    fmt.Sprintf("%s in [%s]", name, strings.Join(vals, ", ")),
+			Message: fmt.Sprintf("must be one of %s", strings.Join(vals, ", ")),
+		})
+	}
+	if prop.MinLength != nil {
+		in.Rules = append(in.Rules, &ruleForMarshaling{
+			Rule:    fmt.Sprintf("size(%s) >= %d", name, *prop.MinLength),
+			Message: fmt.Sprintf("must be at least %d characters", *prop.MinLength),
+		})
+	}
+	if prop.MaxLength != nil {
+		in.Rules = append(in.Rules, &ruleForMarshaling{
+			Rule:    fmt.Sprintf("size(%s) <= %d", name, *prop.MaxLength),
+			Message: fmt.Sprintf("must be at most %d characters", *prop.MaxLength),
+		})
+	}
+
+	c.spec.Inputs = append(c.spec.Inputs, in)
+}
+
+// addBackstageStep converts a single scaffolder step. Steps that have no abc
+// equivalent are skipped with a warning rather than failing the conversion.
+func (c *conversion) addBackstageStep(step *backstageStep) error {
+	switch step.Action {
+	case "fetch:template", "fetch:plain":
+	default:
+		c.warnf("step %q uses action %q, which has no abc equivalent and was skipped", step.ID, step.Action)
+		return nil
+	}
+
+	var in backstageFetchInput
+	if err := step.Input.Decode(&in); err != nil {
+		return fmt.Errorf("Decode(): %w", err)
+	}
+	if in.URL == "" {
+		return fmt.Errorf(`missing "url" in step input`)
+	}
+	if strings.Contains(in.URL, "://") {
+		c.warnf("step %q fetches the remote location %q, which can't be included in an abc template and was skipped", step.ID, in.URL)
+		return nil
+	}
+	src := path.Clean(in.URL)
+	if path.IsAbs(src) || strings.HasPrefix(src, "..") {
+		c.warnf("step %q fetches %q, which is outside the template directory, and was skipped", step.ID, in.URL)
+		return nil
+	}
+
+	dest := "."
+	if in.TargetPath != "" {
+		dest = path.Clean(in.TargetPath)
+	}
+	desc := firstNonEmpty(step.Name, step.ID, "Include "+src)
+	c.spec.Steps = append(c.spec.Steps, &stepForMarshaling{
+		Desc:   desc,
+		Action: "include",
+		Params: &includeParams{
+			Paths: []*includePath{{Paths: []string{src}, As: []string{dest}}},
+		},
+	})
+
+	if step.Action != "fetch:template" || in.Values.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var replacements []*regexReplacement
+	content := in.Values.Content
+	for i := 0; i+1 < len(content); i += 2 {
+		key, val := content[i].Value, content[i+1]
+		with, ok := c.backstageValue(step.ID, key, val)
+		if !ok {
+			continue
+		}
+		replacements = append(replacements, &regexReplacement{
+			Regex: fmt.Sprintf(`\$\{\{\s*values\.%s\s*\}\}`, regexp.QuoteMeta(key)),
+			With:  with,
+		})
+	}
+	if len(replacements) > 0 {
+		c.spec.Steps = append(c.spec.Steps, &stepForMarshaling{
+			Desc:   fmt.Sprintf("Fill in template values for %q", desc),
+			Action: "regex_replace",
+			Params: &regexReplaceParams{
+				Paths:        []string{dest},
+				Replacements: replacements,
+			},
+		})
+	}
+	c.warnf("step %q renders %q with Nunjucks; only plain ${{ values.x }} references were converted, "+
+		"so check those files for filters, conditionals, loops and templated file names", desc, src)
+	return nil
+}
+
+// backstageValue returns the abc template expression equivalent to the given
+// value of a fetch:template step, or false if it can't be converted.
+func (c *conversion) backstageValue(stepID, key string, val *yaml.Node) (string, bool) {
+	if val.Kind != yaml.ScalarNode {
+		c.warnf("step %q value %q isn't a plain string and was skipped", stepID, key)
+		return "", false
+	}
+	if m := backstageParamRef.FindStringSubmatch(val.Value); m != nil {
+		return fmt.Sprintf("{{.%s}}", m[1]), true
+	}
+	if backstageExpr.MatchString(val.Value) || strings.Contains(val.Value, "{{") {
+		c.warnf("step %q value %q uses the expression %q, which couldn't be converted and was skipped", stepID, key, val.Value)
+		return "", false
+	}
+	if val.Value == "" {
+		c.warnf("step %q value %q is empty and was skipped", stepID, key)
+		return "", false
+	}
+	return val.Value, true
+}
@@ -0,0 +1,261 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestConvertBackstage(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		templateYAML string
+		want         *specForMarshaling
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name: "parameter_pages_and_fetch_template",
+			templateYAML: `apiVersion: scaffolder.backstage.io/v1beta3
+kind: Template
+metadata:
+  name: go-service
+  title: Go service
+  description: Creates a Go service
+spec:
+  parameters:
+    - title: Service
+      required: [name]
+      properties:
+        name:
+          title: Name
+          type: string
+          description: The service name
+          pattern: '^[a-z][a-z0-9-]*$'
+          maxLength: 30
+    - title: Options
+      properties:
+        tier:
+          type: string
+          enum: [small, large]
+          default: small
+        owner:
+          type: string
+  steps:
+    - id: fetch
+      name: Fetch skeleton
+      action: fetch:template
+      input:
+        url: ./skeleton
+        values:
+          name: ${{ parameters.name }}
+          tier: ${{ parameters.tier }}
+          language: go
+    - id: publish
+      action: publish:github
+      input:
+        repoUrl: ${{ parameters.repoUrl }}
+`,
+			want: &specForMarshaling{
+				Desc: "Creates a Go service",
+				Inputs: []*inputForMarshaling{
+					{
+						Name: "name",
+						Desc: "The service name",
+						Rules: []*ruleForMarshaling{
+							{Rule: `name.matches("^[a-z][a-z0-9-]*$")`, Message: "must match the pattern ^[a-z][a-z0-9-]*$"},
+							{Rule: "size(name) <= 30", Message: "must be at most 30 characters"},
+						},
+					},
+					{
+						Name:    "tier",
+						Desc:    "tier",
+						Default: strPtr("small"),
+						Rules: []*ruleForMarshaling{
+							{Rule: `tier in ["small", "large"]`, Message: `must be one of "small", "large"`},
+						},
+					},
+					{
+						Name:    "owner",
+						Desc:    "owner",
+						Default: strPtr(""),
+					},
+				},
+				Steps: []*stepForMarshaling{
+					{
+						Desc:   "Fetch skeleton",
+						Action: "include",
+						Params: &includeParams{
+							Paths: []*includePath{{Paths: []string{"skeleton"}, As: []string{"."}}},
+						},
+					},
+					{
+						Desc:   `Fill in template values for "Fetch skeleton"`,
+						Action: "regex_replace",
+						Params: &regexReplaceParams{
+							Paths: []string{"."},
+							Replacements: []*regexReplacement{
+								{Regex: `\$\{\{\s*values\.name\s*\}\}`, With: "{{.name}}"},
+								{Regex: `\$\{\{\s*values\.tier\s*\}\}`, With: "{{.tier}}"},
+								{Regex: `\$\{\{\s*values\.language\s*\}\}`, With: "go"},
+							},
+						},
+					},
+				},
+			},
+			wantWarnings: []string{
+				`step "Fetch skeleton" renders "skeleton" with Nunjucks; only plain ${{ values.x }} references were converted, so check those files for filters, conditionals, loops and templated file names`,
+				`step "publish" uses action "publish:github", which has no abc equivalent and was skipped`,
+			},
+		},
+		{
+			name: "single_parameter_object_and_fetch_plain",
+			templateYAML: `apiVersion: scaffolder.backstage.io/v1beta3
+kind: Template
+metadata:
+  name: docs
+spec:
+  parameters:
+    properties:
+      count:
+        type: number
+        default: 3
+  steps:
+    - id: copy
+      action: fetch:plain
+      input:
+        url: ./docs
+        targetPath: out/docs
+`,
+			want: &specForMarshaling{
+				Desc: "docs",
+				Inputs: []*inputForMarshaling{
+					{Name: "count", Desc: "count", Default: strPtr("3")},
+				},
+				Steps: []*stepForMarshaling{
+					{
+						Desc:   "copy",
+						Action: "include",
+						Params: &includeParams{
+							Paths: []*includePath{{Paths: []string{"docs"}, As: []string{"out/docs"}}},
+						},
+					},
+				},
+			},
+			wantWarnings: []string{
+				`parameter "count" has type "number"; abc inputs are always strings`,
+			},
+		},
+		{
+			name: "unconvertible_values_are_skipped",
+			templateYAML: `apiVersion: scaffolder.backstage.io/v1beta3
+kind: Template
+metadata:
+  name: x
+spec:
+  steps:
+    - id: fetch
+      action: fetch:template
+      input:
+        url: ./skeleton
+        values:
+          upper: ${{ parameters.name | upper }}
+          list: [a, b]
+    - id: remote
+      action: fetch:template
+      input:
+        url: https://github.com/example/repo
+`,
+			want: &specForMarshaling{
+				Desc: "x",
+				Steps: []*stepForMarshaling{
+					{
+						Desc:   "fetch",
+						Action: "include",
+						Params: &includeParams{
+							Paths: []*includePath{{Paths: []string{"skeleton"}, As: []string{"."}}},
+						},
+					},
+				},
+			},
+			wantWarnings: []string{
+				`step "fetch" value "upper" uses the expression "${{ parameters.name | upper }}", which couldn't be converted and was skipped`,
+				`step "fetch" value "list" isn't a plain string and was skipped`,
+				`step "fetch" renders "skeleton" with Nunjucks; only plain ${{ values.x }} references were converted, so check those files for filters, conditionals, loops and templated file names`,
+				`step "remote" fetches the remote location "https://github.com/example/repo", which can't be included in an abc template and was skipped`,
+			},
+		},
+		{
+			name: "wrong_kind",
+			templateYAML: `apiVersion: backstage.io/v1alpha1
+kind: Component
+`,
+			wantErr: "is not a Backstage template",
+		},
+		{
+			name: "no_convertible_steps",
+			templateYAML: `apiVersion: scaffolder.backstage.io/v1beta3
+kind: Template
+metadata:
+  name: x
+spec:
+  steps:
+    - id: log
+      action: debug:log
+`,
+			wantErr: "has no steps that could be converted",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, dir, map[string]string{
+				"template.yaml": tc.templateYAML,
+			})
+
+			got, err := convertBackstage(context.Background(), &common.RealFS{}, dir)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(got.spec, tc.want); diff != "" {
+				t.Errorf("spec was not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(got.warnings, tc.wantWarnings); diff != "" {
+				t.Errorf("warnings were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+const (
+	formatCookiecutter = "cookiecutter"
+
+	// cookiecutterFile is the name of the file declaring the variables of a
+	// cookiecutter template.
+	cookiecutterFile = "cookiecutter.json"
+
+	// cookiecutterPrompts is the special key in cookiecutter.json that maps
+	// variable names to human-readable prompts.
+	cookiecutterPrompts = "__prompts__"
+
+	// maxJinjaExamples is how many unconvertible Jinja constructs are quoted
+	// in the warning for a single file.
+	maxJinjaExamples = 3
+)
+
+var (
+	// cookiecutterRef matches a plain reference to a cookiecutter variable,
+	// like "{{ cookiecutter.project_name }}".
+	cookiecutterRef = regexp.MustCompile(`\{\{\s*cookiecutter\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+	// jinjaConstruct matches any Jinja expression, statement or comment.
+	jinjaConstruct = regexp.MustCompile(`(?s)\{\{.*?\}\}|\{%.*?%\}|\{#.*?#\}`)
+)
+
+// convertCookiecutter converts the cookiecutter template in dir.
+//
+// A cookiecutter template is a cookiecutter.json file declaring variables,
+// next to a single directory whose name is templated (like
+// "{{cookiecutter.project_slug}}") and which contains Jinja-templated files.
+// Plain variable references in file contents and file names are converted;
+// anything else, like filters, conditionals and loops, is reported as a
+// warning.
+func convertCookiecutter(ctx context.Context, rfs common.FS, dir string) (*conversion, error) {
+	filename := filepath.Join(dir, cookiecutterFile)
+	buf, err := rfs.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile(%s): %w", filename, err)
+	}
+
+	// JSON is a subset of YAML, and decoding into a node keeps the variables
+	// in the order they were declared.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filename, err)
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s must contain a JSON object", filename)
+	}
+
+	conv := &conversion{spec: &specForMarshaling{}}
+	vars := conv.addCookiecutterInputs(doc.Content[0])
+
+	root, err := findCookiecutterRoot(rfs, dir)
+	if err != nil {
+		return nil, err
+	}
+	conv.spec.Desc = fmt.Sprintf("Imported from the cookiecutter template %s", filepath.Base(filepath.Clean(dir)))
+
+	if _, err := rfs.Stat(filepath.Join(dir, "hooks")); err == nil {
+		conv.warnf("the hooks directory was skipped; cookiecutter hooks have no abc equivalent")
+	}
+
+	if err := conv.addCookiecutterSteps(rfs, dir, root, vars); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// addCookiecutterInputs adds an input for each variable in cookiecutter.json
+// and returns the names of the variables that became inputs.
+func (c *conversion) addCookiecutterInputs(obj *yaml.Node) map[string]struct{} {
+	prompts := map[string]string{}
+	for i := 0; i+1 < len(obj.Content); i += 2 {
+		if obj.Content[i].Value == cookiecutterPrompts {
+			// Prompts for choice variables may be objects; only the plain
+			// string ones are used.
+			var raw map[string]any
+			if err := obj.Content[i+1].Decode(&raw); err == nil {
+				for k, v := range raw {
+					if s, ok := v.(string); ok {
+						prompts[k] = s
+					}
+				}
+			}
+		}
+	}
+
+	vars := map[string]struct{}{}
+	for i := 0; i+1 < len(obj.Content); i += 2 {
+		name, val := obj.Content[i].Value, obj.Content[i+1]
+		if strings.HasPrefix(name, "_") {
+			if name != cookiecutterPrompts {
+				c.warnf("the private variable %q was skipped", name)
+			}
+			continue
+		}
+
+		in := &inputForMarshaling{
+			Name: name,
+			Desc: firstNonEmpty(prompts[name], strings.ReplaceAll(name, "_", " ")),
+		}
+		switch val.Kind {
+		case yaml.ScalarNode:
+			if jinjaConstruct.MatchString(val.Value) {
+				// abc defaults can't refer to other inputs, so the user has
+				// to provide the value.
+				c.warnf("variable %q has the computed default %q, which couldn't be converted; the input is now required",
+					name, val.Value)
+				break
+			}
+			d := val.Value
+			in.Default = &d
+			if val.Tag == "!!bool" {
+				in.Rules = append(in.Rules, &ruleForMarshaling{
+					Rule:    fmt.Sprintf(`%s in ["true", "false"]`, name),
+					Message: `must be "true" or "false"`,
+				})
+			}
+		case yaml.SequenceNode:
+			// A list is a choice variable, whose default is the first choice.
+			if len(val.Content) == 0 {
+				c.warnf("choice variable %q has no choices and was skipped", name)
+				continue
+			}
+			vals := make([]string, 0, len(val.Content))
+			for _, v := range val.Content {
+				vals = append(vals, strconv.Quote(v.Value))
+			}
+			d := val.Content[0].Value
+			in.Default = &d
+			in.Rules = append(in.Rules, &ruleForMarshaling{
+				Rule:    fmt.Sprintf("%s in [%s]", name, strings.Join(vals, ", ")),
+				Message: fmt.Sprintf("must be one of %s", strings.Join(vals, ", ")),
+			})
+		default:
+			c.warnf("dictionary variable %q was skipped; abc inputs are always strings", name)
+			continue
+		}
+
+		c.spec.Inputs = append(c.spec.Inputs, in)
+		vars[name] = struct{}{}
+	}
+	return vars
+}
+
+// findCookiecutterRoot returns the name of the templated directory inside dir
+// that holds the files of a cookiecutter template.
+func findCookiecutterRoot(rfs common.FS, dir string) (string, error) {
+	entries, err := fs.ReadDir(rfs, dir)
+	if err != nil {
+		return "", fmt.Errorf("ReadDir(%s): %w", dir, err)
+	}
+	var roots []string
+	for _, e := range entries {
+		if e.IsDir() && strings.Contains(e.Name(), "{{") {
+			roots = append(roots, e.Name())
+		}
+	}
+	if len(roots) != 1 {
+		return "", fmt.Errorf(`%s must contain exactly one directory with a templated name like "{{cookiecutter.project_slug}}", found %d`,
+			dir, len(roots))
+	}
+	return roots[0], nil
+}
+
+// addCookiecutterSteps adds the steps that copy the template files and fill
+// in the variables they reference.
+func (c *conversion) addCookiecutterSteps(rfs common.FS, dir, root string, vars map[string]struct{}) error {
+	rootAs, ok := c.convertJinja(vars, root)
+	if !ok {
+		return fmt.Errorf("the name of the template directory %q couldn't be converted", root)
+	}
+
+	// Files and directories with templated names below the root need their
+	// own include path, since "as" only renames the path being included. Each
+	// include path skips the templated paths below it, which are included
+	// separately. Like the include paths, skip paths are relative to the
+	// template directory.
+	var templated, renamed []string
+	refs := map[string]struct{}{}
+	rootPath := filepath.Join(dir, root)
+	err := fs.WalkDir(rfs, rootPath, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", dir, path, err)
+		}
+
+		if path != rootPath && strings.Contains(de.Name(), "{{") {
+			templated = append(templated, rel)
+			if _, ok := c.convertJinjaPath(vars, rel); !ok {
+				c.warnf("%q has a file name that couldn't be converted and was skipped", rel)
+				if de.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			renamed = append(renamed, rel)
+		}
+
+		if de.IsDir() {
+			return nil
+		}
+		buf, err := rfs.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("ReadFile(%s): %w", path, err)
+		}
+		c.scanJinja(vars, rel, string(buf), refs)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed walking %s: %w", rootPath, err)
+	}
+
+	paths := make([]*includePath, 0, len(renamed)+1)
+	for _, rel := range append([]string{root}, renamed...) {
+		// Already known to succeed for every path.
+		as, _ := c.convertJinjaPath(vars, rel)
+		inc := &includePath{
+			Paths: []string{escapeGoTemplate(rel)},
+			As:    []string{as},
+		}
+		for _, t := range templated {
+			if strings.HasPrefix(t, rel+string(filepath.Separator)) {
+				inc.Skip = append(inc.Skip, escapeGoTemplate(t))
+			}
+		}
+		paths = append(paths, inc)
+	}
+	c.spec.Steps = append(c.spec.Steps, &stepForMarshaling{
+		Desc:   "Include the template files",
+		Action: "include",
+		Params: &includeParams{Paths: paths},
+	})
+
+	// Replacements are in the same order as the inputs, so the output is
+	// deterministic.
+	var replacements []*regexReplacement
+	for _, in := range c.spec.Inputs {
+		if _, ok := refs[in.Name]; !ok {
+			continue
+		}
+		replacements = append(replacements, &regexReplacement{
+			Regex: fmt.Sprintf(`\{\{\s*cookiecutter\.%s\s*\}\}`, regexp.QuoteMeta(in.Name)),
+			With:  fmt.Sprintf("{{.%s}}", in.Name),
+		})
+	}
+	if len(replacements) > 0 {
+		c.spec.Steps = append(c.spec.Steps, &stepForMarshaling{
+			Desc:   "Replace cookiecutter variables",
+			Action: "regex_replace",
+			Params: &regexReplaceParams{
+				Paths:        []string{rootAs},
+				Replacements: replacements,
+			},
+		})
+	}
+	return nil
+}
+
+// scanJinja records the variables referenced in the contents of the file at
+// rel, and warns about any Jinja construct that isn't a plain reference to a
+// known variable.
+func (c *conversion) scanJinja(vars map[string]struct{}, rel, contents string, refs map[string]struct{}) {
+	var unconverted []string
+	for _, m := range jinjaConstruct.FindAllString(contents, -1) {
+		if sub := cookiecutterRef.FindStringSubmatch(m); sub != nil && sub[0] == m {
+			if _, ok := vars[sub[1]]; ok {
+				refs[sub[1]] = struct{}{}
+				continue
+			}
+		}
+		unconverted = append(unconverted, m)
+	}
+	if len(unconverted) == 0 {
+		return
+	}
+	examples := unconverted
+	if len(examples) > maxJinjaExamples {
+		examples = examples[:maxJinjaExamples]
+	}
+	quoted := make([]string, 0, len(examples))
+	for _, e := range examples {
+		quoted = append(quoted, strconv.Quote(e))
+	}
+	c.warnf("%q contains %d Jinja construct(s) that couldn't be converted, like %s",
+		rel, len(unconverted), strings.Join(quoted, ", "))
+}
+
+// convertJinjaPath converts each templated element of the given path, which
+// is relative to the template directory.
+func (c *conversion) convertJinjaPath(vars map[string]struct{}, rel string) (string, bool) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, p := range parts {
+		converted, ok := c.convertJinja(vars, p)
+		if !ok {
+			return "", false
+		}
+		parts[i] = converted
+	}
+	return filepath.Join(parts...), true
+}
+
+// convertJinja converts a string whose only Jinja constructs are plain
+// references to known variables into the equivalent go template.
+func (c *conversion) convertJinja(vars map[string]struct{}, s string) (string, bool) {
+	ok := true
+	converted := jinjaConstruct.ReplaceAllStringFunc(s, func(m string) string {
+		sub := cookiecutterRef.FindStringSubmatch(m)
+		if sub == nil || sub[0] != m {
+			ok = false
+			return m
+		}
+		if _, known := vars[sub[1]]; !known {
+			ok = false
+			return m
+		}
+		return fmt.Sprintf("{{.%s}}", sub[1])
+	})
+	return converted, ok
+}
+
+// escapeGoTemplate returns a go template that renders to s. Paths in a spec
+// are go templates, so literal "{{" in a file name must be escaped.
+func escapeGoTemplate(s string) string {
+	return strings.ReplaceAll(s, "{{", `{{"{{"}}`)
+}
@@ -0,0 +1,234 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/pkg/abcrender"
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestConvertCookiecutter(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		files        map[string]string
+		want         *specForMarshaling
+		wantWarnings []string
+		wantErr      string
+	}{
+		{
+			name: "variables_and_templated_names",
+			files: map[string]string{
+				"cookiecutter.json": `{
+  "project_slug": "my_project",
+  "license": ["MIT", "Apache-2.0"],
+  "use_docker": false,
+  "module_name": "{{ cookiecutter.project_slug.replace('-', '_') }}",
+  "extra": {"a": "b"},
+  "_copy_without_render": ["*.png"],
+  "__prompts__": {"project_slug": "Name of the project directory"}
+}`,
+				"{{cookiecutter.project_slug}}/README.md":                         "# {{ cookiecutter.project_slug }}\n{% if cookiecutter.use_docker %}docker{% endif %}\n",
+				"{{cookiecutter.project_slug}}/{{cookiecutter.license}}.txt":      "license",
+				"{{cookiecutter.project_slug}}/{{cookiecutter.module_name}}/x.py": "x",
+			},
+			want: &specForMarshaling{
+				Desc: "Imported from the cookiecutter template",
+				Inputs: []*inputForMarshaling{
+					{Name: "project_slug", Desc: "Name of the project directory", Default: strPtr("my_project")},
+					{
+						Name:    "license",
+						Desc:    "license",
+						Default: strPtr("MIT"),
+						Rules: []*ruleForMarshaling{
+							{Rule: `license in ["MIT", "Apache-2.0"]`, Message: `must be one of "MIT", "Apache-2.0"`},
+						},
+					},
+					{
+						Name:    "use_docker",
+						Desc:    "use docker",
+						Default: strPtr("false"),
+						Rules: []*ruleForMarshaling{
+							{Rule: `use_docker in ["true", "false"]`, Message: `must be "true" or "false"`},
+						},
+					},
+					{Name: "module_name", Desc: "module name"},
+				},
+				Steps: []*stepForMarshaling{
+					{
+						Desc:   "Include the template files",
+						Action: "include",
+						Params: &includeParams{
+							Paths: []*includePath{
+								{
+									Paths: []string{`{{"{{"}}cookiecutter.project_slug}}`},
+									As:    []string{"{{.project_slug}}"},
+									Skip: []string{
+										`{{"{{"}}cookiecutter.project_slug}}/{{"{{"}}cookiecutter.license}}.txt`,
+										`{{"{{"}}cookiecutter.project_slug}}/{{"{{"}}cookiecutter.module_name}}`,
+									},
+								},
+								{
+									Paths: []string{`{{"{{"}}cookiecutter.project_slug}}/{{"{{"}}cookiecutter.license}}.txt`},
+									As:    []string{"{{.project_slug}}/{{.license}}.txt"},
+								},
+								{
+									Paths: []string{`{{"{{"}}cookiecutter.project_slug}}/{{"{{"}}cookiecutter.module_name}}`},
+									As:    []string{"{{.project_slug}}/{{.module_name}}"},
+								},
+							},
+						},
+					},
+					{
+						Desc:   "Replace cookiecutter variables",
+						Action: "regex_replace",
+						Params: &regexReplaceParams{
+							Paths: []string{"{{.project_slug}}"},
+							Replacements: []*regexReplacement{
+								{Regex: `\{\{\s*cookiecutter\.project_slug\s*\}\}`, With: "{{.project_slug}}"},
+							},
+						},
+					},
+				},
+			},
+			wantWarnings: []string{
+				`variable "module_name" has the computed default "{{ cookiecutter.project_slug.replace('-', '_') }}", which couldn't be converted; the input is now required`,
+				`dictionary variable "extra" was skipped; abc inputs are always strings`,
+				`the private variable "_copy_without_render" was skipped`,
+				`"{{cookiecutter.project_slug}}/README.md" contains 2 Jinja construct(s) that couldn't be converted, like "{% if cookiecutter.use_docker %}", "{% endif %}"`,
+			},
+		},
+		{
+			name: "unconvertible_file_name",
+			files: map[string]string{
+				"cookiecutter.json": `{"name": "x"}`,
+				"{{cookiecutter.name}}/{{cookiecutter.name|upper}}.md": "",
+				"hooks/post_gen_project.py":                            "",
+			},
+			want: &specForMarshaling{
+				Desc:   "Imported from the cookiecutter template",
+				Inputs: []*inputForMarshaling{{Name: "name", Desc: "name", Default: strPtr("x")}},
+				Steps: []*stepForMarshaling{
+					{
+						Desc:   "Include the template files",
+						Action: "include",
+						Params: &includeParams{
+							Paths: []*includePath{{
+								Paths: []string{`{{"{{"}}cookiecutter.name}}`},
+								As:    []string{"{{.name}}"},
+								Skip:  []string{`{{"{{"}}cookiecutter.name}}/{{"{{"}}cookiecutter.name|upper}}.md`},
+							}},
+						},
+					},
+				},
+			},
+			wantWarnings: []string{
+				"the hooks directory was skipped; cookiecutter hooks have no abc equivalent",
+				`"{{cookiecutter.name}}/{{cookiecutter.name|upper}}.md" has a file name that couldn't be converted and was skipped`,
+			},
+		},
+		{
+			name: "no_template_directory",
+			files: map[string]string{
+				"cookiecutter.json": `{"name": "x"}`,
+			},
+			wantErr: "must contain exactly one directory with a templated name",
+		},
+		{
+			name: "not_an_object",
+			files: map[string]string{
+				"cookiecutter.json": `["x"]`,
+			},
+			wantErr: "must contain a JSON object",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, dir, tc.files)
+
+			got, err := convertCookiecutter(context.Background(), &common.RealFS{}, dir)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			// The description contains the name of the temp dir.
+			got.spec.Desc = tc.want.Desc
+			if diff := cmp.Diff(got.spec, tc.want); diff != "" {
+				t.Errorf("spec was not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(got.warnings, tc.wantWarnings); diff != "" {
+				t.Errorf("warnings were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+// TestCommand_RenderImportedCookiecutter checks that the spec generated from a
+// cookiecutter template renders the same output as cookiecutter would.
+func TestCommand_RenderImportedCookiecutter(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	dir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, dir, map[string]string{
+		"cookiecutter.json":                                             `{"project_slug": "demo", "module": "app"}`,
+		"{{cookiecutter.project_slug}}/README.md":                       "# {{ cookiecutter.project_slug }}\n",
+		"{{cookiecutter.project_slug}}/{{cookiecutter.module}}.txt":     "{{cookiecutter.module}}\n",
+		"{{cookiecutter.project_slug}}/{{cookiecutter.module}}/main.py": "print('{{cookiecutter.module}}')\n",
+	})
+
+	cmd := &Command{}
+	cmd.Pipe()
+	if err := cmd.Run(ctx, []string{"cookiecutter", dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := abcrender.Render(ctx, &abcrender.Options{
+		Source: dir,
+		Inputs: map[string]string{"project_slug": "greeter", "module": "hello"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string, len(res.Files))
+	for k, v := range res.Files {
+		got[k] = string(v)
+	}
+	want := map[string]string{
+		"greeter/README.md":     "# greeter\n",
+		"greeter/hello/main.py": "print('hello')\n",
+		"greeter/hello.txt":     "hello\n",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("rendered files were not as expected (-got,+want): %s", diff)
+	}
+}
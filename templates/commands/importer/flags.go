@@ -0,0 +1,86 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abcxyz/pkg/cli"
+)
+
+// ImportFlags describes which foreign template to convert and how.
+type ImportFlags struct {
+	// Positional arguments:
+
+	// Location is the local directory containing the template to convert. The
+	// generated spec.yaml is written into this same directory.
+	Location string
+
+	// Flag arguments (--foo):
+
+	// Format is the kind of template being imported, one of the values
+	// returned by formats(). When empty, it's detected from the files present
+	// in Location.
+	Format string
+
+	// ForceOverwrite lets an existing spec.yaml be replaced.
+	ForceOverwrite bool
+}
+
+func (r *ImportFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("IMPORT OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "format",
+		Example: "backstage",
+		Target:  &r.Format,
+		Usage: fmt.Sprintf("The kind of template being imported, one of %v. "+
+			"If omitted, it's detected from the files in the template directory.", formats()),
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "force-overwrite",
+		Target:  &r.ForceOverwrite,
+		Default: false,
+		Usage:   "If a spec.yaml file already exists, overwrite it instead of failing.",
+	})
+
+	set.AfterParse(func(existingErr error) error {
+		switch len(set.Args()) {
+		case 0:
+			return fmt.Errorf("missing <location> argument")
+		case 1:
+			r.Location = strings.TrimSpace(set.Arg(0))
+		case 2:
+			format := strings.TrimSpace(set.Arg(0))
+			if r.Format != "" && r.Format != format {
+				return fmt.Errorf("the format was given as both --format=%s and %q", r.Format, format)
+			}
+			r.Format = format
+			r.Location = strings.TrimSpace(set.Arg(1))
+		default:
+			return fmt.Errorf("expected at most two arguments, [<format>] <location>, got %d", len(set.Args()))
+		}
+		if r.Location == "" {
+			return fmt.Errorf("missing <location> argument")
+		}
+		if r.Format != "" && !slices.Contains(formats(), r.Format) {
+			return fmt.Errorf("the format must be one of %v, got %q", formats(), r.Format)
+		}
+		return nil
+	})
+}
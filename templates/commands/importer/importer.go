@@ -0,0 +1,275 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package importer implements the "templates import" subcommand, which
+// converts templates written for other scaffolding tools into abc templates.
+package importer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// converter knows how to turn one kind of foreign template into a spec.
+type converter struct {
+	// markerFile is the name of the file, relative to the template directory,
+	// whose presence identifies a template of this format.
+	markerFile string
+
+	// convert reads the template in dir and returns the equivalent spec.
+	convert func(ctx context.Context, rfs common.FS, dir string) (*conversion, error)
+}
+
+// converters maps each value of the --format flag to its converter.
+var converters = map[string]*converter{
+	formatBackstage:    {markerFile: backstageFile, convert: convertBackstage},
+	formatCookiecutter: {markerFile: cookiecutterFile, convert: convertCookiecutter},
+}
+
+// formats returns the sorted list of supported values of --format.
+func formats() []string {
+	out := make([]string, 0, len(converters))
+	for f := range converters {
+		out = append(out, f)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// conversion is the output of a converter.
+type conversion struct {
+	spec *specForMarshaling
+
+	// warnings describes the parts of the foreign template that couldn't be
+	// converted automatically and need a human to look at them.
+	warnings []string
+}
+
+func (c *conversion) warnf(format string, args ...any) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// specForMarshaling is the subset of a spec.yaml that converters can produce.
+// We don't marshal the real spec model because its steps can't be marshaled
+// (the action-specific fields are hidden from the YAML library).
+type specForMarshaling struct {
+	APIVersion string                `yaml:"api_version"`
+	Kind       string                `yaml:"kind"`
+	Desc       string                `yaml:"desc"`
+	Inputs     []*inputForMarshaling `yaml:"inputs,omitempty"`
+	Steps      []*stepForMarshaling  `yaml:"steps"`
+}
+
+type inputForMarshaling struct {
+	Name    string               `yaml:"name"`
+	Desc    string               `yaml:"desc"`
+	Default *string              `yaml:"default,omitempty"`
+	Rules   []*ruleForMarshaling `yaml:"rules,omitempty"`
+}
+
+type ruleForMarshaling struct {
+	Rule    string `yaml:"rule"`
+	Message string `yaml:"message,omitempty"`
+}
+
+type stepForMarshaling struct {
+	Desc   string `yaml:"desc"`
+	Action string `yaml:"action"`
+	Params any    `yaml:"params"`
+}
+
+type includeParams struct {
+	Paths []*includePath `yaml:"paths"`
+}
+
+type includePath struct {
+	Paths []string `yaml:"paths"`
+	As    []string `yaml:"as,omitempty"`
+	Skip  []string `yaml:"skip,omitempty"`
+}
+
+type regexReplaceParams struct {
+	Paths        []string            `yaml:"paths"`
+	Replacements []*regexReplacement `yaml:"replacements"`
+}
+
+type regexReplacement struct {
+	Regex string `yaml:"regex"`
+	With  string `yaml:"with"`
+}
+
+type Command struct {
+	cli.BaseCommand
+	flags ImportFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "convert a template from another scaffolding tool into an abc template"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] [<format>] <location>
+
+The {{ COMMAND }} command reads a template written for another scaffolding
+tool from the local directory <location> and writes an equivalent abc
+spec.yaml into that same directory. The original template files are left in
+place, since the generated spec refers to them.
+
+Supported formats:
+
+- backstage: a Backstage scaffolder template.yaml. Parameters become inputs,
+    and fetch:template/fetch:plain steps become include and regex_replace
+    steps.
+- cookiecutter: a cookiecutter.json file next to a templated directory like
+    "{{cookiecutter.project_slug}}". Variables become inputs, and plain
+    {{cookiecutter.x}} references in file contents and names are converted.
+
+Not everything can be converted automatically. Anything that was skipped is
+printed as a warning, and the generated spec should be reviewed before use.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) Run(ctx context.Context, args []string) (rErr error) {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	rfs := c.testFS
+	if rfs == nil {
+		rfs = &common.RealFS{}
+	}
+
+	format := c.flags.Format
+	if format == "" {
+		var err error
+		if format, err = detectFormat(rfs, c.flags.Location); err != nil {
+			return err
+		}
+	}
+
+	conv, err := converters[format].convert(ctx, rfs, c.flags.Location)
+	if err != nil {
+		return err
+	}
+
+	buf, err := marshalSpec(ctx, conv.spec)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range conv.warnings {
+		fmt.Fprintf(c.Stderr(), "warning: %s\n", w)
+	}
+
+	specPath := filepath.Join(c.flags.Location, specutil.SpecFileName)
+	fileFlag := os.O_CREATE | os.O_EXCL | os.O_WRONLY
+	if c.flags.ForceOverwrite {
+		fileFlag = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	}
+	fh, err := rfs.OpenFile(specPath, fileFlag, common.OwnerRWPerms)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%q already exists, use --force-overwrite to replace it: %w", specPath, err)
+		}
+		return fmt.Errorf("can't open file(%q): %w", specPath, err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, fh.Close())
+	}()
+	if _, err := fh.Write(buf); err != nil {
+		return fmt.Errorf("write(%q): %w", specPath, err)
+	}
+
+	fmt.Fprintf(c.Stdout(), "wrote %s from %s template with %d warning(s)\n", specPath, format, len(conv.warnings))
+	return nil
+}
+
+// detectFormat returns the format of the template in dir based on which
+// marker files exist.
+func detectFormat(rfs common.FS, dir string) (string, error) {
+	var found []string
+	for _, f := range formats() {
+		_, err := rfs.Stat(filepath.Join(dir, converters[f].markerFile))
+		if err == nil {
+			found = append(found, f)
+			continue
+		}
+		if !common.IsStatNotExistErr(err) {
+			return "", fmt.Errorf("Stat(): %w", err)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("couldn't detect the template format of %q, use --format to choose one of %v", dir, formats())
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("the template format of %q is ambiguous, use --format to choose one of %v", dir, found)
+	}
+}
+
+// marshalSpec serializes the given spec and checks that the result is a valid
+// spec.yaml, so a converter bug is reported here rather than at render time.
+func marshalSpec(ctx context.Context, s *specForMarshaling) ([]byte, error) {
+	s.APIVersion = decode.LatestSupportedAPIVersion(version.IsReleaseBuild())
+	s.Kind = decode.KindTemplate
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(s); err != nil {
+		return nil, fmt.Errorf("failed marshaling spec: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed marshaling spec: %w", err)
+	}
+
+	if _, err := decode.DecodeValidateUpgrade(ctx, bytes.NewReader(buf.Bytes()), specutil.SpecFileName, decode.KindTemplate); err != nil {
+		return nil, fmt.Errorf("internal error: the generated spec is invalid: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,263 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/pkg/abcrender"
+	"github.com/abcxyz/abc/templates/model/decode"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const backstageTemplateYAML = `apiVersion: scaffolder.backstage.io/v1beta3
+kind: Template
+metadata:
+  name: hello
+  description: Says hello
+spec:
+  parameters:
+    - required: [name]
+      properties:
+        name:
+          type: string
+          description: Who to greet
+  steps:
+    - id: fetch
+      action: fetch:template
+      input:
+        url: ./skeleton
+        values:
+          name: ${{ parameters.name }}
+`
+
+func TestImportFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    ImportFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{"--format", "backstage", "--force-overwrite", "my/dir"},
+			want: ImportFlags{
+				Location:       "my/dir",
+				Format:         "backstage",
+				ForceOverwrite: true,
+			},
+		},
+		{
+			name: "defaults",
+			args: []string{"my/dir"},
+			want: ImportFlags{Location: "my/dir"},
+		},
+		{
+			name: "positional_format",
+			args: []string{"cookiecutter", "my/dir"},
+			want: ImportFlags{
+				Location: "my/dir",
+				Format:   "cookiecutter",
+			},
+		},
+		{
+			name:    "conflicting_formats",
+			args:    []string{"--format=backstage", "cookiecutter", "my/dir"},
+			wantErr: `the format was given as both --format=backstage and "cookiecutter"`,
+		},
+		{
+			name:    "missing_location",
+			args:    []string{},
+			wantErr: "missing <location> argument",
+		},
+		{
+			name:    "unknown_format",
+			args:    []string{"--format", "nope", "my/dir"},
+			wantErr: "the format must be one of",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd Command
+			cmd.SetLookupEnv(func(string) (string, bool) { return "", false })
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		files         map[string]string
+		flagArgs      []string
+		wantSpec      string
+		wantStderr    string
+		wantErr       string
+		wantUnchanged bool
+	}{
+		{
+			name: "backstage_detected",
+			files: map[string]string{
+				"template.yaml": backstageTemplateYAML,
+			},
+			wantSpec: `kind: Template
+desc: Says hello
+inputs:
+  - name: name
+    desc: Who to greet
+steps:
+  - desc: fetch
+    action: include
+    params:
+      paths:
+        - paths:
+            - skeleton
+          as:
+            - .
+  - desc: Fill in template values for "fetch"
+    action: regex_replace
+    params:
+      paths:
+        - .
+      replacements:
+        - regex: \$\{\{\s*values\.name\s*\}\}
+          with: '{{.name}}'
+`,
+			wantStderr: `warning: step "fetch" renders "skeleton" with Nunjucks`,
+		},
+		{
+			name:    "undetectable_format",
+			files:   map[string]string{"README.md": "hi"},
+			wantErr: "couldn't detect the template format",
+		},
+		{
+			name: "existing_spec_not_overwritten",
+			files: map[string]string{
+				"template.yaml": backstageTemplateYAML,
+				"spec.yaml":     "original",
+			},
+			wantErr:       "use --force-overwrite to replace it",
+			wantUnchanged: true,
+		},
+		{
+			name: "existing_spec_overwritten",
+			files: map[string]string{
+				"template.yaml": backstageTemplateYAML,
+				"spec.yaml":     "original",
+			},
+			flagArgs:   []string{"--force-overwrite", "--format=backstage"},
+			wantStderr: "warning:",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			dir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, dir, tc.files)
+
+			cmd := &Command{}
+			_, _, stderr := cmd.Pipe()
+			err := cmd.Run(ctx, append(tc.flagArgs, dir))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if !strings.Contains(stderr.String(), tc.wantStderr) {
+				t.Errorf("stderr %q doesn't contain %q", stderr.String(), tc.wantStderr)
+			}
+
+			got := abctestutil.LoadDirWithoutMode(t, dir)["spec.yaml"]
+			switch {
+			case tc.wantUnchanged:
+				if got != tc.files["spec.yaml"] {
+					t.Errorf("spec.yaml was modified to %q", got)
+				}
+			case tc.wantSpec != "":
+				want := "api_version: " + decode.LatestSupportedAPIVersion(version.IsReleaseBuild()) + "\n" + tc.wantSpec
+				if diff := cmp.Diff(got, want); diff != "" {
+					t.Errorf("spec.yaml was not as expected (-got,+want): %s", diff)
+				}
+			}
+		})
+	}
+}
+
+// TestCommand_RenderImported checks that the spec generated from a Backstage
+// template actually renders the skeleton.
+func TestCommand_RenderImported(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	dir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, dir, map[string]string{
+		"template.yaml":        backstageTemplateYAML,
+		"skeleton/README.md":   "# ${{ values.name }}\n",
+		"skeleton/src/main.go": "// ${{values.name}} service\n",
+	})
+
+	cmd := &Command{}
+	cmd.Pipe()
+	if err := cmd.Run(ctx, []string{dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := abcrender.Render(ctx, &abcrender.Options{
+		Source: dir,
+		Inputs: map[string]string{"name": "greeter"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string, len(res.Files))
+	for k, v := range res.Files {
+		got[k] = string(v)
+	}
+	want := map[string]string{
+		"README.md":   "# greeter\n",
+		"src/main.go": "// greeter service\n",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("rendered files were not as expected (-got,+want): %s", diff)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inputs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/diagnostic"
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// ValidateFlags describes what template and inputs to validate.
+type ValidateFlags struct {
+	// Source is the location of the template whose input rules are checked.
+	//
+	// Example: github.com/abcxyz/abc/t/rest_server@latest
+	Source string
+
+	// See common/flags.Inputs().
+	Inputs map[string]string
+
+	// See common/flags.InputFiles().
+	InputFiles []string
+
+	// GitProtocol either https or ssh.
+	GitProtocol string
+
+	// See common/flags.DiagnosticFormat().
+	Format string
+}
+
+func (r *ValidateFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("INPUT OPTIONS")
+	f.StringMapVar(flags.Inputs(&r.Inputs))
+	f.StringSliceVar(flags.InputFiles(&r.InputFiles))
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	o := set.NewSection("OUTPUT OPTIONS")
+	o.StringVar(flags.DiagnosticFormat(&r.Format))
+
+	// Default source to the first CLI argument, if given
+	set.AfterParse(func(existingErr error) error {
+		r.Source = strings.TrimSpace(set.Arg(0))
+		if r.Source == "" {
+			return fmt.Errorf("missing <source> file")
+		}
+		if err := diagnostic.ValidateFormat(r.Format); err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inputs implements the template input related subcommands.
+package inputs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/diagnostic"
+	"github.com/abcxyz/abc/templates/common/extends"
+	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type ValidateCommand struct {
+	cli.BaseCommand
+	flags ValidateFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *ValidateCommand) Desc() string {
+	return "check template inputs against the template's validation rules without rendering"
+}
+
+func (c *ValidateCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <source>
+
+The {{ COMMAND }} command loads the given template's spec and the inputs given
+with --input and --input-file, and runs the template's input validation rules
+without rendering anything. Every rule violation is printed, with its position
+in the spec file. Inputs that aren't given take their default values, as they
+would in "abc templates render".
+
+The "<source>" is the location of the template, in any form accepted by
+"abc templates render", like:
+
+- github.com/abcxyz/abc/t/rest_server@latest
+- /home/me/mydir
+
+With --format=json, the violations, and any problems loading the template, are
+printed as a JSON report with the file, line, column, severity, and code of each
+one, for editors and other tools.
+`
+}
+
+func (c *ValidateCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type runParams struct {
+	fs     common.FS
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func (c *ValidateCommand) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	return c.realRun(ctx, &runParams{
+		fs:     fSys,
+		stdin:  c.Stdin(),
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *ValidateCommand) realRun(ctx context.Context, rp *runParams) error {
+	violations, err := c.validate(ctx, rp)
+	if c.flags.Format == diagnostic.FormatJSON {
+		report := diagnostic.NewReport("inputs validate", c.flags.Source)
+		if err != nil {
+			report.AddError(specutil.SpecFileName, err)
+		}
+		for _, v := range violations {
+			report.AddError(specutil.SpecFileName, v)
+		}
+		if err := report.Write(rp.stdout); err != nil {
+			return err //nolint:wrapcheck
+		}
+		if n := report.ErrorCount(); n > 0 {
+			return fmt.Errorf("found %d problem(s) with the inputs", n)
+		}
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		fmt.Fprintf(rp.stdout, "all inputs are valid\n")
+		return nil
+	}
+	for _, v := range violations {
+		fmt.Fprintf(rp.stdout, "%s\n", v.Error())
+	}
+	return fmt.Errorf("%d input validation rule(s) failed", len(violations))
+}
+
+// validate loads the template and the inputs, and returns every violation of
+// the template's input rules and constraints. The violations, and the error
+// if the template or the inputs couldn't be loaded, are marked with
+// diagnostic codes.
+func (c *ValidateCommand) validate(ctx context.Context, rp *runParams) (_ []error, rErr error) {
+	tempTracker := tempdir.NewDirTracker(rp.fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("os.Getwd(): %w", err)
+	}
+
+	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory to use as template directory: %w", err)
+	}
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:         cwd,
+		Source:      c.flags.Source,
+		GitProtocol: c.flags.GitProtocol,
+		FS:          rp.fs,
+	})
+	if err != nil {
+		return nil, diagnostic.WithCode(diagnostic.CodeDownloadFailed, err)
+	}
+
+	if _, err = downloader.Download(ctx, cwd, templateDir); err != nil {
+		return nil, diagnostic.WithCode(diagnostic.CodeDownloadFailed, fmt.Errorf("failed to download/copy template: %w", err))
+	}
+
+	spec, err := specutil.Load(ctx, rp.fs, templateDir, c.flags.Source)
+	if err != nil {
+		return nil, diagnostic.WithCode(diagnostic.CodeSpecInvalid, err)
+	}
+
+	// Inputs inherited from base templates have rules too.
+	bases, err := extends.Resolve(ctx, &extends.ResolveParams{
+		Cwd:         cwd,
+		Downloader:  downloader,
+		FS:          rp.fs,
+		GitProtocol: c.flags.GitProtocol,
+		Spec:        spec,
+		TemplateDir: templateDir,
+		Tracker:     tempTracker,
+	})
+	if err != nil {
+		return nil, diagnostic.WithCode(diagnostic.CodeBaseTemplateFailed, err)
+	}
+	spec = extends.Merge(bases, spec)
+
+	// This combines the flags, input files, and defaults, and catches unknown
+	// and missing inputs. The rules are checked separately below, so that
+	// every violation is reported.
+	inputs, err := input.Resolve(ctx, &input.ResolveParams{
+		FS:                  rp.fs,
+		Spec:                spec,
+		Inputs:              c.flags.Inputs,
+		InputFiles:          c.flags.InputFiles,
+		Stdin:               rp.stdin,
+		SkipInputValidation: true,
+	})
+	if err != nil {
+		return nil, diagnostic.WithCode(diagnostic.CodeInputInvalid, err)
+	}
+
+	var violations []error
+	for _, v := range input.CheckRules(ctx, spec.Inputs, inputs) {
+		violations = append(violations, diagnostic.WithCode(diagnostic.CodeInputRuleViolated, v))
+	}
+	for _, v := range input.CheckConstraints(spec.Inputs, spec.InputConstraints, inputs) {
+		violations = append(violations, diagnostic.WithCode(diagnostic.CodeInputConstraintViolated, v))
+	}
+	return violations, nil
+}
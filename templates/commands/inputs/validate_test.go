@@ -0,0 +1,265 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inputs
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestValidateFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    ValidateFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--input", "name=alice",
+				"--input-file", "inputs.yaml",
+				"--git-protocol", "ssh",
+				"--format", "json",
+				"helloworld@v1",
+			},
+			want: ValidateFlags{
+				Source:      "helloworld@v1",
+				Inputs:      map[string]string{"name": "alice"},
+				InputFiles:  []string{"inputs.yaml"},
+				GitProtocol: "ssh",
+				Format:      "json",
+			},
+		},
+		{
+			name: "defaults",
+			args: []string{"helloworld@v1"},
+			want: ValidateFlags{
+				Source:      "helloworld@v1",
+				Inputs:      map[string]string{},
+				GitProtocol: "https",
+				Format:      "text",
+			},
+		},
+		{
+			name:    "required_source_is_missing",
+			args:    []string{},
+			wantErr: "missing <source> file",
+		},
+		{
+			name:    "invalid_format",
+			args:    []string{"--format", "xml", "helloworld@v1"},
+			wantErr: `invalid --format: invalid format "xml", must be one of text, json`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd ValidateCommand
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if err != nil || tc.wantErr != "" {
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'Test Description'
+inputs:
+  - name: 'name'
+    desc: 'a name'
+    rules:
+      - rule: 'size(name) < 6'
+        message: 'must be short'
+  - name: 'color'
+    desc: 'a color'
+    default: 'red'
+    rules:
+      - rule: 'color in ["red", "blue"]'
+steps:
+  - desc: 'Print a message'
+    action: 'print'
+    params:
+      message: 'hello'
+`
+
+	cases := []struct {
+		name       string
+		inputs     map[string]string
+		inputFiles map[string]string
+		format     string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name:       "valid_with_default",
+			inputs:     map[string]string{"name": "alice"},
+			wantStdout: "all inputs are valid\n",
+		},
+		{
+			name:       "valid_from_input_file",
+			inputFiles: map[string]string{"inputs.yaml": "name: bob\ncolor: blue\n"},
+			wantStdout: "all inputs are valid\n",
+		},
+		{
+			name:   "every_violation_is_printed",
+			inputs: map[string]string{"name": "bartholomew", "color": "green"},
+			wantStdout: `at line 8 column 9: input "name" with value "bartholomew" doesn't satisfy rule "size(name) < 6": must be short
+at line 14 column 9: input "color" with value "green" doesn't satisfy rule "color in [\"red\", \"blue\"]"
+`,
+			wantErr: "2 input validation rule(s) failed",
+		},
+		{
+			name:   "json_violations",
+			inputs: map[string]string{"name": "bartholomew", "color": "green"},
+			format: "json",
+			wantStdout: `{
+  "schema_version": 1,
+  "command": "inputs validate",
+  "source": "SOURCE",
+  "diagnostics": [
+    {
+      "file": "spec.yaml",
+      "line": 8,
+      "column": 9,
+      "severity": "error",
+      "code": "input_rule_violated",
+      "message": "input \"name\" with value \"bartholomew\" doesn't satisfy rule \"size(name) < 6\": must be short"
+    },
+    {
+      "file": "spec.yaml",
+      "line": 14,
+      "column": 9,
+      "severity": "error",
+      "code": "input_rule_violated",
+      "message": "input \"color\" with value \"green\" doesn't satisfy rule \"color in [\\\"red\\\", \\\"blue\\\"]\""
+    }
+  ]
+}
+`,
+			wantErr: "found 2 problem(s) with the inputs",
+		},
+		{
+			name:   "json_valid",
+			inputs: map[string]string{"name": "alice"},
+			format: "json",
+			wantStdout: `{
+  "schema_version": 1,
+  "command": "inputs validate",
+  "source": "SOURCE",
+  "diagnostics": []
+}
+`,
+		},
+		{
+			name:   "json_unknown_input",
+			inputs: map[string]string{"name": "alice", "size": "large"},
+			format: "json",
+			wantStdout: `{
+  "schema_version": 1,
+  "command": "inputs validate",
+  "source": "SOURCE",
+  "diagnostics": [
+    {
+      "severity": "error",
+      "code": "input_invalid",
+      "message": "unknown input(s): size"
+    }
+  ]
+}
+`,
+			wantErr: "found 1 problem(s) with the inputs",
+		},
+		{
+			name:    "missing_input",
+			wantErr: "missing input(s): name",
+		},
+		{
+			name:    "unknown_input",
+			inputs:  map[string]string{"name": "alice", "size": "large"},
+			wantErr: "unknown input(s): size",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{"spec.yaml": specContents})
+			inputFilesDir := filepath.Join(tempDir, "inputs")
+			abctestutil.WriteAllDefaultMode(t, inputFilesDir, tc.inputFiles)
+			inputFiles := make([]string, 0, len(tc.inputFiles))
+			for name := range tc.inputFiles {
+				inputFiles = append(inputFiles, filepath.Join(inputFilesDir, name))
+			}
+
+			stdoutBuf := &strings.Builder{}
+			c := &ValidateCommand{
+				flags: ValidateFlags{
+					Source:     sourceDir,
+					Inputs:     tc.inputs,
+					InputFiles: inputFiles,
+					Format:     tc.format,
+				},
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := c.realRun(ctx, &runParams{
+				fs:     &common.RealFS{},
+				stdout: stdoutBuf,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			wantStdout := strings.ReplaceAll(tc.wantStdout, "SOURCE", sourceDir)
+			if diff := cmp.Diff(stdoutBuf.String(), wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
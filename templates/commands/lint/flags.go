@@ -0,0 +1,115 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/diagnostic"
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// LintFlags describes what template to lint and which checks to run.
+type LintFlags struct {
+	// Source is the location of the template to lint.
+	//
+	// Example: github.com/abcxyz/abc/t/rest_server@latest
+	Source string
+
+	// RenderTwice renders the template twice into the same destination and
+	// checks that the second render doesn't change anything.
+	RenderTwice bool
+
+	// CheckDeterminism renders the template twice into separate directories
+	// and checks that the outputs are the same.
+	CheckDeterminism bool
+
+	// ExplainMigration adds, to the warning about each old behavior that the
+	// template keeps because of its api_version, how the behavior changes
+	// with a newer api_version.
+	ExplainMigration bool
+
+	// AllowExec allows the template to run external programs, like the
+	// "command" of a "format" action.
+	AllowExec bool
+
+	// See common/flags.Inputs().
+	Inputs map[string]string
+
+	// See common/flags.InputFiles().
+	InputFiles []string
+
+	// See common/flags.KeepTempDirs().
+	KeepTempDirs bool
+
+	// GitProtocol either https or ssh.
+	GitProtocol string
+
+	// See common/flags.DiagnosticFormat().
+	Format string
+}
+
+func (r *LintFlags) Register(set *cli.FlagSet) {
+	l := set.NewSection("LINT OPTIONS")
+	l.BoolVar(&cli.BoolVar{
+		Name:    "render-twice",
+		Target:  &r.RenderTwice,
+		Default: false,
+		Usage: "Render the template twice into the same empty destination directory with the same inputs, " +
+			"and fail if the second render changes any files, which means the template isn't idempotent.",
+	})
+	l.BoolVar(&cli.BoolVar{
+		Name:    "check-determinism",
+		Target:  &r.CheckDeterminism,
+		Default: false,
+		Usage: "Render the template twice into separate empty directories with the same inputs, and fail if " +
+			"the outputs differ, naming the first step whose output was different.",
+	})
+	l.BoolVar(&cli.BoolVar{
+		Name:    "explain-migration",
+		Target:  &r.ExplainMigration,
+		Default: false,
+		Usage: "For each behavior that the template keeps from its older api_version, explain how it changes " +
+			"with a newer api_version, and what to check before upgrading.",
+	})
+	l.BoolVar(&cli.BoolVar{
+		Name:    "allow-exec",
+		Target:  &r.AllowExec,
+		Default: false,
+		Usage:   "Allow the template to run external programs on this machine when it's rendered, like formatters named in the \"command\" of a \"format\" action.",
+	})
+	l.StringMapVar(flags.Inputs(&r.Inputs))
+	l.StringSliceVar(flags.InputFiles(&r.InputFiles))
+	l.BoolVar(flags.KeepTempDirs(&r.KeepTempDirs))
+	l.StringVar(flags.DiagnosticFormat(&r.Format))
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	// Default source to the first CLI argument, if given
+	set.AfterParse(func(existingErr error) error {
+		r.Source = strings.TrimSpace(set.Arg(0))
+		if r.Source == "" {
+			return fmt.Errorf("missing <source> file")
+		}
+		if err := diagnostic.ValidateFormat(r.Format); err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,403 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint implements the "templates lint" subcommand, which checks a
+// template for problems without rendering it into a real destination.
+package lint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/diagnostic"
+	"github.com/abcxyz/abc/templates/common/extends"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/abc/templates/model/spec/features"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags LintFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "check a template for problems"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <source>
+
+The {{ COMMAND }} command downloads the template <source>, and the templates it
+extends, and checks that their spec.yaml files are valid.
+
+With --render-twice, it also renders the template twice into the same empty
+temporary directory, and fails if the second render changes any of the files
+written by the first. A template that isn't idempotent, like one that appends
+to a file every time it's rendered, is listed along with the files that
+changed.
+
+With --check-determinism, it also renders the template twice, each time into a
+new empty temporary directory, and fails if the two renders produced different
+files. A template that isn't deterministic, like one that uses the current time
+or random values, breaks golden tests. The files that differ are listed, along
+with the first step whose output was different.
+
+Renders use the inputs given with --input and --input-file, and the defaults of
+any others, without prompting.
+
+If the api_version is older than the latest, lint also warns about each old
+behavior that the template keeps because of it, like paths that aren't globs.
+With --explain-migration, each of these warnings also says how the behavior
+changes with a newer api_version, and what to check before changing it.
+
+With --format=json, the problems that are found, including warnings like an
+outdated api_version, are printed as a JSON report with the file, line, column,
+severity, and code of each one, for editors and other tools. The command still
+fails if there are any errors.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type runParams struct {
+	clock  clock.Clock
+	cwd    string
+	fs     common.FS
+	stdout io.Writer
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		clock:  clock.New(),
+		cwd:    wd,
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(ctx context.Context, rp *runParams) error {
+	report := diagnostic.NewReport("lint", c.flags.Source)
+	if c.flags.Format != diagnostic.FormatJSON {
+		return c.lint(ctx, rp, report)
+	}
+
+	// The report is the only output, so the messages of the checks that
+	// passed are left out.
+	lintParams := *rp
+	lintParams.stdout = io.Discard
+	if err := c.lint(ctx, &lintParams, report); err != nil {
+		report.AddError(specutil.SpecFileName, err)
+	}
+	if err := report.Write(rp.stdout); err != nil {
+		return err //nolint:wrapcheck
+	}
+	if n := report.ErrorCount(); n > 0 {
+		return fmt.Errorf("found %d problem(s) in the template", n)
+	}
+	return nil
+}
+
+// lint runs the checks, adding any warnings to report and printing them, and
+// returns the first error. The errors are marked with the diagnostic codes of
+// the checks that failed.
+func (c *Command) lint(ctx context.Context, rp *runParams, report *diagnostic.Report) (rErr error) {
+	tempTracker := tempdir.NewDirTracker(rp.fs, c.flags.KeepTempDirs)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory to use as template directory: %w", err)
+	}
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:         rp.cwd,
+		Source:      c.flags.Source,
+		GitProtocol: c.flags.GitProtocol,
+		FS:          rp.fs,
+	})
+	if err != nil {
+		return diagnostic.WithCode(diagnostic.CodeDownloadFailed, err)
+	}
+	if _, err := downloader.Download(ctx, rp.cwd, templateDir); err != nil {
+		return diagnostic.WithCode(diagnostic.CodeDownloadFailed, fmt.Errorf("failed to download/copy template: %w", err))
+	}
+
+	spec, err := specutil.Load(ctx, rp.fs, templateDir, c.flags.Source)
+	if err != nil {
+		return diagnostic.WithCode(diagnostic.CodeSpecInvalid, err)
+	}
+	if err := c.checkAPIVersion(rp, templateDir, spec.Features, report); err != nil {
+		return err
+	}
+	if _, err := extends.Resolve(ctx, &extends.ResolveParams{
+		Cwd:         rp.cwd,
+		Downloader:  downloader,
+		FS:          rp.fs,
+		GitProtocol: c.flags.GitProtocol,
+		Spec:        spec,
+		TemplateDir: templateDir,
+		Tracker:     tempTracker,
+	}); err != nil {
+		return diagnostic.WithCode(diagnostic.CodeBaseTemplateFailed, err)
+	}
+
+	if c.flags.RenderTwice {
+		if err := c.renderTwice(ctx, rp, downloader, tempTracker); err != nil {
+			return err
+		}
+	}
+	if c.flags.CheckDeterminism {
+		if err := c.checkDeterminism(ctx, rp, downloader, tempTracker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAPIVersion adds warnings to report, and prints them, if the template's
+// spec.yaml has an older api_version than the latest one supported: one for
+// the api_version itself, and one for each old behavior that the template
+// keeps because of it, which f is the features of.
+func (c *Command) checkAPIVersion(rp *runParams, templateDir string, f features.Features, report *diagnostic.Report) error {
+	apiVersion, err := specutil.LoadAPIVersion(rp.fs, templateDir)
+	if err != nil {
+		return diagnostic.WithCode(diagnostic.CodeSpecInvalid, err)
+	}
+	d := diagnostic.OutdatedAPIVersion(specutil.SpecFileName, apiVersion, decode.LatestSupportedAPIVersion(version.IsReleaseBuild()))
+	if d == nil {
+		return nil
+	}
+	ds := append([]*diagnostic.Diagnostic{d}, diagnostic.Migrations(specutil.SpecFileName, apiVersion, f.Migrations(), c.flags.ExplainMigration)...)
+	report.Add(ds...)
+	for _, d := range ds {
+		fmt.Fprintln(rp.stdout, d)
+	}
+	return nil
+}
+
+// render renders the template into destDir without prompting.
+func (c *Command) render(ctx context.Context, rp *runParams, downloader templatesource.Downloader, destDir string, forceOverwrite bool, snapshots *render.StepSnapshots) error {
+	return diagnostic.WithCode(diagnostic.CodeRenderFailed, render.Render(ctx, &render.Params{
+		AllowExec:         c.flags.AllowExec,
+		Clock:             rp.clock,
+		Cwd:               rp.cwd,
+		DestDir:           destDir,
+		Downloader:        downloader,
+		FS:                rp.fs,
+		ForceOverwrite:    forceOverwrite,
+		Inputs:            c.flags.Inputs,
+		InputFiles:        c.flags.InputFiles,
+		KeepTempDirs:      c.flags.KeepTempDirs,
+		LookupEnv:         c.LookupEnv,
+		SourceForMessages: c.flags.Source,
+		StepSnapshots:     snapshots,
+		Stdout:            io.Discard,
+	}))
+}
+
+// renderTwice renders the template twice into the same destination directory
+// and returns an error listing the files that the second render changed.
+func (c *Command) renderTwice(ctx context.Context, rp *runParams, downloader templatesource.Downloader, tempTracker *tempdir.DirTracker) error {
+	destDir, err := tempTracker.MkdirTempTracked("", tempdir.LintRenderDirNamePart)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory to render into: %w", err)
+	}
+
+	if err := c.render(ctx, rp, downloader, destDir, false, nil); err != nil {
+		return fmt.Errorf("first render failed: %w", err)
+	}
+	first, err := loadDir(rp.fs, destDir)
+	if err != nil {
+		return err
+	}
+	// The second render must be allowed to overwrite the output of the first,
+	// so that the outputs can be compared.
+	if err := c.render(ctx, rp, downloader, destDir, true, nil); err != nil {
+		return fmt.Errorf("second render into the output of the first failed: %w", err)
+	}
+	second, err := loadDir(rp.fs, destDir)
+	if err != nil {
+		return err
+	}
+
+	if changes := compareDirs(first, second); len(changes) > 0 {
+		return diagnostic.WithCode(diagnostic.CodeNotIdempotent, fmt.Errorf(
+			"the template isn't idempotent, rendering it a second time into the same directory with the same inputs changed %d file(s):\n  %s",
+			len(changes), strings.Join(changes, "\n  ")))
+	}
+	fmt.Fprintf(rp.stdout, "rendering %s twice produced the same %d file(s)\n", c.flags.Source, len(first))
+	return nil
+}
+
+// checkDeterminism renders the template twice, each time into a new empty
+// directory, and returns an error listing the files that differ between the
+// two, and the first step whose output differed.
+func (c *Command) checkDeterminism(ctx context.Context, rp *runParams, downloader templatesource.Downloader, tempTracker *tempdir.DirTracker) error {
+	var outputs [2]map[string]string
+	var snapshots [2]*render.StepSnapshots
+	for i := range outputs {
+		destDir, err := tempTracker.MkdirTempTracked("", tempdir.LintRenderDirNamePart)
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory to render into: %w", err)
+		}
+		snapshots[i] = &render.StepSnapshots{}
+		if err := c.render(ctx, rp, downloader, destDir, false, snapshots[i]); err != nil {
+			return fmt.Errorf("render %d of 2 failed: %w", i+1, err)
+		}
+		if outputs[i], err = loadDir(rp.fs, destDir); err != nil {
+			return err
+		}
+	}
+
+	changes := compareDirs(outputs[0], outputs[1])
+	if len(changes) == 0 {
+		fmt.Fprintf(rp.stdout, "rendering %s twice into separate directories produced the same %d file(s)\n", c.flags.Source, len(outputs[0]))
+		return nil
+	}
+	msg := fmt.Sprintf("the template isn't deterministic, two renders with the same inputs into separate directories produced %d different file(s):\n  %s",
+		len(changes), strings.Join(changes, "\n  "))
+	if culprit := firstDifferentStep(snapshots[0], snapshots[1]); culprit != "" {
+		msg += "\n" + culprit
+	}
+	return diagnostic.WithCode(diagnostic.CodeNotDeterministic, errors.New(msg))
+}
+
+// firstDifferentStep describes the first step after which the scratch
+// directories of two renders differed, or returns "" if they never did.
+func firstDifferentStep(a, b *render.StepSnapshots) string {
+	for i := 0; i < len(a.Snapshots) && i < len(b.Snapshots); i++ {
+		sa, sb := a.Snapshots[i], b.Snapshots[i]
+		if sa.Template != sb.Template || sa.Step.Pos != sb.Step.Pos {
+			// Something like an "if" on a random value.
+			return fmt.Sprintf("the renders ran different steps: %s, and %s", describeStep(sa), describeStep(sb))
+		}
+		if changed := sa.ChangedPaths(sb); len(changed) > 0 {
+			return fmt.Sprintf("the output first differed after %s, in: %s", describeStep(sa), strings.Join(changed, ", "))
+		}
+	}
+	if len(a.Snapshots) != len(b.Snapshots) {
+		return fmt.Sprintf("the renders ran different numbers of steps: %d and %d", len(a.Snapshots), len(b.Snapshots))
+	}
+	return ""
+}
+
+// describeStep names the step of a snapshot and says where it's defined.
+func describeStep(s *render.StepSnapshot) string {
+	out := fmt.Sprintf("the step %q (action %q) at line %d of spec.yaml", s.Step.Desc.Val, s.Step.Action.Val, s.Step.Pos.Line)
+	if s.Template != "" {
+		out += fmt.Sprintf(" of the base template %q", s.Template)
+	}
+	return out
+}
+
+// loadDir returns the contents of every file under dir, keyed by their paths
+// relative to dir, using forward slashes.
+func loadDir(fsys common.FS, dir string) (map[string]string, error) {
+	out := map[string]string{}
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", dir, path, err)
+		}
+		buf, err := fsys.ReadFile(path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		out[filepath.ToSlash(rel)] = string(buf)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading the rendered files in %q: %w", dir, err)
+	}
+	return out, nil
+}
+
+// compareDirs returns a sorted description of each file that was added,
+// removed, or modified between the before and after contents.
+func compareDirs(before, after map[string]string) []string {
+	var out []string
+	for path, b := range before {
+		a, ok := after[path]
+		switch {
+		case !ok:
+			out = append(out, fmt.Sprintf("%s: removed", path))
+		case a != b:
+			out = append(out, fmt.Sprintf("%s: modified, %s", path, firstDifference(b, a)))
+		}
+	}
+	for path := range after {
+		if _, ok := before[path]; !ok {
+			out = append(out, fmt.Sprintf("%s: added", path))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// firstDifference describes the first line that differs between before and
+// after, which are known to be different.
+func firstDifference(before, after string) string {
+	beforeLines := strings.Split(before, "\n")
+	afterLines := strings.Split(after, "\n")
+	for i := 0; ; i++ {
+		switch {
+		case i >= len(beforeLines):
+			return fmt.Sprintf("line %d was added: %q", i+1, afterLines[i])
+		case i >= len(afterLines):
+			return fmt.Sprintf("line %d was removed: %q", i+1, beforeLines[i])
+		case beforeLines[i] != afterLines[i]:
+			return fmt.Sprintf("line %d changed from %q to %q", i+1, beforeLines[i], afterLines[i])
+		}
+	}
+}
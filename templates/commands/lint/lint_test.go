@@ -0,0 +1,562 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestLintFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    LintFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--render-twice",
+				"--check-determinism",
+				"--explain-migration",
+				"--allow-exec",
+				"--input", "x=y",
+				"--input-file", "abc-inputs.yaml",
+				"--keep-temp-dirs",
+				"--git-protocol", "ssh",
+				"--format", "json",
+				"helloworld@v1",
+			},
+			want: LintFlags{
+				Source:           "helloworld@v1",
+				RenderTwice:      true,
+				CheckDeterminism: true,
+				ExplainMigration: true,
+				AllowExec:        true,
+				Inputs:           map[string]string{"x": "y"},
+				InputFiles:       []string{"abc-inputs.yaml"},
+				KeepTempDirs:     true,
+				GitProtocol:      "ssh",
+				Format:           "json",
+			},
+		},
+		{
+			name: "minimal_flags_present",
+			args: []string{"helloworld@v1"},
+			want: LintFlags{
+				Source:      "helloworld@v1",
+				Inputs:      map[string]string{},
+				GitProtocol: "https",
+				Format:      "text",
+			},
+		},
+		{
+			name:    "required_source_is_missing",
+			args:    []string{},
+			wantErr: "missing <source> file",
+		},
+		{
+			name:    "invalid_format",
+			args:    []string{"--format", "yaml", "helloworld@v1"},
+			wantErr: `invalid --format: invalid format "yaml", must be one of text, json`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd Command
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if err != nil || tc.wantErr != "" {
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		templateContents map[string]string
+		renderTwice      bool
+		checkDeterminism bool
+		explainMigration bool
+		allowExec        bool
+		inputs           map[string]string
+		format           string
+		wantStdout       string
+		wantErr          string
+	}{
+		{
+			name: "valid_spec",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'name'
+    desc: 'A name'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+			},
+			// v1beta4 is only an alias of the latest, v1beta5, so there's no
+			// warning.
+			wantStdout: "",
+		},
+		{
+			name: "migration_warnings",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta3'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+			},
+			wantStdout: `spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta3" is older than the latest, "cli.abcxyz.dev/v1beta5"; change it to the latest to use the newest features
+spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta3" is older than "cli.abcxyz.dev/v1beta4", so the builtin variable _rendered_paths isn't defined
+spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta3" is older than "cli.abcxyz.dev/v1beta4", so the builtin variables _git_commit_time, _git_author_name, and _git_author_email aren't defined
+spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta3" is older than "cli.abcxyz.dev/v1beta4", so "**" in a glob matches a single path element, like "*", and a path starting with "!" is literal
+spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta3" is older than "cli.abcxyz.dev/v1beta4", so a path in an action that modifies files may match only empty directories
+`,
+		},
+		{
+			name:             "explain_migration",
+			explainMigration: true,
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta1'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+			},
+			wantStdout: `spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta1" is older than "cli.abcxyz.dev/v1beta2", so paths in steps are literal file names, not globs. Starting in cli.abcxyz.dev/v1beta2, the paths of actions like include and string_replace are globs, so a path containing *, ?, or [ matches every file that fits the pattern. Check that none of the paths in this spec contain those characters, or escape them, before upgrading.
+spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta1" is older than "cli.abcxyz.dev/v1beta3", so the builtin variables _git_sha, _git_short_sha, and _git_tag aren't defined. Starting in cli.abcxyz.dev/v1beta3, _git_sha, _git_short_sha, and _git_tag are set from the git repo that the template was downloaded from, and are empty if it wasn't in one. Nothing changes for templates that don't use them.
+spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta1" is older than "cli.abcxyz.dev/v1beta4", so the builtin variable _rendered_paths isn't defined. Starting in cli.abcxyz.dev/v1beta4, each step can use _rendered_paths, which lists the files that the earlier steps have written. Nothing changes for templates that don't use it.
+spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta1" is older than "cli.abcxyz.dev/v1beta4", so the builtin variables _git_commit_time, _git_author_name, and _git_author_email aren't defined. Starting in cli.abcxyz.dev/v1beta4, _git_commit_time, _git_author_name, and _git_author_email are set from the commit of the template's git repo, and are empty if it wasn't in one. Nothing changes for templates that don't use them.
+spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta1" is older than "cli.abcxyz.dev/v1beta4", so "**" in a glob matches a single path element, like "*", and a path starting with "!" is literal. Starting in cli.abcxyz.dev/v1beta4, a "**" path element in a glob matches any number of directories, so "**/*.txt" matches text files at every depth rather than one directory down, and a path starting with "!" excludes the files it matches from the step. Check the paths, ignore patterns, and skip patterns in this spec that contain "**" or start with "!" before upgrading.
+spec.yaml:1:14: warning: api_version "cli.abcxyz.dev/v1beta1" is older than "cli.abcxyz.dev/v1beta4", so a path in an action that modifies files may match only empty directories. Starting in cli.abcxyz.dev/v1beta4, it's an error when a path in an action that modifies files, like string_replace or go_template, has no files in it that the action can modify, like an empty directory, rather than just a warning. Render the template with the inputs it's used with, and check for "didn't match any files" warnings, before upgrading.
+`,
+		},
+		{
+			name:   "json_migration_warnings",
+			format: "json",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta3'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+			},
+			wantStdout: `    {
+      "file": "spec.yaml",
+      "line": 1,
+      "column": 14,
+      "severity": "warning",
+      "code": "api_version_migration",
+      "message": "api_version \"cli.abcxyz.dev/v1beta3\" is older than \"cli.abcxyz.dev/v1beta4\", so the builtin variables _git_commit_time, _git_author_name, and _git_author_email aren't defined"
+    },
+    {
+      "file": "spec.yaml",
+      "line": 1,
+      "column": 14,
+      "severity": "warning",
+      "code": "api_version_migration",
+      "message": "api_version \"cli.abcxyz.dev/v1beta3\" is older than \"cli.abcxyz.dev/v1beta4\", so \"**\" in a glob matches a single path element, like \"*\", and a path starting with \"!\" is literal"
+    },
+    {
+      "file": "spec.yaml",
+      "line": 1,
+      "column": 14,
+      "severity": "warning",
+      "code": "api_version_migration",
+      "message": "api_version \"cli.abcxyz.dev/v1beta3\" is older than \"cli.abcxyz.dev/v1beta4\", so a path in an action that modifies files may match only empty directories"
+    }
+  ]
+}
+`,
+		},
+		{
+			name:   "json_valid_spec",
+			format: "json",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+			},
+			wantStdout: `"diagnostics": []
+}
+`,
+		},
+		{
+			name:   "json_invalid_spec",
+			format: "json",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a**']
+  - desc: 'Include another file'
+    action: 'include'
+    params:
+      paths: ['b**']
+`,
+			},
+			wantStdout: `"diagnostics": [
+    {
+      "file": "spec.yaml",
+      "line": 8,
+      "column": 15,
+      "severity": "error",
+      "code": "spec_invalid",
+      "message": "invalid glob: \"**\" can only be used as a whole path element, like \"a/**/b\", in \"a**\": syntax error in pattern"
+    },
+    {
+      "file": "spec.yaml",
+      "line": 12,
+      "column": 15,
+      "severity": "error",
+      "code": "spec_invalid",
+      "message": "invalid glob: \"**\" can only be used as a whole path element, like \"a/**/b\", in \"b**\": syntax error in pattern"
+    }
+  ]
+}
+`,
+			wantErr: "found 2 problem(s) in the template",
+		},
+		{
+			name:        "json_not_idempotent",
+			format:      "json",
+			renderTwice: true,
+			templateContents: map[string]string{
+				"count.txt": "{{.count}}1\n",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'count'
+    desc: 'The count so far'
+    default: ''
+    infer:
+      file: 'count.txt'
+      regex: '(\d+)'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['count.txt']
+  - desc: 'Fill it in'
+    action: 'go_template'
+    params:
+      paths: ['count.txt']
+`,
+			},
+			wantStdout: `"diagnostics": [
+    {
+      "severity": "error",
+      "code": "not_idempotent",
+      "message": "the template isn't idempotent, rendering it a second time into the same directory with the same inputs changed 1 file(s):\n  count.txt: modified, line 1 changed from \"1\" to \"11\""
+    }
+  ]
+}
+`,
+			wantErr: "found 1 problem(s) in the template",
+		},
+		{
+			name: "invalid_spec",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a**']
+`,
+			},
+			wantErr: `invalid glob`,
+		},
+		{
+			name:        "idempotent",
+			renderTwice: true,
+			inputs:      map[string]string{"name": "alice"},
+			templateContents: map[string]string{
+				"a.txt": "Hello, {{.name}}\n",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'name'
+    desc: 'A name'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Fill it in'
+    action: 'go_template'
+    params:
+      paths: ['a.txt']
+`,
+			},
+			wantStdout: "produced the same 1 file(s)\n",
+		},
+		{
+			name:        "missing_input",
+			renderTwice: true,
+			templateContents: map[string]string{
+				"a.txt": "Hello",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'name'
+    desc: 'A name'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+			},
+			wantErr: "first render failed",
+		},
+		{
+			// Each render appends to the value it read from the output of
+			// the previous one.
+			name:        "not_idempotent",
+			renderTwice: true,
+			templateContents: map[string]string{
+				"count.txt": "{{.count}}1\n",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'count'
+    desc: 'The count so far'
+    default: ''
+    infer:
+      file: 'count.txt'
+      regex: '(\d+)'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['count.txt']
+  - desc: 'Fill it in'
+    action: 'go_template'
+    params:
+      paths: ['count.txt']
+`,
+			},
+			wantErr: `changed 1 file(s):
+  count.txt: modified, line 1 changed from "1" to "11"`,
+		},
+		{
+			name:             "deterministic",
+			checkDeterminism: true,
+			templateContents: map[string]string{
+				"a.txt": "Hello, {{._flag_source}}\n",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Fill it in'
+    action: 'go_template'
+    params:
+      paths: ['a.txt']
+`,
+			},
+			wantStdout: "into separate directories produced the same 1 file(s)\n",
+		},
+		{
+			// The formatter appends its process ID, which is different each
+			// time.
+			name:             "not_deterministic",
+			checkDeterminism: true,
+			allowExec:        true,
+			templateContents: map[string]string{
+				"a.txt": "Hello\n",
+				"b.txt": "Hello\n",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include the files'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'b.txt']
+  - desc: 'Uppercase a'
+    action: 'format'
+    params:
+      paths: ['a.txt']
+      command: ['tr', 'a-z', 'A-Z']
+  - desc: 'Add the process ID to b'
+    action: 'format'
+    params:
+      paths: ['b.txt']
+      command: ['sh', '-c', 'cat; echo $$']
+`,
+			},
+			wantErr: `produced 1 different file(s):
+  b.txt: modified, line 2 changed from`,
+		},
+		{
+			name:             "not_deterministic_names_step",
+			checkDeterminism: true,
+			allowExec:        true,
+			templateContents: map[string]string{
+				"b.txt": "Hello\n",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include the files'
+    action: 'include'
+    params:
+      paths: ['b.txt']
+  - desc: 'Add the process ID to b'
+    action: 'format'
+    params:
+      paths: ['b.txt']
+      command: ['sh', '-c', 'cat; echo $$']
+`,
+			},
+			wantErr: `the output first differed after the step "Add the process ID to b" (action "format") at line 9 of spec.yaml, in: b.txt`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, tc.templateContents)
+			stdoutBuf := &strings.Builder{}
+			c := &Command{
+				flags: LintFlags{
+					Source:           sourceDir,
+					RenderTwice:      tc.renderTwice,
+					CheckDeterminism: tc.checkDeterminism,
+					ExplainMigration: tc.explainMigration,
+					AllowExec:        tc.allowExec,
+					Inputs:           tc.inputs,
+					Format:           tc.format,
+				},
+			}
+			rp := &runParams{
+				clock:  clock.NewMock(),
+				cwd:    tempDir,
+				fs:     &common.RealFS{},
+				stdout: stdoutBuf,
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := c.realRun(ctx, rp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if !strings.HasSuffix(stdoutBuf.String(), tc.wantStdout) {
+				t.Errorf("got stdout %q, want it to end with %q", stdoutBuf.String(), tc.wantStdout)
+			}
+		})
+	}
+}
+
+func TestCompareDirs(t *testing.T) {
+	t.Parallel()
+
+	before := map[string]string{
+		"same.txt":    "x",
+		"removed.txt": "x",
+		"changed.txt": "a\nb\n",
+		"longer.txt":  "a",
+	}
+	after := map[string]string{
+		"same.txt":    "x",
+		"changed.txt": "a\nc\n",
+		"longer.txt":  "a\nb",
+		"added.txt":   "x",
+	}
+	want := []string{
+		"added.txt: added",
+		`changed.txt: modified, line 2 changed from "b" to "c"`,
+		`longer.txt: modified, line 2 was added: "b"`,
+		"removed.txt: removed",
+	}
+	if diff := cmp.Diff(compareDirs(before, after), want); diff != "" {
+		t.Errorf("compareDirs() was not as expected (-got,+want): %s", diff)
+	}
+}
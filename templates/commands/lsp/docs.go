@@ -0,0 +1,54 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"github.com/abcxyz/abc/templates/common/builtinvar"
+)
+
+// docsURL is the template developer guide, which documents every action in
+// detail.
+const docsURL = "https://github.com/abcxyz/abc#template-developer-guide"
+
+// actionDocs are the hover docs of each action, shown for the value of an
+// "action" field in spec.yaml. They're kept short; the README has the
+// details.
+var actionDocs = map[string]string{
+	"append":            "Appends text to the end of files.",
+	"call_step_group":   "Runs the steps of a step group defined under `step_groups`.",
+	"for_each":          "Runs its steps once for each value of a list, with the value in a var.",
+	"format":            "Runs a formatter, like gofmt, on files. Needs `--allow-exec` if it has a `command`.",
+	"go_mod_edit":       "Edits a go.mod file, like to add a require or replace directive.",
+	"go_template":       "Executes files as Go templates, with the inputs and vars in scope, like `{{.my_input}}`.",
+	"hcl_edit":          "Edits an HCL file, like a Terraform file, to set or append to attributes.",
+	"include":           "Copies files and directories from the template, or from the destination, into the output.",
+	"print":             "Prints a message to standard output after the template is rendered.",
+	"regex_name_lookup": "Replaces regex matches with the input or var named by a capture group.",
+	"regex_replace":     "Replaces regex matches in files with a template expression.",
+	"string_replace":    "Replaces strings in files.",
+}
+
+// builtinVarDocs are the hover docs of the built-in vars.
+var builtinVarDocs = map[string]string{
+	builtinvar.FlagDest:       "The destination directory of the render, the value of `--dest`.",
+	builtinvar.FlagSource:     "The location of the template being rendered, as given on the command line.",
+	builtinvar.GitTag:         "The git tag of the template's commit, if it has one. Needs api_version v1beta3 or later.",
+	builtinvar.GitSHA:         "The full SHA of the template's git commit. Needs api_version v1beta3 or later.",
+	builtinvar.GitShortSHA:    "The first 7 characters of the template's git commit SHA. Needs api_version v1beta3 or later.",
+	builtinvar.GitCommitTime:  "The time of the template's git commit, in RFC 3339 format. Needs api_version v1beta4 or later.",
+	builtinvar.GitAuthorName:  "The author name of the template's git commit. Needs api_version v1beta4 or later.",
+	builtinvar.GitAuthorEmail: "The author email of the template's git commit. Needs api_version v1beta4 or later.",
+	builtinvar.RenderedPaths:  "The paths of the files written by the previous steps, separated by newlines. Needs api_version v1beta4 or later.",
+}
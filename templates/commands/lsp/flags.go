@@ -0,0 +1,36 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"github.com/abcxyz/pkg/cli"
+)
+
+// LSPFlags describes how to run the language server.
+type LSPFlags struct {
+	// Stdio is accepted because editors commonly pass --stdio to language
+	// servers. Standard input and output are the only transport.
+	Stdio bool
+}
+
+func (f *LSPFlags) Register(set *cli.FlagSet) {
+	s := set.NewSection("LSP OPTIONS")
+	s.BoolVar(&cli.BoolVar{
+		Name:    "stdio",
+		Target:  &f.Stdio,
+		Default: true,
+		Usage:   "Communicate over standard input and output. This is the default and the only option; the flag is accepted because editors commonly pass it.",
+	})
+}
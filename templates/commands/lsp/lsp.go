@@ -0,0 +1,75 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lsp implements the "lsp" subcommand, a language server for
+// template authors that checks spec.yaml and test.yaml files as they're
+// edited.
+package lsp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags LSPFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "run a language server for editing template spec.yaml and test.yaml files"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+The {{ COMMAND }} command runs a Language Server Protocol server over standard
+input and output, for editors to start when a template's spec.yaml, or a golden
+test's test.yaml, is opened. It provides:
+
+- Diagnostics: the problems that "abc templates lint" finds in the file, at
+  their line and column, updated as the file is edited.
+- Hover docs: for the action of a step, for built-in vars like _git_tag, and
+  for the template's inputs.
+- Completion: of the template's input names and the built-in vars, and of the
+  action names in an "action" field.
+
+Inputs inherited from base templates with "extends" aren't completed, and
+templates aren't rendered, so nothing is downloaded.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	return newServer(fSys, c.Stdout()).serve(ctx, c.Stdin())
+}
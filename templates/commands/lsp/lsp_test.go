@@ -0,0 +1,284 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const testSpec = `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'service_name'
+    desc: 'The name of the service'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a**']
+`
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+
+	// The LSP messages that are sent, other than "initialize", which is always
+	// first, and "shutdown" and "exit", which are always last.
+	type request struct {
+		method string
+		params any
+	}
+	openSpec := request{"textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": "file://SPEC", "text": testSpec},
+	}}
+	at := func(method, uri string, line, character int) request {
+		return request{method, map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": line, "character": character},
+		}}
+	}
+
+	cases := []struct {
+		name     string
+		requests []request
+		want     []string
+	}{
+		{
+			name:     "diagnostics_on_open",
+			requests: []request{openSpec},
+			want: []string{
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file://SPEC","diagnostics":[` +
+					`{"range":{"start":{"line":10,"character":14},"end":{"line":10,"character":20}},"severity":1,"code":"spec_invalid","source":"abc",` +
+					`"message":"validation failed in spec.yaml: invalid glob: \"**\" can only be used as a whole path element, like \"a/**/b\", in \"a**\": syntax error in pattern"}]}}`,
+			},
+		},
+		{
+			name: "cleared_after_change",
+			requests: []request{openSpec, {"textDocument/didChange", map[string]any{
+				"textDocument":   map[string]any{"uri": "file://SPEC"},
+				"contentChanges": []any{map[string]any{"text": strings.ReplaceAll(testSpec, "a**", "a.txt")}},
+			}}},
+			want: []string{
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file://SPEC","diagnostics":[{"range":{"start":{"line":10,"character":14}`,
+				// v1beta4 is only an alias of the latest, v1beta5, so there's no
+				// warning.
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file://SPEC","diagnostics":[]}}`,
+			},
+		},
+		{
+			name: "migration_warnings",
+			requests: []request{{"textDocument/didOpen", map[string]any{"textDocument": map[string]any{
+				"uri":  "file://SPEC",
+				"text": strings.NewReplacer("v1beta4", "v1beta3", "a**", "a.txt").Replace(testSpec),
+			}}}},
+			want: []string{
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file://SPEC","diagnostics":[` +
+					`{"range":{"start":{"line":0,"character":13},"end":{"line":0,"character":37}},"severity":2,"code":"api_version_outdated","source":"abc",` +
+					`"message":"api_version \"cli.abcxyz.dev/v1beta3\" is older than the latest, \"cli.abcxyz.dev/v1beta5\"; change it to the latest to use the newest features"},` +
+					`{"range":{"start":{"line":0,"character":13},"end":{"line":0,"character":37}},"severity":2,"code":"api_version_migration","source":"abc",` +
+					`"message":"api_version \"cli.abcxyz.dev/v1beta3\" is older than \"cli.abcxyz.dev/v1beta4\", so the builtin variable _rendered_paths isn't defined. Starting in`,
+			},
+		},
+		{
+			name:     "hover_action",
+			requests: []request{openSpec, at("textDocument/hover", "file://SPEC", 8, 15)},
+			want: []string{
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics"`,
+				`{"jsonrpc":"2.0","id":2,"result":{"contents":{"kind":"markdown","value":"**action** ` + "`include`" +
+					`\n\nCopies files and directories from the template, or from the destination, into the output.\n\n` +
+					`See the [template developer guide](https://github.com/abcxyz/abc#template-developer-guide)."},` +
+					`"range":{"start":{"line":8,"character":13},"end":{"line":8,"character":20}}}}`,
+			},
+		},
+		{
+			name:     "hover_input_in_golden_test",
+			requests: []request{openSpec, {"textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": "file://TEST", "text": "inputs:\n  - name: 'service_name'\n"}}}, at("textDocument/hover", "file://TEST", 1, 12)},
+			want: []string{
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file://SPEC"`,
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file://TEST","diagnostics":[{"range":{"start":{"line":0,"character":0}`,
+				`{"jsonrpc":"2.0","id":3,"result":{"contents":{"kind":"markdown","value":"**input** ` + "`service_name`" + `\n\nThe name of the service"},` +
+					`"range":{"start":{"line":1,"character":11},"end":{"line":1,"character":23}}}}`,
+			},
+		},
+		{
+			name:     "hover_env_var",
+			requests: []request{{"textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": "file://SPEC", "text": strings.ReplaceAll(testSpec, "a**", "{{._env_HOME}}")}}}, at("textDocument/hover", "file://SPEC", 10, 20)},
+			want: []string{
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics"`,
+				`{"jsonrpc":"2.0","id":2,"result":{"contents":{"kind":"markdown","value":"**built-in var** ` + "`_env_HOME`" +
+					`\n\nThe environment variable ` + "`HOME`" + `, which must be declared in ` + "`env_vars`" + `."},` +
+					`"range":{"start":{"line":10,"character":18},"end":{"line":10,"character":27}}}}`,
+			},
+		},
+		{
+			name:     "hover_nothing",
+			requests: []request{openSpec, at("textDocument/hover", "file://SPEC", 2, 1)},
+			want: []string{
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics"`,
+				`{"jsonrpc":"2.0","id":2,"result":null}`,
+			},
+		},
+		{
+			name:     "complete_action",
+			requests: []request{openSpec, at("textDocument/completion", "file://SPEC", 8, 15)},
+			want: []string{
+				`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics"`,
+				`{"jsonrpc":"2.0","id":2,"result":[{"label":"append","kind":14,"documentation":"Appends text to the end of files."},{"label":"call_step_group"`,
+			},
+		},
+		{
+			// The spec isn't open, so it's read from the file.
+			name: "complete_input_in_golden_test",
+			requests: []request{
+				at("textDocument/completion", "file://TEST", 1, 11),
+			},
+			want: []string{
+				`{"jsonrpc":"2.0","id":1,"result":[{"label":"service_name","kind":6,"detail":"input","documentation":"The name of the service"},` +
+					`{"label":"_flag_dest","kind":6,"detail":"built-in var"`,
+			},
+		},
+		{
+			name:     "unknown_method",
+			requests: []request{{"textDocument/definition", map[string]any{}}},
+			want: []string{
+				`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method \"textDocument/definition\" is not supported"}}`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+				"spec.yaml": testSpec,
+			})
+			specPath := filepath.Join(tempDir, "spec.yaml")
+			testPath := filepath.Join(tempDir, "testdata", "golden", "test1", "test.yaml")
+			replacer := strings.NewReplacer("file://SPEC", "file://"+specPath, "file://TEST", "file://"+testPath)
+
+			var in bytes.Buffer
+			send := func(id int, method string, params any) {
+				msg := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+				if id >= 0 {
+					msg["id"] = id
+				}
+				buf, err := json.Marshal(msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(replacer.Replace(string(buf))), replacer.Replace(string(buf)))
+			}
+			send(0, "initialize", map[string]any{})
+			for i, r := range tc.requests {
+				id := i + 1
+				if strings.HasPrefix(r.method, "textDocument/did") {
+					id = -1 // a notification
+				}
+				send(id, r.method, r.params)
+			}
+			send(100, "shutdown", nil)
+			send(-1, "exit", nil)
+
+			var out bytes.Buffer
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			if err := newServer(&common.RealFS{}, &out).serve(ctx, &in); err != nil {
+				t.Fatal(err)
+			}
+
+			got := readAll(t, &out)
+			if len(got) < 2 || !strings.Contains(got[0], `"hoverProvider":true`) || got[len(got)-1] != `{"jsonrpc":"2.0","id":100,"result":null}` {
+				t.Fatalf("got messages %q, want the initialize and shutdown responses first and last", got)
+			}
+			got = got[1 : len(got)-1]
+			want := make([]string, 0, len(tc.want))
+			for _, w := range tc.want {
+				want = append(want, replacer.Replace(w))
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d messages %q, want %d", len(got), got, len(want))
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], want[i]) {
+					t.Errorf("message %d:\n%s\nwant it to start with:\n%s", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServe_ExitWithoutShutdown(t *testing.T) {
+	t.Parallel()
+
+	in := strings.NewReader("Content-Length: 33\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"exit\"}")
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	err := newServer(&common.RealFS{}, io.Discard).serve(ctx, in)
+	if diff := testutil.DiffErrString(err, "exited without a shutdown request"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestByteOffset(t *testing.T) {
+	t.Parallel()
+
+	// "é" is 2 bytes and 1 UTF-16 code unit, "😀" is 4 bytes and 2.
+	line := "aé😀b"
+	for char, want := range map[int]int{0: 0, 1: 1, 2: 3, 4: 7, 5: 8, 6: 8} {
+		if got := byteOffset(line, char); got != want {
+			t.Errorf("byteOffset(%q, %d) = %d, want %d", line, char, got, want)
+		}
+	}
+	if got, want := utf16Len(line), 5; got != want {
+		t.Errorf("utf16Len(%q) = %d, want %d", line, got, want)
+	}
+	if got, want := runeColumnToUTF16(line, 4), 4; got != want {
+		t.Errorf("runeColumnToUTF16(%q, 4) = %d, want %d", line, got, want)
+	}
+}
+
+// readAll returns the bodies of the messages in r.
+func readAll(t *testing.T, r io.Reader) []string {
+	t.Helper()
+
+	var out []string
+	br := bufio.NewReader(r)
+	for {
+		buf, err := readMessage(br)
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, string(buf))
+	}
+}
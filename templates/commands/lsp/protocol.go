@@ -0,0 +1,231 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file has the small part of JSON-RPC 2.0 and the Language Server
+// Protocol that the server uses. See
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/.
+
+// maxMessageSize limits the Content-Length of a message, so a bad header
+// can't make the server allocate without bound.
+const maxMessageSize = 64 << 20
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// LSP enum values.
+const (
+	textDocumentSyncFull = 1
+
+	severityError   = 1
+	severityWarning = 2
+
+	completionKindVariable = 6
+	completionKindKeyword  = 14
+)
+
+// message is a JSON-RPC request, or a notification if ID is nil.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// readMessage reads one message, with its Content-Length header, from r.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err //nolint:wrapcheck // io.EOF is checked by the caller
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 || length > maxMessageSize {
+		return nil, fmt.Errorf("invalid Content-Length header %q", header.Get("Content-Length"))
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("failed reading a message body: %w", err)
+	}
+	return buf, nil
+}
+
+// writeMessage writes v to w as JSON with a Content-Length header.
+func writeMessage(w io.Writer, v any) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed marshaling a message: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(buf), buf); err != nil {
+		return fmt.Errorf("failed writing a message: %w", err)
+	}
+	return nil
+}
+
+type position struct {
+	// Line starts at 0.
+	Line int `json:"line"`
+
+	// Character is the offset in the line in UTF-16 code units, starting at
+	// 0.
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string           `json:"uri"`
+	Diagnostics []*lspDiagnostic `json:"diagnostics"`
+}
+
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    *lspRange     `json:"range,omitempty"`
+}
+
+type completionItem struct {
+	Label         string `json:"label"`
+	Kind          int    `json:"kind"`
+	Detail        string `json:"detail,omitempty"`
+	Documentation string `json:"documentation,omitempty"`
+}
+
+// utf16Len returns the length of s in UTF-16 code units, which is how LSP
+// measures characters.
+func utf16Len(s string) int {
+	var n int
+	for _, r := range s {
+		n += utf16Units(r)
+	}
+	return n
+}
+
+// utf16Units returns the number of UTF-16 code units that encode r.
+func utf16Units(r rune) int {
+	if r >= 0x10000 {
+		return 2 // a surrogate pair
+	}
+	return 1
+}
+
+// byteOffset returns the offset in bytes in line of the given offset in
+// UTF-16 code units, or len(line) if it's past the end.
+func byteOffset(line string, char int) int {
+	var units int
+	for i, r := range line {
+		if units >= char {
+			return i
+		}
+		units += utf16Units(r)
+	}
+	return len(line)
+}
+
+// runeColumnToUTF16 converts a column in runes, starting at 1, like those of
+// model.ConfigPos, to an offset in UTF-16 code units, starting at 0.
+func runeColumnToUTF16(line string, column int) int {
+	if column <= 1 {
+		return 0
+	}
+	var units int
+	for i := 0; i < column-1 && line != ""; i++ {
+		r, size := utf8.DecodeRuneInString(line)
+		units += utf16Units(r)
+		line = line[size:]
+	}
+	return units
+}
+
+// lines splits text into lines, without their line endings.
+func lines(text string) []string {
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
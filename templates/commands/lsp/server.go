@@ -0,0 +1,417 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/builtinvar"
+	"github.com/abcxyz/abc/templates/common/diagnostic"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/model/decode"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// goldenTestFileName is the name of a golden test's config file, which is in
+// testdata/golden/<test name>/ under the template directory.
+const goldenTestFileName = "test.yaml"
+
+// server holds the state of one language server session.
+type server struct {
+	fs  common.FS
+	out io.Writer
+
+	// docs are the contents of the open documents, keyed by file path.
+	docs map[string]string
+
+	// isReleaseBuild is the value of version.IsReleaseBuild(), which decides
+	// the latest api_version.
+	isReleaseBuild bool
+
+	shutdown bool
+}
+
+func newServer(fs common.FS, out io.Writer) *server {
+	return &server{
+		fs:             fs,
+		out:            out,
+		docs:           map[string]string{},
+		isReleaseBuild: version.IsReleaseBuild(),
+	}
+}
+
+// serve handles the messages read from r until the client sends "exit" or r
+// is closed.
+func (s *server) serve(ctx context.Context, r io.Reader) error {
+	logger := logging.FromContext(ctx).With("logger", "lsp.serve")
+
+	br := bufio.NewReader(r)
+	for {
+		buf, err := readMessage(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(buf, &msg); err != nil {
+			if err := s.respondError(nil, codeParseError, fmt.Sprintf("invalid JSON: %v", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		logger.DebugContext(ctx, "received message", "method", msg.Method)
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("the client exited without a shutdown request")
+			}
+			return nil
+		}
+		if err := s.handle(ctx, &msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles one message. Errors in a request are sent back to the
+// client; only failures to write to it are returned.
+func (s *server) handle(ctx context.Context, msg *message) error {
+	var result any
+	var err error
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": textDocumentSyncFull,
+				"hoverProvider":    true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{".", " "},
+				},
+			},
+			"serverInfo": map[string]string{
+				"name":    version.Name,
+				"version": version.Version,
+			},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			return s.update(ctx, p.TextDocument.URI, p.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil && len(p.ContentChanges) > 0 {
+			// With full sync, the last change is the whole document.
+			return s.update(ctx, p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			delete(s.docs, uriToPath(p.TextDocument.URI))
+			return s.publish(p.TextDocument.URI, []*lspDiagnostic{})
+		}
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			result = s.hover(ctx, &p)
+		}
+	case "textDocument/completion":
+		var p textDocumentPositionParams
+		if err = json.Unmarshal(msg.Params, &p); err == nil {
+			result = s.complete(ctx, &p)
+		}
+	default:
+		if msg.ID == nil {
+			// Notifications that aren't needed, like "initialized" and
+			// "$/cancelRequest", are ignored.
+			return nil
+		}
+		return s.respondError(msg.ID, codeMethodNotFound, fmt.Sprintf("method %q is not supported", msg.Method))
+	}
+
+	if msg.ID == nil {
+		return nil
+	}
+	if err != nil {
+		return s.respondError(msg.ID, codeInvalidParams, fmt.Sprintf("invalid params: %v", err))
+	}
+	buf, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed marshaling the result of %q: %w", msg.Method, err)
+	}
+	return writeMessage(s.out, &response{JSONRPC: "2.0", ID: msg.ID, Result: buf})
+}
+
+func (s *server) respondError(id *json.RawMessage, code int, msg string) error {
+	return writeMessage(s.out, &response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &responseError{Code: code, Message: msg},
+	})
+}
+
+func (s *server) publish(uri string, diags []*lspDiagnostic) error {
+	return writeMessage(s.out, &notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  &publishDiagnosticsParams{URI: uri, Diagnostics: diags},
+	})
+}
+
+// update stores the new text of a document, and publishes its diagnostics.
+func (s *server) update(ctx context.Context, uri, text string) error {
+	path := uriToPath(uri)
+	s.docs[path] = text
+	return s.publish(uri, toLSPDiagnostics(text, s.lint(ctx, path, text)))
+}
+
+// lint returns the problems with a spec.yaml or test.yaml file, from decoding
+// and validating it like "abc templates lint" does. Other files have none.
+func (s *server) lint(ctx context.Context, path, text string) []*diagnostic.Diagnostic {
+	name := filepath.Base(path)
+	var kind, code string
+	switch name {
+	case specutil.SpecFileName:
+		kind, code = decode.KindTemplate, diagnostic.CodeSpecInvalid
+	case goldenTestFileName:
+		kind, code = decode.KindGoldenTest, diagnostic.CodeGoldenTestInvalid
+	default:
+		return nil
+	}
+
+	decoded, err := decode.DecodeValidateUpgrade(ctx, strings.NewReader(text), name, kind)
+	if err != nil {
+		return diagnostic.FromError(name, diagnostic.SeverityError, diagnostic.WithCode(code, err))
+	}
+	sp, ok := decoded.(*spec.Spec)
+	if !ok {
+		return nil
+	}
+	apiVersion, err := decode.APIVersion(strings.NewReader(text), name)
+	if err != nil {
+		return nil //nolint:nilerr // it was already decoded without error
+	}
+	d := diagnostic.OutdatedAPIVersion(name, apiVersion, decode.LatestSupportedAPIVersion(s.isReleaseBuild))
+	if d == nil {
+		return nil
+	}
+	// Editors have room for the explanations, which say what to check before
+	// changing the api_version.
+	return append([]*diagnostic.Diagnostic{d}, diagnostic.Migrations(name, apiVersion, sp.Features.Migrations(), true)...)
+}
+
+// toLSPDiagnostics converts diagnostics to LSP diagnostics in text. Each one
+// goes from its position to the end of the line, or covers the first line if
+// the position isn't known.
+func toLSPDiagnostics(text string, diags []*diagnostic.Diagnostic) []*lspDiagnostic {
+	ls := lines(text)
+	out := make([]*lspDiagnostic, 0, len(diags))
+	for _, d := range diags {
+		line, column := d.Line, d.Column
+		if line < 1 || line > len(ls) {
+			line, column = 1, 1
+		}
+		lineText := ls[line-1]
+		severity := severityError
+		if d.Severity == diagnostic.SeverityWarning {
+			severity = severityWarning
+		}
+		out = append(out, &lspDiagnostic{
+			Range: lspRange{
+				Start: position{Line: line - 1, Character: runeColumnToUTF16(lineText, column)},
+				End:   position{Line: line - 1, Character: utf16Len(lineText)},
+			},
+			Severity: severity,
+			Code:     d.Code,
+			Source:   version.Name,
+			Message:  d.Message,
+		})
+	}
+	return out
+}
+
+// actionValueRE matches the part of a line before the value of an "action"
+// field, including any part of the value that has been typed.
+var actionValueRE = regexp.MustCompile(`^\s*(- )?\s*action:\s*['"]?(\w*)$`)
+
+// hover returns the docs of the action, built-in var, or input at a position,
+// or nil if there aren't any.
+func (s *server) hover(ctx context.Context, p *textDocumentPositionParams) *hover {
+	path := uriToPath(p.TextDocument.URI)
+	ls := lines(s.docs[path])
+	if p.Position.Line >= len(ls) {
+		return nil
+	}
+	line := ls[p.Position.Line]
+	start, end := wordAt(line, byteOffset(line, p.Position.Character))
+	word := line[start:end]
+	if word == "" {
+		return nil
+	}
+
+	var value string
+	if doc, ok := actionDocs[word]; ok && actionValueRE.MatchString(line[:end]) {
+		value = fmt.Sprintf("**action** `%s`\n\n%s\n\nSee the [template developer guide](%s).", word, doc, docsURL)
+	} else if doc, ok := builtinVarDocs[word]; ok {
+		value = fmt.Sprintf("**built-in var** `%s`\n\n%s", word, doc)
+	} else if name := strings.TrimPrefix(word, builtinvar.EnvPrefix); name != word && name != "" {
+		value = fmt.Sprintf("**built-in var** `%s`\n\nThe environment variable `%s`, which must be declared in `env_vars`.", word, name)
+	} else {
+		for _, in := range s.templateInputs(ctx, path) {
+			if in.name == word {
+				value = fmt.Sprintf("**input** `%s`\n\n%s", in.name, in.desc)
+				break
+			}
+		}
+	}
+	if value == "" {
+		return nil
+	}
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: value},
+		Range: &lspRange{
+			Start: position{Line: p.Position.Line, Character: utf16Len(line[:start])},
+			End:   position{Line: p.Position.Line, Character: utf16Len(line[:end])},
+		},
+	}
+}
+
+// complete returns the completions at a position: action names for the value
+// of an "action" field, and otherwise the names of the template's inputs and
+// the built-in vars.
+func (s *server) complete(ctx context.Context, p *textDocumentPositionParams) []*completionItem {
+	path := uriToPath(p.TextDocument.URI)
+	ls := lines(s.docs[path])
+	if p.Position.Line < len(ls) {
+		line := ls[p.Position.Line]
+		if actionValueRE.MatchString(line[:byteOffset(line, p.Position.Character)]) {
+			out := make([]*completionItem, 0, len(actionDocs))
+			for name, doc := range actionDocs {
+				out = append(out, &completionItem{Label: name, Kind: completionKindKeyword, Documentation: doc})
+			}
+			sort.Slice(out, func(i, j int) bool { return out[i].Label < out[j].Label })
+			return out
+		}
+	}
+
+	out := []*completionItem{}
+	for _, in := range s.templateInputs(ctx, path) {
+		out = append(out, &completionItem{Label: in.name, Kind: completionKindVariable, Detail: "input", Documentation: in.desc})
+	}
+	builtins := make([]*completionItem, 0, len(builtinVarDocs))
+	for name, doc := range builtinVarDocs {
+		builtins = append(builtins, &completionItem{Label: name, Kind: completionKindVariable, Detail: "built-in var", Documentation: doc})
+	}
+	sort.Slice(builtins, func(i, j int) bool { return builtins[i].Label < builtins[j].Label })
+	return append(out, builtins...)
+}
+
+type inputInfo struct {
+	name, desc string
+}
+
+// templateInputs returns the inputs declared in the spec.yaml of the template
+// that path belongs to: path itself, or the template of a golden test. The
+// open document is used if the spec.yaml is open, and otherwise the file.
+// Inputs inherited with "extends" aren't included, since that would mean
+// downloading the base templates.
+func (s *server) templateInputs(ctx context.Context, path string) []*inputInfo {
+	specPath := path
+	if filepath.Base(path) == goldenTestFileName {
+		specPath = filepath.Join(filepath.Dir(path), "..", "..", "..", specutil.SpecFileName)
+	}
+	if filepath.Base(specPath) != specutil.SpecFileName {
+		return nil
+	}
+	text, ok := s.docs[specPath]
+	if !ok {
+		buf, err := s.fs.ReadFile(specPath)
+		if err != nil {
+			logging.FromContext(ctx).DebugContext(ctx, "failed reading the template spec for completions",
+				"path", specPath, "error", err)
+			return nil
+		}
+		text = string(buf)
+	}
+	return parseInputs(text)
+}
+
+// parseInputs returns the inputs in the text of a spec.yaml file. Unlike
+// decoding it, this works on a file that's invalid, as it often is while it's
+// being edited, as long as it's valid YAML.
+func parseInputs(text string) []*inputInfo {
+	var doc struct {
+		Inputs []struct {
+			Name string `yaml:"name"`
+			Desc string `yaml:"desc"`
+		} `yaml:"inputs"`
+	}
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil
+	}
+	var out []*inputInfo
+	for _, in := range doc.Inputs {
+		if in.Name != "" {
+			out = append(out, &inputInfo{name: in.Name, desc: in.Desc})
+		}
+	}
+	return out
+}
+
+// wordAt returns the bounds of the identifier in line that contains the byte
+// offset, which may be just after its end.
+func wordAt(line string, offset int) (start, end int) {
+	isWordByte := func(b byte) bool {
+		return b == '_' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+	}
+	start, end = offset, offset
+	for start > 0 && isWordByte(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordByte(line[end]) {
+		end++
+	}
+	return start, end
+}
+
+// uriToPath converts a file:// URI to a file path. Other URIs are returned
+// as-is, so they're still unique keys.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
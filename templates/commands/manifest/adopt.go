@@ -0,0 +1,336 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/benbjohnson/clock"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/manifestutil"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type AdoptCommand struct {
+	cli.BaseCommand
+	flags AdoptFlags
+
+	testFS common.FS
+
+	// testDownloader, if set, is used instead of the downloader for <source>.
+	testDownloader templatesource.Downloader
+}
+
+// Desc implements cli.Command.
+func (c *AdoptCommand) Desc() string {
+	return "create a manifest for output that was rendered without one"
+}
+
+func (c *AdoptCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <source>
+
+The {{ COMMAND }} command writes a manifest for a destination directory that
+was rendered from the template <source> without leaving one, like before abc
+wrote manifests, or by another tool, so that it can be upgraded like any other
+rendered template. <source> should include the version that was rendered,
+like github.com/my-org/templates/service@v1.2.3, and the --input and
+--input-file flags should give the inputs that it was rendered with.
+
+The template is rendered again into a temporary directory, and each output file
+is compared with the one in --dest (default: the current directory):
+
+  matches  the file in --dest is the same as the rendered one.
+  differs  the file in --dest has been changed. It's in the manifest, so an
+           upgrade treats it as changed by the user.
+  missing  there's no such file in --dest. It's left out of the manifest, so
+           an upgrade may create it.
+
+Then the manifest is written to the .abc directory of --dest. It fails if none
+of the output files are in --dest, which usually means the wrong template or
+destination, or if --dest already has a manifest for the template.
+
+<source> must be a remote location, like a git repo or a bucket, since upgrades
+need to find the template again; a local directory isn't accepted.
+
+Use --dry-run to compare the files without writing the manifest.
+`
+}
+
+func (c *AdoptCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *AdoptCommand) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		clock:  clock.New(),
+		cwd:    wd,
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// The ways that an output file of the template can compare with the file in
+// the destination.
+const (
+	adoptMatches = "matches"
+	adoptDiffers = "differs"
+	adoptMissing = "missing"
+)
+
+// realRun provides a fakeable interface to test Run.
+func (c *AdoptCommand) realRun(ctx context.Context, rp *runParams) (rErr error) {
+	dest := c.flags.Dest
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(rp.cwd, dest)
+	}
+	if fi, err := rp.fs.Stat(dest); err != nil || !fi.IsDir() {
+		return fmt.Errorf("the destination %q must be an existing directory", c.flags.Dest)
+	}
+
+	tempTracker := tempdir.NewDirTracker(rp.fs, c.flags.KeepTempDirs)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	renderDir, err := c.render(ctx, rp, tempTracker)
+	if err != nil {
+		return err
+	}
+	paths, err := manifestutil.Find(rp.fs, renderDir)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if len(paths) != 1 {
+		return fmt.Errorf("internal error: the render left %d manifests, not 1", len(paths))
+	}
+	m, buf, err := manifestutil.Load(ctx, rp.fs, paths[0])
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if err := checkNotAdopted(ctx, rp.fs, dest, m); err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	kept := make([]*manifest.OutputHash, 0, len(m.OutputHashes))
+	for _, oh := range m.OutputHashes {
+		result, err := compareOutput(rp.fs, renderDir, dest, oh)
+		if err != nil {
+			return err
+		}
+		counts[result]++
+		if result != adoptMissing {
+			kept = append(kept, oh)
+		}
+		if _, err := fmt.Fprintf(rp.stdout, "%s  %s\n", result, oh.File.Val); err != nil {
+			return fmt.Errorf("failed writing output: %w", err)
+		}
+	}
+	if len(m.OutputHashes) > 0 && len(kept) == 0 {
+		return fmt.Errorf("none of the template's %d output files are in %q; check the template location and --dest",
+			len(m.OutputHashes), c.flags.Dest)
+	}
+
+	summary := fmt.Sprintf("%d file(s) match, %d differ, %d missing", counts[adoptMatches], counts[adoptDiffers], counts[adoptMissing])
+	if c.flags.DryRun {
+		_, err := fmt.Fprintf(rp.stdout, "%s; would write a manifest to %s\n", summary, displayPath(rp.cwd, filepath.Join(dest, common.ABCInternalDir)))
+		if err != nil {
+			return fmt.Errorf("failed writing output: %w", err)
+		}
+		return nil
+	}
+
+	out, err := setOutputHashes(buf, kept)
+	if err != nil {
+		return fmt.Errorf("failed building manifest: %w", err)
+	}
+	path, err := writeAdoptedManifest(rp, dest, filepath.Base(paths[0]), out)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(rp.stdout, "%s; wrote %s\n", summary, displayPath(rp.cwd, path)); err != nil {
+		return fmt.Errorf("failed writing output: %w", err)
+	}
+	return nil
+}
+
+// render renders the template into a new temporary directory, with a
+// manifest, and returns the directory.
+func (c *AdoptCommand) render(ctx context.Context, rp *runParams, tempTracker *tempdir.DirTracker) (string, error) {
+	renderDir, err := tempTracker.MkdirTempTracked("", tempdir.AdoptRenderNamePart)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory to render into: %w", err)
+	}
+	downloader := c.testDownloader
+	if downloader == nil {
+		downloader, err = templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+			CWD:         rp.cwd,
+			Source:      c.flags.Source,
+			GitProtocol: c.flags.GitProtocol,
+			FS:          rp.fs,
+		})
+		if err != nil {
+			return "", err //nolint:wrapcheck
+		}
+	}
+	if _, ok := downloader.(*templatesource.LocalDownloader); ok {
+		return "", errs.Wrap(errs.ErrInputValidation, fmt.Errorf("the template %q is a local directory, which "+
+			"can't be upgraded from; give its remote location, like github.com/my-org/templates/service@v1.2.3", c.flags.Source))
+	}
+	if err := render.Render(ctx, &render.Params{
+		AllowExec:         c.flags.AllowExec,
+		Clock:             rp.clock,
+		Cwd:               rp.cwd,
+		DestDir:           renderDir,
+		Downloader:        downloader,
+		FS:                rp.fs,
+		Inputs:            c.flags.Inputs,
+		InputFiles:        c.flags.InputFiles,
+		KeepTempDirs:      c.flags.KeepTempDirs,
+		LookupEnv:         c.LookupEnv,
+		Manifest:          true,
+		SourceForMessages: c.flags.Source,
+		Stdout:            io.Discard,
+	}); err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return renderDir, nil
+}
+
+// checkNotAdopted returns an error if dest already has a manifest for the
+// template location of m. Templates without a canonical location can't be
+// told apart, so they're never rejected.
+func checkNotAdopted(ctx context.Context, fsys common.FS, dest string, m *manifest.Manifest) error {
+	if m.TemplateLocation.Val == "" {
+		return nil
+	}
+	paths, err := manifestutil.Find(fsys, dest)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	for _, path := range paths {
+		if manifestutil.DestDir(path) != dest {
+			continue
+		}
+		existing, _, err := manifestutil.Load(ctx, fsys, path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if existing.TemplateLocation.Val == m.TemplateLocation.Val {
+			return errs.Wrap(errs.ErrConflict, fmt.Errorf("the destination already has the manifest %q for %s; "+
+				"use upgrade instead", path, m.TemplateLocation.Val))
+		}
+	}
+	return nil
+}
+
+// compareOutput compares the output file of oh in renderDir with the file of
+// the same name in dest. Symlinks are compared by their targets.
+func compareOutput(fsys common.FS, renderDir, dest string, oh *manifest.OutputHash) (string, error) {
+	rendered := filepath.Join(renderDir, filepath.FromSlash(oh.File.Val))
+	existing := filepath.Join(dest, filepath.FromSlash(oh.File.Val))
+
+	if oh.SymlinkTarget.Val != "" {
+		target, ok, err := common.ReadlinkIfSymlink(fsys, existing)
+		if err != nil {
+			if common.IsStatNotExistErr(err) {
+				return adoptMissing, nil
+			}
+			return "", err //nolint:wrapcheck
+		}
+		if ok && filepath.ToSlash(target) == oh.SymlinkTarget.Val {
+			return adoptMatches, nil
+		}
+		return adoptDiffers, nil
+	}
+
+	want, err := fsys.ReadFile(rendered)
+	if err != nil {
+		return "", fmt.Errorf("failed reading rendered file: %w", err)
+	}
+	got, err := fsys.ReadFile(existing)
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return adoptMissing, nil
+		}
+		return "", fmt.Errorf("failed reading existing file: %w", err)
+	}
+	if bytes.Equal(got, want) {
+		return adoptMatches, nil
+	}
+	return adoptDiffers, nil
+}
+
+// setOutputHashes returns the manifest YAML in buf with its output_hashes
+// replaced by outputs. The YAML is edited as a node tree, so the rest of the
+// manifest, including its header comment, is kept.
+func setOutputHashes(buf []byte, outputs []*manifest.OutputHash) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	node, err := mappingValue(&doc, "output_hashes")
+	if err != nil {
+		return nil, err
+	}
+	if err := node.Encode(outputs); err != nil {
+		return nil, fmt.Errorf("failed encoding output_hashes: %w", err)
+	}
+	return yaml.Marshal(&doc) //nolint:wrapcheck
+}
+
+// writeAdoptedManifest writes the manifest contents buf to the .abc directory
+// of dest, with the given file name, while holding the destination's lock. It
+// returns the path of the manifest.
+func writeAdoptedManifest(rp *runParams, dest, name string, buf []byte) (_ string, rErr error) {
+	lock, err := common.LockDest(rp.fs, dest, rp.clock.Now())
+	if err != nil {
+		return "", fmt.Errorf("failed locking the destination directory: %w", err)
+	}
+	defer func() { rErr = errors.Join(rErr, lock.Unlock(true)) }()
+
+	path := filepath.Join(dest, common.ABCInternalDir, name)
+	if _, err := rp.fs.Stat(path); err == nil {
+		return "", fmt.Errorf("the manifest %q already exists", path)
+	}
+	if err := rp.fs.WriteFile(path, buf, common.OwnerRWPerms); err != nil {
+		return "", fmt.Errorf("failed writing manifest: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/manifestutil"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestAdoptCommand(t *testing.T) {
+	t.Parallel()
+
+	template := map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template to adopt'
+inputs:
+  - name: 'person'
+    desc: 'who to greet'
+steps:
+  - desc: 'Include the files'
+    action: 'include'
+    params:
+      paths: ['hello.txt', 'config.yaml', 'extra.txt']
+  - desc: 'Greet the person'
+    action: 'string_replace'
+    params:
+      paths: ['hello.txt']
+      replacements:
+      - to_replace: 'PERSON'
+        with: '{{.person}}'
+`,
+		"hello.txt":   "hello PERSON\n",
+		"config.yaml": "replicas: 1\n",
+		"extra.txt":   "added in a later version\n",
+	}
+
+	const (
+		location     = "github.com/my-org/templates/greeting"
+		manifestName = ".abc/manifest_github.com%2Fmy-org%2Ftemplates%2Fgreeting_2024-03-10T12:00:00Z.lock.yaml"
+	)
+
+	cases := []struct {
+		name       string
+		dest       map[string]string
+		args       []string
+		local      bool // use the template directory as <source>, without a remote location
+		wantStdout string
+		wantFiles  []string // in the manifest
+		wantErr    string
+	}{
+		{
+			name: "writes_manifest",
+			dest: map[string]string{
+				"hello.txt":   "hello alice\n",
+				"config.yaml": "replicas: 3\n",
+				"main.go":     "package main\n",
+			},
+			args: []string{"--input=person=alice"},
+			wantStdout: "differs  config.yaml\n" +
+				"missing  extra.txt\n" +
+				"matches  hello.txt\n" +
+				"1 file(s) match, 1 differ, 1 missing; wrote dest/" + manifestName + "\n",
+			wantFiles: []string{"config.yaml", "hello.txt"},
+		},
+		{
+			name: "dry_run",
+			dest: map[string]string{
+				"hello.txt": "hello alice\n",
+			},
+			args: []string{"--input=person=alice", "--dry-run"},
+			wantStdout: "missing  config.yaml\n" +
+				"missing  extra.txt\n" +
+				"matches  hello.txt\n" +
+				"1 file(s) match, 0 differ, 2 missing; would write a manifest to dest/.abc\n",
+		},
+		{
+			name: "nothing_in_dest",
+			dest: map[string]string{
+				"main.go": "package main\n",
+			},
+			args:    []string{"--input=person=alice"},
+			wantErr: `none of the template's 3 output files are in "dest"`,
+		},
+		{
+			name:    "missing_input",
+			dest:    map[string]string{"hello.txt": "hello alice\n"},
+			wantErr: "missing input(s): person",
+		},
+		{
+			name:    "local_template",
+			dest:    map[string]string{"hello.txt": "hello alice\n"},
+			args:    []string{"--input=person=alice"},
+			local:   true,
+			wantErr: "is a local directory, which can't be upgraded from",
+		},
+		{
+			name: "already_adopted",
+			dest: map[string]string{
+				"hello.txt":  "hello alice\n",
+				manifestName: strings.Replace(testManifest, "LOCATION", location, 1),
+			},
+			args:    []string{"--input=person=alice"},
+			wantErr: "the destination already has the manifest",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, filepath.Join(tempDir, "template"), template)
+			abctestutil.WriteAllDefaultMode(t, filepath.Join(tempDir, "dest"), tc.dest)
+
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+
+			ctx := context.Background()
+			cmd := &AdoptCommand{}
+			if !tc.local {
+				cmd.testDownloader = &fakeRemoteDownloader{
+					LocalDownloader: templatesource.LocalDownloader{SrcPath: filepath.Join(tempDir, "template")},
+					location:        location,
+				}
+			}
+			args := append([]string{"--dest=dest"}, tc.args...)
+			if err := cmd.Flags().Parse(append(args, filepath.Join(tempDir, "template"))); err != nil {
+				t.Fatal(err)
+			}
+			var stdout bytes.Buffer
+			err := cmd.realRun(ctx, &runParams{
+				clock:  clk,
+				cwd:    tempDir,
+				fs:     &common.RealFS{},
+				stdout: &stdout,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got := stdout.String(); tc.wantErr == "" && got != tc.wantStdout {
+				t.Errorf("got stdout:\n%s\nwant:\n%s", got, tc.wantStdout)
+			}
+
+			got := abctestutil.LoadDirWithoutMode(t, filepath.Join(tempDir, "dest"))
+			buf, ok := got[manifestName]
+			if tc.wantFiles == nil {
+				if ok && buf != tc.dest[manifestName] {
+					t.Errorf("a manifest was written, but none should have been")
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no manifest was written; the destination has %v", got)
+			}
+			m, _, err := manifestutil.Load(ctx, &common.RealFS{}, filepath.Join(tempDir, "dest", manifestName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotFiles []string
+			for _, oh := range m.OutputHashes {
+				gotFiles = append(gotFiles, oh.File.Val)
+			}
+			if diff := cmp.Diff(gotFiles, tc.wantFiles); diff != "" {
+				t.Errorf("manifest output files were not as expected (-got,+want): %s\n%s", diff, buf)
+			}
+			if m.TemplateLocation.Val != location || m.TemplateVersion.Val != "v1.0.0" {
+				t.Errorf("the manifest's template location and version were not as expected: %s", buf)
+			}
+			if len(m.Inputs) != 1 || m.Inputs[0].Value.Val != "alice" {
+				t.Errorf("the manifest's inputs were not as expected: %s", buf)
+			}
+		})
+	}
+}
+
+// fakeRemoteDownloader copies a local template, but reports it as if it came
+// from a remote git repo, so that the render has a canonical location.
+type fakeRemoteDownloader struct {
+	templatesource.LocalDownloader
+	location string
+}
+
+func (f *fakeRemoteDownloader) Download(ctx context.Context, cwd, destDir string) (*templatesource.DownloadMetadata, error) {
+	dlMeta, err := f.LocalDownloader.Download(ctx, cwd, destDir)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	dlMeta.IsCanonical = true
+	dlMeta.CanonicalSource = f.location
+	dlMeta.LocationType = templatesource.LocTypeRemoteGit
+	dlMeta.HasVersion = true
+	dlMeta.Version = "v1.0.0"
+	return dlMeta, nil
+}
+
+func TestCheckNotAdopted(t *testing.T) {
+	t.Parallel()
+
+	loc := "github.com/my-org/templates/service"
+	name, contents := manifestFile(loc)
+	tempDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		name:                    contents,
+		"sub/" + name:           contents, // another destination
+		"other/" + name + ".md": "not a manifest",
+	})
+
+	ctx := context.Background()
+	m := &manifest.Manifest{TemplateLocation: model.String{Val: loc}}
+	err := checkNotAdopted(ctx, &common.RealFS{}, tempDir, m)
+	if diff := testutil.DiffErrString(err, "the destination already has the manifest"); diff != "" {
+		t.Error(diff)
+	}
+	if !errors.Is(err, errs.ErrConflict) {
+		t.Errorf("got %v, want an error in the conflict category", err)
+	}
+
+	m.TemplateLocation.Val = "github.com/my-org/templates/other"
+	if err := checkNotAdopted(ctx, &common.RealFS{}, tempDir, m); err != nil {
+		t.Errorf("checkNotAdopted() for another template: %v", err)
+	}
+	if err := checkNotAdopted(ctx, &common.RealFS{}, filepath.Join(tempDir, "other"), m); err != nil {
+		t.Errorf("checkNotAdopted() for a directory without manifests: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// RewriteSourceFlags describes which manifests to rewrite, and how.
+type RewriteSourceFlags struct {
+	// Positional arguments:
+
+	// Dests are the directory trees to look for manifests in. Defaults to the
+	// current directory.
+	Dests []string
+
+	// Flag arguments (--foo):
+
+	// From is the old template location, like "github.com/old/repo". It
+	// matches the template_location of a manifest that's equal to it or that
+	// starts with it followed by "/".
+	From string
+
+	// To replaces From in the matching template locations.
+	To string
+
+	// DryRun lists the manifests that would be rewritten, without changing
+	// them.
+	DryRun bool
+}
+
+func (r *RewriteSourceFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("REWRITE OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "from",
+		Example: "github.com/old-org/templates",
+		Target:  &r.From,
+		Usage: "The old location of the templates. Manifests whose template_location is this location, or a " +
+			"subdirectory of it, are rewritten.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "to",
+		Example: "github.com/new-org/templates",
+		Target:  &r.To,
+		Usage:   "The new location of the templates, which replaces the --from part of each template_location.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "dry-run",
+		Target:  &r.DryRun,
+		Default: false,
+		Usage:   "List the manifests that would be rewritten, without changing them.",
+	})
+
+	set.AfterParse(func(existingErr error) error {
+		r.From = strings.TrimSuffix(r.From, "/")
+		r.To = strings.TrimSuffix(r.To, "/")
+		if r.From == "" {
+			return fmt.Errorf("missing --from")
+		}
+		if r.To == "" {
+			return fmt.Errorf("missing --to")
+		}
+		if r.From == r.To {
+			return fmt.Errorf("--from and --to must be different, but both are %q", r.From)
+		}
+		r.Dests = set.Args()
+		if len(r.Dests) == 0 {
+			r.Dests = []string{"."}
+		}
+		return nil
+	})
+}
+
+// GCFlags describes which manifests to clean up.
+type GCFlags struct {
+	// Positional arguments:
+
+	// Dests are the directory trees to look for manifests in. Defaults to the
+	// current directory.
+	Dests []string
+
+	// Flag arguments (--foo):
+
+	// DryRun lists what would be removed and merged, without changing
+	// anything.
+	DryRun bool
+}
+
+func (g *GCFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("GC OPTIONS")
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "dry-run",
+		Target:  &g.DryRun,
+		Default: false,
+		Usage:   "List the manifests that would be removed or merged, without changing them.",
+	})
+
+	set.AfterParse(func(existingErr error) error {
+		g.Dests = set.Args()
+		if len(g.Dests) == 0 {
+			g.Dests = []string{"."}
+		}
+		return nil
+	})
+}
+
+// AdoptFlags describes the template that a destination was rendered from,
+// and how to render it again to compare.
+type AdoptFlags struct {
+	// Positional arguments:
+
+	// Source is the location of the template that the destination was
+	// rendered from, including its version.
+	//
+	// Example: github.com/abcxyz/abc/t/rest_server@v0.2.1
+	Source string
+
+	// Flag arguments (--foo):
+
+	// Dest is the directory that was rendered into.
+	Dest string
+
+	// AllowExec allows the template to run external programs, like the
+	// "command" of a "format" action.
+	AllowExec bool
+
+	// See common/flags.Inputs(). They should be the inputs that the
+	// destination was rendered with.
+	Inputs map[string]string
+
+	// See common/flags.InputFiles().
+	InputFiles []string
+
+	// See common/flags.KeepTempDirs().
+	KeepTempDirs bool
+
+	// DryRun compares the files without writing the manifest.
+	DryRun bool
+
+	// See common/flags.GitProtocol().
+	GitProtocol string
+}
+
+func (a *AdoptFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("ADOPT OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "dest",
+		Aliases: []string{"d"},
+		Example: "/my/git/dir",
+		Target:  &a.Dest,
+		Default: ".",
+		Predict: predict.Dirs("*"),
+		Usage:   "The directory that the template was rendered into, where the manifest is written.",
+	})
+	f.BoolVar(&cli.BoolVar{
+		Name:    "allow-exec",
+		Target:  &a.AllowExec,
+		Default: false,
+		Usage:   "Allow the template to run external programs on this machine when it's rendered, like formatters named in the \"command\" of a \"format\" action.",
+	})
+	f.StringMapVar(flags.Inputs(&a.Inputs))
+	f.StringSliceVar(flags.InputFiles(&a.InputFiles))
+	f.BoolVar(flags.KeepTempDirs(&a.KeepTempDirs))
+	f.BoolVar(&cli.BoolVar{
+		Name:    "dry-run",
+		Target:  &a.DryRun,
+		Default: false,
+		Usage:   "Compare the files and report the result, without writing the manifest.",
+	})
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&a.GitProtocol))
+
+	set.AfterParse(func(existingErr error) error {
+		a.Source = strings.TrimSpace(set.Arg(0))
+		if a.Source == "" {
+			return fmt.Errorf("missing <source> file")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,367 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/manifestutil"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type GCCommand struct {
+	cli.BaseCommand
+	flags GCFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *GCCommand) Desc() string {
+	return "remove stale manifests and merge superseded ones"
+}
+
+func (c *GCCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] [<dir>...]
+
+The {{ COMMAND }} command cleans up the manifests in the .abc directories under
+each <dir> (default: the current directory), which pile up as templates are
+rendered again over the years:
+
+  - A manifest is removed if none of the files that it lists as outputs exist
+    anymore.
+  - When a destination has more than one manifest for the same
+    template_location, the newest one is kept and the others are merged into
+    it: their outputs that still exist, and that the newest one doesn't list,
+    are added to it, and its creation_time becomes the earliest one. Then the
+    others are removed.
+
+Outputs marked included_from_dest, which the template modified in place
+rather than created, belong to the user. They don't keep a manifest from
+being removed, and aren't added to the newest one when merging.
+  - A .abc directory that's empty afterward is removed.
+
+Manifests without a template_location, like those of templates rendered from a
+local directory outside of a git workspace, are never merged.
+
+Use --dry-run to list what would be done without changing anything. To remove
+stale lock files, use "abc templates clean".
+`
+}
+
+func (c *GCCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *GCCommand) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		cwd:    wd,
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// loadedManifest is a manifest file in a destination directory.
+type loadedManifest struct {
+	path string
+	m    *manifest.Manifest
+	buf  []byte
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *GCCommand) realRun(ctx context.Context, rp *runParams) error {
+	removeVerb, mergeVerb := "removed", "merged"
+	if c.flags.DryRun {
+		removeVerb, mergeVerb = "would remove", "would merge"
+	}
+
+	var count int
+	for _, dir := range c.flags.Dests {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(rp.cwd, dir)
+		}
+		paths, err := manifestutil.Find(rp.fs, dir)
+		if err != nil {
+			return err
+		}
+
+		// Group the manifests by destination directory, keeping the order
+		// of Find.
+		var dests []string
+		byDest := map[string][]*loadedManifest{}
+		for _, path := range paths {
+			m, buf, err := manifestutil.Load(ctx, rp.fs, path)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+			dest := manifestutil.DestDir(path)
+			if _, ok := byDest[dest]; !ok {
+				dests = append(dests, dest)
+			}
+			byDest[dest] = append(byDest[dest], &loadedManifest{path: path, m: m, buf: buf})
+		}
+
+		for _, dest := range dests {
+			kept, err := c.removeStale(rp, dest, byDest[dest], removeVerb, &count)
+			if err != nil {
+				return err
+			}
+			if err := c.mergeSuperseded(rp, dest, kept, mergeVerb, &count); err != nil {
+				return err
+			}
+			if err := c.removeEmptyInternalDir(rp, dest); err != nil {
+				return err
+			}
+		}
+	}
+
+	if count == 0 {
+		if _, err := fmt.Fprintln(rp.stdout, "no manifests need to be cleaned up"); err != nil {
+			return fmt.Errorf("failed writing output: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeStale removes the manifests in dest none of whose outputs exist, and
+// returns the others.
+func (c *GCCommand) removeStale(rp *runParams, dest string, lms []*loadedManifest, verb string, count *int) ([]*loadedManifest, error) {
+	var kept []*loadedManifest
+	for _, lm := range lms {
+		stale, err := allOutputsMissing(rp.fs, dest, lm.m)
+		if err != nil {
+			return nil, err
+		}
+		if !stale {
+			kept = append(kept, lm)
+			continue
+		}
+		*count++
+		if _, err := fmt.Fprintf(rp.stdout, "%s %s: none of its %d output files exist\n",
+			verb, displayPath(rp.cwd, lm.path), len(generatedOutputs(lm.m))); err != nil {
+			return nil, fmt.Errorf("failed writing output: %w", err)
+		}
+		if c.flags.DryRun {
+			continue
+		}
+		if err := rp.fs.RemoveAll(lm.path); err != nil {
+			return nil, fmt.Errorf("failed removing manifest: %w", err)
+		}
+	}
+	return kept, nil
+}
+
+// mergeSuperseded merges the manifests in dest that have the same template
+// location into the newest of them.
+func (c *GCCommand) mergeSuperseded(rp *runParams, dest string, lms []*loadedManifest, verb string, count *int) error {
+	var locations []string
+	byLocation := map[string][]*loadedManifest{}
+	for _, lm := range lms {
+		loc := lm.m.TemplateLocation.Val
+		if loc == "" {
+			continue
+		}
+		if _, ok := byLocation[loc]; !ok {
+			locations = append(locations, loc)
+		}
+		byLocation[loc] = append(byLocation[loc], lm)
+	}
+
+	for _, loc := range locations {
+		group := byLocation[loc]
+		if len(group) < 2 {
+			continue
+		}
+		// Newest first. The creation time is in the file name, so the path
+		// breaks ties.
+		sort.Slice(group, func(i, j int) bool {
+			ti, tj := group[i].m.ModificationTime, group[j].m.ModificationTime
+			if !ti.Equal(tj) {
+				return ti.After(tj)
+			}
+			return group[i].path > group[j].path
+		})
+		newest, older := group[0], group[1:]
+
+		out, err := mergeManifests(rp.fs, dest, newest, older)
+		if err != nil {
+			return fmt.Errorf("failed merging manifests into %q: %w", newest.path, err)
+		}
+		for _, lm := range older {
+			*count++
+			if _, err := fmt.Fprintf(rp.stdout, "%s %s into %s\n",
+				verb, displayPath(rp.cwd, lm.path), displayPath(rp.cwd, newest.path)); err != nil {
+				return fmt.Errorf("failed writing output: %w", err)
+			}
+		}
+		if c.flags.DryRun {
+			continue
+		}
+
+		// The merged manifest is written before the others are removed, so
+		// that nothing is lost if this is interrupted; running it again
+		// finishes the job.
+		if err := rp.fs.WriteFile(newest.path, out, common.OwnerRWPerms); err != nil {
+			return fmt.Errorf("failed writing manifest: %w", err)
+		}
+		for _, lm := range older {
+			if err := rp.fs.RemoveAll(lm.path); err != nil {
+				return fmt.Errorf("failed removing manifest: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// removeEmptyInternalDir removes the .abc directory of dest if there's
+// nothing left in it.
+func (c *GCCommand) removeEmptyInternalDir(rp *runParams, dest string) error {
+	if c.flags.DryRun {
+		return nil
+	}
+	dir := filepath.Join(dest, common.ABCInternalDir)
+	entries, err := fs.ReadDir(rp.fs, dir)
+	if err != nil {
+		return fmt.Errorf("ReadDir(): %w", err)
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+	if err := rp.fs.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed removing empty directory: %w", err)
+	}
+	return nil
+}
+
+// allOutputsMissing reports whether m lists generated outputs, and none of
+// them exist in dest.
+func allOutputsMissing(fsys common.FS, dest string, m *manifest.Manifest) (bool, error) {
+	outputs := generatedOutputs(m)
+	if len(outputs) == 0 {
+		return false, nil
+	}
+	for _, oh := range outputs {
+		ok, err := exists(fsys, dest, oh.File.Val)
+		if err != nil || ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// generatedOutputs returns the outputs of m that the template created, leaving
+// out those that it included from the destination.
+func generatedOutputs(m *manifest.Manifest) []*manifest.OutputHash {
+	var out []*manifest.OutputHash
+	for _, oh := range m.OutputHashes {
+		if !oh.IncludedFromDest.Val {
+			out = append(out, oh)
+		}
+	}
+	return out
+}
+
+// exists reports whether the output file at the slash-separated path rel in
+// dest exists. A dangling symlink exists.
+func exists(fsys common.FS, dest, rel string) (bool, error) {
+	path := filepath.Join(dest, filepath.FromSlash(rel))
+	stat := fsys.Stat
+	if sfs, ok := fsys.(common.SymlinkFS); ok {
+		stat = sfs.Lstat
+	}
+	if _, err := stat(path); err != nil {
+		if common.IsStatNotExistErr(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Stat(): %w", err)
+	}
+	return true, nil
+}
+
+// mergeManifests returns the YAML of newest with the generated outputs of
+// older added, if they still exist in dest and newest doesn't list them, and
+// with the earliest creation time of them all. The YAML is edited as a node tree, so
+// the rest of the manifest, including its header comment, is kept.
+func mergeManifests(fsys common.FS, dest string, newest *loadedManifest, older []*loadedManifest) ([]byte, error) {
+	outputs := append([]*manifest.OutputHash(nil), newest.m.OutputHashes...)
+	listed := map[string]struct{}{}
+	for _, oh := range outputs {
+		listed[oh.File.Val] = struct{}{}
+	}
+	created := newest.m.CreationTime
+	for _, lm := range older {
+		if lm.m.CreationTime.Before(created) {
+			created = lm.m.CreationTime
+		}
+		for _, oh := range generatedOutputs(lm.m) {
+			if _, ok := listed[oh.File.Val]; ok {
+				continue
+			}
+			ok, err := exists(fsys, dest, oh.File.Val)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				listed[oh.File.Val] = struct{}{}
+				outputs = append(outputs, oh)
+			}
+		}
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].File.Val < outputs[j].File.Val
+	})
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(newest.buf, &doc); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	createdNode, err := mappingValue(&doc, "creation_time")
+	if err != nil {
+		return nil, err
+	}
+	createdNode.Value = created.UTC().Format(time.RFC3339Nano)
+
+	outputsNode, err := mappingValue(&doc, "output_hashes")
+	if err != nil {
+		return nil, err
+	}
+	if err := outputsNode.Encode(outputs); err != nil {
+		return nil, fmt.Errorf("failed encoding output_hashes: %w", err)
+	}
+	return yaml.Marshal(&doc) //nolint:wrapcheck
+}
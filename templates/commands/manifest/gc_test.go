@@ -0,0 +1,209 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// gcManifest returns a manifest of a render at the given day in March 2024,
+// with the given outputs. An output with the prefix "dest:" is marked
+// included_from_dest.
+func gcManifest(location string, day int, files ...string) string {
+	var outputs strings.Builder
+	for _, f := range files {
+		f, fromDest := strings.CutPrefix(f, "dest:")
+		fmt.Fprintf(&outputs, "    - file: %s\n      hash: h1:ZmFrZV9vdXRwdXRfaGFzaF8zMl9ieXRlc19zaGEyNTY=\n", f)
+		if fromDest {
+			outputs.WriteString("      included_from_dest: true\n")
+		}
+	}
+	if len(files) == 0 {
+		outputs.WriteString("    []\n")
+	}
+	return fmt.Sprintf(`# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta4
+kind: Manifest
+creation_time: 2024-03-%02[2]dT12:00:00Z
+modification_time: 2024-03-%02[2]dT12:00:00Z
+template_location: %[1]s
+location_type: remote_git
+template_version: v1.0.%[2]d
+template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
+inputs:
+    - name: service
+      value: frontend
+output_hashes:
+%[3]s`, location, day, outputs.String())
+}
+
+func TestGCCommand(t *testing.T) {
+	t.Parallel()
+
+	const loc = "github.com/org/repo/t/service"
+	merged := strings.Replace(gcManifest(loc, 3, "a.txt", "b.txt", "old.txt"),
+		"creation_time: 2024-03-03", "creation_time: 2024-03-01", 1)
+
+	initial := map[string]string{
+		// Rendered three times; the first two are superseded.
+		"svc/.abc/manifest_1.lock.yaml": gcManifest(loc, 1, "a.txt", "old.txt", "gone.txt", "dest:mine.txt"),
+		"svc/.abc/manifest_2.lock.yaml": gcManifest(loc, 2, "a.txt"),
+		"svc/.abc/manifest_3.lock.yaml": gcManifest(loc, 3, "a.txt", "b.txt"),
+		"svc/.abc/protect.yaml":         "paths: ['infra']\n",
+		"svc/a.txt":                     "a",
+		"svc/b.txt":                     "b",
+		"svc/old.txt":                   "left by the first render",
+		"svc/mine.txt":                  "the user's",
+
+		// All of its outputs were deleted.
+		"stale/.abc/manifest_1.lock.yaml": gcManifest(loc, 1, "x.txt", "y.txt"),
+		"stale/README.md":                 "hello",
+
+		// Only a file that the template modified in place is left, which
+		// belongs to the user.
+		"dest/.abc/manifest_1.lock.yaml": gcManifest(loc, 1, "dest:go.mod", "gen.txt"),
+		"dest/go.mod":                    "module example.com/mine",
+
+		// Different templates in the same destination aren't merged.
+		"two/.abc/manifest_1.lock.yaml": gcManifest(loc, 1, "a.txt"),
+		"two/.abc/manifest_2.lock.yaml": gcManifest("github.com/org/other", 2, "b.txt"),
+		"two/a.txt":                     "a",
+		"two/b.txt":                     "b",
+
+		// A manifest without outputs isn't stale.
+		"empty/.abc/manifest_1.lock.yaml": gcManifest(loc, 1),
+	}
+
+	cases := []struct {
+		name       string
+		args       []string
+		want       map[string]string
+		wantStdout string
+		// wantRemovedDirs are directories that must not exist afterward,
+		// which want can't say since it only has files.
+		wantRemovedDirs []string
+	}{
+		{
+			name: "cleans_up",
+			want: map[string]string{
+				"svc/.abc/manifest_3.lock.yaml":   merged,
+				"svc/.abc/protect.yaml":           "paths: ['infra']\n",
+				"svc/a.txt":                       "a",
+				"svc/b.txt":                       "b",
+				"svc/old.txt":                     "left by the first render",
+				"svc/mine.txt":                    "the user's",
+				"stale/README.md":                 "hello",
+				"dest/go.mod":                     "module example.com/mine",
+				"two/.abc/manifest_1.lock.yaml":   initial["two/.abc/manifest_1.lock.yaml"],
+				"two/.abc/manifest_2.lock.yaml":   initial["two/.abc/manifest_2.lock.yaml"],
+				"two/a.txt":                       "a",
+				"two/b.txt":                       "b",
+				"empty/.abc/manifest_1.lock.yaml": initial["empty/.abc/manifest_1.lock.yaml"],
+			},
+			wantStdout: "removed dest/.abc/manifest_1.lock.yaml: none of its 1 output files exist\n" +
+				"removed stale/.abc/manifest_1.lock.yaml: none of its 2 output files exist\n" +
+				"merged svc/.abc/manifest_2.lock.yaml into svc/.abc/manifest_3.lock.yaml\n" +
+				"merged svc/.abc/manifest_1.lock.yaml into svc/.abc/manifest_3.lock.yaml\n",
+			wantRemovedDirs: []string{"dest/.abc", "stale/.abc"},
+		},
+		{
+			name: "dry_run",
+			args: []string{"--dry-run"},
+			want: initial,
+			wantStdout: "would remove dest/.abc/manifest_1.lock.yaml: none of its 1 output files exist\n" +
+				"would remove stale/.abc/manifest_1.lock.yaml: none of its 2 output files exist\n" +
+				"would merge svc/.abc/manifest_2.lock.yaml into svc/.abc/manifest_3.lock.yaml\n" +
+				"would merge svc/.abc/manifest_1.lock.yaml into svc/.abc/manifest_3.lock.yaml\n",
+		},
+		{
+			name:       "nothing_to_do",
+			args:       []string{"two", "empty"},
+			want:       initial,
+			wantStdout: "no manifests need to be cleaned up\n",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tempDir, initial)
+
+			ctx := context.Background()
+			cmd := &GCCommand{}
+			if err := cmd.Flags().Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			var stdout bytes.Buffer
+			if err := cmd.realRun(ctx, &runParams{
+				cwd:    tempDir,
+				fs:     &common.RealFS{},
+				stdout: &stdout,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if got := stdout.String(); got != tc.wantStdout {
+				t.Errorf("got stdout:\n%s\nwant:\n%s", got, tc.wantStdout)
+			}
+
+			got := abctestutil.LoadDirWithoutMode(t, tempDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("directory contents were not as expected (-got,+want): %s", diff)
+			}
+			for _, dir := range tc.wantRemovedDirs {
+				if _, err := os.Stat(filepath.Join(tempDir, dir)); !os.IsNotExist(err) {
+					t.Errorf("the directory %q wasn't removed", dir)
+				}
+			}
+		})
+	}
+}
+
+func TestGCCommand_InvalidManifest(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		".abc/manifest_x.lock.yaml": "kind: Manifest\nbogus: true\n",
+	})
+
+	cmd := &GCCommand{}
+	if err := cmd.Flags().Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	err := cmd.realRun(context.Background(), &runParams{
+		cwd:    tempDir,
+		fs:     &common.RealFS{},
+		stdout: &bytes.Buffer{},
+	})
+	if diff := testutil.DiffErrString(err, "error reading manifest file"); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest implements the subcommands for working with the manifests
+// that renders leave in destination directories.
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/manifestutil"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type RewriteSourceCommand struct {
+	cli.BaseCommand
+	flags RewriteSourceFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *RewriteSourceCommand) Desc() string {
+	return "change the template location in manifests after a template moves"
+}
+
+func (c *RewriteSourceCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] --from=<old location> --to=<new location> [<dir>...]
+
+The {{ COMMAND }} command updates the manifests in the .abc directories under
+each <dir> (default: the current directory) when the templates they were
+rendered from have moved, like to another git repo, so that future upgrades
+fetch the templates from their new home without rendering them again.
+
+A manifest is rewritten if its template_location is the --from location, or
+is in a subdirectory of it; the --from part is replaced with --to. For example,
+with --from=github.com/old/repo --to=github.com/new/repo, the location
+github.com/old/repo/t/service becomes github.com/new/repo/t/service. The
+manifest file is renamed to match. Nothing else in it changes.
+
+Use --dry-run to list the manifests that would be rewritten.
+`
+}
+
+func (c *RewriteSourceCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type runParams struct {
+	// clock is only used by adopt, for the times in the new manifest.
+	clock  clock.Clock
+	cwd    string
+	fs     common.FS
+	stdout io.Writer
+}
+
+func (c *RewriteSourceCommand) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		cwd:    wd,
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *RewriteSourceCommand) realRun(ctx context.Context, rp *runParams) error {
+	verb := "rewrote"
+	if c.flags.DryRun {
+		verb = "would rewrite"
+	}
+
+	var count int
+	for _, dest := range c.flags.Dests {
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(rp.cwd, dest)
+		}
+		paths, err := manifestutil.Find(rp.fs, dest)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			oldLoc, newLoc, newPath, err := c.rewriteOne(ctx, rp.fs, path)
+			if err != nil {
+				return err
+			}
+			if newLoc == "" {
+				continue
+			}
+			count++
+			if _, err := fmt.Fprintf(rp.stdout, "%s %s: %s -> %s\n", verb, displayPath(rp.cwd, newPath), oldLoc, newLoc); err != nil {
+				return fmt.Errorf("failed writing output: %w", err)
+			}
+		}
+	}
+
+	if count == 0 {
+		if _, err := fmt.Fprintf(rp.stdout, "no manifests have a template_location in %s\n", c.flags.From); err != nil {
+			return fmt.Errorf("failed writing output: %w", err)
+		}
+	}
+	return nil
+}
+
+// rewriteOne rewrites the template location of the manifest at path, if it's
+// in the --from location. It returns the old and new locations, and the new
+// path of the manifest, which is renamed if its name contains the old
+// location. newLoc is empty if the manifest wasn't rewritten.
+func (c *RewriteSourceCommand) rewriteOne(ctx context.Context, fsys common.FS, path string) (oldLoc, newLoc, newPath string, _ error) {
+	m, buf, err := manifestutil.Load(ctx, fsys, path)
+	if err != nil {
+		return "", "", "", err //nolint:wrapcheck
+	}
+
+	oldLoc = m.TemplateLocation.Val
+	newLoc, ok := rewriteLocation(oldLoc, c.flags.From, c.flags.To)
+	if !ok {
+		return "", "", "", nil
+	}
+
+	newPath = path
+	oldNamePart, newNamePart := "_"+url.PathEscape(oldLoc)+"_", "_"+url.PathEscape(newLoc)+"_"
+	if name := filepath.Base(path); strings.Contains(name, oldNamePart) {
+		newPath = filepath.Join(filepath.Dir(path), strings.Replace(name, oldNamePart, newNamePart, 1))
+		if _, err := fsys.Stat(newPath); err == nil {
+			return "", "", "", fmt.Errorf("can't rename manifest %q to %q, which already exists", path, newPath)
+		}
+	}
+	if c.flags.DryRun {
+		return oldLoc, newLoc, newPath, nil
+	}
+
+	out, err := setTemplateLocation(buf, newLoc)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed rewriting manifest %q: %w", path, err)
+	}
+	if err := fsys.WriteFile(path, out, common.OwnerRWPerms); err != nil {
+		return "", "", "", fmt.Errorf("failed writing manifest: %w", err)
+	}
+	if newPath != path {
+		if err := fsys.Rename(path, newPath); err != nil {
+			return "", "", "", fmt.Errorf("failed renaming manifest: %w", err)
+		}
+	}
+	return oldLoc, newLoc, newPath, nil
+}
+
+// rewriteLocation replaces the from prefix of loc with to, if loc is from or
+// is in a subdirectory of it.
+func rewriteLocation(loc, from, to string) (string, bool) {
+	if loc == from {
+		return to, true
+	}
+	if rest, ok := strings.CutPrefix(loc, from+"/"); ok {
+		return to + "/" + rest, true
+	}
+	return "", false
+}
+
+// setTemplateLocation returns the manifest YAML in buf with its
+// template_location set to loc. The YAML is edited as a node tree, so the
+// rest of the manifest, including its header comment, is kept.
+func setTemplateLocation(buf []byte, loc string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	node, err := mappingValue(&doc, "template_location")
+	if err != nil {
+		return nil, err
+	}
+	node.Value = loc
+	return yaml.Marshal(&doc) //nolint:wrapcheck
+}
+
+// mappingValue returns the node of the value of the field named key in the
+// manifest doc.
+func mappingValue(doc *yaml.Node, key string) (*yaml.Node, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the manifest isn't a YAML mapping")
+	}
+	fields := doc.Content[0].Content
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i].Value == key {
+			return fields[i+1], nil
+		}
+	}
+	return nil, fmt.Errorf("the manifest has no %s", key)
+}
+
+// displayPath returns path relative to cwd if it's inside it, and otherwise
+// path itself.
+func displayPath(cwd, path string) string {
+	rel, err := filepath.Rel(cwd, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// testManifest is a manifest with the template location LOCATION.
+const testManifest = `# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta4
+kind: Manifest
+creation_time: 2024-03-10T12:00:00Z
+modification_time: 2024-03-10T12:00:00Z
+template_location: LOCATION
+location_type: remote_git
+template_version: 5f1e6a4
+template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
+inputs:
+    - name: service
+      value: frontend
+output_hashes:
+    - file: a.txt
+      hash: h1:ZmFrZV9vdXRwdXRfaGFzaF8zMl9ieXRlc19zaGEyNTY=
+`
+
+func manifestFile(location string) (string, string) {
+	name := ".abc/manifest_" + url.PathEscape(location) + "_2024-03-10T12:00:00Z.lock.yaml"
+	return name, strings.Replace(testManifest, "LOCATION", location, 1)
+}
+
+func TestRewriteSourceCommand(t *testing.T) {
+	t.Parallel()
+
+	moved1, moved1Contents := manifestFile("github.com/old/repo/t/service")
+	moved2, moved2Contents := manifestFile("github.com/old/repo")
+	other, otherContents := manifestFile("github.com/old/repository/t/service")
+	newMoved1, newMoved1Contents := manifestFile("github.com/new/repo/t/service")
+	newMoved2, newMoved2Contents := manifestFile("github.com/new/repo")
+
+	initial := map[string]string{
+		"svc/" + moved1:   moved1Contents,
+		"svc/main.go":     "package main",
+		"root/" + moved2:  moved2Contents,
+		"other/" + other:  otherContents,
+		".git/" + moved1:  moved1Contents, // not searched
+		"README.md":       "hello",
+		"svc/.abc/.lock":  "not a manifest",
+		"svc/.abc/x.yaml": "not a manifest",
+	}
+
+	cases := []struct {
+		name       string
+		args       []string
+		want       map[string]string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name: "rewrites_matching_manifests",
+			args: []string{"--from=github.com/old/repo", "--to=github.com/new/repo/"},
+			want: map[string]string{
+				"svc/" + newMoved1:  newMoved1Contents,
+				"svc/main.go":       "package main",
+				"root/" + newMoved2: newMoved2Contents,
+				"other/" + other:    otherContents,
+				".git/" + moved1:    moved1Contents,
+				"README.md":         "hello",
+				"svc/.abc/.lock":    "not a manifest",
+				"svc/.abc/x.yaml":   "not a manifest",
+			},
+			wantStdout: "rewrote root/" + newMoved2 + ": github.com/old/repo -> github.com/new/repo\n" +
+				"rewrote svc/" + newMoved1 + ": github.com/old/repo/t/service -> github.com/new/repo/t/service\n",
+		},
+		{
+			name: "only_one_dir",
+			args: []string{"--from=github.com/old/repo", "--to=github.com/new/repo", "svc"},
+			want: map[string]string{
+				"svc/" + newMoved1: newMoved1Contents,
+				"svc/main.go":      "package main",
+				"root/" + moved2:   moved2Contents,
+				"other/" + other:   otherContents,
+				".git/" + moved1:   moved1Contents,
+				"README.md":        "hello",
+				"svc/.abc/.lock":   "not a manifest",
+				"svc/.abc/x.yaml":  "not a manifest",
+			},
+			wantStdout: "rewrote svc/" + newMoved1 + ": github.com/old/repo/t/service -> github.com/new/repo/t/service\n",
+		},
+		{
+			name:       "dry_run",
+			args:       []string{"--from=github.com/old/repo", "--to=github.com/new/repo", "--dry-run", "svc"},
+			want:       initial,
+			wantStdout: "would rewrite svc/" + newMoved1 + ": github.com/old/repo/t/service -> github.com/new/repo/t/service\n",
+		},
+		{
+			name:       "no_matches",
+			args:       []string{"--from=github.com/nobody/repo", "--to=github.com/new/repo"},
+			want:       initial,
+			wantStdout: "no manifests have a template_location in github.com/nobody/repo\n",
+		},
+		{
+			name:    "missing_to",
+			args:    []string{"--from=github.com/old/repo"},
+			want:    initial,
+			wantErr: "missing --to",
+		},
+		{
+			name:    "same_from_and_to",
+			args:    []string{"--from=github.com/old/repo", "--to=github.com/old/repo/"},
+			want:    initial,
+			wantErr: "--from and --to must be different",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tempDir, initial)
+
+			ctx := context.Background()
+			cmd := &RewriteSourceCommand{}
+			err := cmd.Flags().Parse(tc.args)
+			if err == nil {
+				var stdout bytes.Buffer
+				err = cmd.realRun(ctx, &runParams{
+					cwd:    tempDir,
+					fs:     &common.RealFS{},
+					stdout: &stdout,
+				})
+				if got := stdout.String(); got != tc.wantStdout {
+					t.Errorf("got stdout:\n%s\nwant:\n%s", got, tc.wantStdout)
+				}
+			}
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			got := abctestutil.LoadDirWithoutMode(t, tempDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("directory contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRewriteSourceCommand_InvalidManifest(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		".abc/manifest_x.lock.yaml": "kind: Manifest\nbogus: true\n",
+	})
+
+	cmd := &RewriteSourceCommand{}
+	if err := cmd.Flags().Parse([]string{"--from=a", "--to=b"}); err != nil {
+		t.Fatal(err)
+	}
+	err := cmd.realRun(context.Background(), &runParams{
+		cwd:    tempDir,
+		fs:     &common.RealFS{},
+		stdout: &bytes.Buffer{},
+	})
+	if diff := testutil.DiffErrString(err, "error reading manifest file"); diff != "" {
+		t.Error(diff)
+	}
+}
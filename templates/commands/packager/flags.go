@@ -0,0 +1,168 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packager
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+	"golang.org/x/mod/semver"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+const (
+	formatTarGzip = "tar.gz"
+	formatTar     = "tar"
+	formatZip     = "zip"
+	formatOCI     = "oci"
+)
+
+// formats is the list of every supported package format, with the default
+// first.
+var formats = []string{formatTarGzip, formatTar, formatZip, formatOCI}
+
+// PackageFlags describes what template to package and where to write it.
+type PackageFlags struct {
+	// Source is the location of the template to package.
+	//
+	// Example: ./my-template
+	Source string
+
+	// Output is the path of the package file to create.
+	Output string
+
+	// Format is one of the formats in the formats list.
+	Format string
+
+	// GitProtocol either https or ssh.
+	GitProtocol string
+}
+
+func (r *PackageFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("PACKAGE OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Example: "my-template.tar.gz",
+		Target:  &r.Output,
+		Predict: predict.Files("*"),
+		Usage:   "The path of the package file to create. An existing file is overwritten.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "format",
+		Example: "oci",
+		Target:  &r.Format,
+		Default: formatTarGzip,
+		Predict: predict.Set(formats),
+		Usage: fmt.Sprintf(`The format of the package, one of %s. "oci" is an OCI image in the tar form of the OCI image layout, `+
+			`which can be pushed to a container registry.`, strings.Join(formats, ", ")),
+	})
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	// Default source to the first CLI argument, if given
+	set.AfterParse(func(existingErr error) error {
+		r.Source = strings.TrimSpace(set.Arg(0))
+		if r.Source == "" {
+			return fmt.Errorf("missing <source> file")
+		}
+
+		if r.Output == "" {
+			return fmt.Errorf("missing --output")
+		}
+
+		if !slices.Contains(formats, r.Format) {
+			return fmt.Errorf("--format must be one of %s, but got %q", strings.Join(formats, ", "), r.Format)
+		}
+
+		return nil
+	})
+}
+
+// PublishFlags describes what template to publish and where.
+type PublishFlags struct {
+	// Location is the local directory of the template to publish.
+	//
+	// Example: t/rest_server
+	Location string
+
+	// Repository is the OCI repository to push to, including the registry.
+	//
+	// Example: ghcr.io/my-org/rest-server-template
+	Repository string
+
+	// Tag is the version to publish, which must not already exist.
+	//
+	// Example: v1.2.3
+	Tag string
+
+	// PlainHTTP connects to the registry without TLS, for local registries.
+	PlainHTTP bool
+}
+
+func (r *PublishFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("PUBLISH OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "repository",
+		Aliases: []string{"r"},
+		Example: "ghcr.io/my-org/my-template",
+		EnvVar:  "ABC_PUBLISH_REPOSITORY",
+		Target:  &r.Repository,
+		Usage:   "The OCI repository to push the template to, including the registry host.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "tag",
+		Example: "v1.2.3",
+		Target:  &r.Tag,
+		Usage:   "The version to publish, which must be a semantic version like v1.2.3 that isn't already in the repository.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "plain-http",
+		Default: false,
+		Target:  &r.PlainHTTP,
+		Usage:   "Connect to the registry over plain HTTP instead of HTTPS. Only for local test registries.",
+	})
+
+	// Default template location to the first CLI argument, if given.
+	// If not given, default to current directory.
+	set.AfterParse(func(existingErr error) error {
+		r.Location = strings.TrimSpace(set.Arg(0))
+		if r.Location == "" {
+			r.Location = "."
+		}
+
+		if r.Repository == "" {
+			return fmt.Errorf("missing --repository")
+		}
+		if r.Tag == "" {
+			return fmt.Errorf("missing --tag")
+		}
+		if semver.Canonical(r.Tag) != r.Tag {
+			return fmt.Errorf("--tag must be a semantic version like v1.2.3, but got %q", r.Tag)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package packager implements the "templates package" subcommand, which
+// bundles a template into a single distributable file, and the "templates
+// publish" subcommand, which pushes that bundle to a container registry.
+package packager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// Annotations set on the manifest of an OCI template image.
+const (
+	annotationDirhash     = "dev.abcxyz.abc.template.dirhash"
+	annotationDescription = "org.opencontainers.image.description"
+	annotationSource      = "org.opencontainers.image.source"
+	annotationVersion     = "org.opencontainers.image.version"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags PackageFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "bundle a template into a single file for distribution"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] --output <file> <source>
+
+The {{ COMMAND }} command bundles the template at <source> into a single file,
+which can be stored anywhere that templates can be downloaded from, like a
+cloud storage bucket.
+
+The package contains everything in the template directory: the spec.yaml, the
+template's files, and its golden tests. The template's dirhash is printed, and
+is the same as the template_dirhash recorded in the manifest when the package
+is rendered, so it can be used to check that a rendered template came from this
+package. The SHA-256 digest of the package file itself is printed too.
+
+The "<source>" is the location of the template, in any of the forms accepted by
+"abc templates render", like a local directory or
+github.com/abcxyz/abc/t/rest_server@latest.
+
+The --format is one of:
+
+- tar.gz (the default): a gzip-compressed tar archive
+- tar: an uncompressed tar archive
+- zip: a zip archive
+- oci: an OCI image in the tar form of the OCI image layout. The template is
+    the image's only layer, and the dirhash is recorded in the
+    "dev.abcxyz.abc.template.dirhash" annotation of the image manifest. Push it
+    with a tool like "oras cp --from-oci-layout" or "skopeo copy oci-archive:".
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type runParams struct {
+	fs     common.FS
+	stdout io.Writer
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	return c.realRun(ctx, &runParams{
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
+	logger := logging.FromContext(ctx).With("logger", "realRun")
+
+	tempTracker := tempdir.NewDirTracker(rp.fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	tpl, err := prepareTemplate(ctx, rp.fs, tempTracker, c.flags.Source, c.flags.GitProtocol)
+	if err != nil {
+		return err
+	}
+
+	digest, err := writePackage(ctx, rp.fs, c.flags.Format, tpl.dir, c.flags.Output, tpl.annotations)
+	if err != nil {
+		return err
+	}
+
+	logger.DebugContext(ctx, "wrote template package",
+		"source", c.flags.Source,
+		"output", c.flags.Output,
+		"format", c.flags.Format)
+
+	fmt.Fprintf(rp.stdout, "wrote %s\ndirhash: %s\nsha256: %s\n", c.flags.Output, tpl.dirhash, digest)
+	return nil
+}
+
+// preparedTemplate is a downloaded template that's ready to be packaged.
+type preparedTemplate struct {
+	// dir is a temp directory containing the template.
+	dir string
+
+	// dirhash is the hash of dir that's recorded in manifests.
+	dirhash string
+
+	// annotations are the annotations for the manifest of an OCI image of
+	// the template.
+	annotations map[string]string
+}
+
+// prepareTemplate downloads the template at source into a temp directory
+// tracked by tempTracker, and checks that its spec is valid.
+func prepareTemplate(ctx context.Context, fs common.FS, tempTracker *tempdir.DirTracker, source, gitProtocol string) (*preparedTemplate, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("os.Getwd(): %w", err)
+	}
+
+	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory to use as template directory: %w", err)
+	}
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:         cwd,
+		Source:      source,
+		GitProtocol: gitProtocol,
+		FS:          fs,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	dlMeta, err := downloader.Download(ctx, cwd, templateDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download/copy template: %w", err)
+	}
+
+	// Don't package something that can't be rendered.
+	spec, err := specutil.Load(ctx, fs, templateDir, source)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	dirhash, err := common.HashTemplateDir(ctx, templateDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed hashing template directory: %w", err)
+	}
+
+	annotations := map[string]string{
+		annotationDirhash:     dirhash,
+		annotationDescription: spec.Desc.Val,
+	}
+	if dlMeta.IsCanonical {
+		annotations[annotationSource] = dlMeta.CanonicalSource
+	}
+	if dlMeta.HasVersion {
+		annotations[annotationVersion] = dlMeta.Version
+	}
+
+	return &preparedTemplate{
+		dir:         templateDir,
+		dirhash:     dirhash,
+		annotations: annotations,
+	}, nil
+}
+
+// writePackage writes the contents of srcDir to the file at dest in the given
+// format, and returns the hex SHA-256 digest of the file.
+func writePackage(ctx context.Context, fs common.FS, format, srcDir, dest string, annotations map[string]string) (_ string, rErr error) {
+	if err := fs.MkdirAll(filepath.Dir(dest), common.OwnerRWXPerms); err != nil {
+		return "", fmt.Errorf("MkdirAll(): %w", err)
+	}
+	f, err := fs.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, common.OwnerRWPerms)
+	if err != nil {
+		return "", fmt.Errorf("OpenFile(): %w", err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, f.Close())
+	}()
+
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+	switch format {
+	case formatTarGzip:
+		err = archive.WriteTarGzip(ctx, fs, srcDir, w)
+	case formatTar:
+		err = archive.WriteTar(ctx, fs, srcDir, w)
+	case formatZip:
+		err = archive.WriteZip(ctx, fs, srcDir, w)
+	case formatOCI:
+		err = archive.WriteOCILayout(ctx, fs, srcDir, annotations, w)
+	default:
+		err = fmt.Errorf("unknown package format %q", format)
+	}
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,273 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestPackageFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    PackageFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--output", "out.zip",
+				"--format", "zip",
+				"--git-protocol", "ssh",
+				"helloworld@v1",
+			},
+			want: PackageFlags{
+				Source:      "helloworld@v1",
+				Output:      "out.zip",
+				Format:      "zip",
+				GitProtocol: "ssh",
+			},
+		},
+		{
+			name: "defaults",
+			args: []string{"-o", "out.tar.gz", "helloworld@v1"},
+			want: PackageFlags{
+				Source:      "helloworld@v1",
+				Output:      "out.tar.gz",
+				Format:      "tar.gz",
+				GitProtocol: "https",
+			},
+		},
+		{
+			name:    "required_source_is_missing",
+			args:    []string{"--output", "out.tar.gz"},
+			wantErr: "missing <source> file",
+		},
+		{
+			name:    "required_output_is_missing",
+			args:    []string{"helloworld@v1"},
+			wantErr: "missing --output",
+		},
+		{
+			name:    "bad_format",
+			args:    []string{"--output", "out.rar", "--format", "rar", "helloworld@v1"},
+			wantErr: `--format must be one of tar.gz, tar, zip, oci, but got "rar"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd Command
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template for testing'
+steps:
+  - desc: 'Include some files'
+    action: 'include'
+    params:
+      paths: ['hello.txt']
+`
+	templateFiles := map[string]string{
+		"spec.yaml":                           specContents,
+		"hello.txt":                           "hello",
+		"testdata/golden/test/test.yaml":      "api_version: 'cli.abcxyz.dev/v1beta4'\nkind: 'GoldenTest'\n",
+		"testdata/golden/test/data/hello.txt": "hello",
+	}
+
+	cases := []struct {
+		name    string
+		format  string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:   "tar_gz",
+			format: formatTarGzip,
+			files:  templateFiles,
+		},
+		{
+			name:   "tar",
+			format: formatTar,
+			files:  templateFiles,
+		},
+		{
+			name:   "zip",
+			format: formatZip,
+			files:  templateFiles,
+		},
+		{
+			name:   "oci",
+			format: formatOCI,
+			files:  templateFiles,
+		},
+		{
+			name:   "invalid_spec",
+			format: formatTarGzip,
+			files: map[string]string{
+				"spec.yaml": "this is not a spec",
+			},
+			wantErr: "error reading template spec file",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			tempDir := t.TempDir()
+			templateDir := filepath.Join(tempDir, "template")
+			abctestutil.WriteAllDefaultMode(t, templateDir, tc.files)
+			output := filepath.Join(tempDir, "out", "my-template."+tc.format)
+
+			cmd := &Command{
+				flags: PackageFlags{
+					Source: templateDir,
+					Output: output,
+					Format: tc.format,
+				},
+			}
+			stdout := &strings.Builder{}
+			err := cmd.realRun(ctx, &runParams{
+				fs:     &common.RealFS{},
+				stdout: stdout,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			wantDirhash, err := common.HashTemplateDir(ctx, templateDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantStdout := fmt.Sprintf("wrote %s\ndirhash: %s\nsha256: ", output, wantDirhash)
+			if !strings.HasPrefix(stdout.String(), wantStdout) {
+				t.Errorf("got stdout %q, want it to start with %q", stdout.String(), wantStdout)
+			}
+
+			archiveName := output
+			if tc.format == formatOCI {
+				var gotDirhash string
+				buf, gotDirhash = readOCILayer(t, buf)
+				if gotDirhash != wantDirhash {
+					t.Errorf("got dirhash annotation %q, want %q", gotDirhash, wantDirhash)
+				}
+				archiveName = "template.tar.gz"
+			}
+			extractDir := t.TempDir()
+			if err := archive.Extract(ctx, &common.RealFS{}, archiveName, buf, extractDir); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, extractDir), tc.files); diff != "" {
+				t.Errorf("package contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+// readOCILayer follows the index and manifest of an OCI image layout tar to
+// its single layer, and returns the layer and the dirhash annotation.
+func readOCILayer(t *testing.T, buf []byte) ([]byte, string) {
+	t.Helper()
+
+	layout := abctestutil.ReadTar(t, bytes.NewReader(buf))
+	blob := func(digest string) []byte {
+		t.Helper()
+		f, ok := layout["blobs/sha256/"+strings.TrimPrefix(digest, "sha256:")]
+		if !ok {
+			t.Fatalf("OCI layout has no blob %q", digest)
+		}
+		return []byte(f.Contents)
+	}
+
+	var index struct {
+		Manifests []struct {
+			Digest       string `json:"digest"`
+			ArtifactType string `json:"artifactType"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal([]byte(layout["index.json"].Contents), &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].ArtifactType != archive.MediaTypeTemplate {
+		t.Fatalf("got index %+v, want one template manifest", index)
+	}
+
+	var manifest struct {
+		Layers []struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"layers"`
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(blob(index.Manifests[0].Digest), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Layers) != 1 || manifest.Layers[0].MediaType != archive.MediaTypeTemplateLayer {
+		t.Fatalf("got manifest %+v, want one template layer", manifest)
+	}
+	return blob(manifest.Layers[0].Digest), manifest.Annotations[annotationDirhash]
+}
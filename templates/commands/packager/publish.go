@@ -0,0 +1,171 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/commands/goldentest"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
+	"github.com/abcxyz/abc/templates/common/ociregistry"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+type PublishCommand struct {
+	cli.BaseCommand
+	flags PublishFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *PublishCommand) Desc() string {
+	return "validate a template and push a new version of it to a container registry"
+}
+
+func (c *PublishCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] --repository <repository> --tag <version> [<location>]
+
+The {{ COMMAND }} command releases a new version of the template in the local
+directory <location>, which defaults to the current directory. It:
+
+  1. checks that the spec file is valid,
+  2. runs the template's golden tests, like "abc templates golden-test verify",
+  3. checks that the --tag doesn't already exist in the --repository, since
+     published versions must never change, and
+  4. pushes the template to the --repository as an OCI image, like
+     "abc templates package --format=oci" would create, tagged with --tag.
+
+If any step fails, nothing is pushed.
+
+The --repository includes the registry host, like ghcr.io/my-org/my-template.
+It can also be set with the ABC_PUBLISH_REPOSITORY environment variable. If the
+registry requires authentication, the credentials are read from the
+ABC_REGISTRY_USERNAME and ABC_REGISTRY_PASSWORD environment variables.
+`
+}
+
+func (c *PublishCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type publishParams struct {
+	fs     common.FS
+	stdout io.Writer
+	stderr io.Writer
+
+	// registryClient is the client for the --repository's registry.
+	registryClient *ociregistry.Client
+}
+
+func (c *PublishCommand) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	username, _ := c.LookupEnv("ABC_REGISTRY_USERNAME")
+	password, _ := c.LookupEnv("ABC_REGISTRY_PASSWORD")
+	return c.realRun(ctx, &publishParams{
+		fs:     fSys,
+		stdout: c.Stdout(),
+		stderr: c.Stderr(),
+		registryClient: ociregistry.NewClient(&ociregistry.ClientParams{
+			Username:  username,
+			Password:  password,
+			PlainHTTP: c.flags.PlainHTTP,
+		}),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *PublishCommand) realRun(ctx context.Context, rp *publishParams) (rErr error) {
+	logger := logging.FromContext(ctx).With("logger", "realRun")
+
+	repo, err := ociregistry.ParseRepository(c.flags.Repository)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	tempTracker := tempdir.NewDirTracker(rp.fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	tpl, err := prepareTemplate(ctx, rp.fs, tempTracker, c.flags.Location, "")
+	if err != nil {
+		return err
+	}
+
+	if err := c.verifyGoldenTests(ctx, rp); err != nil {
+		return err
+	}
+
+	exists, err := rp.registryClient.TagExists(ctx, repo, c.flags.Tag)
+	if err != nil {
+		return fmt.Errorf("failed checking whether %s:%s already exists: %w", repo, c.flags.Tag, err)
+	}
+	if exists {
+		return fmt.Errorf("the version %s:%s was already published; published versions must not change, so choose a new --tag", repo, c.flags.Tag)
+	}
+
+	tpl.annotations[annotationVersion] = c.flags.Tag
+	img, err := archive.BuildOCIImage(ctx, rp.fs, tpl.dir, tpl.annotations)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if err := rp.registryClient.Push(ctx, repo, c.flags.Tag, img); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	logger.DebugContext(ctx, "published template",
+		"location", c.flags.Location,
+		"repository", repo.String(),
+		"tag", c.flags.Tag)
+
+	fmt.Fprintf(rp.stdout, "published %s:%s\ndigest: %s\ndirhash: %s\n", repo, c.flags.Tag, img.Manifest.Digest, tpl.dirhash)
+	return nil
+}
+
+// verifyGoldenTests runs "golden-test verify" on the template, with its report
+// going to stderr so that stdout only describes what was published. A template
+// without golden tests is published with a warning.
+func (c *PublishCommand) verifyGoldenTests(ctx context.Context, rp *publishParams) error {
+	goldenDir := filepath.Join(c.flags.Location, "testdata", "golden")
+	if _, err := rp.fs.Stat(goldenDir); err != nil {
+		if common.IsStatNotExistErr(err) {
+			fmt.Fprintf(rp.stderr, "warning: the template has no golden tests in %s, so only its spec file was checked\n", goldenDir)
+			return nil
+		}
+		return fmt.Errorf("Stat(%s): %w", goldenDir, err)
+	}
+
+	verify := &goldentest.VerifyCommand{}
+	verify.SetStdout(rp.stderr)
+	verify.SetLookupEnv(c.LookupEnv)
+	if err := verify.Run(ctx, []string{c.flags.Location}); err != nil {
+		return fmt.Errorf("not publishing, because the golden tests failed: %w", err)
+	}
+	return nil
+}
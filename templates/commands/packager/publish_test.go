@@ -0,0 +1,258 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packager
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
+	"github.com/abcxyz/abc/templates/common/ociregistry"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestPublishFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    PublishFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--repository", "ghcr.io/my-org/my-template",
+				"--tag", "v1.2.3",
+				"--plain-http",
+				"t/my-template",
+			},
+			want: PublishFlags{
+				Location:   "t/my-template",
+				Repository: "ghcr.io/my-org/my-template",
+				Tag:        "v1.2.3",
+				PlainHTTP:  true,
+			},
+		},
+		{
+			name: "defaults",
+			args: []string{"--tag", "v1.2.3-rc.1"},
+			env:  map[string]string{"ABC_PUBLISH_REPOSITORY": "ghcr.io/my-org/my-template"},
+			want: PublishFlags{
+				Location:   ".",
+				Repository: "ghcr.io/my-org/my-template",
+				Tag:        "v1.2.3-rc.1",
+			},
+		},
+		{
+			name:    "missing_repository",
+			args:    []string{"--tag", "v1.2.3"},
+			wantErr: "missing --repository",
+		},
+		{
+			name:    "missing_tag",
+			args:    []string{"--repository", "ghcr.io/my-org/my-template"},
+			wantErr: "missing --tag",
+		},
+		{
+			name:    "tag_not_semver",
+			args:    []string{"--repository", "ghcr.io/my-org/my-template", "--tag", "latest"},
+			wantErr: `--tag must be a semantic version like v1.2.3, but got "latest"`,
+		},
+		{
+			name:    "tag_not_canonical",
+			args:    []string{"--repository", "ghcr.io/my-org/my-template", "--tag", "v1.2"},
+			wantErr: `--tag must be a semantic version like v1.2.3, but got "v1.2"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd PublishCommand
+			cmd.SetLookupEnv(cli.MapLookuper(tc.env))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestPublishRealRun(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template for testing'
+steps:
+  - desc: 'Include some files'
+    action: 'include'
+    params:
+      paths: ['hello.txt']
+`
+	testYAML := "api_version: 'cli.abcxyz.dev/v1beta4'\nkind: 'GoldenTest'\n"
+
+	cases := []struct {
+		name          string
+		files         map[string]string
+		existingTag   bool
+		wantPublished bool
+		wantStderr    string
+		wantErr       string
+	}{
+		{
+			name: "success",
+			files: map[string]string{
+				"spec.yaml":                           specContents,
+				"hello.txt":                           "hello",
+				"testdata/golden/test/test.yaml":      testYAML,
+				"testdata/golden/test/data/hello.txt": "hello",
+			},
+			wantPublished: true,
+			wantStderr:    "golden test test succeeds",
+		},
+		{
+			name: "no_golden_tests",
+			files: map[string]string{
+				"spec.yaml": specContents,
+				"hello.txt": "hello",
+			},
+			wantPublished: true,
+			wantStderr:    "warning: the template has no golden tests",
+		},
+		{
+			name: "golden_test_fails",
+			files: map[string]string{
+				"spec.yaml":                           specContents,
+				"hello.txt":                           "hello",
+				"testdata/golden/test/test.yaml":      testYAML,
+				"testdata/golden/test/data/hello.txt": "goodbye",
+			},
+			wantErr: "not publishing, because the golden tests failed",
+		},
+		{
+			name: "invalid_spec",
+			files: map[string]string{
+				"spec.yaml": "this is not a spec",
+			},
+			wantErr: "error reading template spec file",
+		},
+		{
+			name: "tag_already_exists",
+			files: map[string]string{
+				"spec.yaml": specContents,
+				"hello.txt": "hello",
+			},
+			existingTag: true,
+			wantErr:     "was already published",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			templateDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, templateDir, tc.files)
+
+			reg := abctestutil.NewFakeRegistry(t, &abctestutil.FakeRegistryParams{})
+			client := ociregistry.NewClient(&ociregistry.ClientParams{PlainHTTP: true})
+			repository := reg.Host + "/my-org/my-template"
+
+			if tc.existingTag {
+				img, err := archive.BuildOCIImage(ctx, &common.RealFS{}, templateDir, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				repo := &ociregistry.Repository{Registry: reg.Host, Name: "my-org/my-template"}
+				if err := client.Push(ctx, repo, "v1.0.0", img); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cmd := &PublishCommand{
+				flags: PublishFlags{
+					Location:   templateDir,
+					Repository: repository,
+					Tag:        "v1.0.0",
+				},
+			}
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+			stdout, stderr := &strings.Builder{}, &strings.Builder{}
+			err := cmd.realRun(ctx, &publishParams{
+				fs:             &common.RealFS{},
+				stdout:         stdout,
+				stderr:         stderr,
+				registryClient: client,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if !strings.Contains(stderr.String(), tc.wantStderr) {
+				t.Errorf("got stderr %q, want it to contain %q", stderr.String(), tc.wantStderr)
+			}
+
+			manifest := reg.Manifest("my-org/my-template", "v1.0.0")
+			if !tc.existingTag && (manifest != nil) != tc.wantPublished {
+				t.Fatalf("got published=%t, want %t", manifest != nil, tc.wantPublished)
+			}
+			if !tc.wantPublished {
+				return
+			}
+
+			var got struct {
+				Annotations map[string]string `json:"annotations"`
+			}
+			if err := json.Unmarshal(manifest, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Annotations[annotationVersion] != "v1.0.0" {
+				t.Errorf("got version annotation %q, want %q", got.Annotations[annotationVersion], "v1.0.0")
+			}
+			wantStdout := "published " + repository + ":v1.0.0\ndigest: sha256:"
+			if !strings.HasPrefix(stdout.String(), wantStdout) {
+				t.Errorf("got stdout %q, want it to start with %q", stdout.String(), wantStdout)
+			}
+			if !strings.Contains(stdout.String(), "dirhash: "+got.Annotations[annotationDirhash]) {
+				t.Errorf("got stdout %q, want it to contain the dirhash %q", stdout.String(), got.Annotations[annotationDirhash])
+			}
+		})
+	}
+}
@@ -16,14 +16,32 @@ package render
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/posener/complete/v2/predict"
 
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
 	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	"github.com/abcxyz/abc/templates/common/redact"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/ui"
 	"github.com/abcxyz/pkg/cli"
 )
 
+// stdoutDest is the special --dest value meaning "write the rendered output to
+// stdout as an archive instead of to a directory".
+const stdoutDest = "-"
+
+// outputFormatDir is the --output-format value meaning "write the rendered
+// output files into the --dest directory". The other allowed values are the
+// archive formats in archive.Formats.
+const outputFormatDir = "dir"
+
 // RenderFlags describes what template to render and how.
 type RenderFlags struct {
 	// Positional arguments:
@@ -35,10 +53,21 @@ type RenderFlags struct {
 
 	// Flag arguments (--foo):
 
+	// AllowExec lets templates run external programs, like the "command" of a
+	// "format" action.
+	AllowExec bool
+
 	// Dest is the local directory where the template output will be written.
-	// It's OK for it to already exist or not.
+	// It's OK for it to already exist or not. The special value "-" means to
+	// write an archive of the output to stdout. When OutputFormat is an
+	// archive format, Dest is the path of the archive file to create.
 	Dest string
 
+	// ExtraDests are the directories of the template's other destinations,
+	// declared in "destinations" in its spec, keyed by name. The output files
+	// of a destination that isn't given one are written to Dest.
+	ExtraDests map[string]string
+
 	// See common/flags.GitProtocol().
 	GitProtocol string
 
@@ -46,30 +75,145 @@ type RenderFlags struct {
 	// with the output of the template.
 	ForceOverwrite bool
 
+	// OnConflict says what to do with output files that already exist in the
+	// Dest directory, one of render.ConflictPolicies. If it's "error" and
+	// stdin is a terminal, the user is asked instead.
+	OnConflict string
+
+	// OutputFormat is either "dir" to write the output files into the Dest
+	// directory, or one of the archive formats ("tar" or "zip") to package
+	// the output files into a single archive file at Dest.
+	OutputFormat string
+
+	// ToStdout is the path of one output file, relative to the template output,
+	// to print to stdout instead of writing any output to Dest. This lets
+	// template authors quickly see how one file expands with given inputs.
+	ToStdout string
+
 	// See common/flags.Inputs().
 	Inputs map[string]string
 
 	// See common/flags.InputFiles().
 	InputFiles []string
 
+	// SetVars overrides the values of the template's vars, which are normally
+	// computed by the template.
+	SetVars map[string]string
+
 	// See common/flags.KeepTempDirs().
 	KeepTempDirs bool
 
 	// Whether to prompt the user for template inputs.
 	Prompt bool
 
+	// PromptTimeout is how long to wait for the answer to each prompt before
+	// failing. Zero means forever.
+	PromptTimeout time.Duration
+
+	// AcceptDefaults uses the defaults of the inputs that weren't given,
+	// without prompting for them, and records that in the manifest.
+	AcceptDefaults bool
+
+	// Resume continues a render into Dest that was interrupted before its
+	// inputs were all known, reusing the saved source and inputs.
+	Resume bool
+
+	// ListInputs prints the template's inputs as JSON, saying which ones
+	// still need values given the other flags, instead of rendering.
+	ListInputs bool
+
 	// See common/flags.DebugStepDiffs().
 	DebugStepDiffs bool
 
 	// See common/flags.DebugScratchContents().
 	DebugScratchContents bool
 
+	// See common/flags.DebugScope().
+	DebugScope bool
+
+	// See common/flags.AllowUnmatchedPaths().
+	AllowUnmatchedPaths bool
+
 	// See common/flags.SkipInputValidation().
 	SkipInputValidation bool
 
+	// See common/flags.StrictAPIVersion().
+	StrictAPIVersion bool
+
+	// See common/flags.Symlinks().
+	Symlinks string
+
+	// See common/flags.LineEndings().
+	LineEndings string
+
+	// See common/flags.StripBOM().
+	StripBOM bool
+
+	// See common/flags.FileModes().
+	FileModes string
+
+	// See common/flags.GeneratedMarker().
+	GeneratedMarker bool
+
+	// OnlyPaths are globs that choose which output files are written to the
+	// destination, so that part of the output can be refreshed without
+	// touching the rest.
+	OnlyPaths []string
+
+	// Protect are globs of paths in the destination that the render must not
+	// create or modify, in addition to those in the destination's
+	// .abc/protect.yaml file.
+	Protect []string
+
+	// Chown is the owner to give the output files, as "UID[:GID]", or "dest"
+	// to use the owner of the destination directory.
+	Chown string
+
+	// See common/flags.MaxFiles().
+	MaxFiles int
+
+	// See common/flags.MaxBytes().
+	MaxBytes int64
+
+	// See common/flags.MaxPathDepth().
+	MaxPathDepth int
+
+	// See common/flags.Color().
+	Color string
+
+	// See common/flags.DownloadRetries().
+	DownloadRetries int
+
+	// See common/flags.AuditLog().
+	AuditLog string
+
+	// See common/flags.AllowDirtyTemplate().
+	AllowDirtyTemplate bool
+
+	// See common/flags.Redact().
+	Redact []string
+
+	// PolicyFiles are the policy files whose rules the rendered output must
+	// pass before it's written.
+	PolicyFiles []string
+
 	// Manifest enables the writing of manifest files, which are an experimental
 	// feature related to template upgrades.
 	Manifest bool
+
+	// HashAlgorithm is the name of the hash algorithm for the manifest, one
+	// of hashalg.Names(). The empty default means hashalg.Default.
+	HashAlgorithm string
+
+	// StatsOut is the optional path of a file to write a summary of the
+	// render to as JSON, like the number of files written, for wrappers and
+	// CI jobs that want the outcome without parsing the output.
+	StatsOut string
+
+	// VendorDir is the directory of templates vendored with "abc templates
+	// vendor". If empty, third_party/templates in the git workspace of Dest
+	// is used if it exists.
+	VendorDir string
 }
 
 func (r *RenderFlags) Register(set *cli.FlagSet) {
@@ -79,6 +223,18 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 	f.StringSliceVar(flags.InputFiles(&r.InputFiles))
 	f.BoolVar(flags.KeepTempDirs(&r.KeepTempDirs))
 	f.BoolVar(flags.SkipInputValidation(&r.SkipInputValidation))
+	f.BoolVar(flags.StrictAPIVersion(&r.StrictAPIVersion))
+	f.StringVar(flags.Symlinks(&r.Symlinks))
+	f.StringVar(flags.LineEndings(&r.LineEndings))
+	f.BoolVar(flags.StripBOM(&r.StripBOM))
+	f.StringVar(flags.FileModes(&r.FileModes))
+	f.BoolVar(flags.GeneratedMarker(&r.GeneratedMarker))
+	f.IntVar(flags.MaxFiles(&r.MaxFiles))
+	f.Int64Var(flags.MaxBytes(&r.MaxBytes))
+	f.IntVar(flags.MaxPathDepth(&r.MaxPathDepth))
+	f.StringVar(flags.Color(&r.Color))
+	f.StringVar(flags.AuditLog(&r.AuditLog))
+	f.StringSliceVar(flags.Redact(&r.Redact))
 
 	f.StringVar(&cli.StringVar{
 		Name:    "dest",
@@ -87,7 +243,54 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 		Target:  &r.Dest,
 		Default: ".",
 		Predict: predict.Dirs("*"),
-		Usage:   "Required. The target directory in which to write the output files.",
+		Usage:   `Required. The target directory in which to write the output files, or the archive file to create if --output-format is an archive format. Use "-" to write an archive of the output files to stdout.`,
+	})
+
+	f.StringMapVar(&cli.StringMapVar{
+		Name:    "extra-dest",
+		Example: "infra=../infra-repo",
+		Target:  &r.ExtraDests,
+		Usage: "The name=dir pairs of the template's other destinations, as declared in its spec, like the checkout " +
+			"of a separate repo; may be repeated. Each destination's output files are written to its directory, " +
+			"with a manifest of their own if --manifest is given. Those of a destination that isn't given a " +
+			"directory are written to --dest.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "output-format",
+		Example: "zip",
+		Target:  &r.OutputFormat,
+		Default: outputFormatDir,
+		Predict: predict.Set(outputFormats()),
+		Usage: fmt.Sprintf(`How to write the output files, one of %s. With "dir", the output files are written into the --dest directory. `+
+			`Otherwise, they're packaged into a single archive file at --dest. Defaults to "tar" when --dest is "-".`,
+			strings.Join(outputFormats(), ", ")),
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "to-stdout",
+		Example: "src/main.go",
+		Target:  &r.ToStdout,
+		Usage: "Print the rendered contents of just this output file to stdout, instead of writing any output files. " +
+			"The path is relative to the template output. The output of print actions goes to stderr.",
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "only-paths",
+		Example: ".github/workflows/*.yml",
+		Target:  &r.OnlyPaths,
+		Usage: "Render the whole template, but only write the output files that match these globs, or that are in a " +
+			"matching directory, leaving the rest of the destination untouched. May be repeated or comma-separated. " +
+			`A glob may use "**" to match any number of directories. Usually combined with --force-overwrite or --on-conflict.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "protect",
+		Example: "infra/**",
+		Target:  &r.Protect,
+		Usage: "Globs of paths in the destination that must never be created or modified, in addition to those " +
+			"in the destination's .abc/protect.yaml file. The render fails before writing anything if its output " +
+			"includes a protected path, or a path inside a protected directory. May be repeated or comma-separated.",
 	})
 
 	f.BoolVar(&cli.BoolVar{
@@ -97,6 +300,27 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 		Usage:   "If an output file already exists in the destination, overwrite it instead of failing.",
 	})
 
+	f.StringVar(&cli.StringVar{
+		Name:    "on-conflict",
+		Example: "keep",
+		Default: string(render.ConflictError),
+		Predict: predict.Set(render.ConflictPolicies),
+		Target:  &r.OnConflict,
+		Usage: fmt.Sprintf(`What to do if an output file already exists in the destination, one of %s. `+
+			`"keep" leaves the existing file alone. With "error", if standard input is a terminal, you're asked `+
+			`whether to overwrite or keep each file, or to see its diff first. --force-overwrite means "overwrite".`,
+			strings.Join(render.ConflictPolicies, ", ")),
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "chown",
+		Example: "1000:1000",
+		Target:  &r.Chown,
+		Usage: `Give the files and directories that the render creates this owner, as a numeric "UID[:GID]", ` +
+			`or "dest" to use the owner of the --dest directory. This is for running as root in a container ` +
+			`that writes to a directory mounted from the host. Not supported on Windows.`,
+	})
+
 	f.BoolVar(&cli.BoolVar{
 		Name:   "prompt",
 		Target: &r.Prompt,
@@ -117,6 +341,56 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 		Usage: "Prompt the user for template inputs that weren't provided as flags.",
 	})
 
+	f.DurationVar(&cli.DurationVar{
+		Name:    "prompt-timeout",
+		Example: "5m",
+		Target:  &r.PromptTimeout,
+		Usage: "With --prompt, fail if a prompt isn't answered within this long, rather than waiting forever, " +
+			"like in a CI job that nobody is watching. The default is no limit.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "accept-defaults",
+		Target:  &r.AcceptDefaults,
+		Default: false,
+		Usage: "Use the defaults of the inputs that weren't given, without prompting for them even with --prompt, " +
+			"and mark them in the manifest as accepted defaults. With --prompt, only the inputs without a default " +
+			"are prompted for.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "resume",
+		Target:  &r.Resume,
+		Default: false,
+		Usage: "Continue a render into the same --dest that was interrupted during prompting or downloading, " +
+			"reusing its template source and the inputs entered so far. The <source> argument may be omitted. " +
+			"Inputs given as flags take precedence over the saved inputs.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "list-inputs",
+		Target:  &r.ListInputs,
+		Default: false,
+		Usage: "Instead of rendering, print the template's inputs as JSON, including whether each one already has a value " +
+			"from --input, --input-file, or a default, so another tool can ask for the rest before rendering.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "allow-exec",
+		Target:  &r.AllowExec,
+		Default: false,
+		Usage:   "Allow the template to run external programs on this machine, like formatters named in the \"command\" of a \"format\" action.",
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "policy-file",
+		Example: "/etc/abc/policy.yaml",
+		Target:  &r.PolicyFiles,
+		Predict: predict.Files("*.yaml"),
+		Usage: "A YAML file of policies, like required or forbidden output files, that the rendered output is checked against " +
+			"before anything is written to --dest; the render fails if any are violated. May be repeated.",
+	})
+
 	f.BoolVar(&cli.BoolVar{
 		Name:    "manifest",
 		Target:  &r.Manifest,
@@ -124,21 +398,165 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 		Usage:   "(experimental) write a manifest file containing metadata that will allow future template upgrades.",
 	})
 
+	f.StringVar(&cli.StringVar{
+		Name:    "hash-algorithm",
+		Example: "sha512",
+		Target:  &r.HashAlgorithm,
+		Predict: predict.Set(hashalg.Names()),
+		Usage: fmt.Sprintf("The hash algorithm for the file hashes and template dirhash in the manifest, one of %s. "+
+			"The default is %s. Manifests that were written with another algorithm can still be checked.",
+			strings.Join(hashalg.Names(), ", "), hashalg.Default.Name),
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "stats-out",
+		Example: "render-stats.json",
+		Target:  &r.StatsOut,
+		Predict: predict.Files("*.json"),
+		Usage: "Write a summary of the render to this file as JSON: the number of files written and skipped, their total size, " +
+			"how long it took, and the template version. The same summary is always printed at the end of the render.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "vendor-dir",
+		Example: "third_party/templates",
+		Target:  &r.VendorDir,
+		Predict: predict.Dirs("*"),
+		Usage: "The directory of templates that were vendored with \"abc templates vendor\". " +
+			"A template or base template that was vendored there is rendered from the vendored copy instead of being downloaded. " +
+			"Defaults to third_party/templates in the git workspace containing --dest, if it has a vendor.yaml file.",
+	})
+
+	f.StringMapVar(&cli.StringMapVar{
+		Name:    "set",
+		Example: "foo=bar",
+		Target:  &r.SetVars,
+		Usage: "(advanced) The key=val pairs that override the values of the template's internal vars, which are normally computed from the inputs; " +
+			"may be repeated. This can break templates in unexpected ways, so only use it if the template documentation suggests it.",
+	})
+
 	t := set.NewSection("TEMPLATE AUTHORS")
 	t.BoolVar(flags.DebugScratchContents(&r.DebugScratchContents))
+	t.BoolVar(flags.DebugScope(&r.DebugScope))
 	t.BoolVar(flags.DebugStepDiffs(&r.DebugStepDiffs))
+	t.BoolVar(flags.AllowDirtyTemplate(&r.AllowDirtyTemplate))
+	t.BoolVar(flags.AllowUnmatchedPaths(&r.AllowUnmatchedPaths))
 
 	g := set.NewSection("GIT OPTIONS")
 
 	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+	g.IntVar(flags.DownloadRetries(&r.DownloadRetries))
 
 	// Default source to the first CLI argument, if given
 	set.AfterParse(func(existingErr error) error {
 		r.Source = strings.TrimSpace(set.Arg(0))
-		if r.Source == "" {
+		if r.Source == "" && !r.Resume {
 			return fmt.Errorf("missing <source> file")
 		}
 
+		if !slices.Contains(outputFormats(), r.OutputFormat) {
+			return fmt.Errorf("--output-format must be one of %s, but got %q",
+				strings.Join(outputFormats(), ", "), r.OutputFormat)
+		}
+		if _, err := render.ParseConflictPolicy(r.OnConflict); err != nil {
+			return fmt.Errorf("invalid --on-conflict: %w", err)
+		}
+		if _, err := common.ParseSymlinkMode(r.Symlinks); err != nil {
+			return fmt.Errorf("invalid --symlinks: %w", err)
+		}
+		if _, err := hashalg.ByName(r.HashAlgorithm); err != nil {
+			return fmt.Errorf("invalid --hash-algorithm: %w", err)
+		}
+		if _, err := common.ParseLineEndings(r.LineEndings); err != nil {
+			return fmt.Errorf("invalid --line-endings: %w", err)
+		}
+		if _, err := common.ParseFileModes(r.FileModes); err != nil {
+			return fmt.Errorf("invalid --file-modes: %w", err)
+		}
+		for _, pattern := range r.OnlyPaths {
+			if err := common.ValidateGlob(pattern); err != nil {
+				return fmt.Errorf("invalid --only-paths %q: %w", pattern, err)
+			}
+		}
+		for _, pattern := range r.Protect {
+			if err := common.ValidateGlob(pattern); err != nil {
+				return fmt.Errorf("invalid --protect %q: %w", pattern, err)
+			}
+		}
+		if len(r.OnlyPaths) > 0 && r.Manifest {
+			return fmt.Errorf("--only-paths can't be combined with --manifest, since the manifest would only describe part of the template's output")
+		}
+		if r.Chown != "" && r.Chown != common.OwnerFromDest {
+			if _, err := common.ParseOwner(r.Chown); err != nil {
+				return fmt.Errorf("invalid --chown: %w", err)
+			}
+		}
+		if _, err := ui.ParseColorMode(r.Color); err != nil {
+			return fmt.Errorf("invalid --color: %w", err)
+		}
+		if err := redact.ValidatePatterns(r.Redact); err != nil {
+			return fmt.Errorf("invalid --redact: %w", err)
+		}
+		if r.MaxFiles < 0 {
+			return fmt.Errorf("--max-files must not be negative, but got %d", r.MaxFiles)
+		}
+		if r.MaxBytes < 0 {
+			return fmt.Errorf("--max-bytes must not be negative, but got %d", r.MaxBytes)
+		}
+		if r.MaxPathDepth < 0 {
+			return fmt.Errorf("--max-path-depth must not be negative, but got %d", r.MaxPathDepth)
+		}
+		if r.DownloadRetries < 0 {
+			return fmt.Errorf("--download-retries must not be negative, but got %d", r.DownloadRetries)
+		}
+		if r.ToStdout != "" {
+			if r.OutputFormat != outputFormatDir || r.Dest == stdoutDest {
+				return fmt.Errorf("--to-stdout can't be combined with --output-format or --dest=%s", stdoutDest)
+			}
+			if !filepath.IsLocal(r.ToStdout) {
+				return fmt.Errorf("--to-stdout must be a relative path inside the template output, but got %q", r.ToStdout)
+			}
+		}
+		if r.Chown != "" && (r.OutputFormat != outputFormatDir || r.Dest == stdoutDest) {
+			return fmt.Errorf("--chown can't be combined with --output-format or --dest=%s", stdoutDest)
+		}
+		if len(r.ExtraDests) > 0 {
+			if r.OutputFormat != outputFormatDir || r.Dest == stdoutDest || r.ToStdout != "" {
+				return fmt.Errorf("--extra-dest can't be combined with --output-format, --to-stdout, or --dest=%s", stdoutDest)
+			}
+			if len(r.OnlyPaths) > 0 {
+				return fmt.Errorf("--only-paths can't be combined with --extra-dest")
+			}
+			for name, dir := range r.ExtraDests {
+				if dir == "" {
+					return fmt.Errorf("--extra-dest %q is missing a directory; use --extra-dest=%s=<dir>", name, name)
+				}
+			}
+		}
+		if r.PromptTimeout < 0 {
+			return fmt.Errorf("--prompt-timeout must not be negative, but got %s", r.PromptTimeout)
+		}
+		if r.PromptTimeout > 0 && !r.Prompt {
+			return fmt.Errorf("--prompt-timeout requires --prompt")
+		}
+		if r.ListInputs && (r.Prompt || r.ToStdout != "" || r.OutputFormat != outputFormatDir || r.Dest == stdoutDest) {
+			return fmt.Errorf("--list-inputs can't be combined with --prompt, --to-stdout, --output-format, or --dest=%s", stdoutDest)
+		}
+		if r.Dest == stdoutDest && r.OutputFormat == outputFormatDir {
+			// A directory can't be written to stdout, so fall back to the
+			// simplest archive format.
+			r.OutputFormat = string(archive.FormatTar)
+		}
+
 		return nil
 	})
 }
+
+// outputFormats returns all the valid values of --output-format.
+func outputFormats() []string {
+	out := []string{outputFormatDir}
+	for _, f := range archive.Formats {
+		out = append(out, string(f))
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// This file implements "templates render --list-inputs".
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/abcxyz/abc/templates/common/render"
+)
+
+// listInputsOutput is what --list-inputs prints. Its JSON field names are part
+// of the CLI's interface, so they must not change.
+type listInputsOutput struct {
+	Source string         `json:"source"`
+	Inputs []*listedInput `json:"inputs"`
+
+	// Unsatisfied is the names of the inputs that don't have a value yet, in
+	// order, which would be reported as missing by a render.
+	Unsatisfied []string `json:"unsatisfied"`
+}
+
+type listedInput struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Type        string        `json:"type"`
+	Default     *string       `json:"default,omitempty"`
+	DefaultFrom string        `json:"default_from,omitempty"`
+	Rules       []*listedRule `json:"rules,omitempty"`
+
+	Satisfied bool `json:"satisfied"`
+
+	// Value, Origin, and OriginFile are only set if Satisfied.
+	Value      *string `json:"value,omitempty"`
+	Origin     string  `json:"origin,omitempty"`
+	OriginFile string  `json:"origin_file,omitempty"`
+}
+
+type listedRule struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message,omitempty"`
+}
+
+// listInputs prints the status of the template's inputs as JSON, for
+// --list-inputs.
+func (c *Command) listInputs(ctx context.Context, p *render.Params) error {
+	statuses, err := render.ListInputs(ctx, p)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	out := &listInputsOutput{
+		Source:      p.SourceForMessages,
+		Inputs:      make([]*listedInput, 0, len(statuses)),
+		Unsatisfied: []string{},
+	}
+	for _, st := range statuses {
+		in := st.Input
+		li := &listedInput{
+			Name:        in.Name.Val,
+			Description: in.Desc.Val,
+			Type:        string(st.Type),
+			DefaultFrom: in.DefaultFrom.Val,
+			Satisfied:   st.Satisfied,
+			Origin:      st.Origin,
+			OriginFile:  st.OriginFile,
+		}
+		if in.Default != nil {
+			def := in.Default.Val
+			li.Default = &def
+		}
+		for _, rule := range in.Rules {
+			li.Rules = append(li.Rules, &listedRule{
+				Rule:    rule.Rule.Val,
+				Message: rule.Message.Val,
+			})
+		}
+		if st.Satisfied {
+			val := st.Value
+			li.Value = &val
+		} else {
+			out.Unsatisfied = append(out.Unsatisfied, li.Name)
+		}
+		out.Inputs = append(out.Inputs, li)
+	}
+
+	enc := json.NewEncoder(c.Stdout())
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false) // rules commonly contain "<" and ">"
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("failed writing inputs: %w", err)
+	}
+	return nil
+}
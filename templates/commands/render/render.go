@@ -19,18 +19,32 @@ package render
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/benbjohnson/clock"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
+	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/policy"
 	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/common/ui"
 	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
 )
 
 type Command struct {
@@ -38,6 +52,14 @@ type Command struct {
 	flags RenderFlags
 	// used in prompt UT.
 	skipPromptTTYCheck bool
+
+	// testFS allows filesystem interaction to be faked for testing. If nil,
+	// the real filesystem is used.
+	testFS common.FS
+
+	// testResumeDir is where resume files are kept, for testing. If empty,
+	// ~/.abc/resume is used.
+	testResumeDir string
 }
 
 // Desc implements cli.Command.
@@ -60,6 +82,13 @@ few forms:
     - github.com/abcxyz/abc/t/rest_server@latest
     - github.com/abcxyz/abc/t/rest_server@v0.3.1
   - A local directory, like /home/me/mydir
+  - A GCS or S3 location, either a prefix or an archive object. Examples:
+    - gs://my-bucket/templates/rest_server
+    - s3://my-bucket/templates/rest_server.tar.gz
+    GCS credentials are only read from $GOOGLE_OAUTH_ACCESS_TOKEN, like the
+    output of "gcloud auth print-access-token"; Application Default
+    Credentials aren't used. S3 credentials are read from the same
+    environment variables as the AWS CLI.
   - (Deprecated) A go-getter-style location, with or without ?ref=foo. Examples:
     - github.com/abcxyz/abc.git//t/react_template?ref=latest
 	- github.com/abcxyz/abc.git//t/react_template
@@ -73,14 +102,58 @@ func (c *Command) Flags() *cli.FlagSet {
 	return set
 }
 
-func (c *Command) Run(ctx context.Context, args []string) error {
+func (c *Command) Run(ctx context.Context, args []string) (rErr error) {
 	if err := c.Flags().Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
 
-	fs := &common.RealFS{}
-	if err := destOK(fs, c.flags.Dest); err != nil {
-		return err
+	var fs common.FS = &common.RealFS{}
+	if c.testFS != nil {
+		fs = c.testFS
+	}
+	isArchive := c.flags.OutputFormat != outputFormatDir
+	toStdout := c.flags.ToStdout != ""
+	switch {
+	case isArchive:
+		if err := archiveDestOK(fs, c.flags.Dest, c.flags.ForceOverwrite); err != nil {
+			return err
+		}
+	case toStdout:
+		// Nothing is written to the destination.
+	default:
+		if err := destOK(fs, c.flags.Dest); err != nil {
+			return err
+		}
+	}
+
+	destDir := c.flags.Dest
+	stdout := c.Stdout()
+	var prompter input.Prompter = c
+	if c.flags.Dest == stdoutDest || toStdout {
+		// The output of "print" actions, logs, and prompts are sent to stderr
+		// so they don't get mixed into the output.
+		stdout = c.Stderr()
+		logger, err := newStderrLogger(c.LookupEnv, c.Stderr())
+		if err != nil {
+			return err
+		}
+		ctx = logging.WithLogger(ctx, logger)
+		prompter = newStderrPrompter(c)
+	}
+	if isArchive || toStdout {
+		// The template is rendered into a temp directory that is then
+		// packaged into an archive, or that the selected file is read from.
+		tempTracker := tempdir.NewDirTracker(fs, c.flags.KeepTempDirs)
+		defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+		namePart := tempdir.ArchiveDirNamePart
+		if toStdout {
+			namePart = tempdir.ToStdoutDirNamePart
+		}
+		var err error
+		destDir, err = tempTracker.MkdirTempTracked("", namePart)
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory for the render output: %w", err)
+		}
 	}
 
 	wd, err := c.WorkingDir()
@@ -98,38 +171,387 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 		"backups",
 		fmt.Sprint(time.Now().Unix()))
 
+	resumeDir := c.testResumeDir
+	if resumeDir == "" {
+		resumeDir = filepath.Join(homeDir, ".abc", "resume")
+	}
+	absDest := c.flags.Dest
+	if !filepath.IsAbs(absDest) {
+		absDest = filepath.Join(wd, absDest)
+	}
+	resumeFile := render.ResumeFilePath(resumeDir, absDest)
+
+	extraDests := make(map[string]string, len(c.flags.ExtraDests))
+	for name, dir := range c.flags.ExtraDests {
+		if err := destOK(fs, dir); err != nil {
+			return err
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(wd, dir)
+		}
+		extraDests[name] = dir
+	}
+	source, inputs, err := c.sourceAndInputs(fs, resumeFile)
+	if err != nil {
+		return err
+	}
+
+	limits := &common.Limits{
+		MaxFiles:     c.flags.MaxFiles,
+		MaxBytes:     c.flags.MaxBytes,
+		MaxPathDepth: c.flags.MaxPathDepth,
+	}
+
+	vendorDir, err := c.vendorDir(ctx, fs, wd, absDest)
+	if err != nil {
+		return err
+	}
+
+	retry := &templatesource.RetryPolicy{MaxRetries: c.flags.DownloadRetries}
+	stats := &templatesource.DownloadStats{}
+	renderStats := &render.Stats{}
+
 	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
 		CWD:         wd,
-		Source:      c.flags.Source,
+		Source:      source,
 		GitProtocol: c.flags.GitProtocol,
+		FS:          fs,
+		Limits:      limits,
+		Symlinks:    common.SymlinkMode(c.flags.Symlinks),
+		VendorDir:   vendorDir,
+		Retry:       retry,
+		Stats:       stats,
+		AllowDirty:  c.flags.AllowDirtyTemplate,
 	})
 	if err != nil {
 		return err //nolint:wrapcheck
 	}
 
-	return render.Render(ctx, &render.Params{ //nolint:wrapcheck
+	if c.flags.ListInputs {
+		return c.listInputs(ctx, &render.Params{
+			Cwd:               wd,
+			DestDir:           absDest,
+			Downloader:        downloader,
+			DownloadRetry:     retry,
+			DownloadStats:     stats,
+			FS:                fs,
+			GitProtocol:       c.flags.GitProtocol,
+			InputFiles:        c.flags.InputFiles,
+			Inputs:            inputs,
+			KeepTempDirs:      c.flags.KeepTempDirs,
+			Limits:            limits,
+			LookupEnv:         c.LookupEnv,
+			Redact:            c.flags.Redact,
+			SourceForMessages: source,
+			Stdin:             c.Stdin(),
+			Symlinks:          common.SymlinkMode(c.flags.Symlinks),
+			VendorDir:         vendorDir,
+		})
+	}
+
+	policies := make([]policy.Checker, 0, len(c.flags.PolicyFiles))
+	for _, path := range c.flags.PolicyFiles {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(wd, path)
+		}
+		pf, err := policy.Load(fs, path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		policies = append(policies, pf)
+	}
+
+	auditLog := c.flags.AuditLog
+	if auditLog != "" && !filepath.IsAbs(auditLog) {
+		auditLog = filepath.Join(wd, auditLog)
+	}
+
+	chown, err := parseChown(fs, c.flags.Chown, absDest)
+	if err != nil {
+		return err
+	}
+
+	hashAlg, err := hashalg.ByName(c.flags.HashAlgorithm)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	var debugScope io.Writer
+	if c.flags.DebugScope {
+		debugScope = c.Stderr()
+	}
+
+	if err := render.Render(ctx, &render.Params{
+		AcceptDefaults:       c.flags.AcceptDefaults,
+		AllowExec:            c.flags.AllowExec,
+		AllowUnmatchedPaths:  c.flags.AllowUnmatchedPaths,
+		AuditDest:            absDest,
+		AuditLog:             auditLog,
 		BackupDir:            backupDir,
 		Backups:              true,
+		Chown:                chown,
 		Clock:                clock.New(),
+		Colors:               ui.NewColors(ui.ColorMode(c.flags.Color), stdout, c.LookupEnv),
 		Cwd:                  wd,
+		DebugScope:           debugScope,
 		DebugScratchContents: c.flags.DebugScratchContents,
 		DebugStepDiffs:       c.flags.DebugStepDiffs,
-		DestDir:              c.flags.Dest,
+		DestDir:              destDir,
 		Downloader:           downloader,
+		DownloadRetry:        retry,
+		DownloadStats:        stats,
+		ExtraDests:           extraDests,
+		FileModes:            common.FileModes(c.flags.FileModes),
 		ForceOverwrite:       c.flags.ForceOverwrite,
 		FS:                   fs,
+		GeneratedMarker:      c.flags.GeneratedMarker,
 		GitProtocol:          c.flags.GitProtocol,
+		HashAlgorithm:        hashAlg,
 		KeepTempDirs:         c.flags.KeepTempDirs,
-		Inputs:               c.flags.Inputs,
+		Inputs:               inputs,
 		InputFiles:           c.flags.InputFiles,
+		LineEndings:          common.LineEndings(c.flags.LineEndings),
+		Limits:               limits,
+		LookupEnv:            c.LookupEnv,
 		Manifest:             c.flags.Manifest,
+		OnConflict:           render.ConflictPolicy(c.flags.OnConflict),
+		OnlyPaths:            c.flags.OnlyPaths,
+		Protect:              c.flags.Protect,
+		Policies:             policies,
 		Prompt:               c.flags.Prompt,
-		Prompter:             c,
+		PromptTimeout:        c.flags.PromptTimeout,
+		Prompter:             prompter,
+		Redact:               c.flags.Redact,
+		ResumeFile:           resumeFile,
+		SetVars:              c.flags.SetVars,
 		SkipInputValidation:  c.flags.SkipInputValidation,
 		SkipPromptTTYCheck:   c.skipPromptTTYCheck,
-		SourceForMessages:    c.flags.Source,
-		Stdout:               c.Stdout(),
-	})
+		StrictAPIVersion:     c.flags.StrictAPIVersion,
+		SourceForMessages:    source,
+		Stats:                renderStats,
+		Stdin:                c.Stdin(),
+		Stdout:               stdout,
+		StripBOM:             c.flags.StripBOM,
+		Symlinks:             common.SymlinkMode(c.flags.Symlinks),
+		VendorDir:            vendorDir,
+	}); err != nil {
+		return err //nolint:wrapcheck
+	}
+	if stats.Downloads() > 0 {
+		logging.FromContext(ctx).InfoContext(ctx, stats.String())
+	}
+
+	if isArchive {
+		if err := writeArchive(ctx, fs, archive.Format(c.flags.OutputFormat), destDir, c.flags.Dest, c.Stdout()); err != nil {
+			return err
+		}
+	}
+	if toStdout {
+		if err := writeOneFile(fs, destDir, c.flags.ToStdout, c.Stdout()); err != nil {
+			return err
+		}
+	}
+	return writeStats(fs, renderStats, wd, c.flags.StatsOut, stdout)
+}
+
+// writeStats prints the one-line summary of the render to w, followed by a
+// line for each step that failed and was skipped because of its on_error, and
+// writes the summary as JSON to statsOut, if it's set, for --stats-out.
+func writeStats(fs common.FS, st *render.Stats, wd, statsOut string, w io.Writer) error {
+	if _, err := fmt.Fprintln(w, st.String()); err != nil {
+		return fmt.Errorf("failed writing the render summary: %w", err)
+	}
+	for _, f := range st.FailedSteps {
+		if _, err := fmt.Fprintf(w, "  step %q (action %q) at line %d failed: %s\n", f.Desc, f.Action, f.Line, f.Error); err != nil {
+			return fmt.Errorf("failed writing the render summary: %w", err)
+		}
+	}
+	if statsOut == "" {
+		return nil
+	}
+	if !filepath.IsAbs(statsOut) {
+		statsOut = filepath.Join(wd, statsOut)
+	}
+	buf, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed marshaling the render summary: %w", err)
+	}
+	if err := fs.WriteFile(statsOut, append(buf, '\n'), common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("failed writing --stats-out file: %w", err)
+	}
+	return nil
+}
+
+// writeOneFile copies the output file at relPath inside outDir to w, for
+// --to-stdout.
+func writeOneFile(fs common.FS, outDir, relPath string, w io.Writer) error {
+	buf, err := fs.ReadFile(filepath.Join(outDir, relPath))
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return fmt.Errorf("the template output doesn't contain the file %q given in --to-stdout", relPath)
+		}
+		return fmt.Errorf("failed reading the output file %q: %w", relPath, err)
+	}
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("failed writing to stdout: %w", err)
+	}
+	return nil
+}
+
+// parseChown returns the owner given by the value of --chown, or nil if it's
+// empty. The value "dest" means the owner of absDest, or of its nearest
+// ancestor that exists.
+func parseChown(fs common.FS, chown, absDest string) (*common.Owner, error) {
+	switch chown {
+	case "":
+		return nil, nil
+	case common.OwnerFromDest:
+		owner, err := common.DirOwner(fs, absDest)
+		if err != nil {
+			return nil, fmt.Errorf("failed determining the owner of --dest for --chown=%s: %w", common.OwnerFromDest, err)
+		}
+		return owner, nil
+	default:
+		return common.ParseOwner(chown) //nolint:wrapcheck
+	}
+}
+
+// vendorDir returns the absolute path of the --vendor-dir. If the flag wasn't
+// given, it's the default vendor directory in the git workspace containing
+// absDest, or empty if that has no vendored templates.
+func (c *Command) vendorDir(ctx context.Context, fs common.FS, wd, absDest string) (string, error) {
+	if c.flags.VendorDir != "" {
+		if filepath.IsAbs(c.flags.VendorDir) {
+			return c.flags.VendorDir, nil
+		}
+		return filepath.Join(wd, c.flags.VendorDir), nil
+	}
+
+	root, ok, err := git.Workspace(ctx, absDest)
+	if err != nil {
+		return "", fmt.Errorf("failed determining git workspace for %q: %w", absDest, err)
+	}
+	if !ok {
+		return "", nil
+	}
+	dir := filepath.Join(root, filepath.FromSlash(templatesource.DefaultVendorDir))
+	if _, err := fs.Stat(filepath.Join(dir, templatesource.VendorIndexFileName)); err != nil {
+		if common.IsStatNotExistErr(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("Stat(): %w", err)
+	}
+	return dir, nil
+}
+
+// sourceAndInputs returns the template source and inputs to render with. With
+// --resume, they come from the resume file saved by an interrupted render, but
+// the source argument and --input flags take precedence if they're given.
+func (c *Command) sourceAndInputs(fs common.FS, resumeFile string) (string, map[string]string, error) {
+	if !c.flags.Resume {
+		return c.flags.Source, c.flags.Inputs, nil
+	}
+	state, err := render.LoadResumeState(fs, resumeFile)
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return "", nil, fmt.Errorf("--resume was given, but there's no interrupted render to resume for --dest %q", c.flags.Dest)
+		}
+		return "", nil, err //nolint:wrapcheck
+	}
+
+	source := state.Source
+	if c.flags.Source != "" {
+		source = c.flags.Source
+	}
+	inputs := make(map[string]string, len(state.Inputs)+len(c.flags.Inputs))
+	maps.Copy(inputs, state.Inputs)
+	maps.Copy(inputs, c.flags.Inputs)
+	return source, inputs, nil
+}
+
+// newStderrLogger returns a logger configured from the ABC_LOG_* environment
+// variables, like the one that the abc command starts with, except that it
+// writes to w instead of stdout. It's used when the rendered output is written
+// to stdout, where log lines would corrupt it. Unset variables have the same
+// defaults as in the abc command.
+func newStderrLogger(lookupEnv func(string) (string, bool), w io.Writer) (*slog.Logger, error) {
+	level := logging.LevelWarning
+	if v, _ := lookupEnv("ABC_LOG_LEVEL"); v != "" {
+		var err error
+		if level, err = logging.LookupLevel(v); err != nil {
+			return nil, fmt.Errorf("invalid value for ABC_LOG_LEVEL: %w", err)
+		}
+	}
+	format := logging.FormatText
+	if v, _ := lookupEnv("ABC_LOG_FORMAT"); v != "" {
+		var err error
+		if format, err = logging.LookupFormat(v); err != nil {
+			return nil, fmt.Errorf("invalid value for ABC_LOG_FORMAT: %w", err)
+		}
+	}
+	var debug bool
+	if v, _ := lookupEnv("ABC_LOG_DEBUG"); v != "" {
+		var err error
+		if debug, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid value for ABC_LOG_DEBUG: %w", err)
+		}
+	}
+	return logging.New(w, level, format, debug), nil
+}
+
+// newStderrPrompter returns a prompter that reads from the stdin of c, like c
+// does, but shows its prompts on the stderr of c rather than its stdout.
+func newStderrPrompter(c *Command) input.Prompter {
+	p := &cli.BaseCommand{}
+	p.SetStdin(c.Stdin())
+	p.SetStdout(c.Stderr())
+	p.SetStderr(c.Stderr())
+	return p
+}
+
+// writeArchive packages the contents of srcDir into an archive that is written
+// to the file at dest, or to stdout if dest is "-".
+func writeArchive(ctx context.Context, fs common.FS, format archive.Format, srcDir, dest string, stdout io.Writer) (rErr error) {
+	if dest == stdoutDest {
+		return archive.Write(ctx, fs, format, srcDir, stdout) //nolint:wrapcheck
+	}
+
+	if err := fs.MkdirAll(filepath.Dir(dest), common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("MkdirAll(): %w", err)
+	}
+	f, err := fs.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, common.OwnerRWPerms)
+	if err != nil {
+		return fmt.Errorf("OpenFile(): %w", err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, f.Close())
+	}()
+
+	return archive.Write(ctx, fs, format, srcDir, f) //nolint:wrapcheck
+}
+
+// archiveDestOK makes sure that the output archive path looks sane.
+func archiveDestOK(fs fs.StatFS, dest string, forceOverwrite bool) error {
+	if dest == stdoutDest {
+		return nil
+	}
+
+	fi, err := fs.Stat(dest)
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return nil
+		}
+		return fmt.Errorf("os.Stat(%s): %w", dest, err)
+	}
+
+	if fi.IsDir() {
+		return fmt.Errorf("the destination %q is a directory, but --output-format requires the path of an archive file to create", dest)
+	}
+	if !forceOverwrite {
+		return fmt.Errorf("the destination %q already exists; use --force-overwrite to replace it", dest)
+	}
+
+	return nil
 }
 
 // destOK makes sure that the output directory looks sane.
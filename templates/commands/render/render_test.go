@@ -15,11 +15,17 @@
 package render
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"testing/fstest"
 	"time"
@@ -27,6 +33,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/templatesource"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
@@ -49,11 +57,36 @@ func TestRenderFlags_Parse(t *testing.T) {
 				"--git-protocol", "https",
 				"--input", "x=y",
 				"--input-file", "abc-inputs.yaml",
+				"--set", "image=gcr.io/x",
 				"--force-overwrite",
+				"--on-conflict", "keep",
 				"--keep-temp-dirs",
+				"--output-format", "zip",
 				"--skip-input-validation",
+				"--strict-api-version",
 				"--debug-scratch-contents",
+				"--debug-scope",
 				"--debug-step-diffs",
+				"--allow-dirty-template",
+				"--allow-unmatched-paths",
+				"--symlinks", "preserve",
+				"--line-endings", "crlf",
+				"--strip-bom",
+				"--file-modes", "normalize",
+				"--generated-marker",
+				"--max-files", "100",
+				"--max-bytes", "2048",
+				"--max-path-depth", "0",
+				"--color", "never",
+				"--download-retries", "5",
+				"--vendor-dir", "third_party/templates",
+				"--policy-file", "policy.yaml",
+				"--audit-log", "audit.jsonl",
+				"--redact", "password,*_token",
+				"--stats-out", "stats.json",
+				"--only-paths", "ci/*.yml,docs",
+				"--protect", "infra/**",
+				"--hash-algorithm", "sha512",
 				"helloworld@v1",
 			},
 			want: RenderFlags{
@@ -62,11 +95,37 @@ func TestRenderFlags_Parse(t *testing.T) {
 				GitProtocol:          "https",
 				Inputs:               map[string]string{"x": "y"},
 				InputFiles:           []string{"abc-inputs.yaml"},
+				SetVars:              map[string]string{"image": "gcr.io/x"},
+				ExtraDests:           map[string]string{},
 				ForceOverwrite:       true,
+				OnConflict:           "keep",
 				KeepTempDirs:         true,
+				OutputFormat:         "zip",
 				SkipInputValidation:  true,
+				StrictAPIVersion:     true,
 				DebugScratchContents: true,
+				DebugScope:           true,
 				DebugStepDiffs:       true,
+				AllowDirtyTemplate:   true,
+				AllowUnmatchedPaths:  true,
+				Symlinks:             "preserve",
+				LineEndings:          "crlf",
+				StripBOM:             true,
+				FileModes:            "normalize",
+				GeneratedMarker:      true,
+				MaxFiles:             100,
+				MaxBytes:             2048,
+				MaxPathDepth:         0,
+				Color:                "never",
+				DownloadRetries:      5,
+				VendorDir:            "third_party/templates",
+				PolicyFiles:          []string{"policy.yaml"},
+				AuditLog:             "audit.jsonl",
+				Redact:               []string{"password", "*_token"},
+				StatsOut:             "stats.json",
+				OnlyPaths:            []string{"ci/*.yml", "docs"},
+				Protect:              []string{"infra/**"},
+				HashAlgorithm:        "sha512",
 			},
 		},
 		{
@@ -75,19 +134,389 @@ func TestRenderFlags_Parse(t *testing.T) {
 				"helloworld@v1",
 			},
 			want: RenderFlags{
-				Source:         "helloworld@v1",
-				Dest:           ".",
-				GitProtocol:    "https",
-				Inputs:         map[string]string{},
-				ForceOverwrite: false,
-				KeepTempDirs:   false,
+				Source:          "helloworld@v1",
+				Dest:            ".",
+				GitProtocol:     "https",
+				Inputs:          map[string]string{},
+				SetVars:         map[string]string{},
+				ExtraDests:      map[string]string{},
+				ForceOverwrite:  false,
+				KeepTempDirs:    false,
+				OutputFormat:    "dir",
+				OnConflict:      "error",
+				Symlinks:        "follow",
+				MaxFiles:        10_000,
+				MaxBytes:        512 * 1024 * 1024,
+				MaxPathDepth:    32,
+				Color:           "auto",
+				DownloadRetries: 3,
 			},
 		},
+		{
+			name: "chown",
+			args: []string{
+				"--chown", "1000:1000",
+				"helloworld@v1",
+			},
+			want: RenderFlags{
+				Source:          "helloworld@v1",
+				Dest:            ".",
+				GitProtocol:     "https",
+				Inputs:          map[string]string{},
+				SetVars:         map[string]string{},
+				ExtraDests:      map[string]string{},
+				OutputFormat:    "dir",
+				OnConflict:      "error",
+				Symlinks:        "follow",
+				Chown:           "1000:1000",
+				MaxFiles:        10_000,
+				MaxBytes:        512 * 1024 * 1024,
+				MaxPathDepth:    32,
+				Color:           "auto",
+				DownloadRetries: 3,
+			},
+		},
+		{
+			name: "dest_stdout_defaults_to_tar",
+			args: []string{
+				"--dest", "-",
+				"helloworld@v1",
+			},
+			want: RenderFlags{
+				Source:          "helloworld@v1",
+				Dest:            "-",
+				GitProtocol:     "https",
+				Inputs:          map[string]string{},
+				SetVars:         map[string]string{},
+				ExtraDests:      map[string]string{},
+				OutputFormat:    "tar",
+				OnConflict:      "error",
+				Symlinks:        "follow",
+				MaxFiles:        10_000,
+				MaxBytes:        512 * 1024 * 1024,
+				MaxPathDepth:    32,
+				Color:           "auto",
+				DownloadRetries: 3,
+			},
+		},
+		{
+			name: "dest_stdout_with_zip",
+			args: []string{
+				"--dest", "-",
+				"--output-format", "zip",
+				"helloworld@v1",
+			},
+			want: RenderFlags{
+				Source:          "helloworld@v1",
+				Dest:            "-",
+				GitProtocol:     "https",
+				Inputs:          map[string]string{},
+				SetVars:         map[string]string{},
+				ExtraDests:      map[string]string{},
+				OutputFormat:    "zip",
+				OnConflict:      "error",
+				Symlinks:        "follow",
+				MaxFiles:        10_000,
+				MaxBytes:        512 * 1024 * 1024,
+				MaxPathDepth:    32,
+				Color:           "auto",
+				DownloadRetries: 3,
+			},
+		},
+		{
+			name: "invalid_output_format",
+			args: []string{
+				"--output-format", "rar",
+				"helloworld@v1",
+			},
+			wantErr: `--output-format must be one of dir, tar, zip, but got "rar"`,
+		},
+		{
+			name: "invalid_symlinks",
+			args: []string{
+				"--symlinks", "ignore",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --symlinks: invalid symlink mode "ignore"`,
+		},
+		{
+			name: "invalid_on_conflict",
+			args: []string{
+				"--on-conflict", "ask",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --on-conflict: invalid conflict policy "ask"`,
+		},
+		{
+			name: "invalid_line_endings",
+			args: []string{
+				"--line-endings", "cr",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --line-endings: invalid line endings "cr"`,
+		},
+		{
+			name: "invalid_file_modes",
+			args: []string{
+				"--file-modes", "windows",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --file-modes: invalid file modes "windows", must be one of preserve, normalize`,
+		},
+		{
+			name: "invalid_only_paths",
+			args: []string{
+				"--only-paths", "ci/a**",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --only-paths "ci/a**"`,
+		},
+		{
+			name: "invalid_protect",
+			args: []string{
+				"--protect", "infra/a**",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --protect "infra/a**"`,
+		},
+		{
+			name: "invalid_hash_algorithm",
+			args: []string{
+				"--hash-algorithm", "md5",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --hash-algorithm: unknown hash algorithm "md5", the known ones are sha256, sha512`,
+		},
+		{
+			name: "only_paths_with_manifest",
+			args: []string{
+				"--only-paths", "ci/*.yml",
+				"--manifest",
+				"helloworld@v1",
+			},
+			wantErr: "--only-paths can't be combined with --manifest",
+		},
+		{
+			name: "invalid_chown",
+			args: []string{
+				"--chown", "alice",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --chown: invalid owner "alice", must be a numeric user ID`,
+		},
+		{
+			name: "chown_with_archive",
+			args: []string{
+				"--chown", "dest",
+				"--output-format", "zip",
+				"helloworld@v1",
+			},
+			wantErr: "--chown can't be combined with --output-format or --dest=-",
+		},
+		{
+			name: "negative_max_files",
+			args: []string{
+				"--max-files", "-1",
+				"helloworld@v1",
+			},
+			wantErr: "--max-files must not be negative, but got -1",
+		},
+		{
+			name: "negative_download_retries",
+			args: []string{
+				"--download-retries", "-1",
+				"helloworld@v1",
+			},
+			wantErr: "--download-retries must not be negative, but got -1",
+		},
+		{
+			name: "invalid_color",
+			args: []string{
+				"--color", "sometimes",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --color: invalid color mode "sometimes"`,
+		},
+		{
+			name: "invalid_redact",
+			args: []string{
+				"--redact", "[token",
+				"helloworld@v1",
+			},
+			wantErr: `invalid --redact: invalid redaction pattern "[token"`,
+		},
+		{
+			name: "to_stdout",
+			args: []string{
+				"--to-stdout", "src/main.go",
+				"helloworld@v1",
+			},
+			want: RenderFlags{
+				Source:          "helloworld@v1",
+				Dest:            ".",
+				GitProtocol:     "https",
+				Inputs:          map[string]string{},
+				SetVars:         map[string]string{},
+				ExtraDests:      map[string]string{},
+				OutputFormat:    "dir",
+				ToStdout:        "src/main.go",
+				OnConflict:      "error",
+				Symlinks:        "follow",
+				MaxFiles:        10_000,
+				MaxBytes:        512 * 1024 * 1024,
+				MaxPathDepth:    32,
+				Color:           "auto",
+				DownloadRetries: 3,
+			},
+		},
+		{
+			name: "to_stdout_with_archive",
+			args: []string{
+				"--to-stdout", "src/main.go",
+				"--dest", "-",
+				"helloworld@v1",
+			},
+			wantErr: "--to-stdout can't be combined with --output-format or --dest=-",
+		},
+		{
+			name: "to_stdout_outside_output",
+			args: []string{
+				"--to-stdout", "../main.go",
+				"helloworld@v1",
+			},
+			wantErr: `--to-stdout must be a relative path inside the template output, but got "../main.go"`,
+		},
+		{
+			name: "prompt_timeout_and_accept_defaults",
+			args: []string{
+				"--prompt",
+				"--prompt-timeout", "5m",
+				"--accept-defaults",
+				"helloworld@v1",
+			},
+			want: RenderFlags{
+				Source:          "helloworld@v1",
+				Dest:            ".",
+				GitProtocol:     "https",
+				Inputs:          map[string]string{},
+				SetVars:         map[string]string{},
+				ExtraDests:      map[string]string{},
+				OutputFormat:    "dir",
+				Prompt:          true,
+				PromptTimeout:   5 * time.Minute,
+				AcceptDefaults:  true,
+				OnConflict:      "error",
+				Symlinks:        "follow",
+				MaxFiles:        10_000,
+				MaxBytes:        512 * 1024 * 1024,
+				MaxPathDepth:    32,
+				Color:           "auto",
+				DownloadRetries: 3,
+			},
+		},
+		{
+			name: "prompt_timeout_without_prompt",
+			args: []string{
+				"--prompt-timeout", "5m",
+				"helloworld@v1",
+			},
+			wantErr: "--prompt-timeout requires --prompt",
+		},
+		{
+			name: "negative_prompt_timeout",
+			args: []string{
+				"--prompt",
+				"--prompt-timeout", "-1s",
+				"helloworld@v1",
+			},
+			wantErr: "--prompt-timeout must not be negative",
+		},
+		{
+			name: "extra_dests",
+			args: []string{
+				"--extra-dest", "infra=../infra-repo",
+				"--extra-dest", "docs=../docs-repo",
+				"helloworld@v1",
+			},
+			want: RenderFlags{
+				Source:          "helloworld@v1",
+				Dest:            ".",
+				ExtraDests:      map[string]string{"infra": "../infra-repo", "docs": "../docs-repo"},
+				GitProtocol:     "https",
+				Inputs:          map[string]string{},
+				SetVars:         map[string]string{},
+				OutputFormat:    "dir",
+				OnConflict:      "error",
+				Symlinks:        "follow",
+				MaxFiles:        10_000,
+				MaxBytes:        512 * 1024 * 1024,
+				MaxPathDepth:    32,
+				Color:           "auto",
+				DownloadRetries: 3,
+			},
+		},
+		{
+			name: "extra_dest_with_archive",
+			args: []string{
+				"--extra-dest", "infra=../infra-repo",
+				"--output-format", "zip",
+				"helloworld@v1",
+			},
+			wantErr: "--extra-dest can't be combined with --output-format, --to-stdout, or --dest=-",
+		},
+		{
+			name: "extra_dest_with_only_paths",
+			args: []string{
+				"--extra-dest", "infra=../infra-repo",
+				"--only-paths", "docs",
+				"helloworld@v1",
+			},
+			wantErr: "--only-paths can't be combined with --extra-dest",
+		},
+		{
+			name: "extra_dest_without_dir",
+			args: []string{
+				"--extra-dest", "infra=",
+				"helloworld@v1",
+			},
+			wantErr: `--extra-dest "infra" is missing a directory`,
+		},
+		{
+			name: "list_inputs_with_prompt",
+			args: []string{
+				"--list-inputs",
+				"--prompt",
+				"helloworld@v1",
+			},
+			wantErr: "--list-inputs can't be combined with --prompt, --to-stdout, --output-format, or --dest=-",
+		},
 		{
 			name:    "required_source_is_missing",
 			args:    []string{},
 			wantErr: "missing <source> file",
 		},
+		{
+			name: "source_is_optional_with_resume",
+			args: []string{
+				"--resume",
+			},
+			want: RenderFlags{
+				Dest:            ".",
+				GitProtocol:     "https",
+				Inputs:          map[string]string{},
+				SetVars:         map[string]string{},
+				ExtraDests:      map[string]string{},
+				OutputFormat:    "dir",
+				Resume:          true,
+				OnConflict:      "error",
+				Symlinks:        "follow",
+				MaxFiles:        10_000,
+				MaxBytes:        512 * 1024 * 1024,
+				MaxPathDepth:    32,
+				Color:           "auto",
+				DownloadRetries: 3,
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -158,6 +587,71 @@ func TestDestOK(t *testing.T) {
 	}
 }
 
+func TestArchiveDestOK(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		dest           string
+		forceOverwrite bool
+		fs             fs.StatFS
+		wantErr        string
+	}{
+		{
+			name: "dest_does_not_exist_should_succeed",
+			dest: "my/out.zip",
+			fs:   fstest.MapFS{},
+		},
+		{
+			name: "dest_is_stdout_should_succeed",
+			dest: "-",
+			fs:   &common.ErrorFS{StatErr: fmt.Errorf("should not be called")},
+		},
+		{
+			name: "dest_exists_should_fail",
+			dest: "my/out.zip",
+			fs: fstest.MapFS{
+				"my/out.zip": {},
+			},
+			wantErr: "already exists; use --force-overwrite",
+		},
+		{
+			name:           "dest_exists_with_force_overwrite_should_succeed",
+			dest:           "my/out.zip",
+			forceOverwrite: true,
+			fs: fstest.MapFS{
+				"my/out.zip": {},
+			},
+		},
+		{
+			name: "dest_is_dir_should_fail",
+			dest: "my/dir",
+			fs: fstest.MapFS{
+				"my/dir/foo.txt": {},
+			},
+			wantErr: "is a directory",
+		},
+		{
+			name:    "stat_returns_error",
+			dest:    "my/out.zip",
+			fs:      &common.ErrorFS{StatErr: fmt.Errorf("yikes")},
+			wantErr: "yikes",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := archiveDestOK(tc.fs, tc.dest, tc.forceOverwrite)
+			if diff := testutil.DiffErrString(got, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
 func TestRenderPrompt(t *testing.T) {
 	t.Parallel()
 
@@ -239,7 +733,7 @@ Enter value: `,
 			args = append(args, fmt.Sprintf("--dest=%s", dest))
 			args = append(args, sourceDir)
 
-			r := &Command{skipPromptTTYCheck: true}
+			r := &Command{skipPromptTTYCheck: true, testResumeDir: filepath.Join(tempDir, "resume")}
 			stdinReader, stdinWriter := io.Pipe()
 			stdoutReader, stdoutWriter := io.Pipe()
 			_, stderrWriter := io.Pipe()
@@ -259,6 +753,9 @@ Enter value: `,
 				abctestutil.ReadWithTimeout(t, stdoutReader, ds.WaitForPrompt)
 				abctestutil.WriteWithTimeout(t, stdinWriter, ds.ThenRespond)
 			}
+			// Nothing else is prompted for, but the render summary is still
+			// printed.
+			go io.Copy(io.Discard, stdoutReader) //nolint:errcheck
 
 			select {
 			case err := <-errCh:
@@ -276,3 +773,798 @@ Enter value: `,
 		})
 	}
 }
+
+func TestRenderResume(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with two inputs'
+inputs:
+- name: 'first'
+  desc: 'The first input'
+- name: 'second'
+  desc: 'The second input'
+steps:
+- desc: 'Include the file'
+  action: 'include'
+  params:
+    paths: ['out.txt']
+- desc: 'Fill in the inputs'
+  action: 'go_template'
+  params:
+    paths: ['out.txt']
+`
+
+	tempDir := t.TempDir()
+	dest := filepath.Join(tempDir, "dest")
+	sourceDir := filepath.Join(tempDir, "source")
+	resumeDir := filepath.Join(tempDir, "resume")
+	abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{
+		"spec.yaml": specContents,
+		"out.txt":   "{{.first}} {{.second}}",
+	})
+
+	// The first render is interrupted while prompting for the second input.
+	ctx, cancel := context.WithCancel(logging.WithLogger(context.Background(), logging.TestLogger(t)))
+	defer cancel()
+
+	r := &Command{skipPromptTTYCheck: true, testResumeDir: resumeDir}
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	_, stderrWriter := io.Pipe()
+	r.SetStdin(stdinReader)
+	r.SetStdout(stdoutWriter)
+	r.SetStderr(stderrWriter)
+
+	errCh := make(chan error)
+	go func() {
+		defer close(errCh)
+		errCh <- r.Run(ctx, []string{"--prompt", "--dest", dest, sourceDir})
+	}()
+
+	abctestutil.ReadWithTimeout(t, stdoutReader, `
+Input name:   first
+Description:  The first input
+
+Enter value: `)
+	abctestutil.WriteWithTimeout(t, stdinWriter, "hello\n")
+	abctestutil.ReadWithTimeout(t, stdoutReader, `
+Input name:   second
+Description:  The second input
+
+Enter value: `)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for background goroutine to finish")
+	}
+
+	resumeFile := render.ResumeFilePath(resumeDir, dest)
+	state, err := render.LoadResumeState(&common.RealFS{}, resumeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantState := &render.ResumeState{
+		Source: sourceDir,
+		Inputs: map[string]string{"first": "hello"},
+	}
+	if diff := cmp.Diff(state, wantState); diff != "" {
+		t.Errorf("resume state was not as expected (-got,+want): %s", diff)
+	}
+
+	// The second render resumes without the source argument, and provides
+	// the missing input as a flag.
+	ctx = logging.WithLogger(context.Background(), logging.TestLogger(t))
+	r = &Command{testResumeDir: resumeDir}
+	if err := r.Run(ctx, []string{"--resume", "--dest", dest, "--input", "second=world"}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantDestContents := map[string]string{"out.txt": "hello world"}
+	if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, dest), wantDestContents); diff != "" {
+		t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
+	}
+	if _, err := os.Stat(resumeFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got Stat() error %v for the resume file after a successful render, want it to not exist", err)
+	}
+
+	// There's nothing left to resume.
+	r = &Command{testResumeDir: resumeDir}
+	err = r.Run(ctx, []string{"--resume", "--dest", dest})
+	if diff := testutil.DiffErrString(err, "there's no interrupted render to resume"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRenderStdinStdout(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+desc: 'A template for the ages'
+inputs:
+- name: 'name_of_favourite_person'
+  desc: 'The name of favourite person'
+steps:
+- desc: 'Include some files and directories'
+  action: 'include'
+  params:
+    paths: ['file1.txt', 'dir1']
+- desc: 'Replace "Alice" with [input]'
+  action: 'string_replace'
+  params:
+    paths: ['.']
+    replacements:
+    - to_replace: 'Alice'
+      with: '{{.name_of_favourite_person}}'
+`
+
+	cases := []struct {
+		name        string
+		args        []string
+		stdin       string
+		wantZip     bool
+		wantArchive map[string]abctestutil.ModeAndContents
+		wantErr     string
+	}{
+		{
+			name:  "inputs_from_stdin_output_to_stdout",
+			args:  []string{"--dest=-", "--input-file=-"},
+			stdin: "name_of_favourite_person: 'Bob'\n",
+			wantArchive: map[string]abctestutil.ModeAndContents{
+				"file1.txt":            {Mode: 0o600, Contents: "my favorite person is Bob"},
+				"dir1/file_in_dir.txt": {Mode: 0o600, Contents: "file_in_dir contents"},
+			},
+		},
+		{
+			name:  "json_inputs_from_stdin",
+			args:  []string{"--dest=-", "--input-file=-"},
+			stdin: `{"name_of_favourite_person": "Carol"}`,
+			wantArchive: map[string]abctestutil.ModeAndContents{
+				"file1.txt":            {Mode: 0o600, Contents: "my favorite person is Carol"},
+				"dir1/file_in_dir.txt": {Mode: 0o600, Contents: "file_in_dir contents"},
+			},
+		},
+		{
+			name:    "zip_to_stdout",
+			args:    []string{"--dest=-", "--output-format=zip", "--input=name_of_favourite_person=Dan"},
+			wantZip: true,
+			wantArchive: map[string]abctestutil.ModeAndContents{
+				"file1.txt":            {Mode: 0o600, Contents: "my favorite person is Dan"},
+				"dir1/file_in_dir.txt": {Mode: 0o600, Contents: "file_in_dir contents"},
+			},
+		},
+		{
+			name:    "stdin_inputs_conflict_with_prompt",
+			args:    []string{"--dest=-", "--input-file=-", "--prompt"},
+			wantErr: "can't be combined with --prompt",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sourceDir := t.TempDir()
+			abctestutil.WriteAll(t, sourceDir, map[string]abctestutil.ModeAndContents{
+				"spec.yaml":            {Mode: 0o600, Contents: specContents},
+				"file1.txt":            {Mode: 0o600, Contents: "my favorite person is Alice"},
+				"dir1/file_in_dir.txt": {Mode: 0o600, Contents: "file_in_dir contents"},
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+			r := &Command{skipPromptTTYCheck: true}
+			stdout := &bytes.Buffer{}
+			r.SetStdin(strings.NewReader(tc.stdin))
+			r.SetStdout(stdout)
+			r.SetStderr(io.Discard)
+
+			args := append([]string{}, tc.args...)
+			args = append(args, sourceDir)
+			err := r.Run(ctx, args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			var got map[string]abctestutil.ModeAndContents
+			if tc.wantZip {
+				got = abctestutil.ReadZip(t, stdout.Bytes())
+			} else {
+				got = abctestutil.ReadTar(t, stdout)
+			}
+			if diff := cmp.Diff(got, tc.wantArchive); diff != "" {
+				t.Errorf("tar archive contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRenderStdoutLogs(t *testing.T) {
+	t.Parallel()
+
+	sourceDir := t.TempDir()
+	abctestutil.WriteAll(t, sourceDir, map[string]abctestutil.ModeAndContents{
+		// The older api_version makes the render log a warning.
+		"spec.yaml": {Mode: 0o600, Contents: `
+api_version: 'cli.abcxyz.dev/v1beta3'
+kind: 'Template'
+desc: 'A template with an older api_version'
+steps:
+- desc: 'Include a file'
+  action: 'include'
+  params:
+    paths: ['file1.txt']
+`},
+		"file1.txt": {Mode: 0o600, Contents: "file1 contents"},
+	})
+
+	r := &Command{}
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	r.SetStdout(stdout)
+	r.SetStderr(stderr)
+	r.SetLookupEnv(cli.MapLookuper(nil))
+
+	// Like the abc command's own logger, this one writes to stdout.
+	ctx := logging.WithLogger(context.Background(), logging.New(stdout, logging.LevelWarning, logging.FormatText, false))
+	if err := r.Run(ctx, []string{"--dest=-", sourceDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := abctestutil.ReadTar(t, stdout)
+	want := map[string]abctestutil.ModeAndContents{
+		"file1.txt": {Mode: 0o600, Contents: "file1 contents"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("tar archive contents were not as expected (-got,+want): %s", diff)
+	}
+	if want := "older api_version"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("got stderr %q, want it to contain the warning %q", stderr.String(), want)
+	}
+}
+
+func TestRenderArchiveFile(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+desc: 'A template for the ages'
+steps:
+- desc: 'Include some files'
+  action: 'include'
+  params:
+    paths: ['file1.txt']
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'hello'
+`
+
+	wantArchive := map[string]abctestutil.ModeAndContents{
+		"file1.txt": {Mode: 0o600, Contents: "file1 contents"},
+	}
+
+	for _, format := range []string{"tar", "zip"} {
+		format := format
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			dest := filepath.Join(tempDir, "out", "skeleton."+format)
+			abctestutil.WriteAll(t, sourceDir, map[string]abctestutil.ModeAndContents{
+				"spec.yaml": {Mode: 0o600, Contents: specContents},
+				"file1.txt": {Mode: 0o600, Contents: "file1 contents"},
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+			r := &Command{}
+			stdout := &bytes.Buffer{}
+			r.SetStdout(stdout)
+			r.SetStderr(io.Discard)
+
+			args := []string{"--dest=" + dest, "--output-format=" + format, sourceDir}
+			if err := r.Run(ctx, args); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := stdout.String(), "hello\n"; !strings.HasPrefix(got, want) {
+				t.Errorf("stdout was %q, want it to start with %q", got, want)
+			}
+			checkSummary(t, stdout.String(), `wrote 1 file \(14 B\) and skipped 0 files in \S+`)
+
+			var got map[string]abctestutil.ModeAndContents
+			if format == "zip" {
+				b, err := os.ReadFile(dest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = abctestutil.ReadZip(t, b)
+			} else {
+				f, err := os.Open(dest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { f.Close() })
+				got = abctestutil.ReadTar(t, f)
+			}
+			if diff := cmp.Diff(got, wantArchive); diff != "" {
+				t.Errorf("archive contents were not as expected (-got,+want): %s", diff)
+			}
+
+			// Rendering again should fail, since the archive already exists.
+			err := (&Command{}).Run(ctx, args)
+			if diff := testutil.DiffErrString(err, "already exists"); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestRenderToStdout(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+desc: 'A template for the ages'
+inputs:
+- name: 'name_of_favourite_person'
+  desc: 'The name of favourite person'
+steps:
+- desc: 'Include some files and directories'
+  action: 'include'
+  params:
+    paths: ['file1.txt', 'dir1']
+- desc: 'Replace "Alice" with [input]'
+  action: 'string_replace'
+  params:
+    paths: ['.']
+    replacements:
+    - to_replace: 'Alice'
+      with: '{{.name_of_favourite_person}}'
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'hello'
+`
+
+	cases := []struct {
+		name       string
+		toStdout   string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name:       "selected_file_is_printed",
+			toStdout:   "file1.txt",
+			wantStdout: "my favorite person is Bob",
+		},
+		{
+			name:       "file_in_subdir",
+			toStdout:   "dir1/file_in_dir.txt",
+			wantStdout: "file_in_dir contents",
+		},
+		{
+			name:     "file_not_in_output",
+			toStdout: "nonexistent.txt",
+			wantErr:  `the template output doesn't contain the file "nonexistent.txt" given in --to-stdout`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			destDir := filepath.Join(tempDir, "dest")
+			abctestutil.WriteAll(t, sourceDir, map[string]abctestutil.ModeAndContents{
+				"spec.yaml":            {Mode: 0o600, Contents: specContents},
+				"file1.txt":            {Mode: 0o600, Contents: "my favorite person is Alice"},
+				"dir1/file_in_dir.txt": {Mode: 0o600, Contents: "file_in_dir contents"},
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+			r := &Command{}
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			r.SetStdout(stdout)
+			r.SetStderr(stderr)
+			// Logs go to stderr too, like the warning about the older
+			// api_version; only log errors, so stderr starts with the
+			// print output.
+			r.SetLookupEnv(cli.MapLookuper(map[string]string{"ABC_LOG_LEVEL": "error"}))
+
+			args := []string{
+				"--dest=" + destDir,
+				"--input=name_of_favourite_person=Bob",
+				"--to-stdout=" + tc.toStdout,
+				sourceDir,
+			}
+			err := r.Run(ctx, args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if got := stdout.String(); got != tc.wantStdout {
+				t.Errorf("stdout was %q, want %q", got, tc.wantStdout)
+			}
+			if got, want := stderr.String(), "hello\n"; !strings.HasPrefix(got, want) {
+				t.Errorf("stderr was %q, want it to start with %q", got, want)
+			}
+			checkSummary(t, stderr.String(), `wrote 2 files \(45 B\) and skipped 0 files in \S+`)
+			if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+				t.Errorf("the destination directory was created, but --to-stdout should not write any output files (err=%v)", err)
+			}
+		})
+	}
+}
+
+func TestRenderPolicyFile(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		policy   string
+		wantDest map[string]string
+		wantErr  string
+	}{
+		{
+			name:     "passes",
+			policy:   "required_files: ['README.md']\n",
+			wantDest: map[string]string{"README.md": "hello", "key.pem": "secret"},
+		},
+		{
+			name:    "violated",
+			policy:  "required_files: ['CODEOWNERS']\nforbidden_files: ['**/*.pem']\n",
+			wantErr: `required file "CODEOWNERS" is missing`,
+		},
+		{
+			name:    "invalid_policy_file",
+			policy:  "required_filez: ['CODEOWNERS']\n",
+			wantErr: "failed parsing policy file",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			destDir := filepath.Join(tempDir, "dest")
+			abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+				"policy.yaml": tc.policy,
+				"source/spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']
+`,
+				"source/README.md": "hello",
+				"source/key.pem":   "secret",
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			r := &Command{}
+			err := r.Run(ctx, []string{
+				"--dest=" + destDir,
+				"--policy-file=" + filepath.Join(tempDir, "policy.yaml"),
+				sourceDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			var got map[string]string
+			if _, err := os.Stat(destDir); err == nil {
+				got = abctestutil.LoadDirWithoutMode(t, destDir)
+			}
+			if diff := cmp.Diff(got, tc.wantDest); diff != "" {
+				t.Errorf("destination was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRenderStatsOut(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	statsOut := filepath.Join(tempDir, "stats.json")
+	abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']
+`,
+		"README.md":  "hello",
+		"src/foo.go": "package foo",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	r := &Command{}
+	stdout := &bytes.Buffer{}
+	r.SetStdout(stdout)
+	if err := r.Run(ctx, []string{"--dest=" + destDir, "--stats-out=" + statsOut, sourceDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSummary(t, stdout.String(), `wrote 2 files \(16 B\) and skipped 0 files in \S+`)
+
+	buf, err := os.ReadFile(statsOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["duration_seconds"].(float64); !ok {
+		t.Errorf("stats %s have no duration_seconds", buf)
+	}
+	delete(got, "duration_seconds")
+	want := map[string]any{
+		"source":        sourceDir,
+		"files_written": float64(2),
+		"files_skipped": float64(0),
+		"bytes":         float64(16),
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("stats were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestRenderListInputs(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with inputs'
+inputs:
+- name: 'from_flag'
+  desc: 'Given with --input'
+- name: 'from_file'
+  desc: 'Given in an --input-file'
+  type: 'int'
+- name: 'from_default'
+  desc: 'Has a default'
+  default: 'dflt'
+- name: 'computed'
+  desc: 'Has a default computed from another input'
+  default_from: 'from_flag + "!"'
+- name: 'missing'
+  desc: 'Not given'
+  rules:
+  - rule: 'size(missing) > 2'
+    message: 'too short'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'this should not be printed'
+`
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	inputFile := filepath.Join(tempDir, "inputs.yaml")
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		"source/spec.yaml": specContents,
+		"inputs.yaml":      "from_file: 42\n",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	r := &Command{}
+	stdout := &bytes.Buffer{}
+	r.SetStdout(stdout)
+	args := []string{
+		"--list-inputs",
+		"--dest=" + destDir,
+		"--input=from_flag=hi",
+		"--input-file=" + inputFile,
+		sourceDir,
+	}
+	if err := r.Run(ctx, args); err != nil {
+		t.Fatal(err)
+	}
+
+	want := fmt.Sprintf(`{
+  "source": %q,
+  "inputs": [
+    {
+      "name": "from_flag",
+      "description": "Given with --input",
+      "type": "string",
+      "satisfied": true,
+      "value": "hi",
+      "origin": "flag"
+    },
+    {
+      "name": "from_file",
+      "description": "Given in an --input-file",
+      "type": "int",
+      "satisfied": true,
+      "value": "42",
+      "origin": "input_file",
+      "origin_file": %q
+    },
+    {
+      "name": "from_default",
+      "description": "Has a default",
+      "type": "string",
+      "default": "dflt",
+      "satisfied": true,
+      "value": "dflt",
+      "origin": "default"
+    },
+    {
+      "name": "computed",
+      "description": "Has a default computed from another input",
+      "type": "string",
+      "default_from": "from_flag + \"!\"",
+      "satisfied": true,
+      "value": "hi!",
+      "origin": "default"
+    },
+    {
+      "name": "missing",
+      "description": "Not given",
+      "type": "string",
+      "rules": [
+        {
+          "rule": "size(missing) > 2",
+          "message": "too short"
+        }
+      ],
+      "satisfied": false
+    }
+  ],
+  "unsatisfied": [
+    "missing"
+  ]
+}
+`, sourceDir, inputFile)
+	if diff := cmp.Diff(stdout.String(), want); diff != "" {
+		t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+	}
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("the destination directory was created, but --list-inputs should not render anything (err=%v)", err)
+	}
+}
+
+func TestRenderVendored(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A vendored template'
+steps:
+- desc: 'Include some files'
+  action: 'include'
+  params:
+    paths: ['file1.txt']
+`
+	source := "github.com/myorg/myrepo/hello@v1.0.0"
+
+	cases := []struct {
+		name      string
+		noGit     bool
+		vendorDir string
+		modify    map[string]string
+		wantErr   string
+	}{
+		{
+			name: "default_vendor_dir_in_git_workspace",
+		},
+		{
+			name:      "explicit_vendor_dir",
+			noGit:     true,
+			vendorDir: "third_party/templates",
+		},
+		{
+			name:    "modified_vendored_copy",
+			modify:  map[string]string{"third_party/templates/hello/file1.txt": "changed"},
+			wantErr: "was changed after it was vendored",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			repoDir := t.TempDir()
+			vendorDir := filepath.Join(repoDir, "third_party", "templates")
+			abctestutil.WriteAllDefaultMode(t, filepath.Join(vendorDir, "hello"), map[string]string{
+				"spec.yaml": specContents,
+				"file1.txt": "vendored contents",
+			})
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			dirhash, err := common.HashTemplateDir(ctx, filepath.Join(vendorDir, "hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := templatesource.SaveVendorIndex(&common.RealFS{}, vendorDir, &templatesource.VendorIndex{
+				Templates: []*templatesource.VendorEntry{{
+					Name:            "hello",
+					Source:          source,
+					CanonicalSource: "github.com/myorg/myrepo/hello",
+					LocationType:    templatesource.LocTypeRemoteGit,
+					Version:         "v1.0.0",
+					Dirhash:         dirhash,
+				}},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if !tc.noGit {
+				abctestutil.WriteAllDefaultMode(t, repoDir, map[string]string{".git/HEAD": "ref: refs/heads/main\n"})
+			}
+			abctestutil.WriteAllDefaultMode(t, repoDir, tc.modify)
+
+			r := &Command{}
+			r.SetStdout(&bytes.Buffer{})
+			args := []string{"--dest=" + filepath.Join(repoDir, "out")}
+			if tc.vendorDir != "" {
+				args = append(args, "--vendor-dir="+filepath.Join(repoDir, tc.vendorDir))
+			}
+			err = r.Run(ctx, append(args, source))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			got := abctestutil.LoadDirWithoutMode(t, filepath.Join(repoDir, "out"))
+			want := map[string]string{"file1.txt": "vendored contents"}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+// checkSummary checks that the last line of out is the render summary, which
+// matches the regular expression want. The duration in it varies.
+func checkSummary(tb testing.TB, out, want string) {
+	tb.Helper()
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if got := lines[len(lines)-1]; !regexp.MustCompile("^" + want + "$").MatchString(got) {
+		tb.Errorf("render summary was %q, want it to match %q", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// formats is the list of every supported output format, with the default
+// first.
+var formats = []string{formatJSON, formatCSV}
+
+// Flags describes which directories to scan and how to print the report.
+type Flags struct {
+	// Positional arguments:
+
+	// Dirs are the directory trees to look for manifests in, usually the
+	// roots of repos. Defaults to the current directory.
+	Dirs []string
+
+	// Flag arguments (--foo):
+
+	// Format is one of the formats in the formats list.
+	Format string
+
+	// CheckLatest looks up the latest version of each template, to find the
+	// destinations that are outdated.
+	CheckLatest bool
+
+	// See common/flags.GitProtocol().
+	GitProtocol string
+}
+
+func (r *Flags) Register(set *cli.FlagSet) {
+	f := set.NewSection("REPORT OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "format",
+		Example: "csv",
+		Target:  &r.Format,
+		Default: formatJSON,
+		Predict: predict.Set(formats),
+		Usage: fmt.Sprintf(`The output format, one of %s. "json" is an array with one object per manifest; "csv" has a header row and one row per manifest.`,
+			strings.Join(formats, ", ")),
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "check-latest",
+		Target:  &r.CheckLatest,
+		Default: true,
+		Usage: "Whether to look up the latest version of each template that's in a remote git repo, to report " +
+			"which destinations are outdated. This lists the tags of each repo once.",
+	})
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	// The dirs are the CLI arguments.
+	set.AfterParse(func(existingErr error) error {
+		for _, arg := range set.Args() {
+			if dir := strings.TrimSpace(arg); dir != "" {
+				r.Dirs = append(r.Dirs, dir)
+			}
+		}
+		if len(r.Dirs) == 0 {
+			r.Dirs = []string{"."}
+		}
+
+		if !slices.Contains(formats, r.Format) {
+			return fmt.Errorf("--format must be one of %s, but got %q", strings.Join(formats, ", "), r.Format)
+		}
+
+		return nil
+	})
+}
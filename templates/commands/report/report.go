@@ -0,0 +1,318 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package report implements the command that makes an inventory of the
+// templates rendered in one or more repos.
+package report
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/common/manifestutil"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// The values of Entry.Status.
+const (
+	statusCurrent  = "current"
+	statusOutdated = "outdated"
+	statusUnknown  = "unknown"
+)
+
+// csvHeader is the first row of the CSV output. The columns are the fields of
+// Entry, with the drifted files joined by ";" and preceded by their count.
+var csvHeader = []string{
+	"dir", "dest", "manifest", "template_location", "location_type", "template_version",
+	"latest_version", "status", "modification_time", "drifted_file_count", "drifted_files",
+}
+
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "report which templates are rendered where, and which are outdated or modified"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] [<dir>...]
+
+The {{ COMMAND }} command searches each <dir> (default: the current directory),
+usually the root of a repo, for the manifests that renders leave in .abc
+directories, and prints one entry per manifest with:
+
+  - the destination directory, relative to <dir>
+  - the template location and version that it was rendered from
+  - the latest version of the template, and whether the destination is
+    "current", "outdated", or "unknown" (see below)
+  - the files that were rendered and have since been changed or removed
+    ("drifted")
+
+The latest version is the highest semver tag of the template's git repo, so
+it's only known for templates in remote git repos that have release tags.
+Use --check-latest=false to skip looking it up, such as when offline.
+
+The output is JSON by default, or CSV with --format=csv, for loading into
+dashboards and spreadsheets.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+// Entry is the report for one manifest.
+type Entry struct {
+	// Dir is the <dir> argument that the manifest was found in.
+	Dir string `json:"dir"`
+
+	// Dest is the destination directory of the render, relative to Dir, with
+	// forward slashes.
+	Dest string `json:"dest"`
+
+	// Manifest is the path of the manifest file, relative to Dir, with
+	// forward slashes.
+	Manifest string `json:"manifest"`
+
+	TemplateLocation string    `json:"template_location"`
+	LocationType     string    `json:"location_type"`
+	TemplateVersion  string    `json:"template_version"`
+	LatestVersion    string    `json:"latest_version"`
+	Status           string    `json:"status"`
+	ModificationTime time.Time `json:"modification_time"`
+
+	// DriftedFiles are the rendered files that have been changed or removed
+	// since the last render or upgrade, relative to Dest.
+	DriftedFiles []string `json:"drifted_files"`
+}
+
+// latestVersionFunc is templatesource.LatestVersion, or a fake in tests.
+type latestVersionFunc func(ctx context.Context, canonicalLocation, locType, gitProtocol string) (string, bool, error)
+
+type runParams struct {
+	cwd           string
+	fs            common.FS
+	stdout        io.Writer
+	latestVersion latestVersionFunc
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		cwd:           wd,
+		fs:            fSys,
+		stdout:        c.Stdout(),
+		latestVersion: templatesource.LatestVersion,
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(ctx context.Context, rp *runParams) error {
+	latest := &latestCache{
+		flags:         &c.flags,
+		latestVersion: rp.latestVersion,
+		versions:      map[string]string{},
+	}
+
+	entries := []*Entry{}
+	for _, dir := range c.flags.Dirs {
+		root := dir
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(rp.cwd, root)
+		}
+		paths, err := manifestutil.Find(rp.fs, root)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		for _, path := range paths {
+			m, _, err := manifestutil.Load(ctx, rp.fs, path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			entry, err := newEntry(ctx, rp.fs, latest, dir, root, path, m)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Dir != entries[j].Dir {
+			return entries[i].Dir < entries[j].Dir
+		}
+		return entries[i].Manifest < entries[j].Manifest
+	})
+
+	if c.flags.Format == formatCSV {
+		return writeCSV(rp.stdout, entries)
+	}
+	enc := json.NewEncoder(rp.stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(entries); err != nil {
+		return fmt.Errorf("failed writing report: %w", err)
+	}
+	return nil
+}
+
+func newEntry(ctx context.Context, fsys common.FS, latest *latestCache, dir, root, path string, m *manifest.Manifest) (*Entry, error) {
+	destDir := manifestutil.DestDir(path)
+	drifted, err := manifestutil.Drift(fsys, destDir, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed checking %q for drift: %w", destDir, err)
+	}
+	if drifted == nil {
+		drifted = []string{}
+	}
+
+	entry := &Entry{
+		Dir:              dir,
+		Dest:             relSlash(root, destDir),
+		Manifest:         relSlash(root, path),
+		TemplateLocation: m.TemplateLocation.Val,
+		LocationType:     m.LocationType.Val,
+		TemplateVersion:  m.TemplateVersion.Val,
+		Status:           statusUnknown,
+		ModificationTime: m.ModificationTime.UTC(),
+		DriftedFiles:     drifted,
+	}
+	if entry.LatestVersion = latest.get(ctx, m); entry.LatestVersion != "" {
+		entry.Status = status(entry.TemplateVersion, entry.LatestVersion)
+	}
+	return entry, nil
+}
+
+// latestCache looks up the latest version of each template location once.
+type latestCache struct {
+	flags         *Flags
+	latestVersion latestVersionFunc
+
+	// versions maps each location type and template location to its latest
+	// version, which is empty if it's unknown.
+	versions map[string]string
+}
+
+// get returns the latest version of the template that m was rendered from,
+// or "" if it's unknown. A failed lookup is logged rather than returned, so
+// that one unreachable repo doesn't stop the report.
+func (l *latestCache) get(ctx context.Context, m *manifest.Manifest) string {
+	if !l.flags.CheckLatest {
+		return ""
+	}
+	key := m.LocationType.Val + " " + m.TemplateLocation.Val
+	if v, ok := l.versions[key]; ok {
+		return v
+	}
+	v, ok, err := l.latestVersion(ctx, m.TemplateLocation.Val, m.LocationType.Val, l.flags.GitProtocol)
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed looking up the latest version of a template",
+			"template_location", m.TemplateLocation.Val,
+			"error", err)
+	}
+	if err != nil || !ok {
+		v = ""
+	}
+	l.versions[key] = v
+	return v
+}
+
+// status compares the version that a destination was rendered from with the
+// latest version of its template. A version that isn't a semver tag, like a
+// commit SHA, can't be compared.
+func status(version, latest string) string {
+	if version == latest {
+		return statusCurrent
+	}
+	sv, err := git.ParseSemverTag(version)
+	if err != nil {
+		return statusUnknown
+	}
+	lv, err := git.ParseSemverTag(latest)
+	if err != nil {
+		return statusUnknown
+	}
+	if sv.LessThan(lv) {
+		return statusOutdated
+	}
+	return statusCurrent
+}
+
+func writeCSV(w io.Writer, entries []*Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("failed writing report: %w", err)
+	}
+	for _, e := range entries {
+		if err := cw.Write([]string{
+			e.Dir,
+			e.Dest,
+			e.Manifest,
+			e.TemplateLocation,
+			e.LocationType,
+			e.TemplateVersion,
+			e.LatestVersion,
+			e.Status,
+			e.ModificationTime.Format(time.RFC3339),
+			strconv.Itoa(len(e.DriftedFiles)),
+			strings.Join(e.DriftedFiles, ";"),
+		}); err != nil {
+			return fmt.Errorf("failed writing report: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed writing report: %w", err)
+	}
+	return nil
+}
+
+// relSlash returns path relative to root, with forward slashes.
+func relSlash(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,244 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// testManifest is a manifest with placeholders for the template location and
+// version, and for the hash of its outputs. go.mod was included from the
+// destination, so it never counts as drifted.
+const testManifest = `# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta4
+kind: Manifest
+creation_time: 2024-03-10T12:00:00Z
+modification_time: 2024-03-11T12:00:00Z
+template_location: LOCATION
+location_type: LOCTYPE
+template_version: VERSION
+template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
+inputs: []
+output_hashes:
+    - file: a.txt
+      hash: HASH
+    - file: go.mod
+      hash: HASH
+      included_from_dest: true
+    - file: sub/b.txt
+      hash: HASH
+`
+
+func manifestFor(location, locType, version string) string {
+	return strings.NewReplacer(
+		"LOCATION", location,
+		"LOCTYPE", locType,
+		"VERSION", version,
+		"HASH", hashalg.SHA256.Sum([]byte("hello")),
+	).Replace(testManifest)
+}
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	initial := map[string]string{
+		"repo1/svc/.abc/manifest_1.lock.yaml": manifestFor("github.com/org/templates/svc", "remote_git", "v1.0.0"),
+		"repo1/svc/a.txt":                     "hello",
+		"repo1/svc/sub/b.txt":                 "hello",
+		"repo1/svc/go.mod":                    "module example.com/mine",
+
+		"repo1/app/.abc/manifest_2.lock.yaml": manifestFor("github.com/org/templates/svc", "remote_git", "v2.0.0"),
+		"repo1/app/a.txt":                     "changed",
+
+		"repo2/.abc/manifest_3.lock.yaml": manifestFor("t/local", "local_git", "abc123"),
+		"repo2/a.txt":                     "hello",
+		"repo2/sub/b.txt":                 "hello",
+
+		"repo2/x/.abc/manifest_4.lock.yaml": manifestFor("github.com/org/broken", "remote_git", "v1.0.0"),
+		"repo2/x/a.txt":                     "hello",
+		"repo2/x/sub/b.txt":                 "hello",
+	}
+
+	cases := []struct {
+		name       string
+		args       []string
+		wantStdout string
+		wantCalls  []string
+		wantErr    string
+	}{
+		{
+			name: "json",
+			args: []string{"repo1", "repo2"},
+			wantStdout: `[
+  {
+    "dir": "repo1",
+    "dest": "app",
+    "manifest": "app/.abc/manifest_2.lock.yaml",
+    "template_location": "github.com/org/templates/svc",
+    "location_type": "remote_git",
+    "template_version": "v2.0.0",
+    "latest_version": "v2.0.0",
+    "status": "current",
+    "modification_time": "2024-03-11T12:00:00Z",
+    "drifted_files": [
+      "a.txt",
+      "sub/b.txt"
+    ]
+  },
+  {
+    "dir": "repo1",
+    "dest": "svc",
+    "manifest": "svc/.abc/manifest_1.lock.yaml",
+    "template_location": "github.com/org/templates/svc",
+    "location_type": "remote_git",
+    "template_version": "v1.0.0",
+    "latest_version": "v2.0.0",
+    "status": "outdated",
+    "modification_time": "2024-03-11T12:00:00Z",
+    "drifted_files": []
+  },
+  {
+    "dir": "repo2",
+    "dest": ".",
+    "manifest": ".abc/manifest_3.lock.yaml",
+    "template_location": "t/local",
+    "location_type": "local_git",
+    "template_version": "abc123",
+    "latest_version": "",
+    "status": "unknown",
+    "modification_time": "2024-03-11T12:00:00Z",
+    "drifted_files": []
+  },
+  {
+    "dir": "repo2",
+    "dest": "x",
+    "manifest": "x/.abc/manifest_4.lock.yaml",
+    "template_location": "github.com/org/broken",
+    "location_type": "remote_git",
+    "template_version": "v1.0.0",
+    "latest_version": "",
+    "status": "unknown",
+    "modification_time": "2024-03-11T12:00:00Z",
+    "drifted_files": []
+  }
+]
+`,
+			// Each location is only looked up once.
+			wantCalls: []string{
+				"github.com/org/templates/svc",
+				"t/local",
+				"github.com/org/broken",
+			},
+		},
+		{
+			name: "csv",
+			args: []string{"--format=csv", "repo1"},
+			wantStdout: "dir,dest,manifest,template_location,location_type,template_version,latest_version,status,modification_time,drifted_file_count,drifted_files\n" +
+				"repo1,app,app/.abc/manifest_2.lock.yaml,github.com/org/templates/svc,remote_git,v2.0.0,v2.0.0,current,2024-03-11T12:00:00Z,2,a.txt;sub/b.txt\n" +
+				"repo1,svc,svc/.abc/manifest_1.lock.yaml,github.com/org/templates/svc,remote_git,v1.0.0,v2.0.0,outdated,2024-03-11T12:00:00Z,0,\n",
+			wantCalls: []string{"github.com/org/templates/svc"},
+		},
+		{
+			name: "no_check_latest",
+			args: []string{"--format=csv", "--check-latest=false", "repo1/svc"},
+			wantStdout: "dir,dest,manifest,template_location,location_type,template_version,latest_version,status,modification_time,drifted_file_count,drifted_files\n" +
+				"repo1/svc,.,.abc/manifest_1.lock.yaml,github.com/org/templates/svc,remote_git,v1.0.0,,unknown,2024-03-11T12:00:00Z,0,\n",
+		},
+		{
+			name:       "no_manifests",
+			args:       []string{"repo1/svc/sub"},
+			wantStdout: "[]\n",
+		},
+		{
+			name:    "bad_format",
+			args:    []string{"--format=xml"},
+			wantErr: `--format must be one of json, csv, but got "xml"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tempDir, initial)
+
+			var calls []string
+			fakeLatest := func(_ context.Context, location, locType, gitProtocol string) (string, bool, error) {
+				calls = append(calls, location)
+				switch {
+				case locType != "remote_git":
+					return "", false, nil
+				case location == "github.com/org/broken":
+					return "", false, fmt.Errorf("fake error")
+				default:
+					return "v2.0.0", true, nil
+				}
+			}
+
+			cmd := &Command{}
+			err := cmd.Flags().Parse(tc.args)
+			if err == nil {
+				var stdout bytes.Buffer
+				err = cmd.realRun(context.Background(), &runParams{
+					cwd:           tempDir,
+					fs:            &common.RealFS{},
+					stdout:        &stdout,
+					latestVersion: fakeLatest,
+				})
+				if diff := cmp.Diff(stdout.String(), tc.wantStdout); diff != "" {
+					t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+				}
+			}
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(calls, tc.wantCalls); diff != "" {
+				t.Errorf("latest version lookups were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		version, latest, want string
+	}{
+		{version: "v1.2.3", latest: "v1.2.3", want: statusCurrent},
+		{version: "v1.2.3", latest: "v1.10.0", want: statusOutdated},
+		{version: "v1.3.0-rc1", latest: "v1.2.3", want: statusCurrent},
+		{version: "5f1e6a4", latest: "v1.2.3", want: statusUnknown},
+	}
+	for _, tc := range cases {
+		if got := status(tc.version, tc.latest); got != tc.want {
+			t.Errorf("status(%q, %q) = %q, want %q", tc.version, tc.latest, got, tc.want)
+		}
+	}
+}
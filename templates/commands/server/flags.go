@@ -0,0 +1,102 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// ServerFlags describes how to run the rendering service.
+type ServerFlags struct {
+	// Port is the TCP port to listen on.
+	Port string
+
+	// AllowBucketSources allows templates from gs:// and s3:// locations, in
+	// addition to remote git repos.
+	AllowBucketSources bool
+
+	// AllowedGitHosts are the hosts that templates in remote git repos may be
+	// cloned from.
+	AllowedGitHosts []string
+
+	// RequestTimeout limits how long a single request may take, including
+	// downloading the template. Zero means no limit.
+	RequestTimeout time.Duration
+
+	// See common/flags.MaxFiles().
+	MaxFiles int
+
+	// See common/flags.MaxBytes().
+	MaxBytes int64
+
+	// See common/flags.MaxPathDepth().
+	MaxPathDepth int
+
+	// See common/flags.GitProtocol().
+	GitProtocol string
+}
+
+// defaultAllowedGitHosts is the default value of --allowed-git-hosts.
+var defaultAllowedGitHosts = []string{"github.com", "gitlab.com"}
+
+func (f *ServerFlags) Register(set *cli.FlagSet) {
+	s := set.NewSection("SERVER OPTIONS")
+
+	s.StringVar(&cli.StringVar{
+		Name:    "port",
+		Example: "8080",
+		Target:  &f.Port,
+		Default: "8080",
+		EnvVar:  "PORT",
+		Usage:   "The TCP port to listen on for HTTP requests.",
+	})
+
+	s.BoolVar(&cli.BoolVar{
+		Name:    "allow-bucket-sources",
+		Target:  &f.AllowBucketSources,
+		Default: false,
+		Usage: "Allow requests for templates in gs:// and s3:// buckets, not just remote git repos. " +
+			"They're downloaded with the server's own credentials for those services: " +
+			"$GOOGLE_OAUTH_ACCESS_TOKEN for GCS (Application Default Credentials aren't used), " +
+			"and the AWS CLI's environment variables for S3.",
+	})
+
+	s.StringSliceVar(&cli.StringSliceVar{
+		Name:    "allowed-git-hosts",
+		Example: "github.com,git.example.com",
+		Target:  &f.AllowedGitHosts,
+		Default: defaultAllowedGitHosts,
+		Usage: "The hosts that templates in remote git repos may be cloned from, " +
+			"so that requests can't make the server clone from hosts on its internal network.",
+	})
+
+	s.DurationVar(&cli.DurationVar{
+		Name:    "request-timeout",
+		Example: "2m",
+		Target:  &f.RequestTimeout,
+		Default: 5 * time.Minute,
+		Usage:   "Fail any request that takes longer than this, including the time to download the template. Use 0 for no limit.",
+	})
+
+	s.IntVar(flags.MaxFiles(&f.MaxFiles))
+	s.Int64Var(flags.MaxBytes(&f.MaxBytes))
+	s.IntVar(flags.MaxPathDepth(&f.MaxPathDepth))
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&f.GitProtocol))
+}
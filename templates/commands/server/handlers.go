@@ -0,0 +1,418 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/abcxyz/abc/pkg/abcrender"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// maxRequestBytes limits the size of request bodies, which are small JSON
+// objects.
+const maxRequestBytes = 1 << 20
+
+// handler implements the HTTP+JSON API. Every request gets its own empty
+// in-memory filesystem, so templates can only be fetched from remote git
+// repos, and nothing is ever written to the server's disk other than the
+// temporary git clone. If allowBucketSources is true, templates can also be
+// fetched from gs:// and s3:// locations, using the server's own credentials
+// for those services and buffering the objects in temporary files on disk.
+// Remote git repos must be on one of allowedGitHosts.
+type handler struct {
+	allowBucketSources bool
+	allowedGitHosts    []string
+	gitProtocol        string
+
+	// limits is applied to each downloaded template and rendered output.
+	limits common.Limits
+
+	// requestTimeout, if non-zero, is the deadline for handling each request.
+	requestTimeout time.Duration
+
+	// newFS returns the filesystem to use for a single describe or lint
+	// request, and newRenderFS for a single render request. These are
+	// fakeable for testing.
+	newFS       func() common.FS
+	newRenderFS func() *abcrender.MemFS
+}
+
+// newHandler returns the http.Handler serving every API endpoint.
+func newHandler(h *handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/v1/describe", postOnly(h.handleDescribe))
+	mux.HandleFunc("/v1/lint", postOnly(h.handleLint))
+	mux.HandleFunc("/v1/render", postOnly(h.handleRender))
+	return mux
+}
+
+// RenderRequest is the request body for /v1/render.
+type RenderRequest struct {
+	// Source is the template location, like
+	// "github.com/abcxyz/abc/t/rest_server@latest".
+	Source string `json:"source"`
+
+	// Inputs is the template input values, keyed by input name.
+	Inputs map[string]string `json:"inputs"`
+}
+
+// RenderEvent is one line of the newline-delimited JSON stream returned by
+// /v1/render. There is one "file" event per output file, sent as soon as the
+// file is rendered, then an optional "stdout" event with the output of the
+// template's print actions, then a final "done" event. A stream without a
+// "done" event was cut off by a failure.
+type RenderEvent struct {
+	Type string `json:"type"`
+
+	// For "file" events: the slash-separated output path, and the file
+	// contents, which are base64 encoded in the JSON.
+	Path     string `json:"path,omitempty"`
+	Contents []byte `json:"contents,omitempty"`
+
+	// For "stdout" events.
+	Text string `json:"text,omitempty"`
+
+	// For "done" events: the total number of "file" events.
+	FileCount int `json:"file_count,omitempty"`
+}
+
+// SourceRequest is the request body for /v1/describe and /v1/lint.
+type SourceRequest struct {
+	// Source is the template location, like
+	// "github.com/abcxyz/abc/t/rest_server@latest".
+	Source string `json:"source"`
+}
+
+// DescribeResponse is the response body for /v1/describe.
+type DescribeResponse struct {
+	Description string           `json:"description"`
+	Inputs      []*DescribeInput `json:"inputs"`
+}
+
+// DescribeInput describes one template input in a DescribeResponse.
+type DescribeInput struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Type        string          `json:"type,omitempty"`
+	Default     *string         `json:"default,omitempty"`
+	DefaultFrom string          `json:"default_from,omitempty"`
+	Rules       []*DescribeRule `json:"rules,omitempty"`
+}
+
+// DescribeRule describes one input validation rule in a DescribeInput.
+type DescribeRule struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message,omitempty"`
+}
+
+// LintResponse is the response body for /v1/lint.
+type LintResponse struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// ErrorResponse is the response body for any request that fails.
+type ErrorResponse struct {
+	Error string `json:"error"`
+
+	// Code names the category of the error, like "input_validation", if it
+	// has one. See common/errs.Code().
+	Code string `json:"code,omitempty"`
+}
+
+func (h *handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(r.Context(), w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *handler) handleRender(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.withTimeout(r)
+	defer cancel()
+	logger := logging.FromContext(ctx).With("logger", "handleRender")
+
+	var req RenderRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := h.checkSource(req.Source); err != nil {
+		writeError(ctx, w, http.StatusBadRequest, err)
+		return
+	}
+
+	// The status is only written along with the first event, so that a
+	// render that fails before producing any files gets an error response.
+	var enc *json.Encoder
+	flusher, _ := w.(http.Flusher)
+	emit := func(ev *RenderEvent) error {
+		if enc == nil {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			enc = json.NewEncoder(w)
+		}
+		if err := enc.Encode(ev); err != nil {
+			return fmt.Errorf("failed writing render event: %w", err)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	var fileCount int
+	stdout := &bytes.Buffer{}
+	_, err := abcrender.Render(ctx, &abcrender.Options{
+		Cwd:          "/",
+		FS:           h.newRenderFS(),
+		GitProtocol:  h.gitProtocol,
+		Inputs:       req.Inputs,
+		MaxBytes:     h.limits.MaxBytes,
+		MaxFiles:     h.limits.MaxFiles,
+		MaxPathDepth: h.limits.MaxPathDepth,
+		OnFile: func(path string, contents []byte) error {
+			fileCount++
+			return emit(&RenderEvent{Type: "file", Path: path, Contents: contents})
+		},
+		Source: req.Source,
+		Stdout: stdout,
+	})
+	if err != nil {
+		if enc == nil {
+			h.writeFailure(ctx, w, err)
+			return
+		}
+		// The 200 status was already sent, so all that's left is to cut the
+		// stream off before the "done" event.
+		logger.WarnContext(ctx, "render failed after sending output", "error", err)
+		return
+	}
+
+	if stdout.Len() > 0 {
+		if err := emit(&RenderEvent{Type: "stdout", Text: stdout.String()}); err != nil {
+			logger.WarnContext(ctx, "failed sending render output", "error", err)
+			return
+		}
+	}
+	if err := emit(&RenderEvent{Type: "done", FileCount: fileCount}); err != nil {
+		logger.WarnContext(ctx, "failed sending render output", "error", err)
+	}
+}
+
+func (h *handler) handleDescribe(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.withTimeout(r)
+	defer cancel()
+
+	var req SourceRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s, err := h.loadSpec(ctx, req.Source)
+	if err != nil {
+		h.writeFailure(ctx, w, err)
+		return
+	}
+
+	writeJSON(ctx, w, http.StatusOK, describeResponse(s))
+}
+
+func (h *handler) handleLint(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := h.withTimeout(r)
+	defer cancel()
+
+	var req SourceRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	fsys := h.newFS()
+	templateDir, cleanup, err := h.download(ctx, fsys, req.Source)
+	if err != nil {
+		h.writeFailure(ctx, w, err)
+		return
+	}
+	defer cleanup()
+
+	// Unlike a download failure, an invalid spec file is a successful lint
+	// result.
+	if _, err := specutil.Load(ctx, fsys, templateDir, req.Source); err != nil {
+		writeJSON(ctx, w, http.StatusOK, &LintResponse{Valid: false, Error: err.Error()})
+		return
+	}
+	writeJSON(ctx, w, http.StatusOK, &LintResponse{Valid: true})
+}
+
+// loadSpec downloads the template at source and parses its spec file.
+func (h *handler) loadSpec(ctx context.Context, source string) (*spec.Spec, error) {
+	fsys := h.newFS()
+	templateDir, cleanup, err := h.download(ctx, fsys, source)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	return specutil.Load(ctx, fsys, templateDir, source) //nolint:wrapcheck
+}
+
+// download fetches the template at source into a new temp directory in fsys.
+// The returned cleanup function removes the temp directory.
+func (h *handler) download(ctx context.Context, fsys common.FS, source string) (_ string, cleanup func(), _ error) {
+	if err := h.checkSource(source); err != nil {
+		return "", nil, err
+	}
+
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:         "/",
+		FS:          fsys,
+		GitProtocol: h.gitProtocol,
+		Limits:      &h.limits,
+		Source:      source,
+	})
+	if err != nil {
+		return "", nil, err //nolint:wrapcheck
+	}
+
+	templateDir, err := fsys.MkdirTemp("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory to use as template directory: %w", err)
+	}
+	cleanup = func() {
+		if err := fsys.RemoveAll(templateDir); err != nil {
+			logging.FromContext(ctx).WarnContext(ctx, "failed removing template directory",
+				"path", templateDir, "error", err)
+		}
+	}
+
+	if _, err := downloader.Download(ctx, "/", templateDir); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to download/copy template: %w", err)
+	}
+	return templateDir, cleanup, nil
+}
+
+// checkSource returns an error if the server doesn't accept the given template
+// source.
+func (h *handler) checkSource(source string) error {
+	if source == "" {
+		return fmt.Errorf(`the "source" field is required`)
+	}
+	if !h.allowBucketSources && templatesource.IsBucketSource(source) {
+		return fmt.Errorf("template source %q is in a gs:// or s3:// bucket, which this server doesn't allow; start it with --allow-bucket-sources to allow it", source)
+	}
+	if host, ok := templatesource.RemoteGitHost(source); ok && !slices.Contains(h.allowedGitHosts, host) {
+		return fmt.Errorf("template source %q is a git repo on %s, which this server doesn't allow; the allowed hosts are [%s], which can be changed with --allowed-git-hosts",
+			source, host, strings.Join(h.allowedGitHosts, ", "))
+	}
+	return nil
+}
+
+// withTimeout returns the context for handling r, which is canceled after
+// h.requestTimeout if that's set.
+func (h *handler) withTimeout(r *http.Request) (context.Context, context.CancelFunc) {
+	if h.requestTimeout == 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), h.requestTimeout)
+}
+
+// writeFailure writes the error response for a request that failed with err
+// after it was accepted, which is a timeout if the request's deadline passed.
+func (h *handler) writeFailure(ctx context.Context, w http.ResponseWriter, err error) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		writeError(ctx, w, http.StatusGatewayTimeout,
+			fmt.Errorf("the request took longer than the server's limit of %s (set by --request-timeout): %w", h.requestTimeout, err))
+		return
+	}
+	writeError(ctx, w, http.StatusBadRequest, err)
+}
+
+func describeResponse(s *spec.Spec) *DescribeResponse {
+	out := &DescribeResponse{
+		Description: s.Desc.Val,
+		Inputs:      make([]*DescribeInput, 0, len(s.Inputs)),
+	}
+	for _, in := range s.Inputs {
+		di := &DescribeInput{
+			Name:        in.Name.Val,
+			Description: in.Desc.Val,
+			Type:        in.Type.Val,
+			DefaultFrom: in.DefaultFrom.Val,
+		}
+		if in.Default != nil {
+			def := in.Default.Val
+			di.Default = &def
+		}
+		for _, rule := range in.Rules {
+			di.Rules = append(di.Rules, &DescribeRule{
+				Rule:    rule.Rule.Val,
+				Message: rule.Message.Val,
+			})
+		}
+		out.Inputs = append(out.Inputs, di)
+	}
+	return out
+}
+
+// postOnly wraps a handler to reject any method other than POST.
+func postOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(r.Context(), w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed, use POST", r.Method))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// readJSON decodes the request body into out. On failure, it writes an error
+// response and returns false.
+func readJSON(w http.ResponseWriter, r *http.Request, out any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		writeError(r.Context(), w, http.StatusBadRequest, fmt.Errorf("failed to parse request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeError(ctx context.Context, w http.ResponseWriter, status int, err error) {
+	logging.FromContext(ctx).DebugContext(ctx, "request failed", "status", status, "error", err)
+	writeJSON(ctx, w, status, &ErrorResponse{Error: err.Error(), Code: errs.Code(err)})
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed writing response", "error", err)
+	}
+}
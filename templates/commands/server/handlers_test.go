@@ -0,0 +1,440 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/pkg/abcrender"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+const specContents = `
+api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+desc: 'A template for the ages'
+inputs:
+- name: 'person'
+  desc: 'The name of a person'
+  default: 'Alice'
+  rules:
+  - rule: 'size(person) < 10'
+    message: 'too long'
+steps:
+- desc: 'Include some files'
+  action: 'include'
+  params:
+    paths: ['greeting.txt', 'dir']
+- desc: 'Replace "Alice" with [input]'
+  action: 'string_replace'
+  params:
+    paths: ['.']
+    replacements:
+    - to_replace: 'Alice'
+      with: '{{.person}}'
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'rendered for {{.person}}'
+`
+
+// newTestServer returns a server whose filesystem for each request contains
+// the given template files under /template. The configure functions can
+// change the handler's settings.
+func newTestServer(t *testing.T, templateFiles map[string]string, configure ...func(*handler)) *httptest.Server {
+	t.Helper()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	h := &handler{
+		allowedGitHosts: defaultAllowedGitHosts,
+		gitProtocol:     "https",
+		newFS: func() common.FS {
+			mfs := &common.MemFS{}
+			for name, contents := range templateFiles {
+				path := filepath.Join("/template", name)
+				if err := mfs.MkdirAll(filepath.Dir(path), common.OwnerRWXPerms); err != nil {
+					t.Error(err)
+				}
+				if err := mfs.WriteFile(path, []byte(contents), common.OwnerRWPerms); err != nil {
+					t.Error(err)
+				}
+			}
+			return mfs
+		},
+		newRenderFS: func() *abcrender.MemFS {
+			mfs := &abcrender.MemFS{}
+			for name, contents := range templateFiles {
+				if err := mfs.WriteFile(filepath.Join("/template", name), []byte(contents)); err != nil {
+					t.Error(err)
+				}
+			}
+			return mfs
+		},
+	}
+	for _, c := range configure {
+		c(h)
+	}
+
+	srv := httptest.NewUnstartedServer(newHandler(h))
+	srv.Config.BaseContext = func(_ net.Listener) context.Context { return ctx }
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func post(t *testing.T, url, body string) (int, string) {
+	t.Helper()
+
+	resp, err := http.Post(url, "application/json", strings.NewReader(body)) //nolint:noctx
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	sb := &strings.Builder{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		sb.WriteString(scanner.Text())
+		sb.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, sb.String()
+}
+
+func TestHandleRender(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantEvents  []*RenderEvent
+		wantErrBody string
+	}{
+		{
+			name:       "success",
+			body:       `{"source": "/template", "inputs": {"person": "Bob"}}`,
+			wantStatus: http.StatusOK,
+			wantEvents: []*RenderEvent{
+				{Type: "file", Path: "dir/other.txt", Contents: []byte("other contents")},
+				{Type: "file", Path: "greeting.txt", Contents: []byte("hello Bob")},
+				{Type: "stdout", Text: "rendered for Bob\n"},
+				{Type: "done", FileCount: 2},
+			},
+		},
+		{
+			name:        "missing_source",
+			body:        `{"inputs": {"person": "Bob"}}`,
+			wantStatus:  http.StatusBadRequest,
+			wantErrBody: `the \"source\" field is required`,
+		},
+		{
+			name:        "unknown_field",
+			body:        `{"source": "/template", "bogus": 1}`,
+			wantStatus:  http.StatusBadRequest,
+			wantErrBody: `unknown field \"bogus\"`,
+		},
+		{
+			name:        "failed_validation",
+			body:        `{"source": "/template", "inputs": {"person": "Bartholomew"}}`,
+			wantStatus:  http.StatusBadRequest,
+			wantErrBody: "too long",
+		},
+		{
+			name:        "nonexistent_source",
+			body:        `{"source": "/nonexistent"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantErrBody: "isn't a valid template name or doesn't exist",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newTestServer(t, map[string]string{
+				"spec.yaml":     specContents,
+				"greeting.txt":  "hello Alice",
+				"dir/other.txt": "other contents",
+			})
+
+			status, body := post(t, srv.URL+"/v1/render", tc.body)
+			if status != tc.wantStatus {
+				t.Errorf("got status %d, want %d; body: %s", status, tc.wantStatus, body)
+			}
+			if tc.wantErrBody != "" {
+				if !strings.Contains(body, tc.wantErrBody) {
+					t.Errorf("got body %q, want it to contain %q", body, tc.wantErrBody)
+				}
+				return
+			}
+
+			var got []*RenderEvent
+			for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+				var ev RenderEvent
+				if err := json.Unmarshal([]byte(line), &ev); err != nil {
+					t.Fatalf("failed parsing event %q: %v", line, err)
+				}
+				got = append(got, &ev)
+			}
+			if diff := cmp.Diff(got, tc.wantEvents); diff != "" {
+				t.Errorf("render events were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+// TestHandleRender_ProcessEnv can't be parallel, since it sets an environment
+// variable.
+func TestHandleRender_ProcessEnv(t *testing.T) {
+	t.Setenv("ABC_TEST_SERVER_SECRET", "hunter2")
+
+	srv := newTestServer(t, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template that asks for an environment variable'
+env_vars: ['ABC_TEST_SERVER_SECRET']
+steps:
+- desc: 'Print the environment variable'
+  action: 'print'
+  params:
+    message: 'secret={{._env_ABC_TEST_SERVER_SECRET}}'
+`,
+	})
+
+	status, body := post(t, srv.URL+"/v1/render", `{"source": "/template"}`)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d; body: %s", status, http.StatusOK, body)
+	}
+	if strings.Contains(body, "hunter2") {
+		t.Errorf("the server's environment was exposed to the template: %s", body)
+	}
+	if want := `"text":"secret=\n"`; !strings.Contains(body, want) {
+		t.Errorf("got body %q, want it to contain %q", body, want)
+	}
+}
+
+func TestHandleDescribe(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, map[string]string{
+		"spec.yaml": specContents,
+	})
+
+	status, body := post(t, srv.URL+"/v1/describe", `{"source": "/template"}`)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want 200; body: %s", status, body)
+	}
+
+	var got DescribeResponse
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	def := "Alice"
+	want := DescribeResponse{
+		Description: "A template for the ages",
+		Inputs: []*DescribeInput{
+			{
+				Name:        "person",
+				Description: "The name of a person",
+				Default:     &def,
+				Rules: []*DescribeRule{
+					{Rule: "size(person) < 10", Message: "too long"},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("describe response was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestHandleLint(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		spec       string
+		wantStatus int
+		want       *LintResponse
+	}{
+		{
+			name:       "valid",
+			spec:       specContents,
+			wantStatus: http.StatusOK,
+			want:       &LintResponse{Valid: true},
+		},
+		{
+			name: "invalid",
+			spec: `
+api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+desc: 'missing steps'
+`,
+			wantStatus: http.StatusOK,
+			want: &LintResponse{
+				Valid: false,
+				Error: `error reading template spec file: validation failed in spec.yaml: at line 2 column 1: field "steps" is required`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newTestServer(t, map[string]string{
+				"spec.yaml": tc.spec,
+			})
+
+			status, body := post(t, srv.URL+"/v1/lint", `{"source": "/template"}`)
+			if status != tc.wantStatus {
+				t.Errorf("got status %d, want %d; body: %s", status, tc.wantStatus, body)
+			}
+			var got LintResponse
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(&got, tc.want); diff != "" {
+				t.Errorf("lint response was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestBucketSourceRejected(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, map[string]string{
+		"spec.yaml": specContents,
+	})
+
+	for _, endpoint := range []string{"/v1/render", "/v1/describe", "/v1/lint"} {
+		for _, source := range []string{"gs://my-bucket/my-template", "s3://my-bucket/my-template.tar.gz"} {
+			status, body := post(t, srv.URL+endpoint, `{"source": "`+source+`"}`)
+			if status != http.StatusBadRequest {
+				t.Errorf("%s %s: got status %d, want %d; body: %s", endpoint, source, status, http.StatusBadRequest, body)
+			}
+			if want := "start it with --allow-bucket-sources"; !strings.Contains(body, want) {
+				t.Errorf("%s %s: got body %q, want it to contain %q", endpoint, source, body, want)
+			}
+		}
+	}
+}
+
+func TestGitHostRejected(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, nil)
+
+	for _, endpoint := range []string{"/v1/render", "/v1/describe", "/v1/lint"} {
+		for _, source := range []string{"git.internal.example.com/myorg/myrepo.git", "169.254.169.254/myorg/myrepo.git//subdir?ref=main"} {
+			status, body := post(t, srv.URL+endpoint, `{"source": "`+source+`"}`)
+			if status != http.StatusBadRequest {
+				t.Errorf("%s %s: got status %d, want %d; body: %s", endpoint, source, status, http.StatusBadRequest, body)
+			}
+			if want := "can be changed with --allowed-git-hosts"; !strings.Contains(body, want) {
+				t.Errorf("%s %s: got body %q, want it to contain %q", endpoint, source, body, want)
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		handler    func(*handler)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "request_timeout",
+			handler: func(h *handler) {
+				h.requestTimeout = time.Nanosecond
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   "(set by --request-timeout)",
+		},
+		{
+			name: "max_files",
+			handler: func(h *handler) {
+				h.limits.MaxFiles = 2
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "limit set by --max-files",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newTestServer(t, map[string]string{
+				"spec.yaml":     specContents,
+				"greeting.txt":  "hello Alice",
+				"dir/other.txt": "other contents",
+			}, tc.handler)
+
+			for endpoint, reqBody := range map[string]string{
+				"/v1/render":   `{"source": "/template", "inputs": {"person": "Bob"}}`,
+				"/v1/describe": `{"source": "/template"}`,
+			} {
+				status, body := post(t, srv.URL+endpoint, reqBody)
+				if status != tc.wantStatus {
+					t.Errorf("%s: got status %d, want %d; body: %s", endpoint, status, tc.wantStatus, body)
+				}
+				if !strings.Contains(body, tc.wantBody) {
+					t.Errorf("%s: got body %q, want it to contain %q", endpoint, body, tc.wantBody)
+				}
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, nil)
+	resp, err := http.Get(srv.URL + "/v1/render") //nolint:noctx
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusMethodNotAllowed; got != want {
+		t.Errorf("got status %d, want %d", got, want)
+	}
+}
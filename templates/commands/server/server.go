@@ -0,0 +1,100 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server implements the "server" subcommand, which exposes template
+// rendering as an HTTP+JSON service.
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abcxyz/abc/pkg/abcrender"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/serving"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags ServerFlags
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "run an HTTP server that renders, describes, and lints templates"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+The {{ COMMAND }} command starts an HTTP+JSON server so that other systems,
+like internal developer portals, can use abc as a service. It runs until
+interrupted.
+
+Endpoints (all request and response bodies are JSON):
+
+  POST /v1/render    {"source": "...", "inputs": {"name": "value"}}
+                     Responds with a stream of newline-delimited JSON events,
+                     one per output file, followed by a final "done" event.
+  POST /v1/describe  {"source": "..."}
+                     Responds with the template description and inputs.
+  POST /v1/lint      {"source": "..."}
+                     Responds with whether the template's spec file is valid.
+  GET  /healthz      Responds with {"status": "ok"}.
+
+Only templates in remote git repos on the hosts in --allowed-git-hosts can be
+used, plus gs:// and s3:// buckets if --allow-bucket-sources is given; local
+directories on the server are not accessible. Rendered output is never written
+to the server's disk. Each request fails with a 504 status if it takes longer
+than --request-timeout, and templates are subject to the --max-* size limits.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	h := newHandler(&handler{
+		allowBucketSources: c.flags.AllowBucketSources,
+		allowedGitHosts:    c.flags.AllowedGitHosts,
+		gitProtocol:        c.flags.GitProtocol,
+		limits: common.Limits{
+			MaxFiles:     c.flags.MaxFiles,
+			MaxBytes:     c.flags.MaxBytes,
+			MaxPathDepth: c.flags.MaxPathDepth,
+		},
+		requestTimeout: c.flags.RequestTimeout,
+		newFS: func() common.FS {
+			return &common.MemFS{}
+		},
+		newRenderFS: func() *abcrender.MemFS {
+			return &abcrender.MemFS{}
+		},
+	})
+
+	srv, err := serving.New(c.flags.Port)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+	return srv.StartHTTPHandler(ctx, h) //nolint:wrapcheck
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testmatrix
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// TestMatrixFlags describes what template to test and with which inputs.
+type TestMatrixFlags struct {
+	// Source is the location of the template to test.
+	//
+	// Example: github.com/abcxyz/abc/t/rest_server@latest
+	Source string
+
+	// Matrix is the path of the matrix.yaml file. If empty, it's
+	// DefaultMatrixFile in the template.
+	Matrix string
+
+	// AllowExec allows the template to run external programs, like the
+	// "command" of a "format" action.
+	AllowExec bool
+
+	// See common/flags.Inputs(). These are used in every combination, unless
+	// the matrix has other values for them.
+	Inputs map[string]string
+
+	// See common/flags.InputFiles().
+	InputFiles []string
+
+	// See common/flags.KeepTempDirs().
+	KeepTempDirs bool
+
+	// GitProtocol either https or ssh.
+	GitProtocol string
+}
+
+func (r *TestMatrixFlags) Register(set *cli.FlagSet) {
+	t := set.NewSection("TEST MATRIX OPTIONS")
+	t.StringVar(&cli.StringVar{
+		Name:    "matrix",
+		Example: "matrix.yaml",
+		Target:  &r.Matrix,
+		Usage: "The file listing the values to try for each input. Defaults to " + DefaultMatrixFile +
+			" in the template.",
+	})
+	t.BoolVar(&cli.BoolVar{
+		Name:    "allow-exec",
+		Target:  &r.AllowExec,
+		Default: false,
+		Usage:   "Allow the template to run external programs on this machine when it's rendered, like formatters named in the \"command\" of a \"format\" action.",
+	})
+	t.StringMapVar(flags.Inputs(&r.Inputs))
+	t.StringSliceVar(flags.InputFiles(&r.InputFiles))
+	t.BoolVar(flags.KeepTempDirs(&r.KeepTempDirs))
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	// Default source to the first CLI argument, if given
+	set.AfterParse(func(existingErr error) error {
+		r.Source = strings.TrimSpace(set.Arg(0))
+		if r.Source == "" {
+			return fmt.Errorf("missing <source> file")
+		}
+		return nil
+	})
+}
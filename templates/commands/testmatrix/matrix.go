@@ -0,0 +1,156 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testmatrix
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultMatrixFile is where the matrix is read from, relative to the template
+// directory, if --matrix isn't given.
+const DefaultMatrixFile = "testdata/matrix.yaml"
+
+// Matrix is the contents of a matrix.yaml file, which lists the values to try
+// for each input. Every combination of them is rendered, except for those
+// that match an exclude rule.
+type Matrix struct {
+	// Inputs are the values to try for each input, like
+	// {"environment": ["dev", "prod"]}.
+	Inputs map[string][]string `yaml:"inputs"`
+
+	// Exclude are the combinations to skip. A combination is skipped if it
+	// has all the input values of any one of the rules, like
+	// {"environment": "dev", "enable_cdn": "true"}.
+	Exclude []map[string]string `yaml:"exclude"`
+}
+
+// parseMatrix decodes and validates the matrix.yaml in buf, which was read
+// from path.
+func parseMatrix(buf []byte, path string) (*Matrix, error) {
+	var m Matrix
+	dec := yaml.NewDecoder(strings.NewReader(string(buf)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed parsing matrix %q: %w", path, err)
+	}
+	if len(m.Inputs) == 0 {
+		return nil, fmt.Errorf("the matrix %q has no inputs", path)
+	}
+	for _, name := range m.inputNames() {
+		vals := m.Inputs[name]
+		if len(vals) == 0 {
+			return nil, fmt.Errorf("input %q in the matrix %q has no values", name, path)
+		}
+		seen := make(map[string]struct{}, len(vals))
+		for _, v := range vals {
+			if _, ok := seen[v]; ok {
+				return nil, fmt.Errorf("input %q in the matrix %q has the value %q more than once", name, path, v)
+			}
+			seen[v] = struct{}{}
+		}
+	}
+	for i, rule := range m.Exclude {
+		if len(rule) == 0 {
+			return nil, fmt.Errorf("exclude rule %d in the matrix %q is empty", i, path)
+		}
+		for name, val := range rule {
+			vals, ok := m.Inputs[name]
+			if !ok {
+				return nil, fmt.Errorf("exclude rule %d in the matrix %q names %q, which isn't one of the matrix inputs", i, path, name)
+			}
+			if !slices.Contains(vals, val) {
+				return nil, fmt.Errorf("exclude rule %d in the matrix %q has %s=%q, which isn't one of the values of %q", i, path, name, val, name)
+			}
+		}
+	}
+	return &m, nil
+}
+
+// inputNames returns the names of the matrix inputs in sorted order.
+func (m *Matrix) inputNames() []string {
+	out := maps.Keys(m.Inputs)
+	sort.Strings(out)
+	return out
+}
+
+// combinations returns the cartesian product of the input values, leaving
+// out those that match an exclude rule, and the number that were left out.
+// The inputs are varied in sorted order of their names, with the last one
+// changing fastest, and the values of each are tried in the order listed.
+func (m *Matrix) combinations() ([]map[string]string, int) {
+	names := m.inputNames()
+	var out []map[string]string
+	var excluded int
+	idx := make([]int, len(names))
+	for {
+		combo := make(map[string]string, len(names))
+		for i, name := range names {
+			combo[name] = m.Inputs[name][idx[i]]
+		}
+		if m.excludes(combo) {
+			excluded++
+		} else {
+			out = append(out, combo)
+		}
+
+		// Advance idx like an odometer.
+		i := len(names) - 1
+		for ; i >= 0; i-- {
+			idx[i]++
+			if idx[i] < len(m.Inputs[names[i]]) {
+				break
+			}
+			idx[i] = 0
+		}
+		if i < 0 {
+			return out, excluded
+		}
+	}
+}
+
+// excludes returns whether combo matches any of the exclude rules.
+func (m *Matrix) excludes(combo map[string]string) bool {
+	for _, rule := range m.Exclude {
+		matched := true
+		for name, val := range rule {
+			if combo[name] != val {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// describe formats combo as "name=value" pairs in sorted order of the names,
+// like "enable_cdn=true environment=dev".
+func describe(combo map[string]string) string {
+	names := maps.Keys(combo)
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+combo[name])
+	}
+	return strings.Join(parts, " ")
+}
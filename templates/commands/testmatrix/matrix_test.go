@@ -0,0 +1,180 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testmatrix
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestParseMatrix(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		in      string
+		want    *Matrix
+		wantErr string
+	}{
+		{
+			name: "valid",
+			in: `inputs:
+  environment: ['dev', 'prod']
+  enable_cdn: [true, false]
+  replicas: [1, 3]
+exclude:
+  - environment: 'dev'
+    enable_cdn: true
+`,
+			want: &Matrix{
+				Inputs: map[string][]string{
+					"environment": {"dev", "prod"},
+					"enable_cdn":  {"true", "false"},
+					"replicas":    {"1", "3"},
+				},
+				Exclude: []map[string]string{
+					{"environment": "dev", "enable_cdn": "true"},
+				},
+			},
+		},
+		{
+			name:    "unknown_field",
+			in:      "inputs: {a: [x]}\nexcludes: []\n",
+			wantErr: "field excludes not found",
+		},
+		{
+			name:    "no_inputs",
+			in:      "exclude: []\n",
+			wantErr: `the matrix "matrix.yaml" has no inputs`,
+		},
+		{
+			name:    "no_values",
+			in:      "inputs: {a: [x], b: []}\n",
+			wantErr: `input "b" in the matrix "matrix.yaml" has no values`,
+		},
+		{
+			name:    "duplicate_value",
+			in:      "inputs: {a: [x, y, x]}\n",
+			wantErr: `input "a" in the matrix "matrix.yaml" has the value "x" more than once`,
+		},
+		{
+			name:    "empty_exclude_rule",
+			in:      "inputs: {a: [x]}\nexclude: [{}]\n",
+			wantErr: `exclude rule 0 in the matrix "matrix.yaml" is empty`,
+		},
+		{
+			name:    "exclude_unknown_input",
+			in:      "inputs: {a: [x]}\nexclude: [{b: x}]\n",
+			wantErr: `exclude rule 0 in the matrix "matrix.yaml" names "b", which isn't one of the matrix inputs`,
+		},
+		{
+			name:    "exclude_unknown_value",
+			in:      "inputs: {a: [x]}\nexclude: [{a: x}, {a: y}]\n",
+			wantErr: `exclude rule 1 in the matrix "matrix.yaml" has a="y", which isn't one of the values of "a"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseMatrix([]byte(tc.in), "matrix.yaml")
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("matrix was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		matrix       *Matrix
+		want         []string
+		wantExcluded int
+	}{
+		{
+			name: "one_input",
+			matrix: &Matrix{
+				Inputs: map[string][]string{"a": {"x", "y"}},
+			},
+			want: []string{"a=x", "a=y"},
+		},
+		{
+			name: "cartesian_product",
+			matrix: &Matrix{
+				Inputs: map[string][]string{
+					"b": {"1", "2", "3"},
+					"a": {"y", "x"},
+				},
+			},
+			want: []string{"a=y b=1", "a=y b=2", "a=y b=3", "a=x b=1", "a=x b=2", "a=x b=3"},
+		},
+		{
+			name: "excludes",
+			matrix: &Matrix{
+				Inputs: map[string][]string{
+					"a": {"x", "y"},
+					"b": {"1", "2"},
+					"c": {"on", "off"},
+				},
+				Exclude: []map[string]string{
+					{"a": "x", "c": "on"},
+					{"a": "y", "b": "2", "c": "off"},
+				},
+			},
+			want:         []string{"a=x b=1 c=off", "a=x b=2 c=off", "a=y b=1 c=on", "a=y b=1 c=off", "a=y b=2 c=on"},
+			wantExcluded: 3,
+		},
+		{
+			name: "all_excluded",
+			matrix: &Matrix{
+				Inputs:  map[string][]string{"a": {"x"}},
+				Exclude: []map[string]string{{"a": "x"}},
+			},
+			wantExcluded: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			combos, excluded := tc.matrix.combinations()
+			var got []string
+			for _, combo := range combos {
+				got = append(got, describe(combo))
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("combinations were not as expected (-got,+want): %s", diff)
+			}
+			if excluded != tc.wantExcluded {
+				t.Errorf("got %d excluded combinations, want %d", excluded, tc.wantExcluded)
+			}
+		})
+	}
+}
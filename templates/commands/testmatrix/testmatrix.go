@@ -0,0 +1,237 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testmatrix implements the "templates test-matrix" subcommand, which
+// renders a template with every combination of the input values listed in a
+// matrix file, to find the combinations that don't work.
+package testmatrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+	"golang.org/x/exp/maps"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags TestMatrixFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "render a template with every combination of some input values"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <source>
+
+The {{ COMMAND }} command renders the template <source> once for each
+combination of the input values listed in a matrix file, each time into a new
+empty temporary directory, and reports the combinations that failed input
+validation or failed to render. It finds bugs that only show up with some
+combinations of inputs, which golden tests, with their few hand-picked sets of
+inputs, often miss.
+
+The matrix file is ` + DefaultMatrixFile + ` in the template, unless --matrix is
+given. It lists the values to try for each input, and optionally the
+combinations to skip:
+
+  inputs:
+    environment: ['dev', 'prod']
+    region: ['us-central1', 'europe-west1']
+    enable_cdn: ['true', 'false']
+  exclude:
+    - environment: 'dev'
+      enable_cdn: 'true'
+
+Every combination of the values is rendered, except those that have all the
+values of any one of the exclude rules. Inputs that aren't in the matrix get
+their values from --input and --input-file, or their defaults; there's no
+prompting.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type runParams struct {
+	clock  clock.Clock
+	cwd    string
+	fs     common.FS
+	stdout io.Writer
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		clock:  clock.New(),
+		cwd:    wd,
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
+	tempTracker := tempdir.NewDirTracker(rp.fs, c.flags.KeepTempDirs)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory to download the template into: %w", err)
+	}
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:         rp.cwd,
+		Source:      c.flags.Source,
+		GitProtocol: c.flags.GitProtocol,
+		FS:          rp.fs,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if _, err := downloader.Download(ctx, rp.cwd, templateDir); err != nil {
+		return fmt.Errorf("failed to download/copy template: %w", err)
+	}
+
+	matrix, err := c.loadMatrix(rp, templateDir)
+	if err != nil {
+		return err
+	}
+	combos, excluded := matrix.combinations()
+
+	var failed int
+	for _, combo := range combos {
+		err := c.render(ctx, rp, downloader, tempTracker, combo)
+		if err == nil {
+			if _, err := fmt.Fprintf(rp.stdout, "ok   %s\n", describe(combo)); err != nil {
+				return fmt.Errorf("failed writing output: %w", err)
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		failed++
+		what := "failed to render"
+		if errors.Is(err, errs.ErrInputValidation) {
+			what = "failed input validation"
+		}
+		if _, err := fmt.Fprintf(rp.stdout, "FAIL %s: %s:\n%s\n", describe(combo), what, indent(err.Error())); err != nil {
+			return fmt.Errorf("failed writing output: %w", err)
+		}
+	}
+
+	summary := fmt.Sprintf("%d of %d combination(s) passed", len(combos)-failed, len(combos))
+	if excluded > 0 {
+		summary += fmt.Sprintf(", %d excluded", excluded)
+	}
+	if _, err := fmt.Fprintln(rp.stdout, summary); err != nil {
+		return fmt.Errorf("failed writing output: %w", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d input combination(s) failed", failed, len(combos))
+	}
+	return nil
+}
+
+// loadMatrix reads the matrix file given with --matrix, or the default one in
+// the downloaded template.
+func (c *Command) loadMatrix(rp *runParams, templateDir string) (*Matrix, error) {
+	path, displayPath := c.flags.Matrix, c.flags.Matrix
+	if path == "" {
+		path = filepath.Join(templateDir, filepath.FromSlash(DefaultMatrixFile))
+		displayPath = DefaultMatrixFile
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(rp.cwd, path)
+	}
+	buf, err := rp.fs.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && c.flags.Matrix == "" {
+			return nil, fmt.Errorf("the template has no %s; create one, or give another matrix file with --matrix", DefaultMatrixFile)
+		}
+		return nil, fmt.Errorf("failed reading matrix: %w", err)
+	}
+	return parseMatrix(buf, displayPath)
+}
+
+// indent indents the non-empty lines of msg, so that a multi-line error is
+// shown under the combination that it's about.
+func indent(msg string) string {
+	lines := strings.Split(strings.TrimRight(msg, "\n"), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = "    " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// render renders the template with the inputs of combo, on top of those given
+// with --input, into a new empty temporary directory, without prompting.
+func (c *Command) render(ctx context.Context, rp *runParams, downloader templatesource.Downloader, tempTracker *tempdir.DirTracker, combo map[string]string) error {
+	destDir, err := tempTracker.MkdirTempTracked("", tempdir.TestMatrixRenderNamePart)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory to render into: %w", err)
+	}
+	inputs := maps.Clone(c.flags.Inputs)
+	if inputs == nil {
+		inputs = make(map[string]string, len(combo))
+	}
+	maps.Copy(inputs, combo)
+
+	return render.Render(ctx, &render.Params{ //nolint:wrapcheck
+		AllowExec:         c.flags.AllowExec,
+		Clock:             rp.clock,
+		Cwd:               rp.cwd,
+		DestDir:           destDir,
+		Downloader:        downloader,
+		FS:                rp.fs,
+		Inputs:            inputs,
+		InputFiles:        c.flags.InputFiles,
+		KeepTempDirs:      c.flags.KeepTempDirs,
+		LookupEnv:         c.LookupEnv,
+		SourceForMessages: c.flags.Source,
+		Stdout:            io.Discard,
+	})
+}
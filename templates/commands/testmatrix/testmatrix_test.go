@@ -0,0 +1,290 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testmatrix
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestTestMatrixFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    TestMatrixFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--matrix", "matrix.yaml",
+				"--allow-exec",
+				"--input", "x=y",
+				"--input-file", "abc-inputs.yaml",
+				"--keep-temp-dirs",
+				"--git-protocol", "ssh",
+				"helloworld@v1",
+			},
+			want: TestMatrixFlags{
+				Source:       "helloworld@v1",
+				Matrix:       "matrix.yaml",
+				AllowExec:    true,
+				Inputs:       map[string]string{"x": "y"},
+				InputFiles:   []string{"abc-inputs.yaml"},
+				KeepTempDirs: true,
+				GitProtocol:  "ssh",
+			},
+		},
+		{
+			name: "minimal_flags_present",
+			args: []string{"helloworld@v1"},
+			want: TestMatrixFlags{
+				Source:      "helloworld@v1",
+				Inputs:      map[string]string{},
+				GitProtocol: "https",
+			},
+		},
+		{
+			name:    "required_source_is_missing",
+			args:    []string{},
+			wantErr: "missing <source> file",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd Command
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if err != nil || tc.wantErr != "" {
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+// testSpec fails input validation when environment is "dev" and enable_cdn
+// is "true", and fails to render when environment is "prod" and region is
+// "europe-west1", because cdn_domain isn't set.
+const testSpec = `api_version: 'cli.abcxyz.dev/v1beta5'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'environment'
+    desc: 'The environment'
+  - name: 'region'
+    desc: 'The region'
+  - name: 'enable_cdn'
+    desc: 'Whether to use a CDN'
+    default: 'false'
+    rules:
+      - rule: '!(environment == "dev" && enable_cdn == "true")'
+        message: 'dev has no CDN'
+  - name: 'owner'
+    desc: 'The owner'
+    default: 'nobody'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['main.tf']
+  - desc: 'Fill it in'
+    action: 'go_template'
+    params:
+      paths: ['main.tf']
+`
+
+const testMainTF = `# owner: {{.owner}}
+region = "{{.region}}"
+{{- if and (eq .environment "prod") (eq .region "europe-west1") }}
+cdn = "{{.cdn_domain}}"
+{{- end }}
+`
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		templateContents map[string]string
+		dirContents      map[string]string // in the working directory
+		matrix           string
+		inputs           map[string]string
+		wantStdout       string
+		wantErr          string
+	}{
+		{
+			name: "all_pass",
+			templateContents: map[string]string{
+				"spec.yaml": testSpec,
+				"main.tf":   testMainTF,
+				"testdata/matrix.yaml": `inputs:
+  environment: ['dev', 'prod']
+  region: ['us-central1']
+`,
+			},
+			wantStdout: `ok   environment=dev region=us-central1
+ok   environment=prod region=us-central1
+2 of 2 combination(s) passed
+`,
+		},
+		{
+			name: "failures",
+			templateContents: map[string]string{
+				"spec.yaml": testSpec,
+				"main.tf":   testMainTF,
+				"testdata/matrix.yaml": `inputs:
+  environment: ['dev', 'prod']
+  region: ['us-central1', 'europe-west1']
+  enable_cdn: [true, false]
+exclude:
+  - environment: 'prod'
+    enable_cdn: true
+`,
+			},
+			wantStdout: `FAIL enable_cdn=true environment=dev region=us-central1: failed input validation:
+    input validation failed:
+
+    Input name:   enable_cdn
+    Input value:  true
+    Rule:         !(environment == "dev" && enable_cdn == "true")
+    Rule msg:     dev has no CDN
+FAIL enable_cdn=true environment=dev region=europe-west1: failed input validation:
+`,
+			wantErr: "3 of 6 input combination(s) failed",
+		},
+		{
+			name: "failures_summary",
+			templateContents: map[string]string{
+				"spec.yaml": testSpec,
+				"main.tf":   testMainTF,
+				"testdata/matrix.yaml": `inputs:
+  environment: ['dev', 'prod']
+  region: ['us-central1', 'europe-west1']
+  enable_cdn: [true, false]
+exclude:
+  - environment: 'prod'
+    enable_cdn: true
+`,
+			},
+			wantStdout: `ok   enable_cdn=false environment=dev region=us-central1
+ok   enable_cdn=false environment=dev region=europe-west1
+ok   enable_cdn=false environment=prod region=us-central1
+FAIL enable_cdn=false environment=prod region=europe-west1: failed to render:
+    step "Fill it in" (action "go_template") failed: when processing template file "main.tf": failed executing file as Go template: template.Execute() failed: the template referenced a nonexistent variable name "cdn_domain"; available variable names are [`,
+			wantErr: "3 of 6 input combination(s) failed",
+		},
+		{
+			name: "matrix_flag_and_inputs",
+			templateContents: map[string]string{
+				"spec.yaml": testSpec,
+				"main.tf":   testMainTF,
+			},
+			dirContents: map[string]string{
+				"my_matrix.yaml": `inputs:
+  environment: ['dev']
+  region: ['us-central1']
+`,
+			},
+			matrix: "my_matrix.yaml",
+			// The matrix's region wins over the one given with --input.
+			inputs: map[string]string{"enable_cdn": "true", "region": "ignored"},
+			wantStdout: `FAIL environment=dev region=us-central1: failed input validation:
+    input validation failed:
+
+    Input name:   enable_cdn
+    Input value:  true
+`,
+			wantErr: "1 of 1 input combination(s) failed",
+		},
+		{
+			name: "no_matrix",
+			templateContents: map[string]string{
+				"spec.yaml": testSpec,
+				"main.tf":   testMainTF,
+			},
+			wantErr: "the template has no testdata/matrix.yaml; create one, or give another matrix file with --matrix",
+		},
+		{
+			name: "invalid_matrix",
+			templateContents: map[string]string{
+				"spec.yaml":            testSpec,
+				"main.tf":              testMainTF,
+				"testdata/matrix.yaml": "inputs: {environment: []}\n",
+			},
+			wantErr: `input "environment" in the matrix "testdata/matrix.yaml" has no values`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, tc.templateContents)
+			abctestutil.WriteAllDefaultMode(t, tempDir, tc.dirContents)
+			stdoutBuf := &strings.Builder{}
+			c := &Command{
+				flags: TestMatrixFlags{
+					Source: sourceDir,
+					Matrix: tc.matrix,
+					Inputs: tc.inputs,
+				},
+			}
+			rp := &runParams{
+				clock:  clock.NewMock(),
+				cwd:    tempDir,
+				fs:     &common.RealFS{},
+				stdout: stdoutBuf,
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := c.realRun(ctx, rp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if !strings.Contains(stdoutBuf.String(), tc.wantStdout) {
+				t.Errorf("got stdout %q, want it to contain %q", stdoutBuf.String(), tc.wantStdout)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"strings"
 
 	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/abc/templates/common/ui"
 	"github.com/abcxyz/pkg/cli"
 )
 
@@ -39,6 +40,12 @@ type Flags struct {
 
 	// See common/flags.SkipInputValidation().
 	SkipInputValidation bool
+
+	// See common/flags.Color().
+	Color string
+
+	// See common/flags.AuditLog().
+	AuditLog string
 }
 
 func (f *Flags) Register(set *cli.FlagSet) {
@@ -47,14 +54,8 @@ func (f *Flags) Register(set *cli.FlagSet) {
 	r.StringMapVar(flags.Inputs(&f.Inputs))
 	r.StringSliceVar(flags.InputFiles(&f.InputFiles))
 	r.BoolVar(flags.SkipInputValidation(&f.SkipInputValidation))
-	r.BoolVar(flags.DebugScratchContents(&f.DebugScratchContents))
-
-	r.StringMapVar(&cli.StringMapVar{
-		Name:    "input",
-		Example: "foo=bar",
-		Target:  &f.Inputs,
-		Usage:   "The key=val pairs of template values; may be repeated.",
-	})
+	r.StringVar(flags.Color(&f.Color))
+	r.StringVar(flags.AuditLog(&f.AuditLog))
 
 	t := set.NewSection("TEMPLATE AUTHORS")
 	t.BoolVar(flags.DebugScratchContents(&f.DebugScratchContents))
@@ -68,6 +69,9 @@ func (f *Flags) Register(set *cli.FlagSet) {
 		if f.Manifest == "" {
 			return fmt.Errorf("missing <manifest> file argument")
 		}
+		if _, err := ui.ParseColorMode(f.Color); err != nil {
+			return fmt.Errorf("invalid --color: %w", err)
+		}
 
 		return nil
 	})
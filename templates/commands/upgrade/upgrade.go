@@ -17,9 +17,18 @@ package upgrade
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
 
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/internal/version"
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/audit"
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/manifestutil"
 	"github.com/abcxyz/abc/templates/model/decode"
 	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
 	"github.com/abcxyz/pkg/cli"
@@ -74,24 +83,96 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 	}
 
 	return c.realRun(ctx, &runParams{
-		fs: fSys,
+		clock: clock.New(),
+		fs:    fSys,
 	})
 }
 
 type runParams struct {
-	fs common.FS
+	clock clock.Clock
+	fs    common.FS
 }
 
-func (c *Command) realRun(ctx context.Context, rp *runParams) error {
+func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
+	auditEntry := &audit.Entry{
+		Command: audit.CommandUpgrade,
+		Source:  c.flags.Manifest,
+		// The manifest is in the .abc directory of the destination.
+		Dest: filepath.Dir(filepath.Dir(c.flags.Manifest)),
+	}
+	defer func() {
+		rErr = errors.Join(rErr, c.appendAuditEntry(rp, auditEntry, rErr))
+	}()
+
+	// The manifest is loaded before locking the destination, since locking
+	// creates the destination if it doesn't exist, which it wouldn't for a
+	// mistyped --manifest.
 	manifest, err := loadManifest(ctx, rp.fs, c.flags.Manifest)
 	if err != nil {
 		return err
 	}
-	_ = manifest
 
+	// Hold the destination lock for the rest of the upgrade, so a concurrent
+	// render or upgrade can't change the destination out from under it. An
+	// upgrade never creates the destination, so if the lock did, it's
+	// removed again.
+	lock, err := common.LockDest(rp.fs, auditEntry.Dest, rp.clock.Now())
+	if err != nil {
+		return fmt.Errorf("failed locking the destination directory: %w", err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, lock.Unlock(false))
+	}()
+	auditEntry.Source = manifest.TemplateLocation.Val
+	auditEntry.CanonicalSource = manifest.TemplateLocation.Val
+	auditEntry.Version = manifest.TemplateVersion.Val
+	inputs := make(map[string]string, len(manifest.Inputs))
+	for _, in := range manifest.Inputs {
+		inputs[in.Name.Val] = in.Value.Val
+	}
+	auditEntry.InputsHash = audit.HashInputs(inputs)
+
+	// Files that were changed after they were rendered are only regenerated
+	// if they're still marked as generated, which says that changing them
+	// isn't supported. Otherwise the changes would be lost.
+	owned, err := manifestutil.UserOwned(rp.fs, auditEntry.Dest, manifest)
+	if err != nil {
+		return fmt.Errorf("failed checking for changed output files: %w", err)
+	}
+	if len(owned) > 0 {
+		return errs.Wrap(errs.ErrConflict, fmt.Errorf("these files were changed after they were rendered, and "+
+			"aren't marked as generated by abc, so upgrading would overwrite the changes: %s; "+
+			"undo the changes, or move them to other files", strings.Join(owned, ", ")))
+	}
+
+	// Applying the new template version isn't implemented yet (#191), so the
+	// destination is left as it was.
+	auditEntry.Outcome = audit.OutcomeSkipped
 	return nil
 }
 
+// appendAuditEntry completes e with the outcome of the upgrade, and appends
+// it to the --audit-log, if there is one. An outcome that's already set in e
+// is kept unless the upgrade failed.
+func (c *Command) appendAuditEntry(rp *runParams, e *audit.Entry, upgradeErr error) error {
+	if c.flags.AuditLog == "" {
+		return nil
+	}
+	if abs, err := filepath.Abs(e.Dest); err == nil {
+		e.Dest = abs
+	}
+	e.Time = rp.clock.Now().UTC()
+	e.User = audit.CurrentUser()
+	e.ABCVersion = version.Version
+	if e.Outcome == "" {
+		e.Outcome = audit.OutcomeSuccess
+	}
+	if upgradeErr != nil {
+		e.Outcome, e.Error = audit.OutcomeFailure, upgradeErr.Error()
+	}
+	return audit.Append(rp.fs, c.flags.AuditLog, e) //nolint:wrapcheck
+}
+
 func loadManifest(ctx context.Context, fs common.FS, path string) (*manifest.Manifest, error) {
 	f, err := fs.Open(path)
 	if err != nil {
@@ -0,0 +1,204 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/audit"
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const testManifest = `api_version: cli.abcxyz.dev/v1beta4
+kind: Manifest
+creation_time: 2024-03-10T12:00:00Z
+modification_time: 2024-03-10T12:00:00Z
+template_location: github.com/my-org/templates/greeting
+location_type: remote_git
+template_version: v1.0.0
+template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
+inputs: []
+output_hashes: []
+`
+
+func TestRealRun_DestLocked(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	manifestPath := filepath.Join(tempDir, common.ABCInternalDir, "manifest.lock.yaml")
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		filepath.Join(common.ABCInternalDir, "manifest.lock.yaml"): testManifest,
+	})
+
+	clk := clock.NewMock()
+	clk.Set(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+	rfs := &common.RealFS{}
+
+	lock, err := common.LockDest(rfs, tempDir, clk.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	cmd := &Command{flags: Flags{Manifest: manifestPath}}
+	err = cmd.realRun(ctx, &runParams{clock: clk, fs: rfs})
+	if diff := testutil.DiffErrString(err, "the destination directory is locked by another render or upgrade"); diff != "" {
+		t.Fatal(diff)
+	}
+	if !errors.Is(err, &errs.DestLockedError{}) {
+		t.Errorf("got %v, want a DestLockedError", err)
+	}
+
+	// Once the lock is released, the upgrade can go ahead.
+	if err := lock.Unlock(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.realRun(ctx, &runParams{clock: clk, fs: rfs}); err != nil {
+		t.Errorf("realRun() after unlocking: %v", err)
+	}
+}
+
+func TestRealRun_MissingManifest(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	dest := filepath.Join(tempDir, "dest")
+	clk := clock.NewMock()
+
+	cmd := &Command{flags: Flags{Manifest: filepath.Join(dest, common.ABCInternalDir, "manifest.lock.yaml")}}
+	err := cmd.realRun(context.Background(), &runParams{clock: clk, fs: &common.RealFS{}})
+	if diff := testutil.DiffErrString(err, "failed to open manifest file"); diff != "" {
+		t.Fatal(diff)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("the upgrade left behind the destination directory %q, which didn't exist before", dest)
+	}
+}
+
+// TestRun_AuditLog goes through Run rather than realRun, so that the flags are
+// registered and parsed like on the command line.
+func TestRun_AuditLog(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	manifestPath := filepath.Join(tempDir, "dest", common.ABCInternalDir, "manifest.lock.yaml")
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		filepath.Join("dest", common.ABCInternalDir, "manifest.lock.yaml"): testManifest,
+	})
+	auditLog := filepath.Join(tempDir, "audit.jsonl")
+	rfs := &common.RealFS{}
+
+	cmd := &Command{}
+	args := []string{"--audit-log=" + auditLog, "--input=person=Bob", "--debug-scratch-contents", manifestPath}
+	if err := cmd.Run(context.Background(), args); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cmd.flags.Inputs, map[string]string{"person": "Bob"}; !maps.Equal(got, want) {
+		t.Errorf("got --input values %v, want %v", got, want)
+	}
+
+	entries, err := audit.Read(rfs, auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit log entries, want 1", len(entries))
+	}
+	// The upgrade didn't change the destination, so it isn't recorded as a
+	// success.
+	if got, want := entries[0].Outcome, audit.OutcomeSkipped; got != want {
+		t.Errorf("got outcome %q, want %q", got, want)
+	}
+}
+
+func TestRealRun_ChangedOutputs(t *testing.T) {
+	t.Parallel()
+
+	manifest := strings.Replace(testManifest, "output_hashes: []\n", `output_hashes:
+    - file: main.go
+      hash: HASH
+    - file: go.mod
+      hash: HASH
+      included_from_dest: true
+`, 1)
+	manifest = strings.ReplaceAll(manifest, "HASH", hashalg.SHA256.Sum([]byte("as rendered")))
+
+	cases := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "unchanged",
+			files: map[string]string{
+				"main.go": "as rendered",
+				"go.mod":  "as rendered",
+			},
+		},
+		{
+			// The template modifies go.mod as it is now, so the user's
+			// changes to it aren't lost.
+			name: "included_from_dest_changed",
+			files: map[string]string{
+				"main.go": "as rendered",
+				"go.mod":  "changed by the user",
+			},
+		},
+		{
+			name: "output_changed",
+			files: map[string]string{
+				"main.go": "changed by the user",
+				"go.mod":  "as rendered",
+			},
+			wantErr: "these files were changed after they were rendered, and aren't marked as generated by abc, so upgrading would overwrite the changes: main.go",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tempDir, tc.files)
+			abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+				filepath.Join(common.ABCInternalDir, "manifest.lock.yaml"): manifest,
+			})
+
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+
+			cmd := &Command{flags: Flags{Manifest: filepath.Join(tempDir, common.ABCInternalDir, "manifest.lock.yaml")}}
+			err := cmd.realRun(context.Background(), &runParams{clock: clk, fs: &common.RealFS{}})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vendorer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// VendorFlags describes what template to vendor and where to put it.
+type VendorFlags struct {
+	// Source is the location of the template to vendor.
+	//
+	// Example: github.com/abcxyz/abc/t/rest_server@v0.5.0
+	Source string
+
+	// Dir is the vendor directory. If empty, it's third_party/templates in
+	// the git workspace containing the working directory.
+	Dir string
+
+	// Name is the subdirectory of Dir to put the template in. If empty, it's
+	// the last component of the template's canonical source.
+	Name string
+
+	// GitProtocol either https or ssh.
+	GitProtocol string
+}
+
+func (r *VendorFlags) Register(set *cli.FlagSet) {
+	f := set.NewSection("VENDOR OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "dir",
+		Example: "third_party/templates",
+		Target:  &r.Dir,
+		Predict: predict.Dirs("*"),
+		Usage: "The vendor directory to put the template in. Defaults to third_party/templates in the git workspace " +
+			"containing the working directory, which is where \"abc templates render\" looks for vendored templates.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "name",
+		Example: "rest_server",
+		Target:  &r.Name,
+		Usage: "The name of the subdirectory of the vendor directory to put the template in. " +
+			"Defaults to the last path component of the template location.",
+	})
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	// Default source to the first CLI argument, if given
+	set.AfterParse(func(existingErr error) error {
+		r.Source = strings.TrimSpace(set.Arg(0))
+		if r.Source == "" {
+			return fmt.Errorf("missing <source> file")
+		}
+
+		if r.Name != "" {
+			if err := validateName(r.Name); err != nil {
+				return fmt.Errorf("invalid --name: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// validateName checks that name can be used as a single subdirectory of the
+// vendor directory.
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%q must be a single directory name", name)
+	}
+	return nil
+}
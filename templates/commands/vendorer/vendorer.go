@@ -0,0 +1,247 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vendorer implements the "templates vendor" subcommand, which copies
+// a template into the consumer's repo so it can be rendered without network
+// access.
+package vendorer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags VendorFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "copy a template at a pinned version into this repo, so it can be rendered without network access"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <source>
+
+The {{ COMMAND }} command downloads the template at <source> into a
+subdirectory of the vendor directory, which is third_party/templates in the
+current git workspace unless --dir is given, and records where it came from in
+the vendor.yaml file there. Commit the vendor directory to the repo.
+
+After that, "abc templates render" uses the vendored copy instead of
+downloading the template, when rendering into the same git workspace with the
+same <source>, or with the exact version that was vendored. This also applies
+to base templates named by "extends". The vendored copy must not be edited; a
+changed copy is refused by render.
+
+The <source> must be a location that includes a version, like
+github.com/abcxyz/abc/t/rest_server@v0.5.0 or ...@latest, so that manifests
+and upgrades work the same as for the upstream template. Vendoring the same
+template again replaces the vendored copy, which is how a vendored template is
+upgraded.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+type runParams struct {
+	cwd    string
+	fs     common.FS
+	stdout io.Writer
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		cwd:    wd,
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
+	logger := logging.FromContext(ctx).With("logger", "realRun")
+
+	vendorDir, err := c.vendorDir(ctx, rp.cwd)
+	if err != nil {
+		return err
+	}
+	idx, err := templatesource.LoadVendorIndex(rp.fs, vendorDir)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	tempTracker := tempdir.NewDirTracker(rp.fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory to use as template directory: %w", err)
+	}
+	// Always download from upstream, never from the vendor directory.
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:         rp.cwd,
+		Source:      c.flags.Source,
+		GitProtocol: c.flags.GitProtocol,
+		FS:          rp.fs,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	dlMeta, err := downloader.Download(ctx, rp.cwd, templateDir)
+	if err != nil {
+		return fmt.Errorf("failed to download/copy template: %w", err)
+	}
+	if !dlMeta.IsCanonical || !dlMeta.HasVersion {
+		return fmt.Errorf("template source %q can't be vendored, because it's not a location with a version, like github.com/myorg/myrepo/subdir@v1.2.3", c.flags.Source)
+	}
+
+	// Don't vendor something that can't be rendered.
+	if _, err := specutil.Load(ctx, rp.fs, templateDir, c.flags.Source); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	dirhash, err := common.HashTemplateDir(ctx, templateDir)
+	if err != nil {
+		return fmt.Errorf("failed hashing template directory: %w", err)
+	}
+
+	name := c.flags.Name
+	if name == "" {
+		name = path.Base(strings.TrimSuffix(dlMeta.CanonicalSource, "/"))
+		if err := validateName(name); err != nil {
+			return fmt.Errorf("can't name the vendored template after its location, use --name: %w", err)
+		}
+	}
+	if err := checkName(rp.fs, vendorDir, idx, name, dlMeta.CanonicalSource); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(vendorDir, name)
+	if err := rp.fs.RemoveAll(dest); err != nil {
+		return fmt.Errorf("RemoveAll(): %w", err)
+	}
+	if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+		SrcRoot: templateDir,
+		DstRoot: dest,
+		FS:      rp.fs,
+	}); err != nil {
+		return fmt.Errorf("failed copying template into vendor directory: %w", err)
+	}
+
+	entry := &templatesource.VendorEntry{
+		Name:            name,
+		Source:          c.flags.Source,
+		CanonicalSource: dlMeta.CanonicalSource,
+		LocationType:    dlMeta.LocationType,
+		Version:         dlMeta.Version,
+		GitSHA:          dlMeta.Vars.GitSHA,
+		GitTag:          dlMeta.Vars.GitTag,
+		GitCommitTime:   dlMeta.Vars.GitCommitTime,
+		GitAuthorName:   dlMeta.Vars.GitAuthorName,
+		GitAuthorEmail:  dlMeta.Vars.GitAuthorEmail,
+		Dirhash:         dirhash,
+	}
+	templates := []*templatesource.VendorEntry{entry}
+	for _, e := range idx.Templates {
+		if e.Name != name {
+			templates = append(templates, e)
+		}
+	}
+	idx.Templates = templates
+	if err := templatesource.SaveVendorIndex(rp.fs, vendorDir, idx); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	logger.DebugContext(ctx, "vendored template",
+		"source", c.flags.Source,
+		"dest", dest,
+		"version", dlMeta.Version)
+
+	fmt.Fprintf(rp.stdout, "vendored %s@%s into %s\ndirhash: %s\n", dlMeta.CanonicalSource, dlMeta.Version, dest, dirhash)
+	return nil
+}
+
+// vendorDir returns the absolute path of the vendor directory.
+func (c *Command) vendorDir(ctx context.Context, cwd string) (string, error) {
+	if c.flags.Dir != "" {
+		if filepath.IsAbs(c.flags.Dir) {
+			return c.flags.Dir, nil
+		}
+		return filepath.Join(cwd, c.flags.Dir), nil
+	}
+	root, ok, err := git.Workspace(ctx, cwd)
+	if err != nil {
+		return "", fmt.Errorf("failed determining git workspace for %q: %w", cwd, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("the working directory %q isn't in a git workspace, so there's no default vendor directory; use --dir", cwd)
+	}
+	return filepath.Join(root, filepath.FromSlash(templatesource.DefaultVendorDir)), nil
+}
+
+// checkName returns an error if the vendored template named name can't be
+// replaced by the template from canonicalSource. A vendored template can only
+// be replaced by another version of the same template, and a directory that
+// wasn't vendored is never replaced.
+func checkName(fs common.FS, vendorDir string, idx *templatesource.VendorIndex, name, canonicalSource string) error {
+	for _, e := range idx.Templates {
+		if e.Name != name {
+			continue
+		}
+		if e.CanonicalSource != canonicalSource {
+			return fmt.Errorf("the name %q is already used by the vendored template %s, use a different --name", name, e.CanonicalSource)
+		}
+		return nil
+	}
+
+	dest := filepath.Join(vendorDir, name)
+	if _, err := fs.Stat(dest); err == nil {
+		return fmt.Errorf("%q already exists but isn't a vendored template listed in %s, use a different --name", dest, templatesource.VendorIndexFileName)
+	} else if !common.IsStatNotExistErr(err) {
+		return fmt.Errorf("Stat(): %w", err)
+	}
+	return nil
+}
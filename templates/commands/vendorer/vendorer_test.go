@@ -0,0 +1,294 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vendorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const specContents = `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template for testing'
+steps:
+  - desc: 'Include some files'
+    action: 'include'
+    params:
+      paths: ['hello.txt']
+`
+
+// fakeTemplates are the templates served by the "vendor-test://" source
+// parser, keyed by source. The part after the "@" is the version.
+var fakeTemplates = map[string]map[string]string{
+	"vendor-test://myorg/hello@v1.0.0": {"spec.yaml": specContents, "hello.txt": "hello v1"},
+	"vendor-test://myorg/hello@v2.0.0": {"spec.yaml": specContents, "hello.txt": "hello v2"},
+	"vendor-test://other/hello@v1.0.0": {"spec.yaml": specContents, "hello.txt": "other hello"},
+	"vendor-test://myorg/invalid@v1":   {"spec.yaml": "not a spec"},
+}
+
+// fakeDownloader writes one of the fakeTemplates.
+type fakeDownloader struct {
+	source string
+}
+
+func (f *fakeDownloader) Download(ctx context.Context, cwd, destDir string) (*templatesource.DownloadMetadata, error) {
+	for name, contents := range fakeTemplates[f.source] {
+		if err := os.WriteFile(filepath.Join(destDir, name), []byte(contents), common.OwnerRWPerms); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
+	canonical, version, _ := strings.Cut(f.source, "@")
+	return &templatesource.DownloadMetadata{
+		IsCanonical:     true,
+		CanonicalSource: canonical,
+		LocationType:    "vendor_test",
+		HasVersion:      true,
+		Version:         version,
+		Vars:            templatesource.DownloaderVars{GitTag: version},
+	}, nil
+}
+
+func init() {
+	templatesource.RegisterSourceParser("vendor-test", templatesource.AfterBuiltins, templatesource.SourceParserFunc(
+		func(ctx context.Context, params *templatesource.ParseSourceParams) (templatesource.Downloader, bool, error) {
+			if _, ok := fakeTemplates[params.Source]; !ok {
+				return nil, false, nil
+			}
+			return &fakeDownloader{source: params.Source}, true, nil
+		}))
+}
+
+func TestVendorFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    VendorFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--dir", "vendored",
+				"--name", "my_template",
+				"--git-protocol", "ssh",
+				"github.com/myorg/myrepo@v1.2.3",
+			},
+			want: VendorFlags{
+				Source:      "github.com/myorg/myrepo@v1.2.3",
+				Dir:         "vendored",
+				Name:        "my_template",
+				GitProtocol: "ssh",
+			},
+		},
+		{
+			name: "defaults",
+			args: []string{"github.com/myorg/myrepo@v1.2.3"},
+			want: VendorFlags{
+				Source:      "github.com/myorg/myrepo@v1.2.3",
+				GitProtocol: "https",
+			},
+		},
+		{
+			name:    "missing_source",
+			args:    []string{},
+			wantErr: "missing <source> file",
+		},
+		{
+			name:    "name_with_slash",
+			args:    []string{"--name", "a/b", "github.com/myorg/myrepo@v1.2.3"},
+			wantErr: `invalid --name: "a/b" must be a single directory name`,
+		},
+		{
+			name:    "name_dot_dot",
+			args:    []string{"--name", "..", "github.com/myorg/myrepo@v1.2.3"},
+			wantErr: `invalid --name: ".." must be a single directory name`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd Command
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		flags        VendorFlags
+		existing     []VendorFlags
+		initialFiles map[string]string
+		noGit        bool
+		wantFiles    map[string]string
+		wantNames    []string
+		wantErr      string
+	}{
+		{
+			name:      "default_dir_and_name",
+			flags:     VendorFlags{Source: "vendor-test://myorg/hello@v1.0.0"},
+			wantFiles: map[string]string{"spec.yaml": specContents, "hello.txt": "hello v1"},
+			wantNames: []string{"hello"},
+		},
+		{
+			name:      "upgrade_replaces",
+			existing:  []VendorFlags{{Source: "vendor-test://myorg/hello@v1.0.0"}},
+			flags:     VendorFlags{Source: "vendor-test://myorg/hello@v2.0.0"},
+			wantFiles: map[string]string{"spec.yaml": specContents, "hello.txt": "hello v2"},
+			wantNames: []string{"hello"},
+		},
+		{
+			name:      "custom_name_keeps_others",
+			existing:  []VendorFlags{{Source: "vendor-test://myorg/hello@v1.0.0"}},
+			flags:     VendorFlags{Source: "vendor-test://other/hello@v1.0.0", Name: "a_other"},
+			wantFiles: map[string]string{"spec.yaml": specContents, "hello.txt": "other hello"},
+			wantNames: []string{"a_other", "hello"},
+		},
+		{
+			name:     "name_used_by_other_template",
+			existing: []VendorFlags{{Source: "vendor-test://myorg/hello@v1.0.0"}},
+			flags:    VendorFlags{Source: "vendor-test://other/hello@v1.0.0"},
+			wantErr:  `the name "hello" is already used by the vendored template vendor-test://myorg/hello`,
+		},
+		{
+			name:         "name_used_by_unvendored_dir",
+			initialFiles: map[string]string{"third_party/templates/hello/mine.txt": "mine"},
+			flags:        VendorFlags{Source: "vendor-test://myorg/hello@v1.0.0"},
+			wantErr:      "already exists but isn't a vendored template",
+		},
+		{
+			name:    "invalid_spec",
+			flags:   VendorFlags{Source: "vendor-test://myorg/invalid@v1"},
+			wantErr: "error reading template spec file",
+		},
+		{
+			name:    "local_not_canonical",
+			noGit:   true,
+			flags:   VendorFlags{Source: ".", Dir: "vendored"},
+			wantErr: `template source "." can't be vendored`,
+		},
+		{
+			name:    "no_git_workspace",
+			noGit:   true,
+			flags:   VendorFlags{Source: "vendor-test://myorg/hello@v1.0.0"},
+			wantErr: "isn't in a git workspace",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			repoDir := t.TempDir()
+			files := map[string]string{"spec.yaml": specContents}
+			if !tc.noGit {
+				files[".git/HEAD"] = "ref: refs/heads/main\n"
+			}
+			abctestutil.WriteAllDefaultMode(t, repoDir, files)
+			abctestutil.WriteAllDefaultMode(t, repoDir, tc.initialFiles)
+			cwd := filepath.Join(repoDir, "subdir")
+			abctestutil.WriteAllDefaultMode(t, cwd, map[string]string{"x.txt": "x"})
+
+			run := func(flags VendorFlags) (string, error) {
+				cmd := &Command{flags: flags}
+				stdout := &strings.Builder{}
+				err := cmd.realRun(ctx, &runParams{
+					cwd:    cwd,
+					fs:     &common.RealFS{},
+					stdout: stdout,
+				})
+				return stdout.String(), err
+			}
+			for _, f := range tc.existing {
+				if _, err := run(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stdout, err := run(tc.flags)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			vendorDir := filepath.Join(repoDir, "third_party", "templates")
+			idx, err := templatesource.LoadVendorIndex(&common.RealFS{}, vendorDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, e := range idx.Templates {
+				names = append(names, e.Name)
+			}
+			if diff := cmp.Diff(names, tc.wantNames); diff != "" {
+				t.Errorf("vendored template names were not as expected (-got,+want): %s", diff)
+			}
+
+			entry := idx.Lookup(tc.flags.Source)
+			if entry == nil {
+				t.Fatalf("the vendor index has no entry for %q", tc.flags.Source)
+			}
+			dest := filepath.Join(vendorDir, entry.Name)
+			if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, dest), tc.wantFiles); diff != "" {
+				t.Errorf("vendored files were not as expected (-got,+want): %s", diff)
+			}
+			dirhash, err := common.HashTemplateDir(ctx, dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Dirhash != dirhash {
+				t.Errorf("got dirhash %q in the vendor index, want %q", entry.Dirhash, dirhash)
+			}
+			wantStdout := "vendored " + entry.CanonicalSource + "@" + entry.Version + " into " + dest + "\ndirhash: " + dirhash + "\n"
+			if stdout != wantStdout {
+				t.Errorf("got stdout %q, want %q", stdout, wantStdout)
+			}
+		})
+	}
+}
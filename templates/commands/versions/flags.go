@@ -0,0 +1,64 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package versions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// Flags describes which template to list the versions of.
+type Flags struct {
+	// Positional arguments:
+
+	// Location is the location of the template in a remote git repo, like
+	// github.com/org/repo/subdir.
+	Location string
+
+	// Flag arguments (--foo):
+
+	// Prereleases includes the versions with a prerelease suffix, like
+	// v1.2.3-rc1.
+	Prereleases bool
+
+	// See common/flags.GitProtocol().
+	GitProtocol string
+}
+
+func (r *Flags) Register(set *cli.FlagSet) {
+	f := set.NewSection("VERSIONS OPTIONS")
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "prereleases",
+		Target:  &r.Prereleases,
+		Default: false,
+		Usage:   `Also list the versions with a prerelease suffix, like "v1.2.3-rc1", which "@latest" never resolves to.`,
+	})
+
+	g := set.NewSection("GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	// The location is the first CLI argument.
+	set.AfterParse(func(existingErr error) error {
+		r.Location = strings.TrimSpace(set.Arg(0))
+		if r.Location == "" {
+			return fmt.Errorf("missing <location> argument")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package versions implements the command that lists the versions of a
+// template.
+package versions
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "list the released versions of a template in a git repo"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <location>
+
+The {{ COMMAND }} command prints the versions of the template at <location>,
+like github.com/org/repo/subdir, one per line from highest to lowest. Any
+"@version" at the end of <location> is ignored, so a template source that's
+used with "abc templates render" works too.
+
+The versions are the semver tags of the git repo, like v1.2.3. They're listed
+with "git ls-remote" or the GitHub API, without cloning the repo, so this is
+fast even for a huge repo. The first version is the one that "@latest"
+resolves to, unless --prereleases is given.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+// listVersionsFunc is templatesource.ListVersions, or a fake in tests.
+type listVersionsFunc func(ctx context.Context, location, gitProtocol string, prereleases bool) ([]string, error)
+
+type runParams struct {
+	stdout       io.Writer
+	listVersions listVersionsFunc
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	return c.realRun(ctx, &runParams{
+		stdout:       c.Stdout(),
+		listVersions: templatesource.ListVersions,
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(ctx context.Context, rp *runParams) error {
+	versions, err := rp.listVersions(ctx, c.flags.Location, c.flags.GitProtocol, c.flags.Prereleases)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("%q has no versions; a version is a git tag like v1.2.3", c.flags.Location)
+	}
+	for _, v := range versions {
+		if _, err := fmt.Fprintln(rp.stdout, v); err != nil {
+			return fmt.Errorf("failed writing output: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package versions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		args       []string
+		versions   []string
+		listErr    error
+		wantArgs   string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name:       "success",
+			args:       []string{"github.com/org/repo/t@latest"},
+			versions:   []string{"v1.10.0", "v1.2.0"},
+			wantArgs:   "github.com/org/repo/t@latest https false",
+			wantStdout: "v1.10.0\nv1.2.0\n",
+		},
+		{
+			name:       "prereleases_and_ssh",
+			args:       []string{"--prereleases", "--git-protocol=ssh", "github.com/org/repo"},
+			versions:   []string{"v2.0.0-rc1", "v1.2.0"},
+			wantArgs:   "github.com/org/repo ssh true",
+			wantStdout: "v2.0.0-rc1\nv1.2.0\n",
+		},
+		{
+			name:     "no_versions",
+			args:     []string{"github.com/org/repo"},
+			wantArgs: "github.com/org/repo https false",
+			wantErr:  `"github.com/org/repo" has no versions`,
+		},
+		{
+			name:     "list_error",
+			args:     []string{"github.com/org/repo"},
+			listErr:  fmt.Errorf("fake error"),
+			wantArgs: "github.com/org/repo https false",
+			wantErr:  "fake error",
+		},
+		{
+			name:    "missing_location",
+			wantErr: "missing <location> argument",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotArgs string
+			fakeList := func(_ context.Context, location, gitProtocol string, prereleases bool) ([]string, error) {
+				gotArgs = fmt.Sprintf("%s %s %t", location, gitProtocol, prereleases)
+				return tc.versions, tc.listErr
+			}
+
+			cmd := &Command{}
+			var stdout bytes.Buffer
+			err := cmd.Flags().Parse(tc.args)
+			if err == nil {
+				err = cmd.realRun(context.Background(), &runParams{
+					stdout:       &stdout,
+					listVersions: fakeList,
+				})
+			}
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if gotArgs != tc.wantArgs {
+				t.Errorf("got ListVersions args %q, want %q", gotArgs, tc.wantArgs)
+			}
+			if got := stdout.String(); got != tc.wantStdout {
+				t.Errorf("got stdout %q, want %q", got, tc.wantStdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archive packages a directory tree into a single archive stream, and
+// unpacks such archives. Writing is used when the render output should be sent
+// somewhere other than a directory on the local filesystem, like standard
+// output. Extracting is used for templates that are stored as archives.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// Format is an archive file format.
+type Format string
+
+const (
+	// FormatTar is an uncompressed tar archive.
+	FormatTar Format = "tar"
+
+	// FormatZip is a zip archive using the "deflate" compression method.
+	FormatZip Format = "zip"
+)
+
+// Formats is the list of every supported archive format.
+var Formats = []Format{FormatTar, FormatZip}
+
+// Write writes every file under srcDir to w as an archive in the given format.
+func Write(ctx context.Context, rfs common.FS, format Format, srcDir string, w io.Writer) error {
+	switch format {
+	case FormatTar:
+		return WriteTar(ctx, rfs, srcDir, w)
+	case FormatZip:
+		return WriteZip(ctx, rfs, srcDir, w)
+	default:
+		return fmt.Errorf("unknown archive format %q", format)
+	}
+}
+
+// WriteTar writes every file under srcDir to w as an uncompressed tar stream.
+// The paths in the archive are relative to srcDir and use forward slashes.
+// Directories are not written as separate entries; they're implied by the
+// paths of the files they contain.
+func WriteTar(ctx context.Context, rfs common.FS, srcDir string, w io.Writer) (rErr error) {
+	logger := logging.FromContext(ctx).With("logger", "WriteTar")
+
+	tw := tar.NewWriter(w)
+	defer func() {
+		rErr = errors.Join(rErr, tw.Close())
+	}()
+
+	err := walkFiles(rfs, srcDir, func(path, rel string, fi fs.FileInfo, linkTarget string) error {
+		hdr, err := tar.FileInfoHeader(fi, linkTarget)
+		if err != nil {
+			return fmt.Errorf("FileInfoHeader(%s): %w", path, err)
+		}
+		hdr.Name = rel
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("WriteHeader(%s): %w", hdr.Name, err)
+		}
+		if linkTarget != "" {
+			logger.DebugContext(ctx, "added symlink to tar archive", "path", hdr.Name)
+			return nil
+		}
+
+		if err := copyFileTo(rfs, path, tw); err != nil {
+			return err
+		}
+		logger.DebugContext(ctx, "added file to tar archive", "path", hdr.Name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed writing tar archive of %q: %w", srcDir, err)
+	}
+	return nil
+}
+
+// WriteTarGzip is like WriteTar, except that the tar stream is compressed with
+// gzip.
+func WriteTarGzip(ctx context.Context, rfs common.FS, srcDir string, w io.Writer) (rErr error) {
+	gw := gzip.NewWriter(w)
+	defer func() {
+		rErr = errors.Join(rErr, gw.Close())
+	}()
+	return WriteTar(ctx, rfs, srcDir, gw)
+}
+
+// WriteZip writes every file under srcDir to w as a zip archive. Like WriteTar,
+// the paths in the archive are relative to srcDir, use forward slashes, and
+// directories don't get their own entries.
+func WriteZip(ctx context.Context, rfs common.FS, srcDir string, w io.Writer) (rErr error) {
+	logger := logging.FromContext(ctx).With("logger", "WriteZip")
+
+	zw := zip.NewWriter(w)
+	defer func() {
+		rErr = errors.Join(rErr, zw.Close())
+	}()
+
+	err := walkFiles(rfs, srcDir, func(path, rel string, fi fs.FileInfo, linkTarget string) error {
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return fmt.Errorf("FileInfoHeader(%s): %w", path, err)
+		}
+		hdr.Name = rel
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("CreateHeader(%s): %w", hdr.Name, err)
+		}
+		if linkTarget != "" {
+			// By convention, the contents of a symlink entry in a zip archive
+			// are its target.
+			if _, err := io.WriteString(fw, linkTarget); err != nil {
+				return fmt.Errorf("WriteString(%s): %w", hdr.Name, err)
+			}
+			logger.DebugContext(ctx, "added symlink to zip archive", "path", hdr.Name)
+			return nil
+		}
+
+		if err := copyFileTo(rfs, path, fw); err != nil {
+			return err
+		}
+		logger.DebugContext(ctx, "added file to zip archive", "path", hdr.Name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed writing zip archive of %q: %w", srcDir, err)
+	}
+	return nil
+}
+
+// walkFiles calls visit for every regular file and symlink under srcDir, in
+// lexical order. The rel argument is the file's path relative to srcDir, using
+// forward slashes, which is the form expected by archive formats. For a
+// symlink, linkTarget is its target, and it's empty otherwise.
+func walkFiles(rfs common.FS, srcDir string, visit func(path, rel string, fi fs.FileInfo, linkTarget string) error) error {
+	return fs.WalkDir(rfs, srcDir, func(path string, de fs.DirEntry, err error) error { //nolint:wrapcheck
+		if err != nil {
+			return err // There was some filesystem error. Give up.
+		}
+		if de.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", srcDir, path, err)
+		}
+
+		fi, err := de.Info()
+		if err != nil {
+			return fmt.Errorf("Info(): %w", err)
+		}
+		var linkTarget string
+		if de.Type()&fs.ModeSymlink != 0 {
+			if linkTarget, _, err = common.ReadlinkIfSymlink(rfs, path); err != nil {
+				return err //nolint:wrapcheck
+			}
+		}
+		return visit(path, filepath.ToSlash(rel), fi, filepath.ToSlash(linkTarget))
+	})
+}
+
+// copyFileTo writes the contents of the file at path to w.
+func copyFileTo(rfs common.FS, path string, w io.Writer) (rErr error) {
+	f, err := rfs.Open(path)
+	if err != nil {
+		return fmt.Errorf("Open(): %w", err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, f.Close())
+	}()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("Copy(%s): %w", path, err)
+	}
+	return nil
+}
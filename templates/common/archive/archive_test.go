@@ -0,0 +1,155 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		files    map[string]abctestutil.ModeAndContents
+		symlinks map[string]string
+		want     map[string]abctestutil.ModeAndContents // if nil, same as files
+	}{
+		{
+			name: "simple",
+			files: map[string]abctestutil.ModeAndContents{
+				"a.txt":            {Mode: 0o600, Contents: "a contents"},
+				"dir/b.txt":        {Mode: 0o600, Contents: "b contents"},
+				"dir/subdir/c.txt": {Mode: 0o600, Contents: ""},
+			},
+		},
+		{
+			name: "executable_bit_preserved",
+			files: map[string]abctestutil.ModeAndContents{
+				"run.sh": {Mode: 0o700, Contents: "#!/bin/sh"},
+			},
+		},
+		{
+			name: "symlinks_preserved",
+			files: map[string]abctestutil.ModeAndContents{
+				"dir/a.txt": {Mode: 0o600, Contents: "a contents"},
+			},
+			symlinks: map[string]string{
+				"link.txt": "dir/a.txt",
+				"linkdir":  "dir",
+			},
+			want: map[string]abctestutil.ModeAndContents{
+				"dir/a.txt": {Mode: 0o600, Contents: "a contents"},
+				"link.txt":  {Mode: fs.ModeSymlink | 0o777, Contents: "dir/a.txt"},
+				"linkdir":   {Mode: fs.ModeSymlink | 0o777, Contents: "dir"},
+			},
+		},
+		{
+			name:  "empty_dir",
+			files: map[string]abctestutil.ModeAndContents{},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		for _, format := range Formats {
+			format := format
+
+			t.Run(fmt.Sprintf("%s_%s", tc.name, format), func(t *testing.T) {
+				t.Parallel()
+
+				ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+				srcDir := t.TempDir()
+				abctestutil.WriteAll(t, srcDir, tc.files)
+				abctestutil.WriteSymlinks(t, srcDir, tc.symlinks)
+
+				buf := &bytes.Buffer{}
+				if err := Write(ctx, &common.RealFS{}, format, srcDir, buf); err != nil {
+					t.Fatal(err)
+				}
+
+				var got map[string]abctestutil.ModeAndContents
+				switch format {
+				case FormatTar:
+					got = abctestutil.ReadTar(t, buf)
+				case FormatZip:
+					got = abctestutil.ReadZip(t, buf.Bytes())
+				}
+				want := tc.want
+				if want == nil {
+					want = tc.files
+				}
+				if diff := cmp.Diff(got, want); diff != "" {
+					t.Errorf("archive contents were not as expected (-got,+want): %s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestWrite_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		format  Format
+		srcDir  string
+		wantErr string
+	}{
+		{
+			name:    "tar_missing_dir",
+			format:  FormatTar,
+			srcDir:  "/nonexistent/dir",
+			wantErr: "failed writing tar archive",
+		},
+		{
+			name:    "zip_missing_dir",
+			format:  FormatZip,
+			srcDir:  "/nonexistent/dir",
+			wantErr: "failed writing zip archive",
+		},
+		{
+			name:    "unknown_format",
+			format:  "rar",
+			srcDir:  "/nonexistent/dir",
+			wantErr: `unknown archive format "rar"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Write(ctx, &common.RealFS{}, tc.format, tc.srcDir, &bytes.Buffer{})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// IsArchiveName returns true if name ends with the extension of an archive that
+// Extract can read: ".tar", ".tar.gz", ".tgz", or ".zip".
+func IsArchiveName(name string) bool {
+	_, _, ok := formatForName(name)
+	return ok
+}
+
+// formatForName returns the archive format of a file, based on its name, and
+// whether it's gzip-compressed.
+func formatForName(name string) (Format, bool, bool) {
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return FormatTar, false, true
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FormatTar, true, true
+	case strings.HasSuffix(name, ".zip"):
+		return FormatZip, false, true
+	default:
+		return "", false, false
+	}
+}
+
+// Extract unpacks the archive in buf into destDir. The format is chosen from
+// name, which must satisfy IsArchiveName.
+//
+// Only regular files and directories are extracted. Since archives may come
+// from untrusted places, links and paths that would escape destDir are
+// rejected. Extracted files are only accessible by their owner, and keep their
+// owner-execute bit.
+func Extract(ctx context.Context, rfs common.FS, name string, buf []byte, destDir string) error {
+	format, gzipped, ok := formatForName(name)
+	if !ok {
+		return fmt.Errorf("%q doesn't have the name of a supported archive, which must end in .tar, .tar.gz, .tgz, or .zip", name)
+	}
+
+	var err error
+	switch format {
+	case FormatTar:
+		var r io.Reader = bytes.NewReader(buf)
+		if gzipped {
+			if r, err = gzip.NewReader(r); err != nil {
+				return fmt.Errorf("failed reading gzip header of %q: %w", name, err)
+			}
+		}
+		err = extractTar(ctx, rfs, r, destDir)
+	case FormatZip:
+		err = extractZip(ctx, rfs, buf, destDir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed extracting %q: %w", name, err)
+	}
+	return nil
+}
+
+func extractTar(ctx context.Context, rfs common.FS, r io.Reader, destDir string) error {
+	logger := logging.FromContext(ctx).With("logger", "extractTar")
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Next(): %w", err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+		default:
+			return fmt.Errorf("the archive entry %q isn't a regular file or directory, which isn't allowed in a template archive", hdr.Name)
+		}
+		if err := extractFile(rfs, destDir, hdr.Name, hdr.FileInfo().Mode(), tr); err != nil {
+			return err
+		}
+		logger.DebugContext(ctx, "extracted file from tar archive", "path", hdr.Name)
+	}
+}
+
+func extractZip(ctx context.Context, rfs common.FS, buf []byte, destDir string) error {
+	logger := logging.FromContext(ctx).With("logger", "extractZip")
+
+	zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return fmt.Errorf("zip.NewReader(): %w", err)
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		if !mode.IsRegular() {
+			return fmt.Errorf("the archive entry %q isn't a regular file or directory, which isn't allowed in a template archive", f.Name)
+		}
+		if err := extractZipFile(rfs, destDir, f); err != nil {
+			return err
+		}
+		logger.DebugContext(ctx, "extracted file from zip archive", "path", f.Name)
+	}
+	return nil
+}
+
+func extractZipFile(rfs common.FS, destDir string, f *zip.File) (rErr error) {
+	r, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("Open(%s): %w", f.Name, err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, r.Close())
+	}()
+	return extractFile(rfs, destDir, f.Name, f.Mode(), r)
+}
+
+// extractFile writes the contents of r to the file named by the archive entry
+// name, relative to destDir.
+func extractFile(rfs common.FS, destDir, name string, mode fs.FileMode, r io.Reader) error {
+	rel := filepath.FromSlash(name)
+	if !filepath.IsLocal(rel) {
+		return fmt.Errorf("the archive entry %q would be extracted outside of the destination directory", name)
+	}
+	dst := filepath.Join(destDir, rel)
+
+	var perms fs.FileMode = common.OwnerRWPerms
+	if mode&0o100 != 0 {
+		perms = common.OwnerRWXPerms
+	}
+	if err := rfs.MkdirAll(filepath.Dir(dst), common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("MkdirAll(): %w", err)
+	}
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed reading archive entry %q: %w", name, err)
+	}
+	if err := rfs.WriteFile(dst, buf, perms); err != nil {
+		return fmt.Errorf("WriteFile(): %w", err)
+	}
+	return nil
+}
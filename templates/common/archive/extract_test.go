@@ -0,0 +1,156 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestExtract(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]abctestutil.ModeAndContents{
+		"spec.yaml":        {Mode: 0o600, Contents: "spec contents"},
+		"dir/run.sh":       {Mode: 0o700, Contents: "#!/bin/sh"},
+		"dir/subdir/c.txt": {Mode: 0o600, Contents: ""},
+	}
+
+	cases := []struct {
+		name    string
+		archive string
+		format  Format
+		gzip    bool
+	}{
+		{name: "tar", archive: "template.tar", format: FormatTar},
+		{name: "tar_gz", archive: "template.tar.gz", format: FormatTar, gzip: true},
+		{name: "tgz", archive: "template.tgz", format: FormatTar, gzip: true},
+		{name: "zip", archive: "template.zip", format: FormatZip},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			rfs := &common.RealFS{}
+
+			srcDir := t.TempDir()
+			abctestutil.WriteAll(t, srcDir, files)
+			buf := &bytes.Buffer{}
+			if err := Write(ctx, rfs, tc.format, srcDir, buf); err != nil {
+				t.Fatal(err)
+			}
+			archiveBytes := buf.Bytes()
+			if tc.gzip {
+				archiveBytes = gzipBytes(t, archiveBytes)
+			}
+
+			destDir := t.TempDir()
+			if err := Extract(ctx, rfs, tc.archive, archiveBytes, destDir); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(abctestutil.LoadDirContents(t, destDir), files); diff != "" {
+				t.Errorf("extracted files were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestExtract_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		archive string
+		headers []*tar.Header
+		wantErr string
+	}{
+		{
+			name:    "unsupported_name",
+			archive: "template.rar",
+			wantErr: "doesn't have the name of a supported archive",
+		},
+		{
+			name:    "path_traversal",
+			archive: "template.tar",
+			headers: []*tar.Header{{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0o600}},
+			wantErr: `the archive entry "../evil.txt" would be extracted outside of the destination directory`,
+		},
+		{
+			name:    "absolute_path",
+			archive: "template.tar",
+			headers: []*tar.Header{{Name: "/etc/evil.txt", Typeflag: tar.TypeReg, Mode: 0o600}},
+			wantErr: "would be extracted outside of the destination directory",
+		},
+		{
+			name:    "symlink",
+			archive: "template.tar",
+			headers: []*tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+			wantErr: `the archive entry "link" isn't a regular file or directory`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+			tw := tar.NewWriter(buf)
+			for _, hdr := range tc.headers {
+				if err := tw.WriteHeader(hdr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Extract(ctx, &common.RealFS{}, tc.archive, buf.Bytes(), t.TempDir())
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
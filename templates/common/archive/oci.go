@@ -0,0 +1,200 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+const (
+	// MediaTypeTemplate is the OCI artifact type of a template image built by
+	// BuildOCIImage.
+	MediaTypeTemplate = "application/vnd.abcxyz.abc.template.v1"
+
+	// MediaTypeTemplateLayer is the media type of the single layer of a
+	// template image, which is a gzipped tar of the template directory.
+	MediaTypeTemplateLayer = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// MediaTypeOCIManifest is the media type of an OCI image manifest.
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+
+	mediaTypeOCIIndex = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIEmpty = "application/vnd.oci.empty.v1+json"
+)
+
+// ociDescriptor is an OCI content descriptor, which refers to a blob by its
+// digest. See https://github.com/opencontainers/image-spec/blob/main/descriptor.md.
+type ociDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType"`
+	Config        *ociDescriptor    `json:"config"`
+	Layers        []*ociDescriptor  `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	MediaType     string           `json:"mediaType"`
+	Manifests     []*ociDescriptor `json:"manifests"`
+}
+
+// OCIBlob is a piece of content in an OCI image, addressed by its digest.
+type OCIBlob struct {
+	MediaType string
+
+	// Digest is like "sha256:<hex>".
+	Digest   string
+	Contents []byte
+}
+
+func newOCIBlob(mediaType string, contents []byte) *OCIBlob {
+	sum := sha256.Sum256(contents)
+	return &OCIBlob{
+		MediaType: mediaType,
+		Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+		Contents:  contents,
+	}
+}
+
+func (b *OCIBlob) descriptor() *ociDescriptor {
+	return &ociDescriptor{
+		MediaType: b.MediaType,
+		Digest:    b.Digest,
+		Size:      int64(len(b.Contents)),
+	}
+}
+
+// OCIImage is a template packaged as an OCI image.
+type OCIImage struct {
+	// Config is the image config, which is always the empty JSON object.
+	Config *OCIBlob
+
+	// Layer is the only layer, a gzipped tar of the template directory.
+	Layer *OCIBlob
+
+	// Manifest is the image manifest, which refers to Config and Layer by
+	// their digests. The manifest's digest identifies the whole image.
+	Manifest *OCIBlob
+}
+
+// BuildOCIImage packages every file under srcDir as an OCI image. The image
+// has a single layer, which is a gzipped tar of srcDir as written by
+// WriteTarGzip, and an empty config. The given annotations are set on the
+// image manifest.
+func BuildOCIImage(ctx context.Context, rfs common.FS, srcDir string, annotations map[string]string) (*OCIImage, error) {
+	layerBuf := &bytes.Buffer{}
+	if err := WriteTarGzip(ctx, rfs, srcDir, layerBuf); err != nil {
+		return nil, err
+	}
+	config := newOCIBlob(mediaTypeOCIEmpty, []byte("{}"))
+	layer := newOCIBlob(MediaTypeTemplateLayer, layerBuf.Bytes())
+
+	layerDesc := layer.descriptor()
+	layerDesc.Annotations = map[string]string{
+		"org.opencontainers.image.title": "template.tar.gz",
+	}
+	manifestJSON, err := json.Marshal(&ociManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		ArtifactType:  MediaTypeTemplate,
+		Config:        config.descriptor(),
+		Layers:        []*ociDescriptor{layerDesc},
+		Annotations:   annotations,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling OCI manifest: %w", err)
+	}
+
+	return &OCIImage{
+		Config:   config,
+		Layer:    layer,
+		Manifest: newOCIBlob(MediaTypeOCIManifest, manifestJSON),
+	}, nil
+}
+
+// WriteOCILayout writes every file under srcDir to w as an OCI image built by
+// BuildOCIImage, in the tar form of the OCI image layout
+// (https://github.com/opencontainers/image-spec/blob/main/image-layout.md).
+// This can be pushed to a container registry with tools like "oras cp" or
+// "skopeo copy oci-archive:...".
+func WriteOCILayout(ctx context.Context, rfs common.FS, srcDir string, annotations map[string]string, w io.Writer) (rErr error) {
+	img, err := BuildOCIImage(ctx, rfs, srcDir, annotations)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	defer func() {
+		rErr = errors.Join(rErr, tw.Close())
+	}()
+
+	for _, b := range []*OCIBlob{img.Config, img.Layer, img.Manifest} {
+		name := "blobs/sha256/" + strings.TrimPrefix(b.Digest, "sha256:")
+		if err := writeTarEntry(tw, name, b.Contents); err != nil {
+			return err
+		}
+	}
+
+	manifestDesc := img.Manifest.descriptor()
+	manifestDesc.ArtifactType = MediaTypeTemplate
+	indexJSON, err := json.Marshal(&ociIndex{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIIndex,
+		Manifests:     []*ociDescriptor{manifestDesc},
+	})
+	if err != nil {
+		return fmt.Errorf("failed marshaling OCI index: %w", err)
+	}
+	if err := writeTarEntry(tw, "index.json", indexJSON); err != nil {
+		return err
+	}
+	return writeTarEntry(tw, "oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`))
+}
+
+// writeTarEntry writes a regular file with the given contents to tw.
+func writeTarEntry(tw *tar.Writer, name string, contents []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(contents)),
+	}); err != nil {
+		return fmt.Errorf("WriteHeader(%s): %w", name, err)
+	}
+	if _, err := tw.Write(contents); err != nil {
+		return fmt.Errorf("Write(%s): %w", name, err)
+	}
+	return nil
+}
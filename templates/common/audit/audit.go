@@ -0,0 +1,157 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit implements the audit log, an append-only record of every
+// render and upgrade, for organizations that need to know who installed which
+// template version where.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// The values of Entry.Command.
+const (
+	CommandRender  = "render"
+	CommandUpgrade = "upgrade"
+)
+
+// The values of Entry.Outcome.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+
+	// OutcomeSkipped is for a command that succeeded without changing the
+	// destination.
+	OutcomeSkipped = "skipped"
+)
+
+// Entry is one line of the audit log. The JSON field names are part of the
+// audit log format, so they must not change.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	User    string    `json:"user"`
+
+	// Source is the template location as the user gave it. CanonicalSource
+	// and Version are from the template download, and are empty if the
+	// template couldn't be downloaded or doesn't have a canonical location.
+	Source          string `json:"source"`
+	CanonicalSource string `json:"canonical_source,omitempty"`
+	Version         string `json:"version,omitempty"`
+
+	// Dest is the absolute path of the destination directory.
+	Dest string `json:"dest"`
+
+	// InputsHash is the HashInputs of the input values, so that renders with
+	// the same inputs can be matched up without recording the values, which
+	// may be sensitive. It's empty if the inputs weren't known yet.
+	InputsHash string `json:"inputs_hash,omitempty"`
+
+	// Outcome is OutcomeSuccess, OutcomeFailure, or OutcomeSkipped, and Error
+	// is the error message of a failure.
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+
+	// ABCVersion is the version of abc that did the render.
+	ABCVersion string `json:"abc_version"`
+}
+
+// HashInputs returns a hash of the input names and values, like
+// "sha256:0a1b...". It doesn't depend on the order of the map.
+func HashInputs(inputs map[string]string) string {
+	if inputs == nil {
+		inputs = map[string]string{}
+	}
+	// json.Marshal sorts map keys, so the encoding is deterministic.
+	buf, err := json.Marshal(inputs)
+	if err != nil {
+		panic(fmt.Sprintf("internal error: marshaling a map[string]string can't fail: %v", err))
+	}
+	sum := sha256.Sum256(buf)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// CurrentUser returns the name of the user running abc, for Entry.User, or ""
+// if it can't be determined.
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Append adds e to the end of the audit log at path, creating the log and its
+// directory if needed. Each entry is a single write of one line, so entries
+// from concurrent renders aren't interleaved.
+func Append(rfs common.FS, path string, e *Entry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed marshaling audit log entry: %w", err)
+	}
+	buf = append(buf, '\n')
+
+	if err := rfs.MkdirAll(filepath.Dir(path), common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("failed creating the directory for the audit log: %w", err)
+	}
+	f, err := rfs.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, common.OwnerRWPerms)
+	if err != nil {
+		return fmt.Errorf("failed opening audit log: %w", err)
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return fmt.Errorf("failed writing to audit log %q: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed closing audit log %q: %w", path, err)
+	}
+	return nil
+}
+
+// Read returns the entries in the audit log at path, oldest first. If the log
+// doesn't exist, the error satisfies common.IsStatNotExistErr.
+func Read(rfs common.FS, path string) ([]*Entry, error) {
+	buf, err := rfs.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading audit log: %w", err)
+	}
+	var out []*Entry
+	sc := bufio.NewScanner(bytes.NewReader(buf))
+	sc.Buffer(nil, len(buf)+1)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		e := &Entry{}
+		if err := json.Unmarshal(sc.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("failed parsing line %d of audit log %q: %w", line, path, err)
+		}
+		out = append(out, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading audit log %q: %w", path, err)
+	}
+	return out, nil
+}
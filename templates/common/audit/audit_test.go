@@ -0,0 +1,116 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestAppendRead(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "audit.jsonl")
+	rfs := &common.RealFS{}
+
+	if _, err := Read(rfs, path); !common.IsStatNotExistErr(err) {
+		t.Fatalf("Read() of a missing log got error %v, want a not-exist error", err)
+	}
+
+	entries := []*Entry{
+		{
+			Time:            time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Command:         CommandRender,
+			User:            "alice",
+			Source:          "github.com/foo/bar@latest",
+			CanonicalSource: "github.com/foo/bar",
+			Version:         "v1.2.3",
+			Dest:            "/work/dest",
+			InputsHash:      HashInputs(map[string]string{"a": "b"}),
+			Outcome:         OutcomeSuccess,
+			ABCVersion:      "0.1.0",
+		},
+		{
+			Time:       time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC),
+			Command:    CommandUpgrade,
+			User:       "bob",
+			Source:     "github.com/foo/bar",
+			Dest:       "/work/dest",
+			Outcome:    OutcomeFailure,
+			Error:      "it broke",
+			ABCVersion: "0.1.0",
+		},
+	}
+	for _, e := range entries {
+		if err := Append(rfs, path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Read(rfs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, entries); diff != "" {
+		t.Errorf("entries were not as expected (-got,+want): %s", diff)
+	}
+
+	buf := abctestutil.LoadDirWithoutMode(t, filepath.Dir(path))["audit.jsonl"]
+	if lines := strings.Count(buf, "\n"); lines != len(entries) {
+		t.Errorf("got %d lines in the audit log, want one per entry:\n%s", lines, buf)
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, dir, map[string]string{
+		"audit.jsonl": `{"command":"render"}` + "\n\n" + "not json\n",
+	})
+
+	_, err := Read(&common.RealFS{}, filepath.Join(dir, "audit.jsonl"))
+	if diff := testutil.DiffErrString(err, "failed parsing line 3 of audit log"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestHashInputs(t *testing.T) {
+	t.Parallel()
+
+	a := HashInputs(map[string]string{"x": "1", "y": "2"})
+	b := HashInputs(map[string]string{"y": "2", "x": "1"})
+	if a != b {
+		t.Errorf("hashes of the same inputs differ: %q != %q", a, b)
+	}
+	if !strings.HasPrefix(a, "sha256:") {
+		t.Errorf("hash %q doesn't start with sha256:", a)
+	}
+	if c := HashInputs(map[string]string{"x": "1", "y": "3"}); c == a {
+		t.Errorf("hashes of different inputs are the same: %q", c)
+	}
+	if HashInputs(nil) != HashInputs(map[string]string{}) {
+		t.Errorf("hash of nil inputs differs from the hash of empty inputs")
+	}
+}
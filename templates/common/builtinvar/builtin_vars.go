@@ -19,6 +19,7 @@ package builtinvar
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/abcxyz/abc/templates/model/spec/features"
 	"github.com/abcxyz/pkg/sets"
@@ -34,30 +35,56 @@ const (
 	GitSHA      = "_git_sha"
 	GitShortSHA = "_git_short_sha"
 
+	// The _git_commit_time and _git_author_* vars describe the commit of
+	// _git_sha. They're in scope if and only if api_version>=v1beta4, and are
+	// empty in the same cases as _git_sha.
+	GitCommitTime  = "_git_commit_time"
+	GitAuthorName  = "_git_author_name"
+	GitAuthorEmail = "_git_author_email"
+
 	// The value of the --dest flag (the render output directory).
 	FlagDest = "_flag_dest"
 
 	// The positional argument on the command line providing the template to be
 	// rendered.
 	FlagSource = "_flag_source"
+
+	// The paths of the files that the previous steps have created or included
+	// so far, relative to the scratch directory, separated by newlines. Unlike
+	// the other builtins, this changes from one step to the next, and it can't
+	// be overridden. In scope if and only if api_version>=v1beta4.
+	RenderedPaths = "_rendered_paths"
+
+	// EnvPrefix is the prefix of the builtin vars that hold the environment
+	// variables a template declares in its env_vars, like _env_HOME. Each is in
+	// scope if and only if the template declares it.
+	EnvPrefix = "_env_"
 )
 
+// Env returns the name of the builtin var for the given environment variable.
+func Env(name string) string {
+	return EnvPrefix + name
+}
+
 // Validate returns error if any of the attemptedNames are not valid builtin
 // var names. The "features" parameter is derived from the api_version, and it's
 // needed because the set of variable names that are in scope depends on the
-// api_version; we sometimes add new variables.
-func Validate(f features.Features, attemptedNames []string) error {
-	allowed := NamesInScope(f)
+// api_version; we sometimes add new variables. envVars are the names of the
+// environment variables that the template declares in env_vars.
+func Validate(f features.Features, envVars, attemptedNames []string) error {
+	allowed := NamesInScope(f, envVars)
 	unknown := sets.Subtract(attemptedNames, allowed)
 	if len(unknown) > 0 {
+		sort.Strings(unknown) // attemptedNames often come from a map
 		return fmt.Errorf("these builtin override var names are unknown and therefore invalid: %v; the set of valid builtin var names is %v",
 			unknown, allowed)
 	}
 	return nil
 }
 
-// NamesInScope returns the set of builtin var names.
-func NamesInScope(f features.Features) []string {
+// NamesInScope returns the set of builtin var names, including one for each of
+// the environment variables in envVars.
+func NamesInScope(f features.Features, envVars []string) []string {
 	// These vars have always existed in every api_version
 	out := []string{FlagDest, FlagSource}
 
@@ -66,5 +93,14 @@ func NamesInScope(f features.Features) []string {
 		out = append(out, GitSHA, GitShortSHA, GitTag)
 	}
 
+	// v1beta4 added these new vars
+	if !f.SkipGitCommitVars {
+		out = append(out, GitAuthorEmail, GitAuthorName, GitCommitTime)
+	}
+
+	for _, e := range envVars {
+		out = append(out, Env(e))
+	}
+
 	return out
 }
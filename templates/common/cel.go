@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -293,7 +294,7 @@ func celCompile(ctx context.Context, scope *Scope, expr string) (cel.Program, er
 
 	celOpts := []cel.EnvOption{}
 	for varName := range scope.All() {
-		celOpts = append(celOpts, cel.Variable(varName, cel.StringType))
+		celOpts = append(celOpts, cel.Variable(varName, celType(scope.Type(varName))))
 	}
 	celOpts = append(celOpts, celFuncs...) // Add custom function bindings
 
@@ -305,9 +306,11 @@ func celCompile(ctx context.Context, scope *Scope, expr string) (cel.Program, er
 	ast, issues := env.Compile(expr)
 	if err := issues.Err(); err != nil {
 		if name, ok := isCELUndeclaredRef(err); ok {
+			availableVars := maps.Keys(scope.All())
+			sort.Strings(availableVars)
 			return nil, &errs.UnknownVarError{
 				VarName:       name,
-				AvailableVars: maps.Keys(scope.All()),
+				AvailableVars: availableVars,
 				Wrapped:       err,
 			}
 		}
@@ -352,11 +355,15 @@ func celEval(ctx context.Context, scope *Scope, prog cel.Program, outPtr any) er
 	startedAt := time.Now()
 
 	// The CEL engine needs variable values as a map[string]any, but we have a
-	// map[string]string, so convert.
+	// map[string]string, so convert, parsing the values of typed variables.
 	scopeAll := scope.All()
 	scopeMapAny := make(map[string]any, len(scopeAll))
 	for varName, varVal := range scopeAll {
-		scopeMapAny[varName] = varVal
+		val, err := celValue(scope.Type(varName), varVal)
+		if err != nil {
+			return fmt.Errorf("invalid value for variable %q: %w", varName, err)
+		}
+		scopeMapAny[varName] = val
 	}
 
 	celOut, _, err := prog.Eval(scopeMapAny)
@@ -35,6 +35,7 @@ func TestCompileAndEvalCEL(t *testing.T) {
 		name    string
 		in      model.String
 		vars    map[string]string
+		types   map[string]VarType
 		want    any
 		wantErr string
 	}{
@@ -61,6 +62,13 @@ func TestCompileAndEvalCEL(t *testing.T) {
 			want:    []string(nil),
 			wantErr: `CEL expression result couldn't be converted to []string. The CEL engine error was: unsupported type conversion from 'int' to string`,
 		},
+		{
+			name:    "unknown_var_lists_sorted_vars",
+			in:      model.String{Val: `nope`},
+			vars:    map[string]string{"zebra": "1", "alligator": "2", "moose": "3", "crocodile": "4"},
+			want:    "",
+			wantErr: `nonexistent variable name "nope"; available variable names are [alligator crocodile moose zebra]`,
+		},
 		{
 			name: "string_split",
 			in:   model.String{Val: `"alligator,crocodile".split(",")`},
@@ -72,6 +80,43 @@ func TestCompileAndEvalCEL(t *testing.T) {
 			vars: map[string]string{"reptile": "crocodile"},
 			want: []string{"alligator", "crocodile"},
 		},
+		{
+			name:  "typed_bool_var",
+			in:    model.String{Val: `enabled && !disabled`},
+			vars:  map[string]string{"enabled": "true", "disabled": "false"},
+			types: map[string]VarType{"enabled": VarTypeBool, "disabled": VarTypeBool},
+			want:  true,
+		},
+		{
+			name:  "typed_int_var",
+			in:    model.String{Val: `replicas * 2`},
+			vars:  map[string]string{"replicas": "21"},
+			types: map[string]VarType{"replicas": VarTypeInt},
+			want:  42,
+		},
+		{
+			name:  "typed_list_var",
+			in:    model.String{Val: `regions + [region]`},
+			vars:  map[string]string{"regions": `["us-east1","us-west1"]`, "region": "eu-west1"},
+			types: map[string]VarType{"regions": VarTypeList},
+			want:  []string{"us-east1", "us-west1", "eu-west1"},
+		},
+		{
+			name:    "typed_var_is_not_a_string",
+			in:      model.String{Val: `replicas + "1"`},
+			vars:    map[string]string{"replicas": "21"},
+			types:   map[string]VarType{"replicas": VarTypeInt},
+			want:    "",
+			wantErr: "found no matching overload for '_+_' applied to '(int, string)'",
+		},
+		{
+			name:    "typed_var_with_non_canonical_value",
+			in:      model.String{Val: `enabled`},
+			vars:    map[string]string{"enabled": "maybe"},
+			types:   map[string]VarType{"enabled": VarTypeBool},
+			want:    false,
+			wantErr: `invalid value for variable "enabled": "maybe" isn't a bool`,
+		},
 		{
 			name:    "invalid_cel_syntax",
 			in:      model.String{Val: `[[[[[`},
@@ -102,7 +147,7 @@ func TestCompileAndEvalCEL(t *testing.T) {
 			t.Parallel()
 
 			ctx := context.Background()
-			scope := NewScope(tc.vars)
+			scope := NewTypedScope(tc.vars, tc.types)
 
 			// Create a new "any" variable whose type is pointer-to-the-type-of-tc.want.
 			gotPtr := reflect.New(reflect.ValueOf(tc.want).Type()).Interface()
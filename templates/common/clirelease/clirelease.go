@@ -0,0 +1,205 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clirelease downloads released versions of the abc binary, so that
+// something can be checked against the output of another version of abc, like
+// golden tests before upgrading the version of abc that CI uses.
+package clirelease
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// DefaultBaseURL is where the releases of abc are downloaded from. A release's
+// files are under the release's tag, like ".../v0.9.0/abc_0.9.0_linux_amd64.tar.gz".
+const DefaultBaseURL = "https://github.com/abcxyz/abc/releases/download"
+
+// binaryName is the name of the binary in the release archives.
+const binaryName = "abc"
+
+// FetchParams are the parameters of Fetch.
+type FetchParams struct {
+	// Version is the released version, like "v0.9.0" or "0.9.0".
+	Version string
+
+	// CacheDir is where downloaded binaries are kept, so that each version is
+	// only downloaded once, normally ~/.abc/cache/cli.
+	CacheDir string
+
+	// BaseURL is where to download the releases from. Defaults to
+	// DefaultBaseURL.
+	BaseURL string
+
+	// GOOS and GOARCH are the platform of the binary. They default to the
+	// platform that this binary was built for.
+	GOOS   string
+	GOARCH string
+
+	// FS is the filesystem that CacheDir is in.
+	FS common.FS
+
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Fetch returns the path of the abc binary of the released version
+// p.Version, downloading it into p.CacheDir if it isn't there already. The
+// downloaded archive must match the SHA-512 checksum that's published with the
+// release.
+func Fetch(ctx context.Context, p *FetchParams) (string, error) {
+	logger := logging.FromContext(ctx).With("logger", "clirelease.Fetch")
+
+	version := "v" + strings.TrimPrefix(p.Version, "v")
+	if !semver.IsValid(version) {
+		return "", fmt.Errorf("%q isn't a released version of abc, which looks like v0.9.0", p.Version)
+	}
+	goos, goarch := p.GOOS, p.GOARCH
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+	if (goos != "linux" && goos != "darwin") || (goarch != "amd64" && goarch != "arm64") {
+		return "", fmt.Errorf("abc is only released for linux and darwin on amd64 and arm64, not %s/%s", goos, goarch)
+	}
+
+	installDir := filepath.Join(p.CacheDir, fmt.Sprintf("%s_%s_%s", version, goos, goarch))
+	binPath := filepath.Join(installDir, binaryName)
+	if _, err := p.FS.Stat(binPath); err == nil {
+		logger.DebugContext(ctx, "using the cached abc binary", "path", binPath)
+		return binPath, nil
+	} else if !common.IsStatNotExistErr(err) {
+		return "", fmt.Errorf("Stat(): %w", err)
+	}
+
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// The names of the release files come from .goreleaser.yaml, where the
+	// version doesn't have its "v".
+	bareVersion := strings.TrimPrefix(version, "v")
+	archiveName := fmt.Sprintf("abc_%s_%s_%s.tar.gz", bareVersion, goos, goarch)
+	sumsName := fmt.Sprintf("abc_%s_SHA512SUMS", bareVersion)
+	releaseURL := strings.TrimSuffix(baseURL, "/") + "/" + version + "/"
+
+	logger.InfoContext(ctx, "downloading abc", "version", version, "url", releaseURL+archiveName)
+	sums, err := get(ctx, client, releaseURL+sumsName)
+	if err != nil {
+		return "", err
+	}
+	wantSum, err := findSum(sums, archiveName)
+	if err != nil {
+		return "", fmt.Errorf("in %s of abc %s: %w", sumsName, version, err)
+	}
+	buf, err := get(ctx, client, releaseURL+archiveName)
+	if err != nil {
+		return "", err
+	}
+	if sum := sha512.Sum512(buf); hex.EncodeToString(sum[:]) != wantSum {
+		return "", fmt.Errorf("the SHA-512 checksum of %s doesn't match %s; the download may be corrupt", archiveName, sumsName)
+	}
+
+	// The archive is extracted into a temporary directory that's renamed into
+	// place, so that an interrupted download is never mistaken for a whole
+	// one.
+	if err := p.FS.MkdirAll(p.CacheDir, common.OwnerRWXPerms); err != nil {
+		return "", fmt.Errorf("MkdirAll(): %w", err)
+	}
+	tempDir, err := p.FS.MkdirTemp(p.CacheDir, "download-")
+	if err != nil {
+		return "", fmt.Errorf("MkdirTemp(): %w", err)
+	}
+	defer p.FS.RemoveAll(tempDir) //nolint:errcheck // it's gone after a successful rename
+
+	if err := archive.Extract(ctx, p.FS, archiveName, buf, tempDir); err != nil {
+		return "", fmt.Errorf("failed extracting %s: %w", archiveName, err)
+	}
+	if _, err := p.FS.Stat(filepath.Join(tempDir, binaryName)); err != nil {
+		return "", fmt.Errorf("%s has no %q binary: %w", archiveName, binaryName, err)
+	}
+	if err := p.FS.Chmod(filepath.Join(tempDir, binaryName), common.OwnerRWXPerms); err != nil {
+		return "", fmt.Errorf("Chmod(): %w", err)
+	}
+	if err := p.FS.Rename(tempDir, installDir); err != nil {
+		// Another process may have installed the same version meanwhile.
+		if _, statErr := p.FS.Stat(binPath); statErr == nil {
+			return binPath, nil
+		}
+		return "", fmt.Errorf("Rename(): %w", err)
+	}
+	return binPath, nil
+}
+
+// get returns the body of the file at url.
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed downloading %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s doesn't exist; is the version a release of abc?", url)
+		}
+		return nil, fmt.Errorf("failed downloading %s: %s", url, resp.Status)
+	}
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed downloading %s: %w", url, err)
+	}
+	return buf, nil
+}
+
+// findSum returns the hex checksum of the file name in sums, which has a line
+// like "<hex>  <name>" for each file, like the output of sha512sum.
+func findSum(sums []byte, name string) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(sums))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", fmt.Errorf("failed reading checksums: %w", err)
+	}
+	return "", fmt.Errorf("there's no checksum for %s", name)
+}
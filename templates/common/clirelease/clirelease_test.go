@@ -0,0 +1,168 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clirelease
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeRelease serves a release of version 1.2.3 for linux/amd64, and counts
+// the requests.
+func fakeRelease(t *testing.T, sumOverride string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	srcDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, srcDir, map[string]string{
+		"abc":       "#!/bin/sh\necho fake abc\n",
+		"README.md": "readme",
+	})
+	var tgz bytes.Buffer
+	if err := archive.WriteTarGzip(context.Background(), &common.RealFS{}, srcDir, &tgz); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha512.Sum512(tgz.Bytes())
+	hexSum := hex.EncodeToString(sum[:])
+	if sumOverride != "" {
+		hexSum = sumOverride
+	}
+
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.2.3/abc_1.2.3_SHA512SUMS", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprintf(w, "%s  abc_1.2.3_darwin_arm64.tar.gz\n%s  abc_1.2.3_linux_amd64.tar.gz\n", hexSum, hexSum)
+	})
+	mux.HandleFunc("/v1.2.3/abc_1.2.3_linux_amd64.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write(tgz.Bytes()) //nolint:errcheck
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestFetch(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		version     string
+		goos        string
+		sumOverride string
+		wantErr     string
+	}{
+		{
+			name:    "success",
+			version: "v1.2.3",
+		},
+		{
+			name:    "version_without_v",
+			version: "1.2.3",
+		},
+		{
+			name:    "not_released",
+			version: "v9.9.9",
+			wantErr: "v9.9.9/abc_9.9.9_SHA512SUMS doesn't exist; is the version a release of abc?",
+		},
+		{
+			name:        "checksum_mismatch",
+			version:     "v1.2.3",
+			sumOverride: "00",
+			wantErr:     "the SHA-512 checksum of abc_1.2.3_linux_amd64.tar.gz doesn't match abc_1.2.3_SHA512SUMS",
+		},
+		{
+			name:    "invalid_version",
+			version: "main",
+			wantErr: `"main" isn't a released version of abc`,
+		},
+		{
+			name:    "unsupported_platform",
+			version: "v1.2.3",
+			goos:    "windows",
+			wantErr: "abc is only released for linux and darwin on amd64 and arm64, not windows/amd64",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			srv, requests := fakeRelease(t, tc.sumOverride)
+			goos := tc.goos
+			if goos == "" {
+				goos = "linux"
+			}
+			params := &FetchParams{
+				Version:  tc.version,
+				CacheDir: filepath.Join(t.TempDir(), "cli"),
+				BaseURL:  srv.URL,
+				GOOS:     goos,
+				GOARCH:   "amd64",
+				FS:       &common.RealFS{},
+			}
+
+			got, err := Fetch(ctx, params)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				entries, _ := os.ReadDir(params.CacheDir)
+				if len(entries) > 0 {
+					t.Errorf("a failed download left %d entries in the cache", len(entries))
+				}
+				return
+			}
+
+			want := filepath.Join(params.CacheDir, "v1.2.3_linux_amd64", "abc")
+			if got != want {
+				t.Errorf("Fetch() = %q, want %q", got, want)
+			}
+			fi, err := os.Stat(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode()&0o100 == 0 {
+				t.Errorf("the binary isn't executable, its mode is %v", fi.Mode())
+			}
+
+			// The second time, it's cached.
+			if _, err := Fetch(ctx, params); err != nil {
+				t.Fatal(err)
+			}
+			if got := requests.Load(); got != 2 {
+				t.Errorf("got %d requests, want 2 for the first download and none for the second", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common/errs"
+)
+
+// ABCLockFile is the name of the lock file in the ABCInternalDir of a
+// destination directory. It exists while a render or upgrade is writing to the
+// destination directory.
+const ABCLockFile = "lock"
+
+// lockHolderFormat is the format of the contents of a lock file, which say who
+// holds the lock: the process ID, the host name, and the time it was locked.
+const lockHolderFormat = "pid %d on host %q since %s\n"
+
+// DestLock is a lock on a destination directory, held while writing to it so
+// that concurrent renders and upgrades into the same directory don't
+// interleave their writes or corrupt each other's manifests.
+//
+// The lock is a file that's created exclusively, so it works across processes,
+// but it's only advisory: it doesn't stop other programs from writing to the
+// destination directory.
+type DestLock struct {
+	fs   FS
+	path string
+
+	internalDir string
+	destDir     string
+
+	// Whether LockDest created ABCInternalDir and destDir, so that Unlock can
+	// remove them if they're still empty.
+	createdInternalDir, createdDestDir bool
+}
+
+// LockDest locks the destination directory destDir, creating it if needed. If
+// it's already locked, LockDest returns a *errs.DestLockedError without
+// waiting. The caller must call Unlock when it's done writing.
+//
+// now is recorded in the lock file, to help the user judge whether a lock was
+// left behind by an interrupted process.
+func LockDest(rfs FS, destDir string, now time.Time) (*DestLock, error) {
+	internalDir := filepath.Join(destDir, ABCInternalDir)
+	createdInternalDir, err := notExists(rfs, internalDir)
+	if err != nil {
+		return nil, err
+	}
+	createdDestDir, err := notExists(rfs, destDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := rfs.MkdirAll(internalDir, OwnerRWXPerms); err != nil {
+		return nil, fmt.Errorf("MkdirAll(): %w", err)
+	}
+
+	path := filepath.Join(internalDir, ABCLockFile)
+	f, err := rfs.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, OwnerRWPerms)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			holder, _ := rfs.ReadFile(path)
+			return nil, &errs.DestLockedError{
+				LockPath: path,
+				Holder:   strings.TrimSpace(string(holder)),
+			}
+		}
+		return nil, fmt.Errorf("failed creating lock file: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	_, writeErr := fmt.Fprintf(f, lockHolderFormat, os.Getpid(), host, now.UTC().Format(time.RFC3339))
+	if err := errors.Join(writeErr, f.Close()); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed writing lock file: %w", err), rfs.RemoveAll(path))
+	}
+
+	return &DestLock{
+		fs:                 rfs,
+		path:               path,
+		internalDir:        internalDir,
+		destDir:            destDir,
+		createdInternalDir: createdInternalDir,
+		createdDestDir:     createdDestDir,
+	}, nil
+}
+
+// Unlock releases the lock. If LockDest created the ABCInternalDir and nothing
+// else was written to it, it's removed. The same goes for the destination
+// directory, unless keepDest is true; that's for when the destination was
+// written successfully, since an empty destination directory is a valid
+// result.
+func (l *DestLock) Unlock(keepDest bool) error {
+	if err := l.fs.RemoveAll(l.path); err != nil {
+		return fmt.Errorf("failed removing lock file: %w", err)
+	}
+	if l.createdInternalDir {
+		if err := removeIfEmpty(l.fs, l.internalDir); err != nil {
+			return err
+		}
+	}
+	if l.createdDestDir && !keepDest {
+		if err := removeIfEmpty(l.fs, l.destDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreatedDirs returns the directories that LockDest created because they
+// didn't exist yet: the destination directory and its ABCInternalDir.
+func (l *DestLock) CreatedDirs() []string {
+	var out []string
+	if l.createdDestDir {
+		out = append(out, l.destDir)
+	}
+	if l.createdInternalDir {
+		out = append(out, l.internalDir)
+	}
+	return out
+}
+
+// LockHolder is who holds a destination lock, as recorded in its lock file.
+type LockHolder struct {
+	PID   int
+	Host  string
+	Since time.Time
+}
+
+// ParseLockHolder parses the contents of a lock file written by LockDest. It
+// returns false if they're not in the expected format.
+func ParseLockHolder(contents string) (*LockHolder, bool) {
+	var h LockHolder
+	var since string
+	if _, err := fmt.Sscanf(contents, lockHolderFormat, &h.PID, &h.Host, &since); err != nil {
+		return nil, false
+	}
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return nil, false
+	}
+	h.Since = t
+	return &h, true
+}
+
+// notExists returns true if path doesn't exist.
+func notExists(rfs FS, path string) (bool, error) {
+	_, err := rfs.Stat(path)
+	if err == nil {
+		return false, nil
+	}
+	if IsStatNotExistErr(err) {
+		return true, nil
+	}
+	return false, fmt.Errorf("Stat(): %w", err)
+}
+
+// removeIfEmpty removes the directory dir if it has no entries.
+func removeIfEmpty(rfs FS, dir string) error {
+	entries, err := fs.ReadDir(rfs, dir)
+	if err != nil {
+		return fmt.Errorf("ReadDir(): %w", err)
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+	if err := rfs.RemoveAll(dir); err != nil {
+		return fmt.Errorf("RemoveAll(): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/abc/templates/common/errs"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+)
+
+func TestLockDest(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name            string
+		initialContents map[string]string
+		destMissing     bool
+		keepDest        bool
+		wantCreated     []string // relative to the parent of dest
+		wantAfterUnlock map[string]string
+		wantDestExists  bool
+	}{
+		{
+			name:           "existing_empty_dest",
+			wantCreated:    []string{"dest/.abc"},
+			wantDestExists: true,
+		},
+		{
+			name: "existing_abc_dir_is_kept",
+			initialContents: map[string]string{
+				".abc/manifest.lock.yaml": "manifest",
+			},
+			wantAfterUnlock: map[string]string{
+				".abc/manifest.lock.yaml": "manifest",
+			},
+			wantDestExists: true,
+		},
+		{
+			name:        "created_dest_is_removed",
+			destMissing: true,
+			wantCreated: []string{"dest", "dest/.abc"},
+		},
+		{
+			name:           "created_dest_is_kept_with_keep_dest",
+			destMissing:    true,
+			keepDest:       true,
+			wantCreated:    []string{"dest", "dest/.abc"},
+			wantDestExists: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dest := filepath.Join(t.TempDir(), "dest")
+			if !tc.destMissing {
+				if err := os.MkdirAll(dest, OwnerRWXPerms); err != nil {
+					t.Fatal(err)
+				}
+			}
+			abctestutil.WriteAllDefaultMode(t, dest, tc.initialContents)
+
+			rfs := &RealFS{}
+			lock, err := LockDest(rfs, dest, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotCreated []string
+			for _, dir := range lock.CreatedDirs() {
+				rel, err := filepath.Rel(filepath.Dir(dest), dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotCreated = append(gotCreated, filepath.ToSlash(rel))
+			}
+			if diff := cmp.Diff(gotCreated, tc.wantCreated); diff != "" {
+				t.Errorf("CreatedDirs() was not as expected (-got,+want): %s", diff)
+			}
+
+			lockPath := filepath.Join(dest, ABCInternalDir, ABCLockFile)
+			_, err = LockDest(rfs, dest, now)
+			if !errors.Is(err, &errs.DestLockedError{}) {
+				t.Fatalf("second LockDest() got error %v, want a DestLockedError", err)
+			}
+			wantHolder := fmt.Sprintf("pid %d on host", os.Getpid())
+			if !strings.Contains(err.Error(), wantHolder) || !strings.Contains(err.Error(), "since 2024-03-01T12:00:00Z") {
+				t.Errorf("second LockDest() got error %q, want it to describe the holder of the lock", err)
+			}
+			if !strings.Contains(err.Error(), lockPath) {
+				t.Errorf("second LockDest() got error %q, want it to contain the lock path %q", err, lockPath)
+			}
+
+			if err := lock.Unlock(tc.keepDest); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = os.Stat(dest)
+			if gotDestExists := err == nil; gotDestExists != tc.wantDestExists {
+				t.Errorf("after Unlock, dest exists is %t, want %t", gotDestExists, tc.wantDestExists)
+			}
+			if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, dest), tc.wantAfterUnlock, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("dest contents after Unlock were not as expected (-got,+want): %s", diff)
+			}
+			if tc.wantDestExists {
+				if got := abctestutil.LoadEmptyDirs(t, dest); len(got) > 0 {
+					t.Errorf("after Unlock, got empty directories %v, want none", got)
+				}
+			}
+
+			// The lock can be taken again after it's released.
+			lock, err = LockDest(rfs, dest, now)
+			if err != nil {
+				t.Fatalf("LockDest() after Unlock(): %v", err)
+			}
+			if err := lock.Unlock(true); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestParseLockHolder(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	contents := fmt.Sprintf(lockHolderFormat, 1234, "my host", since.Format(time.RFC3339))
+
+	for _, in := range []string{contents, strings.TrimSpace(contents)} {
+		got, ok := ParseLockHolder(in)
+		if !ok {
+			t.Fatalf("ParseLockHolder(%q) failed", in)
+		}
+		if diff := cmp.Diff(got, &LockHolder{PID: 1234, Host: "my host", Since: since}); diff != "" {
+			t.Errorf("ParseLockHolder(%q) was not as expected (-got,+want): %s", in, diff)
+		}
+	}
+
+	for _, in := range []string{"", "locked by someone", `pid 1 on host "h" since yesterday`} {
+		if got, ok := ParseLockHolder(in); ok {
+			t.Errorf("ParseLockHolder(%q) = %+v, want failure", in, got)
+		}
+	}
+}
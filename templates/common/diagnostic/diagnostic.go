@@ -0,0 +1,365 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diagnostic defines the JSON output of the commands that check
+// templates, like "templates lint --format=json", so that an editor extension
+// or language server can show template authoring errors next to the lines of
+// spec.yaml that caused them.
+//
+// The JSON field names, severities, and codes are part of the CLI's
+// interface, so they must not change. Fields and codes may be added.
+package diagnostic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/abc/templates/model/spec/features"
+)
+
+// SchemaVersion is the version of the JSON schema of Report. It's only
+// incremented for changes that would break existing readers.
+const SchemaVersion = 1
+
+// FormatText and FormatJSON are the values of the --format flag of the
+// commands that print a Report.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Formats are the valid values of --format.
+var Formats = []string{FormatText, FormatJSON}
+
+// ValidateFormat returns an error if format isn't one of Formats.
+func ValidateFormat(format string) error {
+	for _, f := range Formats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid format %q, must be one of %s", format, strings.Join(Formats, ", "))
+}
+
+// Severity is how bad a Diagnostic is.
+type Severity string
+
+const (
+	// SeverityError means the template won't work, and the command fails.
+	SeverityError Severity = "error"
+
+	// SeverityWarning means the template works, but should be changed.
+	SeverityWarning Severity = "warning"
+)
+
+// The values of Diagnostic.Code.
+const (
+	// CodeError is for errors that don't have a more specific code.
+	CodeError = "error"
+
+	// CodeDownloadFailed means the template couldn't be downloaded or copied.
+	CodeDownloadFailed = "download_failed"
+
+	// CodeSpecInvalid means spec.yaml couldn't be parsed or isn't valid.
+	CodeSpecInvalid = "spec_invalid"
+
+	// CodeGoldenTestInvalid means a golden test's test.yaml couldn't be parsed
+	// or isn't valid.
+	CodeGoldenTestInvalid = "golden_test_invalid"
+
+	// CodeBaseTemplateFailed means a template named by "extends" couldn't be
+	// downloaded or isn't valid.
+	CodeBaseTemplateFailed = "base_template_failed"
+
+	// CodeAPIVersionOutdated means spec.yaml has an older api_version than
+	// the latest one supported.
+	CodeAPIVersionOutdated = "api_version_outdated"
+
+	// CodeAPIVersionMigration means spec.yaml keeps an old behavior because
+	// of its api_version, which a newer api_version would change.
+	CodeAPIVersionMigration = "api_version_migration"
+
+	// CodeInputInvalid means the given inputs are unknown, missing, or of the
+	// wrong type.
+	CodeInputInvalid = "input_invalid"
+
+	// CodeInputRuleViolated means an input doesn't satisfy one of its rules.
+	CodeInputRuleViolated = "input_rule_violated"
+
+	// CodeInputConstraintViolated means the inputs don't satisfy one of the
+	// spec's input_constraints.
+	CodeInputConstraintViolated = "input_constraint_violated"
+
+	// CodeRenderFailed means rendering the template failed.
+	CodeRenderFailed = "render_failed"
+
+	// CodeNotIdempotent means rendering the template a second time into the
+	// same directory changed its output.
+	CodeNotIdempotent = "not_idempotent"
+
+	// CodeNotDeterministic means two renders of the template with the same
+	// inputs produced different output.
+	CodeNotDeterministic = "not_deterministic"
+)
+
+// Diagnostic is one problem with a template.
+type Diagnostic struct {
+	// File is the slash-separated path of the file that the problem is in,
+	// relative to the template directory, like "spec.yaml". It's empty if
+	// the problem isn't in a particular file.
+	File string `json:"file,omitempty"`
+
+	// Line and Column are where the problem is in File, starting at 1. They're
+	// zero if the position isn't known.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+
+	Severity Severity `json:"severity"`
+
+	// Code is one of the Code values above, for tools that treat some
+	// problems specially.
+	Code string `json:"code"`
+
+	Message string `json:"message"`
+}
+
+// String formats d like a compiler message, like
+// "spec.yaml:3:5: error: invalid glob".
+func (d *Diagnostic) String() string {
+	var loc string
+	if d.File != "" {
+		loc = d.File + ":"
+		if d.Line > 0 {
+			loc += fmt.Sprintf("%d:%d:", d.Line, d.Column)
+		}
+		loc += " "
+	}
+	return fmt.Sprintf("%s%s: %s", loc, d.Severity, d.Message)
+}
+
+// Report is the JSON output of a command that checks a template.
+type Report struct {
+	// SchemaVersion is always the SchemaVersion constant.
+	SchemaVersion int `json:"schema_version"`
+
+	// Command is the name of the command, like "lint".
+	Command string `json:"command"`
+
+	// Source is the location of the template, as given on the command line.
+	Source string `json:"source"`
+
+	// Diagnostics is never null in the JSON, so readers can iterate over it
+	// without checking.
+	Diagnostics []*Diagnostic `json:"diagnostics"`
+
+	// Template describes the template, for the "describe" command.
+	Template *Template `json:"template,omitempty"`
+}
+
+// Template describes a template and its inputs, including those of the
+// templates that it extends.
+type Template struct {
+	Description string   `json:"description"`
+	Inputs      []*Input `json:"inputs"`
+}
+
+// Input describes one of a template's inputs.
+type Input struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Type        string  `json:"type"`
+	Default     *string `json:"default,omitempty"`
+	DefaultFrom string  `json:"default_from,omitempty"`
+	Rules       []*Rule `json:"rules,omitempty"`
+
+	// Line and Column are where the input is defined in spec.yaml. They're
+	// zero for inputs of a base template.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// Rule is one of the validation rules of an Input.
+type Rule struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message,omitempty"`
+}
+
+// NewReport returns an empty Report for the given command and template.
+func NewReport(command, source string) *Report {
+	return &Report{
+		SchemaVersion: SchemaVersion,
+		Command:       command,
+		Source:        source,
+		Diagnostics:   []*Diagnostic{},
+	}
+}
+
+// Add appends diagnostics to the report.
+func (r *Report) Add(ds ...*Diagnostic) {
+	r.Diagnostics = append(r.Diagnostics, ds...)
+}
+
+// AddError appends the diagnostics for err, as returned by FromError, with
+// SeverityError.
+func (r *Report) AddError(file string, err error) {
+	r.Add(FromError(file, SeverityError, err)...)
+}
+
+// ErrorCount returns the number of diagnostics with SeverityError.
+func (r *Report) ErrorCount() int {
+	var n int
+	for _, d := range r.Diagnostics {
+		if d.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+// Write writes the report to w as indented JSON.
+func (r *Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false) // rules and messages commonly contain "<" and ">"
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed writing diagnostics: %w", err)
+	}
+	return nil
+}
+
+// At returns a diagnostic at the given position in file. pos may be nil.
+func At(file string, pos *model.ConfigPos, severity Severity, code, msg string) *Diagnostic {
+	d := &Diagnostic{File: file, Severity: severity, Code: code, Message: msg}
+	if pos != nil {
+		d.Line, d.Column = pos.Line, pos.Column
+	}
+	return d
+}
+
+// OutdatedAPIVersion returns a warning at the api_version of a spec file if
+// it's older than latest and behaves differently, or nil if it doesn't; see
+// decode.OutdatedAPIVersion.
+func OutdatedAPIVersion(file string, apiVersion model.String, latest string) *Diagnostic {
+	if !decode.OutdatedAPIVersion(apiVersion.Val, latest) {
+		return nil
+	}
+	return At(file, apiVersion.Pos, SeverityWarning, CodeAPIVersionOutdated,
+		fmt.Sprintf("api_version %q is older than the latest, %q; change it to the latest to use the newest features", apiVersion.Val, latest))
+}
+
+// Migrations returns a warning at the api_version of a spec file for each of
+// the old behaviors that the spec keeps because of its api_version. With
+// explain, each message also says how the behavior would change.
+func Migrations(file string, apiVersion model.String, migrations []*features.Migration, explain bool) []*Diagnostic {
+	out := make([]*Diagnostic, 0, len(migrations))
+	for _, m := range migrations {
+		msg := fmt.Sprintf("api_version %q is older than %q, so %s", apiVersion.Val, m.Since, m.Assumed)
+		if explain {
+			msg += ". " + m.Explanation
+		}
+		out = append(out, At(file, apiVersion.Pos, SeverityWarning, CodeAPIVersionMigration, msg))
+	}
+	return out
+}
+
+// WithCode returns err, with the same message, marked with one of the Code
+// values above for FromError. Returns nil if err is nil.
+func WithCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+type codedError struct {
+	code string
+	err  error
+}
+
+func (c *codedError) Error() string {
+	return c.err.Error()
+}
+
+func (c *codedError) Unwrap() error {
+	return c.err
+}
+
+// FromError converts err to diagnostics. Errors that were combined with
+// errors.Join, like the validation errors of a spec file, become separate
+// diagnostics. The position of each one in file is taken from the
+// *model.PosError that it wraps, if any, and the file is left out if the
+// position isn't known. The code is the one given to WithCode, or CodeError.
+func FromError(file string, severity Severity, err error) []*Diagnostic {
+	code := CodeError
+	var ce *codedError
+	if errors.As(err, &ce) {
+		code = ce.code
+	}
+
+	var out []*Diagnostic
+	for _, leaf := range splitJoined(err) {
+		d := &Diagnostic{Severity: severity, Code: code, Message: leaf.Error()}
+		var pe *model.PosError
+		if errors.As(leaf, &pe) {
+			d.File, d.Line, d.Column = file, pe.Pos.Line, pe.Pos.Column
+			// The position is in its own fields, so it doesn't need to be in
+			// the message too.
+			d.Message = strings.Replace(d.Message, fmt.Sprintf("at line %d column %d: ", pe.Pos.Line, pe.Pos.Column), "", 1)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// splitJoined returns the errors that were combined with errors.Join to make
+// err, however deeply it's wrapped, or err itself if it isn't a joined error.
+func splitJoined(err error) []error {
+	for e := err; e != nil; {
+		switch u := e.(type) { //nolint:errorlint // unwrapping one level at a time on purpose
+		case interface{ Unwrap() []error }:
+			var out []error
+			for _, child := range u.Unwrap() {
+				if isCategory(child) {
+					// errs.Wrap adds its category as a second wrapped error,
+					// but it isn't a separate problem.
+					continue
+				}
+				out = append(out, splitJoined(child)...)
+			}
+			if len(out) == 1 {
+				// Like the wrapped error of errs.Wrap, but err has more
+				// context in its message.
+				return []error{err}
+			}
+			return out
+		case interface{ Unwrap() error }:
+			e = u.Unwrap()
+		default:
+			e = nil
+		}
+	}
+	return []error{err}
+}
+
+// isCategory returns true if err is one of the error categories in the errs
+// package, rather than an error that's in one of them.
+func isCategory(err error) bool {
+	return errs.Code(err) != "" && errors.Unwrap(err) == nil
+}
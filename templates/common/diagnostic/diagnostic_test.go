@@ -0,0 +1,183 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/spec/features"
+)
+
+func TestFromError(t *testing.T) {
+	t.Parallel()
+
+	pos := &model.ConfigPos{Line: 3, Column: 5}
+
+	cases := []struct {
+		name string
+		err  error
+		want []*Diagnostic
+	}{
+		{
+			name: "plain",
+			err:  fmt.Errorf("failed to download: %w", errors.New("not found")),
+			want: []*Diagnostic{
+				{Severity: SeverityError, Code: CodeError, Message: "failed to download: not found"},
+			},
+		},
+		{
+			name: "positioned",
+			err:  fmt.Errorf("error reading spec: %w", pos.Errorf("bad glob")),
+			want: []*Diagnostic{
+				{File: "spec.yaml", Line: 3, Column: 5, Severity: SeverityError, Code: CodeError, Message: "error reading spec: bad glob"},
+			},
+		},
+		{
+			name: "joined_with_code",
+			err: WithCode(CodeSpecInvalid, fmt.Errorf("validation failed: %w", errors.Join(
+				pos.Errorf("bad glob"),
+				(&model.ConfigPos{Line: 7, Column: 1}).Errorf("missing field"),
+				errors.New("no position"),
+			))),
+			want: []*Diagnostic{
+				{File: "spec.yaml", Line: 3, Column: 5, Severity: SeverityError, Code: CodeSpecInvalid, Message: "bad glob"},
+				{File: "spec.yaml", Line: 7, Column: 1, Severity: SeverityError, Code: CodeSpecInvalid, Message: "missing field"},
+				{Severity: SeverityError, Code: CodeSpecInvalid, Message: "no position"},
+			},
+		},
+		{
+			name: "errs_category_is_not_a_separate_problem",
+			err:  WithCode(CodeRenderFailed, errs.Wrap(errs.ErrConflict, pos.Errorf("already exists"))),
+			want: []*Diagnostic{
+				{File: "spec.yaml", Line: 3, Column: 5, Severity: SeverityError, Code: CodeRenderFailed, Message: "already exists"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := FromError("spec.yaml", SeverityError, tc.err)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("diagnostics were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	t.Parallel()
+
+	apiVersion := model.String{Val: "cli.abcxyz.dev/v1beta3", Pos: &model.ConfigPos{Line: 1, Column: 14}}
+	migrations := []*features.Migration{
+		{Feature: "SkipFoo", Since: "cli.abcxyz.dev/v1beta4", Assumed: "foo is off", Explanation: "Starting in v1beta4, foo is on."},
+	}
+
+	cases := []struct {
+		name    string
+		explain bool
+		want    []*Diagnostic
+	}{
+		{
+			name: "short",
+			want: []*Diagnostic{{
+				File: "spec.yaml", Line: 1, Column: 14, Severity: SeverityWarning, Code: CodeAPIVersionMigration,
+				Message: `api_version "cli.abcxyz.dev/v1beta3" is older than "cli.abcxyz.dev/v1beta4", so foo is off`,
+			}},
+		},
+		{
+			name:    "explained",
+			explain: true,
+			want: []*Diagnostic{{
+				File: "spec.yaml", Line: 1, Column: 14, Severity: SeverityWarning, Code: CodeAPIVersionMigration,
+				Message: `api_version "cli.abcxyz.dev/v1beta3" is older than "cli.abcxyz.dev/v1beta4", so foo is off. Starting in v1beta4, foo is on.`,
+			}},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := Migrations("spec.yaml", apiVersion, migrations, tc.explain)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("diagnostics were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	r := NewReport("lint", "./my_template")
+	r.Add(At("spec.yaml", &model.ConfigPos{Line: 1, Column: 14}, SeverityWarning, CodeAPIVersionOutdated, "api_version is old"))
+	r.AddError("spec.yaml", WithCode(CodeNotIdempotent, errors.New("a.txt changed")))
+
+	if got, want := r.ErrorCount(), 1; got != want {
+		t.Errorf("ErrorCount() = %d, want %d", got, want)
+	}
+
+	var sb strings.Builder
+	if err := r.Write(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "schema_version": 1,
+  "command": "lint",
+  "source": "./my_template",
+  "diagnostics": [
+    {
+      "file": "spec.yaml",
+      "line": 1,
+      "column": 14,
+      "severity": "warning",
+      "code": "api_version_outdated",
+      "message": "api_version is old"
+    },
+    {
+      "severity": "error",
+      "code": "not_idempotent",
+      "message": "a.txt changed"
+    }
+  ]
+}
+`
+	if diff := cmp.Diff(sb.String(), want); diff != "" {
+		t.Errorf("report JSON was not as expected (-got,+want): %s", diff)
+	}
+
+	wantStrings := []string{
+		`spec.yaml:1:14: warning: api_version is old`,
+		`error: a.txt changed`,
+	}
+	for i, d := range r.Diagnostics {
+		if got := d.String(); got != wantStrings[i] {
+			t.Errorf("String() of diagnostic %d = %q, want %q", i, got, wantStrings[i])
+		}
+	}
+}
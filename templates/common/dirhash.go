@@ -0,0 +1,90 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/hashalg"
+)
+
+// HashTemplateDir is like dirhash.HashDir, except that a symlink is hashed by
+// its target rather than by the contents of the file that it points to. So a
+// template that was copied with --symlinks=preserve can be hashed even if it
+// has symlinks to directories or dangling symlinks. The result is what's
+// recorded as the template_dirhash in manifests, with hashalg.Default.
+//
+// Hashing stops with an error once ctx is canceled.
+func HashTemplateDir(ctx context.Context, dir string) (string, error) {
+	return HashTemplateDirFS(ctx, &RealFS{}, dir)
+}
+
+// HashTemplateDirFS is HashTemplateDir for a directory in rfs, which may be a
+// filesystem other than the real one, like MemFS.
+func HashTemplateDirFS(ctx context.Context, rfs FS, dir string) (string, error) {
+	return HashTemplateDirWith(ctx, rfs, dir, hashalg.Default)
+}
+
+// HashTemplateDirWith is HashTemplateDirFS with the hash algorithm alg. To
+// check a hash that was recorded earlier, use the algorithm that made it,
+// which hashalg.Of returns.
+func HashTemplateDirWith(ctx context.Context, rfs FS, dir string, alg *hashalg.Algorithm) (string, error) {
+	dir = filepath.Clean(dir)
+	var files []string
+	err := fs.WalkDir(rfs, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+		if path == dir {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", dir, path, err)
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed listing the files to hash: %w", err)
+	}
+	open := func(name string) (io.ReadCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		target, ok, err := ReadlinkIfSymlink(rfs, path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return io.NopCloser(strings.NewReader(filepath.ToSlash(target))), nil
+		}
+		return rfs.Open(path) //nolint:wrapcheck
+	}
+	h, err := alg.HashFiles(files, open)
+	if err != nil {
+		return "", fmt.Errorf("failed hashing with %s: %w", alg.Name, err)
+	}
+	return h, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errs
+
+import (
+	"errors"
+)
+
+// These are the categories of errors that callers of abc, like wrapper
+// scripts, CI jobs, and tests, commonly need to tell apart. Check for them
+// with errors.Is rather than by matching error messages. Each category has an
+// exit code and a code string for JSON; see ExitCode and Code.
+//
+// An error is put in a category with Wrap, which doesn't change its message.
+var (
+	// ErrInputValidation means that the template inputs were missing, unknown,
+	// of the wrong type, or failed a validation rule.
+	ErrInputValidation = errors.New("input validation failed")
+
+	// ErrSourceNotFound means that the template source doesn't exist, or
+	// doesn't have the requested version or subdirectory.
+	ErrSourceNotFound = errors.New("template source not found")
+
+	// ErrConflict means that the output conflicts with what's already in the
+	// destination, like a file that would be overwritten without
+	// --force-overwrite, or a destination locked by another render.
+	ErrConflict = errors.New("conflict in the destination")
+
+	// ErrGoldenMismatch means that a golden test's output didn't match what
+	// was recorded.
+	ErrGoldenMismatch = errors.New("golden test output mismatch")
+
+	// ErrPolicyViolation means that the rendered output broke one of the
+	// policies given with --policy-file, so it wasn't written.
+	ErrPolicyViolation = errors.New("policy violation")
+)
+
+// ExitCodeOther is the exit code for errors that aren't in any category.
+const ExitCodeOther = 1
+
+type category struct {
+	err      error
+	code     string
+	exitCode int
+}
+
+// The exit codes are part of the CLI's interface, so they must never change.
+// Exit code 2 is skipped because it's conventionally used for usage errors.
+var categories = []*category{
+	{err: ErrInputValidation, code: "input_validation", exitCode: 3},
+	{err: ErrSourceNotFound, code: "source_not_found", exitCode: 4},
+	{err: ErrConflict, code: "conflict", exitCode: 5},
+	{err: ErrGoldenMismatch, code: "golden_mismatch", exitCode: 6},
+	{err: ErrPolicyViolation, code: "policy_violation", exitCode: 7},
+}
+
+// Wrap puts err in the given category, which is one of the ErrFoo values
+// above, so that errors.Is(err, category) is true. The message of the
+// returned error is the same as the message of err. Returns nil if err is nil.
+func Wrap(category, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorizedError{category: category, err: err}
+}
+
+type categorizedError struct {
+	category error
+	err      error
+}
+
+func (c *categorizedError) Error() string {
+	return c.err.Error()
+}
+
+func (c *categorizedError) Unwrap() []error {
+	return []error{c.err, c.category}
+}
+
+// ExitCode returns the exit code that the CLI should exit with for err: 0 for
+// nil, the code of err's category if it has one, and otherwise ExitCodeOther.
+// If err is in more than one category, the first one listed above wins.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if c := categoryOf(err); c != nil {
+		return c.exitCode
+	}
+	return ExitCodeOther
+}
+
+// Code returns a short string naming err's category, like "conflict", for
+// use in JSON. Returns "" if err isn't in a category.
+func Code(err error) string {
+	if c := categoryOf(err); c != nil {
+		return c.code
+	}
+	return ""
+}
+
+func categoryOf(err error) *category {
+	for _, c := range categories {
+		if errors.Is(err, c.err) {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCategories(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		err          error
+		wantIs       error
+		wantExitCode int
+		wantCode     string
+	}{
+		{
+			name:         "nil",
+			err:          nil,
+			wantExitCode: 0,
+		},
+		{
+			name:         "uncategorized",
+			err:          errors.New("something broke"),
+			wantExitCode: ExitCodeOther,
+		},
+		{
+			name:         "input_validation",
+			err:          Wrap(ErrInputValidation, errors.New("missing input(s): foo")),
+			wantIs:       ErrInputValidation,
+			wantExitCode: 3,
+			wantCode:     "input_validation",
+		},
+		{
+			name:         "source_not_found_wrapped_again",
+			err:          fmt.Errorf("failed to download: %w", Wrap(ErrSourceNotFound, errors.New("no such repo"))),
+			wantIs:       ErrSourceNotFound,
+			wantExitCode: 4,
+			wantCode:     "source_not_found",
+		},
+		{
+			name:         "conflict",
+			err:          Wrap(ErrConflict, errors.New("file exists")),
+			wantIs:       ErrConflict,
+			wantExitCode: 5,
+			wantCode:     "conflict",
+		},
+		{
+			name:         "dest_locked_is_a_conflict",
+			err:          &DestLockedError{LockPath: "/dest/.abc/lock"},
+			wantIs:       ErrConflict,
+			wantExitCode: 5,
+			wantCode:     "conflict",
+		},
+		{
+			name:         "golden_mismatch",
+			err:          Wrap(ErrGoldenMismatch, errors.New("a.txt differs")),
+			wantIs:       ErrGoldenMismatch,
+			wantExitCode: 6,
+			wantCode:     "golden_mismatch",
+		},
+		{
+			name:         "policy_violation",
+			err:          Wrap(ErrPolicyViolation, errors.New("CODEOWNERS is missing")),
+			wantIs:       ErrPolicyViolation,
+			wantExitCode: 7,
+			wantCode:     "policy_violation",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.wantIs != nil && !errors.Is(tc.err, tc.wantIs) {
+				t.Errorf("errors.Is(%v, %v) = false, want true", tc.err, tc.wantIs)
+			}
+			if got := ExitCode(tc.err); got != tc.wantExitCode {
+				t.Errorf("ExitCode() = %d, want %d", got, tc.wantExitCode)
+			}
+			if got := Code(tc.err); got != tc.wantCode {
+				t.Errorf("Code() = %q, want %q", got, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	t.Parallel()
+
+	if Wrap(ErrConflict, nil) != nil {
+		t.Errorf("Wrap() of a nil error should be nil")
+	}
+
+	inner := &UnknownVarError{VarName: "x", Wrapped: errors.New("wrapped")}
+	err := Wrap(ErrInputValidation, inner)
+	if got, want := err.Error(), inner.Error(); got != want {
+		t.Errorf("Wrap() changed the error message to %q, want %q", got, want)
+	}
+	var as *UnknownVarError
+	if !errors.As(err, &as) {
+		t.Errorf("errors.As() should find the wrapped error of type %T", as)
+	}
+	if errors.Is(err, ErrConflict) {
+		t.Errorf("errors.Is() should be false for a category the error isn't in")
+	}
+}
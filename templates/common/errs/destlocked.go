@@ -0,0 +1,47 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errs
+
+import "fmt"
+
+// DestLockedError is returned when a destination directory can't be written
+// because another render or upgrade is writing to it.
+type DestLockedError struct {
+	// LockPath is the path of the lock file.
+	LockPath string
+
+	// Holder describes the process holding the lock, as recorded in the lock
+	// file. It may be empty if the lock file couldn't be read.
+	Holder string
+}
+
+func (d *DestLockedError) Error() string {
+	holder := ""
+	if d.Holder != "" {
+		holder = fmt.Sprintf(" (held by %s)", d.Holder)
+	}
+	return fmt.Sprintf("the destination directory is locked by another render or upgrade%s; "+
+		"if no other render or upgrade is running, it may have been interrupted, and you can delete the lock file %q",
+		holder, d.LockPath)
+}
+
+// Is returns true for any DestLockedError, and for ErrConflict.
+func (d *DestLockedError) Is(other error) bool {
+	if other == ErrConflict {
+		return true
+	}
+	_, ok := other.(*DestLockedError)
+	return ok
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os/exec"
 	"time"
 )
@@ -42,6 +43,28 @@ const DefaultRunTimeout = time.Minute
 // If the command fails, the error message will include the contents of stdout
 // and stderr. This saves boilerplate in the caller.
 func Run(ctx context.Context, args ...string) (stdout, stderr string, _ error) {
+	return RunWithStdin(ctx, nil, args...)
+}
+
+// RunWithStdin is like [Run], but the command's stdin is read from the given
+// reader. If stdin is nil, the command reads from the null device.
+func RunWithStdin(ctx context.Context, stdin io.Reader, args ...string) (stdout, stderr string, _ error) {
+	return run(ctx, stdin, "", nil, args...)
+}
+
+// RunInDir is like [Run], but the command runs in the directory dir, and its
+// environment is only env, in the "key=value" form of exec.Cmd.Env, rather
+// than that of this process.
+func RunInDir(ctx context.Context, dir string, env []string, args ...string) (stdout, stderr string, _ error) {
+	if env == nil {
+		env = []string{}
+	}
+	return run(ctx, nil, dir, env, args...)
+}
+
+// run runs the command given by args. If env is nil, the command inherits the
+// environment of this process.
+func run(ctx context.Context, stdin io.Reader, dir string, env []string, args ...string) (stdout, stderr string, _ error) {
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, DefaultRunTimeout)
@@ -51,6 +74,9 @@ func Run(ctx context.Context, args ...string) (stdout, stderr string, _ error) {
 
 	stdoutBuf := &bytes.Buffer{}
 	stderrBuf := &bytes.Buffer{}
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdin = stdin
 	cmd.Stdout = stdoutBuf
 	cmd.Stderr = stderrBuf
 
@@ -16,6 +16,7 @@ package common
 
 import (
 	"context"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -29,6 +30,7 @@ func TestExec(t *testing.T) {
 	cases := []struct {
 		name       string
 		args       []string
+		stdin      string
 		timeout    time.Duration
 		wantStdout string
 		wantStderr string
@@ -39,6 +41,12 @@ func TestExec(t *testing.T) {
 			args:       []string{"echo", "hello", "world"},
 			wantStdout: "hello world",
 		},
+		{
+			name:       "stdin",
+			args:       []string{"cat"},
+			stdin:      "hello from stdin",
+			wantStdout: "hello from stdin",
+		},
 		{
 			name:       "simple_stderr",
 			args:       []string{"ls", "--nonexistent"},
@@ -69,7 +77,13 @@ func TestExec(t *testing.T) {
 				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
 				defer cancel()
 			}
-			stdout, stderr, err := Run(ctx, tc.args...)
+			var stdout, stderr string
+			var err error
+			if tc.stdin != "" {
+				stdout, stderr, err = RunWithStdin(ctx, strings.NewReader(tc.stdin), tc.args...)
+			} else {
+				stdout, stderr, err = Run(ctx, tc.args...)
+			}
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
@@ -83,3 +97,22 @@ func TestExec(t *testing.T) {
 		})
 	}
 }
+
+func TestRunInDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := (&RealFS{}).WriteFile(filepath.Join(dir, "marker.txt"), nil, OwnerRWPerms); err != nil {
+		t.Fatal(err)
+	}
+
+	// HOME is set in the environment of the test, but isn't passed.
+	stdout, _, err := RunInDir(context.Background(), dir, []string{"FOO=foo"},
+		"sh", "-c", `echo "$FOO,$HOME"; ls`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "foo,\nmarker.txt\n"; stdout != want {
+		t.Errorf("got stdout %q, want %q", stdout, want)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package extends implements template inheritance. A spec.yaml may name a base
+// template in its "extends" field; the base template is downloaded, and its
+// inputs, rules and steps are combined with those of the extending template.
+//
+// The rules for combining a template with its base are:
+//
+//   - Inputs are matched by name. An input declared by the extending template
+//     replaces the base template's input of the same name entirely (including
+//     its default and rules), but keeps its position in the input order. Inputs
+//     that only the extending template declares come last.
+//   - Vars are matched by name, the same way as inputs.
+//   - Rules and input constraints are combined, the base template's first.
+//   - The skip_if_exists, skip_generated_marker, and executable patterns are
+//     combined, so they apply to the output files of every template in the
+//     chain.
+//   - The env_vars are combined, so every template in the chain can read the
+//     environment variables that any of them declares.
+//   - Destinations are matched by name, the same way as inputs.
+//   - Steps are not combined into a single list, because each template's
+//     steps read files from that template's own directory. Instead, the base
+//     template's steps run first, then the extending template's steps run on
+//     the result.
+//
+// A base template may itself extend another template.
+package extends
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// maxDepth limits how long a chain of base templates may be. This is mostly a
+// backstop for cycles that can't be detected by comparing sources, like two
+// different remote versions that extend each other.
+const maxDepth = 10
+
+// Base is a base template that has been downloaded.
+type Base struct {
+	// Source is the "extends" value that named this template.
+	Source string
+
+	// Spec is the parsed spec.yaml of the base template.
+	Spec *spec.Spec
+
+	// TemplateDir is the temp directory that the base template was downloaded
+	// into.
+	TemplateDir string
+}
+
+// ResolveParams contains the arguments to Resolve.
+type ResolveParams struct {
+	// The working directory, passed along to the downloader.
+	Cwd string
+
+	// Downloader is the downloader of the extending template. It's used to
+	// resolve relative "extends" paths: for a local template, relative paths
+	// are relative to the template's own directory.
+	Downloader templatesource.Downloader
+
+	// FS is the filesystem that base templates are downloaded into.
+	FS common.FS
+
+	// The value of --git-protocol.
+	GitProtocol string
+
+	// The values of --max-files, --max-bytes, and --max-path-depth, which
+	// limit the size of each downloaded base template. If nil, there are no
+	// limits.
+	Limits *common.Limits
+
+	// Spec is the spec of the extending template.
+	Spec *spec.Spec
+
+	// The value of --symlinks.
+	Symlinks common.SymlinkMode
+
+	// TemplateDir is the directory the extending template was downloaded into.
+	TemplateDir string
+
+	// TempDirBase is the directory under which the base template directories
+	// are created. Normally empty, except in testing.
+	TempDirBase string
+
+	// Tracker is used to create the base template directories, so they're
+	// cleaned up along with the caller's other temp dirs.
+	Tracker *tempdir.DirTracker
+
+	// VendorDir is an absolute path to a directory of vendored templates.
+	// Base templates that were vendored there are used instead of being
+	// downloaded. See templatesource.ParseSourceParams.
+	VendorDir string
+
+	// DownloadRetry and DownloadStats are passed to
+	// templatesource.ParseSourceParams for each base template. Both may be
+	// nil.
+	DownloadRetry *templatesource.RetryPolicy
+	DownloadStats *templatesource.DownloadStats
+}
+
+// Resolve downloads the base templates named by p.Spec.Extends, following
+// the chain of "extends" fields. The returned list begins with the base
+// template at the root of the chain, whose steps should run first. If p.Spec
+// doesn't extend another template, the returned list is empty.
+func Resolve(ctx context.Context, p *ResolveParams) ([]*Base, error) {
+	logger := logging.FromContext(ctx).With("logger", "extends.Resolve")
+
+	var out []*Base
+	seen := map[string]struct{}{}
+	if ld, ok := p.Downloader.(*templatesource.LocalDownloader); ok {
+		seen[filepath.Clean(ld.SrcPath)] = struct{}{}
+	}
+	cur, downloader, templateDir := p.Spec, p.Downloader, p.TemplateDir
+	for cur.Extends.Val != "" {
+		if len(out) == maxDepth {
+			return nil, cur.Extends.Pos.Errorf("too many levels of \"extends\", the limit is %d", maxDepth)
+		}
+
+		cwd := templateDir
+		if ld, ok := downloader.(*templatesource.LocalDownloader); ok {
+			cwd = ld.Dir()
+		}
+		baseDownloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+			CWD:         cwd,
+			Source:      cur.Extends.Val,
+			GitProtocol: p.GitProtocol,
+			FS:          p.FS,
+			Limits:      p.Limits,
+			Symlinks:    p.Symlinks,
+			VendorDir:   p.VendorDir,
+			Retry:       p.DownloadRetry,
+			Stats:       p.DownloadStats,
+		})
+		if err != nil {
+			return nil, cur.Extends.Pos.Errorf("invalid \"extends\": %w", err)
+		}
+
+		key := cur.Extends.Val
+		if ld, ok := baseDownloader.(*templatesource.LocalDownloader); ok {
+			key = filepath.Clean(ld.SrcPath)
+		}
+		if _, ok := seen[key]; ok {
+			return nil, cur.Extends.Pos.Errorf("template %q extends itself, directly or indirectly", cur.Extends.Val)
+		}
+		seen[key] = struct{}{}
+
+		baseDir, err := p.Tracker.MkdirTempTracked(p.TempDirBase, tempdir.BaseTemplateDirNamePart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory for base template: %w", err)
+		}
+		if _, err := templatesource.DownloadVerified(ctx, &templatesource.DownloadVerifiedParams{
+			Downloader: baseDownloader,
+			Cwd:        p.Cwd,
+			DestDir:    baseDir,
+			FS:         p.FS,
+			Stats:      p.DownloadStats,
+		}); err != nil {
+			return nil, cur.Extends.Pos.Errorf("failed to download base template %q: %w", cur.Extends.Val, err)
+		}
+		baseSpec, err := specutil.Load(ctx, p.FS, baseDir, cur.Extends.Val)
+		if err != nil {
+			return nil, fmt.Errorf("in base template %q: %w", cur.Extends.Val, err)
+		}
+		if err := specutil.WriteInlineFiles(p.FS, baseDir, baseSpec); err != nil {
+			return nil, fmt.Errorf("in base template %q: %w", cur.Extends.Val, err)
+		}
+		logger.DebugContext(ctx, "downloaded base template",
+			"source", cur.Extends.Val,
+			"destination", baseDir)
+
+		out = append(out, &Base{
+			Source:      cur.Extends.Val,
+			Spec:        baseSpec,
+			TemplateDir: baseDir,
+		})
+		cur, downloader, templateDir = baseSpec, baseDownloader, baseDir
+	}
+
+	// Reverse, so the root of the chain is first.
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// Merge returns a copy of s whose inputs, rules, input constraints,
+// skip_if_exists, skip_generated_marker, and executable patterns, env_vars,
+// and destinations are combined with those of the given
+// base templates, as described in the package docs. The bases must be in the
+// order returned by Resolve. The steps of the returned spec are only those of
+// s.
+func Merge(bases []*Base, s *spec.Spec) *spec.Spec {
+	if len(bases) == 0 {
+		return s
+	}
+
+	var inputs []*spec.Input
+	var vars []*spec.Var
+	var rules []*spec.Rule
+	var constraints []*spec.InputConstraint
+	var skipIfExists []model.String
+	var skipGeneratedMarker []model.String
+	var executable []model.String
+	var envVars []model.String
+	var destinations []*spec.Destination
+	destinationIndexes := map[string]int{}
+	envVarIndexes := map[string]int{}
+	inputIndexes := map[string]int{}
+	varIndexes := map[string]int{}
+	for _, b := range bases {
+		inputs = mergeByName(inputs, inputIndexes, b.Spec.Inputs, func(i *spec.Input) string { return i.Name.Val })
+		vars = mergeByName(vars, varIndexes, b.Spec.Vars, func(v *spec.Var) string { return v.Name.Val })
+		rules = append(rules, b.Spec.Rules...)
+		constraints = append(constraints, b.Spec.InputConstraints...)
+		skipIfExists = append(skipIfExists, b.Spec.SkipIfExists...)
+		skipGeneratedMarker = append(skipGeneratedMarker, b.Spec.SkipGeneratedMarker...)
+		executable = append(executable, b.Spec.Executable...)
+		envVars = mergeByName(envVars, envVarIndexes, b.Spec.EnvVars, func(e model.String) string { return e.Val })
+		destinations = mergeByName(destinations, destinationIndexes, b.Spec.Destinations, func(d *spec.Destination) string { return d.Name.Val })
+	}
+	inputs = mergeByName(inputs, inputIndexes, s.Inputs, func(i *spec.Input) string { return i.Name.Val })
+	vars = mergeByName(vars, varIndexes, s.Vars, func(v *spec.Var) string { return v.Name.Val })
+	rules = append(rules, s.Rules...)
+	constraints = append(constraints, s.InputConstraints...)
+	skipIfExists = append(skipIfExists, s.SkipIfExists...)
+	skipGeneratedMarker = append(skipGeneratedMarker, s.SkipGeneratedMarker...)
+	executable = append(executable, s.Executable...)
+	envVars = mergeByName(envVars, envVarIndexes, s.EnvVars, func(e model.String) string { return e.Val })
+	destinations = mergeByName(destinations, destinationIndexes, s.Destinations, func(d *spec.Destination) string { return d.Name.Val })
+
+	out := *s
+	out.Inputs = inputs
+	out.Vars = vars
+	out.Rules = rules
+	out.InputConstraints = constraints
+	out.SkipIfExists = skipIfExists
+	out.SkipGeneratedMarker = skipGeneratedMarker
+	out.Executable = executable
+	out.EnvVars = envVars
+	out.Destinations = destinations
+	return &out
+}
+
+// mergeByName appends each element of add to list, unless list already has an
+// element of the same name, in which case that element is replaced. indexes
+// maps names to their index in list, and is updated.
+func mergeByName[T any](list []T, indexes map[string]int, add []T, name func(T) string) []T {
+	for _, a := range add {
+		if idx, ok := indexes[name(a)]; ok {
+			list[idx] = a
+			continue
+		}
+		indexes[name(a)] = len(list)
+		list = append(list, a)
+	}
+	return list
+}
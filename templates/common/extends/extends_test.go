@@ -0,0 +1,209 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extends
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func specWithExtends(desc, extends string) string {
+	out := "api_version: 'cli.abcxyz.dev/v1beta4'\nkind: 'Template'\ndesc: '" + desc + "'\n"
+	if extends != "" {
+		out += "extends: '" + extends + "'\n"
+	}
+	return out + "steps:\n  - desc: 'greet'\n    action: 'print'\n    params:\n      message: 'hi'\n"
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		files     map[string]string
+		wantDescs []string
+		wantErr   string
+	}{
+		{
+			name: "no_extends",
+			files: map[string]string{
+				"tmpl/spec.yaml": specWithExtends("derived", ""),
+			},
+		},
+		{
+			name: "chain_relative_to_each_template",
+			files: map[string]string{
+				"tmpl/spec.yaml":         specWithExtends("derived", "../middle"),
+				"middle/spec.yaml":       specWithExtends("middle", "./root"),
+				"middle/root/spec.yaml":  specWithExtends("root", ""),
+				"middle/root/extra.txt":  "unused",
+				"tmpl/unrelated/file.go": "unused",
+			},
+			wantDescs: []string{"root", "middle"},
+		},
+		{
+			name: "indirect_cycle",
+			files: map[string]string{
+				"tmpl/spec.yaml":  specWithExtends("derived", "../other"),
+				"other/spec.yaml": specWithExtends("other", "../tmpl"),
+			},
+			wantErr: `template "../tmpl" extends itself, directly or indirectly`,
+		},
+		{
+			name: "invalid_base_spec",
+			files: map[string]string{
+				"tmpl/spec.yaml": specWithExtends("derived", "../base"),
+				"base/spec.yaml": "api_version: 'cli.abcxyz.dev/v1beta4'\nkind: 'Template'\n",
+			},
+			wantErr: `in base template "../base"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tempDir, tc.files)
+			rfs := &common.RealFS{}
+			srcDir := filepath.Join(tempDir, "tmpl")
+			s, err := specutil.Load(ctx, rfs, srcDir, srcDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rErr error
+			tracker := tempdir.NewDirTracker(rfs, false)
+			t.Cleanup(func() {
+				tracker.DeferMaybeRemoveAll(ctx, &rErr)
+				if rErr != nil {
+					t.Error(rErr)
+				}
+			})
+
+			bases, err := Resolve(ctx, &ResolveParams{
+				Downloader:  &templatesource.LocalDownloader{SrcPath: srcDir},
+				FS:          rfs,
+				Spec:        s,
+				TemplateDir: srcDir,
+				TempDirBase: t.TempDir(),
+				Tracker:     tracker,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			var gotDescs []string
+			for _, b := range bases {
+				gotDescs = append(gotDescs, b.Spec.Desc.Val)
+			}
+			if diff := cmp.Diff(gotDescs, tc.wantDescs); diff != "" {
+				t.Errorf("base templates were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	input := func(name, desc string) *spec.Input {
+		return &spec.Input{Name: model.String{Val: name}, Desc: model.String{Val: desc}}
+	}
+	variable := func(name, value string) *spec.Var {
+		return &spec.Var{Name: model.String{Val: name}, Value: model.String{Val: value}}
+	}
+	rule := func(r string) *spec.Rule {
+		return &spec.Rule{Rule: model.String{Val: r}}
+	}
+	destination := func(name, from string) *spec.Destination {
+		return &spec.Destination{
+			Name:  model.String{Val: name},
+			Paths: []*spec.DestinationPath{{From: model.String{Val: from}}},
+		}
+	}
+
+	root := &Base{Spec: &spec.Spec{
+		Inputs: []*spec.Input{input("a", "root a"), input("b", "root b")},
+		Vars:   []*spec.Var{variable("x", "a + b")},
+		Rules:  []*spec.Rule{rule("root")},
+
+		SkipIfExists:        []model.String{{Val: "README.md"}},
+		SkipGeneratedMarker: []model.String{{Val: "LICENSE"}},
+		Executable:          []model.String{{Val: "gradlew"}},
+		EnvVars:             []model.String{{Val: "HOME"}},
+		Destinations:        []*spec.Destination{destination("infra", "terraform"), destination("docs", "docs")},
+	}}
+	middle := &Base{Spec: &spec.Spec{
+		Inputs: []*spec.Input{input("c", "middle c"), input("a", "middle a")},
+		Rules:  []*spec.Rule{rule("middle")},
+	}}
+	derived := &spec.Spec{
+		Desc:   model.String{Val: "derived"},
+		Inputs: []*spec.Input{input("d", "derived d"), input("b", "derived b")},
+		Vars:   []*spec.Var{variable("y", "d"), variable("x", "d + b")},
+		Rules:  []*spec.Rule{rule("derived")},
+		Steps:  []*spec.Step{{Action: model.String{Val: "print"}}},
+
+		SkipIfExists:        []model.String{{Val: "config.yaml"}},
+		SkipGeneratedMarker: []model.String{{Val: "docs/**"}},
+		Executable:          []model.String{{Val: "scripts/*.sh"}},
+		EnvVars:             []model.String{{Val: "USER"}, {Val: "HOME"}},
+		Destinations:        []*spec.Destination{destination("infra", "infra")},
+	}
+
+	got := Merge([]*Base{root, middle}, derived)
+	want := &spec.Spec{
+		Desc: model.String{Val: "derived"},
+		Inputs: []*spec.Input{
+			input("a", "middle a"),
+			input("b", "derived b"),
+			input("c", "middle c"),
+			input("d", "derived d"),
+		},
+		Vars:  []*spec.Var{variable("x", "d + b"), variable("y", "d")},
+		Rules: []*spec.Rule{rule("root"), rule("middle"), rule("derived")},
+		Steps: []*spec.Step{{Action: model.String{Val: "print"}}},
+
+		SkipIfExists:        []model.String{{Val: "README.md"}, {Val: "config.yaml"}},
+		SkipGeneratedMarker: []model.String{{Val: "LICENSE"}, {Val: "docs/**"}},
+		Executable:          []model.String{{Val: "gradlew"}, {Val: "scripts/*.sh"}},
+		EnvVars:             []model.String{{Val: "HOME"}, {Val: "USER"}},
+		Destinations:        []*spec.Destination{destination("infra", "infra"), destination("docs", "docs")},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("merged spec was not as expected (-got,+want): %s", diff)
+	}
+
+	if got := Merge(nil, derived); got != derived {
+		t.Errorf("Merge() with no bases should return the spec unchanged")
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extends
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// EdgeKindExtends is the GraphEdge.Kind of an "extends" relationship.
+const EdgeKindExtends = "extends"
+
+// Graph is the dependency graph between a set of templates and the templates
+// they're composed from. Unlike Resolve, building a graph doesn't stop at
+// problems like cycles; they're reported in the graph instead.
+type Graph struct {
+	// Nodes are the templates, sorted by ID.
+	Nodes []*GraphNode `json:"nodes"`
+
+	// Edges are the dependencies between templates, sorted by From and To.
+	Edges []*GraphEdge `json:"edges"`
+
+	// Cycles are the dependency cycles, each given as the IDs of the
+	// templates in the cycle, in dependency order. The first template in a
+	// cycle depends on the last.
+	Cycles [][]string `json:"cycles,omitempty"`
+
+	// Conflicts are the templates that more than one version of is used.
+	Conflicts []*VersionConflict `json:"conflicts,omitempty"`
+}
+
+// GraphNode is one template in a Graph.
+type GraphNode struct {
+	// ID identifies the template. For a template at a canonical location, it's
+	// the canonical source and the resolved version, like
+	// "github.com/foo/bar@v1.2.3", so that "@latest" and the version it
+	// resolves to are the same node. For a local template, it's the path
+	// relative to the working directory.
+	ID string `json:"id"`
+
+	// Source is the template location that first named this template.
+	Source string `json:"source"`
+
+	// CanonicalSource and Version are from the template's DownloadMetadata.
+	CanonicalSource string `json:"canonical_source,omitempty"`
+	Version         string `json:"version,omitempty"`
+
+	// Desc is the desc field of the template's spec.
+	Desc string `json:"desc,omitempty"`
+
+	// Root is true for the templates that the graph was built from.
+	Root bool `json:"root,omitempty"`
+}
+
+// GraphEdge says that the From template depends on the To template.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Kind is how From uses To, currently always EdgeKindExtends.
+	Kind string `json:"kind"`
+}
+
+// VersionConflict is a template at a canonical location that's used at more
+// than one version.
+type VersionConflict struct {
+	CanonicalSource string `json:"canonical_source"`
+
+	// Versions are the versions that are used, sorted.
+	Versions []string `json:"versions"`
+}
+
+// GraphParams contains the arguments to BuildGraph.
+type GraphParams struct {
+	// The working directory. Relative sources are relative to this.
+	Cwd string
+
+	// Sources are the template locations to build the graph from, in any
+	// form that's accepted by templatesource.ParseSource.
+	Sources []string
+
+	// FS is the filesystem that templates are downloaded into.
+	FS common.FS
+
+	// The value of --git-protocol.
+	GitProtocol string
+
+	// TempDirBase is the directory under which the template directories are
+	// created. Normally empty, except in testing.
+	TempDirBase string
+
+	// Tracker is used to create the template directories, so they're
+	// cleaned up along with the caller's other temp dirs.
+	Tracker *tempdir.DirTracker
+}
+
+// BuildGraph downloads the templates named by p.Sources and every template
+// they depend on, and returns the dependency graph between them, including
+// any cycles and version conflicts. Each template is only downloaded once.
+func BuildGraph(ctx context.Context, p *GraphParams) (*Graph, error) {
+	b := &graphBuilder{
+		params: p,
+		ids:    map[string]string{},
+		nodes:  map[string]*GraphNode{},
+	}
+	for _, source := range p.Sources {
+		id, err := b.visit(ctx, p.Cwd, source)
+		if err != nil {
+			return nil, err
+		}
+		b.nodes[id].Root = true
+	}
+
+	g := &Graph{Edges: b.edges}
+	for _, n := range b.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	g.Cycles = findCycles(g)
+	g.Conflicts = findConflicts(g)
+	return g, nil
+}
+
+// graphBuilder holds the state of BuildGraph.
+type graphBuilder struct {
+	params *GraphParams
+
+	// ids maps the location of each template that's been visited to its
+	// node ID. The location is the absolute path for local templates, and
+	// the source otherwise.
+	ids map[string]string
+
+	nodes map[string]*GraphNode
+	edges []*GraphEdge
+}
+
+// visit adds the template at source, which is relative to cwd, and the
+// templates it depends on to the graph, and returns its node ID.
+func (b *graphBuilder) visit(ctx context.Context, cwd, source string) (string, error) {
+	logger := logging.FromContext(ctx).With("logger", "graphBuilder.visit")
+
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:         cwd,
+		Source:      source,
+		GitProtocol: b.params.GitProtocol,
+		FS:          b.params.FS,
+	})
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	location := source
+	ld, isLocal := downloader.(*templatesource.LocalDownloader)
+	if isLocal {
+		location = filepath.Clean(ld.SrcPath)
+	}
+	if id, ok := b.ids[location]; ok {
+		return id, nil
+	}
+
+	templateDir, err := b.params.Tracker.MkdirTempTracked(b.params.TempDirBase, tempdir.TemplateDirNamePart)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory for template: %w", err)
+	}
+	dlMeta, err := templatesource.DownloadVerified(ctx, &templatesource.DownloadVerifiedParams{
+		Downloader: downloader,
+		Cwd:        b.params.Cwd,
+		DestDir:    templateDir,
+		FS:         b.params.FS,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to download template %q: %w", source, err)
+	}
+
+	node := &GraphNode{
+		ID:     source,
+		Source: source,
+	}
+	switch {
+	case dlMeta.IsCanonical:
+		node.CanonicalSource = dlMeta.CanonicalSource
+		node.Version = dlMeta.Version
+		node.ID = dlMeta.CanonicalSource
+		if dlMeta.HasVersion {
+			node.ID += "@" + dlMeta.Version
+		}
+	case isLocal:
+		if rel, err := filepath.Rel(b.params.Cwd, location); err == nil {
+			node.ID = filepath.ToSlash(rel)
+		} else {
+			node.ID = filepath.ToSlash(location)
+		}
+	}
+	b.ids[location] = node.ID
+	if _, ok := b.nodes[node.ID]; ok {
+		// Another source, like "@latest", already resolved to this template.
+		return node.ID, nil
+	}
+
+	spec, err := specutil.Load(ctx, b.params.FS, templateDir, source)
+	if err != nil {
+		return "", fmt.Errorf("in template %q: %w", source, err)
+	}
+	node.Desc = spec.Desc.Val
+	b.nodes[node.ID] = node
+	logger.DebugContext(ctx, "added template to graph",
+		"source", source,
+		"id", node.ID)
+
+	if spec.Extends.Val == "" {
+		return node.ID, nil
+	}
+	// Relative "extends" paths are relative to the template's own directory.
+	baseCwd := templateDir
+	if isLocal {
+		baseCwd = ld.Dir()
+	}
+	baseID, err := b.visit(ctx, baseCwd, spec.Extends.Val)
+	if err != nil {
+		return "", spec.Extends.Pos.Errorf("in template %q, invalid \"extends\": %w", source, err)
+	}
+	b.edges = append(b.edges, &GraphEdge{
+		From: node.ID,
+		To:   baseID,
+		Kind: EdgeKindExtends,
+	})
+	return node.ID, nil
+}
+
+// findCycles returns the cycles in g, each starting with the node where the
+// search found it.
+func findCycles(g *Graph) [][]string {
+	deps := map[string][]string{}
+	for _, e := range g.Edges {
+		deps[e.From] = append(deps[e.From], e.To)
+	}
+
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := map[string]int{}
+	var stack []string
+	var out [][]string
+	var walk func(id string)
+	walk = func(id string) {
+		state[id] = inProgress
+		stack = append(stack, id)
+		for _, dep := range deps[id] {
+			switch state[dep] {
+			case unvisited:
+				walk(dep)
+			case inProgress:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == dep {
+						out = append(out, append([]string(nil), stack[i:]...))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+	}
+	for _, n := range g.Nodes {
+		if state[n.ID] == unvisited {
+			walk(n.ID)
+		}
+	}
+	return out
+}
+
+// findConflicts returns the canonical sources in g that are used at more than
+// one version, sorted.
+func findConflicts(g *Graph) []*VersionConflict {
+	versions := map[string][]string{}
+	for _, n := range g.Nodes {
+		if n.CanonicalSource != "" && n.Version != "" {
+			versions[n.CanonicalSource] = append(versions[n.CanonicalSource], n.Version)
+		}
+	}
+	var out []*VersionConflict
+	for source, vs := range versions {
+		if len(vs) < 2 {
+			continue
+		}
+		sort.Strings(vs)
+		out = append(out, &VersionConflict{CanonicalSource: source, Versions: vs})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CanonicalSource < out[j].CanonicalSource })
+	return out
+}
+
+// WriteDOT writes g in the Graphviz DOT language. The templates in cycles or
+// version conflicts, and the edges of cycles, are colored red.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bad := map[string]bool{}
+	cycleEdges := map[[2]string]bool{}
+	for _, c := range g.Cycles {
+		for i, id := range c {
+			bad[id] = true
+			cycleEdges[[2]string{id, c[(i+1)%len(c)]}] = true
+		}
+	}
+	for _, c := range g.Conflicts {
+		for _, v := range c.Versions {
+			bad[c.CanonicalSource+"@"+v] = true
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("digraph templates {\n")
+	for _, n := range g.Nodes {
+		attrs := []string{"label=" + strconv.Quote(n.ID)}
+		if n.Root {
+			attrs = append(attrs, "shape=box")
+		}
+		if bad[n.ID] {
+			attrs = append(attrs, "color=red")
+		}
+		fmt.Fprintf(&sb, "  %s [%s];\n", strconv.Quote(n.ID), strings.Join(attrs, ", "))
+	}
+	for _, e := range g.Edges {
+		attrs := []string{"label=" + strconv.Quote(e.Kind)}
+		if cycleEdges[[2]string{e.From, e.To}] {
+			attrs = append(attrs, "color=red")
+		}
+		fmt.Fprintf(&sb, "  %s -> %s [%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), strings.Join(attrs, ", "))
+	}
+	sb.WriteString("}\n")
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return fmt.Errorf("failed writing graph: %w", err)
+	}
+	return nil
+}
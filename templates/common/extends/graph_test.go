@@ -0,0 +1,231 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extends
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeVersionedDownloader serves templates like "graph-test://name@v1" as if
+// they were at a canonical location. "@latest" is "@v2".
+type fakeVersionedDownloader struct {
+	source string
+}
+
+func (f *fakeVersionedDownloader) Download(ctx context.Context, cwd, destDir string) (*templatesource.DownloadMetadata, error) {
+	canonical, version, _ := strings.Cut(f.source, "@")
+	if version == "latest" {
+		version = "v2"
+	}
+	if err := os.WriteFile(filepath.Join(destDir, specutil.SpecFileName), []byte(specWithExtends(version, "")), common.OwnerRWPerms); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return &templatesource.DownloadMetadata{
+		IsCanonical:     true,
+		CanonicalSource: canonical,
+		LocationType:    "graph_test",
+		HasVersion:      true,
+		Version:         version,
+	}, nil
+}
+
+func init() {
+	templatesource.RegisterSourceParser("graph-test", templatesource.AfterBuiltins, templatesource.SourceParserFunc(
+		func(ctx context.Context, params *templatesource.ParseSourceParams) (templatesource.Downloader, bool, error) {
+			if !strings.HasPrefix(params.Source, "graph-test://") {
+				return nil, false, nil
+			}
+			return &fakeVersionedDownloader{source: params.Source}, true, nil
+		}))
+}
+
+func TestBuildGraph(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		files         map[string]string
+		sources       []string
+		wantNodes     []string
+		wantEdges     [][2]string
+		wantCycles    [][]string
+		wantConflicts []*VersionConflict
+		wantErr       string
+	}{
+		{
+			name: "chain",
+			files: map[string]string{
+				"tmpl/spec.yaml":        specWithExtends("derived", "../middle"),
+				"middle/spec.yaml":      specWithExtends("middle", "./root"),
+				"middle/root/spec.yaml": specWithExtends("root", ""),
+			},
+			sources:   []string{"tmpl"},
+			wantNodes: []string{"middle", "middle/root", "tmpl"},
+			wantEdges: [][2]string{{"middle", "middle/root"}, {"tmpl", "middle"}},
+		},
+		{
+			name: "shared_base_is_one_node",
+			files: map[string]string{
+				"a/spec.yaml":    specWithExtends("a", "../base"),
+				"b/spec.yaml":    specWithExtends("b", "../base"),
+				"base/spec.yaml": specWithExtends("base", ""),
+			},
+			sources:   []string{"a", "b"},
+			wantNodes: []string{"a", "b", "base"},
+			wantEdges: [][2]string{{"a", "base"}, {"b", "base"}},
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"tmpl/spec.yaml":  specWithExtends("derived", "../other"),
+				"other/spec.yaml": specWithExtends("other", "../tmpl"),
+			},
+			sources:    []string{"tmpl"},
+			wantNodes:  []string{"other", "tmpl"},
+			wantEdges:  [][2]string{{"other", "tmpl"}, {"tmpl", "other"}},
+			wantCycles: [][]string{{"other", "tmpl"}},
+		},
+		{
+			name: "version_conflict",
+			files: map[string]string{
+				"a/spec.yaml": specWithExtends("a", "graph-test://base@v1"),
+				"b/spec.yaml": specWithExtends("b", "graph-test://base@latest"),
+				"c/spec.yaml": specWithExtends("c", "graph-test://base@v2"),
+			},
+			sources:   []string{"a", "b", "c"},
+			wantNodes: []string{"a", "b", "c", "graph-test://base@v1", "graph-test://base@v2"},
+			wantEdges: [][2]string{
+				{"a", "graph-test://base@v1"},
+				{"b", "graph-test://base@v2"},
+				{"c", "graph-test://base@v2"},
+			},
+			wantConflicts: []*VersionConflict{{CanonicalSource: "graph-test://base", Versions: []string{"v1", "v2"}}},
+		},
+		{
+			name: "invalid_spec",
+			files: map[string]string{
+				"tmpl/spec.yaml": specWithExtends("derived", "../base"),
+				"base/spec.yaml": "api_version: 'cli.abcxyz.dev/v1beta4'\nkind: 'Template'\n",
+			},
+			sources: []string{"tmpl"},
+			wantErr: `in template "../base"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			tempDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tempDir, tc.files)
+			rfs := &common.RealFS{}
+
+			var rErr error
+			tracker := tempdir.NewDirTracker(rfs, false)
+			t.Cleanup(func() {
+				tracker.DeferMaybeRemoveAll(ctx, &rErr)
+				if rErr != nil {
+					t.Error(rErr)
+				}
+			})
+
+			g, err := BuildGraph(ctx, &GraphParams{
+				Cwd:         tempDir,
+				Sources:     tc.sources,
+				FS:          rfs,
+				TempDirBase: t.TempDir(),
+				Tracker:     tracker,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			var gotNodes []string
+			for _, n := range g.Nodes {
+				gotNodes = append(gotNodes, n.ID)
+			}
+			var gotEdges [][2]string
+			for _, e := range g.Edges {
+				gotEdges = append(gotEdges, [2]string{e.From, e.To})
+			}
+			if diff := cmp.Diff(gotNodes, tc.wantNodes); diff != "" {
+				t.Errorf("nodes were not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(gotEdges, tc.wantEdges); diff != "" {
+				t.Errorf("edges were not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(g.Cycles, tc.wantCycles); diff != "" {
+				t.Errorf("cycles were not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(g.Conflicts, tc.wantConflicts); diff != "" {
+				t.Errorf("conflicts were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestGraph_WriteDOT(t *testing.T) {
+	t.Parallel()
+
+	g := &Graph{
+		Nodes: []*GraphNode{
+			{ID: "a", Root: true},
+			{ID: "b"},
+			{ID: "github.com/foo/base@v1"},
+		},
+		Edges: []*GraphEdge{
+			{From: "a", To: "b", Kind: EdgeKindExtends},
+			{From: "b", To: "a", Kind: EdgeKindExtends},
+		},
+		Cycles:    [][]string{{"a", "b"}},
+		Conflicts: []*VersionConflict{{CanonicalSource: "github.com/foo/base", Versions: []string{"v1", "v2"}}},
+	}
+
+	var sb strings.Builder
+	if err := g.WriteDOT(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph templates {
+  "a" [label="a", shape=box, color=red];
+  "b" [label="b", color=red];
+  "github.com/foo/base@v1" [label="github.com/foo/base@v1", color=red];
+  "a" -> "b" [label="extends", color=red];
+  "b" -> "a" [label="extends", color=red];
+}
+`
+	if diff := cmp.Diff(sb.String(), want); diff != "" {
+		t.Errorf("DOT output was not as expected (-got,+want): %s", diff)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// FileModes says how the permission bits of the output files of a template
+// are chosen.
+type FileModes string
+
+const (
+	// FileModesPreserve copies the permission bits of each template file, as
+	// they were on the machine that downloaded the template. This is the
+	// default.
+	FileModesPreserve FileModes = "preserve"
+
+	// FileModesNormalize ignores the permission bits of template files, which
+	// depend on the OS that the template was authored or downloaded on. Every
+	// output file is NormalFileMode, or ExecutableFileMode if the template
+	// marks it executable.
+	FileModesNormalize FileModes = "normalize"
+)
+
+// FileModesValues are the valid values of FileModes, as strings for use in
+// flag help and error messages.
+var FileModesValues = []string{string(FileModesPreserve), string(FileModesNormalize)}
+
+// The permission bits of output files with FileModesNormalize.
+const (
+	NormalFileMode     fs.FileMode = 0o644
+	ExecutableFileMode fs.FileMode = 0o755
+)
+
+// ParseFileModes converts a flag or spec value to a FileModes. The empty
+// string means FileModesPreserve.
+func ParseFileModes(s string) (FileModes, error) {
+	switch FileModes(s) {
+	case "", FileModesPreserve:
+		return FileModesPreserve, nil
+	case FileModesNormalize:
+		return FileModesNormalize, nil
+	default:
+		return "", fmt.Errorf("invalid file modes %q, must be one of %s", s, strings.Join(FileModesValues, ", "))
+	}
+}
+
+// OutputMode returns the permission bits of an output file whose source file
+// has the permission bits src. If executable is true, the template marks the
+// file executable; with FileModesPreserve, it's made executable by whoever
+// can read it.
+func OutputMode(m FileModes, src fs.FileMode, executable bool) fs.FileMode {
+	if m == FileModesNormalize {
+		if executable {
+			return ExecutableFileMode
+		}
+		return NormalFileMode
+	}
+	out := src.Perm()
+	if executable {
+		out |= (out & 0o444) >> 2
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestParseFileModes(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]FileModes{
+		"":          FileModesPreserve,
+		"preserve":  FileModesPreserve,
+		"normalize": FileModesNormalize,
+	} {
+		got, err := ParseFileModes(in)
+		if err != nil {
+			t.Errorf("ParseFileModes(%q): %v", in, err)
+		}
+		if got != want {
+			t.Errorf("ParseFileModes(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	_, err := ParseFileModes("windows")
+	if diff := testutil.DiffErrString(err, `invalid file modes "windows", must be one of preserve, normalize`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestOutputMode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		fileModes  FileModes
+		src        fs.FileMode
+		executable bool
+		want       fs.FileMode
+	}{
+		{
+			name:      "preserve",
+			fileModes: FileModesPreserve,
+			src:       0o640,
+			want:      0o640,
+		},
+		{
+			name:       "preserve_executable_follows_read_bits",
+			fileModes:  FileModesPreserve,
+			src:        0o640,
+			executable: true,
+			want:       0o750,
+		},
+		{
+			name:      "normalize_ignores_source",
+			fileModes: FileModesNormalize,
+			src:       0o777,
+			want:      NormalFileMode,
+		},
+		{
+			// Like a file authored on Windows, which has no execute bits.
+			name:       "normalize_executable",
+			fileModes:  FileModesNormalize,
+			src:        0o666,
+			executable: true,
+			want:       ExecutableFileMode,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := OutputMode(tc.fileModes, tc.src, tc.executable); got != tc.want {
+				t.Errorf("OutputMode() = %o, want %o", got, tc.want)
+			}
+		})
+	}
+}
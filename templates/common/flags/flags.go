@@ -18,6 +18,10 @@ package flags
 import (
 	"github.com/posener/complete/v2/predict"
 
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/diagnostic"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/common/ui"
 	"github.com/abcxyz/pkg/cli"
 )
 
@@ -34,6 +38,167 @@ func GitProtocol(target *string) *cli.StringVar {
 	}
 }
 
+// Symlinks says what to do with symlinks in the template and in the files that
+// it outputs. The valid values are in common.SymlinkModes.
+func Symlinks(target *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "symlinks",
+		Example: "preserve",
+		Default: string(common.SymlinksFollow),
+		Predict: predict.Set(common.SymlinkModes),
+		Target:  target,
+		Usage: `How to handle symlinks in the template and in its output, one of follow, preserve, or reject. ` +
+			`"follow" copies the file or directory that a symlink points to, "preserve" copies the symlink itself, ` +
+			`and "reject" fails if there are any symlinks. Symlinks to locations outside the template can't be followed or preserved.`,
+	}
+}
+
+// LineEndings converts the line endings of the text files that a template
+// outputs. The valid values are in common.LineEndingsValues. The empty default
+// means to use the template's line_endings setting.
+func LineEndings(target *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "line-endings",
+		Example: "lf",
+		Predict: predict.Set(common.LineEndingsValues),
+		Target:  target,
+		Usage: `The line endings of text files in the output, one of preserve, lf, or crlf. ` +
+			`This overrides the template's line_endings setting, if any. Binary files are never changed.`,
+	}
+}
+
+// FileModes chooses how the permission bits of the files that a template
+// outputs are set. The valid values are in common.FileModesValues. The empty
+// default means to use the template's file_modes setting.
+func FileModes(target *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "file-modes",
+		Example: "normalize",
+		Predict: predict.Set(common.FileModesValues),
+		Target:  target,
+		Usage: `How the permission bits of output files are set, one of preserve or normalize. ` +
+			`"normalize" ignores the permission bits of the template's files and makes every output file rw-r--r--, ` +
+			`or rwxr-xr-x if the template's executable setting matches it. This overrides the template's file_modes setting, if any.`,
+	}
+}
+
+// StripBOM removes the UTF-8 byte order mark from the start of the text files
+// that a template outputs.
+func StripBOM(target *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:    "strip-bom",
+		Target:  target,
+		Default: false,
+		Usage:   "Remove the UTF-8 byte order mark from the start of text files in the output, even if the template's strip_bom setting is false.",
+	}
+}
+
+// GeneratedMarker adds a comment to the top of the text files that a template
+// outputs, saying that they were generated by abc and mustn't be edited.
+func GeneratedMarker(target *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:    "generated-marker",
+		Target:  target,
+		Default: false,
+		Usage: `Add a "Code generated by abc ... DO NOT EDIT." comment to the top of each output file whose ` +
+			"comment syntax is known, even if the template's generated_marker setting is false.",
+	}
+}
+
+// Color says when to use color in the output of a command. The valid values
+// are in ui.ColorModes.
+func Color(target *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "color",
+		Example: "never",
+		Default: string(ui.ColorAuto),
+		EnvVar:  "ABC_COLOR",
+		Predict: predict.Set(ui.ColorModes),
+		Target:  target,
+		Usage: `When to use color in the output, one of auto, always, or never. ` +
+			`"auto" uses color only when the output is a terminal and the NO_COLOR environment variable isn't set.`,
+	}
+}
+
+// MaxFiles limits the number of files in a template and in its output. Zero
+// means no limit.
+func MaxFiles(target *int) *cli.IntVar {
+	return &cli.IntVar{
+		Name:    "max-files",
+		Example: "50000",
+		Default: common.DefaultMaxFiles,
+		Target:  target,
+		Usage: "The maximum number of files that the template and its output may contain, " +
+			"to protect against accidentally rendering a template that includes something huge like a node_modules directory. Use 0 for no limit.",
+	}
+}
+
+// MaxBytes limits the total size of the files in a template and in its output.
+// Zero means no limit.
+func MaxBytes(target *int64) *cli.Int64Var {
+	return &cli.Int64Var{
+		Name:    "max-bytes",
+		Example: "1073741824",
+		Default: common.DefaultMaxBytes,
+		Target:  target,
+		Usage:   "The maximum total size in bytes of the files in the template and in its output. Use 0 for no limit.",
+	}
+}
+
+// MaxPathDepth limits how deeply nested the files in a template and in its
+// output may be. Zero means no limit.
+func MaxPathDepth(target *int) *cli.IntVar {
+	return &cli.IntVar{
+		Name:    "max-path-depth",
+		Example: "64",
+		Default: common.DefaultMaxPathDepth,
+		Target:  target,
+		Usage:   `The maximum number of path components in the path of a file in the template or in its output; "a/b/c.txt" has a depth of 3. Use 0 for no limit.`,
+	}
+}
+
+// DownloadRetries is the number of times a remote template download that
+// failed with a transient network error is retried.
+func DownloadRetries(target *int) *cli.IntVar {
+	return &cli.IntVar{
+		Name:    "download-retries",
+		Example: "5",
+		Default: templatesource.DefaultDownloadRetries,
+		EnvVar:  "ABC_DOWNLOAD_RETRIES",
+		Target:  target,
+		Usage: "The number of times to retry downloading a template from a remote location, like a git repo or a bucket, " +
+			"when it fails with a transient network error. Retries wait longer each time, with random jitter. Use 0 to never retry.",
+	}
+}
+
+// AuditLog is the path of the audit log, a JSON lines file that every render
+// and upgrade is recorded in. If it's empty, nothing is recorded.
+func AuditLog(target *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "audit-log",
+		Example: "/home/me/.abc/audit.jsonl",
+		EnvVar:  "ABC_AUDIT_LOG",
+		Target:  target,
+		Predict: predict.Files("*.jsonl"),
+		Usage: "The file to append a record of this command to, with the time, user, template source and version, " +
+			"destination, a hash of the inputs, and the outcome. Nothing is recorded if this is empty.",
+	}
+}
+
+// Redact is the patterns of the names of sensitive inputs, whose values are
+// kept out of logs, print output, manifests, and golden test data.
+func Redact(target *[]string) *cli.StringSliceVar {
+	return &cli.StringSliceVar{
+		Name:    "redact",
+		Example: "*_token",
+		EnvVar:  "ABC_REDACT",
+		Target:  target,
+		Usage: "A pattern of the names of sensitive inputs, like password or *_token, whose values are replaced with " +
+			"[REDACTED] in logs, print output, and errors, and left out of manifests and resume files; " +
+			"may be repeated or comma-separated.",
+	}
+}
+
 // Inputs provide values that are substituted into the template. The keys in
 // this map must match the input names in the Source template's spec.yaml
 // file.
@@ -56,7 +221,7 @@ func InputFiles(inputFiles *[]string) *cli.StringSliceVar {
 		Example: "/my/git/abc-inputs.yaml",
 		Predict: predict.Files(""),
 		Target:  inputFiles,
-		Usage:   "The yaml files with key: val pairs of template values; may be repeated.",
+		Usage:   `The yaml files with key: val pairs of template values; may be repeated, and later files override earlier ones. Use "-" to read from stdin.`,
 	}
 }
 
@@ -82,6 +247,33 @@ func SkipInputValidation(s *bool) *cli.BoolVar {
 	}
 }
 
+// DiagnosticFormat is the output format of the commands that check a
+// template, one of diagnostic.Formats. "json" prints a diagnostic.Report, for
+// editors and other tools.
+func DiagnosticFormat(target *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "format",
+		Example: "json",
+		Default: diagnostic.FormatText,
+		Predict: predict.Set(diagnostic.Formats),
+		Target:  target,
+		Usage: "The output format, text or json. With json, the problems that are found are printed " +
+			"as JSON with their file, line, column, severity, and code, for editor integrations.",
+	}
+}
+
+// StrictAPIVersion makes it an error for the template's spec.yaml to have an
+// older api_version than the latest one supported, rather than a warning.
+func StrictAPIVersion(s *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:    "strict-api-version",
+		Target:  s,
+		Default: false,
+		Usage: "Fail if the template's spec.yaml has an older api_version than the latest one that this " +
+			"version of abc supports, instead of warning. This is for template CI.",
+	}
+}
+
 // DebugScratchContents causes the contents of the scratch directory to be
 // logged at level INFO after each step of the spec.yaml.
 func DebugScratchContents(d *bool) *cli.BoolVar {
@@ -93,6 +285,43 @@ func DebugScratchContents(d *bool) *cli.BoolVar {
 	}
 }
 
+// DebugScope causes the variables in scope to be printed as YAML before each
+// step of the spec.yaml.
+func DebugScope(d *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:    "debug-scope",
+		Target:  d,
+		Default: false,
+		Usage: "Print every variable in scope, including inputs, built-in vars, and for_each keys, as a YAML document " +
+			"on stderr as each step begins; for debugging spec.yaml files.",
+	}
+}
+
+// AllowUnmatchedPaths turns the error for a path in a content-modifying action
+// that doesn't match any files into a warning.
+func AllowUnmatchedPaths(a *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:    "allow-unmatched-paths",
+		Target:  a,
+		Default: false,
+		Usage: "Warn, rather than fail, when a path in an action that modifies files, like string_replace or " +
+			"go_template, doesn't match any files.",
+	}
+}
+
+// AllowDirtyTemplate lets a local template with uncommitted changes in its git
+// workspace still get a version in the manifest, marked as dirty.
+func AllowDirtyTemplate(d *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:    "allow-dirty-template",
+		Target:  d,
+		Default: false,
+		Usage: "When the template is a local directory in a git workspace with uncommitted changes, still record its " +
+			"git tag or SHA as the template version, with a \"-dirty\" suffix, instead of omitting the version; " +
+			"for iterating on a template locally.",
+	}
+}
+
 // DebugStepDiffs causes the diffs between steps to be logged as git commits.
 func DebugStepDiffs(d *bool) *cli.BoolVar {
 	return &cli.BoolVar{
@@ -21,9 +21,11 @@ import (
 	"hash"
 	"io"
 	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 
+	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/pkg/logging"
 )
@@ -43,17 +45,31 @@ type FS interface {
 	fs.StatFS
 
 	// These methods correspond to methods in the "os" package of the same name.
+	Chmod(string, os.FileMode) error
 	MkdirAll(string, os.FileMode) error
 	MkdirTemp(string, string) (string, error)
-	OpenFile(string, int, os.FileMode) (*os.File, error)
+	OpenFile(string, int, os.FileMode) (File, error)
 	ReadFile(string) ([]byte, error)
 	RemoveAll(string) error
+	Rename(string, string) error
 	WriteFile(string, []byte, os.FileMode) error
 }
 
+// File is the subset of *os.File that is returned by FS.OpenFile. It's an
+// interface rather than *os.File so that FS can be implemented by something
+// other than the real filesystem, like MemFS.
+type File interface {
+	fs.File
+	io.Writer
+}
+
 // This is the non-test implementation of the filesystem interface.
 type RealFS struct{}
 
+func (r *RealFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode) //nolint:wrapcheck
+}
+
 func (r *RealFS) MkdirAll(name string, perm os.FileMode) error {
 	return os.MkdirAll(name, perm) //nolint:wrapcheck
 }
@@ -66,7 +82,7 @@ func (r *RealFS) Open(name string) (fs.File, error) {
 	return os.Open(name) //nolint:wrapcheck
 }
 
-func (r *RealFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+func (r *RealFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
 	return os.OpenFile(name, flag, perm) //nolint:wrapcheck
 }
 
@@ -78,6 +94,10 @@ func (r *RealFS) RemoveAll(name string) error {
 	return os.RemoveAll(name) //nolint:wrapcheck
 }
 
+func (r *RealFS) Rename(from, to string) error {
+	return os.Rename(from, to) //nolint:wrapcheck
+}
+
 func (r *RealFS) Stat(name string) (fs.FileInfo, error) {
 	return os.Stat(name) //nolint:wrapcheck
 }
@@ -108,6 +128,10 @@ type CopyParams struct {
 	SrcRoot string
 	// FS is the filesytem to use.
 	FS FS
+	// SrcFS is an optional filesystem to read the source files from, for
+	// copying between two different filesystems. If nil, FS is used for both
+	// reading and writing.
+	SrcFS FS
 	// visitor is an optional function that will be called for each file in the
 	// source, to allow customization of the copy operation on a per-file basis.
 	Visitor CopyVisitor
@@ -119,6 +143,20 @@ type CopyParams struct {
 	// slashes as path separator, regardless of OS.
 	Hasher    func() hash.Hash
 	OutHashes map[string][]byte
+
+	// Symlinks says what to do with symlinks in the source. The zero value
+	// means SymlinksFollow.
+	Symlinks SymlinkMode
+
+	// If OutSymlinks is not nil, then the target of each symlink that's
+	// copied with SymlinksPreserve will be saved in OutSymlinks, keyed by its
+	// path. Paths and targets use forward slashes regardless of OS.
+	OutSymlinks map[string]string
+
+	// Limits is an optional limit on the number of files, total bytes, and
+	// path depth of the copied files. Skipped files don't count against the
+	// limits. If nil, there are no limits.
+	Limits *Limits
 }
 
 // CopyVisitor is the type for callback functions that are called by
@@ -145,26 +183,71 @@ type CopyHint struct {
 	// destination). For directories, this will cause all files underneath the
 	// directory to be skipped.
 	Skip bool
+
+	// If non-zero, Mode is the permission bits of the file in the destination,
+	// instead of those of the source file. Unlike the source's, they're set
+	// even if the destination file already exists.
+	//
+	// This has no effect on directories or preserved symlinks.
+	Mode fs.FileMode
 }
 
 // CopyRecursive recursively copies folder contents with designated config
-// params.
+// params. Directories that are empty in the source are created in the
+// destination.
 func CopyRecursive(ctx context.Context, pos *model.ConfigPos, p *CopyParams) (outErr error) {
-	logger := logging.FromContext(ctx).With("logger", "CopyRecursive")
+	c := &copier{
+		logger: logging.FromContext(ctx).With("logger", "CopyRecursive"),
+		p:      p,
+		pos:    pos,
+		srcFS:  p.SrcFS,
+		limits: &limitTracker{limits: p.Limits},
+	}
+	if c.srcFS == nil {
+		c.srcFS = p.FS
+	}
+	return c.walk(ctx, p.SrcRoot, 0)
+}
+
+// copier holds the state of a single call to CopyRecursive.
+type copier struct {
+	logger *slog.Logger
+	p      *CopyParams
+	pos    *model.ConfigPos
+	srcFS  FS
+	limits *limitTracker
 
-	backupDir := "" // will be set once the backup dir is actually created
+	backupDir string // will be set once the backup dir is actually created
 
-	return fs.WalkDir(p.FS, p.SrcRoot, func(path string, de fs.DirEntry, err error) error { //nolint:wrapcheck
+	// resolvedSrcRoot is p.SrcRoot with its symlinks resolved. It's set once
+	// the first symlink is followed.
+	resolvedSrcRoot string
+}
+
+// walk copies the tree rooted at root, which is either p.SrcRoot or a
+// symlinked directory inside it that's being followed. depth is the number of
+// symlinked directories that have been followed to reach root.
+func (c *copier) walk(ctx context.Context, root string, depth int) error {
+	p, pos := c.p, c.pos
+	return fs.WalkDir(c.srcFS, root, func(path string, de fs.DirEntry, err error) error { //nolint:wrapcheck
 		if err != nil {
 			return err // There was some filesystem error. Give up.
 		}
-		logger.DebugContext(ctx, "handling directory entry",
-			"path", path)
+		if err := ctx.Err(); err != nil {
+			return err // Stop promptly on Ctrl-C or a timeout.
+		}
 		relToSrc, err := filepath.Rel(p.SrcRoot, path)
 		if err != nil {
 			return pos.Errorf("filepath.Rel(%s,%s): %w", p.SrcRoot, path, err)
 		}
 		dst := filepath.Join(p.DstRoot, relToSrc)
+		if depth > 0 && path == root {
+			// This is a followed symlink, which was already visited as a
+			// symlink by the enclosing walk.
+			return c.mkdirIfEmpty(path, dst)
+		}
+		c.logger.DebugContext(ctx, "handling directory entry",
+			"path", path)
 
 		var ch CopyHint
 		if p.Visitor != nil {
@@ -175,66 +258,84 @@ func CopyRecursive(ctx context.Context, pos *model.ConfigPos, p *CopyParams) (ou
 		}
 
 		if ch.Skip {
-			logger.DebugContext(ctx, "walkdir visitor skipped file or directory", "path", relToSrc)
+			c.logger.DebugContext(ctx, "walkdir visitor skipped file or directory", "path", relToSrc)
 			if de.IsDir() {
 				return fs.SkipDir
 			}
 			return nil
 		}
 
-		if de.IsDir() {
-			// We don't create directories when they're encountered by this WalkDirFunc.
-			// Instead, we create output directories as needed when a file needs to be
-			// placed in that directory.
-			return nil
+		if err := c.limits.checkDepth(relToSrc); err != nil {
+			return pos.Errorf("%w", err)
 		}
 
-		// The spec file may specify a file to copy that's deep in a directory
-		// tree, (like include "some/deep/subdir/myfile.txt") without including
-		// its parent directory. We can't rely on WalkDir having traversed the
-		// parent directory of $path, so we must create the target directory if
-		// it doesn't exist.
-		inDir := filepath.Dir(dst)
-
-		if err := mkdirAllChecked(pos, p.FS, inDir, p.DryRun); err != nil {
-			return err
+		if de.IsDir() {
+			// We don't create most directories when they're encountered by
+			// this WalkDirFunc. Instead, we create output directories as
+			// needed when a file needs to be placed in that directory. The
+			// exception is a directory that's empty in the source, which
+			// would otherwise be dropped.
+			return c.mkdirIfEmpty(path, dst)
 		}
-		dstInfo, err := p.FS.Stat(dst)
-		if err == nil {
-			if dstInfo.IsDir() {
-				return pos.Errorf("cannot overwrite a directory with a file of the same name; destination is %q, source is %q", dst, path)
+
+		if de.Type()&fs.ModeSymlink != 0 {
+			switch p.Symlinks {
+			case SymlinksReject:
+				return pos.Errorf("%q is a symlink, which isn't allowed when the symlink mode is %q", relToSrc, SymlinksReject)
+			case SymlinksPreserve:
+				if err := c.limits.addFile(relToSrc, 0); err != nil {
+					return pos.Errorf("%w", err)
+				}
+				return c.copySymlink(ctx, ch, path, relToSrc, dst)
+			}
+			// Otherwise, follow the symlink, if it stays inside the tree.
+			if err := c.checkFollowedSymlink(path, relToSrc); err != nil {
+				return err
 			}
-			if !ch.Overwrite {
-				return pos.Errorf("destination file %s already exists and overwriting was not enabled with --force-overwrite", relToSrc)
+			srcInfo, err := c.srcFS.Stat(path)
+			if err != nil {
+				return pos.Errorf("failed following symlink %q: %w", relToSrc, err)
 			}
-			if ch.BackupIfExists && !p.DryRun {
-				if backupDir == "" {
-					if backupDir, err = p.BackupDirMaker(p.FS); err != nil {
-						return fmt.Errorf("failed making backup directory: %w", err)
-					}
-				}
-				if err := backUp(ctx, p.FS, backupDir, p.DstRoot, relToSrc); err != nil {
-					return err
+			if srcInfo.IsDir() {
+				if depth >= maxSymlinkDepth {
+					return pos.Errorf("too many levels of symlinked directories at %q", relToSrc)
 				}
+				return c.walk(ctx, path, depth+1)
 			}
-		} else if !IsStatNotExistErr(err) {
-			return pos.Errorf("Stat(): %w", err)
 		}
-		srcInfo, err := p.FS.Stat(path)
+
+		srcInfo, err := c.srcFS.Stat(path)
 		if err != nil {
 			return fmt.Errorf("Stat(): %w", err)
 		}
+		if err := c.limits.addFile(relToSrc, srcInfo.Size()); err != nil {
+			return pos.Errorf("%w", err)
+		}
+		if err := c.prepareDst(ctx, ch, relToSrc, path, dst); err != nil {
+			return err
+		}
 
-		// The permission bits on the output file are copied from the input file;
-		// this preserves the execute bit on executable files.
+		// The permission bits on the output file are copied from the input file,
+		// unless the visitor chose them; this preserves the execute bit on
+		// executable files.
 		mode := srcInfo.Mode().Perm()
+		if ch.Mode != 0 {
+			mode = ch.Mode.Perm()
+		}
 		var hash hash.Hash
 		if p.Hasher != nil {
 			hash = p.Hasher()
 		}
-		if err := copyFile(ctx, pos, p.FS, path, dst, mode, p.DryRun, hash); err != nil {
+		if err := copyFile(ctx, pos, c.srcFS, p.FS, path, dst, mode, p.DryRun, hash); err != nil {
 			return err
 		}
+		if ch.Mode != 0 && !p.DryRun {
+			// OpenFile doesn't change the mode of an existing file, and is
+			// subject to the umask.
+			if err := p.FS.Chmod(dst, mode); err != nil {
+				return pos.Errorf("Chmod(): %w", err)
+			}
+		}
 		if hash != nil && p.OutHashes != nil {
 			p.OutHashes[filepath.ToSlash(relToSrc)] = hash.Sum(nil)
 		}
@@ -242,14 +343,152 @@ func CopyRecursive(ctx context.Context, pos *model.ConfigPos, p *CopyParams) (ou
 	})
 }
 
-// copyFile copies the contents of src to dst.
+// checkFollowedSymlink returns an error unless the symlink at path resolves to
+// somewhere inside p.SrcRoot. Otherwise, following it could copy anything on
+// the filesystem, like "/", into the destination.
+func (c *copier) checkFollowedSymlink(path, relToSrc string) error {
+	sfs, ok := c.srcFS.(SymlinkFS)
+	if !ok {
+		return c.pos.Errorf("internal error: %q is a symlink, but the filesystem doesn't support symlinks", relToSrc)
+	}
+	if c.resolvedSrcRoot == "" {
+		root, err := evalSymlinks(sfs, c.p.SrcRoot)
+		if err != nil {
+			return c.pos.Errorf("failed resolving symlinks in %q: %w", c.p.SrcRoot, err)
+		}
+		c.resolvedSrcRoot = root
+	}
+	target, err := evalSymlinks(sfs, path)
+	if err != nil {
+		return c.pos.Errorf("failed following symlink %q: %w", relToSrc, err)
+	}
+	if rel, err := filepath.Rel(c.resolvedSrcRoot, target); err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+		return c.pos.Errorf("symlink %q points to %q, which is outside the directory being copied", relToSrc, target)
+	}
+	return nil
+}
+
+// mkdirIfEmpty creates the directory dst if the source directory src has no
+// entries. A directory that has entries is created when its first file is
+// copied, so that a directory whose files are all skipped isn't created.
+func (c *copier) mkdirIfEmpty(src, dst string) error {
+	entries, err := fs.ReadDir(c.srcFS, src)
+	if err != nil {
+		return c.pos.Errorf("ReadDir(): %w", err)
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+	return mkdirAllChecked(c.pos, c.p.FS, dst, c.p.DryRun)
+}
+
+// prepareDst gets ready to write the file or symlink dst: it creates the
+// parent directory, checks whether an existing file may be overwritten, and
+// backs it up if requested.
+func (c *copier) prepareDst(ctx context.Context, ch CopyHint, relToSrc, src, dst string) error {
+	p, pos := c.p, c.pos
+
+	// The spec file may specify a file to copy that's deep in a directory
+	// tree, (like include "some/deep/subdir/myfile.txt") without including
+	// its parent directory. We can't rely on WalkDir having traversed the
+	// parent directory of $path, so we must create the target directory if
+	// it doesn't exist.
+	inDir := filepath.Dir(dst)
+
+	if err := mkdirAllChecked(pos, p.FS, inDir, p.DryRun); err != nil {
+		return err
+	}
+	dstInfo, err := p.FS.Stat(dst)
+	if err == nil {
+		if dstInfo.IsDir() {
+			return errs.Wrap(errs.ErrConflict, pos.Errorf("cannot overwrite a directory with a file of the same name; destination is %q, source is %q", dst, src))
+		}
+		if !ch.Overwrite {
+			return errs.Wrap(errs.ErrConflict, pos.Errorf("destination file %s already exists and overwriting was not enabled with --force-overwrite", relToSrc))
+		}
+		if ch.BackupIfExists && !p.DryRun {
+			if c.backupDir == "" {
+				if c.backupDir, err = p.BackupDirMaker(p.FS); err != nil {
+					return fmt.Errorf("failed making backup directory: %w", err)
+				}
+			}
+			if err := backUp(ctx, p.FS, c.backupDir, p.DstRoot, relToSrc); err != nil {
+				return err
+			}
+		}
+	} else if !IsStatNotExistErr(err) {
+		return pos.Errorf("Stat(): %w", err)
+	}
+	return nil
+}
+
+// copySymlink creates a symlink at dst with the same target as the symlink at
+// src, for SymlinksPreserve.
+func (c *copier) copySymlink(ctx context.Context, ch CopyHint, src, relToSrc, dst string) error {
+	p, pos := c.p, c.pos
+
+	target, ok, err := ReadlinkIfSymlink(c.srcFS, src)
+	if err != nil {
+		return pos.Errorf("%w", err)
+	}
+	if !ok {
+		return pos.Errorf("internal error: %q was expected to be a symlink", relToSrc)
+	}
+	if err := checkPreservedSymlink(relToSrc, target); err != nil {
+		return pos.Errorf("%w", err)
+	}
+
+	// A dangling symlink is not an error when preserving it, so only a
+	// symlink that already exists in the destination is checked.
+	if _, isLink, err := ReadlinkIfSymlink(p.FS, dst); err == nil && isLink {
+		if !ch.Overwrite {
+			return errs.Wrap(errs.ErrConflict, pos.Errorf("destination file %s already exists and overwriting was not enabled with --force-overwrite", relToSrc))
+		}
+	} else if err := c.prepareDst(ctx, ch, relToSrc, src, dst); err != nil {
+		return err
+	}
+
+	if !p.DryRun {
+		dstFS, ok := p.FS.(SymlinkFS)
+		if !ok {
+			return pos.Errorf("can't preserve symlink %q because the destination filesystem doesn't support symlinks", relToSrc)
+		}
+		if err := p.FS.RemoveAll(dst); err != nil {
+			return pos.Errorf("RemoveAll(): %w", err)
+		}
+		if err := dstFS.Symlink(target, dst); err != nil {
+			return pos.Errorf("Symlink(): %w", err)
+		}
+		c.logger.DebugContext(ctx, "copied symlink",
+			"source", src,
+			"destination", dst,
+			"target", target)
+	}
+
+	slashPath := filepath.ToSlash(relToSrc)
+	if p.Hasher != nil && p.OutHashes != nil {
+		// A symlink is hashed by its target, since that's all it contains.
+		h := p.Hasher()
+		if _, err := h.Write([]byte(target)); err != nil {
+			return fmt.Errorf("hashing symlink target: %w", err)
+		}
+		p.OutHashes[slashPath] = h.Sum(nil)
+	}
+	if p.OutSymlinks != nil {
+		p.OutSymlinks[slashPath] = filepath.ToSlash(target)
+	}
+	return nil
+}
+
+// copyFile copies the contents of src, which is in srcFS, to dst, which is in
+// dstFS.
 //
 // hash is nil-able. If not nil, it will be written to with the file contents.
 // The caller should call hash.Sum() to get the hash output.
-func copyFile(ctx context.Context, pos *model.ConfigPos, rfs FS, src, dst string, mode fs.FileMode, dryRun bool, hash hash.Hash) (outErr error) {
+func copyFile(ctx context.Context, pos *model.ConfigPos, srcFS, dstFS FS, src, dst string, mode fs.FileMode, dryRun bool, hash hash.Hash) (outErr error) {
 	logger := logging.FromContext(ctx).With("logger", "copyFile")
 
-	readFile, err := rfs.Open(src)
+	readFile, err := srcFS.Open(src)
 	if err != nil {
 		return pos.Errorf("Open(): %w", err)
 	}
@@ -260,7 +499,7 @@ func copyFile(ctx context.Context, pos *model.ConfigPos, rfs FS, src, dst string
 	if dryRun {
 		writer = io.Discard
 	} else {
-		writeFile, err := rfs.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		writeFile, err := dstFS.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
 		if err != nil {
 			return pos.Errorf("OpenFile(): %w", err)
 		}
@@ -289,13 +528,13 @@ func copyFile(ctx context.Context, pos *model.ConfigPos, rfs FS, src, dst string
 func backUp(ctx context.Context, rfs FS, backupDir, srcRoot, relPath string) error {
 	backupFile := filepath.Join(backupDir, relPath)
 	parent := filepath.Dir(backupFile)
-	if err := os.MkdirAll(parent, OwnerRWXPerms); err != nil {
-		return fmt.Errorf("os.MkdirAll(%s): %w", parent, err)
+	if err := rfs.MkdirAll(parent, OwnerRWXPerms); err != nil {
+		return fmt.Errorf("MkdirAll(%s): %w", parent, err)
 	}
 
 	fileToBackup := filepath.Join(srcRoot, relPath)
 
-	if err := copyFile(ctx, nil, rfs, fileToBackup, backupFile, OwnerRWPerms, false, nil); err != nil {
+	if err := copyFile(ctx, nil, rfs, rfs, fileToBackup, backupFile, OwnerRWPerms, false, nil); err != nil {
 		return fmt.Errorf("failed backing up file %q at %q before overwriting: %w",
 			fileToBackup, backupFile, err)
 	}
@@ -320,7 +559,7 @@ func mkdirAllChecked(pos *model.ConfigPos, rfs FS, path string, dryRun bool) err
 		}
 		create = true
 	} else if !info.Mode().IsDir() {
-		return pos.Errorf("cannot overwrite a file with a directory of the same name, %q", path)
+		return errs.Wrap(errs.ErrConflict, pos.Errorf("cannot overwrite a file with a directory of the same name, %q", path))
 	}
 
 	if dryRun || !create {
@@ -343,6 +582,7 @@ type ErrorFS struct {
 	OpenFileErr  error
 	ReadFileErr  error
 	RemoveAllErr error
+	RenameErr    error
 	StatErr      error
 	WriteFileErr error
 }
@@ -361,7 +601,7 @@ func (e *ErrorFS) Open(name string) (fs.File, error) {
 	return e.FS.Open(name) //nolint:wrapcheck
 }
 
-func (e *ErrorFS) OpenFile(name string, flag int, mode os.FileMode) (*os.File, error) {
+func (e *ErrorFS) OpenFile(name string, flag int, mode os.FileMode) (File, error) {
 	if e.OpenFileErr != nil {
 		return nil, e.OpenFileErr
 	}
@@ -382,6 +622,13 @@ func (e *ErrorFS) RemoveAll(name string) error {
 	return e.FS.RemoveAll(name) //nolint:wrapcheck
 }
 
+func (e *ErrorFS) Rename(from, to string) error {
+	if e.RenameErr != nil {
+		return e.RenameErr
+	}
+	return e.FS.Rename(from, to) //nolint:wrapcheck
+}
+
 func (e *ErrorFS) Stat(name string) (fs.FileInfo, error) {
 	if e.StatErr != nil {
 		return nil, e.StatErr
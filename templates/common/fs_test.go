@@ -19,6 +19,7 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash"
 	"io/fs"
@@ -32,6 +33,7 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"golang.org/x/exp/slices"
 
+	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/model"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/testutil"
@@ -43,11 +45,14 @@ func TestCopyRecursive(t *testing.T) {
 	cases := []struct {
 		name                  string
 		srcDirContents        map[string]abctestutil.ModeAndContents
+		srcEmptyDirs          []string
 		suffix                string
 		dryRun                bool
 		hasher                func() hash.Hash
 		visitor               CopyVisitor
+		limits                *Limits
 		want                  map[string]abctestutil.ModeAndContents
+		wantEmptyDirs         []string
 		wantBackups           map[string]abctestutil.ModeAndContents
 		dstDirInitialContents map[string]abctestutil.ModeAndContents // only used in the tests for overwriting and backing up
 		mkdirAllErr           error
@@ -56,7 +61,9 @@ func TestCopyRecursive(t *testing.T) {
 		readFileErr           error
 		statErr               error
 		writeFileErr          error
+		canceled              bool
 		wantErr               string
+		wantErrIs             error
 		wantHashesHex         map[string]string
 	}{
 		{
@@ -121,6 +128,7 @@ func TestCopyRecursive(t *testing.T) {
 			openFileErr: fmt.Errorf("OpenFile shouldn't be called in dry run mode"),
 			mkdirAllErr: fmt.Errorf("MkdirAll shouldn't be called in dry run mode"),
 			wantErr:     "file file1.txt already exists and overwriting was not enabled",
+			wantErrIs:   errs.ErrConflict,
 		},
 		{
 			name: "dry_run_should_calculate_hashes",
@@ -218,7 +226,8 @@ func TestCopyRecursive(t *testing.T) {
 			want: map[string]abctestutil.ModeAndContents{
 				"file1.txt": {Mode: 0o600, Contents: "old contents"},
 			},
-			wantErr: "overwriting was not enabled",
+			wantErr:   "overwriting was not enabled",
+			wantErrIs: errs.ErrConflict,
 		},
 		{
 			name: "overwriting_dir_with_child_file_should_fail",
@@ -236,7 +245,8 @@ func TestCopyRecursive(t *testing.T) {
 			want: map[string]abctestutil.ModeAndContents{
 				"a/b.txt": {Mode: 0o600, Contents: "file contents"},
 			},
-			wantErr: "cannot overwrite a directory with a file of the same name",
+			wantErr:   "cannot overwrite a directory with a file of the same name",
+			wantErrIs: errs.ErrConflict,
 		},
 		{
 			name: "overwriting_file_with_dir_should_fail",
@@ -254,7 +264,8 @@ func TestCopyRecursive(t *testing.T) {
 			want: map[string]abctestutil.ModeAndContents{
 				"a": {Mode: 0o600, Contents: "file contents"},
 			},
-			wantErr: "cannot overwrite a file with a directory of the same name",
+			wantErr:   "cannot overwrite a file with a directory of the same name",
+			wantErrIs: errs.ErrConflict,
 		},
 		{
 			name: "skipped_files",
@@ -276,6 +287,69 @@ func TestCopyRecursive(t *testing.T) {
 				"z.txt":          {Mode: 0o600, Contents: "z.txt contents"},
 			},
 		},
+		{
+			name: "within_limits",
+			srcDirContents: map[string]abctestutil.ModeAndContents{
+				"a.txt":     {Mode: 0o600, Contents: "12345"},
+				"dir/b.txt": {Mode: 0o600, Contents: "6789"},
+			},
+			limits: &Limits{MaxFiles: 2, MaxBytes: 9, MaxPathDepth: 2},
+			want: map[string]abctestutil.ModeAndContents{
+				"a.txt":     {Mode: 0o600, Contents: "12345"},
+				"dir/b.txt": {Mode: 0o600, Contents: "6789"},
+			},
+		},
+		{
+			name: "too_many_files",
+			srcDirContents: map[string]abctestutil.ModeAndContents{
+				"a.txt": {Mode: 0o600, Contents: "a"},
+				"b.txt": {Mode: 0o600, Contents: "b"},
+				"c.txt": {Mode: 0o600, Contents: "c"},
+			},
+			limits: &Limits{MaxFiles: 2},
+			want: map[string]abctestutil.ModeAndContents{
+				"a.txt": {Mode: 0o600, Contents: "a"},
+				"b.txt": {Mode: 0o600, Contents: "b"},
+			},
+			wantErr: `there are more than 2 files, which is the limit set by --max-files (reached at "c.txt")`,
+		},
+		{
+			name: "too_many_bytes",
+			srcDirContents: map[string]abctestutil.ModeAndContents{
+				"a.txt": {Mode: 0o600, Contents: "12345"},
+				"b.txt": {Mode: 0o600, Contents: "6789"},
+			},
+			limits: &Limits{MaxBytes: 8},
+			want: map[string]abctestutil.ModeAndContents{
+				"a.txt": {Mode: 0o600, Contents: "12345"},
+			},
+			wantErr: `the files total more than 8 bytes, which is the limit set by --max-bytes (reached at "b.txt")`,
+		},
+		{
+			name: "path_too_deep",
+			srcDirContents: map[string]abctestutil.ModeAndContents{
+				"a/b/c/d.txt": {Mode: 0o600, Contents: "d"},
+			},
+			limits:  &Limits{MaxPathDepth: 3},
+			wantErr: `the path "a/b/c/d.txt" is 4 levels deep, which is more than the limit of 3 set by --max-path-depth`,
+		},
+		{
+			name: "skipped_files_dont_count_against_limits",
+			srcDirContents: map[string]abctestutil.ModeAndContents{
+				"a.txt":                     {Mode: 0o600, Contents: "a"},
+				"node_modules/x/y/index.js": {Mode: 0o600, Contents: "x"},
+				"node_modules/z/index.js":   {Mode: 0o600, Contents: "z"},
+			},
+			visitor: func(relPath string, de fs.DirEntry) (CopyHint, error) {
+				return CopyHint{
+					Skip: relPath == "node_modules",
+				}, nil
+			},
+			limits: &Limits{MaxFiles: 1, MaxPathDepth: 1},
+			want: map[string]abctestutil.ModeAndContents{
+				"a.txt": {Mode: 0o600, Contents: "a"},
+			},
+		},
 		{
 			name: "skipped_directory_skips_all_subsequent",
 			srcDirContents: map[string]abctestutil.ModeAndContents{
@@ -300,6 +374,38 @@ func TestCopyRecursive(t *testing.T) {
 				"otherdir/file4.txt": {Mode: 0o600, Contents: "file4 contents"},
 			},
 		},
+		{
+			name: "empty_directories_are_created",
+			srcDirContents: map[string]abctestutil.ModeAndContents{
+				"file1.txt":        {Mode: 0o600, Contents: "file1 contents"},
+				"subdir/skip1.txt": {Mode: 0o600, Contents: "skip1 contents"},
+			},
+			srcEmptyDirs: []string{"empty1", "nested/empty2", "skipped/empty3"},
+			visitor: func(relPath string, de fs.DirEntry) (CopyHint, error) {
+				return CopyHint{
+					Skip: relPath == "skipped" || relPath == filepath.Join("subdir", "skip1.txt"),
+				}, nil
+			},
+			want: map[string]abctestutil.ModeAndContents{
+				"file1.txt": {Mode: 0o600, Contents: "file1 contents"},
+			},
+			// "subdir" isn't created, because it isn't empty in the source.
+			wantEmptyDirs: []string{"empty1", "nested/empty2"},
+		},
+		{
+			name:   "empty_directory_as_root",
+			suffix: "empty",
+			srcDirContents: map[string]abctestutil.ModeAndContents{
+				"file1.txt": {Mode: 0o600, Contents: "file1 contents"},
+			},
+			srcEmptyDirs:  []string{"empty"},
+			wantEmptyDirs: []string{"empty"},
+		},
+		{
+			name:         "dry_run_should_not_create_empty_directories",
+			dryRun:       true,
+			srcEmptyDirs: []string{"empty1"},
+		},
 		{
 			name: "backup_existing",
 			srcDirContents: map[string]abctestutil.ModeAndContents{
@@ -399,6 +505,15 @@ func TestCopyRecursive(t *testing.T) {
 			statErr: fmt.Errorf("fake error"),
 			wantErr: "fake error", // This error comes from WalkDir, not from our own code, so it doesn't have a "Stat():" at the beginning
 		},
+		{
+			name: "canceled_context_stops_copying",
+			srcDirContents: map[string]abctestutil.ModeAndContents{
+				"file1.txt": {Mode: 0o600, Contents: "file1 contents"},
+			},
+			canceled:  true,
+			wantErrIs: context.Canceled,
+			wantErr:   "context canceled",
+		},
 	}
 
 	for _, tc := range cases {
@@ -413,6 +528,7 @@ func TestCopyRecursive(t *testing.T) {
 			backupDir := filepath.Join(tempDir, "backups")
 
 			abctestutil.WriteAll(t, fromDir, tc.srcDirContents)
+			abctestutil.WriteEmptyDirs(t, fromDir, tc.srcEmptyDirs)
 
 			from := fromDir
 			to := toDir
@@ -429,7 +545,11 @@ func TestCopyRecursive(t *testing.T) {
 				OpenFileErr: tc.openFileErr,
 				StatErr:     tc.statErr,
 			}
-			ctx := context.Background()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.canceled {
+				cancel()
+			}
 
 			clk := clock.NewMock()
 			const unixTime = 1688609125
@@ -449,15 +569,26 @@ func TestCopyRecursive(t *testing.T) {
 				OutHashes:      hashes,
 				FS:             fs,
 				Visitor:        tc.visitor,
+				Limits:         tc.limits,
 			})
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Error(diff)
 			}
+			if tc.wantErrIs != nil && !errors.Is(err, tc.wantErrIs) {
+				t.Errorf("got error %v, want an error matching %v", err, tc.wantErrIs)
+			}
 
 			got := abctestutil.LoadDirContents(t, toDir)
 			if diff := cmp.Diff(got, tc.want, cmpopts.EquateEmpty()); diff != "" {
 				t.Errorf("destination directory was not as expected (-got,+want): %s", diff)
 			}
+			// A failed copy may leave behind the parent directory of the
+			// file that it failed to write.
+			if err == nil {
+				if diff := cmp.Diff(abctestutil.LoadEmptyDirs(t, toDir), tc.wantEmptyDirs, cmpopts.EquateEmpty()); diff != "" {
+					t.Errorf("empty directories in destination were not as expected (-got,+want): %s", diff)
+				}
+			}
 
 			gotBackups := abctestutil.LoadDirContents(t, backupDir)
 			if diff := cmp.Diff(gotBackups, tc.wantBackups, cmpopts.EquateEmpty()); diff != "" {
@@ -478,3 +609,27 @@ func TestCopyRecursive(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkCopyRecursive(b *testing.B) {
+	for _, numFiles := range abctestutil.BenchmarkSizes {
+		numFiles := numFiles
+
+		b.Run(abctestutil.BenchmarkName(numFiles), func(b *testing.B) {
+			ctx := abctestutil.BenchmarkContext()
+			srcDir := b.TempDir()
+			abctestutil.WriteTree(b, srcDir, abctestutil.SyntheticTree(numFiles))
+			dstBase := b.TempDir()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := CopyRecursive(ctx, nil, &CopyParams{
+					SrcRoot: srcDir,
+					DstRoot: filepath.Join(dstBase, fmt.Sprint(i)),
+					FS:      &RealFS{},
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
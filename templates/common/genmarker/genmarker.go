@@ -0,0 +1,209 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package genmarker writes and recognizes the comment that marks a rendered
+// file as generated by abc, so that people know not to edit it, and upgrades
+// know that they may regenerate it.
+package genmarker
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+const (
+	textPrefix = "Code generated by abc"
+	textSuffix = "DO NOT EDIT."
+)
+
+// searchLines is how many lines at the start of a file are searched for a
+// marker by Has. The marker may come after a shebang line or an XML
+// declaration, and editors and formatters sometimes add a line or two above
+// it.
+const searchLines = 5
+
+// Text returns the text of the marker for output rendered from source, which
+// is a template location and version like "github.com/foo/bar/t@v1.2.3". It's
+// empty if the template location isn't canonical, like a local directory. The
+// text follows the convention for generated Go files, which many other tools
+// recognize too.
+func Text(source string) string {
+	if source == "" {
+		return textPrefix + ". " + textSuffix
+	}
+	return fmt.Sprintf("%s from %s. %s", textPrefix, source, textSuffix)
+}
+
+// commentStyle is the syntax of a line comment in some language.
+type commentStyle struct {
+	open  string
+	close string
+}
+
+var (
+	slashComment  = &commentStyle{open: "// "}
+	hashComment   = &commentStyle{open: "# "}
+	dashComment   = &commentStyle{open: "-- "}
+	semiComment   = &commentStyle{open: "; "}
+	blockComment  = &commentStyle{open: "/* ", close: " */"}
+	markupComment = &commentStyle{open: "<!-- ", close: " -->"}
+)
+
+// stylesByExt are the comment styles of files, keyed by their extensions.
+// Formats without comments, like JSON, are missing, so their files are never
+// marked.
+var stylesByExt = map[string]*commentStyle{
+	".c":       slashComment,
+	".cc":      slashComment,
+	".cpp":     slashComment,
+	".cs":      slashComment,
+	".dart":    slashComment,
+	".go":      slashComment,
+	".gradle":  slashComment,
+	".groovy":  slashComment,
+	".h":       slashComment,
+	".hpp":     slashComment,
+	".java":    slashComment,
+	".js":      slashComment,
+	".jsx":     slashComment,
+	".kt":      slashComment,
+	".kts":     slashComment,
+	".mjs":     slashComment,
+	".proto":   slashComment,
+	".rs":      slashComment,
+	".scala":   slashComment,
+	".scss":    slashComment,
+	".swift":   slashComment,
+	".ts":      slashComment,
+	".tsx":     slashComment,
+	".bash":    hashComment,
+	".bzl":     hashComment,
+	".cfg":     hashComment,
+	".conf":    hashComment,
+	".hcl":     hashComment,
+	".mk":      hashComment,
+	".pl":      hashComment,
+	".ps1":     hashComment,
+	".py":      hashComment,
+	".r":       hashComment,
+	".rb":      hashComment,
+	".sh":      hashComment,
+	".tf":      hashComment,
+	".tfvars":  hashComment,
+	".toml":    hashComment,
+	".yaml":    hashComment,
+	".yml":     hashComment,
+	".zsh":     hashComment,
+	".hs":      dashComment,
+	".lua":     dashComment,
+	".sql":     dashComment,
+	".clj":     semiComment,
+	".el":      semiComment,
+	".ini":     semiComment,
+	".lisp":    semiComment,
+	".css":     blockComment,
+	".htm":     markupComment,
+	".html":    markupComment,
+	".md":      markupComment,
+	".svg":     markupComment,
+	".vue":     markupComment,
+	".xml":     markupComment,
+	".xhtml":   markupComment,
+	".env":     hashComment,
+	".service": hashComment,
+}
+
+// stylesByName are the comment styles of files whose names don't have a
+// useful extension.
+var stylesByName = map[string]*commentStyle{
+	".dockerignore": hashComment,
+	".gitignore":    hashComment,
+	"BUILD":         hashComment,
+	"BUILD.bazel":   hashComment,
+	"CODEOWNERS":    hashComment,
+	"Containerfile": hashComment,
+	"Dockerfile":    hashComment,
+	"Makefile":      hashComment,
+	"WORKSPACE":     hashComment,
+	"go.mod":        slashComment,
+}
+
+// styleOf returns the comment style of the file at path, or nil if it's not
+// known.
+func styleOf(path string) *commentStyle {
+	name := filepath.Base(path)
+	if s, ok := stylesByName[name]; ok {
+		return s
+	}
+	return stylesByExt[strings.ToLower(filepath.Ext(name))]
+}
+
+// Stamp returns buf, the contents of the file at path, with the marker for
+// source added at the top as a comment, followed by a blank line. It goes
+// after a shebang line or an XML declaration, which must come first. ok is
+// false, and buf is returned unchanged, if the file is binary, if its comment
+// syntax isn't known from its name (see stylesByExt), or if it already has a
+// marker.
+func Stamp(path string, buf []byte, source string) (_ []byte, ok bool) {
+	style := styleOf(path)
+	if style == nil || common.IsBinary(buf) || Has(buf) {
+		return buf, false
+	}
+
+	var head []byte
+	rest := buf
+	if bom := []byte("\xef\xbb\xbf"); bytes.HasPrefix(rest, bom) {
+		head, rest = bom, rest[len(bom):]
+	}
+	if bytes.HasPrefix(rest, []byte("#!")) || bytes.HasPrefix(rest, []byte("<?xml")) {
+		n := bytes.IndexByte(rest, '\n') + 1
+		if n == 0 {
+			// The file is only that line, with no newline.
+			rest = append(bytes.Clone(rest), '\n')
+			n = len(rest)
+		}
+		head, rest = append(head, rest[:n]...), rest[n:]
+	}
+
+	nl := "\n"
+	if i := bytes.IndexByte(buf, '\n'); i > 0 && buf[i-1] == '\r' {
+		nl = "\r\n"
+	}
+	marker := style.open + Text(source) + style.close + nl
+	if len(rest) > 0 {
+		marker += nl
+	}
+
+	out := make([]byte, 0, len(head)+len(marker)+len(rest))
+	out = append(out, head...)
+	out = append(out, marker...)
+	return append(out, rest...), true
+}
+
+// Has returns whether the file contents in buf have a marker written by
+// Stamp, in any comment style and for any source, near the top.
+func Has(buf []byte) bool {
+	for i := 0; i < searchLines && len(buf) > 0; i++ {
+		line, rest, _ := bytes.Cut(buf, []byte("\n"))
+		if bytes.Contains(line, []byte(textPrefix)) && bytes.Contains(line, []byte(textSuffix)) {
+			return true
+		}
+		buf = rest
+	}
+	return false
+}
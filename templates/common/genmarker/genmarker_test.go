@@ -0,0 +1,185 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package genmarker
+
+import "testing"
+
+func TestStamp(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		path   string
+		in     string
+		source string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "go",
+			path:   "cmd/main.go",
+			in:     "package main\n",
+			source: "github.com/foo/bar/t@v1.2.3",
+			want:   "// Code generated by abc from github.com/foo/bar/t@v1.2.3. DO NOT EDIT.\n\npackage main\n",
+			wantOK: true,
+		},
+		{
+			name:   "no_source",
+			path:   "config.yaml",
+			in:     "a: 1\n",
+			want:   "# Code generated by abc. DO NOT EDIT.\n\na: 1\n",
+			wantOK: true,
+		},
+		{
+			name:   "block_comment",
+			path:   "style.CSS",
+			in:     "body {}\n",
+			want:   "/* Code generated by abc. DO NOT EDIT. */\n\nbody {}\n",
+			wantOK: true,
+		},
+		{
+			name:   "by_name",
+			path:   "Dockerfile",
+			in:     "FROM scratch\n",
+			want:   "# Code generated by abc. DO NOT EDIT.\n\nFROM scratch\n",
+			wantOK: true,
+		},
+		{
+			name:   "after_shebang",
+			path:   "run.sh",
+			in:     "#!/bin/sh\necho hi\n",
+			want:   "#!/bin/sh\n# Code generated by abc. DO NOT EDIT.\n\necho hi\n",
+			wantOK: true,
+		},
+		{
+			name:   "only_shebang",
+			path:   "run.sh",
+			in:     "#!/bin/sh",
+			want:   "#!/bin/sh\n# Code generated by abc. DO NOT EDIT.\n",
+			wantOK: true,
+		},
+		{
+			name:   "after_xml_declaration_with_crlf",
+			path:   "pom.xml",
+			in:     "<?xml version=\"1.0\"?>\r\n<project/>\r\n",
+			want:   "<?xml version=\"1.0\"?>\r\n<!-- Code generated by abc. DO NOT EDIT. -->\r\n\r\n<project/>\r\n",
+			wantOK: true,
+		},
+		{
+			name:   "after_bom",
+			path:   "README.md",
+			in:     "\xef\xbb\xbf# Hi\n",
+			want:   "\xef\xbb\xbf<!-- Code generated by abc. DO NOT EDIT. -->\n\n# Hi\n",
+			wantOK: true,
+		},
+		{
+			name:   "empty",
+			path:   "main.tf",
+			want:   "# Code generated by abc. DO NOT EDIT.\n",
+			wantOK: true,
+		},
+		{
+			name: "already_marked",
+			path: "main.go",
+			in:   "// Code generated by abc from elsewhere. DO NOT EDIT.\n\npackage main\n",
+			want: "// Code generated by abc from elsewhere. DO NOT EDIT.\n\npackage main\n",
+		},
+		{
+			name: "no_comments",
+			path: "package.json",
+			in:   "{}\n",
+			want: "{}\n",
+		},
+		{
+			name: "unknown_extension",
+			path: "notes.txt",
+			in:   "hello\n",
+			want: "hello\n",
+		},
+		{
+			name: "binary",
+			path: "main.go",
+			in:   "\x00package main\n",
+			want: "\x00package main\n",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := Stamp(tc.path, []byte(tc.in), tc.source)
+			if string(got) != tc.want {
+				t.Errorf("Stamp(%q) got %q, want %q", tc.in, got, tc.want)
+			}
+			if ok != tc.wantOK {
+				t.Errorf("Stamp(%q) got ok=%t, want %t", tc.in, ok, tc.wantOK)
+			}
+			if ok && !Has(got) {
+				t.Errorf("Has() is false for the output of Stamp: %q", got)
+			}
+		})
+	}
+}
+
+func TestHas(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+		want bool
+	}{
+		{
+			name: "first_line",
+			in:   "# Code generated by abc from x@v1. DO NOT EDIT.\na: 1\n",
+			want: true,
+		},
+		{
+			name: "after_a_few_lines",
+			in:   "#!/bin/sh\n# shellcheck disable=all\n# Code generated by abc. DO NOT EDIT.\n",
+			want: true,
+		},
+		{
+			name: "too_far_down",
+			in:   "1\n2\n3\n4\n5\n// Code generated by abc. DO NOT EDIT.\n",
+		},
+		{
+			name: "other_generator",
+			in:   "// Code generated by protoc-gen-go. DO NOT EDIT.\n",
+		},
+		{
+			name: "marker_edited",
+			in:   "// Code generated by abc.\npackage main\n",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Has([]byte(tc.in)); got != tc.want {
+				t.Errorf("Has(%q) got %t, want %t", tc.in, got, tc.want)
+			}
+		})
+	}
+}
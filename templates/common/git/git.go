@@ -22,11 +22,14 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
 )
 
 var sha = regexp.MustCompile("^[0-9a-f]{40}$")
@@ -34,20 +37,31 @@ var sha = regexp.MustCompile("^[0-9a-f]{40}$")
 // Clone checks out the given branch, tag or long commit SHA from the given repo.
 // It uses the git CLI already installed on the system.
 //
-// To optimize storage and bandwidth, the full git history is not fetched.
+// To optimize storage and bandwidth, the full git history is not fetched. A
+// long commit SHA is fetched by itself, along with the tags that point to it,
+// which needs a server that allows fetching commits by SHA, like GitHub and
+// GitLab. If the server doesn't allow it, the whole repo is cloned instead.
 //
 // "remote" may be any format accepted by git, such as
 // https://github.com/abcxyz/abc.git or git@github.com:abcxyz/abc.git .
 func Clone(ctx context.Context, remote, version, outDir string) error {
 	if sha.MatchString(version) {
-		_, _, err := common.Run(ctx, "git", "clone", remote, outDir)
-		if err != nil {
-			return err //nolint:wrapcheck
-		}
+		if err := fetchCommit(ctx, remote, version, outDir); err != nil {
+			logging.FromContext(ctx).DebugContext(ctx, "fetching a single commit failed, falling back to cloning the whole repo",
+				"remote", remote,
+				"commit", version,
+				"error", err)
+			if err := removeContents(outDir); err != nil {
+				return err
+			}
 
-		_, _, err = common.Run(ctx, "git", "-C", outDir, "reset", "--hard", version)
-		if err != nil {
-			return err //nolint:wrapcheck
+			if _, _, err := common.Run(ctx, "git", "clone", remote, outDir); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if _, _, err := common.Run(ctx, "git", "-C", outDir, "reset", "--hard", version); err != nil {
+				return err //nolint:wrapcheck
+			}
 		}
 	} else {
 		_, _, err := common.Run(ctx, "git", "clone", "--depth", "1", "--branch", version, remote, outDir)
@@ -66,6 +80,49 @@ func Clone(ctx context.Context, remote, version, outDir string) error {
 	return nil
 }
 
+// fetchCommit checks out the given commit from remote into outDir without its
+// history. The tags that point to the commit are fetched too, so that the
+// checkout has the same tags at HEAD as a full clone would.
+func fetchCommit(ctx context.Context, remote, commit, outDir string) error {
+	refs, err := RemoteRefs(ctx, remote)
+	if err != nil {
+		return err
+	}
+	args := []string{"git", "-C", outDir, "fetch", "--quiet", "--depth", "1", "--no-tags", "origin", commit}
+	for _, r := range refs {
+		if strings.HasPrefix(r.Name, tagRefPrefix) && r.SHA == commit {
+			args = append(args, "+"+r.Name+":"+r.Name)
+		}
+	}
+
+	cmds := [][]string{
+		{"git", "init", "--quiet", outDir},
+		{"git", "-C", outDir, "remote", "add", "origin", remote},
+		args,
+		{"git", "-C", outDir, "checkout", "--quiet", "--detach", commit},
+	}
+	for _, cmd := range cmds {
+		if _, _, err := common.Run(ctx, cmd...); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	return nil
+}
+
+// removeContents removes everything inside dir, but not dir itself.
+func removeContents(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("ReadDir(): %w", err)
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return fmt.Errorf("RemoveAll(): %w", err)
+		}
+	}
+	return nil
+}
+
 func findSymlinks(dir string) ([]string, error) {
 	var out []string
 	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
@@ -97,44 +154,110 @@ func findSymlinks(dir string) ([]string, error) {
 	return out, nil
 }
 
+const (
+	tagRefPrefix = "refs/tags/"
+
+	// peeledSuffix ends the name of the extra line that "git ls-remote" prints
+	// for an annotated tag, with the SHA of the commit that the tag points to.
+	peeledSuffix = "^{}"
+)
+
+// Ref is a branch or tag in a remote repo.
+type Ref struct {
+	// Name is the full name of the ref, like "refs/tags/v1.2.3" or
+	// "refs/heads/main".
+	Name string
+
+	// SHA is the long SHA of the commit that the ref points to. For an
+	// annotated tag, it's the commit, not the tag object.
+	SHA string
+}
+
+// RemoteRefs looks up the branches and tags in the given remote repo with "git
+// ls-remote", which is fast even for a huge repo, since nothing is cloned.
+// The refs are in the order that git lists them.
+//
+// "remote" may be any format accepted by git, such as
+// https://github.com/abcxyz/abc.git or git@github.com:abcxyz/abc.git .
+func RemoteRefs(ctx context.Context, remote string) ([]*Ref, error) {
+	return lsRemote(ctx, remote, "--heads", "--tags")
+}
+
 // RemoteTags looks up the tags in the given remote repo. If there are no tags,
 // that's not an error, and the returned slice is len 0.
 //
 // "remote" may be any format accepted by git, such as
 // https://github.com/abcxyz/abc.git or git@github.com:abcxyz/abc.git .
 func RemoteTags(ctx context.Context, remote string) ([]string, error) {
-	stdout, _, err := common.Run(ctx, "git", "ls-remote", "--tags", remote)
+	refs, err := lsRemote(ctx, remote, "--tags")
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(refs))
+	for _, r := range refs {
+		tags = append(tags, strings.TrimPrefix(r.Name, tagRefPrefix))
+	}
+	return tags, nil
+}
+
+// lsRemote runs "git ls-remote" with the given flags and parses its output.
+func lsRemote(ctx context.Context, remote string, flags ...string) ([]*Ref, error) {
+	args := append(append([]string{"git", "ls-remote"}, flags...), remote)
+	stdout, _, err := common.Run(ctx, args...)
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
+	var refs []*Ref
+	byName := map[string]*Ref{}
 	lineScanner := bufio.NewScanner(strings.NewReader(stdout))
-	var tags []string
 	for lineScanner.Scan() {
-		line := lineScanner.Text()
-		fields := strings.Fields(line)
-		prefixedTag := fields[len(fields)-1]
-		if strings.HasSuffix(prefixedTag, "^{}") {
-			// Skip the weird extra duplicate tags ending with "^{}" that git
-			// prints for some reason.
+		fields := strings.Fields(lineScanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		commit, name := fields[0], fields[1]
+		if tagName, ok := strings.CutSuffix(name, peeledSuffix); ok {
+			// The commit that an annotated tag points to, listed right
+			// after the tag itself.
+			if r, ok := byName[tagName]; ok {
+				r.SHA = commit
+			}
 			continue
 		}
-		tag := strings.TrimPrefix(prefixedTag, "refs/tags/")
-		tags = append(tags, tag)
+		r := &Ref{Name: name, SHA: commit}
+		refs = append(refs, r)
+		byName[name] = r
 	}
-
-	return tags, nil
+	return refs, nil
 }
 
 // Workspace looks for the presence of a .git directory in parent directories
 // to determine the root directory of the git workspace containing "path".
 // Returns false if the given path is not inside a git workspace.
 //
+// A linked worktree (created by "git worktree add") has a .git file instead of
+// a .git directory, and counts as a workspace of its own. A submodule also has
+// a .git file, but it's part of the workspace of its superproject; use Repo to
+// find the submodule itself.
+//
 // The input path need not actually exist yet. For example, suppose "/a/b" is a
 // git workspace, which means that "/a/b/.git" is a directory that exists.
 // Calling Workspace("/a/b/c") will return "/a/b" whether or not "c" actually
 // exists yet. This supports the case where the user is rendering into a
 // directory that doesn't exist yet but will be created by the render operation.
 func Workspace(ctx context.Context, path string) (string, bool, error) {
+	return findRoot(path, false)
+}
+
+// Repo is like Workspace, except that if "path" is inside a submodule, it
+// returns the root of the submodule rather than of its superproject.
+func Repo(ctx context.Context, path string) (string, bool, error) {
+	return findRoot(path, true)
+}
+
+// findRoot crawls upward from path looking for the root of a git workspace.
+// If stopAtSubmodules is false, submodules are crawled through.
+func findRoot(path string, stopAtSubmodules bool) (string, bool, error) {
 	// Alternative considered and rejected: use "git rev-parse --git-dir" to
 	// print the .git dir. We can't use that here because that would require the
 	// directory to already exist in the filesystem, but this function is called
@@ -147,9 +270,19 @@ func Workspace(ctx context.Context, path string) (string, bool, error) {
 		if fileInfo != nil && fileInfo.IsDir() {
 			return path, true, nil
 		}
+		if fileInfo != nil && fileInfo.Mode().IsRegular() {
+			worktree, err := isLinkedWorktree(path)
+			if err != nil {
+				return "", false, err
+			}
+			if worktree || stopAtSubmodules {
+				return path, true, nil
+			}
+		}
 		// At this point, we know that one of two things is true:
 		//   - $path/.git doesn't exist
-		//   - $path/.git is a file (not a directory)
+		//   - $path/.git is a file (not a directory) belonging to a
+		//     submodule, which is part of the superproject's workspace
 		//
 		// In both cases, we'll continue crawling upward in the directory tree
 		// looking for a .git directory.
@@ -163,6 +296,33 @@ func Workspace(ctx context.Context, path string) (string, bool, error) {
 	}
 }
 
+// isLinkedWorktree reads the .git file in dir, which is either a linked
+// worktree or a submodule, and returns true if it's a linked worktree. The
+// .git file contains "gitdir: <path>", and only the git dir of a linked
+// worktree has a "commondir" file pointing at the main repo's git dir.
+func isLinkedWorktree(dir string) (bool, error) {
+	gitFile := filepath.Join(dir, ".git")
+	buf, err := os.ReadFile(gitFile)
+	if err != nil {
+		return false, fmt.Errorf("ReadFile(): %w", err)
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(buf)), "gitdir:")
+	if !ok {
+		return false, fmt.Errorf("%q doesn't look like a git file, it should begin with \"gitdir:\"", gitFile)
+	}
+	gitDir = filepath.FromSlash(strings.TrimSpace(gitDir))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "commondir")); err != nil {
+		if common.IsStatNotExistErr(err) {
+			return false, nil
+		}
+		return false, err //nolint:wrapcheck
+	}
+	return true, nil
+}
+
 // IsClean returns false if the given git workspace has any uncommitted changes,
 // and otherwise returns true. Returns error if dir is not in a git workspace.
 func IsClean(ctx context.Context, dir string) (bool, error) {
@@ -220,6 +380,38 @@ func CurrentSHA(ctx context.Context, dir string) (string, error) {
 	return strings.TrimSpace(stdout), nil
 }
 
+// CommitInfo describes a git commit.
+type CommitInfo struct {
+	// Time is when the commit was made, according to the committer.
+	Time time.Time
+
+	AuthorName  string
+	AuthorEmail string
+}
+
+// CurrentCommit returns the time and author of the current HEAD in the given
+// git workspace.
+func CurrentCommit(ctx context.Context, dir string) (*CommitInfo, error) {
+	args := []string{"git", "-C", dir, "log", "-1", "--format=%ct%n%an%n%ae", "HEAD"}
+	stdout, _, err := common.Run(ctx, args...)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	lines := strings.Split(strings.TrimRight(stdout, "\n"), "\n")
+	if len(lines) != 3 {
+		return nil, fmt.Errorf("internal error: unexpected output format from \"git log\": %q", stdout)
+	}
+	secs, err := strconv.ParseInt(lines[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: unexpected commit time from \"git log\": %q", lines[0])
+	}
+	return &CommitInfo{
+		Time:        time.Unix(secs, 0).UTC(),
+		AuthorName:  lines[1],
+		AuthorEmail: lines[2],
+	}, nil
+}
+
 // ParseSemverTag parses a string of the form "v1.2.3" into a semver tag. In abc
 // CLI, we require that tags begin with "v", and anything else is a parse error.
 //
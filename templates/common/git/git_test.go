@@ -18,7 +18,9 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/exp/slices"
@@ -154,43 +156,47 @@ func TestClone(t *testing.T) {
 func TestFindSymlinks(t *testing.T) {
 	t.Parallel()
 
+	link := abctestutil.Symlink("link-dest")
+	regular := abctestutil.FileMode("my-contents", 0o644)
+
 	cases := []struct {
-		name         string
-		regularFiles []string
-		symlinks     []string
-		want         []string
+		name  string
+		files abctestutil.Tree
+		want  []string
 	}{
 		{
-			name:     "one_symlink",
-			symlinks: []string{"my-symlink"},
-			want:     []string{"my-symlink"},
+			name:  "one_symlink",
+			files: abctestutil.Tree{"my-symlink": link},
+			want:  []string{"my-symlink"},
 		},
 		{
 			name: "multi_symlinks",
-			symlinks: []string{
-				"my-symlink-1",
-				"my-symlink-2",
+			files: abctestutil.Tree{
+				"my-symlink-1": link,
+				"my-symlink-2": link,
 			},
 			want: []string{"my-symlink-1", "my-symlink-2"},
 		},
 		{
-			name:         "mix_symlinks_and_regular",
-			symlinks:     []string{"my-symlink"},
-			regularFiles: []string{"my-regular-file"},
-			want:         []string{"my-symlink"},
+			name: "mix_symlinks_and_regular",
+			files: abctestutil.Tree{
+				"my-symlink":      link,
+				"my-regular-file": regular,
+			},
+			want: []string{"my-symlink"},
 		},
 		{
-			name:         "no_symlinks",
-			regularFiles: []string{"my-regular-file"},
+			name:  "no_symlinks",
+			files: abctestutil.Tree{"my-regular-file": regular},
 		},
 		{
-			name:     "dot_git_is_skipped",
-			symlinks: []string{".git/my-symlink"},
+			name:  "dot_git_is_skipped",
+			files: abctestutil.Tree{".git/my-symlink": link},
 		},
 		{
-			name:     "dot_git_outside_of_root_is_not_skipped",
-			symlinks: []string{"foo/.git/my-symlink"},
-			want:     []string{"foo/.git/my-symlink"},
+			name:  "dot_git_outside_of_root_is_not_skipped",
+			files: abctestutil.Tree{"foo/.git/my-symlink": link},
+			want:  []string{"foo/.git/my-symlink"},
 		},
 		{
 			name: "empty_dir",
@@ -204,22 +210,7 @@ func TestFindSymlinks(t *testing.T) {
 			t.Parallel()
 
 			tempDir := t.TempDir()
-
-			for _, r := range tc.regularFiles {
-				path := filepath.Join(tempDir, r)
-				if err := os.WriteFile(path, []byte("my-contents"), 0o644); err != nil { //nolint:gosec
-					t.Fatal(err)
-				}
-			}
-			for _, s := range tc.symlinks {
-				path := filepath.Join(tempDir, s)
-				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-					t.Fatal(err)
-				}
-				if err := os.Symlink("link-dest", path); err != nil {
-					t.Fatal(err)
-				}
-			}
+			abctestutil.WriteTree(t, tempDir, tc.files)
 
 			got, err := findSymlinks(tempDir)
 			if err != nil {
@@ -310,3 +301,243 @@ func TestHeadTags(t *testing.T) {
 		})
 	}
 }
+
+func TestCurrentCommit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		files   map[string]string
+		want    *CommitInfo
+		wantErr string
+	}{
+		{
+			name:  "success",
+			files: abctestutil.WithGitRepoAt("", nil),
+			want: &CommitInfo{
+				Time:        time.Date(2023, 12, 14, 23, 53, 4, 0, time.UTC),
+				AuthorName:  abctestutil.MinimalGitHeadAuthorName,
+				AuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+			},
+		},
+		{
+			name:    "not_git_repo_error",
+			wantErr: "not a git repository",
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			tmpDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tmpDir, tc.files)
+
+			got, err := CurrentCommit(ctx, tmpDir)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("commit wasn't as expected (-got,+want): %s", diff)
+			}
+			if got != nil && got.Time.Format(time.RFC3339) != abctestutil.MinimalGitHeadCommitTime {
+				t.Errorf("got commit time %s, want %s", got.Time.Format(time.RFC3339), abctestutil.MinimalGitHeadCommitTime)
+			}
+		})
+	}
+}
+
+func TestWorkspaceAndRepo(t *testing.T) {
+	t.Parallel()
+
+	files := abctestutil.WithGitRepoAt("main",
+		abctestutil.WithGitWorktreeAt("main", "wt",
+			abctestutil.WithGitSubmoduleAt("main", "sub/mod", nil)))
+
+	cases := []struct {
+		name          string
+		path          string
+		wantWorkspace string
+		wantRepo      string
+		wantOK        bool
+	}{
+		{
+			name:          "main_checkout",
+			path:          "main/a/b",
+			wantWorkspace: "main",
+			wantRepo:      "main",
+			wantOK:        true,
+		},
+		{
+			name:          "linked_worktree",
+			path:          "wt/a",
+			wantWorkspace: "wt",
+			wantRepo:      "wt",
+			wantOK:        true,
+		},
+		{
+			name:          "submodule",
+			path:          "main/sub/mod/a",
+			wantWorkspace: "main",
+			wantRepo:      "main/sub/mod",
+			wantOK:        true,
+		},
+		{
+			name: "not_git",
+			path: "other",
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tmpDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, tmpDir, files)
+
+			rel := func(p string) string {
+				if p == "" {
+					return ""
+				}
+				out, err := filepath.Rel(tmpDir, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return filepath.ToSlash(out)
+			}
+
+			path := filepath.Join(tmpDir, tc.path)
+			ws, ok, err := Workspace(ctx, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.wantOK || rel(ws) != tc.wantWorkspace {
+				t.Errorf("Workspace() got (%q, %t), want (%q, %t)", rel(ws), ok, tc.wantWorkspace, tc.wantOK)
+			}
+			repo, ok, err := Repo(ctx, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.wantOK || rel(repo) != tc.wantRepo {
+				t.Errorf("Repo() got (%q, %t), want (%q, %t)", rel(repo), ok, tc.wantRepo, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestRemoteTagsAndClone_FakeRemote(t *testing.T) {
+	t.Parallel()
+
+	remote := abctestutil.NewFakeGitRemote(t)
+	v1SHA := remote.Commit(t, "v1", map[string]string{"README.md": "v1"})
+	remote.Tag(t, "v0.1.0", v1SHA)
+	remote.Tag(t, "not-semver", v1SHA)
+	v2SHA := remote.Commit(t, "v2", map[string]string{"README.md": "v2"})
+	remote.AnnotatedTag(t, "v0.2.0", v2SHA)
+
+	ctx := context.Background()
+	tags, err := RemoteTags(ctx, remote.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(tags)
+	if diff := cmp.Diff(tags, []string{"not-semver", "v0.1.0", "v0.2.0"}); diff != "" {
+		t.Errorf("tags were not as expected (-got,+want): %s", diff)
+	}
+
+	refs, err := RemoteRefs(ctx, remote.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(refs, func(a, b *Ref) int { return strings.Compare(a.Name, b.Name) })
+	wantRefs := []*Ref{
+		{Name: "refs/heads/" + abctestutil.FakeGitRemoteBranch, SHA: v2SHA},
+		{Name: "refs/tags/not-semver", SHA: v1SHA},
+		{Name: "refs/tags/v0.1.0", SHA: v1SHA},
+		{Name: "refs/tags/v0.2.0", SHA: v2SHA}, // the commit, not the annotated tag
+	}
+	if diff := cmp.Diff(refs, wantRefs); diff != "" {
+		t.Errorf("refs were not as expected (-got,+want): %s", diff)
+	}
+
+	cases := []struct {
+		name     string
+		version  string
+		wantFile string
+		wantTags []string
+		wantErr  string
+	}{
+		{
+			name:     "tag",
+			version:  "v0.1.0",
+			wantFile: "v1",
+		},
+		{
+			name:     "branch",
+			version:  abctestutil.FakeGitRemoteBranch,
+			wantFile: "v2",
+		},
+		{
+			name:     "long_commit",
+			version:  v1SHA,
+			wantFile: "v1",
+			// Only the commit is fetched, but with the tags that point to it.
+			wantTags: []string{"not-semver", "v0.1.0"},
+		},
+		{
+			name:     "long_commit_annotated_tag",
+			version:  v2SHA,
+			wantFile: "v2",
+			wantTags: []string{"v0.2.0"},
+		},
+		{
+			name:    "nonexistent_commit",
+			version: "0123456789012345678901234567890123456789",
+			wantErr: "0123456789012345678901234567890123456789",
+		},
+		{
+			name:    "nonexistent_tag",
+			version: "v9.9.9",
+			wantErr: "v9.9.9 not found",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			outDir := t.TempDir()
+			err := Clone(ctx, remote.URL, tc.version, outDir)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+			got, err := os.ReadFile(filepath.Join(outDir, "README.md"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.wantFile {
+				t.Errorf("got README.md %q, want %q", got, tc.wantFile)
+			}
+			if tc.wantTags != nil {
+				gotTags, err := HeadTags(ctx, outDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				slices.Sort(gotTags)
+				if diff := cmp.Diff(gotTags, tc.wantTags); diff != "" {
+					t.Errorf("tags at HEAD were not as expected (-got,+want): %s", diff)
+				}
+			}
+		})
+	}
+}
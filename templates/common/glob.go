@@ -0,0 +1,243 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// doubleStar is the path element that matches zero or more path elements.
+const doubleStar = "**"
+
+// Glob is like filepath.Glob, except that it looks for matching files in the
+// given FS rather than always using the real filesystem. Paths use OS-native
+// separators, and the pattern syntax is that of MatchGlob, so a "**" path
+// element matches any number of directories. Unlike filepath.Glob, filesystem
+// errors other than "doesn't exist" are returned rather than ignored.
+//
+// When a "**" pattern matches a directory, the files under it aren't returned
+// separately, since they're already included in the directory.
+//
+// The matches are in lexical order, comparing one path element at a time, on
+// every FS. Renders rely on this to be deterministic.
+func Glob(fsys FS, pattern string) ([]string, error) {
+	return glob(fsys, pattern, true)
+}
+
+// GlobSingleStar is like Glob, except that the pattern syntax is exactly that
+// of filepath.Match, so "**" is the same as "*". This is the behavior of older
+// spec api_versions.
+func GlobSingleStar(fsys FS, pattern string) ([]string, error) {
+	return glob(fsys, pattern, false)
+}
+
+// glob implements Glob and GlobSingleStar.
+func glob(fsys FS, pattern string, doubleStars bool) ([]string, error) {
+	if doubleStars {
+		if err := ValidateGlob(pattern); err != nil {
+			return nil, err
+		}
+		if hasDoubleStar(pattern) {
+			return globDoubleStar(fsys, pattern)
+		}
+	} else if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if !hasGlobMeta(pattern) {
+		if _, err := fsys.Stat(pattern); err != nil {
+			if IsStatNotExistErr(err) {
+				return nil, nil
+			}
+			return nil, err //nolint:wrapcheck
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := filepath.Split(pattern)
+	dir = cleanGlobPath(dir)
+
+	if !hasGlobMeta(dir) {
+		return globDir(fsys, dir, file, nil)
+	}
+
+	// Prevent infinite recursion.
+	if dir == pattern {
+		return nil, filepath.ErrBadPattern
+	}
+
+	dirMatches, err := glob(fsys, dir, doubleStars)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, d := range dirMatches {
+		if out, err = globDir(fsys, d, file, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// globDir appends to matches the entries of dir whose names match pattern.
+func globDir(fsys FS, dir, pattern string, matches []string) ([]string, error) {
+	fi, err := fsys.Stat(dir)
+	if err != nil {
+		if IsStatNotExistErr(err) {
+			return matches, nil
+		}
+		return nil, err //nolint:wrapcheck
+	}
+	if !fi.IsDir() {
+		return matches, nil
+	}
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	for _, e := range entries {
+		matched, err := filepath.Match(pattern, e.Name())
+		if err != nil {
+			return matches, err //nolint:wrapcheck
+		}
+		if matched {
+			matches = append(matches, filepath.Join(dir, e.Name()))
+		}
+	}
+	return matches, nil
+}
+
+// cleanGlobPath prepares a directory path for use by Glob, the same way as
+// filepath.Glob does.
+func cleanGlobPath(path string) string {
+	switch path {
+	case "":
+		return "."
+	case string(filepath.Separator):
+		return path
+	default:
+		return path[0 : len(path)-1] // chop off trailing separator
+	}
+}
+
+// hasGlobMeta reports whether path contains any of the magic characters
+// recognized by filepath.Match.
+func hasGlobMeta(path string) bool {
+	magicChars := `*?[`
+	if filepath.Separator != '\\' {
+		magicChars = `*?[\`
+	}
+	return strings.ContainsAny(path, magicChars)
+}
+
+// ValidateGlob returns an error if pattern isn't a well-formed pattern for
+// MatchGlob. Besides the syntax of filepath.Match, "**" may only be used as a
+// whole path element, like "src/**/*.go", and not like "src/a**".
+func ValidateGlob(pattern string) error {
+	for _, elem := range splitPath(pattern) {
+		if _, err := filepath.Match(elem, ""); err != nil {
+			return err //nolint:wrapcheck
+		}
+		if elem != doubleStar && strings.Contains(elem, doubleStar) {
+			return fmt.Errorf(`%q can only be used as a whole path element, like "a/**/b", in %q: %w`,
+				doubleStar, pattern, filepath.ErrBadPattern)
+		}
+	}
+	return nil
+}
+
+// MatchGlob reports whether name matches pattern. It's like filepath.Match,
+// except that a "**" path element matches zero or more path elements, so
+// "**/*.go" matches "a.go" and "x/y/a.go". Both name and pattern use OS-native
+// separators.
+func MatchGlob(pattern, name string) (bool, error) {
+	if err := ValidateGlob(pattern); err != nil {
+		return false, err
+	}
+	return matchElems(splitPath(pattern), splitPath(name)), nil
+}
+
+// matchElems matches the path elements of a name against the path elements of
+// a pattern that's known to be well-formed.
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == doubleStar {
+			// Try matching the rest of the pattern against every suffix of
+			// name, including the empty one.
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// globDoubleStar is Glob for a pattern containing "**". It walks the directory
+// named by the part of the pattern before the first element containing any
+// glob metacharacters, and matches every path under it against the pattern.
+func globDoubleStar(fsys FS, pattern string) ([]string, error) {
+	elems := splitPath(pattern)
+	root := pattern
+	for hasGlobMeta(root) {
+		root = filepath.Dir(root)
+	}
+
+	var out []string
+	err := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && IsStatNotExistErr(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if !matchElems(elems, splitPath(path)) {
+			return nil
+		}
+		out = append(out, path)
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return out, nil
+}
+
+// hasDoubleStar reports whether the pattern has a "**" path element.
+func hasDoubleStar(pattern string) bool {
+	return slices.Contains(splitPath(pattern), doubleStar)
+}
+
+// splitPath splits a path into its elements, ignoring empty elements.
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool {
+		return r == filepath.Separator
+	})
+}
@@ -0,0 +1,255 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestGlob(t *testing.T) {
+	t.Parallel()
+
+	files := []string{
+		"a.txt",
+		"b.md",
+		"dir1/c.txt",
+		"dir1/d.md",
+		"dir2/e.txt",
+		"dir2/sub/f.txt",
+	}
+
+	cases := []struct {
+		name    string
+		pattern string
+	}{
+		{name: "no_meta_exists", pattern: "a.txt"},
+		{name: "no_meta_missing", pattern: "nope.txt"},
+		{name: "star_in_base", pattern: "*.txt"},
+		{name: "star_in_dir", pattern: "dir*/*.txt"},
+		{name: "question_mark", pattern: "dir?/c.txt"},
+		{name: "char_class", pattern: "[ab].*"},
+		{name: "no_matches", pattern: "*.go"},
+		{name: "nested", pattern: "*/*/*.txt"},
+	}
+
+	realRoot := t.TempDir()
+	memFS := &MemFS{}
+	for _, f := range files {
+		for _, fsys := range []FS{&RealFS{}, memFS} {
+			root := realRoot
+			if fsys == memFS {
+				root = "/mem"
+			}
+			path := filepath.Join(root, filepath.FromSlash(f))
+			if err := fsys.MkdirAll(filepath.Dir(path), OwnerRWXPerms); err != nil {
+				t.Fatal(err)
+			}
+			if err := fsys.WriteFile(path, []byte{}, OwnerRWPerms); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The real filesystem results from filepath.Glob are the
+			// source of truth.
+			want, err := filepath.Glob(filepath.Join(realRoot, tc.pattern))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = relAll(t, realRoot, want)
+
+			gotReal, err := Glob(&RealFS{}, filepath.Join(realRoot, tc.pattern))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(relAll(t, realRoot, gotReal), want); diff != "" {
+				t.Errorf("Glob on RealFS was not as expected (-got,+want): %s", diff)
+			}
+
+			gotMem, err := Glob(memFS, filepath.Join("/mem", tc.pattern))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(relAll(t, "/mem", gotMem), want); diff != "" {
+				t.Errorf("Glob on MemFS was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestGlob_BadPattern(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Glob(&MemFS{}, "/foo/[x"); err == nil {
+		t.Error("got no error for a malformed pattern, want an error")
+	}
+}
+
+func TestGlob_DoubleStar(t *testing.T) {
+	t.Parallel()
+
+	files := []string{
+		"a.go",
+		"b.md",
+		"dir1/c.go",
+		"dir1/gen/d.go",
+		"dir2/sub/e.go",
+		"dir2/sub/f.md",
+	}
+
+	cases := []struct {
+		name       string
+		pattern    string
+		singleStar bool // use GlobSingleStar
+		want       []string
+	}{
+		{
+			name:    "all_go_files",
+			pattern: "**/*.go",
+			want:    []string{"a.go", "dir1/c.go", "dir1/gen/d.go", "dir2/sub/e.go"},
+		},
+		{
+			name:    "under_dir",
+			pattern: "dir2/**/*.md",
+			want:    []string{"dir2/sub/f.md"},
+		},
+		{
+			name:    "middle",
+			pattern: "dir*/**/d.go",
+			want:    []string{"dir1/gen/d.go"},
+		},
+		{
+			// The directory itself matches, so what's under it isn't
+			// returned separately.
+			name:    "trailing",
+			pattern: "dir1/**",
+			want:    []string{"dir1"},
+		},
+		{
+			name:    "matching_dir",
+			pattern: "**/gen",
+			want:    []string{"dir1/gen"},
+		},
+		{
+			name:    "missing_root",
+			pattern: "nope/**/*.go",
+		},
+		{
+			// Older api_versions treat "**" as "*", matching a single
+			// path element.
+			name:       "single_star",
+			pattern:    "**/*.go",
+			singleStar: true,
+			want:       []string{"dir1/c.go"},
+		},
+		{
+			name:       "single_star_within_element",
+			pattern:    "dir1/g**",
+			singleStar: true,
+			want:       []string{"dir1/gen"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			memFS := &MemFS{}
+			for _, f := range files {
+				path := filepath.Join("/mem", filepath.FromSlash(f))
+				if err := memFS.MkdirAll(filepath.Dir(path), OwnerRWXPerms); err != nil {
+					t.Fatal(err)
+				}
+				if err := memFS.WriteFile(path, []byte{}, OwnerRWPerms); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			glob := Glob
+			if tc.singleStar {
+				glob = GlobSingleStar
+			}
+			got, err := glob(memFS, filepath.Join("/mem", filepath.FromSlash(tc.pattern)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(relAll(t, "/mem", got), tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Glob was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		pattern string
+		name    string
+		want    bool
+		wantErr string
+	}{
+		{pattern: "*.go", name: "a.go", want: true},
+		{pattern: "*.go", name: "x/a.go", want: false},
+		{pattern: "**/*.go", name: "a.go", want: true},
+		{pattern: "**/*.go", name: "x/y/a.go", want: true},
+		{pattern: "x/**", name: "x", want: true},
+		{pattern: "x/**", name: "x/y/z", want: true},
+		{pattern: "x/**/z", name: "x/z", want: true},
+		{pattern: "x/**/z", name: "x/y/w/z", want: true},
+		{pattern: "x/**/z", name: "x/y/w", want: false},
+		{pattern: "**", name: "anything/at/all", want: true},
+		{pattern: "x/a**", name: "x/ab", wantErr: "whole path element"},
+		{pattern: "[x", name: "x", wantErr: "syntax error in pattern"},
+	}
+
+	for _, tc := range cases {
+		got, err := MatchGlob(filepath.FromSlash(tc.pattern), filepath.FromSlash(tc.name))
+		if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+			t.Errorf("MatchGlob(%q, %q): %s", tc.pattern, tc.name, diff)
+		}
+		if got != tc.want {
+			t.Errorf("MatchGlob(%q, %q) = %t, want %t", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
+
+func relAll(tb testing.TB, root string, paths []string) []string {
+	tb.Helper()
+
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		out = append(out, filepath.ToSlash(rel))
+	}
+	return out
+}
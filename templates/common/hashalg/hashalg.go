@@ -0,0 +1,197 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hashalg has the hash algorithms that manifests and vendor indexes
+// can use for their template_dirhash and output_hashes.
+//
+// Every hash is written with the algorithm that made it, as a prefix like the
+// "h1:" of "h1:0a1b2c3d...". Code that checks a hash uses the algorithm named
+// by the hash, rather than the one that abc would choose today, so that the
+// default can change without invalidating the manifests that already exist,
+// and one manifest can mix algorithms.
+package hashalg
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Algorithm is a hash algorithm that abc can record hashes with.
+type Algorithm struct {
+	// Name is what the user calls the algorithm, as in --hash-algorithm.
+	Name string
+
+	// Prefix is what's before the ":" in the hashes that the algorithm
+	// makes. It must not change once hashes have been written with it.
+	Prefix string
+
+	// New returns a new hash.Hash that computes the algorithm.
+	New func() hash.Hash
+}
+
+var (
+	// SHA256 is the algorithm that abc has always used. Its "h1" prefix and
+	// its directory hashes are the same as golang.org/x/mod/sumdb/dirhash.Hash1.
+	SHA256 = &Algorithm{Name: "sha256", Prefix: "h1", New: sha256.New}
+
+	// SHA512 is SHA-512, for users whose policies require it.
+	SHA512 = &Algorithm{Name: "sha512", Prefix: "sha512", New: sha512.New}
+
+	// Default is the algorithm for new hashes, unless the user asks for
+	// another one.
+	Default = SHA256
+)
+
+var (
+	mu       sync.RWMutex
+	byName   = map[string]*Algorithm{}
+	byPrefix = map[string]*Algorithm{}
+)
+
+func init() {
+	Register(SHA256)
+	Register(SHA512)
+}
+
+// Register adds an algorithm, like BLAKE3 from a third-party package, so it
+// can be chosen by name and its hashes can be verified. It panics if the name
+// or the prefix is already taken, so it should be called from an init
+// function.
+func Register(a *Algorithm) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if a.Name == "" || a.Prefix == "" || a.New == nil {
+		panic("hashalg: Register of an incomplete Algorithm")
+	}
+	if strings.Contains(a.Prefix, ":") {
+		panic(fmt.Sprintf("hashalg: the prefix %q contains a colon", a.Prefix))
+	}
+	if _, ok := byName[a.Name]; ok {
+		panic(fmt.Sprintf("hashalg: the algorithm %q is already registered", a.Name))
+	}
+	if _, ok := byPrefix[a.Prefix]; ok {
+		panic(fmt.Sprintf("hashalg: the prefix %q is already registered", a.Prefix))
+	}
+	byName[a.Name] = a
+	byPrefix[a.Prefix] = a
+}
+
+// Names returns the names of the registered algorithms, in sorted order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	out := make([]string, 0, len(byName))
+	for name := range byName {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ByName returns the algorithm with the given name. The empty name is the
+// Default.
+func ByName(name string) (*Algorithm, error) {
+	if name == "" {
+		return Default, nil
+	}
+	mu.RLock()
+	a, ok := byName[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm %q, the known ones are %s", name, strings.Join(Names(), ", "))
+	}
+	return a, nil
+}
+
+// Of returns the algorithm that made the hash h, according to its prefix.
+func Of(h string) (*Algorithm, error) {
+	prefix, _, ok := strings.Cut(h, ":")
+	if !ok {
+		return nil, fmt.Errorf("the hash %q doesn't start with the name of an algorithm, like \"h1:\"", h)
+	}
+	mu.RLock()
+	a, ok := byPrefix[prefix]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("the hash %q was made with an unknown algorithm %q; this version of abc may be too old to read it", h, prefix)
+	}
+	return a, nil
+}
+
+// Format returns sum, which was computed with a, in the format of manifests,
+// like "h1:0a1b2c3d...".
+func (a *Algorithm) Format(sum []byte) string {
+	return a.Prefix + ":" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// Sum returns the formatted hash of buf.
+func (a *Algorithm) Sum(buf []byte) string {
+	h := a.New()
+	h.Write(buf) // a hash.Hash never returns an error
+	return a.Format(h.Sum(nil))
+}
+
+// HashFiles returns the formatted hash of a list of files, which open reads.
+// The files are hashed the same way as by dirhash.Hash1, except with a
+// rather than always SHA-256: the hash of a summary with a line for each file
+// in sorted order, holding the hex hash of its contents and its name.
+func (a *Algorithm) HashFiles(files []string, open func(string) (io.ReadCloser, error)) (string, error) {
+	files = append([]string(nil), files...)
+	sort.Strings(files)
+
+	summary := a.New()
+	for _, file := range files {
+		if strings.Contains(file, "\n") {
+			return "", fmt.Errorf("filenames with newlines are not supported: %q", file)
+		}
+		sum, err := a.hashFile(file, open)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", sum, file)
+	}
+	return a.Format(summary.Sum(nil)), nil
+}
+
+func (a *Algorithm) hashFile(file string, open func(string) (io.ReadCloser, error)) ([]byte, error) {
+	r, err := open(file)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer r.Close()
+	h := a.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("failed reading %q: %w", file, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// Verify reports whether want is the hash of buf, using the algorithm that
+// made want.
+func Verify(want string, buf []byte) (bool, error) {
+	a, err := Of(want)
+	if err != nil {
+		return false, err
+	}
+	return a.Sum(buf) == want, nil
+}
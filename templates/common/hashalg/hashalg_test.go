@@ -0,0 +1,159 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashalg
+
+import (
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb/dirhash"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestHashFiles(t *testing.T) {
+	t.Parallel()
+
+	contents := map[string]string{
+		"spec.yaml":   "kind: Template\n",
+		"a/b.txt":     "hello",
+		"a/empty.txt": "",
+	}
+	files := []string{"spec.yaml", "a/empty.txt", "a/b.txt"}
+	open := func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(contents[name])), nil
+	}
+
+	want, err := dirhash.Hash1(files, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := SHA256.HashFiles(files, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("SHA256.HashFiles() = %s, want %s, the same as dirhash.Hash1", got, want)
+	}
+
+	got512, err := SHA512.HashFiles(files, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got512, "sha512:") {
+		t.Errorf("SHA512.HashFiles() = %s, want a sha512: prefix", got512)
+	}
+	if a, err := Of(got512); err != nil || a != SHA512 {
+		t.Errorf("Of(%s) = %v, %v, want SHA512", got512, a, err)
+	}
+
+	if _, err := SHA256.HashFiles([]string{"a\nb"}, open); err == nil {
+		t.Error("HashFiles() with a newline in a filename succeeded, want an error")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	sum := sha256.Sum256([]byte("hello"))
+	h1 := SHA256.Format(sum[:])
+
+	cases := []struct {
+		name    string
+		want    string
+		buf     string
+		wantOK  bool
+		wantErr string
+	}{
+		{
+			name:   "sha256_match",
+			want:   h1,
+			buf:    "hello",
+			wantOK: true,
+		},
+		{
+			name: "sha256_mismatch",
+			want: h1,
+			buf:  "goodbye",
+		},
+		{
+			name:   "sha512_match",
+			want:   SHA512.Sum([]byte("hello")),
+			buf:    "hello",
+			wantOK: true,
+		},
+		{
+			name:    "unknown_algorithm",
+			want:    "md5:XUFAKrxLKna5cZ2REBfFkg==",
+			buf:     "hello",
+			wantErr: `unknown algorithm "md5"`,
+		},
+		{
+			name:    "no_prefix",
+			want:    "XUFAKrxLKna5cZ2REBfFkg==",
+			buf:     "hello",
+			wantErr: "doesn't start with the name of an algorithm",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ok, err := Verify(tc.want, []byte(tc.buf))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if ok != tc.wantOK {
+				t.Errorf("Verify() = %t, want %t", ok, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestByName(t *testing.T) {
+	t.Parallel()
+
+	for name, want := range map[string]*Algorithm{
+		"":       Default,
+		"sha256": SHA256,
+		"sha512": SHA512,
+	} {
+		got, err := ByName(name)
+		if err != nil || got != want {
+			t.Errorf("ByName(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+
+	_, err := ByName("blake3")
+	if diff := testutil.DiffErrString(err, `unknown hash algorithm "blake3", the known ones are sha256, sha512`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Register() with a taken prefix didn't panic")
+		}
+	}()
+	Register(&Algorithm{Name: "other", Prefix: "h1", New: sha256.New})
+}
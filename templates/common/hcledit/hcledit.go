@@ -0,0 +1,336 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hcledit makes targeted edits to files in the HCL native syntax, like
+// Terraform .tf files. Files are parsed and written with hclwrite, which keeps
+// the original tokens, so formatting and comments outside the edited attribute
+// are preserved exactly. New attributes and blocks are indented to match their
+// surroundings.
+package hcledit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// indentWidth is the number of spaces that a block's contents are indented by
+// relative to its header, if there's nothing in the block to copy it from.
+const indentWidth = 2
+
+// Block identifies a block by its type and labels, like the block
+// `resource "google_project" "main" { ... }`.
+type Block struct {
+	Type   string
+	Labels []string
+}
+
+// String returns the block header in HCL syntax, without the opening brace.
+func (b *Block) String() string {
+	var sb strings.Builder
+	sb.WriteString(b.Type)
+	for _, l := range b.Labels {
+		sb.WriteString(" ")
+		sb.WriteString(strconv.Quote(l))
+	}
+	return sb.String()
+}
+
+// ParseBlock parses a block header in HCL syntax, like
+// `resource "google_project" "main"` or `terraform`.
+func ParseBlock(header string) (*Block, error) {
+	tokens, diags := hclsyntax.LexConfig([]byte(header), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid block header %q: %w", header, diags)
+	}
+	if len(tokens) == 0 || tokens[0].Type != hclsyntax.TokenIdent {
+		return nil, fmt.Errorf("invalid block header %q: must start with a block type", header)
+	}
+	for _, tok := range tokens[1:] {
+		switch tok.Type {
+		case hclsyntax.TokenIdent, hclsyntax.TokenOQuote, hclsyntax.TokenQuotedLit, hclsyntax.TokenCQuote, hclsyntax.TokenEOF:
+		default:
+			return nil, fmt.Errorf("invalid block header %q: unexpected %q", header, strings.TrimSpace(header[tok.Range.Start.Byte:]))
+		}
+	}
+
+	// Let the HCL parser unquote the labels by parsing an empty block.
+	f, diags := hclsyntax.ParseConfig([]byte(header+" {\n}\n"), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid block header %q: %w", header, diags)
+	}
+	blocks := f.Body.(*hclsyntax.Body).Blocks //nolint:forcetypeassert // always true for ParseConfig
+	if len(blocks) != 1 {
+		return nil, fmt.Errorf("invalid block header %q", header)
+	}
+	return &Block{Type: blocks[0].Type, Labels: blocks[0].Labels}, nil
+}
+
+// Validate checks that src is valid HCL native syntax.
+func Validate(src []byte) error {
+	_, err := parse(src)
+	return err
+}
+
+// SetAttribute sets the attribute called name, inside the block found by
+// following path from the top level of the file, to the given HCL expression.
+// An existing attribute keeps its position and only its expression is
+// replaced; a new attribute is added at the end of the block. If createBlocks
+// is true, blocks in path that don't exist are created at the end of their
+// parent; otherwise it's an error if they don't exist.
+func SetAttribute(src []byte, path []*Block, name, expr string, createBlocks bool) ([]byte, error) {
+	if !hclsyntax.ValidIdentifier(name) {
+		return nil, fmt.Errorf("invalid attribute name %q", name)
+	}
+	exprTokens, err := exprTokens(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for attribute %q: %w", name, err)
+	}
+
+	f, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	b, err := resolve(f, path, createBlocks)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.body.GetAttribute(name) != nil {
+		b.body.SetAttributeRaw(name, exprTokens)
+		return bytesOf(f), nil
+	}
+	b.prepareAppend()
+	b.body.SetAttributeRaw(name, exprTokens)
+	space(b.body.GetAttribute(name).BuildTokens(nil), b.indent)
+	return bytesOf(f), nil
+}
+
+// RemoveAttribute removes the attribute called name from the block found by
+// following path, along with its comments. It's not an error if the attribute
+// doesn't exist, but it is an error if the block doesn't exist.
+func RemoveAttribute(src []byte, path []*Block, name string) ([]byte, error) {
+	f, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	b, err := resolve(f, path, false)
+	if err != nil {
+		return nil, err
+	}
+	if b.body.RemoveAttribute(name) == nil {
+		return src, nil
+	}
+	return bytesOf(f), nil
+}
+
+// EnsureBlock creates every block in path that doesn't already exist.
+func EnsureBlock(src []byte, path []*Block) ([]byte, error) {
+	f, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolve(f, path, true); err != nil {
+		return nil, err
+	}
+	return bytesOf(f), nil
+}
+
+// bytesOf returns the source code of f. Unlike f.Bytes, it doesn't reformat
+// the whole file like "terraform fmt", so the parts that weren't edited keep
+// their formatting.
+func bytesOf(f *hclwrite.File) []byte {
+	return f.BuildTokens(nil).Bytes()
+}
+
+func parse(src []byte) (*hclwrite.File, error) {
+	f, diags := hclwrite.ParseConfig(src, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return f, nil
+}
+
+// exprTokens returns the tokens of the HCL expression expr, as they'd be
+// written after "=" in an attribute.
+func exprTokens(expr string) (hclwrite.Tokens, error) {
+	if _, diags := hclsyntax.ParseExpression([]byte(expr), "", hcl.InitialPos); diags.HasErrors() {
+		return nil, diags
+	}
+	f, diags := hclwrite.ParseConfig([]byte("x = "+expr+"\n"), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	attr := f.Body().GetAttribute("x")
+	if attr == nil {
+		return nil, fmt.Errorf("%q isn't a single expression", expr)
+	}
+	return attr.Expr().BuildTokens(nil), nil
+}
+
+// body is a block body, or the whole file, along with the indentation of its
+// contents.
+type body struct {
+	body *hclwrite.Body
+
+	// indent is the number of spaces before each item in the body.
+	indent int
+
+	// inBlock is whether the body is a block's, rather than the whole file's,
+	// and openLine is whether the block's opening brace isn't followed by a
+	// newline yet, like in "x {}".
+	inBlock, openLine bool
+}
+
+// resolve finds the body of the block at the end of path, creating missing
+// blocks if create is true.
+func resolve(f *hclwrite.File, path []*Block, create bool) (*body, error) {
+	b := &body{body: f.Body()}
+	for i, want := range path {
+		var matches []*hclwrite.Block
+		for _, blk := range b.body.Blocks() {
+			if blk.Type() == want.Type && equalLabels(blk.Labels(), want.Labels) {
+				matches = append(matches, blk)
+			}
+		}
+
+		var blk *hclwrite.Block
+		switch len(matches) {
+		case 0:
+			if !create {
+				return nil, fmt.Errorf("block %q not found", pathString(path[:i+1]))
+			}
+			// Separate the new block from what's before it by a blank line.
+			separate := !isEmpty(b.body)
+			b.prepareAppend()
+			if separate {
+				b.body.AppendNewline()
+			}
+			blk = b.body.AppendNewBlock(want.Type, want.Labels)
+			tokens := blk.BuildTokens(nil)
+			space(tokens, b.indent)
+			tokens[len(tokens)-2].SpacesBefore = b.indent // the closing brace
+		case 1:
+			blk = matches[0]
+		default:
+			return nil, fmt.Errorf("block %q is ambiguous, there are %d blocks with that type and labels",
+				pathString(path[:i+1]), len(matches))
+		}
+		b = &body{
+			body:     blk.Body(),
+			indent:   contentIndent(blk.Body(), b.indent),
+			inBlock:  true,
+			openLine: openLine(blk),
+		}
+	}
+	return b, nil
+}
+
+// contentIndent returns the indentation of the first line in a block body, or
+// the default if the body is empty. parentIndent is that of the block header.
+func contentIndent(b *hclwrite.Body, parentIndent int) int {
+	afterNewline := false
+	for _, tok := range b.BuildTokens(nil) {
+		if tok.Type == hclsyntax.TokenNewline {
+			afterNewline = true
+			continue
+		}
+		if afterNewline {
+			return tok.SpacesBefore
+		}
+	}
+	return parentIndent + indentWidth
+}
+
+// space sets the spaces before the tokens of a new attribute name or block
+// header, which hclwrite creates without any. The first token is indented by
+// indent, and the tokens that start a label, the "=", and the opening brace
+// get a single space before them. The expression after the "=" already has
+// the spacing it was written with.
+func space(tokens hclwrite.Tokens, indent int) {
+	tokens[0].SpacesBefore = indent
+	for _, tok := range tokens[1:] {
+		switch tok.Type {
+		case hclsyntax.TokenIdent, hclsyntax.TokenOQuote:
+			tok.SpacesBefore = 1
+		case hclsyntax.TokenEqual, hclsyntax.TokenOBrace:
+			tok.SpacesBefore = 1
+			return
+		}
+	}
+}
+
+// openLine returns whether blk's opening brace isn't followed by a newline,
+// like in "x {}".
+func openLine(blk *hclwrite.Block) bool {
+	tokens := blk.BuildTokens(nil)
+	for i, tok := range tokens {
+		if tok.Type == hclsyntax.TokenOBrace {
+			return i+1 < len(tokens) && tokens[i+1].Type != hclsyntax.TokenNewline
+		}
+	}
+	return false
+}
+
+// isEmpty returns whether b has nothing but whitespace in it.
+func isEmpty(b *hclwrite.Body) bool {
+	for _, tok := range b.BuildTokens(nil) {
+		if tok.Type != hclsyntax.TokenNewline {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareAppend makes sure that an item appended to the body starts on a new
+// line. hclwrite adds a newline at the end of each item it appends, but not
+// before it, so one is needed after the opening brace of a block like "x {}",
+// and at the end of a file that doesn't end with one.
+func (b *body) prepareAppend() {
+	if b.inBlock {
+		if b.openLine {
+			b.body.AppendNewline()
+			b.openLine = false
+		}
+		return
+	}
+	tokens := b.body.BuildTokens(nil)
+	if len(tokens) > 0 && tokens[len(tokens)-1].Type != hclsyntax.TokenNewline {
+		b.body.AppendNewline()
+	}
+}
+
+func equalLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func pathString(path []*Block) string {
+	parts := make([]string, 0, len(path))
+	for _, b := range path {
+		parts = append(parts, b.String())
+	}
+	return strings.Join(parts, " > ")
+}
@@ -0,0 +1,374 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcledit
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const mainTF = `# The project.
+terraform {
+  required_version = ">= 1.5"
+
+  required_providers {
+    google = {
+      source  = "hashicorp/google"
+      version = "~> 5.0" # pinned
+    }
+  }
+}
+
+module "vpc" {
+  source = "terraform-google-modules/network/google"
+  subnets = [
+    {
+      name = "a" // first
+    },
+  ]
+  description = <<-EOT
+    A VPC for ${var.name}.
+    }
+  EOT
+}
+
+resource "google_project" "main" {}
+`
+
+func mustParseBlocks(t *testing.T, headers ...string) []*Block {
+	t.Helper()
+	out := make([]*Block, 0, len(headers))
+	for _, h := range headers {
+		b, err := ParseBlock(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+func TestSetAttribute(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		src          string
+		path         []string
+		attr         string
+		expr         string
+		createBlocks bool
+		want         string
+		wantErr      string
+	}{
+		{
+			name: "replace_existing_keeps_comments",
+			src:  mainTF,
+			path: []string{"module \"vpc\""},
+			attr: "source",
+			expr: `"./modules/network"`,
+			want: `# The project.
+terraform {
+  required_version = ">= 1.5"
+
+  required_providers {
+    google = {
+      source  = "hashicorp/google"
+      version = "~> 5.0" # pinned
+    }
+  }
+}
+
+module "vpc" {
+  source = "./modules/network"
+  subnets = [
+    {
+      name = "a" // first
+    },
+  ]
+  description = <<-EOT
+    A VPC for ${var.name}.
+    }
+  EOT
+}
+
+resource "google_project" "main" {}
+`,
+		},
+		{
+			name: "add_after_last_attribute_after_heredoc",
+			src:  mainTF,
+			path: []string{"module \"vpc\""},
+			attr: "network_name",
+			expr: `var.network_name`,
+			want: `# The project.
+terraform {
+  required_version = ">= 1.5"
+
+  required_providers {
+    google = {
+      source  = "hashicorp/google"
+      version = "~> 5.0" # pinned
+    }
+  }
+}
+
+module "vpc" {
+  source = "terraform-google-modules/network/google"
+  subnets = [
+    {
+      name = "a" // first
+    },
+  ]
+  description = <<-EOT
+    A VPC for ${var.name}.
+    }
+  EOT
+  network_name = var.network_name
+}
+
+resource "google_project" "main" {}
+`,
+		},
+		{
+			name: "nested_block_multiline_value",
+			src:  mainTF,
+			path: []string{"terraform", "required_providers"},
+			attr: "random",
+			expr: "{\n      source = \"hashicorp/random\"\n    }",
+			want: `# The project.
+terraform {
+  required_version = ">= 1.5"
+
+  required_providers {
+    google = {
+      source  = "hashicorp/google"
+      version = "~> 5.0" # pinned
+    }
+    random = {
+      source = "hashicorp/random"
+    }
+  }
+}
+
+module "vpc" {
+  source = "terraform-google-modules/network/google"
+  subnets = [
+    {
+      name = "a" // first
+    },
+  ]
+  description = <<-EOT
+    A VPC for ${var.name}.
+    }
+  EOT
+}
+
+resource "google_project" "main" {}
+`,
+		},
+		{
+			name: "single_line_block_is_expanded",
+			src:  `resource "google_project" "main" {}` + "\n",
+			path: []string{`resource "google_project" "main"`},
+			attr: "name",
+			expr: `"my-project"`,
+			want: `resource "google_project" "main" {
+  name = "my-project"
+}
+`,
+		},
+		{
+			name:         "create_missing_blocks",
+			src:          "locals {\n  a = 1\n}\n",
+			path:         []string{"terraform", "backend \"gcs\""},
+			attr:         "bucket",
+			expr:         `"my-bucket"`,
+			createBlocks: true,
+			want: `locals {
+  a = 1
+}
+
+terraform {
+  backend "gcs" {
+    bucket = "my-bucket"
+  }
+}
+`,
+		},
+		{
+			name: "top_level_attribute",
+			src:  "project = \"a\"\n",
+			attr: "region",
+			expr: `"us-central1"`,
+			want: "project = \"a\"\nregion = \"us-central1\"\n",
+		},
+		{
+			name:    "missing_block",
+			src:     mainTF,
+			path:    []string{"terraform", "backend \"gcs\""},
+			attr:    "bucket",
+			expr:    `"b"`,
+			wantErr: `block "terraform > backend \"gcs\"" not found`,
+		},
+		{
+			name:    "ambiguous_block",
+			src:     "locals {}\nlocals {}\n",
+			path:    []string{"locals"},
+			attr:    "a",
+			expr:    "1",
+			wantErr: "is ambiguous",
+		},
+		{
+			name:    "invalid_expression",
+			src:     mainTF,
+			attr:    "a",
+			expr:    "[1, 2",
+			wantErr: `invalid value for attribute "a"`,
+		},
+		{
+			name:    "invalid_name",
+			src:     mainTF,
+			attr:    "1abc",
+			expr:    "1",
+			wantErr: `invalid attribute name "1abc"`,
+		},
+		{
+			name:    "unparseable_file",
+			src:     "terraform {\n  a = 1\n",
+			attr:    "a",
+			expr:    "1",
+			wantErr: "Unclosed configuration block",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := SetAttribute([]byte(tc.src), mustParseBlocks(t, tc.path...), tc.attr, tc.expr, tc.createBlocks)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(string(got), tc.want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+			if err := Validate(got); err != nil {
+				t.Errorf("output isn't valid: %v", err)
+			}
+		})
+	}
+}
+
+func TestRemoveAttribute(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		src     string
+		path    []string
+		attr    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "removes_line_and_trailing_comment",
+			src:  "a {\n  x = 1 # why\n  y = 2\n}\n",
+			path: []string{"a"},
+			attr: "x",
+			want: "a {\n  y = 2\n}\n",
+		},
+		{
+			name: "removes_multiline_value",
+			src:  "a {\n  x = [\n    1,\n  ]\n  y = 2\n}\n",
+			path: []string{"a"},
+			attr: "x",
+			want: "a {\n  y = 2\n}\n",
+		},
+		{
+			name: "missing_attribute_is_noop",
+			src:  "a {\n  y = 2\n}\n",
+			path: []string{"a"},
+			attr: "x",
+			want: "a {\n  y = 2\n}\n",
+		},
+		{
+			name:    "missing_block",
+			src:     "a {}\n",
+			path:    []string{"b"},
+			attr:    "x",
+			wantErr: `block "b" not found`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := RemoveAttribute([]byte(tc.src), mustParseBlocks(t, tc.path...), tc.attr)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(string(got), tc.want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestParseBlock(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		header  string
+		want    *Block
+		wantErr string
+	}{
+		{header: "terraform", want: &Block{Type: "terraform"}},
+		{header: `resource "google_project" "main"`, want: &Block{Type: "resource", Labels: []string{"google_project", "main"}}},
+		{header: `  module vpc `, want: &Block{Type: "module", Labels: []string{"vpc"}}},
+		{header: `"quoted"`, wantErr: "must start with a block type"},
+		{header: `module "vpc" {`, wantErr: `unexpected "{"`},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.header, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseBlock(tc.header)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("block was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// inferredDefault is a default input value that was guessed from a file in the
+// destination directory.
+type inferredDefault struct {
+	val string
+
+	// file is the file the value was read from, for showing to the user.
+	file string
+}
+
+// inferDefaults guesses the default values of the inputs that have an "infer"
+// block and weren't already provided by the user. Inference is best-effort:
+// if the file doesn't exist or doesn't contain the value, that input just isn't
+// inferred, and its regular default (if any) is used.
+func inferDefaults(ctx context.Context, rfs common.FS, destDir string, specInputs []*spec.Input, inputs map[string]string) map[string]*inferredDefault {
+	logger := logging.FromContext(ctx).With("logger", "inferDefaults")
+
+	out := make(map[string]*inferredDefault)
+	if destDir == "" {
+		return out
+	}
+	for _, i := range specInputs {
+		if i.Infer == nil {
+			continue
+		}
+		if _, ok := inputs[i.Name.Val]; ok {
+			continue
+		}
+		val, ok, err := infer(rfs, destDir, i.Infer)
+		if err != nil {
+			logger.WarnContext(ctx, "failed inferring the default value of an input",
+				"input", i.Name.Val,
+				"file", i.Infer.File.Val,
+				"error", err)
+			continue
+		}
+		if !ok {
+			logger.DebugContext(ctx, "couldn't infer the default value of an input",
+				"input", i.Name.Val,
+				"file", i.Infer.File.Val)
+			continue
+		}
+		logger.InfoContext(ctx, "inferred the default value of an input",
+			"input", i.Name.Val,
+			"file", i.Infer.File.Val,
+			"value", val)
+		out[i.Name.Val] = &inferredDefault{val: val, file: i.Infer.File.Val}
+	}
+	return out
+}
+
+// infer reads the file named by inf from destDir and extracts a value from it.
+// It returns false if the file doesn't exist or the value isn't in it.
+func infer(rfs common.FS, destDir string, inf *spec.Infer) (string, bool, error) {
+	path := filepath.Join(destDir, filepath.FromSlash(inf.File.Val))
+	buf, err := rfs.ReadFile(path)
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("ReadFile(): %w", err)
+	}
+
+	if inf.Regex.Val != "" {
+		re, err := regexp.Compile(inf.Regex.Val)
+		if err != nil {
+			return "", false, inf.Regex.Pos.Errorf("invalid infer regex: %w", err)
+		}
+		match := re.FindSubmatch(buf)
+		if match == nil {
+			return "", false, nil
+		}
+		if len(match) > 1 {
+			return string(match[1]), true, nil
+		}
+		return string(match[0]), true, nil
+	}
+
+	var doc any
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return "", false, fmt.Errorf("failed parsing %q as JSON or YAML: %w", inf.File.Val, err)
+	}
+	return lookupField(doc, strings.Split(inf.Field.Val, "."))
+}
+
+// lookupField follows the given keys through nested maps parsed from JSON or
+// YAML, and returns the scalar value at the end.
+func lookupField(doc any, keys []string) (string, bool, error) {
+	for _, key := range keys {
+		m, ok := doc.(map[string]any)
+		if !ok {
+			return "", false, nil
+		}
+		if doc, ok = m[key]; !ok {
+			return "", false, nil
+		}
+	}
+	switch doc.(type) {
+	case nil, map[string]any, []any:
+		return "", false, nil
+	default:
+		return fmt.Sprint(doc), true, nil
+	}
+}
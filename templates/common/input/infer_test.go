@@ -0,0 +1,211 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestInfer(t *testing.T) {
+	t.Parallel()
+
+	goMod := "module github.com/my/project\n\ngo 1.21\n"
+	packageJSON := `{"name": "my-project", "version": 3, "repository": {"url": "https://example.com/repo"}, "files": ["a"]}`
+
+	cases := []struct {
+		name         string
+		destContents map[string]string
+		infer        *spec.Infer
+		want         string
+		wantOK       bool
+		wantErr      string
+	}{
+		{
+			name:         "regex_with_group",
+			destContents: map[string]string{"go.mod": goMod},
+			infer: &spec.Infer{
+				File:  model.String{Val: "go.mod"},
+				Regex: model.String{Val: `(?m)^module\s+(\S+)`},
+			},
+			want:   "github.com/my/project",
+			wantOK: true,
+		},
+		{
+			name:         "regex_without_group",
+			destContents: map[string]string{"go.mod": goMod},
+			infer: &spec.Infer{
+				File:  model.String{Val: "go.mod"},
+				Regex: model.String{Val: `go \d+\.\d+`},
+			},
+			want:   "go 1.21",
+			wantOK: true,
+		},
+		{
+			name:         "regex_no_match",
+			destContents: map[string]string{"go.mod": goMod},
+			infer: &spec.Infer{
+				File:  model.String{Val: "go.mod"},
+				Regex: model.String{Val: `toolchain (\S+)`},
+			},
+		},
+		{
+			name:         "json_field",
+			destContents: map[string]string{"package.json": packageJSON},
+			infer: &spec.Infer{
+				File:  model.String{Val: "package.json"},
+				Field: model.String{Val: "name"},
+			},
+			want:   "my-project",
+			wantOK: true,
+		},
+		{
+			name:         "nested_json_field",
+			destContents: map[string]string{"package.json": packageJSON},
+			infer: &spec.Infer{
+				File:  model.String{Val: "package.json"},
+				Field: model.String{Val: "repository.url"},
+			},
+			want:   "https://example.com/repo",
+			wantOK: true,
+		},
+		{
+			name:         "number_field",
+			destContents: map[string]string{"package.json": packageJSON},
+			infer: &spec.Infer{
+				File:  model.String{Val: "package.json"},
+				Field: model.String{Val: "version"},
+			},
+			want:   "3",
+			wantOK: true,
+		},
+		{
+			name:         "yaml_field",
+			destContents: map[string]string{"config/app.yaml": "app:\n  name: my-app\n"},
+			infer: &spec.Infer{
+				File:  model.String{Val: "config/app.yaml"},
+				Field: model.String{Val: "app.name"},
+			},
+			want:   "my-app",
+			wantOK: true,
+		},
+		{
+			name:         "missing_field",
+			destContents: map[string]string{"package.json": packageJSON},
+			infer: &spec.Infer{
+				File:  model.String{Val: "package.json"},
+				Field: model.String{Val: "description"},
+			},
+		},
+		{
+			name:         "non_scalar_field",
+			destContents: map[string]string{"package.json": packageJSON},
+			infer: &spec.Infer{
+				File:  model.String{Val: "package.json"},
+				Field: model.String{Val: "files"},
+			},
+		},
+		{
+			name: "missing_file",
+			infer: &spec.Infer{
+				File:  model.String{Val: "package.json"},
+				Field: model.String{Val: "name"},
+			},
+		},
+		{
+			name:         "unparseable_file",
+			destContents: map[string]string{"package.json": "{not json"},
+			infer: &spec.Infer{
+				File:  model.String{Val: "package.json"},
+				Field: model.String{Val: "name"},
+			},
+			wantErr: `failed parsing "package.json" as JSON or YAML`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			destDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, destDir, tc.destContents)
+
+			got, ok, err := infer(&common.RealFS{}, destDir, tc.infer)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("infer() = (%q, %t), want (%q, %t)", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestResolve_Infer(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	destDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, destDir, map[string]string{
+		"package.json": `{"name": "my-project"}`,
+	})
+
+	inferName := &spec.Infer{
+		File:  model.String{Val: "package.json"},
+		Field: model.String{Val: "name"},
+	}
+	got, err := Resolve(ctx, &ResolveParams{
+		DestDir: destDir,
+		FS:      &common.RealFS{},
+		Inputs:  map[string]string{"provided": "from flag"},
+		Spec: &spec.Spec{
+			Inputs: []*spec.Input{
+				{Name: model.String{Val: "inferred"}, Infer: inferName},
+				{Name: model.String{Val: "provided"}, Infer: inferName},
+				{
+					Name:    model.String{Val: "not_inferred"},
+					Default: &model.String{Val: "spec default"},
+					Infer: &spec.Infer{
+						File:  model.String{Val: "go.mod"},
+						Regex: model.String{Val: `module (\S+)`},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"inferred":     "my-project",
+		"provided":     "from flag",
+		"not_inferred": "spec default",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("resolved inputs were not as expected (-got,+want): %s", diff)
+	}
+}
@@ -16,53 +16,119 @@ package input
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/mattn/go-isatty"
 	"golang.org/x/exp/maps"
 	"gopkg.in/yaml.v3"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/builtinvar"
+	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/common/rules"
+	"github.com/abcxyz/abc/templates/common/ui"
+	"github.com/abcxyz/abc/templates/model"
 	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/sets"
 )
 
+// StdinInputFile is the special --input-file value meaning "read the input file
+// from standard input".
+const StdinInputFile = "-"
+
 // ResolveParams are the parameters to Resolve(), wrapped in a struct because
 // there are so many.
 type ResolveParams struct {
 	FS common.FS
 
+	// DestDir is the destination directory of the render. It's where the
+	// files named by inputs' "infer" blocks are read from. If empty, no input
+	// defaults are inferred.
+	DestDir string
+
 	// The template spec.yaml model.
 	Spec *spec.Spec
 
 	// The value of --input. Template input values.
 	Inputs map[string]string
 
-	// The value of --input-file. A list of YAML filenames defining template inputs.
+	// The value of --input-file. A list of YAML filenames defining template
+	// inputs. The special filename "-" means to read from Stdin.
 	InputFiles []string
 
+	// Stdin is read when one of the InputFiles is "-". May be nil if no input
+	// file is "-".
+	Stdin io.Reader
+
 	// Prompt is the value of --prompt, it enables or disables the prompting feature.
 	Prompt bool
 
 	// Prompter is used to print prompts to the user requesting them to enter
 	// input.
-	Prompter            Prompter
+	Prompter Prompter
+
+	// InputPrompter, if non-nil, is used instead of Prompter to ask for
+	// missing inputs when Prompt is true, like through a web form. Standard
+	// input doesn't need to be a terminal when it's used.
+	InputPrompter InputPrompter
+
+	// PromptBatch asks the InputPrompter for all the missing inputs at once,
+	// rather than one at a time. It's ignored unless InputPrompter is set.
+	PromptBatch bool
+
+	// PromptTimeout is the value of --prompt-timeout. If it's nonzero, and a
+	// prompt isn't answered within it, Resolve fails rather than waiting
+	// forever, like in a CI job that nobody is watching.
+	PromptTimeout time.Duration
+
+	// AcceptDefaults is the value of --accept-defaults. The inputs that have
+	// a default aren't prompted for; their defaults are used, and only the
+	// inputs without one are prompted for. If none need to be, standard input
+	// doesn't have to be a terminal. A default_from expression that refers to
+	// an input that's prompted for is evaluated with the answer.
+	AcceptDefaults bool
+
+	// If OutAcceptedDefaults is not nil, and AcceptDefaults is true, the names
+	// of the inputs whose defaults were used because they weren't given are
+	// added to it once all the inputs are known.
+	OutAcceptedDefaults map[string]struct{}
+
 	SkipInputValidation bool
 
 	// Normally, we'll only prompt if the input is a TTY. For testing, this
 	// can be set to true to bypass the check and allow stdin to be something
 	// other than a TTY, like an os.Pipe.
 	SkipPromptTTYCheck bool
+
+	// Colors is used to highlight prompts. If nil, prompts aren't colored.
+	Colors *ui.Colors
+
+	// If OutInputs is not nil, the input values from flags, input files, and
+	// prompts are saved in it before they're validated. Unlike the return
+	// value of Resolve, it's filled in even if prompting fails partway
+	// through, so the caller can keep the answers that were already entered.
+	OutInputs map[string]string
+
+	// BuiltinVars are the underscore-prefixed builtin vars, like _git_tag,
+	// which are in scope when evaluating an input's default_from expression.
+	// If nil, every builtin var that's in scope for the spec's api_version is
+	// an empty string.
+	BuiltinVars map[string]string
 }
 
 // Prompter prints messages to the user asking them to enter a value. This is
-// implemented by *cli.Command.
+// implemented by *cli.Command. To prompt some other way, use an
+// InputPrompter.
 type Prompter interface {
 	Prompt(ctx context.Context, msg string, args ...any) (string, error)
 	Stdin() io.Reader
@@ -71,55 +137,181 @@ type Prompter interface {
 // Resolve combines flags, user prompts, and defaults to get the full set
 // of template inputs.
 func Resolve(ctx context.Context, rp *ResolveParams) (map[string]string, error) {
-	if badInputs := checkReservedInputs(rp.Inputs); len(badInputs) > 0 {
-		return nil, fmt.Errorf(`input names beginning with underscore cannot be overridden by a normal user input; the bad input names were: %v`, badInputs)
-	}
-
-	if unknownInputs := checkUnknownInputs(rp.Spec, rp.Inputs); len(unknownInputs) > 0 {
-		return nil, fmt.Errorf("unknown input(s): %s", strings.Join(unknownInputs, ", "))
-	}
-
-	fileInputs, err := loadInputFiles(ctx, rp.FS, rp.InputFiles)
+	inputs, fileOrigins, d, err := givenInputs(ctx, rp)
 	if err != nil {
 		return nil, err
 	}
-	// Effectively ignore inputs in file that are not in spec inputs, thereby ignoring them
-	knownFileInputs := filterUnknownInputs(rp.Spec, fileInputs)
 
-	// Order matters: values from --input take precedence over --input-file.
-	inputs := sets.UnionMapKeys(rp.Inputs, knownFileInputs)
+	// With --accept-defaults, there's nothing to prompt for if every input
+	// that wasn't given has a default, so standard input needn't be a
+	// terminal.
+	needPrompt := rp.Prompt
+	var accepted map[string]struct{}
+	if rp.AcceptDefaults {
+		accepted = make(map[string]struct{})
+		if rp.Prompt {
+			withDefaults := maps.Clone(inputs)
+			if _, err := insertDefaultInputs(ctx, rp.Spec, withDefaults, d); err != nil {
+				return nil, err
+			}
+			needPrompt = len(checkInputsMissing(rp.Spec, withDefaults)) > 0
+		}
+	}
 
-	if rp.Prompt {
-		if !rp.SkipPromptTTYCheck {
-			isATTY := (rp.Prompter.Stdin() == os.Stdin && isatty.IsTerminal(os.Stdin.Fd()))
-			if !isATTY {
-				return nil, fmt.Errorf("the flag --prompt was provided, but standard input is not a terminal")
+	if needPrompt {
+		prompter, batch := rp.InputPrompter, rp.PromptBatch
+		if prompter == nil {
+			if !rp.SkipPromptTTYCheck {
+				isATTY := (rp.Prompter.Stdin() == os.Stdin && isatty.IsTerminal(os.Stdin.Fd()))
+				if !isATTY {
+					return nil, fmt.Errorf("the flag --prompt was provided, but standard input is not a terminal")
+				}
 			}
+			prompter, batch = &terminalPrompter{prompter: rp.Prompter, colors: rp.Colors}, false
+		}
+		if rp.PromptTimeout > 0 {
+			prompter = &timeoutPrompter{prompter: prompter, timeout: rp.PromptTimeout}
 		}
 
-		if err := promptForInputs(ctx, rp.Prompter, rp.Spec, inputs); err != nil {
+		// promptForInputs adds each answer to inputs as it's entered, so the
+		// answers before a failure are kept.
+		err := promptForInputs(ctx, prompter, batch, rp.Spec, inputs, d, accepted)
+		if rp.OutInputs != nil {
+			maps.Copy(rp.OutInputs, inputs)
+		}
+		if err != nil {
 			return nil, err
 		}
 	} else {
-		insertDefaultInputs(rp.Spec, inputs)
+		added, err := insertDefaultInputs(ctx, rp.Spec, inputs, d)
+		if rp.OutInputs != nil {
+			maps.Copy(rp.OutInputs, inputs)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if accepted != nil {
+			for _, name := range added {
+				accepted[name] = struct{}{}
+			}
+		}
 		if missing := checkInputsMissing(rp.Spec, inputs); len(missing) > 0 {
-			return nil, fmt.Errorf("missing input(s): %s", strings.Join(missing, ", "))
+			return nil, errs.Wrap(errs.ErrInputValidation, fmt.Errorf("missing input(s): %s", strings.Join(missing, ", ")))
 		}
 	}
+	if rp.OutAcceptedDefaults != nil {
+		maps.Copy(rp.OutAcceptedDefaults, accepted)
+	}
+
+	logInputOrigins(ctx, rp, inputs, fileOrigins, accepted, d.inferred)
 
 	if rp.SkipInputValidation {
 		return inputs, nil
 	}
 
 	if err := validateInputs(ctx, rp.Spec.Inputs, inputs); err != nil {
-		return nil, err
+		return nil, errs.Wrap(errs.ErrInputValidation, err)
+	}
+
+	if violations := CheckConstraints(rp.Spec.Inputs, rp.Spec.InputConstraints, inputs); len(violations) > 0 {
+		msgs := make([]string, 0, len(violations))
+		for _, v := range violations {
+			msgs = append(msgs, v.Error())
+		}
+		return nil, errs.Wrap(errs.ErrInputValidation, fmt.Errorf("input validation failed:\n%s", strings.Join(msgs, "\n")))
 	}
 
 	return inputs, nil
 }
 
+// givenInputs returns the input values given by --input and --input-file,
+// coerced to their types, after checking that they're all known inputs. It
+// also returns the --input-file that each value from a file came from, and
+// the defaulter to use for the remaining inputs.
+func givenInputs(ctx context.Context, rp *ResolveParams) (inputs, fileOrigins map[string]string, _ *defaulter, _ error) {
+	if badInputs := checkReservedInputs(rp.Inputs); len(badInputs) > 0 {
+		return nil, nil, nil, errs.Wrap(errs.ErrInputValidation, fmt.Errorf(`input names beginning with underscore cannot be overridden by a normal user input; the bad input names were: %v`, badInputs))
+	}
+
+	if unknownInputs := checkUnknownInputs(rp.Spec, rp.Inputs); len(unknownInputs) > 0 {
+		return nil, nil, nil, errs.Wrap(errs.ErrInputValidation, fmt.Errorf("unknown input(s): %s", strings.Join(unknownInputs, ", ")))
+	}
+
+	if err := checkStdinInputFile(rp.InputFiles, rp.Prompt); err != nil {
+		return nil, nil, nil, err
+	}
+
+	fileInputs, fileOrigins, err := loadInputFiles(ctx, rp.FS, rp.Stdin, rp.InputFiles)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// Effectively ignore inputs in file that are not in spec inputs, thereby ignoring them
+	knownFileInputs := filterUnknownInputs(rp.Spec, fileInputs)
+
+	// Order matters: values from --input take precedence over --input-file.
+	inputs = sets.UnionMapKeys(rp.Inputs, knownFileInputs)
+
+	// Coerce the given values before computing defaults, so default_from
+	// expressions see the typed values of the inputs they refer to.
+	if err := coerceInputs(rp.Spec.Inputs, inputs); err != nil {
+		return nil, nil, nil, errs.Wrap(errs.ErrInputValidation, err)
+	}
+
+	d := &defaulter{
+		spec:     rp.Spec,
+		types:    Types(rp.Spec.Inputs),
+		builtins: rp.BuiltinVars,
+		inferred: inferDefaults(ctx, rp.FS, rp.DestDir, rp.Spec.Inputs, inputs),
+	}
+	if d.builtins == nil {
+		d.builtins = make(map[string]string)
+		for _, name := range builtinvar.NamesInScope(rp.Spec.Features, rp.Spec.EnvVarNames()) {
+			d.builtins[name] = ""
+		}
+	}
+	return inputs, fileOrigins, d, nil
+}
+
+// Types returns the type of each input in specInputs that has a type other
+// than a string, for use with common.NewTypedScope.
+func Types(specInputs []*spec.Input) map[string]common.VarType {
+	out := make(map[string]common.VarType)
+	for _, i := range specInputs {
+		if t := inputType(i); t != common.VarTypeString {
+			out[i.Name.Val] = t
+		}
+	}
+	return out
+}
+
+func inputType(i *spec.Input) common.VarType {
+	if i.Type.Val == "" {
+		return common.VarTypeString
+	}
+	return common.VarType(i.Type.Val)
+}
+
+// coerceInputs converts each value in inputs to the canonical form of its
+// input's type, as returned by common.CoerceValue. This mutates "inputs".
+func coerceInputs(specInputs []*spec.Input, inputs map[string]string) error {
+	var merr error
+	for _, i := range specInputs {
+		val, ok := inputs[i.Name.Val]
+		if !ok {
+			continue
+		}
+		coerced, err := common.CoerceValue(inputType(i), val)
+		if err != nil {
+			merr = errors.Join(merr, fmt.Errorf("invalid value for input %q of type %s: %w", i.Name.Val, inputType(i), err))
+			continue
+		}
+		inputs[i.Name.Val] = coerced
+	}
+	return merr
+}
+
 func validateInputs(ctx context.Context, specInputs []*spec.Input, inputVals map[string]string) error {
-	scope := common.NewScope(inputVals)
+	scope := common.NewTypedScope(inputVals, Types(specInputs))
 
 	sb := &strings.Builder{}
 	tw := tabwriter.NewWriter(sb, 8, 0, 2, ' ', 0)
@@ -127,8 +319,8 @@ func validateInputs(ctx context.Context, specInputs []*spec.Input, inputVals map
 	for _, input := range specInputs {
 		input := input
 		rules.ValidateRulesWithMessage(ctx, scope, input.Rules, tw, func() {
-			fmt.Fprintf(tw, "\nInput name:\t%s", input.Name.Val)
-			fmt.Fprintf(tw, "\nInput value:\t%s", inputVals[input.Name.Val])
+			fmt.Fprintf(tw, "\n%s\t%s", ui.Msg(ui.MsgInputName), input.Name.Val)
+			fmt.Fprintf(tw, "\n%s\t%s", ui.Msg(ui.MsgInputValue), inputVals[input.Name.Val])
 		})
 	}
 
@@ -139,56 +331,181 @@ func validateInputs(ctx context.Context, specInputs []*spec.Input, inputVals map
 	return nil
 }
 
-// promptForInputs looks for template inputs that were not provided on the
-// command line and prompts the user for them. This mutates "inputs".
-//
-// This must only be called when the user specified --prompt and the input is a
-// terminal (or in a test).
-func promptForInputs(ctx context.Context, prompter Prompter, spec *spec.Spec, inputs map[string]string) error {
-	for _, i := range spec.Inputs {
-		if _, ok := inputs[i.Name.Val]; ok {
-			// Don't prompt if we already have a value for this input.
-			continue
-		}
-		sb := &strings.Builder{}
-		tw := tabwriter.NewWriter(sb, 8, 0, 2, ' ', 0)
-		fmt.Fprintf(tw, "\nInput name:\t%s", i.Name.Val)
-		fmt.Fprintf(tw, "\nDescription:\t%s", i.Desc.Val)
-		for idx, rule := range i.Rules {
-			printRuleIndex := len(i.Rules) > 1
-			rules.WriteRule(tw, rule, printRuleIndex, idx)
-		}
-
-		if i.Default != nil {
-			defaultStr := i.Default.Val
-			if defaultStr == "" {
-				// When empty string is the default, print it differently so
-				// the user can actually see what's happening.
-				defaultStr = `""`
+// Violation is an input value that doesn't satisfy one of its input's
+// validation rules.
+type Violation struct {
+	Input string
+	Value string
+	Rule  *spec.Rule
+
+	// CELErr is set if the rule couldn't be evaluated, rather than evaluating
+	// to false.
+	CELErr error
+}
+
+// Error implements error. The message includes the position of the rule in the
+// spec file.
+func (v *Violation) Error() string {
+	return v.Unwrap().Error()
+}
+
+// Unwrap returns the error that Error describes, which wraps a
+// *model.PosError with the position of the rule.
+func (v *Violation) Unwrap() error {
+	if v.CELErr != nil {
+		// The CEL error already includes the position.
+		return fmt.Errorf("failed evaluating rule %q for input %q: %w", v.Rule.Rule.Val, v.Input, v.CELErr)
+	}
+	msg := fmt.Sprintf("input %q with value %q doesn't satisfy rule %q", v.Input, v.Value, v.Rule.Rule.Val)
+	if v.Rule.Message.Val != "" {
+		msg += ": " + v.Rule.Message.Val
+	}
+	return v.Rule.Pos.Errorf("%s", msg)
+}
+
+// CheckRules evaluates the validation rules of every input in specInputs
+// against inputVals, and returns every violation instead of stopping at the
+// first one. Unlike Resolve, it doesn't prompt or apply defaults; inputVals
+// should already contain every input.
+func CheckRules(ctx context.Context, specInputs []*spec.Input, inputVals map[string]string) []*Violation {
+	scope := common.NewTypedScope(inputVals, Types(specInputs))
+
+	var out []*Violation
+	for _, i := range specInputs {
+		for _, rule := range i.Rules {
+			var ok bool
+			err := common.CelCompileAndEval(ctx, scope, rule.Rule, &ok)
+			if ok && err == nil {
+				continue
 			}
-			fmt.Fprintf(tw, "\nDefault:\t%s", defaultStr)
+			out = append(out, &Violation{
+				Input:  i.Name.Val,
+				Value:  inputVals[i.Name.Val],
+				Rule:   rule,
+				CELErr: err,
+			})
 		}
+	}
+	return out
+}
 
-		tw.Flush()
+// ConstraintViolation is a group of inputs that doesn't satisfy one of the
+// spec's input constraints.
+type ConstraintViolation struct {
+	Constraint *spec.InputConstraint
 
-		if i.Default != nil {
-			fmt.Fprintf(sb, "\n\nEnter value, or leave empty to accept default: ")
-		} else {
-			fmt.Fprintf(sb, "\n\nEnter value: ")
-		}
+	// Set are the names of the inputs in the constraint that were set.
+	Set []string
+}
 
-		inputVal, err := prompter.Prompt(ctx, sb.String())
-		if err != nil {
-			return fmt.Errorf("failed to prompt for user input: %w", err)
-		}
+// Error implements error. The message includes the position of the constraint
+// in the spec file.
+func (v *ConstraintViolation) Error() string {
+	return v.Unwrap().Error()
+}
 
-		if inputVal == "" && i.Default != nil {
-			inputVal = i.Default.Val
+// Unwrap returns the error that Error describes, which is a *model.PosError
+// with the position of the constraint.
+func (v *ConstraintViolation) Unwrap() error {
+	names := quoteNames(v.Constraint.Inputs())
+	set := "none were"
+	if len(v.Set) > 0 {
+		set = strings.Join(quoteStrings(v.Set), ", ") + " were"
+	}
+	var msg string
+	if len(v.Constraint.OneOf) > 0 {
+		msg = fmt.Sprintf("exactly one of the inputs %s must be set, but %s", strings.Join(names, ", "), set)
+	} else {
+		msg = fmt.Sprintf("at most one of the inputs %s may be set, but %s", strings.Join(names, ", "), set)
+	}
+	if v.Constraint.Message.Val != "" {
+		msg += ": " + v.Constraint.Message.Val
+	}
+	return v.Constraint.Pos.Errorf("%s", msg)
+}
+
+// CheckConstraints checks inputVals against every input constraint, and returns
+// every violation instead of stopping at the first one. An input counts as set
+// if its value isn't the zero value of its type, like the empty string or
+// false. The values must be in the canonical form of their types, as returned
+// by Resolve.
+func CheckConstraints(specInputs []*spec.Input, constraints []*spec.InputConstraint, inputVals map[string]string) []*ConstraintViolation {
+	types := Types(specInputs)
+
+	var out []*ConstraintViolation
+	for _, c := range constraints {
+		var set []string
+		for _, name := range c.Inputs() {
+			if isSet(types[name.Val], inputVals[name.Val]) {
+				set = append(set, name.Val)
+			}
+		}
+		ok := len(set) <= 1
+		if len(c.OneOf) > 0 {
+			ok = len(set) == 1
 		}
+		if !ok {
+			out = append(out, &ConstraintViolation{Constraint: c, Set: set})
+		}
+	}
+	return out
+}
 
-		inputs[i.Name.Val] = inputVal
+// isSet returns false if val is the zero value of the type t.
+func isSet(t common.VarType, val string) bool {
+	switch t {
+	case common.VarTypeBool:
+		return val != "false" && val != ""
+	case common.VarTypeInt:
+		return val != "0" && val != ""
+	case common.VarTypeList:
+		return val != "[]" && val != ""
+	default:
+		return val != ""
+	}
+}
+
+func quoteNames(names []model.String) []string {
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		out = append(out, n.Val)
+	}
+	return quoteStrings(out)
+}
+
+func quoteStrings(ss []string) []string {
+	out := make([]string, 0, len(ss))
+	for _, s := range ss {
+		out = append(out, strconv.Quote(s))
+	}
+	return out
+}
+
+// typeForPrompt describes an input type in a prompt, with a hint about how to
+// enter a value of that type.
+func typeForPrompt(t common.VarType) string {
+	switch t {
+	case common.VarTypeBool:
+		return ui.Msg(ui.MsgInputTypeBool)
+	case common.VarTypeList:
+		return ui.Msg(ui.MsgInputTypeList)
+	default:
+		return string(t)
 	}
-	return nil
+}
+
+// defaultForPrompt formats a default value in the canonical form of its type
+// the way the user would type it. A list is shown comma-separated rather than
+// as a JSON array.
+func defaultForPrompt(t common.VarType, val string) string {
+	if t != common.VarTypeList {
+		return val
+	}
+	var l []string
+	if err := json.Unmarshal([]byte(val), &l); err != nil {
+		return val
+	}
+	return strings.Join(l, ", ")
 }
 
 func checkReservedInputs(inputs map[string]string) []string {
@@ -223,38 +540,207 @@ func filterUnknownInputs(spec *spec.Spec, inputs map[string]string) map[string]s
 	return sets.IntersectMapKeys(inputs, specInputs)
 }
 
-// loadInputFiles iterates over each --input-file and combines them all into a map.
-func loadInputFiles(ctx context.Context, fs common.FS, paths []string) (map[string]string, error) {
+// checkStdinInputFile enforces the restrictions on reading an input file from
+// stdin using "--input-file=-". Stdin can only be consumed once, and it can't be
+// shared with prompting.
+func checkStdinInputFile(paths []string, prompt bool) error {
+	var count int
+	for _, p := range paths {
+		if p == StdinInputFile {
+			count++
+		}
+	}
+	if count > 1 {
+		return fmt.Errorf("--input-file=%s may only be provided once", StdinInputFile)
+	}
+	if count == 1 && prompt {
+		return fmt.Errorf("--input-file=%s can't be combined with --prompt, because both of them read from standard input", StdinInputFile)
+	}
+	return nil
+}
+
+// loadInputFiles iterates over each --input-file and combines them all into a
+// map. When an input appears in more than one file, the value from the later
+// file wins, so that files can be layered, like org-wide defaults followed by
+// team and project defaults. The second return value maps each input name to
+// the file its value came from.
+func loadInputFiles(ctx context.Context, fs common.FS, stdin io.Reader, paths []string) (map[string]string, map[string]string, error) {
+	logger := logging.FromContext(ctx)
 	out := make(map[string]string)
 	sourceFileForInput := make(map[string]string)
 
 	for _, f := range paths {
-		inputsThisFile, err := loadInputFile(ctx, fs, f)
+		inputsThisFile, err := loadInputFile(ctx, fs, stdin, f)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		for key, val := range inputsThisFile {
-			if _, ok := out[key]; ok {
-				return nil, fmt.Errorf("input key %q appears in multiple input files %q and %q; there must not be any overlap between input files",
-					key, f, sourceFileForInput[key])
+			if prev, ok := sourceFileForInput[key]; ok {
+				logger.DebugContext(ctx, "input file overrides the value of an input from an earlier input file",
+					"input", key,
+					"file", f,
+					"overridden_file", prev)
 			}
 
 			out[key] = val
 			sourceFileForInput[key] = f
 		}
 	}
-	return out, nil
+	return out, sourceFileForInput, nil
 }
 
-// insertDefaultInputs defaults any missing inputs for which a default
-// exists. The input map will be mutated by adding new keys.
-func insertDefaultInputs(spec *spec.Spec, inputs map[string]string) {
+// logInputOrigins logs where the final value of each input came from, for
+// debugging layered input files.
+func logInputOrigins(ctx context.Context, rp *ResolveParams, inputs, fileOrigins map[string]string, accepted map[string]struct{}, inferred map[string]*inferredDefault) {
+	logger := logging.FromContext(ctx)
+	for _, i := range rp.Spec.Inputs {
+		name := i.Name.Val
+		if _, ok := inputs[name]; !ok {
+			continue
+		}
+		var origin string
+		switch {
+		case hasKey(rp.Inputs, name):
+			origin = "--input"
+		case hasKey(fileOrigins, name):
+			origin = "--input-file=" + fileOrigins[name]
+		case hasKey(accepted, name):
+			origin = "default, accepted with --accept-defaults"
+		case rp.Prompt:
+			origin = "prompt"
+		case inferred[name] != nil:
+			origin = "inferred from " + inferred[name].file
+		default:
+			origin = "default"
+		}
+		logger.DebugContext(ctx, "resolved input", "input", name, "origin", origin)
+	}
+}
+
+func hasKey[V any](m map[string]V, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// insertDefaultInputs defaults any missing inputs for which an inferred or
+// spec default exists. The input map will be mutated by adding new keys. It
+// returns the names of the inputs that were added.
+func insertDefaultInputs(ctx context.Context, spec *spec.Spec, inputs map[string]string, d *defaulter) ([]string, error) {
+	var added []string
 	for _, specInput := range spec.Inputs {
-		if _, ok := inputs[specInput.Name.Val]; !ok && specInput.Default != nil {
-			inputs[specInput.Name.Val] = specInput.Default.Val
+		if _, ok := inputs[specInput.Name.Val]; ok {
+			continue
+		}
+		val, ok, err := d.defaultFor(ctx, specInput, inputs)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			inputs[specInput.Name.Val] = val
+			added = append(added, specInput.Name.Val)
+		}
+	}
+	return added, nil
+}
+
+// defaulter computes the default values of inputs.
+type defaulter struct {
+	spec  *spec.Spec
+	types map[string]common.VarType
+
+	// builtins are the builtin vars in scope for default_from expressions.
+	builtins map[string]string
+
+	// inferred are the defaults inferred from files in the destination
+	// directory, which take precedence over the spec's defaults.
+	inferred map[string]*inferredDefault
+}
+
+// defaultFor returns the default value of the given input: the inferred value
+// if there is one, otherwise the value of the spec's default_from expression
+// or default, in the canonical form of the input's type. It returns false if
+// there's no default. inputs are the values of the inputs known so far, which
+// default_from may refer to.
+func (d *defaulter) defaultFor(ctx context.Context, i *spec.Input, inputs map[string]string) (string, bool, error) {
+	var val string
+	switch {
+	case d.inferred[i.Name.Val] != nil:
+		val = d.inferred[i.Name.Val].val
+	case i.DefaultFrom.Val != "":
+		var err error
+		val, err = d.evalDefaultFrom(ctx, i, inputs)
+		if err != nil {
+			// If the expression refers to an input that doesn't have a value
+			// yet, there's no default, and the input will be reported as
+			// missing along with the one it refers to.
+			var uve *errs.UnknownVarError
+			if errors.As(err, &uve) && d.isInput(uve.VarName) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("failed evaluating default_from of input %q: %w", i.Name.Val, err)
+		}
+	case i.Default != nil:
+		val = i.Default.Val
+	default:
+		return "", false, nil
+	}
+
+	coerced, err := common.CoerceValue(inputType(i), val)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid value for input %q of type %s: %w", i.Name.Val, inputType(i), err)
+	}
+	return coerced, true, nil
+}
+
+// evalDefaultFrom evaluates the default_from expression of the given input,
+// which must have a result of the input's type, and returns it in the
+// canonical form of that type.
+func (d *defaulter) evalDefaultFrom(ctx context.Context, i *spec.Input, inputs map[string]string) (string, error) {
+	scope := common.NewTypedScope(inputs, d.types).With(d.builtins)
+	var val string
+	switch t := inputType(i); t {
+	case common.VarTypeBool:
+		var b bool
+		if err := common.CelCompileAndEval(ctx, scope, i.DefaultFrom, &b); err != nil {
+			return "", err //nolint:wrapcheck
+		}
+		val = strconv.FormatBool(b)
+	case common.VarTypeInt:
+		var n int64
+		if err := common.CelCompileAndEval(ctx, scope, i.DefaultFrom, &n); err != nil {
+			return "", err //nolint:wrapcheck
+		}
+		val = strconv.FormatInt(n, 10)
+	case common.VarTypeList:
+		var l []string
+		if err := common.CelCompileAndEval(ctx, scope, i.DefaultFrom, &l); err != nil {
+			return "", err //nolint:wrapcheck
+		}
+		if l == nil {
+			l = []string{}
+		}
+		buf, err := json.Marshal(l)
+		if err != nil {
+			return "", fmt.Errorf("internal error: json.Marshal(): %w", err)
+		}
+		val = string(buf)
+	default:
+		if err := common.CelCompileAndEval(ctx, scope, i.DefaultFrom, &val); err != nil {
+			return "", err //nolint:wrapcheck
 		}
 	}
+	return val, nil
+}
+
+// isInput returns true if name is the name of one of the spec's inputs.
+func (d *defaulter) isInput(name string) bool {
+	for _, i := range d.spec.Inputs {
+		if i.Name.Val == name {
+			return true
+		}
+	}
+	return false
 }
 
 // checkInputsMissing checks for missing inputs and returns them as a slice.
@@ -272,15 +758,60 @@ func checkInputsMissing(spec *spec.Spec, inputs map[string]string) []string {
 	return missing
 }
 
-// loadInputFile loads a single --input-file into a map.
-func loadInputFile(ctx context.Context, fs common.FS, path string) (map[string]string, error) {
-	data, err := os.ReadFile(path)
+// loadInputFile loads a single --input-file into a map. If path is "-", the
+// file contents are read from stdin. Since JSON is a subset of YAML, either
+// format is accepted.
+func loadInputFile(ctx context.Context, fs common.FS, stdin io.Reader, path string) (map[string]string, error) {
+	var data []byte
+	var err error
+	if path == StdinInputFile {
+		if stdin == nil {
+			return nil, fmt.Errorf("internal error: --input-file=%s was given but there is no stdin to read from", StdinInputFile)
+		}
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = fs.ReadFile(path)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error reading input file: %w", err)
 	}
-	m := make(map[string]string)
-	if err := yaml.Unmarshal(data, &m); err != nil {
+	nodes := make(map[string]yaml.Node)
+	if err := yaml.Unmarshal(data, &nodes); err != nil {
 		return nil, fmt.Errorf("error parsing yaml file: %w", err)
 	}
+	m := make(map[string]string, len(nodes))
+	for key, node := range nodes {
+		node := node
+		val, err := inputFileValue(&node)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing yaml file: input %q: %w", key, err)
+		}
+		m[key] = val
+	}
 	return m, nil
 }
+
+// inputFileValue converts the value of an input in an input file to a string.
+// A list, for an input of type "list", is converted to a JSON array, which is
+// the canonical form of a list value.
+func inputFileValue(node *yaml.Node) (string, error) {
+	if node.Kind == yaml.SequenceNode {
+		var l []string
+		if err := node.Decode(&l); err != nil {
+			return "", err //nolint:wrapcheck
+		}
+		if l == nil {
+			l = []string{}
+		}
+		buf, err := json.Marshal(l)
+		if err != nil {
+			return "", fmt.Errorf("internal error: json.Marshal(): %w", err)
+		}
+		return string(buf), nil
+	}
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return s, nil
+}
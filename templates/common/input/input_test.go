@@ -18,11 +18,17 @@ import (
 	"context"
 	"errors"
 	"io"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/model"
 	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/testutil"
 )
@@ -52,7 +58,7 @@ func TestPromptForInputs_CanceledContext(t *testing.T) {
 				},
 			},
 		}
-		errCh <- promptForInputs(ctx, cmd, spec, map[string]string{})
+		errCh <- promptForInputs(ctx, &terminalPrompter{prompter: cmd}, false, spec, map[string]string{}, &defaulter{spec: spec}, nil)
 	}()
 
 	go func() {
@@ -343,3 +349,304 @@ CEL error:    CEL expression result couldn't be converted to bool. The CEL engin
 		})
 	}
 }
+
+func TestLoadInputFiles(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		files       map[string]string
+		paths       []string
+		stdin       string
+		prompt      bool
+		want        map[string]string
+		wantOrigins map[string]string
+		wantErr     string
+		wantCheck   string
+	}{
+		{
+			name: "single_file",
+			files: map[string]string{
+				"a.yaml": "foo: bar",
+			},
+			paths: []string{"a.yaml"},
+			want:  map[string]string{"foo": "bar"},
+		},
+		{
+			name: "later_file_overrides_earlier",
+			files: map[string]string{
+				"org.yaml":     "foo: org\nbar: org\nbaz: org",
+				"team.yaml":    "bar: team\nbaz: team",
+				"project.yaml": "baz: project",
+			},
+			paths: []string{"org.yaml", "team.yaml", "project.yaml"},
+			want:  map[string]string{"foo": "org", "bar": "team", "baz": "project"},
+			wantOrigins: map[string]string{
+				"foo": "org.yaml",
+				"bar": "team.yaml",
+				"baz": "project.yaml",
+			},
+		},
+		{
+			name:  "stdin_yaml",
+			paths: []string{"-"},
+			stdin: "foo: bar\nbaz: qux\n",
+			want:  map[string]string{"foo": "bar", "baz": "qux"},
+		},
+		{
+			name:  "stdin_json",
+			paths: []string{"-"},
+			stdin: `{"foo": "bar"}`,
+			want:  map[string]string{"foo": "bar"},
+		},
+		{
+			name: "stdin_and_file",
+			files: map[string]string{
+				"a.yaml": "foo: bar",
+			},
+			paths: []string{"a.yaml", "-"},
+			stdin: "baz: qux",
+			want:  map[string]string{"foo": "bar", "baz": "qux"},
+		},
+		{
+			name:      "stdin_twice",
+			paths:     []string{"-", "-"},
+			wantCheck: "may only be provided once",
+		},
+		{
+			name:      "stdin_with_prompt",
+			paths:     []string{"-"},
+			prompt:    true,
+			wantCheck: "can't be combined with --prompt",
+		},
+		{
+			name:  "typed_values",
+			paths: []string{"-"},
+			stdin: "enabled: true\nreplicas: 3\nregions: [us-east1, us-west1]\nempty: []\n",
+			want: map[string]string{
+				"enabled":  "true",
+				"replicas": "3",
+				"regions":  `["us-east1","us-west1"]`,
+				"empty":    `[]`,
+			},
+		},
+		{
+			name:    "nested_list",
+			paths:   []string{"-"},
+			stdin:   "regions: [[us-east1]]",
+			wantErr: `error parsing yaml file: input "regions"`,
+		},
+		{
+			name:    "stdin_malformed",
+			paths:   []string{"-"},
+			stdin:   "[[[",
+			wantErr: "error parsing yaml file",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, dir, tc.files)
+			paths := make([]string, 0, len(tc.paths))
+			for _, p := range tc.paths {
+				if p != StdinInputFile {
+					p = filepath.Join(dir, p)
+				}
+				paths = append(paths, p)
+			}
+
+			err := checkStdinInputFile(paths, tc.prompt)
+			if diff := testutil.DiffErrString(err, tc.wantCheck); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			ctx := context.Background()
+			got, gotOrigins, err := loadInputFiles(ctx, &common.RealFS{}, strings.NewReader(tc.stdin), paths)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("input files were not loaded as expected (-got,+want): %s", diff)
+			}
+			if tc.wantOrigins != nil {
+				for name, path := range gotOrigins {
+					gotOrigins[name] = filepath.Base(path)
+				}
+				if diff := cmp.Diff(gotOrigins, tc.wantOrigins); diff != "" {
+					t.Errorf("input origins were not as expected (-got,+want): %s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCoerceInputs(t *testing.T) {
+	t.Parallel()
+
+	specInputs := []*spec.Input{
+		{Name: model.String{Val: "name"}},
+		{Name: model.String{Val: "enabled"}, Type: model.String{Val: "bool"}},
+		{Name: model.String{Val: "replicas"}, Type: model.String{Val: "int"}},
+		{Name: model.String{Val: "regions"}, Type: model.String{Val: "list"}},
+	}
+
+	cases := []struct {
+		name    string
+		inputs  map[string]string
+		want    map[string]string
+		wantErr []string
+	}{
+		{
+			name: "coerced",
+			inputs: map[string]string{
+				"name":     " yes ",
+				"enabled":  "yes",
+				"replicas": "03",
+				"regions":  "us-east1,us-west1",
+			},
+			want: map[string]string{
+				"name":     " yes ",
+				"enabled":  "true",
+				"replicas": "3",
+				"regions":  `["us-east1","us-west1"]`,
+			},
+		},
+		{
+			name:   "missing_inputs_are_skipped",
+			inputs: map[string]string{"enabled": "n"},
+			want:   map[string]string{"enabled": "false"},
+		},
+		{
+			name: "every_invalid_value_is_reported",
+			inputs: map[string]string{
+				"enabled":  "maybe",
+				"replicas": "many",
+			},
+			wantErr: []string{
+				`invalid value for input "enabled" of type bool: "maybe" isn't a bool`,
+				`invalid value for input "replicas" of type int: "many" isn't an int`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := coerceInputs(specInputs, tc.inputs)
+			for _, wantErr := range tc.wantErr {
+				if diff := testutil.DiffErrString(err, wantErr); diff != "" {
+					t.Error(diff)
+				}
+			}
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tc.inputs, tc.want); diff != "" {
+					t.Errorf("coerced inputs were not as expected (-got,+want): %s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckConstraints(t *testing.T) {
+	t.Parallel()
+
+	specInputs := []*spec.Input{
+		{Name: model.String{Val: "gcs_bucket"}},
+		{Name: model.String{Val: "s3_bucket"}},
+		{Name: model.String{Val: "use_local"}, Type: model.String{Val: "bool"}},
+		{Name: model.String{Val: "replicas"}, Type: model.String{Val: "int"}},
+		{Name: model.String{Val: "regions"}, Type: model.String{Val: "list"}},
+	}
+	oneBackend := &spec.InputConstraint{
+		OneOf:   []model.String{{Val: "gcs_bucket"}, {Val: "s3_bucket"}, {Val: "use_local"}},
+		Message: model.String{Val: "choose one storage backend"},
+	}
+	scaling := &spec.InputConstraint{
+		Conflicts: []model.String{{Val: "replicas"}, {Val: "regions"}},
+	}
+	constraints := []*spec.InputConstraint{oneBackend, scaling}
+
+	cases := []struct {
+		name   string
+		inputs map[string]string
+		want   []string
+	}{
+		{
+			name: "satisfied",
+			inputs: map[string]string{
+				"gcs_bucket": "my-bucket",
+				"s3_bucket":  "",
+				"use_local":  "false",
+				"replicas":   "3",
+				"regions":    "[]",
+			},
+		},
+		{
+			name: "zero_values_are_not_set",
+			inputs: map[string]string{
+				"gcs_bucket": "",
+				"s3_bucket":  "",
+				"use_local":  "true",
+				"replicas":   "0",
+				"regions":    "[]",
+			},
+		},
+		{
+			name: "none_set",
+			inputs: map[string]string{
+				"gcs_bucket": "",
+				"s3_bucket":  "",
+				"use_local":  "false",
+				"replicas":   "0",
+				"regions":    "[]",
+			},
+			want: []string{
+				`exactly one of the inputs "gcs_bucket", "s3_bucket", "use_local" must be set, but none were: choose one storage backend`,
+			},
+		},
+		{
+			name: "every_violation_is_reported",
+			inputs: map[string]string{
+				"gcs_bucket": "my-bucket",
+				"s3_bucket":  "",
+				"use_local":  "true",
+				"replicas":   "2",
+				"regions":    `["us-east1"]`,
+			},
+			want: []string{
+				`exactly one of the inputs "gcs_bucket", "s3_bucket", "use_local" must be set, but "gcs_bucket", "use_local" were: choose one storage backend`,
+				`at most one of the inputs "replicas", "regions" may be set, but "replicas", "regions" were`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, v := range CheckConstraints(specInputs, constraints, tc.inputs) {
+				got = append(got, v.Error())
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("violations were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/rules"
+	"github.com/abcxyz/abc/templates/common/ui"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+)
+
+// InputPrompter asks for the values of missing inputs. It's the way to prompt
+// through something other than the terminal, like a web form or a JSON-RPC
+// call, when abc is embedded in another program.
+//
+// PromptInputs is given one request per input to ask for, in the order the
+// inputs appear in the spec. It returns the answers keyed by input name. An
+// answer that's empty or missing from the map means "use the default". If
+// some answers can't be converted to their input's type, PromptInputs is
+// called again with just those inputs, with PromptRequest.Invalid set.
+type InputPrompter interface {
+	PromptInputs(ctx context.Context, reqs []*PromptRequest) (map[string]string, error)
+}
+
+// InputPrompterFunc is an InputPrompter that's a plain function.
+type InputPrompterFunc func(ctx context.Context, reqs []*PromptRequest) (map[string]string, error)
+
+// PromptInputs implements InputPrompter.
+func (f InputPrompterFunc) PromptInputs(ctx context.Context, reqs []*PromptRequest) (map[string]string, error) {
+	return f(ctx, reqs)
+}
+
+// PromptRequest describes an input that the user is being asked for.
+type PromptRequest struct {
+	// Name and Desc are from the spec.
+	Name string
+	Desc string
+
+	// Type is the input's type. Answers are written the way a user would type
+	// them on the command line, so a list is comma-separated.
+	Type common.VarType
+
+	// Rules are the input's validation rules from the spec, for display. The
+	// answers are validated after all the inputs are known.
+	Rules []*spec.Rule
+
+	// Default is the value used if the answer is empty, in the canonical
+	// form of Type, if HasDefault is true.
+	Default    string
+	HasDefault bool
+
+	// InferredFrom is the file in the destination that Default was inferred
+	// from, if it was.
+	InferredFrom string
+
+	// Invalid is set when the input is asked for again because the previous
+	// answer couldn't be converted to Type. It says what was wrong with it.
+	Invalid string
+
+	input *spec.Input
+}
+
+// promptForInputs looks for template inputs that weren't provided on the
+// command line and asks the prompter for them. This mutates "inputs". Inferred
+// values are offered as the default, in place of the spec's default.
+//
+// Normally, each input is asked for on its own, and a default_from expression
+// is evaluated just before its input is asked for, so it can use the earlier
+// answers. If batch is true, all the inputs are asked for at once instead; a
+// default_from expression that refers to an input that's being asked for has
+// no default in the request, and is evaluated with the answers afterward.
+//
+// If accepted isn't nil, the inputs that have a default when they're reached
+// aren't asked for; the default is used, and the input's name is added to
+// accepted.
+func promptForInputs(ctx context.Context, prompter InputPrompter, batch bool, spec *spec.Spec, inputs map[string]string, d *defaulter, accepted map[string]struct{}) error {
+	var reqs []*PromptRequest
+	for _, i := range spec.Inputs {
+		if _, ok := inputs[i.Name.Val]; ok {
+			// Don't prompt if we already have a value for this input.
+			continue
+		}
+		req, err := newPromptRequest(ctx, i, inputs, d)
+		if err != nil {
+			return err
+		}
+		if accepted != nil && req.HasDefault {
+			inputs[req.Name] = req.Default
+			accepted[req.Name] = struct{}{}
+			continue
+		}
+		if !batch {
+			if err := askUntilValid(ctx, prompter, []*PromptRequest{req}, inputs, d); err != nil {
+				return err
+			}
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+	return askUntilValid(ctx, prompter, reqs, inputs, d)
+}
+
+// newPromptRequest returns the request for the input i, given the values of
+// the inputs known so far.
+func newPromptRequest(ctx context.Context, i *spec.Input, inputs map[string]string, d *defaulter) (*PromptRequest, error) {
+	defaultVal, hasDefault, err := d.defaultFor(ctx, i, inputs)
+	if err != nil {
+		return nil, err
+	}
+	req := &PromptRequest{
+		Name:       i.Name.Val,
+		Desc:       i.Desc.Val,
+		Type:       inputType(i),
+		Rules:      i.Rules,
+		Default:    defaultVal,
+		HasDefault: hasDefault,
+		input:      i,
+	}
+	if inf, ok := d.inferred[i.Name.Val]; ok && hasDefault {
+		req.InferredFrom = inf.file
+	}
+	return req, nil
+}
+
+// askUntilValid asks the prompter for reqs, and adds the answers to inputs.
+// It keeps asking for the inputs whose answers can't be converted to their
+// type, rather than failing the whole render because of a typo.
+func askUntilValid(ctx context.Context, prompter InputPrompter, reqs []*PromptRequest, inputs map[string]string, d *defaulter) error {
+	for len(reqs) > 0 {
+		answers, err := prompter.PromptInputs(ctx, reqs)
+		if err != nil {
+			return fmt.Errorf("failed to prompt for user input: %w", err)
+		}
+
+		var invalid []*PromptRequest
+		for _, req := range reqs {
+			val := answers[req.Name]
+			if val == "" {
+				// The default is computed again, because in batch mode, a
+				// default_from expression may refer to the earlier answers.
+				defaultVal, hasDefault, err := d.defaultFor(ctx, req.input, inputs)
+				if err != nil {
+					return err
+				}
+				if hasDefault {
+					val = defaultVal
+				}
+			}
+			coerced, err := common.CoerceValue(req.Type, val)
+			if err != nil {
+				again := *req
+				again.Invalid = err.Error()
+				invalid = append(invalid, &again)
+				continue
+			}
+			inputs[req.Name] = coerced
+		}
+		reqs = invalid
+	}
+	return nil
+}
+
+// timeoutPrompter is an InputPrompter that fails if the one it wraps doesn't
+// answer within the timeout, for --prompt-timeout.
+type timeoutPrompter struct {
+	prompter InputPrompter
+	timeout  time.Duration
+}
+
+type promptResult struct {
+	answers map[string]string
+	err     error
+}
+
+// PromptInputs implements InputPrompter. The wrapped prompter is given a
+// context that's canceled after the timeout, but it isn't waited for, in case
+// it's blocked reading from a terminal that nobody will type into.
+func (t *timeoutPrompter) PromptInputs(ctx context.Context, reqs []*PromptRequest) (map[string]string, error) {
+	promptCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	resultCh := make(chan *promptResult, 1)
+	go func() {
+		answers, err := t.prompter.PromptInputs(promptCtx, reqs)
+		resultCh <- &promptResult{answers: answers, err: err}
+	}()
+
+	var r *promptResult
+	select {
+	case r = <-resultCh:
+	case <-promptCtx.Done():
+		r = &promptResult{err: promptCtx.Err()}
+	}
+	// A timeout or cancellation of ctx itself, like from the global
+	// --timeout, isn't this prompt's timeout.
+	if r.err != nil && ctx.Err() == nil && errors.Is(promptCtx.Err(), context.DeadlineExceeded) {
+		return nil, t.timeoutErr(reqs)
+	}
+	return r.answers, r.err
+}
+
+func (t *timeoutPrompter) timeoutErr(reqs []*PromptRequest) error {
+	names := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		names = append(names, req.Name)
+	}
+	return fmt.Errorf("no answer within --prompt-timeout=%s for the input(s) %s; give them with --input, or use --accept-defaults if they have defaults",
+		t.timeout, strings.Join(names, ", "))
+}
+
+// terminalPrompter is the InputPrompter for --prompt, which asks for one
+// input at a time on the terminal.
+type terminalPrompter struct {
+	prompter Prompter
+	colors   *ui.Colors
+}
+
+// PromptInputs implements InputPrompter.
+func (t *terminalPrompter) PromptInputs(ctx context.Context, reqs []*PromptRequest) (map[string]string, error) {
+	answers := make(map[string]string, len(reqs))
+	for _, req := range reqs {
+		answer, err := t.prompter.Prompt(ctx, "%s", t.message(req))
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		answers[req.Name] = answer
+	}
+	return answers, nil
+}
+
+// message returns the text of the prompt for req. When an input is asked for
+// again, only the reason and the request to enter a value are shown.
+func (t *terminalPrompter) message(req *PromptRequest) string {
+	enterValue := ui.Msg(ui.MsgInputEnterValue)
+	if req.HasDefault {
+		enterValue = ui.Msg(ui.MsgInputEnterValueOrDefault)
+	}
+	if req.Invalid != "" {
+		return fmt.Sprintf("\n%s\n\n%s", ui.Msg(ui.MsgInputInvalidValue, req.Invalid), enterValue)
+	}
+
+	sb := &strings.Builder{}
+	tw := tabwriter.NewWriter(sb, 8, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\n%s\t%s", ui.Msg(ui.MsgInputName), t.colors.Bold(req.Name))
+	fmt.Fprintf(tw, "\n%s\t%s", ui.Msg(ui.MsgInputDescription), req.Desc)
+	if req.Type != common.VarTypeString {
+		fmt.Fprintf(tw, "\n%s\t%s", ui.Msg(ui.MsgInputType), typeForPrompt(req.Type))
+	}
+	for idx, rule := range req.Rules {
+		printRuleIndex := len(req.Rules) > 1
+		rules.WriteRule(tw, rule, printRuleIndex, idx)
+	}
+	if req.HasDefault {
+		defaultStr := defaultForPrompt(req.Type, req.Default)
+		if defaultStr == "" {
+			// When empty string is the default, print it differently so
+			// the user can actually see what's happening.
+			defaultStr = `""`
+		}
+		if req.InferredFrom != "" {
+			defaultStr = ui.Msg(ui.MsgInputInferredFrom, defaultStr, req.InferredFrom)
+		}
+		fmt.Fprintf(tw, "\n%s\t%s", ui.Msg(ui.MsgInputDefault), defaultStr)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(sb, "\n\n%s", enterValue)
+	return sb.String()
+}
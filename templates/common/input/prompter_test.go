@@ -0,0 +1,262 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/exp/maps"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestResolve_InputPrompter(t *testing.T) {
+	t.Parallel()
+
+	// The answers, keyed by input name, to give each time the prompter is
+	// called. The requests are recorded.
+	type call struct {
+		answers map[string]string
+		err     error
+	}
+
+	cases := []struct {
+		name           string
+		inputs         map[string]string
+		batch          bool
+		acceptDefaults bool
+		calls          []call
+		want           map[string]string
+		wantAccepted   []string
+		wantRequests   [][]*PromptRequest
+		wantErr        string
+	}{
+		{
+			name: "one_at_a_time",
+			calls: []call{
+				{answers: map[string]string{"name": "alice"}},
+				{answers: map[string]string{"greeting": ""}},
+				{answers: map[string]string{"count": "3"}},
+			},
+			want: map[string]string{"name": "alice", "greeting": "hello alice", "count": "3"},
+			wantRequests: [][]*PromptRequest{
+				{{Name: "name", Desc: "your name", Type: common.VarTypeString}},
+				{{Name: "greeting", Desc: "the greeting", Type: common.VarTypeString, Default: "hello alice", HasDefault: true}},
+				{{Name: "count", Desc: "how many", Type: common.VarTypeInt, Default: "1", HasDefault: true}},
+			},
+		},
+		{
+			name:  "batch",
+			batch: true,
+			calls: []call{
+				{answers: map[string]string{"name": "alice"}},
+			},
+			want: map[string]string{"name": "alice", "greeting": "hello alice", "count": "1"},
+			wantRequests: [][]*PromptRequest{{
+				{Name: "name", Desc: "your name", Type: common.VarTypeString},
+				// The default depends on "name", which isn't known yet.
+				{Name: "greeting", Desc: "the greeting", Type: common.VarTypeString},
+				{Name: "count", Desc: "how many", Type: common.VarTypeInt, Default: "1", HasDefault: true},
+			}},
+		},
+		{
+			name:   "batch_only_asks_for_missing_inputs",
+			inputs: map[string]string{"name": "bob"},
+			batch:  true,
+			calls: []call{
+				{answers: map[string]string{"count": "2"}},
+			},
+			want: map[string]string{"name": "bob", "greeting": "hello bob", "count": "2"},
+			wantRequests: [][]*PromptRequest{{
+				{Name: "greeting", Desc: "the greeting", Type: common.VarTypeString, Default: "hello bob", HasDefault: true},
+				{Name: "count", Desc: "how many", Type: common.VarTypeInt, Default: "1", HasDefault: true},
+			}},
+		},
+		{
+			name:  "invalid_answer_is_asked_again",
+			batch: true,
+			calls: []call{
+				{answers: map[string]string{"name": "alice", "count": "many"}},
+				{answers: map[string]string{"count": "4"}},
+			},
+			want: map[string]string{"name": "alice", "greeting": "hello alice", "count": "4"},
+			wantRequests: [][]*PromptRequest{
+				{
+					{Name: "name", Desc: "your name", Type: common.VarTypeString},
+					{Name: "greeting", Desc: "the greeting", Type: common.VarTypeString},
+					{Name: "count", Desc: "how many", Type: common.VarTypeInt, Default: "1", HasDefault: true},
+				},
+				{
+					{
+						Name: "count", Desc: "how many", Type: common.VarTypeInt, Default: "1", HasDefault: true,
+						Invalid: `"many" isn't an int`,
+					},
+				},
+			},
+		},
+		{
+			name:           "accept_defaults",
+			acceptDefaults: true,
+			calls: []call{
+				{answers: map[string]string{"name": "alice"}},
+			},
+			want:         map[string]string{"name": "alice", "greeting": "hello alice", "count": "1"},
+			wantAccepted: []string{"count", "greeting"},
+			wantRequests: [][]*PromptRequest{
+				{{Name: "name", Desc: "your name", Type: common.VarTypeString}},
+			},
+		},
+		{
+			name:           "accept_defaults_batch",
+			batch:          true,
+			acceptDefaults: true,
+			calls: []call{
+				{answers: map[string]string{"name": "alice", "greeting": ""}},
+			},
+			want:         map[string]string{"name": "alice", "greeting": "hello alice", "count": "1"},
+			wantAccepted: []string{"count"},
+			wantRequests: [][]*PromptRequest{{
+				{Name: "name", Desc: "your name", Type: common.VarTypeString},
+				// The default depends on "name", so it can't be accepted yet.
+				{Name: "greeting", Desc: "the greeting", Type: common.VarTypeString},
+			}},
+		},
+		{
+			name:           "accept_defaults_with_nothing_to_ask",
+			inputs:         map[string]string{"name": "bob"},
+			acceptDefaults: true,
+			want:           map[string]string{"name": "bob", "greeting": "hello bob", "count": "1"},
+			wantAccepted:   []string{"count", "greeting"},
+		},
+		{
+			name: "prompter_error",
+			calls: []call{
+				{err: fmt.Errorf("the form was closed")},
+			},
+			wantRequests: [][]*PromptRequest{
+				{{Name: "name", Desc: "your name", Type: common.VarTypeString}},
+			},
+			wantErr: "failed to prompt for user input: the form was closed",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sp := &spec.Spec{
+				Inputs: []*spec.Input{
+					{
+						Name: model.String{Val: "name"},
+						Desc: model.String{Val: "your name"},
+					},
+					{
+						Name:        model.String{Val: "greeting"},
+						Desc:        model.String{Val: "the greeting"},
+						DefaultFrom: model.String{Val: `"hello " + name`},
+					},
+					{
+						Name:    model.String{Val: "count"},
+						Desc:    model.String{Val: "how many"},
+						Type:    model.String{Val: "int"},
+						Default: &model.String{Val: "1"},
+					},
+				},
+			}
+
+			var gotRequests [][]*PromptRequest
+			prompter := InputPrompterFunc(func(ctx context.Context, reqs []*PromptRequest) (map[string]string, error) {
+				gotRequests = append(gotRequests, reqs)
+				if len(gotRequests) > len(tc.calls) {
+					return nil, fmt.Errorf("the prompter was called too many times")
+				}
+				c := tc.calls[len(gotRequests)-1]
+				return c.answers, c.err
+			})
+
+			accepted := make(map[string]struct{})
+			got, err := Resolve(context.Background(), &ResolveParams{
+				AcceptDefaults:      tc.acceptDefaults,
+				FS:                  &common.RealFS{},
+				Inputs:              tc.inputs,
+				InputPrompter:       prompter,
+				OutAcceptedDefaults: accepted,
+				Prompt:              true,
+				PromptBatch:         tc.batch,
+				Spec:                sp,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(got, tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("inputs were not as expected (-got,+want): %s", diff)
+			}
+			gotAccepted := maps.Keys(accepted)
+			sort.Strings(gotAccepted)
+			if diff := cmp.Diff(gotAccepted, tc.wantAccepted, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("accepted defaults were not as expected (-got,+want): %s", diff)
+			}
+			opts := []cmp.Option{
+				cmpopts.IgnoreUnexported(PromptRequest{}),
+				cmpopts.IgnoreFields(PromptRequest{}, "Rules"),
+			}
+			if diff := cmp.Diff(gotRequests, tc.wantRequests, opts...); diff != "" {
+				t.Errorf("prompt requests were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestResolve_PromptTimeout(t *testing.T) {
+	t.Parallel()
+
+	sp := &spec.Spec{
+		Inputs: []*spec.Input{
+			{
+				Name: model.String{Val: "name"},
+				Desc: model.String{Val: "your name"},
+			},
+		},
+	}
+
+	// The prompter never answers, as if nobody were at the terminal.
+	prompter := InputPrompterFunc(func(ctx context.Context, reqs []*PromptRequest) (map[string]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err() //nolint:wrapcheck
+	})
+
+	_, err := Resolve(context.Background(), &ResolveParams{
+		FS:            &common.RealFS{},
+		InputPrompter: prompter,
+		Prompt:        true,
+		PromptTimeout: 10 * time.Millisecond,
+		Spec:          sp,
+	})
+	want := "no answer within --prompt-timeout=10ms for the input(s) name"
+	if diff := testutil.DiffErrString(err, want); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"context"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+)
+
+// The values of Status.Origin.
+const (
+	OriginFlag      = "flag"
+	OriginInputFile = "input_file"
+	OriginInferred  = "inferred"
+	OriginDefault   = "default"
+)
+
+// Status says whether an input already has a value, before rendering.
+type Status struct {
+	Input *spec.Input
+
+	// Type is the input's type, which is VarTypeString if the spec doesn't
+	// say.
+	Type common.VarType
+
+	// Satisfied is true if the input has a value from a flag, an input file,
+	// or a default, so it wouldn't need to be prompted for.
+	Satisfied bool
+
+	// If Satisfied, Value is the input's value in the canonical form of its
+	// type, and Origin is where it came from: one of OriginFlag,
+	// OriginInputFile, OriginInferred, or OriginDefault.
+	Value  string
+	Origin string
+
+	// OriginFile is the --input-file that the value came from, or the file in
+	// the destination that it was inferred from.
+	OriginFile string
+}
+
+// Statuses returns the Status of each of the spec's inputs, in order, given
+// the flags and input files in rp. Unlike Resolve, it doesn't prompt, and
+// doesn't fail when inputs are missing or don't pass validation. It's for
+// tools that need to know which inputs to ask for before rendering. rp.Prompt
+// and the fields for prompting are ignored.
+func Statuses(ctx context.Context, rp *ResolveParams) ([]*Status, error) {
+	rpNoPrompt := *rp
+	rpNoPrompt.Prompt = false
+	inputs, fileOrigins, d, err := givenInputs(ctx, &rpNoPrompt)
+	if err != nil {
+		return nil, err
+	}
+	given := make(map[string]bool, len(inputs))
+	for name := range inputs {
+		given[name] = true
+	}
+	if _, err := insertDefaultInputs(ctx, rp.Spec, inputs, d); err != nil {
+		return nil, err
+	}
+
+	out := make([]*Status, 0, len(rp.Spec.Inputs))
+	for _, i := range rp.Spec.Inputs {
+		name := i.Name.Val
+		st := &Status{Input: i, Type: inputType(i)}
+		out = append(out, st)
+		val, ok := inputs[name]
+		if !ok {
+			continue
+		}
+		st.Satisfied, st.Value = true, val
+		switch {
+		case hasKey(rp.Inputs, name):
+			st.Origin = OriginFlag
+		case given[name]:
+			st.Origin, st.OriginFile = OriginInputFile, fileOrigins[name]
+		case d.inferred[name] != nil:
+			st.Origin, st.OriginFile = OriginInferred, d.inferred[name].file
+		default:
+			st.Origin = OriginDefault
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestStatuses(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		inputs    map[string]string
+		inputFile string
+		destFiles map[string]string
+		want      []*Status
+		wantErr   string
+	}{
+		{
+			name: "nothing_given",
+			want: []*Status{
+				{Type: common.VarTypeString},
+				{Type: common.VarTypeString},
+				{Type: common.VarTypeBool, Satisfied: true, Value: "true", Origin: OriginDefault},
+			},
+		},
+		{
+			name:      "every_origin",
+			inputs:    map[string]string{"name": "alice"},
+			inputFile: "flag: false\n",
+			destFiles: map[string]string{"go.mod": "module example.com/foo\n"},
+			want: []*Status{
+				{Type: common.VarTypeString, Satisfied: true, Value: "alice", Origin: OriginFlag},
+				{Type: common.VarTypeString, Satisfied: true, Value: "example.com/foo", Origin: OriginInferred, OriginFile: "go.mod"},
+				{Type: common.VarTypeBool, Satisfied: true, Value: "false", Origin: OriginInputFile, OriginFile: "inputs.yaml"},
+			},
+		},
+		{
+			name:    "unknown_input",
+			inputs:  map[string]string{"nope": "x"},
+			wantErr: "unknown input(s): nope",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			destDir := filepath.Join(tempDir, "dest")
+			abctestutil.WriteAllDefaultMode(t, destDir, tc.destFiles)
+			var inputFiles []string
+			if tc.inputFile != "" {
+				abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{"inputs.yaml": tc.inputFile})
+				inputFiles = []string{filepath.Join(tempDir, "inputs.yaml")}
+				for _, st := range tc.want {
+					if st.Origin == OriginInputFile {
+						st.OriginFile = inputFiles[0]
+					}
+				}
+			}
+
+			sp := &spec.Spec{
+				Inputs: []*spec.Input{
+					{Name: model.String{Val: "name"}},
+					{
+						Name: model.String{Val: "module"},
+						Infer: &spec.Infer{
+							File:  model.String{Val: "go.mod"},
+							Regex: model.String{Val: `(?m)^module\s+(\S+)`},
+						},
+					},
+					{
+						Name:    model.String{Val: "flag"},
+						Type:    model.String{Val: "bool"},
+						Default: &model.String{Val: "true"},
+					},
+				},
+			}
+
+			got, err := Statuses(context.Background(), &ResolveParams{
+				DestDir:    destDir,
+				FS:         &common.RealFS{},
+				InputFiles: inputFiles,
+				Inputs:     tc.inputs,
+				Prompt:     true, // ignored
+				Spec:       sp,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want, cmpopts.IgnoreFields(Status{}, "Input")); diff != "" {
+				t.Errorf("statuses were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
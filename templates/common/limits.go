@@ -0,0 +1,113 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Limits are guardrails on the size of a copied directory tree, such as a
+// downloaded template or the output of a render. They protect the user from
+// accidentally copying something huge, like a template that contains a
+// vendored node_modules directory.
+//
+// A zero value for any field means that there's no limit.
+type Limits struct {
+	// MaxFiles is the maximum number of files that may be copied.
+	MaxFiles int
+
+	// MaxBytes is the maximum total size in bytes of the files that may be
+	// copied.
+	MaxBytes int64
+
+	// MaxPathDepth is the maximum number of path components in the path of a
+	// copied file or directory, relative to the root of the copy. For
+	// example, "a/b/c.txt" has a depth of 3.
+	MaxPathDepth int
+}
+
+// These are the default values of the --max-files, --max-bytes, and
+// --max-path-depth flags. They're generous enough for any reasonable template.
+const (
+	DefaultMaxFiles     = 10_000
+	DefaultMaxBytes     = 512 * 1024 * 1024
+	DefaultMaxPathDepth = 32
+)
+
+// limitTracker counts the files and bytes copied by a single call to
+// CopyRecursive and enforces Limits.
+type limitTracker struct {
+	limits *Limits
+
+	numFiles int
+	numBytes int64
+}
+
+// checkDepth returns an error if relPath is deeper than MaxPathDepth.
+func (t *limitTracker) checkDepth(relPath string) error {
+	if t.limits == nil || t.limits.MaxPathDepth <= 0 {
+		return nil
+	}
+	if depth := pathDepth(relPath); depth > t.limits.MaxPathDepth {
+		return fmt.Errorf("the path %q is %d levels deep, which is more than the limit of %d set by --max-path-depth",
+			filepath.ToSlash(relPath), depth, t.limits.MaxPathDepth)
+	}
+	return nil
+}
+
+// addFile counts a file of the given size, returning an error if that puts the
+// total over MaxFiles or MaxBytes.
+func (t *limitTracker) addFile(relPath string, size int64) error {
+	if t.limits == nil {
+		return nil
+	}
+	t.numFiles++
+	t.numBytes += size
+	if t.limits.MaxFiles > 0 && t.numFiles > t.limits.MaxFiles {
+		return fmt.Errorf("there are more than %d files, which is the limit set by --max-files (reached at %q)",
+			t.limits.MaxFiles, filepath.ToSlash(relPath))
+	}
+	if t.limits.MaxBytes > 0 && t.numBytes > t.limits.MaxBytes {
+		return fmt.Errorf("the files total more than %d bytes, which is the limit set by --max-bytes (reached at %q)",
+			t.limits.MaxBytes, filepath.ToSlash(relPath))
+	}
+	return nil
+}
+
+// pathDepth returns the number of components in the relative path relPath.
+// The root "." has a depth of 0.
+func pathDepth(relPath string) int {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if relPath == "." {
+		return 0
+	}
+	return strings.Count(relPath, "/") + 1
+}
+
+// FormatBytes formats n like "512 B" or "1.5 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// LineEndings says how the lines of text files are terminated in the output of
+// a template.
+type LineEndings string
+
+const (
+	// LineEndingsPreserve leaves line endings as they are. This is the
+	// default.
+	LineEndingsPreserve LineEndings = "preserve"
+
+	// LineEndingsLF converts CRLF line endings to LF.
+	LineEndingsLF LineEndings = "lf"
+
+	// LineEndingsCRLF converts LF line endings to CRLF.
+	LineEndingsCRLF LineEndings = "crlf"
+)
+
+// LineEndingsValues are the valid values of LineEndings, as strings for use in
+// flag help and error messages.
+var LineEndingsValues = []string{string(LineEndingsPreserve), string(LineEndingsLF), string(LineEndingsCRLF)}
+
+// ParseLineEndings converts a flag or spec value to a LineEndings. The empty
+// string means LineEndingsPreserve.
+func ParseLineEndings(s string) (LineEndings, error) {
+	switch LineEndings(s) {
+	case "", LineEndingsPreserve:
+		return LineEndingsPreserve, nil
+	case LineEndingsLF, LineEndingsCRLF:
+		return LineEndings(s), nil
+	default:
+		return "", fmt.Errorf("invalid line endings %q, must be one of %s", s, strings.Join(LineEndingsValues, ", "))
+	}
+}
+
+// utf8BOM is the UTF-8 encoding of the byte order mark U+FEFF.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// binarySniffLen is how many bytes at the start of a file are checked by
+// IsBinary. This is the same heuristic that git uses.
+const binarySniffLen = 8000
+
+// IsBinary guesses whether buf is the contents of a binary file rather than a
+// text file, by looking for a NUL byte near the beginning.
+func IsBinary(buf []byte) bool {
+	return bytes.IndexByte(buf[:min(len(buf), binarySniffLen)], 0) >= 0
+}
+
+// NormalizeText converts the line endings of the text file contents in buf,
+// and removes a leading UTF-8 byte order mark if stripBOM is true. Binary
+// files, as determined by IsBinary, are returned unchanged.
+func NormalizeText(buf []byte, le LineEndings, stripBOM bool) []byte {
+	if IsBinary(buf) {
+		return buf
+	}
+	if stripBOM {
+		buf = bytes.TrimPrefix(buf, utf8BOM)
+	}
+	switch le {
+	case LineEndingsLF:
+		buf = bytes.ReplaceAll(buf, []byte("\r\n"), []byte("\n"))
+	case LineEndingsCRLF:
+		// Convert to LF first, so existing CRLFs don't become CRCRLF.
+		buf = bytes.ReplaceAll(buf, []byte("\r\n"), []byte("\n"))
+		buf = bytes.ReplaceAll(buf, []byte("\n"), []byte("\r\n"))
+	}
+	return buf
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestNormalizeText(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		in       string
+		le       LineEndings
+		stripBOM bool
+		want     string
+	}{
+		{
+			name: "preserve",
+			in:   "\xef\xbb\xbfa\r\nb\nc",
+			le:   LineEndingsPreserve,
+			want: "\xef\xbb\xbfa\r\nb\nc",
+		},
+		{
+			name: "lf",
+			in:   "a\r\nb\nc\r\n",
+			le:   LineEndingsLF,
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "crlf",
+			in:   "a\r\nb\nc\n",
+			le:   LineEndingsCRLF,
+			want: "a\r\nb\r\nc\r\n",
+		},
+		{
+			name: "lone_cr_is_unchanged",
+			in:   "a\rb\n",
+			le:   LineEndingsLF,
+			want: "a\rb\n",
+		},
+		{
+			name:     "strip_bom",
+			in:       "\xef\xbb\xbfa\n",
+			le:       LineEndingsPreserve,
+			stripBOM: true,
+			want:     "a\n",
+		},
+		{
+			name:     "bom_not_at_start_is_kept",
+			in:       "a\xef\xbb\xbf\n",
+			le:       LineEndingsPreserve,
+			stripBOM: true,
+			want:     "a\xef\xbb\xbf\n",
+		},
+		{
+			name:     "binary_is_unchanged",
+			in:       "\xef\xbb\xbfa\x00\r\n",
+			le:       LineEndingsLF,
+			stripBOM: true,
+			want:     "\xef\xbb\xbfa\x00\r\n",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := string(NormalizeText([]byte(tc.in), tc.le, tc.stripBOM))
+			if got != tc.want {
+				t.Errorf("NormalizeText(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseLineEndings(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in      string
+		want    LineEndings
+		wantErr string
+	}{
+		{in: "", want: LineEndingsPreserve},
+		{in: "preserve", want: LineEndingsPreserve},
+		{in: "lf", want: LineEndingsLF},
+		{in: "crlf", want: LineEndingsCRLF},
+		{in: "cr", wantErr: `invalid line endings "cr", must be one of preserve, lf, crlf`},
+	}
+
+	for _, tc := range cases {
+		got, err := ParseLineEndings(tc.in)
+		if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+			t.Errorf("ParseLineEndings(%q): %s", tc.in, diff)
+		}
+		if got != tc.want {
+			t.Errorf("ParseLineEndings(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifestutil finds and reads the manifests that renders leave in
+// the .abc directories of destinations, and compares them with the files
+// that are there now.
+package manifestutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/genmarker"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	"github.com/abcxyz/abc/templates/model/decode"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+)
+
+// FileSuffix is the end of the name of every manifest file.
+const FileSuffix = ".lock.yaml"
+
+// Find returns the paths of the manifest files in the .abc directories under
+// dir, in lexical order. Git directories aren't searched.
+func Find(fsys common.FS, dir string) ([]string, error) {
+	var out []string
+	if err := fs.WalkDir(fsys, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			if de.Name() == ".git" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filepath.Base(filepath.Dir(path)) == common.ABCInternalDir && strings.HasSuffix(de.Name(), FileSuffix) {
+			out = append(out, path)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed searching for manifests in %q: %w", dir, err)
+	}
+	return out, nil
+}
+
+// Load reads, validates, and upgrades the manifest at path. It also returns
+// the file's contents, for callers that edit it.
+func Load(ctx context.Context, fsys common.FS, path string) (*manifest.Manifest, []byte, error) {
+	buf, err := fsys.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading manifest: %w", err)
+	}
+	decoded, err := decode.DecodeValidateUpgrade(ctx, bytes.NewReader(buf), path, decode.KindManifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading manifest file: %w", err)
+	}
+	m, ok := decoded.(*manifest.Manifest)
+	if !ok {
+		return nil, nil, fmt.Errorf("internal error: manifest file did not decode to *manifest.Manifest")
+	}
+	return m, buf, nil
+}
+
+// DestDir returns the destination directory of the manifest at path, which is
+// the parent of its .abc directory.
+func DestDir(path string) string {
+	return filepath.Dir(filepath.Dir(path))
+}
+
+// Drift returns the output files of the manifest that have been changed or
+// removed in destDir since they were rendered, with forward slashes, in the
+// order of the manifest. A symlink has drifted if its target changed. Each file
+// is hashed with the algorithm of its own output_hashes entry. Files marked
+// included_from_dest are left out, since they belong to the user, who may
+// change them freely.
+func Drift(fsys common.FS, destDir string, m *manifest.Manifest) ([]string, error) {
+	var out []string
+	for _, oh := range m.OutputHashes {
+		if oh.IncludedFromDest.Val {
+			continue
+		}
+		path := filepath.Join(destDir, filepath.FromSlash(oh.File.Val))
+		changed, err := fileChanged(fsys, path, oh)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			out = append(out, oh.File.Val)
+		}
+	}
+	return out, nil
+}
+
+// UserOwned returns the output files of the manifest that users have taken
+// over since they were rendered into destDir, and that an upgrade therefore
+// mustn't regenerate, with forward slashes, in the order of the manifest.
+// They're the files that have drifted (see Drift), except those that still
+// have the comment that marks them as generated (see genmarker), which says
+// that edits to them aren't kept. Files marked skip_if_exists are left out,
+// since upgrades never write them anyway, and so are files marked
+// included_from_dest, since upgrades modify them as they are now, keeping the
+// user's changes.
+func UserOwned(fsys common.FS, destDir string, m *manifest.Manifest) ([]string, error) {
+	var out []string
+	for _, oh := range m.OutputHashes {
+		if oh.SkipIfExists.Val || oh.IncludedFromDest.Val {
+			continue
+		}
+		path := filepath.Join(destDir, filepath.FromSlash(oh.File.Val))
+		changed, err := fileChanged(fsys, path, oh)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+		if oh.SymlinkTarget.Val == "" {
+			marked, err := hasMarker(fsys, path)
+			if err != nil {
+				return nil, err
+			}
+			if marked {
+				continue
+			}
+		}
+		out = append(out, oh.File.Val)
+	}
+	return out, nil
+}
+
+// hasMarker returns whether the file at path has a generated marker. A
+// missing file has none.
+func hasMarker(fsys common.FS, path string) (bool, error) {
+	buf, err := fsys.ReadFile(path)
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed reading output file: %w", err)
+	}
+	return genmarker.Has(buf), nil
+}
+
+func fileChanged(fsys common.FS, path string, oh *manifest.OutputHash) (bool, error) {
+	if oh.SymlinkTarget.Val != "" {
+		target, ok, err := common.ReadlinkIfSymlink(fsys, path)
+		if err != nil {
+			if common.IsStatNotExistErr(err) {
+				return true, nil
+			}
+			return false, err //nolint:wrapcheck
+		}
+		return !ok || filepath.ToSlash(target) != oh.SymlinkTarget.Val, nil
+	}
+
+	buf, err := fsys.ReadFile(path)
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed reading output file: %w", err)
+	}
+	ok, err := hashalg.Verify(oh.Hash.Val, buf)
+	if err != nil {
+		return false, fmt.Errorf("can't check %q: %w", oh.File.Val, err)
+	}
+	return !ok, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifestutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	"github.com/abcxyz/abc/templates/model"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		".abc/manifest_a.lock.yaml":      "",
+		"b/.abc/manifest_b.lock.yaml":    "",
+		"b/.abc/protect.yaml":            "",
+		"b/manifest_c.lock.yaml":         "", // not in .abc
+		".git/.abc/manifest_d.lock.yaml": "", // in .git
+	})
+
+	got, err := Find(&common.RealFS{}, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(tempDir, ".abc", "manifest_a.lock.yaml"),
+		filepath.Join(tempDir, "b", ".abc", "manifest_b.lock.yaml"),
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Find() was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		"same.txt":     "hello",
+		"changed.txt":  "goodbye",
+		"sub/same.txt": "hello",
+		"users.txt":    "goodbye",
+	})
+	if err := os.Symlink("same.txt", filepath.Join(tempDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("changed.txt", filepath.Join(tempDir, "moved_link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A manifest can mix hash algorithms, like after the default changes.
+	hash := hashalg.SHA256.Sum([]byte("hello"))
+	hash512 := hashalg.SHA512.Sum([]byte("hello"))
+	m := &manifest.Manifest{
+		OutputHashes: []*manifest.OutputHash{
+			{File: model.String{Val: "same.txt"}, Hash: model.String{Val: hash}},
+			{File: model.String{Val: "changed.txt"}, Hash: model.String{Val: hash}},
+			{File: model.String{Val: "sub/same.txt"}, Hash: model.String{Val: hash512}},
+			{File: model.String{Val: "removed.txt"}, Hash: model.String{Val: hash512}},
+			{File: model.String{Val: "users.txt"}, Hash: model.String{Val: hash}, IncludedFromDest: model.Bool{Val: true}},
+			{File: model.String{Val: "link"}, SymlinkTarget: model.String{Val: "same.txt"}},
+			{File: model.String{Val: "moved_link"}, SymlinkTarget: model.String{Val: "same.txt"}},
+			{File: model.String{Val: "removed_link"}, SymlinkTarget: model.String{Val: "same.txt"}},
+		},
+	}
+
+	got, err := Drift(&common.RealFS{}, tempDir, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"changed.txt", "removed.txt", "moved_link", "removed_link"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Drift() was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestDrift_UnknownAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		"a.txt": "hello",
+	})
+	m := &manifest.Manifest{
+		OutputHashes: []*manifest.OutputHash{
+			{File: model.String{Val: "a.txt"}, Hash: model.String{Val: "future:AAAA"}},
+		},
+	}
+
+	_, err := Drift(&common.RealFS{}, tempDir, m)
+	if diff := testutil.DiffErrString(err, `can't check "a.txt": the hash "future:AAAA" was made with an unknown algorithm "future"`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestUserOwned(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, tempDir, map[string]string{
+		"same.go":     "package same",
+		"edited.go":   "package edited\n\nfunc Mine() {}",
+		"marked.go":   "// Code generated by abc from x@v1. DO NOT EDIT.\n\npackage marked\n\nfunc Mine() {}",
+		"unmarked.go": "package unmarked\n\nfunc Mine() {}",
+		"config.yaml": "replicas: 3",
+		"go.mod":      "module example.com/mine\n\nrequire example.com/lib v1.0.0",
+	})
+	if err := os.Symlink("same.go", filepath.Join(tempDir, "moved_link")); err != nil {
+		t.Fatal(err)
+	}
+
+	hash := func(s string) string { return hashalg.SHA256.Sum([]byte(s)) }
+	m := &manifest.Manifest{
+		OutputHashes: []*manifest.OutputHash{
+			{File: model.String{Val: "same.go"}, Hash: model.String{Val: hash("package same")}},
+			{File: model.String{Val: "edited.go"}, Hash: model.String{Val: hash("package edited")}},
+			{File: model.String{Val: "marked.go"}, Hash: model.String{Val: hash("package marked")}},
+			{File: model.String{Val: "unmarked.go"}, Hash: model.String{Val: hash("// Code generated by abc. DO NOT EDIT.\n\npackage unmarked")}},
+			{File: model.String{Val: "removed.go"}, Hash: model.String{Val: hash("package removed")}},
+			{File: model.String{Val: "config.yaml"}, Hash: model.String{Val: hash("replicas: 1")}, SkipIfExists: model.Bool{Val: true}},
+			{File: model.String{Val: "go.mod"}, Hash: model.String{Val: hash("module example.com/mine")}, IncludedFromDest: model.Bool{Val: true}},
+			{File: model.String{Val: "moved_link"}, SymlinkTarget: model.String{Val: "edited.go"}},
+		},
+	}
+
+	got, err := UserOwned(&common.RealFS{}, tempDir, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"edited.go", "unmarked.go", "removed.go", "moved_link"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("UserOwned() was not as expected (-got,+want): %s", diff)
+	}
+}
@@ -0,0 +1,443 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memTempDir is the directory used by MemFS.MkdirTemp when no directory is
+// given, analogous to os.TempDir().
+const memTempDir = "/tmp"
+
+var (
+	_ FS           = (*MemFS)(nil)
+	_ fs.ReadDirFS = (*MemFS)(nil)
+)
+
+// MemFS is an in-memory implementation of FS. Nothing is ever written to the
+// real filesystem. This allows rendering without touching the disk, which is
+// useful for servers and for tests.
+//
+// Paths are interpreted as absolute paths with OS-native separators; relative
+// paths are treated as relative to the root directory. The root directory
+// always exists.
+//
+// Operations that shell out to other programs, like git, can't see the
+// contents of a MemFS. So templates that are downloaded from a remote git repo
+// can't be rendered using a MemFS.
+//
+// The zero value is an empty filesystem that's ready to use. It's safe for
+// concurrent use.
+type MemFS struct {
+	mu sync.Mutex
+
+	// Keys are cleaned absolute paths. The root directory is implicit and
+	// has no entry.
+	nodes map[string]*memNode
+
+	// Incremented for each call to MkdirTemp to generate unique names.
+	tempCounter int
+}
+
+type memNode struct {
+	data    []byte
+	mode    fs.FileMode // includes fs.ModeDir for directories
+	modTime time.Time
+}
+
+func (m *MemFS) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.getLocked("chmod", memClean(name))
+	if err != nil {
+		return err
+	}
+	n.mode = n.mode&^fs.ModePerm | mode.Perm()
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAllLocked(memClean(name), perm)
+}
+
+func (m *MemFS) mkdirAllLocked(name string, perm os.FileMode) error {
+	if name == memRoot {
+		return nil
+	}
+	if n, ok := m.nodes[name]; ok {
+		if n.mode.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	if err := m.mkdirAllLocked(filepath.Dir(name), perm); err != nil {
+		return err
+	}
+	m.setLocked(name, &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()})
+	return nil
+}
+
+func (m *MemFS) MkdirTemp(dir, pattern string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if dir == "" {
+		dir = memTempDir
+		if err := m.mkdirAllLocked(dir, OwnerRWXPerms); err != nil {
+			return "", err
+		}
+	}
+	dir = memClean(dir)
+	if err := m.checkDirLocked("mkdirtemp", dir); err != nil {
+		return "", err
+	}
+
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	for {
+		m.tempCounter++
+		name := filepath.Join(dir, fmt.Sprintf("%s%d%s", prefix, m.tempCounter, suffix))
+		if _, ok := m.nodes[name]; ok {
+			continue
+		}
+		m.setLocked(name, &memNode{mode: fs.ModeDir | OwnerRWXPerms, modTime: time.Now()})
+		return name, nil
+	}
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memClean(name)
+	n, err := m.getLocked("open", name)
+	switch {
+	case err == nil:
+		if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+	case flag&os.O_CREATE != 0 && IsStatNotExistErr(err):
+		if err := m.checkDirLocked("open", filepath.Dir(name)); err != nil {
+			return nil, err
+		}
+		n = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.setLocked(name, n)
+	default:
+		return nil, err
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if n.mode.IsDir() && writable {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	if writable && flag&os.O_TRUNC != 0 {
+		n.data = nil
+		n.modTime = time.Now()
+	}
+
+	f := &memFile{
+		fs:       m,
+		name:     name,
+		node:     n,
+		writable: writable,
+	}
+	if flag&os.O_APPEND != 0 {
+		f.offset = len(n.data)
+	}
+	return f, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memClean(name)
+	if err := m.checkDirLocked("readdir", name); err != nil {
+		return nil, err
+	}
+	return m.readDirLocked(name), nil
+}
+
+func (m *MemFS) readDirLocked(dir string) []fs.DirEntry {
+	var out []fs.DirEntry
+	for path, n := range m.nodes {
+		if path != memRoot && filepath.Dir(path) == dir {
+			out = append(out, fs.FileInfoToDirEntry(n.info(path)))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name() < out[j].Name()
+	})
+	return out
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memClean(name)
+	n, err := m.getLocked("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	return append([]byte(nil), n.data...), nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memClean(name)
+	for path := range m.nodes {
+		if isSameOrUnder(path, name) {
+			delete(m.nodes, path)
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Rename(from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from, to = memClean(from), memClean(to)
+	if from == to {
+		return nil
+	}
+	if _, err := m.getLocked("rename", from); err != nil {
+		return err
+	}
+	if err := m.checkDirLocked("rename", filepath.Dir(to)); err != nil {
+		return err
+	}
+	if isSameOrUnder(to, from) {
+		return &fs.PathError{Op: "rename", Path: from, Err: fs.ErrInvalid}
+	}
+
+	for path, n := range m.nodes {
+		if isSameOrUnder(path, from) {
+			delete(m.nodes, path)
+			m.setLocked(to+strings.TrimPrefix(path, from), n)
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memClean(name)
+	n, err := m.getLocked("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(name), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Close() //nolint:wrapcheck
+}
+
+// memRoot is the root directory of a MemFS.
+var memRoot = string(filepath.Separator)
+
+// memClean converts the given path to the cleaned absolute form used as a key
+// in MemFS.nodes.
+func memClean(name string) string {
+	return filepath.Join(memRoot, name)
+}
+
+// isSameOrUnder returns whether path is equal to dir or is inside of it.
+func isSameOrUnder(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if dir == memRoot {
+		return true
+	}
+	return strings.HasPrefix(path, dir+memRoot)
+}
+
+// getLocked returns the node at the given cleaned path. The root directory is
+// synthesized since it has no entry.
+func (m *MemFS) getLocked(op, name string) (*memNode, error) {
+	if name == memRoot {
+		return &memNode{mode: fs.ModeDir | OwnerRWXPerms}, nil
+	}
+	n, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+// checkDirLocked returns an error unless the given cleaned path is an existing
+// directory.
+func (m *MemFS) checkDirLocked(op, name string) error {
+	n, err := m.getLocked(op, name)
+	if err != nil {
+		return err
+	}
+	if !n.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return nil
+}
+
+func (m *MemFS) setLocked(name string, n *memNode) {
+	if m.nodes == nil {
+		m.nodes = map[string]*memNode{}
+	}
+	m.nodes[name] = n
+}
+
+func (n *memNode) info(path string) fs.FileInfo {
+	return &memFileInfo{
+		name:    filepath.Base(path),
+		size:    int64(len(n.data)),
+		mode:    n.mode,
+		modTime: n.modTime,
+	}
+}
+
+// memFile is an open file or directory in a MemFS.
+type memFile struct {
+	fs       *MemFS
+	name     string
+	node     *memNode
+	writable bool
+
+	offset    int // the read/write position for files
+	dirOffset int // the number of entries already returned by ReadDir
+	closed    bool
+}
+
+var _ fs.ReadDirFile = (*memFile)(nil)
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.node.mode.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fmt.Errorf("is a directory")}
+	}
+	if f.offset >= len(f.node.data) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.node.data[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+func (f *memFile) Write(b []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	if !f.writable {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	end := f.offset + len(b)
+	if end > len(f.node.data) {
+		grown := make([]byte, end)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+	copy(f.node.data[f.offset:], b)
+	f.offset = end
+	f.node.modTime = time.Now()
+	return len(b), nil
+}
+
+func (f *memFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if !f.node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fmt.Errorf("not a directory")}
+	}
+	entries := f.fs.readDirLocked(f.name)
+	entries = entries[min(f.dirOffset, len(entries)):]
+	if count > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+	f.dirOffset += len(entries)
+	return entries, nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memFileInfo) Sys() any           { return nil }
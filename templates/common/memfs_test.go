@@ -0,0 +1,281 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestMemFS_Operations(t *testing.T) {
+	t.Parallel()
+
+	m := &MemFS{}
+
+	if err := m.MkdirAll("/a/b", OwnerRWXPerms); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteFile("/a/b/file.txt", []byte("hello"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteFile("/a/top.txt", []byte("top"), OwnerRWPerms); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := m.Stat("/a/b/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fi.Mode(), fs.FileMode(0o640); got != want {
+		t.Errorf("got mode %v, want %v", got, want)
+	}
+	if got, want := fi.Size(), int64(5); got != want {
+		t.Errorf("got size %d, want %d", got, want)
+	}
+
+	// Chmod changes only the permission bits.
+	if err := m.Chmod("/a/b/file.txt", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err = m.Stat("/a/b/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fi.Mode(), fs.FileMode(0o755); got != want {
+		t.Errorf("got mode %v after Chmod, want %v", got, want)
+	}
+
+	// Appending to an existing file.
+	f, err := m.OpenFile("/a/b/file.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(" world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.ReadFile("/a/b/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello world" {
+		t.Errorf("got contents %q, want %q", got, "hello world")
+	}
+
+	// Walking returns every path in lexical order.
+	var walked []string
+	if err := fs.WalkDir(m, "/a", func(path string, _ fs.DirEntry, err error) error {
+		walked = append(walked, path)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	wantWalked := []string{"/a", "/a/b", "/a/b/file.txt", "/a/top.txt"}
+	if diff := cmp.Diff(walked, wantWalked); diff != "" {
+		t.Errorf("walked paths were not as expected (-got,+want): %s", diff)
+	}
+
+	// Renaming a directory moves its contents.
+	if err := m.Rename("/a/b", "/a/c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Stat("/a/b/file.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v after rename, want fs.ErrNotExist", err)
+	}
+	if _, err := m.Stat("/a/c/file.txt"); err != nil {
+		t.Errorf("Stat() after rename: %v", err)
+	}
+
+	// RemoveAll removes the directory and everything under it, but not
+	// siblings whose names share a prefix.
+	if err := m.WriteFile("/a/cc", []byte("sibling"), OwnerRWPerms); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveAll("/a/c"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := m.ReadDir("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if diff := cmp.Diff(names, []string{"cc", "top.txt"}); diff != "" {
+		t.Errorf("directory entries were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestMemFS_MkdirTemp(t *testing.T) {
+	t.Parallel()
+
+	m := &MemFS{}
+	dir1, err := m.MkdirTemp("", "foo-*-bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir2, err := m.MkdirTemp("", "foo-*-bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir1 == dir2 {
+		t.Errorf("MkdirTemp returned %q twice", dir1)
+	}
+	for _, d := range []string{dir1, dir2} {
+		if !strings.HasPrefix(filepath.Base(d), "foo-") || !strings.HasSuffix(d, "-bar") {
+			t.Errorf("temp dir %q doesn't match pattern", d)
+		}
+		if fi, err := m.Stat(d); err != nil || !fi.IsDir() {
+			t.Errorf("temp dir %q wasn't created: %v", d, err)
+		}
+	}
+
+	if _, err := m.MkdirTemp("/nonexistent", "x"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestMemFS_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		op      func(m *MemFS) error
+		wantErr string
+	}{
+		{
+			name: "write_file_missing_parent",
+			op: func(m *MemFS) error {
+				return m.WriteFile("/missing/file.txt", nil, OwnerRWPerms)
+			},
+			wantErr: "file does not exist",
+		},
+		{
+			name: "read_missing_file",
+			op: func(m *MemFS) error {
+				_, err := m.ReadFile("/missing.txt")
+				return err
+			},
+			wantErr: "file does not exist",
+		},
+		{
+			name: "mkdir_through_file",
+			op: func(m *MemFS) error {
+				if err := m.WriteFile("/file", nil, OwnerRWPerms); err != nil {
+					return err
+				}
+				return m.MkdirAll("/file/dir", OwnerRWXPerms)
+			},
+			wantErr: "not a directory",
+		},
+		{
+			name: "exclusive_create_existing",
+			op: func(m *MemFS) error {
+				if err := m.WriteFile("/file", nil, OwnerRWPerms); err != nil {
+					return err
+				}
+				_, err := m.OpenFile("/file", os.O_CREATE|os.O_EXCL|os.O_WRONLY, OwnerRWPerms)
+				return err
+			},
+			wantErr: "file already exists",
+		},
+		{
+			name: "write_to_read_only_file",
+			op: func(m *MemFS) error {
+				if err := m.WriteFile("/file", nil, OwnerRWPerms); err != nil {
+					return err
+				}
+				f, err := m.OpenFile("/file", os.O_RDONLY, 0)
+				if err != nil {
+					return err
+				}
+				_, err = f.Write([]byte("x"))
+				return err
+			},
+			wantErr: "permission denied",
+		},
+		{
+			name: "rename_into_itself",
+			op: func(m *MemFS) error {
+				if err := m.MkdirAll("/a/b", OwnerRWXPerms); err != nil {
+					return err
+				}
+				return m.Rename("/a", "/a/b/c")
+			},
+			wantErr: "invalid argument",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.op(&MemFS{})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestMemFS_CopyRecursiveFromRealFS(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	srcDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcDir, "dir"), OwnerRWXPerms); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "dir", "file.txt"), []byte("contents"), OwnerRWPerms); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &MemFS{}
+	if err := CopyRecursive(ctx, nil, &CopyParams{
+		SrcRoot: srcDir,
+		DstRoot: "/dest",
+		FS:      m,
+		SrcFS:   &RealFS{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := m.Open("/dest/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "contents" {
+		t.Errorf("got %q, want %q", got, "contents")
+	}
+}
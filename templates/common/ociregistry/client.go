@@ -0,0 +1,398 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ociregistry is a small client for the parts of the OCI distribution
+// API (https://github.com/opencontainers/distribution-spec/blob/main/spec.md)
+// that are needed to publish templates to a container registry.
+package ociregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/archive"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// repoComponentRE matches one "/"-separated component of a repository name, as
+// defined by the distribution spec.
+var repoComponentRE = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*$`)
+
+// Repository is a repository in a registry, like the "my-org/my-template" part
+// of "ghcr.io/my-org/my-template".
+type Repository struct {
+	// Registry is the host, and optional port, of the registry.
+	Registry string
+
+	// Name is the path of the repository within the registry.
+	Name string
+}
+
+func (r *Repository) String() string {
+	return r.Registry + "/" + r.Name
+}
+
+// ParseRepository parses a repository reference like
+// "us-docker.pkg.dev/my-project/my-repo/my-template". The registry host is
+// required, so unlike with docker, there's no default registry.
+func ParseRepository(s string) (*Repository, error) {
+	registry, name, ok := strings.Cut(s, "/")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("the repository %q must be like <registry>/<name>, like ghcr.io/my-org/my-template", s)
+	}
+	if !strings.ContainsAny(registry, ".:") && registry != "localhost" {
+		return nil, fmt.Errorf("the repository %q must start with a registry host name, like ghcr.io", s)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if !repoComponentRE.MatchString(part) {
+			return nil, fmt.Errorf("the repository name %q isn't valid; each part must be lowercase letters and digits, separated by '.', '_', or '-'", name)
+		}
+	}
+	return &Repository{Registry: registry, Name: name}, nil
+}
+
+// ClientParams configures a Client.
+type ClientParams struct {
+	// Username and Password are sent to the registry, or to its token server,
+	// when it asks for authentication. They're optional for registries that
+	// allow anonymous access.
+	Username string
+	Password string
+
+	// PlainHTTP uses http:// instead of https:// to connect to the registry.
+	// This is only for local test registries.
+	PlainHTTP bool
+
+	// HTTPClient is optional, and defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Client talks to OCI registries. It handles the "Basic" and "Bearer"
+// (token server) authentication schemes that registries commonly use.
+type Client struct {
+	params     *ClientParams
+	httpClient *http.Client
+
+	// authHeader is the value of the Authorization header that worked for the
+	// most recent request, so it's reused without another round trip to the
+	// token server.
+	authHeader string
+}
+
+// NewClient returns a Client.
+func NewClient(params *ClientParams) *Client {
+	httpClient := params.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		params:     params,
+		httpClient: httpClient,
+	}
+}
+
+// TagExists returns whether the tag exists in repo.
+func (c *Client) TagExists(ctx context.Context, repo *Repository, tag string) (bool, error) {
+	return c.exists(ctx, repo, c.url(repo, "manifests", tag), archive.MediaTypeOCIManifest)
+}
+
+// Push uploads img to repo and points tag at it. Blobs that are already in
+// repo aren't uploaded again.
+func (c *Client) Push(ctx context.Context, repo *Repository, tag string, img *archive.OCIImage) error {
+	logger := logging.FromContext(ctx).With("logger", "Push")
+
+	for _, blob := range []*archive.OCIBlob{img.Config, img.Layer} {
+		exists, err := c.exists(ctx, repo, c.url(repo, "blobs", blob.Digest), "")
+		if err != nil {
+			return err
+		}
+		if exists {
+			logger.DebugContext(ctx, "blob already exists in registry", "digest", blob.Digest)
+			continue
+		}
+		if err := c.pushBlob(ctx, repo, blob); err != nil {
+			return err
+		}
+		logger.DebugContext(ctx, "pushed blob", "digest", blob.Digest, "size", len(blob.Contents))
+	}
+
+	if _, err := c.do(ctx, repo, &request{
+		method:      http.MethodPut,
+		url:         c.url(repo, "manifests", tag),
+		contentType: img.Manifest.MediaType,
+		body:        img.Manifest.Contents,
+		wantStatus:  http.StatusCreated,
+	}); err != nil {
+		return fmt.Errorf("failed pushing manifest for %s:%s: %w", repo, tag, err)
+	}
+	logger.DebugContext(ctx, "pushed manifest", "tag", tag, "digest", img.Manifest.Digest)
+	return nil
+}
+
+// pushBlob uploads a blob with a "monolithic" upload: a POST to start the
+// upload session, then a single PUT with the whole contents.
+func (c *Client) pushBlob(ctx context.Context, repo *Repository, blob *archive.OCIBlob) error {
+	startURL := c.url(repo, "blobs", "uploads") + "/"
+	resp, err := c.do(ctx, repo, &request{
+		method:     http.MethodPost,
+		url:        startURL,
+		wantStatus: http.StatusAccepted,
+	})
+	if err != nil {
+		return fmt.Errorf("failed starting upload of blob %s: %w", blob.Digest, err)
+	}
+
+	// The location may be relative to the registry, and may already have a
+	// query string.
+	loc, err := url.Parse(startURL)
+	if err != nil {
+		return fmt.Errorf("url.Parse(): %w", err)
+	}
+	if loc, err = loc.Parse(resp.location); err != nil {
+		return fmt.Errorf("the registry returned an invalid upload location %q: %w", resp.location, err)
+	}
+	q := loc.Query()
+	q.Set("digest", blob.Digest)
+	loc.RawQuery = q.Encode()
+
+	if _, err := c.do(ctx, repo, &request{
+		method:      http.MethodPut,
+		url:         loc.String(),
+		contentType: "application/octet-stream",
+		body:        blob.Contents,
+		wantStatus:  http.StatusCreated,
+	}); err != nil {
+		return fmt.Errorf("failed uploading blob %s: %w", blob.Digest, err)
+	}
+	return nil
+}
+
+// exists sends a HEAD request for a manifest or blob, and returns whether it
+// exists.
+func (c *Client) exists(ctx context.Context, repo *Repository, u, accept string) (bool, error) {
+	resp, err := c.do(ctx, repo, &request{
+		method:     http.MethodHead,
+		url:        u,
+		accept:     accept,
+		wantStatus: http.StatusOK,
+		okStatuses: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.status == http.StatusOK, nil
+}
+
+func (c *Client) url(repo *Repository, kind, ref string) string {
+	scheme := "https"
+	if c.params.PlainHTTP {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s/%s", scheme, repo.Registry, repo.Name, kind, ref)
+}
+
+type request struct {
+	method      string
+	url         string
+	accept      string
+	contentType string
+	body        []byte
+
+	// wantStatus is the expected response status. okStatuses are other
+	// statuses that aren't errors.
+	wantStatus int
+	okStatuses []int
+}
+
+type response struct {
+	status   int
+	location string
+}
+
+// do sends req, authenticating and retrying once if the registry asks for
+// authentication.
+func (c *Client) do(ctx context.Context, repo *Repository, req *request) (*response, error) {
+	resp, challenge, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		if err := c.authenticate(ctx, repo, challenge); err != nil {
+			return nil, err
+		}
+		if resp, _, err = c.send(ctx, req); err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			return nil, fmt.Errorf("%s %s: the registry rejected the credentials", req.method, req.url)
+		}
+	}
+	return resp, nil
+}
+
+// send sends req once. If the registry asks for authentication, it returns a
+// nil response and the WWW-Authenticate challenge.
+func (c *Client) send(ctx context.Context, req *request) (_ *response, challenge string, rErr error) {
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, req.url, bytes.NewReader(req.body))
+	if err != nil {
+		return nil, "", fmt.Errorf("NewRequest(): %w", err)
+	}
+	if req.accept != "" {
+		httpReq.Header.Set("Accept", req.accept)
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if c.authHeader != "" {
+		httpReq.Header.Set("Authorization", c.authHeader)
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s %s: %w", req.method, req.url, err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, httpResp.Body.Close())
+	}()
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, 4096))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed reading response to %s %s: %w", req.method, req.url, err)
+	}
+
+	if httpResp.StatusCode == http.StatusUnauthorized {
+		return nil, httpResp.Header.Get("WWW-Authenticate"), nil
+	}
+	if httpResp.StatusCode != req.wantStatus && !slices.Contains(req.okStatuses, httpResp.StatusCode) {
+		return nil, "", fmt.Errorf("%s %s: got status %q: %s", req.method, req.url, httpResp.Status, strings.TrimSpace(string(body)))
+	}
+	return &response{
+		status:   httpResp.StatusCode,
+		location: httpResp.Header.Get("Location"),
+	}, "", nil
+}
+
+// authenticate answers a WWW-Authenticate challenge from the registry by
+// setting c.authHeader.
+func (c *Client) authenticate(ctx context.Context, repo *Repository, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.params.Username == "" {
+			return fmt.Errorf("the registry %s requires a username and password", repo.Registry)
+		}
+		c.authHeader = "Basic " + base64.StdEncoding.EncodeToString([]byte(c.params.Username+":"+c.params.Password))
+		return nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, repo, params)
+		if err != nil {
+			return err
+		}
+		c.authHeader = "Bearer " + token
+		return nil
+	default:
+		return fmt.Errorf("the registry %s asked for authentication with an unsupported challenge %q", repo.Registry, challenge)
+	}
+}
+
+// fetchToken gets a token for pushing to repo from the token server named in
+// a Bearer challenge. See https://distribution.github.io/distribution/spec/auth/token/.
+func (c *Client) fetchToken(ctx context.Context, repo *Repository, params map[string]string) (_ string, rErr error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("the registry %s sent a Bearer challenge without a realm", repo.Registry)
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("the registry %s sent an invalid token realm %q: %w", repo.Registry, realm, err)
+	}
+	q := u.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	q.Set("scope", "repository:"+repo.Name+":pull,push")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("NewRequest(): %w", err)
+	}
+	if c.params.Username != "" {
+		req.SetBasicAuth(c.params.Username, c.params.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed getting a token from %s: %w", realm, err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, resp.Body.Close())
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed getting a token from %s: got status %q", realm, resp.Status)
+	}
+
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("failed parsing token response from %s: %w", realm, err)
+	}
+	if tok.Token != "" {
+		return tok.Token, nil
+	}
+	if tok.AccessToken != "" {
+		return tok.AccessToken, nil
+	}
+	return "", fmt.Errorf("the token response from %s didn't contain a token", realm)
+}
+
+// parseChallenge parses a WWW-Authenticate header value like
+// `Bearer realm="https://auth.example.com/token",service="registry.example.com"`
+// into its scheme and parameters. Quoted values may contain commas.
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var key string
+		key, rest, _ = strings.Cut(rest, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				val, rest = rest[1:], ""
+			} else {
+				val, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+		}
+		rest = strings.TrimLeft(rest, ", ")
+		if key != "" {
+			params[key] = strings.TrimSpace(val)
+		}
+	}
+	return scheme, params
+}
@@ -0,0 +1,214 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ociregistry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestParseRepository(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		in      string
+		want    *Repository
+		wantErr string
+	}{
+		{
+			name: "simple",
+			in:   "ghcr.io/my-org/my-template",
+			want: &Repository{Registry: "ghcr.io", Name: "my-org/my-template"},
+		},
+		{
+			name: "port",
+			in:   "localhost:5000/my-template",
+			want: &Repository{Registry: "localhost:5000", Name: "my-template"},
+		},
+		{
+			name: "localhost",
+			in:   "localhost/my_template",
+			want: &Repository{Registry: "localhost", Name: "my_template"},
+		},
+		{
+			name:    "no_registry",
+			in:      "my-org/my-template",
+			wantErr: "must start with a registry host name",
+		},
+		{
+			name:    "no_name",
+			in:      "ghcr.io",
+			wantErr: "must be like <registry>/<name>",
+		},
+		{
+			name:    "uppercase",
+			in:      "ghcr.io/My-Org/template",
+			wantErr: `the repository name "My-Org/template" isn't valid`,
+		},
+		{
+			name:    "empty_component",
+			in:      "ghcr.io/my-org//template",
+			wantErr: "isn't valid",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseRepository(tc.in)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("ParseRepository(%q) was not as expected (-got,+want): %s", tc.in, diff)
+			}
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	t.Parallel()
+
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull,push"`)
+	if scheme != "Bearer" {
+		t.Errorf("got scheme %q, want %q", scheme, "Bearer")
+	}
+	want := map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull,push",
+	}
+	if diff := cmp.Diff(params, want); diff != "" {
+		t.Errorf("params were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestClient_Push(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		auth     string
+		username string
+		password string
+		wantErr  string
+	}{
+		{
+			name: "anonymous",
+		},
+		{
+			name:     "basic_auth",
+			auth:     "basic",
+			username: "alice",
+			password: "s3cret",
+		},
+		{
+			name:     "bearer_token",
+			auth:     "bearer",
+			username: "alice",
+			password: "s3cret",
+		},
+		{
+			name:     "wrong_password",
+			auth:     "bearer",
+			username: "alice",
+			password: "wrong",
+			wantErr:  `got status "401 Unauthorized"`,
+		},
+		{
+			name:    "missing_basic_credentials",
+			auth:    "basic",
+			wantErr: "requires a username and password",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			reg := abctestutil.NewFakeRegistry(t, &abctestutil.FakeRegistryParams{
+				Auth:     tc.auth,
+				Username: "alice",
+				Password: "s3cret",
+			})
+
+			templateDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, templateDir, map[string]string{"spec.yaml": "spec contents"})
+			img, err := archive.BuildOCIImage(ctx, &common.RealFS{}, templateDir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			repo := &Repository{Registry: reg.Host, Name: "my-org/my-template"}
+			client := NewClient(&ClientParams{
+				Username:  tc.username,
+				Password:  tc.password,
+				PlainHTTP: true,
+			})
+
+			exists, err := client.TagExists(ctx, repo, "v1.0.0")
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if exists {
+				t.Fatal("got TagExists()=true before pushing, want false")
+			}
+
+			if err := client.Push(ctx, repo, "v1.0.0", img); err != nil {
+				t.Fatal(err)
+			}
+
+			if exists, err = client.TagExists(ctx, repo, "v1.0.0"); err != nil {
+				t.Fatal(err)
+			}
+			if !exists {
+				t.Error("got TagExists()=false after pushing, want true")
+			}
+			if got, want := string(reg.Manifest("my-org/my-template", "v1.0.0")), string(img.Manifest.Contents); got != want {
+				t.Errorf("got pushed manifest %s, want %s", got, want)
+			}
+			if got, want := string(reg.Blob(img.Layer.Digest)), string(img.Layer.Contents); got != want {
+				t.Errorf("the pushed layer was not as expected")
+			}
+
+			// Pushing a second tag reuses the blobs.
+			uploads := reg.Uploads()
+			if err := client.Push(ctx, repo, "v1.0.1", img); err != nil {
+				t.Fatal(err)
+			}
+			if got := reg.Uploads(); got != uploads {
+				t.Errorf("got %d blob uploads after pushing an existing image, want %d", got, uploads)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Owner is the user and group that own a file, by numeric ID. An ID of -1
+// means to leave it unchanged, as for os.Lchown.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// OwnerFromDest is the value of --chown that means to use the owner of the
+// destination directory.
+const OwnerFromDest = "dest"
+
+// ParseOwner parses an owner like "1000:1000", or just "1000" to leave the
+// group unchanged. The IDs must be numeric, since the users of the host often
+// don't exist in a container that writes to a bind mount.
+func ParseOwner(s string) (*Owner, error) {
+	uidStr, gidStr, hasGID := strings.Cut(s, ":")
+	uid, err := strconv.Atoi(uidStr)
+	if err != nil || uid < 0 {
+		return nil, fmt.Errorf("invalid owner %q, must be a numeric user ID, optionally followed by a colon and a numeric group ID, like 1000:1000", s)
+	}
+	gid := -1
+	if hasGID {
+		if gid, err = strconv.Atoi(gidStr); err != nil || gid < 0 {
+			return nil, fmt.Errorf("invalid group %q in owner %q, must be a numeric group ID", gidStr, s)
+		}
+	}
+	return &Owner{UID: uid, GID: gid}, nil
+}
+
+// ChownFS is implemented by filesystems that support changing the owner of
+// files. It's separate from FS so that filesystems that don't have owners,
+// like MemFS, don't need to implement it.
+type ChownFS interface {
+	// This method corresponds to the method in the "os" package of the same
+	// name.
+	Lchown(string, int, int) error
+}
+
+var _ ChownFS = (*RealFS)(nil)
+
+func (r *RealFS) Lchown(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid) //nolint:wrapcheck
+}
+
+// DirOwner returns the owner of dir, or of its nearest ancestor that exists if
+// it doesn't exist yet. It's an error if the owner isn't available, like on
+// Windows.
+func DirOwner(fsys FS, dir string) (*Owner, error) {
+	for d := dir; ; {
+		fi, err := fsys.Stat(d)
+		if err == nil {
+			owner, ok := fileOwner(fi)
+			if !ok {
+				return nil, fmt.Errorf("the owner of %q can't be determined on this platform", d)
+			}
+			return owner, nil
+		}
+		if !IsStatNotExistErr(err) {
+			return nil, fmt.Errorf("Stat(): %w", err)
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return nil, fmt.Errorf("no ancestor of %q exists", dir)
+		}
+		d = parent
+	}
+}
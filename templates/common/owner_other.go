@@ -0,0 +1,27 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix
+
+package common
+
+import (
+	"io/fs"
+)
+
+// fileOwner returns the owner of the file described by fi. Files don't have
+// numeric owners on this platform.
+func fileOwner(fs.FileInfo) (*Owner, bool) {
+	return nil, false
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestParseOwner(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in      string
+		want    *Owner
+		wantErr string
+	}{
+		{in: "1000:1001", want: &Owner{UID: 1000, GID: 1001}},
+		{in: "0:0", want: &Owner{UID: 0, GID: 0}},
+		{in: "1000", want: &Owner{UID: 1000, GID: -1}},
+		{in: "", wantErr: `invalid owner "", must be a numeric user ID`},
+		{in: "alice:staff", wantErr: `invalid owner "alice:staff"`},
+		{in: "-1", wantErr: `invalid owner "-1"`},
+		{in: "1000:", wantErr: `invalid group "" in owner "1000:"`},
+		{in: "1000:staff", wantErr: `invalid group "staff" in owner "1000:staff"`},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.in, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseOwner(tc.in)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("owner was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestDirOwner(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("files don't have numeric owners on Windows")
+	}
+
+	// Only the user is checked, since on some platforms a new directory gets
+	// the group of its parent rather than that of the process.
+	tempDir := t.TempDir()
+	for _, dir := range []string{tempDir, filepath.Join(tempDir, "not", "created")} {
+		got, err := DirOwner(&RealFS{}, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UID != os.Getuid() {
+			t.Errorf("DirOwner(%q) got user %d, want %d", dir, got.UID, os.Getuid())
+		}
+	}
+
+	if _, err := DirOwner(&MemFS{}, "/"); err == nil {
+		t.Error("DirOwner() on a MemFS succeeded, want an error since it has no owners")
+	}
+}
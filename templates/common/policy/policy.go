@@ -0,0 +1,220 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy checks the output of a render against an organization's
+// policies, like "every repo must have a CODEOWNERS file", before anything is
+// written to the destination.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+)
+
+// Input is what a policy is checked against.
+type Input struct {
+	// Source is the template location, as given by the user.
+	Source string `json:"source"`
+
+	// Inputs are the values of the template's inputs.
+	Inputs map[string]string `json:"inputs"`
+
+	// Files are the paths of the output files, relative to the destination,
+	// with "/" separators, in sorted order. Directories aren't listed.
+	Files []string `json:"files"`
+
+	// Dir is the directory containing the output files, for checks that need
+	// to read them. It's a temporary directory, not the destination.
+	Dir string `json:"-"`
+}
+
+// Violation is one way in which the output breaks a policy.
+type Violation struct {
+	// Policy names the policy that was violated, like the path of the policy
+	// file.
+	Policy string
+
+	// Message says what's wrong, like `required file "CODEOWNERS" is missing`.
+	Message string
+}
+
+// Checker checks the output of a render against a policy. It returns an error
+// only if the check couldn't be done; problems with the output are returned
+// as Violations.
+type Checker interface {
+	Check(ctx context.Context, in *Input) ([]*Violation, error)
+}
+
+// CheckerFunc is a Checker that's a plain function.
+type CheckerFunc func(ctx context.Context, in *Input) ([]*Violation, error)
+
+// Check implements Checker.
+func (f CheckerFunc) Check(ctx context.Context, in *Input) ([]*Violation, error) {
+	return f(ctx, in)
+}
+
+// ViolationError is returned by CheckAll when the output violates any
+// policies.
+type ViolationError struct {
+	Violations []*Violation
+}
+
+func (v *ViolationError) Error() string {
+	msgs := make([]string, 0, len(v.Violations))
+	for _, viol := range v.Violations {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", viol.Policy, viol.Message))
+	}
+	return fmt.Sprintf("the rendered output violates %d policy rule(s), so nothing was written:\n  %s",
+		len(v.Violations), strings.Join(msgs, "\n  "))
+}
+
+// CheckAll runs every checker against in, and returns a *ViolationError
+// listing all the violations if there are any. The error is in the
+// errs.ErrPolicyViolation category.
+func CheckAll(ctx context.Context, checkers []Checker, in *Input) error {
+	var violations []*Violation
+	for _, c := range checkers {
+		v, err := c.Check(ctx, in)
+		if err != nil {
+			return fmt.Errorf("failed checking policy: %w", err)
+		}
+		violations = append(violations, v...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return errs.Wrap(errs.ErrPolicyViolation, &ViolationError{Violations: violations})
+}
+
+// File is the contents of a policy file, as given to --policy-file. It has the
+// built-in rules, and optionally an OPA bundle of rego policies.
+type File struct {
+	// RequiredFiles are globs, in the syntax of "include" paths, that must
+	// each match at least one output file. For example, "CODEOWNERS" or
+	// ".github/workflows/*.yml".
+	RequiredFiles []string `yaml:"required_files"`
+
+	// ForbiddenFiles are globs that must not match any output file. For
+	// example, "**/*.pem".
+	ForbiddenFiles []string `yaml:"forbidden_files"`
+
+	// RequiredInputs are the names of template inputs that must have a
+	// non-empty value.
+	RequiredInputs []string `yaml:"required_inputs"`
+
+	// Rego, if set, evaluates a bundle of rego policies with the "opa" CLI.
+	Rego *Rego `yaml:"rego"`
+
+	// path is where the policy file was loaded from, which names the policy in
+	// violations.
+	path string
+}
+
+// Load reads and validates a policy file. A relative rego bundle path is
+// relative to the directory containing the policy file.
+func Load(rfs common.FS, path string) (*File, error) {
+	buf, err := rfs.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading policy file: %w", err)
+	}
+	out := &File{path: path}
+	dec := yaml.NewDecoder(strings.NewReader(string(buf)))
+	dec.KnownFields(true)
+	if err := dec.Decode(out); err != nil {
+		return nil, fmt.Errorf("failed parsing policy file %q: %w", path, err)
+	}
+	for _, g := range append(append([]string{}, out.RequiredFiles...), out.ForbiddenFiles...) {
+		if err := common.ValidateGlob(filepath.FromSlash(g)); err != nil {
+			return nil, fmt.Errorf("invalid glob %q in policy file %q: %w", g, path, err)
+		}
+	}
+	if out.Rego != nil {
+		if out.Rego.Bundle == "" {
+			return nil, fmt.Errorf(`policy file %q has a "rego" section without a "bundle"`, path)
+		}
+		if !filepath.IsAbs(out.Rego.Bundle) {
+			out.Rego.Bundle = filepath.Join(filepath.Dir(path), out.Rego.Bundle)
+		}
+		out.Rego.policy = path
+	}
+	return out, nil
+}
+
+// Check implements Checker.
+func (f *File) Check(ctx context.Context, in *Input) ([]*Violation, error) {
+	var out []*Violation
+	violate := func(format string, args ...any) {
+		out = append(out, &Violation{Policy: f.path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, g := range f.RequiredFiles {
+		matches, err := matchFiles(g, in.Files)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			violate("required file %q is missing", g)
+		}
+	}
+	for _, g := range f.ForbiddenFiles {
+		matches, err := matchFiles(g, in.Files)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			violate("file %q is forbidden by %q", m, g)
+		}
+	}
+	for _, name := range f.RequiredInputs {
+		if in.Inputs[name] == "" {
+			violate("input %q must have a value", name)
+		}
+	}
+
+	if f.Rego != nil {
+		v, err := f.Rego.Check(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v...)
+	}
+	return out, nil
+}
+
+// matchFiles returns the files that match the glob g. A file also matches if
+// it's inside a directory that matches, so "docs" requires some file in the
+// docs directory.
+func matchFiles(g string, files []string) ([]string, error) {
+	var out []string
+	for _, f := range files {
+		for rel := f; rel != "."; rel = filepath.Dir(rel) {
+			matched, err := common.MatchGlob(filepath.FromSlash(g), filepath.FromSlash(rel))
+			if err != nil {
+				return nil, fmt.Errorf("failed matching %q against %q: %w", f, g, err)
+			}
+			if matched {
+				out = append(out, f)
+				break
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		contents string
+		want     *File
+		wantErr  string
+	}{
+		{
+			name: "all_rules",
+			contents: `required_files: ['CODEOWNERS', '.github/workflows/*.yml']
+forbidden_files: ['**/*.pem']
+required_inputs: ['owner']
+rego:
+  bundle: 'bundle'
+  query: 'data.acme.deny'
+`,
+			want: &File{
+				RequiredFiles:  []string{"CODEOWNERS", ".github/workflows/*.yml"},
+				ForbiddenFiles: []string{"**/*.pem"},
+				RequiredInputs: []string{"owner"},
+				Rego:           &Rego{Bundle: "bundle", Query: "data.acme.deny"},
+			},
+		},
+		{
+			name:     "unknown_field",
+			contents: "required_file: ['CODEOWNERS']\n",
+			wantErr:  "field required_file not found",
+		},
+		{
+			name:     "bad_glob",
+			contents: "forbidden_files: ['src/a**']\n",
+			wantErr:  `invalid glob "src/a**"`,
+		},
+		{
+			name:     "rego_without_bundle",
+			contents: "rego:\n  query: 'data.acme.deny'\n",
+			wantErr:  `has a "rego" section without a "bundle"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, dir, map[string]string{"policy.yaml": tc.contents})
+			path := filepath.Join(dir, "policy.yaml")
+
+			got, err := Load(&common.RealFS{}, path)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.want != nil && tc.want.Rego != nil {
+				// A relative bundle is relative to the policy file.
+				tc.want.Rego.Bundle = filepath.Join(dir, tc.want.Rego.Bundle)
+			}
+			opts := []cmp.Option{
+				cmpopts.IgnoreUnexported(File{}, Rego{}),
+			}
+			if diff := cmp.Diff(got, tc.want, opts...); diff != "" {
+				t.Errorf("policy file was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestFileCheck(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		policy *File
+		files  []string
+		inputs map[string]string
+		want   []*Violation
+	}{
+		{
+			name: "all_satisfied",
+			policy: &File{
+				RequiredFiles:  []string{"CODEOWNERS", ".github/workflows/*.yml", "docs"},
+				ForbiddenFiles: []string{"**/*.pem"},
+				RequiredInputs: []string{"owner"},
+			},
+			files:  []string{".github/workflows/ci.yml", "CODEOWNERS", "docs/README.md", "main.go"},
+			inputs: map[string]string{"owner": "alice"},
+		},
+		{
+			name: "all_violated",
+			policy: &File{
+				RequiredFiles:  []string{"CODEOWNERS", "docs"},
+				ForbiddenFiles: []string{"**/*.pem"},
+				RequiredInputs: []string{"owner", "team"},
+				path:           "policy.yaml",
+			},
+			files:  []string{"certs/server.pem", "key.pem", "main.go"},
+			inputs: map[string]string{"owner": ""},
+			want: []*Violation{
+				{Policy: "policy.yaml", Message: `required file "CODEOWNERS" is missing`},
+				{Policy: "policy.yaml", Message: `required file "docs" is missing`},
+				{Policy: "policy.yaml", Message: `file "certs/server.pem" is forbidden by "**/*.pem"`},
+				{Policy: "policy.yaml", Message: `file "key.pem" is forbidden by "**/*.pem"`},
+				{Policy: "policy.yaml", Message: `input "owner" must have a value`},
+				{Policy: "policy.yaml", Message: `input "team" must have a value`},
+			},
+		},
+		{
+			name: "forbidden_directory",
+			policy: &File{
+				ForbiddenFiles: []string{"secrets"},
+			},
+			files: []string{"secrets/a.txt", "secrets/b.txt"},
+			want: []*Violation{
+				{Message: `file "secrets/a.txt" is forbidden by "secrets"`},
+				{Message: `file "secrets/b.txt" is forbidden by "secrets"`},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tc.policy.Check(context.Background(), &Input{Files: tc.files, Inputs: tc.inputs})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("violations were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	t.Parallel()
+
+	violates := func(msg string) Checker {
+		return CheckerFunc(func(context.Context, *Input) ([]*Violation, error) {
+			return []*Violation{{Policy: "p", Message: msg}}, nil
+		})
+	}
+	ok := CheckerFunc(func(context.Context, *Input) ([]*Violation, error) {
+		return nil, nil
+	})
+
+	if err := CheckAll(context.Background(), []Checker{ok, ok}, &Input{}); err != nil {
+		t.Errorf("CheckAll() with no violations returned error: %v", err)
+	}
+
+	err := CheckAll(context.Background(), []Checker{violates("one"), ok, violates("two")}, &Input{})
+	want := "the rendered output violates 2 policy rule(s), so nothing was written:\n  p: one\n  p: two"
+	if diff := testutil.DiffErrString(err, want); diff != "" {
+		t.Error(diff)
+	}
+	if !errors.Is(err, errs.ErrPolicyViolation) {
+		t.Errorf("got error %v, want one that's an ErrPolicyViolation", err)
+	}
+	var verr *ViolationError
+	if !errors.As(err, &verr) || len(verr.Violations) != 2 {
+		t.Errorf("got error %v, want a *ViolationError with 2 violations", err)
+	}
+
+	broken := CheckerFunc(func(context.Context, *Input) ([]*Violation, error) {
+		return nil, fmt.Errorf("opa not found")
+	})
+	err = CheckAll(context.Background(), []Checker{broken}, &Input{})
+	if diff := testutil.DiffErrString(err, "failed checking policy: opa not found"); diff != "" {
+		t.Error(diff)
+	}
+	if errors.Is(err, errs.ErrPolicyViolation) {
+		t.Errorf("a failure to check a policy must not be an ErrPolicyViolation, got %v", err)
+	}
+}
+
+func TestParseOPAOutput(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "undefined",
+			in:   `{}`,
+		},
+		{
+			name: "empty_set",
+			in:   `{"result":[{"expressions":[{"value":[],"text":"data.abc.deny"}]}]}`,
+		},
+		{
+			name: "strings",
+			in:   `{"result":[{"expressions":[{"value":["CODEOWNERS is missing","no keys allowed"],"text":"data.abc.deny"}]}]}`,
+			want: []string{"CODEOWNERS is missing", "no keys allowed"},
+		},
+		{
+			name: "objects",
+			in:   `{"result":[{"expressions":[{"value":[{"msg":"CODEOWNERS is missing"},{"path":"a.pem"}]}]}]}`,
+			want: []string{"CODEOWNERS is missing", `{"path":"a.pem"}`},
+		},
+		{
+			name:    "not_a_set",
+			in:      `{"result":[{"expressions":[{"value":true}]}]}`,
+			wantErr: "must be a set or array of violations, but got true",
+		},
+		{
+			name:    "not_json",
+			in:      `oops`,
+			wantErr: "invalid character",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseOPAOutput([]byte(tc.in))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("messages were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
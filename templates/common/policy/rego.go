@@ -0,0 +1,133 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// DefaultRegoQuery is the rego query that's evaluated if a policy file doesn't
+// name one. Like a conftest policy, it's a set of messages, one for each
+// violation.
+const DefaultRegoQuery = "data.abc.deny"
+
+// Rego evaluates an OPA bundle of rego policies by running the "opa" CLI,
+// which must be installed. The policy Input is the rego "input" document.
+type Rego struct {
+	// Bundle is the bundle directory or .tar.gz file.
+	Bundle string `yaml:"bundle"`
+
+	// Query is the rego query whose result is the violations, either a set or
+	// array of message strings, or of objects with a "msg" field. Defaults to
+	// DefaultRegoQuery. If the query is undefined, there are no violations.
+	Query string `yaml:"query"`
+
+	// OPA is the opa executable to run. Defaults to "opa" on the PATH.
+	OPA string `yaml:"opa"`
+
+	policy string
+}
+
+// Check implements Checker.
+func (r *Rego) Check(ctx context.Context, in *Input) ([]*Violation, error) {
+	query := r.Query
+	if query == "" {
+		query = DefaultRegoQuery
+	}
+	opa := r.OPA
+	if opa == "" {
+		opa = "opa"
+	}
+
+	inBuf, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling policy input: %w", err)
+	}
+	stdout, _, err := common.RunWithStdin(ctx, bytes.NewReader(inBuf),
+		opa, "eval", "--format=json", "--stdin-input", "--bundle", r.Bundle, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed evaluating rego bundle %q: %w", r.Bundle, err)
+	}
+	msgs, err := parseOPAOutput([]byte(stdout))
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing the output of opa eval of %q: %w", query, err)
+	}
+
+	policy := r.policy
+	if policy == "" {
+		policy = r.Bundle
+	}
+	out := make([]*Violation, 0, len(msgs))
+	for _, msg := range msgs {
+		out = append(out, &Violation{Policy: policy, Message: msg})
+	}
+	return out, nil
+}
+
+// opaOutput is the part of the output of "opa eval --format=json" that we use.
+type opaOutput struct {
+	Result []struct {
+		Expressions []struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"expressions"`
+	} `json:"result"`
+}
+
+// parseOPAOutput returns the violation messages in the output of
+// "opa eval --format=json".
+func parseOPAOutput(buf []byte) ([]string, error) {
+	var out opaOutput
+	if err := json.Unmarshal(buf, &out); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	var msgs []string
+	for _, res := range out.Result {
+		for _, expr := range res.Expressions {
+			var values []json.RawMessage
+			if err := json.Unmarshal(expr.Value, &values); err != nil {
+				return nil, fmt.Errorf("the query result must be a set or array of violations, but got %s", expr.Value)
+			}
+			for _, v := range values {
+				msg, err := violationMessage(v)
+				if err != nil {
+					return nil, err
+				}
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// violationMessage returns the message of one violation, which is either a
+// string or an object with a "msg" field. Any other value is shown as JSON.
+func violationMessage(v json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s, nil
+	}
+	var obj struct {
+		Msg string `json:"msg"`
+	}
+	if err := json.Unmarshal(v, &obj); err == nil && obj.Msg != "" {
+		return obj.Msg, nil
+	}
+	return string(v), nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package protect handles the protected paths of a destination directory,
+// which abc must never create, modify, or delete, like directories that are
+// owned by other systems. They're listed in the destination's
+// .abc/protect.yaml file, and with the --protect flag.
+package protect
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+)
+
+// FileName is the name of the protection list in the .abc directory of a
+// destination.
+const FileName = "protect.yaml"
+
+// FlagSource is the source of the protected paths given with --protect, for
+// error messages.
+const FlagSource = "--protect"
+
+// File is the contents of a protect.yaml file.
+type File struct {
+	// Paths are globs, in the syntax of "include" paths, relative to the
+	// destination directory, like "infra/**" or "CODEOWNERS". A path that
+	// matches a directory protects everything inside it.
+	Paths []string `yaml:"paths"`
+}
+
+// List is the protected paths of a destination. A nil *List protects
+// nothing.
+type List struct {
+	globs []*glob
+}
+
+type glob struct {
+	// pattern uses OS-native separators.
+	pattern string
+
+	// source is where the glob came from, either the path of the
+	// protect.yaml file or FlagSource.
+	source string
+}
+
+// Load returns the protected paths of destDir: those in its
+// .abc/protect.yaml file, if there is one, and the extra globs, which are
+// from --protect.
+func Load(rfs common.FS, destDir string, extra []string) (*List, error) {
+	out := &List{}
+	path := filepath.Join(destDir, common.ABCInternalDir, FileName)
+	buf, err := rfs.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed reading protection list: %w", err)
+	}
+	if err == nil {
+		var f File
+		dec := yaml.NewDecoder(strings.NewReader(string(buf)))
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil {
+			return nil, fmt.Errorf("failed parsing protection list %q: %w", path, err)
+		}
+		if err := out.add(f.Paths, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := out.add(extra, FlagSource); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (l *List) add(patterns []string, source string) error {
+	for _, p := range patterns {
+		pattern := filepath.FromSlash(p)
+		if p == "" || filepath.IsAbs(pattern) || pattern == ".." || strings.HasPrefix(pattern, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid protected path %q in %s: it must be a relative path inside the destination", p, source)
+		}
+		if err := common.ValidateGlob(pattern); err != nil {
+			return fmt.Errorf("invalid protected path %q in %s: %w", p, source, err)
+		}
+		l.globs = append(l.globs, &glob{pattern: filepath.Clean(pattern), source: source})
+	}
+	return nil
+}
+
+// Check returns an error if relPath, a file or directory relative to the
+// destination, is protected, because it or a directory containing it matches
+// one of the globs. The error is in the errs.ErrConflict category.
+func (l *List) Check(relPath string) error {
+	if l == nil {
+		return nil
+	}
+	for path := filepath.Clean(relPath); path != "." && path != string(filepath.Separator); path = filepath.Dir(path) {
+		for _, g := range l.globs {
+			matched, err := common.MatchGlob(g.pattern, path)
+			if err != nil {
+				return fmt.Errorf("failed matching path %q with protected path %q: %w", relPath, g.pattern, err)
+			}
+			if matched {
+				return errs.Wrap(errs.ErrConflict, fmt.Errorf(
+					"the path %q is protected by %q in %s, so it can't be created, modified, or deleted by abc",
+					filepath.ToSlash(relPath), filepath.ToSlash(g.pattern), g.source))
+			}
+		}
+	}
+	return nil
+}
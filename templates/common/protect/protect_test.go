@@ -0,0 +1,116 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protect
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestLoadAndCheck(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		contents string // of .abc/protect.yaml, which isn't written if empty
+		extra    []string
+		checks   map[string]string // from path to the wanted error
+		wantErr  string
+	}{
+		{
+			name:     "file_and_flag",
+			contents: "paths: ['infra/**', 'CODEOWNERS']\n",
+			extra:    []string{"vendor"},
+			checks: map[string]string{
+				"infra":             `the path "infra" is protected by "infra/**" in `,
+				"infra/main.tf":     `the path "infra/main.tf" is protected by "infra/**" in `,
+				"CODEOWNERS":        `the path "CODEOWNERS" is protected by "CODEOWNERS" in `,
+				"vendor/x/y.go":     `the path "vendor/x/y.go" is protected by "vendor" in --protect`,
+				"src/CODEOWNERS":    "",
+				"infrastructure.md": "",
+				"main.go":           "",
+			},
+		},
+		{
+			name: "no_file",
+			checks: map[string]string{
+				"infra/main.tf": "",
+			},
+		},
+		{
+			name:     "unknown_field",
+			contents: "path: ['infra']\n",
+			wantErr:  "field path not found",
+		},
+		{
+			name:     "bad_glob",
+			contents: "paths: ['infra/a**']\n",
+			wantErr:  `invalid protected path "infra/a**"`,
+		},
+		{
+			name:    "outside_dest",
+			extra:   []string{"../other"},
+			wantErr: `invalid protected path "../other" in --protect: it must be a relative path inside the destination`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dest := t.TempDir()
+			if tc.contents != "" {
+				abctestutil.WriteAllDefaultMode(t, dest, map[string]string{
+					filepath.Join(common.ABCInternalDir, FileName): tc.contents,
+				})
+			}
+
+			list, err := Load(&common.RealFS{}, dest, tc.extra)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			for path, wantErr := range tc.checks {
+				err := list.Check(filepath.FromSlash(path))
+				if diff := testutil.DiffErrString(err, wantErr); diff != "" {
+					t.Errorf("Check(%q): %s", path, diff)
+				}
+				if err != nil && !errors.Is(err, errs.ErrConflict) {
+					t.Errorf("Check(%q) returned %v, want an error in the conflict category", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheck_NilList(t *testing.T) {
+	t.Parallel()
+
+	var list *List
+	if err := list.Check("anything"); err != nil {
+		t.Errorf("Check() on a nil list returned %v, want nil", err)
+	}
+}
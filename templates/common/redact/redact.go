@@ -0,0 +1,246 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redact keeps the values of sensitive inputs, like passwords and
+// tokens, out of everything that abc writes besides the rendered files: logs,
+// print output, manifests, resume files, error messages, and golden test data.
+//
+// Which inputs are sensitive is configured with name patterns, like
+// "*_token", rather than by the template, because it's the user who knows
+// which of the values they're passing are secret.
+package redact
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Placeholder replaces a sensitive value.
+const Placeholder = "[REDACTED]"
+
+// Redactor replaces the values of sensitive inputs with Placeholder. The zero
+// value, and nil, don't redact anything.
+type Redactor struct {
+	patterns []string
+
+	// values are the sensitive values, longest first, so that a value that
+	// contains another is replaced whole.
+	values []string
+}
+
+// ValidatePatterns returns an error if any of patterns isn't a valid input
+// name pattern, in the syntax of path.Match.
+func ValidatePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// New returns a Redactor for the inputs whose names match any of patterns,
+// which use the syntax of path.Match, like "password" or "*_token". Returns
+// nil if there are no patterns.
+func New(patterns []string, inputs map[string]string) (*Redactor, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	if err := ValidatePatterns(patterns); err != nil {
+		return nil, err
+	}
+	r := &Redactor{patterns: patterns}
+	r.AddInputs(inputs)
+	return r, nil
+}
+
+// AddInputs adds the values of the sensitive inputs in inputs, once they're
+// known, like after prompting.
+func (r *Redactor) AddInputs(inputs map[string]string) {
+	if r == nil {
+		return
+	}
+	for name, val := range inputs {
+		if val != "" && r.IsSensitive(name) {
+			r.values = append(r.values, val)
+		}
+	}
+	sort.Slice(r.values, func(i, j int) bool {
+		if len(r.values[i]) != len(r.values[j]) {
+			return len(r.values[i]) > len(r.values[j])
+		}
+		return r.values[i] < r.values[j]
+	})
+}
+
+// IsSensitive reports whether the input with the given name is sensitive.
+func (r *Redactor) IsSensitive(name string) bool {
+	if r == nil {
+		return false
+	}
+	for _, p := range r.patterns {
+		if matched, _ := path.Match(p, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns s with every sensitive value replaced.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, Placeholder)
+	}
+	return s
+}
+
+// Inputs returns a copy of inputs without the sensitive ones. They're left out
+// rather than replaced, so that whatever reads them back, like an upgrade or
+// a resumed render, asks for them again rather than using the placeholder.
+func (r *Redactor) Inputs(inputs map[string]string) map[string]string {
+	if r == nil || inputs == nil {
+		return inputs
+	}
+	out := make(map[string]string, len(inputs))
+	for name, val := range inputs {
+		if !r.IsSensitive(name) {
+			out[name] = val
+		}
+	}
+	return out
+}
+
+// Error returns err with its message redacted. The returned error still
+// unwraps to err, so errors.Is and errors.As work as before.
+func (r *Redactor) Error(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	msg := err.Error()
+	if redacted := r.String(msg); redacted != msg {
+		return &redactedError{msg: redacted, err: err}
+	}
+	return err
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Writer returns a writer that redacts each write before passing it to w.
+// Each write should be a whole message, like the output of a "print" action,
+// since a value that's split across writes isn't found.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if r == nil || w == nil {
+		return w
+	}
+	return &writer{r: r, w: w}
+}
+
+type writer struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.r.String(string(p))); err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+	// The number of bytes written is always the number given, since the
+	// caller doesn't know that they were replaced.
+	return len(p), nil
+}
+
+// Logger returns a logger that redacts the messages and attributes of records
+// before passing them to l's handler.
+func (r *Redactor) Logger(l *slog.Logger) *slog.Logger {
+	if r == nil {
+		return l
+	}
+	return slog.New(&handler{r: r, h: l.Handler()})
+}
+
+type handler struct {
+	r *Redactor
+	h slog.Handler
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.h.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, rec slog.Record) error {
+	out := slog.NewRecord(rec.Time, rec.Level, h.r.String(rec.Message), rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.attr(a))
+		return true
+	})
+	return h.h.Handle(ctx, out) //nolint:wrapcheck
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redacted = append(redacted, h.attr(a))
+	}
+	return &handler{r: h.r, h: h.h.WithAttrs(redacted)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{r: h.r, h: h.h.WithGroup(name)}
+}
+
+// attr returns a with any sensitive values in it replaced. Values that aren't
+// strings are formatted as strings first if they contain a sensitive value.
+func (h *handler) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.r.String(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, 0, len(group))
+		for _, ga := range group {
+			redacted = append(redacted, h.attr(ga))
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.Any(a.Key, h.r.Error(err))
+		}
+		s := fmt.Sprint(v.Any())
+		if redacted := h.r.String(s); redacted != s {
+			return slog.String(a.Key, redacted)
+		}
+	default:
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
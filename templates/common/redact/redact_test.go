@@ -0,0 +1,130 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	r, err := New(nil, map[string]string{"password": "hunter2"})
+	if err != nil || r != nil {
+		t.Errorf("New() with no patterns = %v, %v, want nil, nil", r, err)
+	}
+	// A nil Redactor doesn't change anything.
+	if got := r.String("hunter2"); got != "hunter2" {
+		t.Errorf("nil Redactor String() = %q, want it unchanged", got)
+	}
+
+	_, err = New([]string{"[token"}, nil)
+	if diff := testutil.DiffErrString(err, `invalid redaction pattern "[token"`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	t.Parallel()
+
+	r, err := New([]string{"password", "*_token"}, map[string]string{
+		"password":    "hunter2",
+		"api_token":   "hunter2-abc",
+		"empty_token": "",
+		"name":        "alice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddInputs(map[string]string{"gh_token": "ghp_123"})
+
+	for name, want := range map[string]bool{"password": true, "api_token": true, "gh_token": true, "name": false, "passwords": false} {
+		if got := r.IsSensitive(name); got != want {
+			t.Errorf("IsSensitive(%q) = %t, want %t", name, got, want)
+		}
+	}
+
+	// The longer value is replaced whole, even though it contains the shorter.
+	got := r.String("alice: hunter2, hunter2-abc, ghp_123")
+	if want := "alice: [REDACTED], [REDACTED], [REDACTED]"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	gotInputs := r.Inputs(map[string]string{"password": "hunter2", "name": "alice"})
+	if diff := cmp.Diff(gotInputs, map[string]string{"name": "alice"}); diff != "" {
+		t.Errorf("Inputs() was not as expected (-got,+want): %s", diff)
+	}
+
+	sentinel := errors.New("sentinel")
+	err = r.Error(fmt.Errorf("bad password %q: %w", "hunter2", sentinel))
+	if diff := testutil.DiffErrString(err, `bad password "[REDACTED]": sentinel`); diff != "" {
+		t.Error(diff)
+	}
+	if !errors.Is(err, sentinel) {
+		t.Errorf("redacted error %v doesn't unwrap to the original", err)
+	}
+
+	sb := &strings.Builder{}
+	w := r.Writer(sb)
+	if n, err := w.Write([]byte("pw=hunter2\n")); err != nil || n != len("pw=hunter2\n") {
+		t.Errorf("Write() = %d, %v, want the length of the input and no error", n, err)
+	}
+	if got, want := sb.String(), "pw=[REDACTED]\n"; got != want {
+		t.Errorf("Writer wrote %q, want %q", got, want)
+	}
+}
+
+func TestRedactorLogger(t *testing.T) {
+	t.Parallel()
+
+	r, err := New([]string{"password"}, map[string]string{"password": "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb := &strings.Builder{}
+	logger := r.Logger(slog.New(slog.NewTextHandler(sb, nil))).With("with", "hunter2")
+	logger.InfoContext(context.Background(), "the password is hunter2",
+		"str", "hunter2",
+		"err", fmt.Errorf("bad hunter2"),
+		"any", []string{"hunter2"},
+		slog.Group("group", "nested", "hunter2"))
+
+	got := sb.String()
+	if strings.Contains(got, "hunter2") {
+		t.Errorf("log contains the sensitive value: %s", got)
+	}
+	for _, want := range []string{
+		`msg="the password is [REDACTED]"`,
+		`with=[REDACTED]`,
+		`str=[REDACTED]`,
+		`err="bad [REDACTED]"`,
+		`any=[[REDACTED]]`,
+		`group.nested=[REDACTED]`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log %q doesn't contain %q", got, want)
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"io/fs"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"text/template"
@@ -31,6 +32,7 @@ import (
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/spec/features"
 	"github.com/abcxyz/pkg/logging"
 )
 
@@ -38,6 +40,10 @@ import (
 // to be written.
 type walkAndModifyVisitor func([]byte) ([]byte, error)
 
+// Like walkAndModifyVisitor, but also receives the path of the file relative to
+// the scratch directory.
+type walkAndModifyPathVisitor func(relPath string, buf []byte) ([]byte, error)
+
 // For each given path, recursively traverses the directory or file
 // scratchDir/relPath, calling the given visitor for each file. If relPath is a
 // single file, then the visitor will be called for just that one file. If
@@ -48,71 +54,153 @@ type walkAndModifyVisitor func([]byte) ([]byte, error)
 // rawPaths is a list of path strings that will be processed (processPaths,
 // processGlobs) before walking through.
 func walkAndModify(ctx context.Context, sp *stepParams, rawPaths []model.String, v walkAndModifyVisitor) error {
+	return walkAndModifyWithPath(ctx, sp, rawPaths, func(_ string, buf []byte) ([]byte, error) {
+		return v(buf)
+	})
+}
+
+// walkAndModifyWithPath is like walkAndModify, for visitors whose behavior
+// depends on the file name.
+func walkAndModifyWithPath(ctx context.Context, sp *stepParams, rawPaths []model.String, v walkAndModifyPathVisitor) error {
+	return walkPaths(ctx, sp, rawPaths, true, v)
+}
+
+// walkPaths implements walkAndModifyWithPath. If requireMatches is true, each
+// path must match at least one file, otherwise it's an error, or just a
+// warning with --allow-unmatched-paths; a template whose paths silently match
+// nothing is almost always broken. Older api_versions only get the warning
+// for a path that exists but has no files in it. The number of files that
+// were matched and modified is logged either way.
+func walkPaths(ctx context.Context, sp *stepParams, rawPaths []model.String, requireMatches bool, v walkAndModifyPathVisitor) error {
 	logger := logging.FromContext(ctx).With("logger", "walkAndModify")
 	seen := map[string]struct{}{}
+	modified := 0
 
 	paths, err := processPaths(rawPaths, sp.scope)
 	if err != nil {
 		return err
 	}
-	globbedPaths, err := processGlobs(ctx, paths, sp.scratchDir, sp.features.SkipGlobs)
-	if err != nil {
-		return err
+	negated := negatedGlobs(paths, sp.features)
+	var negatedPaths []model.String
+	if len(negated) > 0 {
+		negatedPaths = slices.DeleteFunc(slices.Clone(paths), func(p model.String) bool {
+			return !strings.HasPrefix(p.Val, "!")
+		})
 	}
 
-	for _, absPath := range globbedPaths {
-		err := filepath.WalkDir(absPath.Val, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				// There was some filesystem error. Give up.
-				return absPath.Pos.Errorf("%w", err)
-			}
-			if d.IsDir() {
-				return nil
+	for _, p := range paths {
+		if len(negated) > 0 && strings.HasPrefix(p.Val, "!") {
+			continue
+		}
+		// Each path is globbed on its own so that its matches can be
+		// counted.
+		globbedPaths, err := processGlobs(ctx, sp.rp.FS, append([]model.String{p}, negatedPaths...), sp.workDir(), sp.features)
+		if err != nil {
+			if requireMatches && sp.rp.AllowUnmatchedPaths && errors.Is(err, errNoMatches) {
+				logger.WarnContext(ctx, "path didn't match any files", "error", err)
+				continue
 			}
+			return err
+		}
 
-			if _, ok := seen[path]; ok {
-				// File already processed.
-				logger.DebugContext(ctx, "skipping file as already seen", "path", path)
-				return nil
-			}
-			oldBuf, err := sp.rp.FS.ReadFile(path)
-			if err != nil {
-				return absPath.Pos.Errorf("Readfile(): %w", err)
-			}
+		matched := 0
+		for _, absPath := range globbedPaths {
+			err := fs.WalkDir(sp.rp.FS, absPath.Val, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					// There was some filesystem error. Give up.
+					return absPath.Pos.Errorf("%w", err)
+				}
+				if err := ctx.Err(); err != nil {
+					return err //nolint:wrapcheck
+				}
+				if excluded, err := isExcluded(negated, sp.workDir(), path); err != nil {
+					return err
+				} else if excluded {
+					logger.DebugContext(ctx, "skipping path excluded by a negated path", "path", path)
+					if d.IsDir() {
+						return fs.SkipDir
+					}
+					return nil
+				}
+				if d.IsDir() {
+					return nil
+				}
+				if d.Type()&fs.ModeSymlink != 0 {
+					// A preserved symlink is copied as-is. If it points to a file
+					// that should be modified, that file is modified instead.
+					logger.DebugContext(ctx, "skipping symlink", "path", path)
+					return nil
+				}
 
-			relToScratchDir, err := filepath.Rel(sp.scratchDir, path)
-			if err != nil {
-				return absPath.Pos.Errorf("Rel(): %w", err)
-			}
+				relToScratchDir, err := filepath.Rel(sp.scratchDir, path)
+				if err != nil {
+					return absPath.Pos.Errorf("Rel(): %w", err)
+				}
+				if sp.renderedPaths != nil {
+					// In post_render, only the files that were rendered are
+					// modified, not the rest of the destination directory.
+					if _, ok := slices.BinarySearch(sp.renderedPaths, filepath.ToSlash(relToScratchDir)); !ok {
+						return nil
+					}
+				}
+				matched++
 
-			// We must clone oldBuf to guarantee that the callee won't change the
-			// underlying bytes. We rely on an unmodified oldBuf below in the call
-			// to bytes.Equal.
-			newBuf, err := v(bytes.Clone(oldBuf))
-			if err != nil {
-				return fmt.Errorf("when processing template file %q: %w", relToScratchDir, err)
-			}
+				if _, ok := seen[path]; ok {
+					// File already processed.
+					logger.DebugContext(ctx, "skipping file as already seen", "path", path)
+					return nil
+				}
+
+				oldBuf, err := sp.rp.FS.ReadFile(path)
+				if err != nil {
+					return absPath.Pos.Errorf("Readfile(): %w", err)
+				}
+
+				// We must clone oldBuf to guarantee that the callee won't change the
+				// underlying bytes. We rely on an unmodified oldBuf below in the call
+				// to bytes.Equal.
+				newBuf, err := v(relToScratchDir, bytes.Clone(oldBuf))
+				if err != nil {
+					return fmt.Errorf("when processing template file %q: %w", relToScratchDir, err)
+				}
+
+				seen[path] = struct{}{}
 
-			seen[path] = struct{}{}
+				if bytes.Equal(oldBuf, newBuf) {
+					// If file contents are unchanged, there's no need to write.
+					return nil
+				}
+
+				// The permissions in the following WriteFile call will be ignored
+				// because the file already exists.
+				if err := sp.rp.FS.WriteFile(path, newBuf, common.OwnerRWXPerms); err != nil {
+					return absPath.Pos.Errorf("Writefile(): %w", err)
+				}
+				modified++
+				logger.DebugContext(ctx, "wrote modification", "path", path)
 
-			if bytes.Equal(oldBuf, newBuf) {
-				// If file contents are unchanged, there's no need to write.
 				return nil
+			})
+			if err != nil {
+				return err //nolint:wrapcheck
 			}
+		}
 
-			// The permissions in the following WriteFile call will be ignored
-			// because the file already exists.
-			if err := sp.rp.FS.WriteFile(path, newBuf, common.OwnerRWXPerms); err != nil {
-				return absPath.Pos.Errorf("Writefile(): %w", err)
+		if matched == 0 && requireMatches {
+			// The path exists, but there are no files in it that this action
+			// can modify, like an empty directory.
+			err := p.Pos.Errorf("path %q %w", p.Val, errNoMatches)
+			if !sp.rp.AllowUnmatchedPaths && !sp.features.SkipUnmatchedPathErrors {
+				return err
 			}
-			logger.DebugContext(ctx, "wrote modification", "path", path)
-
-			return nil
-		})
-		if err != nil {
-			return err //nolint:wrapcheck
+			logger.WarnContext(ctx, "path didn't match any files", "error", err)
 		}
 	}
+
+	logger.DebugContext(ctx, "files matched and modified",
+		"paths", rawPaths,
+		"matched", len(seen),
+		"modified", modified)
 	return nil
 }
 
@@ -136,33 +224,60 @@ func templateAndCompileRegexes(regexes []model.String, scope *common.Scope) ([]*
 	return compiled, merr
 }
 
+// errNoMatches is returned when a path doesn't match any files.
+var errNoMatches = errors.New("did not match any files")
+
 // processGlobs processes a list of relative input String paths for simple file globbing.
 // Returned paths are converted from relative to absolute.
 // Used after processPaths where applicable.
-func processGlobs(ctx context.Context, paths []model.String, fromDir string, skipGlobs bool) ([]model.String, error) {
+//
+// The output is in the order of paths, with the matches of each glob in the
+// order returned by common.Glob, and without duplicates. The glob syntax
+// depends on the api_version, as given by f.
+func processGlobs(ctx context.Context, rfs common.FS, paths []model.String, fromDir string, f features.Features) ([]model.String, error) {
 	logger := logging.FromContext(ctx).With("logger", "processGlobs")
 	seenPaths := map[string]struct{}{}
 	out := make([]model.String, 0, len(paths))
 
+	negated := negatedGlobs(paths, f)
 	for _, p := range paths {
 		// This supports older api_versions which didn't have glob support.
-		if skipGlobs {
+		if f.SkipGlobs {
+			absPath, err := common.JoinWithinRoot(p.Pos, fromDir, p.Val)
+			if err != nil {
+				return nil, err //nolint:wrapcheck
+			}
 			out = append(out, model.String{
-				Val: filepath.Join(fromDir, p.Val),
+				Val: absPath,
 				Pos: p.Pos,
 			})
 		} else {
-			globPaths, err := filepath.Glob(filepath.Join(fromDir, p.Val))
+			if len(negated) > 0 && strings.HasPrefix(p.Val, "!") {
+				continue
+			}
+			absGlob, err := common.JoinWithinRoot(p.Pos, fromDir, p.Val)
+			if err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+			globPaths, err := glob(rfs, absGlob, f)
 			if err != nil {
 				return nil, p.Pos.Errorf("file globbing error: %w", err)
 			}
 			if len(globPaths) == 0 {
-				return nil, p.Pos.Errorf("glob %q did not match any files", p.Val)
+				return nil, p.Pos.Errorf("glob %q %w", p.Val, errNoMatches)
 			}
 			logger.DebugContext(ctx, "glob path expanded:",
 				"glob", p.Val,
 				"matches", globPaths)
 			for _, globPath := range globPaths {
+				excluded, err := isExcluded(negated, fromDir, globPath)
+				if err != nil {
+					return nil, err
+				}
+				if excluded {
+					logger.DebugContext(ctx, "glob match excluded by a negated path", "path", globPath)
+					continue
+				}
 				if _, ok := seenPaths[globPath]; !ok {
 					out = append(out, model.String{
 						Val: globPath,
@@ -177,6 +292,65 @@ func processGlobs(ctx context.Context, paths []model.String, fromDir string, ski
 	return out, nil
 }
 
+// negatedGlobs returns the paths that start with "!", without the "!". These
+// exclude files from those matched by the other paths, including files inside
+// matched directories. Older api_versions don't support negated paths, so
+// their paths starting with "!" are literal.
+func negatedGlobs(paths []model.String, f features.Features) []model.String {
+	if f.SkipGlobs || f.SkipDoubleStarGlobs {
+		return nil
+	}
+	var out []model.String
+	for _, p := range paths {
+		if pattern, ok := strings.CutPrefix(p.Val, "!"); ok {
+			out = append(out, model.String{Val: pattern, Pos: p.Pos})
+		}
+	}
+	return out
+}
+
+// glob is common.Glob, or common.GlobSingleStar for the older api_versions
+// whose globs have the syntax of filepath.Match.
+func glob(fsys common.FS, pattern string, f features.Features) ([]string, error) {
+	if f.SkipDoubleStarGlobs {
+		return common.GlobSingleStar(fsys, pattern) //nolint:wrapcheck
+	}
+	return common.Glob(fsys, pattern) //nolint:wrapcheck
+}
+
+// matchGlob is common.MatchGlob, or filepath.Match for the older api_versions
+// whose globs have the syntax of filepath.Match.
+func matchGlob(pattern, name string, f features.Features) (bool, error) {
+	if f.SkipDoubleStarGlobs {
+		return filepath.Match(pattern, name) //nolint:wrapcheck
+	}
+	return common.MatchGlob(pattern, name) //nolint:wrapcheck
+}
+
+// isExcluded returns whether absPath, or any directory between it and fromDir,
+// matches one of the negated globs, which are relative to fromDir.
+func isExcluded(negated []model.String, fromDir, absPath string) (bool, error) {
+	if len(negated) == 0 {
+		return false, nil
+	}
+	rel, err := filepath.Rel(fromDir, absPath)
+	if err != nil {
+		return false, fmt.Errorf("filepath.Rel(%s,%s): %w", fromDir, absPath, err)
+	}
+	for ; rel != "." && rel != string(filepath.Separator); rel = filepath.Dir(rel) {
+		for _, n := range negated {
+			matched, err := common.MatchGlob(n.Val, rel)
+			if err != nil {
+				return false, n.Pos.Errorf("error matching path (%q) with negated path (%q): %w", rel, n.Val, err)
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
 // processPaths processes a list of input String paths for go templating, relative paths,
 // and OS-specific slashes.
 func processPaths(paths []model.String, scope *common.Scope) ([]model.String, error) {
@@ -188,10 +362,16 @@ func processPaths(paths []model.String, scope *common.Scope) ([]model.String, er
 			return nil, err
 		}
 
+		// A negated glob like "!*.md" keeps its "!", but the rest of it must
+		// be a safe relative path like any other.
+		tmplOutput, negated := strings.CutPrefix(tmplOutput, "!")
 		relParsed, err := common.SafeRelPath(p.Pos, tmplOutput)
 		if err != nil {
 			return nil, err //nolint:wrapcheck
 		}
+		if negated {
+			relParsed = "!" + relParsed
+		}
 		out = append(out, model.String{
 			Val: relParsed,
 			Pos: p.Pos,
@@ -0,0 +1,67 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+)
+
+// actionCallStepGroup runs the steps of the named step group, with the group's
+// params in scope. The param values are template expressions that are executed
+// in the caller's scope.
+func actionCallStepGroup(ctx context.Context, c *spec.CallStepGroup, sp *stepParams) error {
+	g, ok := sp.stepGroups[c.Name.Val]
+	if !ok {
+		// This should have been caught when validating the spec.
+		return c.Pos.Errorf("there's no step group named %q", c.Name.Val)
+	}
+
+	vars := make(map[string]string, len(g.Params))
+	for _, p := range g.Params {
+		val, ok := c.With[p.Name.Val]
+		if !ok {
+			if p.Default == nil {
+				return c.Pos.Errorf("step group %q requires the param %q", g.Name.Val, p.Name.Val)
+			}
+			val = *p.Default
+		}
+		executed, err := parseAndExecuteGoTmpl(val.Pos, val.Val, sp.scope)
+		if err != nil {
+			return err
+		}
+		vars[p.Name.Val] = executed
+	}
+
+	subStepParams := sp.WithScope(vars)
+	err := executeSteps(ctx, g.Steps, subStepParams)
+	// Files included from the destination by the group's steps must be
+	// remembered after the group finishes.
+	sp.includedFromDest = subStepParams.includedFromDest
+	if err != nil {
+		return fmt.Errorf("in step group %q: %w", g.Name.Val, err)
+	}
+	return nil
+}
+
+func stepGroupsByName(groups []*spec.StepGroup) map[string]*spec.StepGroup {
+	out := make(map[string]*spec.StepGroup, len(groups))
+	for _, g := range groups {
+		out[g.Name.Val] = g
+	}
+	return out
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestActionCallStepGroup(t *testing.T) {
+	t.Parallel()
+
+	greet := &spec.StepGroup{
+		Name: model.String{Val: "greet"},
+		Params: []*spec.StepGroupParam{
+			{Name: model.String{Val: "target"}},
+			{Name: model.String{Val: "punctuation"}, Default: &model.String{Val: "{{.default_punctuation}}"}},
+		},
+		Steps: []*spec.Step{
+			{
+				Pos:    model.ConfigPos{Line: 12, Column: 7},
+				Desc:   model.String{Val: "Print a greeting"},
+				Action: model.String{Val: "print"},
+				Print: &spec.Print{
+					Message: model.String{Val: "Hello {{.target}} from {{.from}}{{.punctuation}}"},
+				},
+			},
+		},
+	}
+	greetTwice := &spec.StepGroup{
+		Name: model.String{Val: "greet_twice"},
+		Params: []*spec.StepGroupParam{
+			{Name: model.String{Val: "target"}},
+		},
+		Steps: []*spec.Step{
+			{
+				CallStepGroup: &spec.CallStepGroup{
+					Name: model.String{Val: "greet"},
+					With: map[string]model.String{"target": {Val: "{{.target}}"}},
+				},
+			},
+			{
+				CallStepGroup: &spec.CallStepGroup{
+					Name: model.String{Val: "greet"},
+					With: map[string]model.String{"target": {Val: "{{.target}}"}, "punctuation": {Val: "?"}},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name       string
+		in         *spec.CallStepGroup
+		inputs     map[string]string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name: "params_are_templated_in_caller_scope",
+			in: &spec.CallStepGroup{
+				Name: model.String{Val: "greet"},
+				With: map[string]model.String{
+					"target":      {Val: "{{.recipient}}"},
+					"punctuation": {Val: "!"},
+				},
+			},
+			inputs:     map[string]string{"from": "Alice", "recipient": "Bob"},
+			wantStdout: "Hello Bob from Alice!\n",
+		},
+		{
+			name: "default_param",
+			in: &spec.CallStepGroup{
+				Name: model.String{Val: "greet"},
+				With: map[string]model.String{"target": {Val: "Bob"}},
+			},
+			inputs:     map[string]string{"from": "Alice", "default_punctuation": "."},
+			wantStdout: "Hello Bob from Alice.\n",
+		},
+		{
+			name: "nested_groups",
+			in: &spec.CallStepGroup{
+				Name: model.String{Val: "greet_twice"},
+				With: map[string]model.String{"target": {Val: "Bob"}},
+			},
+			inputs:     map[string]string{"from": "Alice", "default_punctuation": "."},
+			wantStdout: "Hello Bob from Alice.\nHello Bob from Alice?\n",
+		},
+		{
+			name: "missing_required_param",
+			in: &spec.CallStepGroup{
+				Name: model.String{Val: "greet"},
+			},
+			wantErr: `step group "greet" requires the param "target"`,
+		},
+		{
+			name: "errors_are_propagated",
+			in: &spec.CallStepGroup{
+				Name: model.String{Val: "greet"},
+				With: map[string]model.String{"target": {Val: "Bob"}, "punctuation": {Val: "!"}},
+			},
+			wantErr: `in step group "greet": step "Print a greeting" (action "print") failed: template.Execute() failed: the template referenced a nonexistent variable name "from"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			buf := &bytes.Buffer{}
+			sp := &stepParams{
+				scope: common.NewScope(tc.inputs),
+				rp: &Params{
+					FS:     &common.RealFS{},
+					Stdout: buf,
+				},
+				scratchDir: t.TempDir(),
+				stepGroups: stepGroupsByName([]*spec.StepGroup{greet, greetTwice}),
+			}
+			err := actionCallStepGroup(ctx, tc.in, sp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := buf.String()
+			if diff := cmp.Diff(got, tc.wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
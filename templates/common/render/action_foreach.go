@@ -16,8 +16,12 @@ package render
 
 import (
 	"context"
+	"sort"
+
+	"golang.org/x/exp/maps"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
 	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
 )
 
@@ -35,17 +39,43 @@ func actionForEach(ctx context.Context, fe *spec.ForEach, sp *stepParams) error
 			return err
 		}
 	} else {
-		if err := common.CelCompileAndEval(ctx, sp.scope, *fe.Iterator.ValuesFrom, &values); err != nil {
-			return err //nolint:wrapcheck
+		var err error
+		values, err = forEachValuesFrom(ctx, sp.scope, *fe.Iterator.ValuesFrom)
+		if err != nil {
+			return err
 		}
 	}
 
 	for _, keyVal := range values {
 		subStepParams := sp.WithScope(map[string]string{key: keyVal})
-		if err := executeSteps(ctx, fe.Steps, subStepParams); err != nil {
+		err := executeSteps(ctx, fe.Steps, subStepParams)
+		// Files included from the destination in any iteration must be
+		// remembered after the loop finishes.
+		sp.includedFromDest = subStepParams.includedFromDest
+		if err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+// forEachValuesFrom evaluates the values_from CEL expression of a for_each.
+// The expression outputs either a list of strings, which is iterated over in
+// order, or a map with string keys, whose keys are iterated over in sorted
+// order. A map has no order of its own, so sorting keeps the output of the
+// loop the same on every render.
+func forEachValuesFrom(ctx context.Context, scope *common.Scope, expr model.String) ([]string, error) {
+	var values []string
+	err := common.CelCompileAndEval(ctx, scope, expr, &values)
+	if err == nil {
+		return values, nil
+	}
+	var m map[string]any
+	if mapErr := common.CelCompileAndEval(ctx, scope, expr, &m); mapErr != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	keys := maps.Keys(m)
+	sort.Strings(keys)
+	return keys, nil
+}
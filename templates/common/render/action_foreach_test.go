@@ -221,6 +221,40 @@ func TestActionForEach(t *testing.T) {
 			},
 			wantStdout: "production\ndev\n",
 		},
+		{
+			name: "cel_values_map_keys_sorted",
+			in: &spec.ForEach{
+				Iterator: &spec.ForEachIterator{
+					Key:        model.String{Val: "env"},
+					ValuesFrom: &model.String{Val: `{"staging": 2, "dev": 1, "production": 3, "canary": 4}`},
+				},
+				Steps: []*spec.Step{
+					{
+						Print: &spec.Print{
+							Message: model.String{Val: "{{.env}}"},
+						},
+					},
+				},
+			},
+			wantStdout: "canary\ndev\nproduction\nstaging\n",
+		},
+		{
+			name: "cel_values_wrong_type",
+			in: &spec.ForEach{
+				Iterator: &spec.ForEachIterator{
+					Key:        model.String{Val: "env"},
+					ValuesFrom: &model.String{Val: `[1, 2]`},
+				},
+				Steps: []*spec.Step{
+					{
+						Print: &spec.Print{
+							Message: model.String{Val: "{{.env}}"},
+						},
+					},
+				},
+			},
+			wantErr: "CEL expression result couldn't be converted to []string",
+		},
 	}
 
 	for _, tc := range cases {
@@ -235,8 +269,10 @@ func TestActionForEach(t *testing.T) {
 			sp := &stepParams{
 				scope: common.NewScope(tc.inputs),
 				rp: &Params{
+					FS:     &common.RealFS{},
 					Stdout: buf,
 				},
+				scratchDir: t.TempDir(),
 			}
 			err := actionForEach(ctx, tc.in, sp)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
@@ -0,0 +1,141 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+)
+
+type formatterFunc func([]byte) ([]byte, error)
+
+// builtinFormatters are keyed by the names in spec.Formatters.
+var builtinFormatters = map[string]formatterFunc{
+	"go":   formatGo,
+	"json": formatJSON,
+	"yaml": formatYAML,
+}
+
+// formattersByExt chooses a built-in formatter when the spec doesn't name one.
+var formattersByExt = map[string]string{
+	".go":   "go",
+	".json": "json",
+	".yaml": "yaml",
+	".yml":  "yaml",
+}
+
+// The format action rewrites files into the canonical form for their
+// language, so the output doesn't depend on how carefully the template author
+// managed whitespace around template expressions.
+func actionFormat(ctx context.Context, f *spec.Format, sp *stepParams) error {
+	if len(f.Command) > 0 {
+		if !sp.rp.AllowExec {
+			return f.Pos.Errorf(`the "command" of a "format" action runs an external program, which requires the --allow-exec flag`)
+		}
+		args := make([]string, 0, len(f.Command))
+		for _, c := range f.Command {
+			arg, err := parseAndExecuteGoTmpl(c.Pos, c.Val, sp.scope)
+			if err != nil {
+				return err
+			}
+			args = append(args, arg)
+		}
+		return walkAndModify(ctx, sp, f.Paths, func(buf []byte) ([]byte, error) {
+			stdout, _, err := common.RunWithStdin(ctx, bytes.NewReader(buf), args...)
+			if err != nil {
+				return nil, f.Pos.Errorf("external formatter failed: %w", err)
+			}
+			return []byte(stdout), nil
+		})
+	}
+
+	return walkAndModifyWithPath(ctx, sp, f.Paths, func(relPath string, buf []byte) ([]byte, error) {
+		name := f.Formatter.Val
+		if name == "" {
+			name = formattersByExt[strings.ToLower(filepath.Ext(relPath))]
+			if name == "" {
+				return buf, nil
+			}
+		}
+		out, err := builtinFormatters[name](buf)
+		if err != nil {
+			return nil, f.Pos.Errorf("failed formatting as %s: %w", name, err)
+		}
+		return out, nil
+	})
+}
+
+func formatGo(buf []byte) ([]byte, error) {
+	out, err := format.Source(buf)
+	if err != nil {
+		return nil, fmt.Errorf("format.Source(): %w", err)
+	}
+	return out, nil
+}
+
+// formatJSON indents with two spaces. Unlike unmarshaling and marshaling
+// again, this keeps the order of object keys.
+func formatJSON(buf []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(buf)
+	if len(trimmed) == 0 {
+		return buf, nil
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, trimmed, "", "  "); err != nil {
+		return nil, fmt.Errorf("json.Indent(): %w", err)
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// formatYAML reserializes each document in the file with two space
+// indentation. Comments are kept, since they're attached to the parsed nodes.
+func formatYAML(buf []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(buf)) == 0 {
+		return buf, nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed parsing YAML: %w", err)
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return nil, fmt.Errorf("failed encoding YAML: %w", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed encoding YAML: %w", err)
+	}
+	return out.Bytes(), nil
+}
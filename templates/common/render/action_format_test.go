@@ -0,0 +1,188 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestActionFormat(t *testing.T) {
+	t.Parallel()
+
+	const (
+		uglyGo     = "package main\nfunc main()  {\n    x:=1\n  _ = x }\n"
+		prettyGo   = "package main\n\nfunc main() {\n\tx := 1\n\t_ = x\n}\n"
+		uglyJSON   = `{"b": 1,   "a": [1,2]}`
+		prettyJSON = "{\n  \"b\": 1,\n  \"a\": [\n    1,\n    2\n  ]\n}\n"
+		uglyYAML   = "a:\n    b: 1 # why\n    c:\n        - x\n---\nd: 2\n"
+		prettyYAML = "a:\n  b: 1 # why\n  c:\n    - x\n---\nd: 2\n"
+	)
+
+	cases := []struct {
+		name      string
+		f         *spec.Format
+		allowExec bool
+		inputs    map[string]string
+
+		initialContents map[string]string
+		want            map[string]string
+		wantErr         string
+	}{
+		{
+			name: "by_extension",
+			f: &spec.Format{
+				Paths: modelStrings([]string{"."}),
+			},
+			initialContents: map[string]string{
+				"main.go":          uglyGo,
+				"config/a.json":    uglyJSON,
+				"config/b.yaml":    uglyYAML,
+				"config/c.yml":     uglyYAML,
+				"README.md":        "  leave   me\n",
+				"config/empty.yml": "",
+			},
+			want: map[string]string{
+				"main.go":          prettyGo,
+				"config/a.json":    prettyJSON,
+				"config/b.yaml":    prettyYAML,
+				"config/c.yml":     prettyYAML,
+				"README.md":        "  leave   me\n",
+				"config/empty.yml": "",
+			},
+		},
+		{
+			name: "named_formatter_ignores_extension",
+			f: &spec.Format{
+				Paths:     modelStrings([]string{"{{.file}}"}),
+				Formatter: model.String{Val: "json"},
+			},
+			inputs: map[string]string{"file": "settings.tmpl"},
+			initialContents: map[string]string{
+				"settings.tmpl": uglyJSON,
+			},
+			want: map[string]string{
+				"settings.tmpl": prettyJSON,
+			},
+		},
+		{
+			name: "invalid_go",
+			f: &spec.Format{
+				Paths: modelStrings([]string{"main.go"}),
+			},
+			initialContents: map[string]string{
+				"main.go": "package main\nfunc {\n",
+			},
+			want: map[string]string{
+				"main.go": "package main\nfunc {\n",
+			},
+			wantErr: "failed formatting as go",
+		},
+		{
+			name: "invalid_json",
+			f: &spec.Format{
+				Paths: modelStrings([]string{"a.json"}),
+			},
+			initialContents: map[string]string{
+				"a.json": "{",
+			},
+			want: map[string]string{
+				"a.json": "{",
+			},
+			wantErr: "failed formatting as json",
+		},
+		{
+			name: "external_command",
+			f: &spec.Format{
+				Paths:   modelStrings([]string{"a.txt"}),
+				Command: modelStrings([]string{"tr", "{{.from}}", "A-Z"}),
+			},
+			allowExec: true,
+			inputs:    map[string]string{"from": "a-z"},
+			initialContents: map[string]string{
+				"a.txt": "shout\n",
+			},
+			want: map[string]string{
+				"a.txt": "SHOUT\n",
+			},
+		},
+		{
+			name: "external_command_without_allow_exec",
+			f: &spec.Format{
+				Paths:   modelStrings([]string{"a.txt"}),
+				Command: modelStrings([]string{"tr", "a-z", "A-Z"}),
+			},
+			initialContents: map[string]string{
+				"a.txt": "shout\n",
+			},
+			want: map[string]string{
+				"a.txt": "shout\n",
+			},
+			wantErr: "requires the --allow-exec flag",
+		},
+		{
+			name: "external_command_fails",
+			f: &spec.Format{
+				Paths:   modelStrings([]string{"a.txt"}),
+				Command: modelStrings([]string{"false"}),
+			},
+			allowExec: true,
+			initialContents: map[string]string{
+				"a.txt": "hello\n",
+			},
+			want: map[string]string{
+				"a.txt": "hello\n",
+			},
+			wantErr: "external formatter failed",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scratchDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, scratchDir, tc.initialContents)
+
+			sp := &stepParams{
+				scope:      common.NewScope(tc.inputs),
+				scratchDir: scratchDir,
+				rp: &Params{
+					AllowExec: tc.allowExec,
+					FS:        &common.RealFS{},
+				},
+			}
+			err := actionFormat(context.Background(), tc.f, sp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := abctestutil.LoadDirWithoutMode(t, scratchDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+			}
+		})
+	}
+}
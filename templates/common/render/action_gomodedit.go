@@ -0,0 +1,205 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// goModRequire is a GoModRequire after its template expressions have been
+// executed and validated.
+type goModRequire struct {
+	path, version string
+}
+
+// The go_mod_edit action edits go.mod files, creating them if needed. An
+// example is:
+//
+//	paths: ['go.mod']
+//	module: 'github.com/{{.org}}/{{.service_name}}'
+//	go: '1.22'
+//	require:
+//	  - path: 'github.com/abcxyz/pkg'
+//	    version: 'v1.0.0'
+func actionGoModEdit(ctx context.Context, gm *spec.GoModEdit, sp *stepParams) error {
+	logger := logging.FromContext(ctx).With("logger", "actionGoModEdit")
+
+	modulePath, err := executeGoModField(gm.Module, sp, func(s string) error {
+		return module.CheckPath(s) //nolint:wrapcheck
+	})
+	if err != nil {
+		return err
+	}
+	goVersion, err := executeGoModField(gm.Go, sp, func(s string) error {
+		if !modfile.GoVersionRE.MatchString(s) {
+			return fmt.Errorf("invalid go version %q, should be like 1.22 or 1.22.1", s)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	toolchain, err := executeGoModField(gm.Toolchain, sp, func(s string) error {
+		if !modfile.ToolchainRE.MatchString(s) {
+			return fmt.Errorf("invalid toolchain %q, should be like go1.22.1", s)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	requires := make([]*goModRequire, 0, len(gm.Require))
+	for _, r := range gm.Require {
+		path, err := executeGoModField(r.Path, sp, func(s string) error {
+			return module.CheckPath(s) //nolint:wrapcheck
+		})
+		if err != nil {
+			return err
+		}
+		version, err := executeGoModField(r.Version, sp, func(s string) error {
+			// Canonical drops any build suffix, but "+incompatible" is allowed in
+			// go.mod files.
+			if semver.Canonical(s) != s && semver.Canonical(s)+"+incompatible" != s {
+				return fmt.Errorf("invalid version %q, should be a canonical semantic version like v1.2.3", s)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		requires = append(requires, &goModRequire{path: path, version: version})
+	}
+
+	drops := make([]string, 0, len(gm.DropRequire))
+	for _, d := range gm.DropRequire {
+		path, err := executeGoModField(d, sp, nil)
+		if err != nil {
+			return err
+		}
+		drops = append(drops, path)
+	}
+
+	paths, err := processPaths(gm.Paths, sp.scope)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		absPath, err := common.JoinWithinRoot(p.Pos, sp.workDir(), p.Val)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		oldBuf, err := sp.rp.FS.ReadFile(absPath)
+		exists := err == nil
+		if err != nil {
+			if !common.IsStatNotExistErr(err) {
+				return p.Pos.Errorf("ReadFile(): %w", err)
+			}
+			if modulePath == "" {
+				return p.Pos.Errorf(`%q doesn't exist; set "module" to create a new go.mod file`, p.Val)
+			}
+		}
+
+		f, err := modfile.Parse(p.Val, oldBuf, nil)
+		if err != nil {
+			return p.Pos.Errorf("failed parsing go.mod file: %w", err)
+		}
+		if err := editGoMod(f, modulePath, goVersion, toolchain, requires, drops); err != nil {
+			return p.Pos.Errorf("failed editing %q: %w", p.Val, err)
+		}
+		// Like "go mod edit", sort the requirements and drop anything left
+		// empty by the edits.
+		f.SortBlocks()
+		f.Cleanup()
+		newBuf, err := f.Format()
+		if err != nil {
+			return p.Pos.Errorf("failed formatting %q: %w", p.Val, err)
+		}
+
+		if exists && bytes.Equal(oldBuf, newBuf) {
+			continue
+		}
+		if !exists {
+			if err := sp.rp.FS.MkdirAll(filepath.Dir(absPath), common.OwnerRWXPerms); err != nil {
+				return p.Pos.Errorf("MkdirAll(): %w", err)
+			}
+		}
+		// The permissions are ignored if the file already exists.
+		if err := sp.rp.FS.WriteFile(absPath, newBuf, common.OwnerRWPerms); err != nil {
+			return p.Pos.Errorf("WriteFile(): %w", err)
+		}
+		logger.DebugContext(ctx, "wrote go.mod file", "path", p.Val, "created", !exists)
+	}
+	return nil
+}
+
+// executeGoModField executes the template expressions in the given field and
+// validates the result, unless the field is empty.
+func executeGoModField(s model.String, sp *stepParams, validate func(string) error) (string, error) {
+	if s.Val == "" {
+		return "", nil
+	}
+	out, err := parseAndExecuteGoTmpl(s.Pos, s.Val, sp.scope)
+	if err != nil {
+		return "", err
+	}
+	if validate != nil {
+		if err := validate(out); err != nil {
+			return "", s.Pos.Errorf("%w", err)
+		}
+	}
+	return out, nil
+}
+
+func editGoMod(f *modfile.File, modulePath, goVersion, toolchain string, requires []*goModRequire, drops []string) error {
+	if modulePath != "" {
+		if err := f.AddModuleStmt(modulePath); err != nil {
+			return fmt.Errorf("AddModuleStmt(): %w", err)
+		}
+	}
+	if goVersion != "" {
+		if err := f.AddGoStmt(goVersion); err != nil {
+			return fmt.Errorf("AddGoStmt(): %w", err)
+		}
+	}
+	if toolchain != "" {
+		if err := f.AddToolchainStmt(toolchain); err != nil {
+			return fmt.Errorf("AddToolchainStmt(): %w", err)
+		}
+	}
+	for _, r := range requires {
+		if err := f.AddRequire(r.path, r.version); err != nil {
+			return fmt.Errorf("AddRequire(): %w", err)
+		}
+	}
+	for _, d := range drops {
+		if err := f.DropRequire(d); err != nil {
+			return fmt.Errorf("DropRequire(): %w", err)
+		}
+	}
+	return nil
+}
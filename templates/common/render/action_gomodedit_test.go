@@ -0,0 +1,192 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestActionGoModEdit(t *testing.T) {
+	t.Parallel()
+
+	const goMod = `module github.com/example/template
+
+go 1.21
+
+require (
+	github.com/google/go-cmp v0.6.0
+	github.com/old/dep v1.0.0 // indirect
+)
+`
+
+	cases := []struct {
+		name   string
+		gm     *spec.GoModEdit
+		inputs map[string]string
+
+		initialContents map[string]string
+		want            map[string]string
+		wantErr         string
+	}{
+		{
+			name: "edit_everything",
+			gm: &spec.GoModEdit{
+				Paths:     modelStrings([]string{"go.mod"}),
+				Module:    model.String{Val: "github.com/{{.org}}/{{.name}}"},
+				Go:        model.String{Val: "1.22"},
+				Toolchain: model.String{Val: "go1.22.1"},
+				Require: []*spec.GoModRequire{
+					{Path: model.String{Val: "github.com/google/go-cmp"}, Version: model.String{Val: "v0.7.0"}},
+					{Path: model.String{Val: "github.com/abcxyz/pkg"}, Version: model.String{Val: "{{.pkg_version}}"}},
+				},
+				DropRequire: modelStrings([]string{"github.com/old/dep"}),
+			},
+			inputs: map[string]string{"org": "my-org", "name": "my-service", "pkg_version": "v1.0.0"},
+			initialContents: map[string]string{
+				"go.mod": goMod,
+			},
+			want: map[string]string{
+				"go.mod": `module github.com/my-org/my-service
+
+go 1.22
+
+toolchain go1.22.1
+
+require (
+	github.com/abcxyz/pkg v1.0.0
+	github.com/google/go-cmp v0.7.0
+)
+`,
+			},
+		},
+		{
+			name: "create_new_file",
+			gm: &spec.GoModEdit{
+				Paths:  modelStrings([]string{"{{.dir}}/go.mod"}),
+				Module: model.String{Val: "github.com/my-org/my-service"},
+				Go:     model.String{Val: "1.22"},
+			},
+			inputs: map[string]string{"dir": "svc"},
+			want: map[string]string{
+				"svc/go.mod": "module github.com/my-org/my-service\n\ngo 1.22\n",
+			},
+		},
+		{
+			name: "missing_file_without_module_fails",
+			gm: &spec.GoModEdit{
+				Paths: modelStrings([]string{"go.mod"}),
+				Go:    model.String{Val: "1.22"},
+			},
+			want:    map[string]string{},
+			wantErr: `"go.mod" doesn't exist; set "module" to create a new go.mod file`,
+		},
+		{
+			name: "invalid_module_path",
+			gm: &spec.GoModEdit{
+				Paths:  modelStrings([]string{"go.mod"}),
+				Module: model.String{Val: "{{.name}}"},
+			},
+			inputs: map[string]string{"name": "has spaces"},
+			initialContents: map[string]string{
+				"go.mod": goMod,
+			},
+			want: map[string]string{
+				"go.mod": goMod,
+			},
+			wantErr: "malformed module path",
+		},
+		{
+			name: "invalid_go_version",
+			gm: &spec.GoModEdit{
+				Paths: modelStrings([]string{"go.mod"}),
+				Go:    model.String{Val: "go1.22"},
+			},
+			initialContents: map[string]string{
+				"go.mod": goMod,
+			},
+			want: map[string]string{
+				"go.mod": goMod,
+			},
+			wantErr: `invalid go version "go1.22"`,
+		},
+		{
+			name: "non_canonical_require_version",
+			gm: &spec.GoModEdit{
+				Paths: modelStrings([]string{"go.mod"}),
+				Require: []*spec.GoModRequire{
+					{Path: model.String{Val: "github.com/abcxyz/pkg"}, Version: model.String{Val: "v1"}},
+				},
+			},
+			initialContents: map[string]string{
+				"go.mod": goMod,
+			},
+			want: map[string]string{
+				"go.mod": goMod,
+			},
+			wantErr: `invalid version "v1"`,
+		},
+		{
+			name: "unparseable_file",
+			gm: &spec.GoModEdit{
+				Paths: modelStrings([]string{"go.mod"}),
+				Go:    model.String{Val: "1.22"},
+			},
+			initialContents: map[string]string{
+				"go.mod": "this is not a go.mod file\n",
+			},
+			want: map[string]string{
+				"go.mod": "this is not a go.mod file\n",
+			},
+			wantErr: "failed parsing go.mod file",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scratchDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, scratchDir, tc.initialContents)
+
+			sp := &stepParams{
+				scope:      common.NewScope(tc.inputs),
+				scratchDir: scratchDir,
+				rp: &Params{
+					FS: &common.RealFS{},
+				},
+			}
+			err := actionGoModEdit(context.Background(), tc.gm, sp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := abctestutil.LoadDirWithoutMode(t, scratchDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+
+	"github.com/abcxyz/abc/templates/common/hcledit"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+)
+
+// hclEdit is an HCLEditEntry after its template expressions have been
+// executed.
+type hclEdit struct {
+	pos         *model.ConfigPos
+	block       []*hcledit.Block
+	createBlock bool
+	set         []hclAttribute
+	remove      []string
+}
+
+type hclAttribute struct {
+	name, value string
+}
+
+// The hcl_edit action sets and removes attributes in files written in the HCL
+// native syntax, like Terraform files. An example edit is:
+//
+//	block: ['module "vpc"']
+//	set:
+//	  - name: 'version'
+//	    value: '"~> 9.0"'
+//
+// This would change the version attribute of the "vpc" module, leaving the
+// rest of the file as it was.
+func actionHCLEdit(ctx context.Context, he *spec.HCLEdit, sp *stepParams) error {
+	edits := make([]*hclEdit, 0, len(he.Edits))
+	for _, e := range he.Edits {
+		edit := &hclEdit{
+			pos:         &e.Pos,
+			createBlock: e.CreateBlock.Val,
+		}
+		for _, b := range e.Block {
+			header, err := parseAndExecuteGoTmpl(b.Pos, b.Val, sp.scope)
+			if err != nil {
+				return err
+			}
+			parsed, err := hcledit.ParseBlock(header)
+			if err != nil {
+				return b.Pos.Errorf("%w", err)
+			}
+			edit.block = append(edit.block, parsed)
+		}
+		for _, a := range e.Set {
+			name, err := parseAndExecuteGoTmpl(a.Name.Pos, a.Name.Val, sp.scope)
+			if err != nil {
+				return err
+			}
+			value, err := parseAndExecuteGoTmpl(a.Value.Pos, a.Value.Val, sp.scope)
+			if err != nil {
+				return err
+			}
+			edit.set = append(edit.set, hclAttribute{name: name, value: value})
+		}
+		for _, r := range e.Remove {
+			name, err := parseAndExecuteGoTmpl(r.Pos, r.Val, sp.scope)
+			if err != nil {
+				return err
+			}
+			edit.remove = append(edit.remove, name)
+		}
+		edits = append(edits, edit)
+	}
+
+	return walkAndModify(ctx, sp, he.Paths, func(buf []byte) ([]byte, error) {
+		return applyHCLEdits(buf, edits)
+	})
+}
+
+func applyHCLEdits(buf []byte, edits []*hclEdit) ([]byte, error) {
+	var err error
+	for _, e := range edits {
+		if e.createBlock {
+			if buf, err = hcledit.EnsureBlock(buf, e.block); err != nil {
+				return nil, e.pos.Errorf("%w", err)
+			}
+		}
+		for _, a := range e.set {
+			if buf, err = hcledit.SetAttribute(buf, e.block, a.name, a.value, false); err != nil {
+				return nil, e.pos.Errorf("%w", err)
+			}
+		}
+		for _, name := range e.remove {
+			if buf, err = hcledit.RemoveAttribute(buf, e.block, name); err != nil {
+				return nil, e.pos.Errorf("%w", err)
+			}
+		}
+	}
+	return buf, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestActionHCLEdit(t *testing.T) {
+	t.Parallel()
+
+	// The HCL parsing and editing is tested in the hcledit package; these cases
+	// cover templating and how edits are combined.
+	cases := []struct {
+		name   string
+		paths  []string
+		edits  []*spec.HCLEditEntry
+		inputs map[string]string
+
+		initialContents map[string]string
+		want            map[string]string
+		wantErr         string
+	}{
+		{
+			name:  "set_and_remove_templated",
+			paths: []string{"*.tf"},
+			edits: []*spec.HCLEditEntry{
+				{
+					Block: modelStrings([]string{`module "{{.module}}"`}),
+					Set: []*spec.HCLAttribute{
+						{Name: model.String{Val: "version"}, Value: model.String{Val: `"{{.version}}"`}},
+					},
+					Remove: modelStrings([]string{"ref"}),
+				},
+			},
+			inputs: map[string]string{"module": "vpc", "version": "~> 9.0"},
+			initialContents: map[string]string{
+				"main.tf":   "module \"vpc\" {\n  source  = \"x\" # keep me\n  ref     = \"main\"\n  version = \"~> 8.0\"\n}\n",
+				"other.txt": "module \"vpc\" {\n}\n",
+			},
+			want: map[string]string{
+				"main.tf":   "module \"vpc\" {\n  source  = \"x\" # keep me\n  version = \"~> 9.0\"\n}\n",
+				"other.txt": "module \"vpc\" {\n}\n",
+			},
+		},
+		{
+			name:  "create_block",
+			paths: []string{"main.tf"},
+			edits: []*spec.HCLEditEntry{
+				{
+					Block:       modelStrings([]string{"terraform", `backend "gcs"`}),
+					CreateBlock: model.Bool{Val: true},
+					Set: []*spec.HCLAttribute{
+						{Name: model.String{Val: "bucket"}, Value: model.String{Val: `"{{.bucket}}"`}},
+					},
+				},
+			},
+			inputs: map[string]string{"bucket": "my-state"},
+			initialContents: map[string]string{
+				"main.tf": "terraform {\n  required_version = \">= 1.5\"\n}\n",
+			},
+			want: map[string]string{
+				"main.tf": "terraform {\n  required_version = \">= 1.5\"\n\n  backend \"gcs\" {\n    bucket = \"my-state\"\n  }\n}\n",
+			},
+		},
+		{
+			name:  "missing_block_fails",
+			paths: []string{"main.tf"},
+			edits: []*spec.HCLEditEntry{
+				{
+					Block: modelStrings([]string{"terraform"}),
+					Set: []*spec.HCLAttribute{
+						{Name: model.String{Val: "a"}, Value: model.String{Val: "1"}},
+					},
+				},
+			},
+			initialContents: map[string]string{
+				"main.tf": "locals {}\n",
+			},
+			want: map[string]string{
+				"main.tf": "locals {}\n",
+			},
+			wantErr: `block "terraform" not found`,
+		},
+		{
+			name:  "invalid_block_header",
+			paths: []string{"main.tf"},
+			edits: []*spec.HCLEditEntry{
+				{
+					Block:  modelStrings([]string{`"terraform"`}),
+					Remove: modelStrings([]string{"a"}),
+				},
+			},
+			initialContents: map[string]string{
+				"main.tf": "terraform {}\n",
+			},
+			want: map[string]string{
+				"main.tf": "terraform {}\n",
+			},
+			wantErr: "must start with a block type",
+		},
+		{
+			name:  "missing_input",
+			paths: []string{"main.tf"},
+			edits: []*spec.HCLEditEntry{
+				{
+					Set: []*spec.HCLAttribute{
+						{Name: model.String{Val: "a"}, Value: model.String{Val: "{{.nope}}"}},
+					},
+				},
+			},
+			initialContents: map[string]string{
+				"main.tf": "a = 1\n",
+			},
+			want: map[string]string{
+				"main.tf": "a = 1\n",
+			},
+			wantErr: `nonexistent variable name "nope"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scratchDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, scratchDir, tc.initialContents)
+
+			he := &spec.HCLEdit{
+				Paths: modelStrings(tc.paths),
+				Edits: tc.edits,
+			}
+			sp := &stepParams{
+				scope:      common.NewScope(tc.inputs),
+				scratchDir: scratchDir,
+				rp: &Params{
+					FS: &common.RealFS{},
+				},
+			}
+			err := actionHCLEdit(context.Background(), he, sp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := abctestutil.LoadDirWithoutMode(t, scratchDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+			}
+		})
+	}
+}
@@ -19,9 +19,12 @@ import (
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/spec/features"
 	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
 	"github.com/abcxyz/pkg/logging"
 )
@@ -49,21 +52,22 @@ func copyToDst(ctx context.Context, sp *stepParams, skipPaths []model.String, po
 		if common.IsStatNotExistErr(err) {
 			return pos.Errorf("include path doesn't exist: %q", absSrc)
 		}
-		return fmt.Errorf("Stat(): %w", err)
+		return pos.Errorf("Stat(): %w", err)
 	}
 
 	params := &common.CopyParams{
-		DryRun:  false,
-		DstRoot: absDst,
-		FS:      sp.rp.FS,
-		SrcRoot: absSrc,
+		DryRun:   false,
+		DstRoot:  absDst,
+		FS:       sp.rp.FS,
+		Symlinks: sp.rp.Symlinks,
+		SrcRoot:  absSrc,
 		Visitor: func(relToSrcRoot string, de fs.DirEntry) (common.CopyHint, error) {
 			for _, skipPath := range skipPaths {
 				matched := (skipPath.Val == filepath.Join(relSrc, relToSrcRoot))
 				if !sp.features.SkipGlobs {
 					var err error
 					path := filepath.Join(relSrc, relToSrcRoot)
-					matched, err = filepath.Match(skipPath.Val, path)
+					matched, err = matchGlob(skipPath.Val, path, sp.features)
 					if err != nil {
 						return common.CopyHint{}, pos.Errorf("error matching path (%q) with skip pattern (%q): %w", path, skipPath.Val, err)
 					}
@@ -79,7 +83,16 @@ func copyToDst(ctx context.Context, sp *stepParams, skipPaths []model.String, po
 			if err != nil {
 				return common.CopyHint{}, fmt.Errorf("filepath.Rel(%s,%s)=%w", fromDir, absSrc, err)
 			}
-			matched, err := checkIgnore(sp.ignorePatterns, relToFromDir)
+			if fromVal == "destination" {
+				// Make the path relative to the root of the destination.
+				relToFromDir = filepath.Join(sp.basePath, relToFromDir)
+				// The destination's manifests and lock belong to abc, not to
+				// the template.
+				if relToFromDir == common.ABCInternalDir {
+					return common.CopyHint{Skip: true}, nil
+				}
+			}
+			matched, err := checkIgnore(sp.ignorePatterns, relToFromDir, sp.features)
 			if err != nil {
 				return common.CopyHint{},
 					fmt.Errorf("failed to match path(%q) with ignore patterns: %w", relToFromDir, err)
@@ -125,9 +138,11 @@ func includePath(ctx context.Context, inc *spec.IncludePath, sp *stepParams) err
 	// By default, we copy from the template directory. We also support
 	// grabbing files from the destination directory, so we can modify files
 	// that already exist in the destination.
+	// When copying from the destination, the step's base path applies to the
+	// source too, so each file is copied back to the same place.
 	fromDir := sp.templateDir
 	if inc.From.Val == "destination" {
-		fromDir = sp.rp.DestDir
+		fromDir = filepath.Join(sp.rp.DestDir, sp.basePath)
 	}
 
 	skipPaths, err := processPaths(inc.Skip, sp.scope)
@@ -161,8 +176,30 @@ func includePath(ctx context.Context, inc *spec.IncludePath, sp *stepParams) err
 		return err
 	}
 
+	var stripPrefix string
+	if inc.StripPrefix.Val != "" {
+		prefixes, err := processPaths([]model.String{inc.StripPrefix}, sp.scope)
+		if err != nil {
+			return err
+		}
+		stripPrefix = prefixes[0].Val
+	}
+	// Negated paths exclude files from every glob, and are also skipped like
+	// the skip paths, to exclude files inside an included directory.
+	var negatedPaths []model.String
+	negated := negatedGlobs(incPaths, sp.features)
+	if len(negated) > 0 {
+		negatedPaths = slices.DeleteFunc(slices.Clone(incPaths), func(p model.String) bool {
+			return !strings.HasPrefix(p.Val, "!")
+		})
+		skipPaths = append(skipPaths, negated...)
+	}
+
 	for i, p := range incPaths {
-		matchedPaths, err := processGlobs(ctx, []model.String{p}, fromDir, sp.features.SkipGlobs)
+		if len(negated) > 0 && strings.HasPrefix(p.Val, "!") {
+			continue
+		}
+		matchedPaths, err := processGlobs(ctx, sp.rp.FS, append([]model.String{p}, negatedPaths...), fromDir, sp.features)
 		if err != nil {
 			return err
 		}
@@ -175,6 +212,11 @@ func includePath(ctx context.Context, inc *spec.IncludePath, sp *stepParams) err
 
 			// if no As val was provided, use the original file or directory name.
 			relDst := relSrc
+			if stripPrefix != "" {
+				if relDst, err = stripPathPrefix(relSrc, stripPrefix); err != nil {
+					return inc.StripPrefix.Pos.Errorf("%w", err)
+				}
+			}
 			// As val provided, check if pattern has file globbing
 			if len(asPaths) > 0 {
 				if isGlob(matchedPaths, filepath.Join(fromDir, p.Val), absSrc.Val) {
@@ -185,7 +227,10 @@ func includePath(ctx context.Context, inc *spec.IncludePath, sp *stepParams) err
 					relDst = asPaths[i].Val
 				}
 			}
-			absDst := filepath.Join(sp.scratchDir, relDst)
+			absDst, err := common.JoinWithinRoot(absSrc.Pos, sp.workDir(), relDst)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
 
 			if err := copyToDst(ctx, sp, skipPaths, absSrc.Pos, absDst, absSrc.Val, relSrc, inc.From.Val, fromDir); err != nil {
 				return err
@@ -195,9 +240,21 @@ func includePath(ctx context.Context, inc *spec.IncludePath, sp *stepParams) err
 	return nil
 }
 
+// stripPathPrefix returns relPath relative to the directory prefix, for the
+// "strip_prefix" of an include. Including prefix itself returns ".", so its
+// contents are written to the root of the output.
+func stripPathPrefix(relPath, prefix string) (string, error) {
+	out, err := filepath.Rel(prefix, relPath)
+	if err != nil || !filepath.IsLocal(out) {
+		return "", fmt.Errorf("the included path %q isn't inside the strip_prefix %q", relPath, prefix)
+	}
+	return out, nil
+}
+
 // checkIgnore checks the given path against the given patterns, if given
-// patterns is not provided, a default list of patterns is used.
-func checkIgnore(patterns []model.String, path string) (bool, error) {
+// patterns is not provided, a default list of patterns is used. The glob
+// syntax depends on the api_version, as given by f.
+func checkIgnore(patterns []model.String, path string, f features.Features) (bool, error) {
 	if len(patterns) == 0 {
 		patterns = defaultIgnorePatterns
 	}
@@ -209,10 +266,10 @@ func checkIgnore(patterns []model.String, path string) (bool, error) {
 			matched, err = filepath.Match(p.Val, filepath.Base(path))
 		} else if p.Val[0] == '/' {
 			// Match pattern with a leading slash as it is from the same root as path.
-			matched, err = filepath.Match(p.Val[1:], path)
+			matched, err = matchGlob(p.Val[1:], path, f)
 		} else {
-			// Math pattern using relative path.
-			matched, err = filepath.Match(p.Val, path)
+			// Match pattern using relative path.
+			matched, err = matchGlob(p.Val, path, f)
 		}
 		if err != nil {
 			return false,
@@ -100,6 +100,76 @@ func TestActionInclude(t *testing.T) {
 			},
 			wantErr: `path "../*.txt" must not contain ".."`,
 		},
+		{
+			name: "reject_templated_dot_dot",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: modelStrings([]string{"{{.my_dir}}/file.txt"}),
+					},
+				},
+			},
+			inputs: map[string]string{
+				"my_dir": "foo/../..",
+			},
+			wantErr: `path "foo/../../file.txt" must not contain ".."`,
+		},
+		{
+			name: "reject_templated_dot_dot_in_as",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: modelStrings([]string{"file.txt"}),
+						As:    modelStrings([]string{"{{.my_dir}}/file.txt"}),
+					},
+				},
+			},
+			templateContents: map[string]abctestutil.ModeAndContents{
+				"file.txt": {Mode: 0o600, Contents: "file contents"},
+			},
+			inputs: map[string]string{
+				"my_dir": "..",
+			},
+			wantErr: `path "../file.txt" must not contain ".."`,
+		},
+		{
+			name: "templated_absolute_as_stays_in_scratch_dir",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: modelStrings([]string{"file.txt"}),
+						As:    modelStrings([]string{"{{.my_dir}}/file.txt"}),
+					},
+				},
+			},
+			templateContents: map[string]abctestutil.ModeAndContents{
+				"file.txt": {Mode: 0o600, Contents: "file contents"},
+			},
+			inputs: map[string]string{
+				"my_dir": "//etc",
+			},
+			wantScratchContents: map[string]abctestutil.ModeAndContents{
+				"etc/file.txt": {Mode: 0o600, Contents: "file contents"},
+			},
+		},
+		{
+			name: "reject_templated_nul_byte",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: modelStrings([]string{"file.txt"}),
+						As:    modelStrings([]string{"{{.my_file}}"}),
+					},
+				},
+			},
+			templateContents: map[string]abctestutil.ModeAndContents{
+				"file.txt": {Mode: 0o600, Contents: "file contents"},
+			},
+			inputs: map[string]string{
+				"my_file": "file.txt\x00.md",
+			},
+			wantErr: "must not contain a NUL byte",
+		},
 		{
 			name: "templated_filename_success",
 			include: &spec.Include{
@@ -421,6 +491,67 @@ func TestActionInclude(t *testing.T) {
 				"file4.txt": {Mode: 0o600, Contents: "my file contents"},
 			},
 		},
+		{
+			name: "strip_prefix_from_dir",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths:       modelStrings([]string{"src/app"}),
+						StripPrefix: model.String{Val: "src"},
+					},
+				},
+			},
+			templateContents: map[string]abctestutil.ModeAndContents{
+				"src/app/main.go":     {Mode: 0o600, Contents: "main contents"},
+				"src/app/lib/lib.go":  {Mode: 0o600, Contents: "lib contents"},
+				"src/other/other.txt": {Mode: 0o600, Contents: "other contents"},
+			},
+			wantScratchContents: map[string]abctestutil.ModeAndContents{
+				"app/main.go":    {Mode: 0o600, Contents: "main contents"},
+				"app/lib/lib.go": {Mode: 0o600, Contents: "lib contents"},
+			},
+		},
+		{
+			name: "strip_prefix_whole_path_and_glob",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths:       modelStrings([]string{"{{.dir}}", "{{.dir}}/*.md"}),
+						StripPrefix: model.String{Val: "{{.dir}}"},
+						Skip:        modelStrings([]string{"template/*.md"}),
+					},
+				},
+			},
+			templateContents: map[string]abctestutil.ModeAndContents{
+				"template/file.txt":  {Mode: 0o600, Contents: "file contents"},
+				"template/README.md": {Mode: 0o600, Contents: "readme contents"},
+			},
+			inputs: map[string]string{
+				"dir": "template",
+			},
+			wantScratchContents: map[string]abctestutil.ModeAndContents{
+				"file.txt": {Mode: 0o600, Contents: "file contents"},
+			},
+		},
+		{
+			name: "strip_prefix_not_matching",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths:       modelStrings([]string{"src/app", "lib/main.go"}),
+						StripPrefix: model.String{Val: "src"},
+					},
+				},
+			},
+			templateContents: map[string]abctestutil.ModeAndContents{
+				"src/app/main.go": {Mode: 0o600, Contents: "main contents"},
+				"lib/main.go":     {Mode: 0o600, Contents: "lib contents"},
+			},
+			wantScratchContents: map[string]abctestutil.ModeAndContents{
+				"app/main.go": {Mode: 0o600, Contents: "main contents"},
+			},
+			wantErr: `the included path "lib/main.go" isn't inside the strip_prefix "src"`,
+		},
 		{
 			name: "spec_yaml_should_be_skipped",
 			include: &spec.Include{
@@ -17,6 +17,7 @@ package render
 import (
 	"context"
 	"regexp"
+	"sort"
 
 	"golang.org/x/exp/maps"
 
@@ -83,8 +84,10 @@ func replaceWithNameLookup(allMatches [][]int, b []byte, rn *spec.RegexNameLooku
 			subGroupName := re.SubexpNames()[subGroupIdx]
 			replacementVal, ok := scope.Lookup(subGroupName)
 			if !ok {
+				varNames := maps.Keys(scope.All())
+				sort.Strings(varNames)
 				return nil, rn.Regex.Pos.Errorf("there was no template input variable matching the subgroup name %q; available variables are %v",
-					subGroupName, maps.Keys(scope.All()))
+					subGroupName, varNames)
 			}
 			replaceAtStartIdx := oneMatch[subGroupIdx*2]
 			replaceAtEndIdx := oneMatch[subGroupIdx*2+1]
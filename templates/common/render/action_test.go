@@ -27,6 +27,7 @@ import (
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/spec/features"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/testutil"
@@ -548,6 +549,31 @@ func TestProcessGlobs(t *testing.T) {
 				"subfolder2/file5.txt",
 			}),
 		},
+		{
+			// Paths are expanded in the order they're given, each glob's
+			// matches are in lexical order, and a match that an earlier path
+			// already had isn't repeated.
+			name: "glob_order",
+			dirContents: map[string]abctestutil.ModeAndContents{
+				"a10.txt": {Mode: 0o600, Contents: "a10 contents"},
+				"a2.txt":  {Mode: 0o600, Contents: "a2 contents"},
+				"B.txt":   {Mode: 0o600, Contents: "B contents"},
+				"z/b.txt": {Mode: 0o600, Contents: "z/b contents"},
+				"z/a.txt": {Mode: 0o600, Contents: "z/a contents"},
+			},
+			paths: modelStrings([]string{
+				"z/*",
+				"a*.txt",
+				"*.txt",
+			}),
+			wantPaths: modelStrings([]string{
+				"z/a.txt",
+				"z/b.txt",
+				"a10.txt",
+				"a2.txt",
+				"B.txt",
+			}),
+		},
 		{
 			name: "glob_star_in_middle",
 			dirContents: map[string]abctestutil.ModeAndContents{
@@ -625,6 +651,41 @@ func TestProcessGlobs(t *testing.T) {
 			wantGlobErr:    fmt.Sprintf(`glob %q did not match any files`, "file_not_found.txt"),
 			wantNonGlobErr: fmt.Sprintf(`include path doesn't exist: %q`, "file_not_found.txt"),
 		},
+		{
+			name: "double_star_paths",
+			dirContents: map[string]abctestutil.ModeAndContents{
+				"file1.txt":              {Mode: 0o600, Contents: "file1 contents"},
+				"subfolder1/file3.txt":   {Mode: 0o600, Contents: "file3 contents"},
+				"subfolder2/a/file4.md":  {Mode: 0o600, Contents: "file4 contents"},
+				"subfolder2/a/file5.txt": {Mode: 0o600, Contents: "file5 contents"},
+			},
+			paths: modelStrings([]string{
+				"**/*.txt",
+			}),
+			wantPaths: modelStrings([]string{
+				"file1.txt",
+				"subfolder1/file3.txt",
+				"subfolder2/a/file5.txt",
+			}),
+		},
+		{
+			name: "negated_paths",
+			dirContents: map[string]abctestutil.ModeAndContents{
+				"file1.txt":            {Mode: 0o600, Contents: "file1 contents"},
+				"file2_test.txt":       {Mode: 0o600, Contents: "file2 contents"},
+				"subfolder1/file3.txt": {Mode: 0o600, Contents: "file3 contents"},
+				"subfolder2/file4.txt": {Mode: 0o600, Contents: "file4 contents"},
+			},
+			paths: modelStrings([]string{
+				"!**/*_test.txt",
+				"**/*.txt",
+				"!subfolder1",
+			}),
+			wantPaths: modelStrings([]string{
+				"file1.txt",
+				"subfolder2/file4.txt",
+			}),
+		},
 		{
 			name: "character_range_paths",
 			dirContents: map[string]abctestutil.ModeAndContents{
@@ -650,7 +711,7 @@ func TestProcessGlobs(t *testing.T) {
 			abctestutil.WriteAll(t, tempDir, tc.dirContents)
 			ctx := context.Background()
 
-			gotPaths, err := processGlobs(ctx, tc.paths, tempDir, false) // with globbing enabled
+			gotPaths, err := processGlobs(ctx, &common.RealFS{}, tc.paths, tempDir, features.Features{}) // with globbing enabled
 			if diff := testutil.DiffErrString(err, tc.wantGlobErr); diff != "" {
 				t.Error(diff)
 			}
@@ -692,3 +753,34 @@ func modelStrings(ss []string) []model.String {
 	}
 	return out
 }
+
+func BenchmarkWalkAndModify(b *testing.B) {
+	helloToHello := func(buf []byte) ([]byte, error) {
+		// Replacing a word with itself reads and scans every file without
+		// changing the tree between iterations.
+		return bytes.ReplaceAll(buf, []byte("hello"), []byte("hello")), nil
+	}
+
+	for _, numFiles := range abctestutil.BenchmarkSizes {
+		numFiles := numFiles
+
+		b.Run(abctestutil.BenchmarkName(numFiles), func(b *testing.B) {
+			ctx := abctestutil.BenchmarkContext()
+			scratchDir := b.TempDir()
+			abctestutil.WriteTree(b, scratchDir, abctestutil.SyntheticTree(numFiles))
+			sp := &stepParams{
+				scope:      common.NewScope(nil),
+				scratchDir: scratchDir,
+				rp:         &Params{FS: &common.RealFS{}},
+			}
+			paths := []model.String{{Val: "."}}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := walkAndModify(ctx, sp, paths, helloToHello); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/input"
+)
+
+// ConflictPolicy says what to do with an output file that already exists in
+// the destination. It's the value of --on-conflict.
+type ConflictPolicy string
+
+const (
+	// ConflictError fails the render without writing anything. This is the
+	// default. If standard input is a terminal, the user is asked about each
+	// conflicting file instead.
+	ConflictError ConflictPolicy = "error"
+
+	// ConflictOverwrite overwrites the existing file, like --force-overwrite.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+
+	// ConflictKeep leaves the existing file alone, and counts the output file
+	// as skipped.
+	ConflictKeep ConflictPolicy = "keep"
+)
+
+// ConflictPolicies are the valid values of ConflictPolicy, as strings for use
+// in flag help and error messages.
+var ConflictPolicies = []string{string(ConflictError), string(ConflictOverwrite), string(ConflictKeep)}
+
+// ParseConflictPolicy converts a flag value to a ConflictPolicy. The empty
+// string means ConflictError.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch ConflictPolicy(s) {
+	case "", ConflictError:
+		return ConflictError, nil
+	case ConflictOverwrite, ConflictKeep:
+		return ConflictPolicy(s), nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy %q, must be one of %s", s, strings.Join(ConflictPolicies, ", "))
+	}
+}
+
+// conflictResolver decides what to do with each output file that already
+// exists in the destination. The decisions are made during the dry run of
+// commit, and remembered for the real one, so the user is only asked once.
+type conflictResolver struct {
+	policy ConflictPolicy
+
+	// prompter is non-nil if the user should be asked about conflicts that
+	// the policy would otherwise fail on.
+	prompter input.Prompter
+
+	// overwrite holds the decision for each conflicting path that has been
+	// resolved, keyed by path relative to the destination.
+	overwrite map[string]bool
+}
+
+// newConflictResolver returns a conflictResolver for p. The user is only
+// asked about conflicts if there's no other policy and standard input is a
+// terminal, so scripts keep failing rather than hanging on a prompt.
+func newConflictResolver(p *Params) *conflictResolver {
+	r := &conflictResolver{
+		policy:    p.OnConflict,
+		overwrite: map[string]bool{},
+	}
+	if r.policy == "" {
+		r.policy = ConflictError
+	}
+	if p.ForceOverwrite {
+		r.policy = ConflictOverwrite
+	}
+	if r.policy == ConflictError && p.Prompter != nil {
+		if p.SkipPromptTTYCheck || (p.Prompter.Stdin() == os.Stdin && isatty.IsTerminal(os.Stdin.Fd())) {
+			r.prompter = p.Prompter
+		}
+	}
+	return r
+}
+
+// resolve returns whether the output file relPath in scratchDir should
+// overwrite the existing file in destDir. If it shouldn't, and the existing
+// file should be kept, keep is true. If neither is true, writing the file
+// fails with a conflict error.
+func (r *conflictResolver) resolve(ctx context.Context, rfs common.FS, scratchDir, destDir, relPath string) (overwrite, keep bool, _ error) {
+	if o, ok := r.overwrite[relPath]; ok {
+		return o, !o, nil
+	}
+	switch r.policy {
+	case ConflictOverwrite:
+		return true, false, nil
+	case ConflictKeep:
+		return false, true, nil
+	case ConflictError:
+	}
+	if r.prompter == nil {
+		return false, false, nil
+	}
+
+	destPath := filepath.Join(destDir, relPath)
+	if fi, err := rfs.Stat(destPath); err != nil || fi.IsDir() {
+		// A directory where the file would go can't be overwritten anyway, so
+		// let that fail as usual.
+		return false, false, nil //nolint:nilerr
+	}
+	existing, err := rfs.ReadFile(destPath)
+	if err != nil {
+		return false, false, fmt.Errorf("ReadFile(): %w", err)
+	}
+	rendered, err := rfs.ReadFile(filepath.Join(scratchDir, relPath))
+	if err != nil {
+		return false, false, fmt.Errorf("ReadFile(): %w", err)
+	}
+	if bytes.Equal(existing, rendered) {
+		// Nothing to ask about. Overwriting it changes nothing, and keeps it
+		// in the manifest.
+		r.overwrite[relPath] = true
+		return true, false, nil
+	}
+
+	question := fmt.Sprintf("The output file %s already exists with different contents. "+
+		"[o]verwrite it, [k]eep the existing file, show the [d]iff, or [a]bort the render? ", filepath.ToSlash(relPath))
+	msg := question
+	for {
+		answer, err := r.prompter.Prompt(ctx, "%s", msg)
+		if err != nil {
+			return false, false, fmt.Errorf("failed prompting about the existing file %s: %w", relPath, err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "o", "overwrite":
+			r.overwrite[relPath] = true
+			return true, false, nil
+		case "k", "keep":
+			r.overwrite[relPath] = false
+			return false, true, nil
+		case "d", "diff":
+			msg = conflictDiff(existing, rendered) + question
+		case "a", "abort":
+			return false, false, errs.Wrap(errs.ErrConflict, fmt.Errorf("render aborted at the existing file %s; nothing was written", relPath))
+		default:
+			msg = `Please answer "o", "k", "d", or "a". ` + question
+		}
+	}
+}
+
+// conflictDiff returns a line diff from the existing contents of a file to
+// its rendered contents, with removed lines prefixed with "-" and added lines
+// with "+".
+func conflictDiff(existing, rendered []byte) string {
+	if common.IsBinary(existing) || common.IsBinary(rendered) {
+		return "(binary files differ)\n"
+	}
+	dmp := diffmatchpatch.New()
+	existingChars, renderedChars, lines := dmp.DiffLinesToChars(string(existing), string(rendered))
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(existingChars, renderedChars, false), lines)
+
+	var sb strings.Builder
+	sb.WriteString("--- existing\n+++ rendered\n")
+	for _, d := range diffs {
+		prefix := " "
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+		case diffmatchpatch.DiffEqual:
+		}
+		text := d.Text
+		for text != "" {
+			line, rest, found := strings.Cut(text, "\n")
+			sb.WriteString(prefix + line + "\n")
+			if !found {
+				sb.WriteString("\\ No newline at end of file\n")
+			}
+			text = rest
+		}
+	}
+	return sb.String()
+}
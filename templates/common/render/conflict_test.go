@@ -0,0 +1,243 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRender_Conflicts(t *testing.T) {
+	t.Parallel()
+
+	templateContents := map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with two files'
+steps:
+  - desc: 'Include the files'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'b.txt']
+`,
+		"a.txt": "line 1\nnew a\n",
+		"b.txt": "b\n",
+	}
+	existing := map[string]string{
+		"a.txt": "line 1\nold a\n",
+	}
+	overwritten := map[string]string{
+		"a.txt": "line 1\nnew a\n",
+		"b.txt": "b\n",
+	}
+	kept := map[string]string{
+		"a.txt": "line 1\nold a\n",
+		"b.txt": "b\n",
+	}
+
+	cases := []struct {
+		name       string
+		onConflict ConflictPolicy
+		// prompt simulates standard input being a terminal.
+		prompt       bool
+		existing     map[string]string
+		dialog       []abctestutil.DialogStep
+		wantDest     map[string]string
+		wantSkipped  int
+		wantConflict *Event
+		wantErr      string
+	}{
+		{
+			name:     "error_without_terminal",
+			existing: existing,
+			wantDest: existing,
+			wantErr:  "already exists and overwriting was not enabled",
+		},
+		{
+			name:         "overwrite",
+			onConflict:   ConflictOverwrite,
+			existing:     existing,
+			wantDest:     overwritten,
+			wantConflict: &Event{Type: EventConflict, Path: "a.txt", Overwrite: true},
+		},
+		{
+			name:         "keep",
+			onConflict:   ConflictKeep,
+			existing:     existing,
+			wantDest:     kept,
+			wantSkipped:  1,
+			wantConflict: &Event{Type: EventConflict, Path: "a.txt", Keep: true},
+		},
+		{
+			name:         "keep_is_not_asked_about",
+			onConflict:   ConflictKeep,
+			prompt:       true,
+			existing:     existing,
+			wantDest:     kept,
+			wantSkipped:  1,
+			wantConflict: &Event{Type: EventConflict, Path: "a.txt", Keep: true},
+		},
+		{
+			name:     "prompt_overwrite_after_diff",
+			prompt:   true,
+			existing: existing,
+			dialog: []abctestutil.DialogStep{
+				{
+					WaitForPrompt: "The output file a.txt already exists with different contents.",
+					ThenRespond:   "d\n",
+				},
+				{
+					WaitForPrompt: "--- existing\n+++ rendered\n line 1\n-old a\n+new a\n",
+					ThenRespond:   "o\n",
+				},
+			},
+			wantDest:     overwritten,
+			wantConflict: &Event{Type: EventConflict, Path: "a.txt", Overwrite: true},
+		},
+		{
+			name:     "prompt_keep_after_bad_answer",
+			prompt:   true,
+			existing: existing,
+			dialog: []abctestutil.DialogStep{
+				{
+					WaitForPrompt: "The output file a.txt already exists",
+					ThenRespond:   "yes\n",
+				},
+				{
+					WaitForPrompt: `Please answer "o", "k", "d", or "a".`,
+					ThenRespond:   "k\n",
+				},
+			},
+			wantDest:     kept,
+			wantSkipped:  1,
+			wantConflict: &Event{Type: EventConflict, Path: "a.txt", Keep: true},
+		},
+		{
+			name:     "prompt_abort",
+			prompt:   true,
+			existing: existing,
+			dialog: []abctestutil.DialogStep{
+				{
+					WaitForPrompt: "The output file a.txt already exists",
+					ThenRespond:   "a\n",
+				},
+			},
+			wantDest: existing,
+			wantErr:  "render aborted at the existing file a.txt",
+		},
+		{
+			name:   "same_contents_not_asked_about",
+			prompt: true,
+			existing: map[string]string{
+				"a.txt": "line 1\nnew a\n",
+			},
+			wantDest:     overwritten,
+			wantConflict: &Event{Type: EventConflict, Path: "a.txt", Overwrite: true},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			dest := filepath.Join(tempDir, "dest")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, templateContents)
+			abctestutil.WriteAllDefaultMode(t, dest, tc.existing)
+
+			cmd := &cli.BaseCommand{}
+			stdinReader, stdinWriter := io.Pipe()
+			stdoutReader, stdoutWriter := io.Pipe()
+			_, stderrWriter := io.Pipe()
+			cmd.SetStdin(stdinReader)
+			cmd.SetStdout(stdoutWriter)
+			cmd.SetStderr(stderrWriter)
+
+			var conflicts []*Event
+			stats := &Stats{}
+			params := &Params{
+				BackupDir:         filepath.Join(tempDir, "backups"),
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				OnConflict:        tc.onConflict,
+				SourceForMessages: sourceDir,
+				Stats:             stats,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+				OnEvent: func(e *Event) {
+					if e.Type == EventConflict {
+						conflicts = append(conflicts, e)
+					}
+				},
+			}
+			if tc.prompt {
+				params.Prompter = cmd
+				params.SkipPromptTTYCheck = true
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			errCh := make(chan error)
+			go func() {
+				defer close(errCh)
+				errCh <- Render(ctx, params)
+			}()
+
+			for _, ds := range tc.dialog {
+				abctestutil.ReadWithTimeout(t, stdoutReader, ds.WaitForPrompt)
+				abctestutil.WriteWithTimeout(t, stdinWriter, ds.ThenRespond)
+			}
+
+			select {
+			case err := <-errCh:
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the render to finish")
+			}
+
+			if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, dest), tc.wantDest); diff != "" {
+				t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+			if diff := cmp.Diff(conflicts, []*Event{tc.wantConflict}); diff != "" {
+				t.Errorf("conflict events were not as expected (-got,+want): %s", diff)
+			}
+			if stats.FilesSkipped != tc.wantSkipped {
+				t.Errorf("got %d skipped files, want %d", stats.FilesSkipped, tc.wantSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+)
+
+// Coverage records which steps of a template's spec were executed, across one
+// or more renders of the same template. It's used by golden tests to point out
+// steps that none of the tests exercise, like a step whose "if" condition is
+// never true.
+//
+// A Coverage may be shared by concurrent calls to Render.
+type Coverage struct {
+	mu    sync.Mutex
+	steps map[coverageKey]*StepCoverage
+}
+
+// coverageKey identifies a step. Steps are identified by their position rather
+// than by pointer, because each render parses the spec file again.
+type coverageKey struct {
+	template     string
+	line, column int
+}
+
+// StepCoverage is the coverage of a single step.
+type StepCoverage struct {
+	// Template is empty for steps of the template being rendered. For steps
+	// of a base template, it's the "extends" value naming that template.
+	Template string
+
+	// Line and Column are the position of the step in its spec file.
+	Line, Column int
+
+	// Action and Desc are the step's fields of the same names.
+	Action string
+	Desc   string
+
+	// HasIf is true if the step has an "if" condition.
+	HasIf bool
+
+	// Ran is the number of times the step ran. A step inside a for_each or a
+	// step group may run more than once per render.
+	Ran int
+
+	// SkippedByIf is the number of times that the step was skipped because
+	// its "if" condition was false.
+	SkippedByIf int
+}
+
+// NewCoverage returns an empty Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		steps: map[coverageKey]*StepCoverage{},
+	}
+}
+
+// Steps returns the coverage of every step that has been seen, sorted by
+// template and then position. Steps that never ran are included.
+func (c *Coverage) Steps() []*StepCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]*StepCoverage, 0, len(c.steps))
+	for _, sc := range c.steps {
+		cp := *sc
+		out = append(out, &cp)
+	}
+	slices.SortFunc(out, func(a, b *StepCoverage) int {
+		if d := cmp.Compare(a.Template, b.Template); d != 0 {
+			return d
+		}
+		if d := cmp.Compare(a.Line, b.Line); d != 0 {
+			return d
+		}
+		return cmp.Compare(a.Column, b.Column)
+	})
+	return out
+}
+
+// addSpec records the existence of every step in s, including the steps
+// inside for_each actions and step groups, so that steps that never run are
+// still reported.
+func (c *Coverage) addSpec(template string, s *spec.Spec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addSteps(template, s.PreRender)
+	c.addSteps(template, s.Steps)
+	c.addSteps(template, s.PostRender)
+	for _, g := range s.StepGroups {
+		c.addSteps(template, g.Steps)
+	}
+}
+
+// addSteps must be called with c.mu held.
+func (c *Coverage) addSteps(template string, steps []*spec.Step) {
+	for _, step := range steps {
+		c.entry(template, step)
+		if step.ForEach != nil {
+			c.addSteps(template, step.ForEach.Steps)
+		}
+	}
+}
+
+// record counts one execution of a step, or one time that it was skipped
+// because of its "if" condition.
+func (c *Coverage) record(template string, step *spec.Step, ran bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sc := c.entry(template, step)
+	if ran {
+		sc.Ran++
+	} else {
+		sc.SkippedByIf++
+	}
+}
+
+// entry returns the coverage of the given step, creating it if needed. It
+// must be called with c.mu held.
+func (c *Coverage) entry(template string, step *spec.Step) *StepCoverage {
+	key := coverageKey{template: template, line: step.Pos.Line, column: step.Pos.Column}
+	sc, ok := c.steps[key]
+	if !ok {
+		sc = &StepCoverage{
+			Template: template,
+			Line:     step.Pos.Line,
+			Column:   step.Pos.Column,
+			Action:   step.Action.Val,
+			Desc:     step.Desc.Val,
+			HasIf:    step.If.Val != "",
+		}
+		c.steps[key] = sc
+	}
+	return sc
+}
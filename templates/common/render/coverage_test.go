@@ -0,0 +1,99 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+)
+
+func TestCoverage(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with conditional steps'
+inputs:
+  - name: 'envs'
+    desc: 'Comma-separated environments'
+step_groups:
+  - name: 'unused_group'
+    steps:
+      - desc: 'Never called'
+        action: 'print'
+        params:
+          message: 'unused'
+steps:
+  - desc: 'Always'
+    action: 'print'
+    params:
+      message: 'always'
+  - desc: 'Loop'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'env'
+        values_from: 'envs == "" ? [] : envs.split(",")'
+      steps:
+        - desc: 'Only prod'
+          action: 'print'
+          if: 'env == "prod"'
+          params:
+            message: 'prod'
+`
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{"spec.yaml": specContents})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	cov := NewCoverage()
+	for i, envs := range []string{"dev,staging", ""} {
+		err := Render(ctx, &Params{
+			Clock:             clock.NewMock(),
+			Coverage:          cov,
+			DestDir:           filepath.Join(tempDir, "dest", string(rune('a'+i))),
+			Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+			FS:                &common.RealFS{},
+			Inputs:            map[string]string{"envs": envs},
+			SourceForMessages: sourceDir,
+			Stdout:            io.Discard,
+			TempDirBase:       tempDir,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []*StepCoverage{
+		{Line: 10, Column: 9, Action: "print", Desc: "Never called"},
+		{Line: 15, Column: 5, Action: "print", Desc: "Always", Ran: 2},
+		{Line: 19, Column: 5, Action: "for_each", Desc: "Loop", Ran: 2},
+		{Line: 26, Column: 11, Action: "print", Desc: "Only prod", HasIf: true, SkippedByIf: 2},
+	}
+	if diff := cmp.Diff(cov.Steps(), want); diff != "" {
+		t.Errorf("coverage was not as expected (-got,+want): %s", diff)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// destOutput is the part of the output that's written to one destination
+// directory, along with its own manifest.
+type destOutput struct {
+	// p are the render's Params, with DestDir set to the directory of the
+	// destination.
+	p *Params
+
+	// cp are the params of the commit, whose scratchDir has the output files
+	// of the destination.
+	cp *commitParams
+}
+
+// splitDestinations moves the output files of each of the spec's destinations
+// that's given a directory in p.ExtraDests out of the scratch directory of cp,
+// into a new scratch directory of its own, at the paths they're mapped to. It
+// returns the outputs to write: the main destination's first, which is the
+// rest of cp's scratch directory, then those of the destinations in the order
+// of the spec. A path that's mapped to a destination but isn't in the output
+// is ignored, since templates may leave out some files depending on their
+// inputs.
+func splitDestinations(ctx context.Context, p *Params, destinations []*spec.Destination, tempTracker *tempdir.DirTracker, cp *commitParams) ([]*destOutput, error) {
+	logger := logging.FromContext(ctx).With("logger", "splitDestinations")
+
+	if err := checkExtraDests(p, destinations); err != nil {
+		return nil, err
+	}
+
+	out := []*destOutput{{p: p, cp: cp}}
+	for _, d := range destinations {
+		dir, ok := p.ExtraDests[d.Name.Val]
+		if !ok {
+			continue
+		}
+		scratchDir, err := tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.ScratchDirNamePart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp directory for the destination %q: %w", d.Name.Val, err)
+		}
+		for _, dp := range d.Paths {
+			src := filepath.Join(cp.scratchDir, filepath.FromSlash(dp.From.Val))
+			if _, err := p.FS.Stat(src); err != nil {
+				if common.IsStatNotExistErr(err) {
+					continue
+				}
+				return nil, fmt.Errorf("Stat(): %w", err)
+			}
+			dst := filepath.Join(scratchDir, filepath.FromSlash(dp.Target()))
+			if err := moveInto(p.FS, src, dst); err != nil {
+				return nil, dp.From.Pos.Errorf("failed moving %q to %q in the destination %q: %w", dp.From.Val, dp.Target(), d.Name.Val, err)
+			}
+			logger.DebugContext(ctx, "moved output to another destination",
+				"from", dp.From.Val,
+				"to", dp.Target(),
+				"destination", d.Name.Val,
+				"dir", dir)
+		}
+
+		destParams := *p
+		destParams.DestDir = dir
+		destCP := *cp
+		destCP.destination = d.Name.Val
+		destCP.scratchDir = scratchDir
+		// Files included "from: destination" came from the main destination,
+		// so they aren't overwritten in this one without asking.
+		destCP.includedFromDest = nil
+		// The post_render steps name paths in the main destination.
+		destCP.postRender = nil
+		out = append(out, &destOutput{p: &destParams, cp: &destCP})
+	}
+	return out, nil
+}
+
+// checkExtraDests returns an error if p.ExtraDests names a destination that
+// isn't in the spec, or gives a directory that's used for another
+// destination.
+func checkExtraDests(p *Params, destinations []*spec.Destination) error {
+	if len(p.ExtraDests) == 0 {
+		return nil
+	}
+	if len(p.OnlyPaths) > 0 {
+		return fmt.Errorf("--only-paths can't be combined with --extra-dest")
+	}
+
+	declared := make([]string, 0, len(destinations))
+	for _, d := range destinations {
+		declared = append(declared, d.Name.Val)
+	}
+	names := maps.Keys(p.ExtraDests)
+	sort.Strings(names)
+	dirs := map[string]string{filepath.Clean(p.DestDir): "--dest"}
+	for _, name := range names {
+		if !slices.Contains(declared, name) {
+			known := "it has none"
+			if len(declared) > 0 {
+				known = "it has " + strings.Join(declared, ", ")
+			}
+			return errs.Wrap(errs.ErrInputValidation, fmt.Errorf("the template has no destination named %q, given in --extra-dest; %s", name, known))
+		}
+		dir := filepath.Clean(p.ExtraDests[name])
+		if other, ok := dirs[dir]; ok {
+			return errs.Wrap(errs.ErrInputValidation, fmt.Errorf("the directory %q of the destination %q is also the directory of %s", p.ExtraDests[name], name, other))
+		}
+		dirs[dir] = fmt.Sprintf("the destination %q", name)
+	}
+	return nil
+}
+
+// moveInto moves the file, symlink, or directory src to dst, creating the
+// parent directories of dst. If dst is an existing directory and src is a
+// directory too, the contents of src are moved into it instead, so several
+// paths can be moved into one directory, like the root of a destination.
+func moveInto(fsys common.FS, src, dst string) error {
+	dstInfo, err := fsys.Stat(dst)
+	if err != nil {
+		if !common.IsStatNotExistErr(err) {
+			return fmt.Errorf("Stat(): %w", err)
+		}
+		if err := fsys.MkdirAll(filepath.Dir(dst), common.OwnerRWXPerms); err != nil {
+			return fmt.Errorf("MkdirAll(): %w", err)
+		}
+		if err := fsys.Rename(src, dst); err != nil {
+			return fmt.Errorf("Rename(): %w", err)
+		}
+		return nil
+	}
+
+	_, srcIsSymlink, err := common.ReadlinkIfSymlink(fsys, src)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	srcInfo, err := fsys.Stat(src)
+	if err != nil {
+		return fmt.Errorf("Stat(): %w", err)
+	}
+	if srcIsSymlink || !srcInfo.IsDir() || !dstInfo.IsDir() {
+		return fmt.Errorf("another output path was already moved there")
+	}
+
+	entries, err := fs.ReadDir(fsys, src)
+	if err != nil {
+		return fmt.Errorf("ReadDir(): %w", err)
+	}
+	for _, e := range entries {
+		if err := moveInto(fsys, filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	if err := fsys.RemoveAll(src); err != nil {
+		return fmt.Errorf("RemoveAll(): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// EventType says what happened in an Event.
+type EventType string
+
+const (
+	// EventDownloadStarted is sent before the template is downloaded or
+	// copied. Source is set.
+	EventDownloadStarted EventType = "download_started"
+
+	// EventDownloadFinished is sent after the template was downloaded or
+	// copied. Source is set.
+	EventDownloadFinished EventType = "download_finished"
+
+	// EventStepStarted is sent before each step of the spec runs, even if its
+	// "if" condition turns out to be false. Phase, Step, StepCount, and
+	// Action are set, as is BaseTemplate for the steps of a base template.
+	// Steps inside a for_each or step group don't send events of their own.
+	EventStepStarted EventType = "step_started"
+
+	// EventConflict is sent for each output file that already exists in the
+	// destination. Path, Overwrite, and Keep are set. It's sent before
+	// anything is written, so if neither Overwrite nor Keep is true, the
+	// render will fail without changing the destination.
+	EventConflict EventType = "conflict"
+
+	// EventFileWritten is sent for each file or symlink written to the
+	// destination. Path is set.
+	EventFileWritten EventType = "file_written"
+)
+
+// The values of Event.Phase, which say which list of steps in the spec a
+// step is from.
+const (
+	PhasePreRender  = "pre_render"
+	PhaseSteps      = "steps"
+	PhasePostRender = "post_render"
+)
+
+// Event is a progress update from Render, for showing live progress in a UI
+// without parsing log messages. Only the fields listed by its Type are set.
+// Events can be received by setting Params.OnEvent.
+type Event struct {
+	Type EventType `json:"type"`
+
+	// Source is the location of the template, as in Params.SourceForMessages.
+	Source string `json:"source,omitempty"`
+
+	// Phase is one of PhasePreRender, PhaseSteps, or PhasePostRender.
+	Phase string `json:"phase,omitempty"`
+
+	// BaseTemplate is the "extends" value naming the base template whose
+	// step is starting, or empty for the template's own steps.
+	BaseTemplate string `json:"base_template,omitempty"`
+
+	// Step is the number of the step, starting at 1, among the StepCount
+	// steps in its phase. The steps of each base template are counted on
+	// their own.
+	Step      int `json:"step,omitempty"`
+	StepCount int `json:"step_count,omitempty"`
+
+	// Action is the name of the step's action, like "include".
+	Action string `json:"action,omitempty"`
+
+	// Path is the slash-separated path of a file relative to the destination
+	// directory.
+	Path string `json:"path,omitempty"`
+
+	// Overwrite is true if the existing file will be overwritten because of
+	// --force-overwrite, --on-conflict, or the user's answer to a prompt.
+	// Files that the template included from the destination in order to
+	// modify them aren't conflicts.
+	Overwrite bool `json:"overwrite,omitempty"`
+
+	// Keep is true if the existing file will be left alone, because of
+	// --on-conflict or the user's answer to a prompt.
+	Keep bool `json:"keep,omitempty"`
+}
+
+// emit sends the event to p.OnEvent, if it's set.
+func emit(p *Params, e *Event) {
+	if p.OnEvent != nil {
+		p.OnEvent(e)
+	}
+}
@@ -16,7 +16,6 @@ package render
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/url"
@@ -27,11 +26,11 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
-	"golang.org/x/mod/sumdb/dirhash"
 	"gopkg.in/yaml.v3"
 
 	"github.com/abcxyz/abc/internal/version"
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/hashalg"
 	"github.com/abcxyz/abc/templates/common/templatesource"
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/decode"
@@ -53,6 +52,10 @@ type writeManifestParams struct {
 	// written under the .abc directory.
 	destDir string
 
+	// destination is the name of the spec's destination that destDir is the
+	// directory of, or "" for the main destination.
+	destination string
+
 	// Information from the downloader. Includes info about the canonical
 	// template location.
 	dlMeta *templatesource.DownloadMetadata
@@ -63,34 +66,62 @@ type writeManifestParams struct {
 	// A fakeable filesystem for testing errors.
 	fs common.FS
 
+	// The algorithm of the output hashes, which is also used for the
+	// template_dirhash. If nil, hashalg.Default is used.
+	hashAlg *hashalg.Algorithm
+
 	// The set of values that were used as the template inputs; combined from
 	// --input, --input-file, prompts, and defaults.
 	inputs map[string]string
 
-	// The SHA256 hash of each file created by the template rendering process
-	// in the destination directory.
+	// The types of the inputs that aren't strings. They're recorded in the
+	// manifest next to the input values.
+	inputTypes map[string]common.VarType
+
+	// The inputs whose defaults were used because of --accept-defaults.
+	// They're marked in the manifest.
+	acceptedDefaults map[string]struct{}
+
+	// The hash of each file created by the template rendering process in the
+	// destination directory, computed with hashAlg.
 	outputHashes map[string][]byte
 
+	// The target of each symlink created in the destination directory, keyed
+	// by the same paths as outputHashes.
+	outputSymlinks map[string]string
+
+	// The files that were included from the destination directory with
+	// "from: destination", and written back to the same place.
+	includedFromDest map[string]struct{}
+
+	// The spec's skip_if_exists patterns. The output files that match them
+	// are marked in the manifest.
+	skipIfExists []model.String
+
 	// The temp directory where the template was downloaded.
 	templateDir string
+
+	// The values of the template's vars that were overridden with --set.
+	varOverrides map[string]string
 }
 
 // writeManifest creates a manifest struct, marshals it as YAML, and writes it
-// to destDir/.abc/ .
-func writeManifest(ctx context.Context, p *writeManifestParams) (rErr error) {
+// to destDir/.abc/ . It returns the path of the manifest file, or "" in a dry
+// run.
+func writeManifest(ctx context.Context, p *writeManifestParams) (_ string, rErr error) {
 	m, err := buildManifest(ctx, p, p.dlMeta)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	buf, err := yaml.Marshal(m)
 	if err != nil {
-		return fmt.Errorf("failed marshaling Manifest when writing: %w", err)
+		return "", fmt.Errorf("failed marshaling Manifest when writing: %w", err)
 	}
 
 	filename, err := newManifestFilename(p, p.dlMeta)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if p.dryRun {
@@ -98,17 +129,17 @@ func writeManifest(ctx context.Context, p *writeManifestParams) (rErr error) {
 			if common.IsStatNotExistErr(err) {
 				// This is good. We don't want to overwrite an existing manifest file,
 				// so that fact that it doesn't already exist is good news.
-				return nil
+				return "", nil
 			}
-			return fmt.Errorf("Stat(): %w", err)
+			return "", fmt.Errorf("Stat(): %w", err)
 		}
-		return fmt.Errorf("dry run failed, the output manifest file %q already exists", filename)
+		return "", fmt.Errorf("dry run failed, the output manifest file %q already exists", filename)
 	}
 
 	// Why O_EXCL? Because we don't want to overwrite an existing file.
 	fh, err := p.fs.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, common.OwnerRWPerms)
 	if err != nil {
-		return fmt.Errorf("OpenFile(%q): %w", filename, err)
+		return "", fmt.Errorf("OpenFile(%q): %w", filename, err)
 	}
 	defer func() {
 		rErr = errors.Join(rErr, fh.Close())
@@ -118,10 +149,10 @@ func writeManifest(ctx context.Context, p *writeManifestParams) (rErr error) {
 		[]byte("# Generated by the \"abc templates\" command. Do not modify.\n"),
 		buf...)
 	if _, err := fh.Write(buf); err != nil {
-		return fmt.Errorf("Write(%q): %w", filename, err)
+		return "", fmt.Errorf("Write(%q): %w", filename, err)
 	}
 
-	return nil
+	return filename, nil
 }
 
 // newManifestFilename outputs the filename that will be used for a newly rendered
@@ -154,35 +185,46 @@ func newManifestFilename(p *writeManifestParams, dlMeta *templatesource.Download
 // canonicalSource is optional, it will be empty in the case where the template
 // location is non-canonical (i.e. installing from ~/mytemplate).
 func buildManifest(ctx context.Context, p *writeManifestParams, dlMeta *templatesource.DownloadMetadata) (*manifest.WithHeader, error) {
-	templateDirhash, err := dirhash.HashDir(p.templateDir, "", dirhash.Hash1)
-	if err != nil {
-		return nil, fmt.Errorf("dirhash.HashDir: %w", err)
+	alg := p.hashAlg
+	if alg == nil {
+		alg = hashalg.Default
 	}
 
-	inputList := make([]*manifest.Input, 0, len(p.inputs))
-	for name, val := range p.inputs {
-		inputList = append(inputList, &manifest.Input{
-			Name:  model.String{Val: name},
-			Value: model.String{Val: val},
-		})
+	// The dirhash was computed when the template was downloaded, unless the
+	// Downloader was called some other way. It's computed again if it was
+	// made with another algorithm, like one that a published package chose,
+	// so that the whole manifest uses the algorithm that was asked for.
+	templateDirhash := dlMeta.Dirhash
+	if dlAlg, err := hashalg.Of(templateDirhash); templateDirhash == "" || err != nil || dlAlg != alg {
+		templateDirhash, err = common.HashTemplateDirWith(ctx, p.fs, p.templateDir, alg)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
 	}
 
+	inputList := manifestInputs(p.inputs, p.inputTypes, p.acceptedDefaults)
+	varOverrideList := manifestInputs(p.varOverrides, nil, nil)
+
 	outputList := make([]*manifest.OutputHash, 0, len(p.outputHashes))
 	for file, hash := range p.outputHashes {
-		// For consistency with dirhash, we'll encode our hashes as
-		// base64 with an "h1:" prefix indicating SHA256.
-		hashStr := "h1:" + base64.StdEncoding.EncodeToString(hash)
+		// For consistency with dirhash, we'll encode our hashes as base64
+		// with a prefix naming the algorithm, like "h1:" for SHA256.
+		hashStr := alg.Format(hash)
+		_, fromDest := p.includedFromDest[filepath.FromSlash(file)]
+		skipIfExists, err := matchesAnyGlob(p.skipIfExists, filepath.FromSlash(file))
+		if err != nil {
+			return nil, err
+		}
 		outputList = append(outputList, &manifest.OutputHash{
-			File: model.String{Val: file},
-			Hash: model.String{Val: hashStr},
+			File:             model.String{Val: file},
+			Hash:             model.String{Val: hashStr},
+			SymlinkTarget:    model.String{Val: p.outputSymlinks[file]},
+			IncludedFromDest: model.Bool{Val: fromDest},
+			SkipIfExists:     model.Bool{Val: skipIfExists},
 		})
 	}
 
-	// Alphabetize the lists of inputs and outputs just to be deterministic and
-	// civilized.
-	sort.Slice(inputList, func(l, r int) bool {
-		return inputList[l].Name.Val < inputList[r].Name.Val
-	})
+	// Alphabetize the list of outputs just to be deterministic and civilized.
 	sort.Slice(outputList, func(l, r int) bool {
 		return outputList[l].File.Val < outputList[r].File.Val
 	})
@@ -203,7 +245,30 @@ func buildManifest(ctx context.Context, p *writeManifestParams, dlMeta *template
 			CreationTime:     now,
 			ModificationTime: now,
 			Inputs:           inputList,
+			VarOverrides:     varOverrideList,
+			Destination:      model.String{Val: p.destination},
 			OutputHashes:     outputList,
 		},
 	}, nil
 }
+
+// manifestInputs converts a map of names to values into a list sorted by name.
+// types is optional, and contains the types of the values that aren't strings.
+// acceptedDefaults is optional, and contains the names of the inputs whose
+// defaults were accepted with --accept-defaults.
+func manifestInputs(m map[string]string, types map[string]common.VarType, acceptedDefaults map[string]struct{}) []*manifest.Input {
+	out := make([]*manifest.Input, 0, len(m))
+	for name, val := range m {
+		_, accepted := acceptedDefaults[name]
+		out = append(out, &manifest.Input{
+			Name:            model.String{Val: name},
+			Value:           model.String{Val: val},
+			Type:            model.String{Val: string(types[name])},
+			AcceptedDefault: model.Bool{Val: accepted},
+		})
+	}
+	sort.Slice(out, func(l, r int) bool {
+		return out[l].Name.Val < out[r].Name.Val
+	})
+	return out
+}
@@ -16,6 +16,9 @@ package render
 
 import (
 	"context"
+	"crypto/sha512"
+	"fmt"
+	"sort"
 	"testing"
 	"time"
 
@@ -23,7 +26,9 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/hashalg"
 	"github.com/abcxyz/abc/templates/common/templatesource"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/testutil"
 )
@@ -38,9 +43,12 @@ func TestWriteManifest(t *testing.T) {
 		dryRun           bool
 		dlMeta           *templatesource.DownloadMetadata
 		templateContents map[string]string
+		templateSymlinks map[string]string
 		destDirContents  map[string]string
 		inputs           map[string]string
+		acceptedDefaults map[string]struct{}
 		outputHashes     map[string][]byte
+		outputSymlinks   map[string]string
 		want             map[string]string
 		wantErr          string
 	}{
@@ -82,6 +90,94 @@ inputs:
 output_hashes:
     - file: a.txt
       hash: h1:ZmFrZV9vdXRwdXRfaGFzaF8zMl9ieXRlc19zaGEyNTY=
+`,
+			},
+		},
+		{
+			name: "accepted_defaults",
+			templateContents: map[string]string{
+				"spec.yaml": "some stuff",
+				"a.txt":     "some other stuff",
+			},
+			destDirContents: map[string]string{
+				"a.txt": "some other stuff",
+			},
+			dlMeta: &templatesource.DownloadMetadata{
+				IsCanonical: false,
+			},
+			inputs: map[string]string{
+				"pizza":     "hawaiian",
+				"pineapple": "deal with it",
+			},
+			acceptedDefaults: map[string]struct{}{
+				"pizza": {},
+			},
+			outputHashes: map[string][]byte{
+				"a.txt": []byte("fake_output_hash_32_bytes_sha256"),
+			},
+			want: map[string]string{
+				"a.txt": "some other stuff",
+				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta5
+kind: Manifest
+creation_time: 2023-12-08T23:59:02.000000013Z
+modification_time: 2023-12-08T23:59:02.000000013Z
+template_location: ""
+location_type: ""
+template_version: ""
+template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
+inputs:
+    - name: pineapple
+      value: deal with it
+    - name: pizza
+      value: hawaiian
+      accepted_default: true
+output_hashes:
+    - file: a.txt
+      hash: h1:ZmFrZV9vdXRwdXRfaGFzaF8zMl9ieXRlc19zaGEyNTY=
+`,
+			},
+		},
+		{
+			name: "symlinks",
+			templateContents: map[string]string{
+				"spec.yaml": "some stuff",
+				"a.txt":     "some other stuff",
+			},
+			templateSymlinks: map[string]string{
+				"dangling": "nonexistent",
+			},
+			destDirContents: map[string]string{
+				"a.txt": "some other stuff",
+			},
+			dlMeta: &templatesource.DownloadMetadata{
+				IsCanonical: false,
+			},
+			outputHashes: map[string][]byte{
+				"a.txt":    []byte("fake_output_hash_32_bytes_sha256"),
+				"link.txt": []byte("fake_symlink_hash_32_bytes_sha25"),
+			},
+			outputSymlinks: map[string]string{
+				"link.txt": "a.txt",
+			},
+			want: map[string]string{
+				"a.txt": "some other stuff",
+				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta5
+kind: Manifest
+creation_time: 2023-12-08T23:59:02.000000013Z
+modification_time: 2023-12-08T23:59:02.000000013Z
+template_location: ""
+location_type: ""
+template_version: ""
+template_dirhash: h1:3cygyaUUFhgZK5cb7mYs2+3eSV1W2864MgC10j3s8CA=
+inputs: []
+output_hashes:
+    - file: a.txt
+      hash: h1:ZmFrZV9vdXRwdXRfaGFzaF8zMl9ieXRlc19zaGEyNTY=
+    - file: link.txt
+      hash: h1:ZmFrZV9zeW1saW5rX2hhc2hfMzJfYnl0ZXNfc2hhMjU=
+      symlink_target: a.txt
 `,
 			},
 		},
@@ -235,18 +331,21 @@ output_hashes: []
 			destDir := t.TempDir()
 
 			abctestutil.WriteAllDefaultMode(t, templateDir, tc.templateContents)
+			abctestutil.WriteSymlinks(t, templateDir, tc.templateSymlinks)
 			abctestutil.WriteAllDefaultMode(t, destDir, tc.destDirContents)
 
 			ctx := context.Background()
-			err := writeManifest(ctx, &writeManifestParams{
-				clock:        clk,
-				destDir:      destDir,
-				dlMeta:       tc.dlMeta,
-				dryRun:       tc.dryRun,
-				fs:           &common.RealFS{},
-				inputs:       tc.inputs,
-				outputHashes: tc.outputHashes,
-				templateDir:  templateDir,
+			_, err := writeManifest(ctx, &writeManifestParams{
+				acceptedDefaults: tc.acceptedDefaults,
+				clock:            clk,
+				destDir:          destDir,
+				dlMeta:           tc.dlMeta,
+				dryRun:           tc.dryRun,
+				fs:               &common.RealFS{},
+				inputs:           tc.inputs,
+				outputHashes:     tc.outputHashes,
+				outputSymlinks:   tc.outputSymlinks,
+				templateDir:      templateDir,
 			})
 
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
@@ -261,6 +360,60 @@ output_hashes: []
 	}
 }
 
+// TestBuildManifest_Deterministic checks that the lists in the manifest, which
+// are built from maps, come out in the same order every time, so that
+// manifests and golden tests don't have spurious diffs.
+func TestBuildManifest_Deterministic(t *testing.T) {
+	t.Parallel()
+
+	params := &writeManifestParams{
+		clock: mockClock(t),
+		dlMeta: &templatesource.DownloadMetadata{
+			IsCanonical:     true,
+			CanonicalSource: "github.com/foo/bar",
+			LocationType:    "remote_git",
+			Version:         "v1.2.3",
+			Dirhash:         "h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=",
+		},
+		inputs:       map[string]string{},
+		varOverrides: map[string]string{},
+		outputHashes: map[string][]byte{},
+	}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("name_%02d", (i*37)%50)
+		params.inputs[name] = "value"
+		params.varOverrides[name] = "value"
+		params.outputHashes[name+".txt"] = []byte("fake_output_hash_32_bytes_sha256")
+	}
+
+	ctx := context.Background()
+	var first *manifest.WithHeader
+	for i := 0; i < 10; i++ {
+		got, err := buildManifest(ctx, params, params.dlMeta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = got
+			continue
+		}
+		if diff := cmp.Diff(got, first); diff != "" {
+			t.Fatalf("manifest changed between builds (-got,+want): %s", diff)
+		}
+	}
+
+	m := first.Wrapped
+	if !sort.SliceIsSorted(m.Inputs, func(l, r int) bool { return m.Inputs[l].Name.Val < m.Inputs[r].Name.Val }) {
+		t.Errorf("inputs aren't sorted by name")
+	}
+	if !sort.SliceIsSorted(m.VarOverrides, func(l, r int) bool { return m.VarOverrides[l].Name.Val < m.VarOverrides[r].Name.Val }) {
+		t.Errorf("var_overrides aren't sorted by name")
+	}
+	if !sort.SliceIsSorted(m.OutputHashes, func(l, r int) bool { return m.OutputHashes[l].File.Val < m.OutputHashes[r].File.Val }) {
+		t.Errorf("output_hashes aren't sorted by file")
+	}
+}
+
 func mockClock(t *testing.T) *clock.Mock {
 	t.Helper()
 
@@ -275,3 +428,45 @@ func mockClock(t *testing.T) *clock.Mock {
 	clk.Set(time.Date(2023, 12, 8, 15, 59, 2, 13, loc))
 	return clk
 }
+
+// TestBuildManifest_HashAlgorithm checks that the manifest uses the chosen
+// hash algorithm for its output hashes, and for the template dirhash even if
+// the download was verified with another one.
+func TestBuildManifest_HashAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	templateDir := t.TempDir()
+	abctestutil.WriteAllDefaultMode(t, templateDir, map[string]string{
+		"spec.yaml": "some yaml",
+	})
+	ctx := context.Background()
+	dirhash256, err := common.HashTemplateDir(ctx, templateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirhash512, err := common.HashTemplateDirWith(ctx, &common.RealFS{}, templateDir, hashalg.SHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha512.Sum512([]byte("hello"))
+
+	params := &writeManifestParams{
+		clock:        mockClock(t),
+		dlMeta:       &templatesource.DownloadMetadata{Dirhash: dirhash256},
+		fs:           &common.RealFS{},
+		hashAlg:      hashalg.SHA512,
+		outputHashes: map[string][]byte{"a.txt": sum[:]},
+		templateDir:  templateDir,
+	}
+	got, err := buildManifest(ctx, params, params.dlMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := got.Wrapped.TemplateDirhash.Val; got != dirhash512 {
+		t.Errorf("got template_dirhash %s, want %s", got, dirhash512)
+	}
+	if got, want := got.Wrapped.OutputHashes[0].Hash.Val, hashalg.SHA512.Sum([]byte("hello")); got != want {
+		t.Errorf("got output hash %s, want %s", got, want)
+	}
+}
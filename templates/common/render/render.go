@@ -16,24 +16,39 @@ package render
 
 import (
 	"context"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/benbjohnson/clock"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
 
+	"github.com/abcxyz/abc/internal/version"
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/audit"
 	"github.com/abcxyz/abc/templates/common/builtinvar"
+	"github.com/abcxyz/abc/templates/common/extends"
+	"github.com/abcxyz/abc/templates/common/genmarker"
+	"github.com/abcxyz/abc/templates/common/hashalg"
 	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/policy"
+	"github.com/abcxyz/abc/templates/common/protect"
+	"github.com/abcxyz/abc/templates/common/redact"
 	"github.com/abcxyz/abc/templates/common/rules"
 	"github.com/abcxyz/abc/templates/common/specutil"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/common/ui"
 	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/decode"
 	"github.com/abcxyz/abc/templates/model/spec/features"
 	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
 	"github.com/abcxyz/pkg/logging"
@@ -42,6 +57,25 @@ import (
 
 // Params contains the arguments to Render().
 type Params struct {
+	// The value of --allow-exec. Whether templates may run external programs,
+	// like the "command" of a "format" action.
+	AllowExec bool
+
+	// The value of --allow-unmatched-paths. Whether a path in a
+	// content-modifying action that matches no files is only a warning,
+	// rather than an error.
+	AllowUnmatchedPaths bool
+
+	// AuditLog is the optional path of the audit log. When the render
+	// finishes, whether it succeeded or not, an audit.Entry is appended to it.
+	// This is set by --audit-log.
+	AuditLog string
+
+	// AuditDest is the destination recorded in the audit log, if it's not
+	// DestDir, like when the output is written to an archive file by way of
+	// a temporary DestDir. It should be absolute.
+	AuditDest string
+
 	// BackupDir is the directory where overwritten files will be backed up.
 	// BackupDir is ignored if Backups is false.
 	BackupDir string
@@ -52,12 +86,25 @@ type Params struct {
 	// underscore.
 	OverrideBuiltinVars map[string]string
 
+	// If Chown is non-nil, the files and directories that the render creates
+	// in the destination, including the manifest, are given this owner once
+	// they're all written. This is set by --chown. FS must implement
+	// common.ChownFS.
+	Chown *common.Owner
+
 	// Fakeable time for testing.
 	Clock clock.Clock
 
+	// Colors is used to highlight prompts. If nil, there's no color.
+	Colors *ui.Colors
+
 	// The fakeable working directory for testing.
 	Cwd string
 
+	// If DebugScope is non-nil, the variables in scope are written to it as a
+	// YAML document as each step begins. This is set by --debug-scope.
+	DebugScope io.Writer
+
 	// The value of --debug-scratch-contents.
 	DebugScratchContents bool
 
@@ -70,15 +117,33 @@ type Params struct {
 	// The downloader that will provide the template.
 	Downloader templatesource.Downloader
 
+	// ExtraDests are the directories of the template's destinations (see
+	// "destinations" in the spec), keyed by name, from --extra-dest. They
+	// should be absolute. The output files of a destination that isn't in
+	// ExtraDests are written to DestDir like the rest of the output.
+	ExtraDests map[string]string
+
+	// The value of --file-modes. If empty, the template's file_modes setting
+	// is used.
+	FileModes common.FileModes
+
 	// The value of --force-overwrite.
 	ForceOverwrite bool
 
 	// A fakeable filesystem for error injection in tests.
 	FS common.FS
 
+	// The value of --generated-marker. If false, the template's
+	// generated_marker setting is used.
+	GeneratedMarker bool
+
 	// The value of --git-protocol.
 	GitProtocol string
 
+	// The value of --hash-algorithm, which is used for the output_hashes and
+	// template_dirhash of the manifest. If nil, hashalg.Default is used.
+	HashAlgorithm *hashalg.Algorithm
+
 	// The value of --input-files.
 	InputFiles []string
 
@@ -89,19 +154,120 @@ type Params struct {
 	// The value of --keep-temp-dirs.
 	KeepTempDirs bool
 
+	// The value of --line-endings. If empty, the template's line_endings
+	// setting is used.
+	LineEndings common.LineEndings
+
+	// The values of --max-files, --max-bytes, and --max-path-depth. These
+	// limit the size of the render output; the Downloader is responsible for
+	// limiting the size of the template itself. If nil, there are no limits.
+	Limits *common.Limits
+
+	// LookupEnv reads the environment variables that the template declares
+	// in its env_vars, which are in scope as _env_* builtin vars. No other
+	// environment variables are read. If nil, the declared environment
+	// variables are empty, as if unset, so that a library or server caller
+	// never exposes its own environment to the template by default.
+	LookupEnv func(string) (string, bool)
+
 	// The value of --manifest.
 	Manifest bool
 
+	// The value of --on-conflict, which says what to do with output files
+	// that already exist in the destination. The empty string means
+	// ConflictError. ForceOverwrite takes precedence.
+	OnConflict ConflictPolicy
+
+	// OnEvent is optional, and if non-nil, is called with each Event as the
+	// render progresses, like when a step starts or a file is written. It's
+	// called synchronously from the goroutine that called Render, so it
+	// should return quickly. A caller that wants a channel of events can send
+	// to one from OnEvent.
+	OnEvent func(*Event)
+
+	// OnlyPaths is the value of --only-paths. If it's non-empty, only the
+	// output files that match one of these globs, or that are in a directory
+	// that matches one, are written to the destination. The rest of the
+	// output is rendered but not written.
+	OnlyPaths []string
+
+	// Protect are globs of extra protected paths in the destination, from
+	// --protect, which the render must not write to, like those in the
+	// destination's .abc/protect.yaml file.
+	Protect []string
+
+	// Policies are checked against the rendered output and inputs before
+	// anything is written to the destination. If any of them are violated,
+	// the render fails. This is set by --policy-file.
+	Policies []policy.Checker
+
+	// If non-nil, Coverage records which of the template's steps ran. This is
+	// used by golden tests.
+	Coverage *Coverage
+
+	// If non-nil, StepSnapshots records the contents of the scratch directory
+	// after each step. This is used to find nondeterministic steps.
+	StepSnapshots *StepSnapshots
+
 	// Whether to prompt the user for inputs on stdin in the case where they're
 	// not all provided in Inputs or InputFiles.
 	Prompt bool
+
+	// ResumeFile is the optional path of a file in which to save a
+	// ResumeState if the render is interrupted, or prompting fails, before
+	// all the inputs are known. It's removed when the render succeeds.
+	ResumeFile string
 	// If Prompt is true, Prompter will be used if needed to ask the user for
-	// any missing inputs. If Prompt is false, this is ignored.
+	// any missing inputs. It's also used to ask what to do with existing
+	// output files when OnConflict is ConflictError and standard input is a
+	// terminal, regardless of Prompt.
 	Prompter input.Prompter
 
+	// InputPrompter, if non-nil, is used instead of Prompter to ask for any
+	// missing inputs when Prompt is true, for embedders that prompt through
+	// something other than the terminal, like a web form.
+	InputPrompter input.InputPrompter
+
+	// Redact is the value of --redact, patterns of the names of sensitive
+	// inputs, in the syntax of path.Match. Their values are replaced in logs,
+	// print output, --debug-scope output, and errors, and are left out of the
+	// manifest, the resume file, and the audit log's inputs hash. They still
+	// appear in the rendered files, if the template puts them there.
+	Redact []string
+
+	// PromptBatch asks the InputPrompter for all the missing inputs at once,
+	// before any steps run, rather than one at a time.
+	PromptBatch bool
+
+	// The value of --prompt-timeout. If it's nonzero, the render fails if a
+	// prompt isn't answered within it.
+	PromptTimeout time.Duration
+
+	// The value of --accept-defaults. Inputs that have a default aren't
+	// prompted for, and are marked in the manifest as having their default
+	// accepted.
+	AcceptDefaults bool
+
+	// The value of --set. These override the values of the template's vars.
+	SetVars map[string]string
+
 	// The value of --skip-input-validation.
 	SkipInputValidation bool
 
+	// The value of --strict-api-version. If true, a template whose spec.yaml
+	// has an older api_version than the latest is an error rather than a
+	// warning.
+	StrictAPIVersion bool
+
+	// The value of --strip-bom. If false, the template's strip_bom setting is
+	// used.
+	StripBOM bool
+
+	// The value of --symlinks. This says how symlinks are copied by "include"
+	// actions and when writing to the destination directory. The Downloader
+	// is responsible for symlinks in the template itself.
+	Symlinks common.SymlinkMode
+
 	// Normally, we'll only prompt if the input is a TTY. For testing, this
 	// can be set to true to bypass the check and allow stdin to be something
 	// other than a TTY, like an os.Pipe.
@@ -112,12 +278,34 @@ type Params struct {
 	// log messages and for the _flag_source variable in print actions.
 	SourceForMessages string
 
+	// The input stream used for --input-file=- . May be nil if no input file
+	// is read from stdin.
+	Stdin io.Reader
+
 	// The output stream used by "print" actions.
 	Stdout io.Writer
 
 	// The directory under which to create temp directories. Normally empty,
 	// except in testing.
 	TempDirBase string
+
+	// The value of --vendor-dir, as an absolute path. Base templates that were
+	// vendored there are read from there instead of being downloaded. The
+	// Downloader is responsible for the template itself.
+	VendorDir string
+
+	// DownloadRetry controls how downloads of remote base templates are
+	// retried. If nil, templatesource.DefaultRetryPolicy is used.
+	DownloadRetry *templatesource.RetryPolicy
+
+	// DownloadStats is optional, and if non-nil, adds up the downloads of
+	// remote base templates. The Downloader is responsible for the template
+	// itself.
+	DownloadStats *templatesource.DownloadStats
+
+	// Stats is optional, and if non-nil, is filled in with a summary of the
+	// render once it succeeds.
+	Stats *Stats
 }
 
 // Render does the full sequence of steps involved in rendering a template. It
@@ -128,7 +316,27 @@ type Params struct {
 // This is a library function because template rendering is a reusable operation
 // that is called as a subroutine by "golden-test" and "upgrade" commands.
 func Render(ctx context.Context, p *Params) (rErr error) {
+	if _, ok := p.FS.(common.ChownFS); p.Chown != nil && !ok {
+		return fmt.Errorf("changing the owner of the output files isn't supported by this filesystem")
+	}
+
+	redactor, err := redact.New(p.Redact, p.Inputs)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if redactor != nil {
+		// Everything that's written or logged from here on goes through the
+		// redactor, which learns the rest of the sensitive values once the
+		// inputs are resolved.
+		ctx = logging.WithLogger(ctx, redactor.Logger(logging.FromContext(ctx)))
+		redacted := *p
+		redacted.Stdout = redactor.Writer(p.Stdout)
+		redacted.DebugScope = redactor.Writer(p.DebugScope)
+		p = &redacted
+	}
+
 	logger := logging.FromContext(ctx).With("logger", "Render")
+	start := p.Clock.Now()
 
 	tempTracker := tempdir.NewDirTracker(p.FS, p.KeepTempDirs)
 	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
@@ -140,34 +348,96 @@ func Render(ctx context.Context, p *Params) (rErr error) {
 	logger.DebugContext(ctx, "created temporary template directory",
 		"path", templateDir)
 
-	logger.DebugContext(ctx, "downloading/copying template")
-	dlMeta, err := p.Downloader.Download(ctx, p.Cwd, templateDir)
+	// Until the inputs are resolved, an interruption saves the progress so
+	// far in the resume file.
+	resume := &ResumeState{Source: p.SourceForMessages, Inputs: maps.Clone(p.Inputs)}
+	inputsResolved := false
+	defer func() {
+		rErr = errors.Join(rErr, updateResumeFile(ctx, p, resume, inputsResolved, rErr))
+	}()
+
+	auditEntry := &audit.Entry{
+		Command: audit.CommandRender,
+		Source:  p.SourceForMessages,
+		Dest:    p.AuditDest,
+	}
+	if auditEntry.Dest == "" {
+		auditEntry.Dest = p.DestDir
+	}
+	defer func() {
+		rErr = errors.Join(rErr, appendAuditEntry(p, auditEntry, rErr))
+	}()
+	// This runs before the deferred functions above, so the error that's
+	// recorded in the audit log is redacted too.
+	defer func() { rErr = redactor.Error(rErr) }()
+
+	dlMeta, spec, bases, err := loadTemplate(ctx, p, tempTracker, templateDir)
+	if dlMeta != nil {
+		resume.Source = pinnedSource(p.SourceForMessages, dlMeta)
+		auditEntry.CanonicalSource, auditEntry.Version = dlMeta.CanonicalSource, dlMeta.Version
+	}
 	if err != nil {
-		return fmt.Errorf("failed to download/copy template: %w", err)
+		return err
 	}
-	logger.DebugContext(ctx, "downloaded source template to temporary directory",
-		"destination", templateDir)
-
-	logger.DebugContext(ctx, "loading spec file")
-	spec, err := specutil.Load(ctx, p.FS, templateDir, p.SourceForMessages)
+	if p.Coverage != nil {
+		for _, b := range bases {
+			p.Coverage.addSpec(b.Source, b.Spec)
+		}
+		p.Coverage.addSpec("", spec)
+	}
+	spec = extends.Merge(bases, spec)
+
+	// Hold a lock on each destination from before anything reads it, like
+	// input inference and "from: destination" includes, until the output is
+	// committed. So a concurrent render or upgrade into the same destination
+	// fails, instead of changing what we read or mixing its output and
+	// manifest with ours.
+	locks, err := lockDests(p)
+	defer func() {
+		for _, lock := range locks {
+			rErr = errors.Join(rErr, lock.Unlock(rErr == nil))
+		}
+	}()
 	if err != nil {
-		return err //nolint:wrapcheck
+		return err
 	}
 
 	logger.DebugContext(ctx, "resolving inputs")
+	if resume.Inputs == nil {
+		resume.Inputs = map[string]string{}
+	}
+	builtins, extraPrintVars, err := builtinVars(p, spec.Features, spec.EnvVarNames(), dlMeta.Vars)
+	if err != nil {
+		return err
+	}
+	acceptedDefaults := make(map[string]struct{})
 	resolvedInputs, err := input.Resolve(ctx, &input.ResolveParams{
+		AcceptDefaults:      p.AcceptDefaults,
+		BuiltinVars:         builtins,
+		Colors:              p.Colors,
+		DestDir:             p.DestDir,
 		FS:                  p.FS,
 		InputFiles:          p.InputFiles,
+		InputPrompter:       p.InputPrompter,
 		Inputs:              p.Inputs,
+		OutAcceptedDefaults: acceptedDefaults,
+		OutInputs:           resume.Inputs,
 		Prompt:              p.Prompt,
+		PromptBatch:         p.PromptBatch,
+		PromptTimeout:       p.PromptTimeout,
 		Prompter:            p.Prompter,
 		SkipInputValidation: p.SkipInputValidation,
 		SkipPromptTTYCheck:  p.SkipPromptTTYCheck,
 		Spec:                spec,
+		Stdin:               p.Stdin,
 	})
 	if err != nil {
 		return err //nolint:wrapcheck
 	}
+	inputsResolved = true
+	redactor.AddInputs(resolvedInputs)
+	// Even a hash of a sensitive value could be used to guess it.
+	auditEntry.InputsHash = audit.HashInputs(redactor.Inputs(resolvedInputs))
 
 	scratchDir, err := tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.ScratchDirNamePart)
 	if err != nil {
@@ -181,7 +451,10 @@ func Render(ctx context.Context, p *Params) (rErr error) {
 		return err
 	}
 
-	scope, extraPrintVars, err := scopes(resolvedInputs, p, spec.Features, dlMeta.Vars)
+	inputTypes := input.Types(spec.Inputs)
+	scope := common.NewTypedScope(resolvedInputs, inputTypes).With(builtins)
+
+	scope, err = resolveVars(ctx, scope, spec.Vars, p.SetVars)
 	if err != nil {
 		return err
 	}
@@ -198,23 +471,76 @@ func Render(ctx context.Context, p *Params) (rErr error) {
 		rp:             p,
 		scope:          scope,
 		scratchDir:     scratchDir,
+		stepGroups:     stepGroupsByName(spec.StepGroups),
 		templateDir:    templateDir,
 	}
 
 	logger.DebugContext(ctx, "executing template steps")
 
+	sp.phase = PhasePreRender
+	if err := executeSteps(ctx, spec.PreRender, sp); err != nil {
+		return err
+	}
+	sp.phase = PhaseSteps
+	if err := executeBaseSteps(ctx, bases, sp); err != nil {
+		return err
+	}
 	if err := executeSteps(ctx, spec.Steps, sp); err != nil {
 		return err
 	}
 
-	logger.DebugContext(ctx, "committing rendered output")
-	if err := commitTentatively(ctx, p, &commitParams{
+	if err := markGenerated(ctx, spec, sp, dlMeta); err != nil {
+		return err
+	}
+	if err := normalizeOutput(ctx, spec, sp); err != nil {
+		return err
+	}
+	modes, err := newModePolicy(p, spec)
+	if err != nil {
+		return err
+	}
+
+	if err := checkPolicies(ctx, p, scratchDir, resolvedInputs); err != nil {
+		return err
+	}
+
+	only, err := selectOnlyPaths(p, scratchDir)
+	if err != nil {
+		return err
+	}
+
+	outputs, err := splitDestinations(ctx, p, spec.Destinations, tempTracker, &commitParams{
+		acceptedDefaults: acceptedDefaults,
 		dlMeta:           dlMeta,
 		includedFromDest: sliceToSet(sp.includedFromDest),
-		inputs:           resolvedInputs,
+		inputs:           redactor.Inputs(resolvedInputs),
+		inputTypes:       inputTypes,
+		modes:            modes,
+		only:             only,
+		postRender:       spec.PostRender,
+		skipIfExists:     spec.SkipIfExists,
+		stepParams:       sp,
 		scratchDir:       scratchDir,
 		templateDir:      templateDir,
-	}); err != nil {
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, out := range outputs {
+		if out.cp.protected, err = protect.Load(p.FS, out.p.DestDir, p.Protect); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if p.Chown != nil {
+			if out.cp.newDirs, err = missingDirs(out.p, out.cp.scratchDir, locks[filepath.Clean(out.p.DestDir)].CreatedDirs()); err != nil {
+				return err
+			}
+		}
+	}
+
+	logger.DebugContext(ctx, "committing rendered output")
+	if err := commitTentatively(ctx, outputs); err != nil {
 		return err
 	}
 
@@ -228,24 +554,286 @@ func Render(ctx context.Context, p *Params) (rErr error) {
 		)
 	}
 
+	if p.Stats != nil {
+		p.Stats.Source = p.SourceForMessages
+		p.Stats.TemplateVersion = dlMeta.Version
+		p.Stats.Duration = p.Clock.Since(start)
+	}
+
 	logger.DebugContext(ctx, "render operation complete", "source", p.SourceForMessages)
 
 	return nil
 }
 
-// scopes returns two things:
-//
-//   - a Scope object that has all variable bindings that are in scope for the
-//     spec.yaml. This includes vars for user inputs and also built-in vars like
-//     _git_tag.
-//   - a map of extra variable bindings in addition to the above scope, for
-//     variables that are only in scope inside "print" actions. Print has access
-//     to e.g. the _flag_dest var that cannot be accessed elsewhere.
-func scopes(resolvedInputs map[string]string, rp *Params, f features.Features, dlVars templatesource.DownloaderVars) (_ *common.Scope, extraPrintVars map[string]string, _ error) {
-	scope := common.NewScope(resolvedInputs)
+// lockDests locks the destination directory and each of p.ExtraDests, keyed
+// by their cleaned paths. The locks that were taken are returned even if
+// locking another one fails, so that the caller can release them.
+func lockDests(p *Params) (map[string]*common.DestLock, error) {
+	dirs := append([]string{p.DestDir}, maps.Values(p.ExtraDests)...)
+	sort.Strings(dirs[1:])
+	locks := make(map[string]*common.DestLock, len(dirs))
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if _, ok := locks[dir]; ok {
+			// The same directory given twice is an error that's reported
+			// later, once the spec's destinations are checked.
+			continue
+		}
+		lock, err := common.LockDest(p.FS, dir, p.Clock.Now())
+		if err != nil {
+			return locks, fmt.Errorf("failed locking the destination directory: %w", err)
+		}
+		locks[dir] = lock
+	}
+	return locks, nil
+}
+
+// appendAuditEntry completes e with the outcome of the render, and appends it
+// to p.AuditLog, if there is one.
+func appendAuditEntry(p *Params, e *audit.Entry, renderErr error) error {
+	if p.AuditLog == "" {
+		return nil
+	}
+	e.Time = p.Clock.Now().UTC()
+	e.User = audit.CurrentUser()
+	e.ABCVersion = version.Version
+	e.Outcome = audit.OutcomeSuccess
+	if renderErr != nil {
+		e.Outcome, e.Error = audit.OutcomeFailure, renderErr.Error()
+	}
+	return audit.Append(p.FS, p.AuditLog, e) //nolint:wrapcheck
+}
+
+// loadTemplate downloads the template into templateDir, and loads its spec
+// and the base templates named by its "extends". The download metadata is
+// returned even if loading the spec fails, once the download succeeded.
+func loadTemplate(ctx context.Context, p *Params, tempTracker *tempdir.DirTracker, templateDir string) (*templatesource.DownloadMetadata, *spec.Spec, []*extends.Base, error) {
+	logger := logging.FromContext(ctx).With("logger", "loadTemplate")
+
+	logger.DebugContext(ctx, "downloading/copying template")
+	emit(p, &Event{Type: EventDownloadStarted, Source: p.SourceForMessages})
+	dlMeta, err := templatesource.DownloadVerified(ctx, &templatesource.DownloadVerifiedParams{
+		Downloader: p.Downloader,
+		Cwd:        p.Cwd,
+		DestDir:    templateDir,
+		FS:         p.FS,
+		Stats:      p.DownloadStats,
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to download/copy template: %w", err)
+	}
+	emit(p, &Event{Type: EventDownloadFinished, Source: p.SourceForMessages})
+	logger.DebugContext(ctx, "downloaded source template to temporary directory",
+		"destination", templateDir)
+
+	logger.DebugContext(ctx, "loading spec file")
+	spec, err := specutil.Load(ctx, p.FS, templateDir, p.SourceForMessages)
+	if err != nil {
+		return dlMeta, nil, nil, err //nolint:wrapcheck
+	}
+	if err := checkAPIVersion(ctx, p, templateDir); err != nil {
+		return dlMeta, nil, nil, err
+	}
+	if err := specutil.WriteInlineFiles(p.FS, templateDir, spec); err != nil {
+		return dlMeta, nil, nil, err //nolint:wrapcheck
+	}
 
+	bases, err := extends.Resolve(ctx, &extends.ResolveParams{
+		Cwd:           p.Cwd,
+		Downloader:    p.Downloader,
+		DownloadRetry: p.DownloadRetry,
+		DownloadStats: p.DownloadStats,
+		FS:            p.FS,
+		GitProtocol:   p.GitProtocol,
+		Limits:        p.Limits,
+		Spec:          spec,
+		Symlinks:      p.Symlinks,
+		TemplateDir:   templateDir,
+		TempDirBase:   p.TempDirBase,
+		Tracker:       tempTracker,
+		VendorDir:     p.VendorDir,
+	})
+	if err != nil {
+		return dlMeta, nil, nil, err //nolint:wrapcheck
+	}
+	return dlMeta, spec, bases, nil
+}
+
+// checkAPIVersion warns if the template's spec.yaml has an older api_version
+// than the latest one that this version of abc supports, and so behaves
+// differently; see decode.OutdatedAPIVersion. If p.StrictAPIVersion is set,
+// it's an error instead. Base templates aren't checked, since they're
+// maintained separately.
+func checkAPIVersion(ctx context.Context, p *Params, templateDir string) error {
+	apiVersionField, err := specutil.LoadAPIVersion(p.FS, templateDir)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	apiVersion := apiVersionField.Val
+	latest := decode.LatestSupportedAPIVersion(version.IsReleaseBuild())
+	if !decode.OutdatedAPIVersion(apiVersion, latest) {
+		return nil
+	}
+	if p.StrictAPIVersion {
+		return fmt.Errorf("the template's spec.yaml has api_version %q, but --strict-api-version requires the latest, %q; "+
+			`run "abc templates lint --explain-migration" to see what changes with the latest, then change its api_version`,
+			apiVersion, latest)
+	}
+	logging.FromContext(ctx).WarnContext(ctx, "the template's spec.yaml has an older api_version than the latest, so it can't use the newest features; "+
+		`run "abc templates lint --explain-migration" to see what changes with the latest`,
+		"source", p.SourceForMessages,
+		"api_version", apiVersion,
+		"latest_api_version", latest)
+	return nil
+}
+
+// ListInputs downloads the template and returns the status of each of its
+// inputs, including those of its base templates, given p.Inputs and
+// p.InputFiles, without rendering anything. It's for tools that need to know
+// which inputs are still needed, like to show a form, before calling Render.
+// The inputs are inferred from files in p.DestDir like they are by Render. The
+// values of the inputs that match p.Redact are replaced with redact.Placeholder.
+func ListInputs(ctx context.Context, p *Params) (_ []*input.Status, rErr error) {
+	tempTracker := tempdir.NewDirTracker(p.FS, p.KeepTempDirs)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	templateDir, err := tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.TemplateDirNamePart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory to use as template directory: %w", err)
+	}
+	dlMeta, spec, bases, err := loadTemplate(ctx, p, tempTracker, templateDir)
+	if err != nil {
+		return nil, err
+	}
+	spec = extends.Merge(bases, spec)
+
+	builtins, _, err := builtinVars(p, spec.Features, spec.EnvVarNames(), dlMeta.Vars)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := input.Statuses(ctx, &input.ResolveParams{
+		BuiltinVars: builtins,
+		DestDir:     p.DestDir,
+		FS:          p.FS,
+		InputFiles:  p.InputFiles,
+		Inputs:      p.Inputs,
+		Spec:        spec,
+		Stdin:       p.Stdin,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	redactor, err := redact.New(p.Redact, nil)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	for _, st := range statuses {
+		if st.Satisfied && redactor.IsSensitive(st.Input.Name.Val) {
+			st.Value = redact.Placeholder
+		}
+	}
+	return statuses, nil
+}
+
+// normalizeOutput converts the line endings and removes the byte order marks
+// of the text files in the scratch directory, as requested by the spec or by
+// flags, just before they're committed. Flags take precedence over the spec.
+func normalizeOutput(ctx context.Context, s *spec.Spec, sp *stepParams) error {
+	lineEndings := sp.rp.LineEndings
+	if lineEndings == "" {
+		var err error
+		if lineEndings, err = common.ParseLineEndings(s.LineEndings.Val); err != nil {
+			return s.LineEndings.Pos.Errorf("%w", err)
+		}
+	}
+	stripBOM := sp.rp.StripBOM || s.StripBOM.Val
+	if lineEndings == common.LineEndingsPreserve && !stripBOM {
+		return nil
+	}
+
+	// The scratch directory may be empty, if the template only prints.
+	return walkPaths(ctx, sp, []model.String{{Val: "."}}, false, func(_ string, buf []byte) ([]byte, error) {
+		return common.NormalizeText(buf, lineEndings, stripBOM), nil
+	})
+}
+
+// markGenerated adds the comment that marks a file as generated by abc to the
+// top of each output file in the scratch directory, if the spec or a flag asks
+// for it. Files included from the destination, and those matching the spec's
+// skip_if_exists or skip_generated_marker patterns, are left alone, since
+// they belong to the user. So are files whose comment syntax isn't known.
+func markGenerated(ctx context.Context, s *spec.Spec, sp *stepParams, dlMeta *templatesource.DownloadMetadata) error {
+	if !sp.rp.GeneratedMarker && !s.GeneratedMarker.Val {
+		return nil
+	}
+
+	var source string
+	if dlMeta.IsCanonical {
+		source = dlMeta.CanonicalSource
+		if dlMeta.Version != "" {
+			source += "@" + dlMeta.Version
+		}
+	}
+	fromDest := sliceToSet(sp.includedFromDest)
+	skip := append(append([]model.String{}, s.SkipIfExists...), s.SkipGeneratedMarker...)
+
+	// The scratch directory may be empty, if the template only prints.
+	return walkPaths(ctx, sp, []model.String{{Val: "."}}, false, func(relPath string, buf []byte) ([]byte, error) {
+		if _, ok := fromDest[relPath]; ok {
+			return buf, nil
+		}
+		if skipped, err := matchesAnyGlob(skip, relPath); err != nil || skipped {
+			return buf, err
+		}
+		out, _ := genmarker.Stamp(relPath, buf, source)
+		return out, nil
+	})
+}
+
+// checkPolicies checks p.Policies against the output files in the scratch
+// directory and the inputs, so that output that breaks a policy is never
+// written to the destination.
+func checkPolicies(ctx context.Context, p *Params, scratchDir string, inputs map[string]string) error {
+	if len(p.Policies) == 0 {
+		return nil
+	}
+	var files []string
+	if err := fs.WalkDir(p.FS, scratchDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err //nolint:wrapcheck
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(scratchDir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", scratchDir, path, err)
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed listing the output files to check policies: %w", err)
+	}
+	sort.Strings(files)
+
+	return policy.CheckAll(ctx, p.Policies, &policy.Input{ //nolint:wrapcheck
+		Source: p.SourceForMessages,
+		Inputs: inputs,
+		Files:  files,
+		Dir:    scratchDir,
+	})
+}
+
+// builtinVars returns the underscore-prefixed builtin vars that are in scope
+// everywhere in the spec, and the extra vars that are only in scope for
+// "print" actions. envVars are the environment variables declared in the
+// spec's env_vars.
+func builtinVars(rp *Params, f features.Features, envVars []string, dlVars templatesource.DownloaderVars) (vars, extraPrintVars map[string]string, _ error) {
 	if rp.OverrideBuiltinVars != nil { // The caller is overriding the builtin underscore-prefixed vars.
-		if err := builtinvar.Validate(f, maps.Keys(rp.OverrideBuiltinVars)); err != nil {
+		if err := builtinvar.Validate(f, envVars, maps.Keys(rp.OverrideBuiltinVars)); err != nil {
 			return nil, nil, err //nolint:wrapcheck
 		}
 		// Split the caller-provided OverrideBuiltinVars into two
@@ -255,33 +843,49 @@ func scopes(resolvedInputs map[string]string, rp *Params, f features.Features, d
 		//  2. The var names that are "print only" (only in scope for "print"
 		//     actions. Examples: _flag_dest, _flag_source
 		//
-		// The former go into "scope", and the latter go into "extraPrintVars".
+		// The former go into "vars", and the latter go into "extraPrintVars".
 		printOnlyVarNames := map[string]string{
 			builtinvar.FlagDest:   "",
 			builtinvar.FlagSource: "",
 		}
 		extraPrintVars = sets.IntersectMapKeys(rp.OverrideBuiltinVars, printOnlyVarNames)
-		scope = scope.With(sets.SubtractMapKeys(rp.OverrideBuiltinVars, printOnlyVarNames))
-		return scope, extraPrintVars, nil
+		vars = sets.SubtractMapKeys(rp.OverrideBuiltinVars, printOnlyVarNames)
+
+		// The real environment is never read when the builtins are
+		// overridden, so that golden tests are the same everywhere. Declared
+		// environment variables that aren't overridden are empty, as if unset.
+		for _, e := range envVars {
+			if _, ok := vars[builtinvar.Env(e)]; !ok {
+				vars[builtinvar.Env(e)] = ""
+			}
+		}
+		return vars, extraPrintVars, nil
 	}
 
 	// The caller isn't overriding the builtin underscore-prefixed vars (this
 	// isn't a golden test). Set the builtin vars normally.
 
 	// The set of builtins varies depending on api_version, hence NamesInScope.
-	builtinNames := builtinvar.NamesInScope(f)
-	builtinsEmptyStringMap := make(map[string]string, len(builtinNames))
+	builtinNames := builtinvar.NamesInScope(f, envVars)
+	vars = make(map[string]string, len(builtinNames))
 	for _, n := range builtinNames {
-		builtinsEmptyStringMap[n] = ""
+		vars[n] = ""
 	}
-	scope = scope.With(builtinsEmptyStringMap)
 
 	if !f.SkipGitVars { // if this api_version supports _git_* vars, add them.
-		scope = scope.With(map[string]string{
-			builtinvar.GitTag:      dlVars.GitTag,
-			builtinvar.GitSHA:      dlVars.GitSHA,
-			builtinvar.GitShortSHA: dlVars.GitShortSHA,
-		})
+		vars[builtinvar.GitTag] = dlVars.GitTag
+		vars[builtinvar.GitSHA] = dlVars.GitSHA
+		vars[builtinvar.GitShortSHA] = dlVars.GitShortSHA
+	}
+	if !f.SkipGitCommitVars {
+		vars[builtinvar.GitCommitTime] = dlVars.GitCommitTime
+		vars[builtinvar.GitAuthorName] = dlVars.GitAuthorName
+		vars[builtinvar.GitAuthorEmail] = dlVars.GitAuthorEmail
+	}
+	if rp.LookupEnv != nil {
+		for _, e := range envVars {
+			vars[builtinvar.Env(e)], _ = rp.LookupEnv(e)
+		}
 	}
 
 	extraPrintVars = map[string]string{
@@ -289,7 +893,7 @@ func scopes(resolvedInputs map[string]string, rp *Params, f features.Features, d
 		builtinvar.FlagSource: rp.SourceForMessages,
 	}
 
-	return scope, extraPrintVars, nil
+	return vars, extraPrintVars, nil
 }
 
 // Configure the git directory that will contain a commit per step for debugging
@@ -354,9 +958,38 @@ type stepParams struct {
 
 	extraPrintVars map[string]string
 
+	// stepGroups are the step groups that may be run by call_step_group
+	// actions, keyed by name.
+	stepGroups map[string]*spec.StepGroup
+
+	// baseTemplate is the "extends" value naming the base template whose steps
+	// are being run, or empty for the steps of the template being rendered.
+	baseTemplate string
+
 	debugDiffsDir string
 	scratchDir    string
+
+	// basePath is the base_path of the current step, joined with those of
+	// its parents, relative to scratchDir. The action's paths are relative
+	// to it.
+	basePath string
+
+	// phase is the Event.Phase of the steps being run. It's empty for the
+	// steps inside a for_each or step group, which don't send events.
+	phase string
+
+	// renderedPaths, if non-nil, is the value of _rendered_paths, instead of
+	// the files in scratchDir. It's set for post_render steps, which run in
+	// the destination directory, so that _rendered_paths is only the files
+	// that were rendered.
+	renderedPaths []string
 	templateDir   string
+
+	// inDest is true for the post_render steps, whose scratchDir is the
+	// destination directory. The changes made there by a failed step with
+	// on_error aren't undone, since that would mean copying the whole
+	// destination directory first.
+	inDest bool
 }
 
 // WithScope returns a copy of this stepParams with a new inner variable scope
@@ -376,8 +1009,46 @@ func executeSteps(ctx context.Context, steps []*spec.Step, sp *stepParams) error
 		logger.DebugContext(ctx, "Starting step %d action %s",
 			"step", i,
 			"action", step.Action.Val)
-		if err := executeOneStep(ctx, i, step, sp); err != nil {
-			return err
+		// The copy's fields are changed below without affecting later steps.
+		stepSPCopy := *sp
+		stepSP := &stepSPCopy
+		var err error
+		if needsRenderedPaths(step, sp) {
+			if stepSP, err = withRenderedPaths(stepSP); err != nil {
+				return err
+			}
+		}
+		if step.BasePath.Val != "" {
+			if stepSP, err = withBasePath(step, stepSP); err != nil {
+				return &StepError{Step: step, Err: err}
+			}
+		}
+		if sp.rp.DebugScope != nil {
+			if err := writeDebugScope(sp.rp.DebugScope, step, stepSP); err != nil {
+				return err
+			}
+		}
+		if sp.phase != "" {
+			emit(sp.rp, &Event{
+				Type:         EventStepStarted,
+				Phase:        sp.phase,
+				BaseTemplate: sp.baseTemplate,
+				Step:         i + 1,
+				StepCount:    len(steps),
+				Action:       step.Action.Val,
+			})
+			stepSP.phase = ""
+		}
+		err = executeStepWithOnError(ctx, i, step, stepSP)
+		sp.includedFromDest = stepSP.includedFromDest
+		if err != nil {
+			// A step inside a for_each or step group already says which step
+			// failed, so only the innermost step is named.
+			var stepErr *StepError
+			if errors.As(err, &stepErr) {
+				return err
+			}
+			return &StepError{Step: step, Err: err}
 		}
 
 		if sp.debugDiffsDir != "" {
@@ -392,6 +1063,12 @@ func executeSteps(ctx context.Context, steps []*spec.Step, sp *stepParams) error
 			}
 		}
 
+		if sp.rp.StepSnapshots != nil {
+			if err := sp.rp.StepSnapshots.record(sp, step); err != nil {
+				return err
+			}
+		}
+
 		logger.DebugContext(ctx, "completed template action", "action", step.Action.Val)
 		if sp.rp.DebugScratchContents {
 			contents, err := scratchContents(ctx, i, step, sp)
@@ -404,6 +1081,138 @@ func executeSteps(ctx context.Context, steps []*spec.Step, sp *stepParams) error
 	return nil
 }
 
+// executeBaseSteps runs the steps of each base template named by "extends",
+// in order, before the extending template's own steps. Each base template's
+// steps read from that template's directory and use its api_version features,
+// but share the scope and scratch directory.
+func executeBaseSteps(ctx context.Context, bases []*extends.Base, sp *stepParams) error {
+	for _, b := range bases {
+		baseSP := *sp
+		baseSP.features = b.Spec.Features
+		baseSP.ignorePatterns = b.Spec.Ignore
+		baseSP.stepGroups = stepGroupsByName(b.Spec.StepGroups)
+		baseSP.templateDir = b.TemplateDir
+		baseSP.baseTemplate = b.Source
+		if err := executeSteps(ctx, b.Spec.Steps, &baseSP); err != nil {
+			return fmt.Errorf("in base template %q: %w", b.Source, err)
+		}
+		sp.includedFromDest = baseSP.includedFromDest
+	}
+	return nil
+}
+
+// StepError is returned by Render when a step of the spec fails. It says which
+// step failed, by its description and action, since the underlying error may
+// only be an OS-level error, like a missing file. The step's position isn't
+// added, because the underlying error usually has a more precise one already.
+type StepError struct {
+	Step *spec.Step
+	Err  error
+}
+
+// Error implements error.
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %q (action %q) failed: %v", e.Step.Desc.Val, e.Step.Action.Val, e.Err)
+}
+
+// Unwrap returns the error from the step.
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// executeStepWithOnError runs one step, and handles its on_error field. A step
+// with on_error "retry(n)" that fails has its changes undone and is run again,
+// up to n more times. A step with on_error "continue" that still fails has
+// its changes undone, and its failure is logged and recorded in Params.Stats
+// instead of returned.
+func executeStepWithOnError(ctx context.Context, stepIdx int, step *spec.Step, sp *stepParams) error {
+	if step.OnError.Val == "" {
+		return executeOneStep(ctx, stepIdx, step, sp)
+	}
+	onError, err := spec.ParseOnError(step.OnError.Val)
+	if err != nil {
+		return step.OnError.Pos.Errorf("%w", err) // it was already validated
+	}
+
+	logger := logging.FromContext(ctx).With("logger", "executeStepWithOnError")
+	includedFromDest := sp.includedFromDest
+	attempts := onError.Retries + 1
+	for attempt := 1; ; attempt++ {
+		sp.includedFromDest = includedFromDest
+		err := executeUndoableStep(ctx, stepIdx, step, sp)
+		if err == nil {
+			return nil
+		}
+		sp.includedFromDest = includedFromDest
+		if attempt < attempts {
+			logger.WarnContext(ctx, "step failed, retrying because of on_error",
+				"desc", step.Desc.Val,
+				"line", step.Pos.Line,
+				"attempt", attempt,
+				"on_error", step.OnError.Val,
+				"error", err)
+			continue
+		}
+		if attempts > 1 {
+			err = fmt.Errorf("failed %d times, the last time with: %w", attempts, err)
+		}
+		if !onError.Continue {
+			return err
+		}
+		logger.WarnContext(ctx, `step failed and was skipped because of on_error "continue"`,
+			"desc", step.Desc.Val,
+			"line", step.Pos.Line,
+			"error", err)
+		if sp.rp.Stats != nil {
+			sp.rp.Stats.FailedSteps = append(sp.rp.Stats.FailedSteps, &FailedStep{
+				Desc:   step.Desc.Val,
+				Action: step.Action.Val,
+				Line:   step.Pos.Line,
+				Error:  err.Error(),
+			})
+		}
+		return nil
+	}
+}
+
+// executeUndoableStep runs one step after copying the scratch directory, and
+// if the step fails, restores the copy, undoing the step's changes. The
+// post_render steps, which run in the destination directory, are run without
+// a copy.
+func executeUndoableStep(ctx context.Context, stepIdx int, step *spec.Step, sp *stepParams) (rErr error) {
+	if sp.inDest {
+		return executeOneStep(ctx, stepIdx, step, sp)
+	}
+
+	rfs := sp.rp.FS
+	tempTracker := tempdir.NewDirTracker(rfs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+	backupDir, err := tempTracker.MkdirTempTracked(sp.rp.TempDirBase, tempdir.StepBackupDirNamePart)
+	if err != nil {
+		return fmt.Errorf("failed creating a temporary directory to back up the scratch directory: %w", err)
+	}
+	if err := common.CopyRecursive(ctx, &step.Pos, &common.CopyParams{
+		SrcRoot:  sp.scratchDir,
+		DstRoot:  backupDir,
+		FS:       rfs,
+		Symlinks: common.SymlinksPreserve,
+	}); err != nil {
+		return fmt.Errorf("failed backing up the scratch directory before the step: %w", err)
+	}
+
+	stepErr := executeOneStep(ctx, stepIdx, step, sp)
+	if stepErr == nil {
+		return nil
+	}
+	if err := rfs.RemoveAll(sp.scratchDir); err != nil {
+		return errors.Join(stepErr, fmt.Errorf("failed undoing the step's changes: %w", err))
+	}
+	if err := rfs.Rename(backupDir, sp.scratchDir); err != nil {
+		return errors.Join(stepErr, fmt.Errorf("failed undoing the step's changes: %w", err))
+	}
+	return stepErr
+}
+
 // executeOneStep runs one action from the spec.
 func executeOneStep(ctx context.Context, stepIdx int, step *spec.Step, sp *stepParams) error {
 	logger := logging.FromContext(ctx).With("logger", "executeOneStep")
@@ -415,6 +1224,9 @@ func executeOneStep(ctx context.Context, stepIdx int, step *spec.Step, sp *stepP
 				step.If.Val, stepIdx, step.Action.Val, err)
 		}
 		if !celResult {
+			if sp.rp.Coverage != nil {
+				sp.rp.Coverage.record(sp.baseTemplate, step, false)
+			}
 			logger.DebugContext(ctx, `skipping step because "if" expression evaluated to false`,
 				"step_index_from_0", stepIdx,
 				"action", step.Action.Val,
@@ -427,13 +1239,25 @@ func executeOneStep(ctx context.Context, stepIdx int, step *spec.Step, sp *stepP
 			"cel_expr", step.If.Val)
 	}
 
+	if sp.rp.Coverage != nil {
+		sp.rp.Coverage.record(sp.baseTemplate, step, true)
+	}
+
 	switch {
 	case step.Append != nil:
 		return actionAppend(ctx, step.Append, sp)
+	case step.CallStepGroup != nil:
+		return actionCallStepGroup(ctx, step.CallStepGroup, sp)
 	case step.ForEach != nil:
 		return actionForEach(ctx, step.ForEach, sp)
+	case step.Format != nil:
+		return actionFormat(ctx, step.Format, sp)
+	case step.GoModEdit != nil:
+		return actionGoModEdit(ctx, step.GoModEdit, sp)
 	case step.GoTemplate != nil:
 		return actionGoTemplate(ctx, step.GoTemplate, sp)
+	case step.HCLEdit != nil:
+		return actionHCLEdit(ctx, step.HCLEdit, sp)
 	case step.Include != nil:
 		return actionInclude(ctx, step.Include, sp)
 	case step.Print != nil:
@@ -449,13 +1273,116 @@ func executeOneStep(ctx context.Context, stepIdx int, step *spec.Step, sp *stepP
 	}
 }
 
+// withBasePath returns a copy of sp whose base path is the step's base_path,
+// relative to the base path of sp.
+func withBasePath(step *spec.Step, sp *stepParams) (*stepParams, error) {
+	paths, err := processPaths([]model.String{step.BasePath}, sp.scope)
+	if err != nil {
+		return nil, err
+	}
+	out := *sp
+	out.basePath = filepath.Join(sp.basePath, paths[0].Val)
+	return &out, nil
+}
+
+// workDir returns the directory that the action's paths are relative to: the
+// base path in the scratch directory.
+func (s *stepParams) workDir() string {
+	return filepath.Join(s.scratchDir, s.basePath)
+}
+
+// needsRenderedPaths returns whether the step might use the _rendered_paths
+// builtin var, so that the scratch directory is only walked for the steps that
+// do. That's any go_template step, since the var can be used in the template
+// files, and any other step whose params mention it. With --debug-scope, every
+// step needs it, since the whole scope is written out.
+func needsRenderedPaths(step *spec.Step, sp *stepParams) bool {
+	if sp.features.SkipRenderedPaths {
+		return false
+	}
+	if sp.rp.DebugScope != nil || step.GoTemplate != nil {
+		return true
+	}
+	return mentions(reflect.ValueOf(step), builtinvar.RenderedPaths)
+}
+
+// mentions returns whether any string in v, including in the fields,
+// elements, and targets of the structs, slices, maps, and pointers it holds,
+// contains s.
+func mentions(v reflect.Value, s string) bool {
+	switch v.Kind() { //nolint:exhaustive // Other kinds can't hold strings.
+	case reflect.Pointer, reflect.Interface:
+		return !v.IsNil() && mentions(v.Elem(), s)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() && mentions(v.Field(i), s) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if mentions(v.Index(i), s) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if mentions(iter.Key(), s) || mentions(iter.Value(), s) {
+				return true
+			}
+		}
+	case reflect.String:
+		return strings.Contains(v.String(), s)
+	}
+	return false
+}
+
+// withRenderedPaths returns a copy of sp with the _rendered_paths builtin var
+// in scope, listing the files currently in the scratch directory. If the
+// api_version doesn't support _rendered_paths, sp is returned unchanged.
+func withRenderedPaths(sp *stepParams) (*stepParams, error) {
+	if sp.features.SkipRenderedPaths {
+		return sp, nil
+	}
+	if sp.renderedPaths != nil {
+		return sp.WithScope(map[string]string{
+			builtinvar.RenderedPaths: strings.Join(sp.renderedPaths, "\n"),
+		}), nil
+	}
+
+	var paths []string
+	err := fs.WalkDir(sp.rp.FS, sp.scratchDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err // some filesystem error happened
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(sp.scratchDir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(): %w", err)
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error crawling scratch directory: %w", err)
+	}
+	sort.Strings(paths)
+
+	return sp.WithScope(map[string]string{
+		builtinvar.RenderedPaths: strings.Join(paths, "\n"),
+	}), nil
+}
+
 // scratchContents returns the contents of the scratch dir for debugging purposes; it's
 // only used if --debug-scratch-contents=true.
 func scratchContents(ctx context.Context, stepIdx int, step *spec.Step, sp *stepParams) (string, error) {
 	sb := &strings.Builder{}
 	fmt.Fprintf(sb, "Scratch dir contents after step %d (starting from 0), which is action type %q, defined at spec file line %d:\n",
 		stepIdx, step.Action.Val, step.Action.Pos.Line)
-	err := filepath.WalkDir(sp.scratchDir, func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(sp.rp.FS, sp.scratchDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err // some filesystem error happened
 		}
@@ -479,53 +1406,386 @@ func scratchContents(ctx context.Context, stepIdx int, step *spec.Step, sp *step
 	return sb.String(), nil
 }
 
+// debugScope is the YAML document written for each step by --debug-scope.
+type debugScope struct {
+	Action string `yaml:"action"`
+	Desc   string `yaml:"desc,omitempty"`
+	Line   int    `yaml:"line"`
+
+	// BaseTemplate is the base template whose steps are running, if any.
+	BaseTemplate string `yaml:"base_template,omitempty"`
+
+	// Scope is every variable in scope, including the print-only vars for
+	// "print" actions.
+	Scope map[string]string `yaml:"scope"`
+
+	// Types are the types of the variables that aren't strings.
+	Types map[string]common.VarType `yaml:"types,omitempty"`
+}
+
+// writeDebugScope writes the variables in scope for the given step to w as a
+// YAML document; it's only used if --debug-scope=true.
+func writeDebugScope(w io.Writer, step *spec.Step, sp *stepParams) error {
+	vars := sp.scope.All()
+	if step.Print != nil {
+		maps.Copy(vars, sp.extraPrintVars)
+	}
+	types := make(map[string]common.VarType)
+	for name := range vars {
+		if t := sp.scope.Type(name); t != common.VarTypeString {
+			types[name] = t
+		}
+	}
+	buf, err := yaml.Marshal(&debugScope{
+		Action:       step.Action.Val,
+		Desc:         step.Desc.Val,
+		Line:         step.Pos.Line,
+		BaseTemplate: sp.baseTemplate,
+		Scope:        vars,
+		Types:        types,
+	})
+	if err != nil {
+		return fmt.Errorf("failed marshaling scope for --debug-scope: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "---\n%s", buf); err != nil {
+		return fmt.Errorf("failed writing scope for --debug-scope: %w", err)
+	}
+	return nil
+}
+
 // commitParams contains the arguments to commitTentatively().
 type commitParams struct {
+	// destination is the name of the spec's destination that the output is
+	// written to, or "" for the main destination, DestDir. It's recorded in
+	// the manifest.
+	destination string
+
 	dlMeta           *templatesource.DownloadMetadata
 	scratchDir       string
 	templateDir      string
 	includedFromDest map[string]struct{}
 	inputs           map[string]string
+	inputTypes       map[string]common.VarType
+
+	// acceptedDefaults are the inputs whose defaults were used because of
+	// --accept-defaults.
+	acceptedDefaults map[string]struct{}
+
+	// skipIfExists are the spec's skip_if_exists patterns.
+	skipIfExists []model.String
+
+	// modes chooses the permission bits of the output files.
+	modes *modePolicy
+
+	// only is the part of the output that's written, as chosen by
+	// --only-paths. If it's nil, all of it is written.
+	only *pathSelection
+
+	// protected are the paths in the destination that must not be written.
+	protected *protect.List
+
+	// newDirs are the directories in the destination that didn't exist
+	// before the render, which are given the owner p.Chown.
+	newDirs []string
+
+	// postRender are the spec's post_render steps, which are run with
+	// stepParams after the output is written to the destination.
+	postRender []*spec.Step
+	stepParams *stepParams
 }
 
-// commitTentatively writes the contents of the scratch directory to the output
-// directory. We first do a dry-run to check that the copy is likely to succeed,
-// so we don't leave a half-done mess in the user's dest directory.
-func commitTentatively(ctx context.Context, p *Params, cp *commitParams) error {
+// commitTentatively writes the contents of the scratch directory of each
+// output to its destination directory. We first do a dry-run of all of them to
+// check that the copies are likely to succeed, so we don't leave a half-done
+// mess in the user's dest directories.
+func commitTentatively(ctx context.Context, outputs []*destOutput) error {
+	conflicts := make([]*conflictResolver, len(outputs))
+	for i, out := range outputs {
+		conflicts[i] = newConflictResolver(out.p)
+	}
 	for _, dryRun := range []bool{true, false} {
-		outputHashes, err := commit(ctx, dryRun, p, cp.scratchDir, cp.includedFromDest)
+		for i, out := range outputs {
+			if err := commitOne(ctx, dryRun, out.p, out.cp, conflicts[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// commitOne writes the contents of cp.scratchDir to p.DestDir, along with the
+// manifest, or checks that it can in a dry run.
+func commitOne(ctx context.Context, dryRun bool, p *Params, cp *commitParams, conflicts *conflictResolver) error {
+	outputHashes, outputSymlinks, err := commit(ctx, dryRun, p, cp.scratchDir, cp.includedFromDest, cp.skipIfExists, cp.modes, cp.only, cp.protected, conflicts)
+	if err != nil {
+		return err
+	}
+
+	if !dryRun && len(cp.postRender) > 0 {
+		if outputHashes, err = executePostRender(ctx, p, cp, outputHashes, outputSymlinks); err != nil {
+			return err
+		}
+	}
+
+	if !dryRun && p.Stats != nil {
+		if err := addOutputStats(p, outputHashes, outputSymlinks); err != nil {
+			return err
+		}
+	}
+
+	var manifestPath string
+	if p.Manifest {
+		if manifestPath, err = writeManifest(ctx, &writeManifestParams{
+			acceptedDefaults: cp.acceptedDefaults,
+			clock:            p.Clock,
+			cwd:              p.Cwd,
+			destination:      cp.destination,
+			dlMeta:           cp.dlMeta,
+			destDir:          p.DestDir,
+			dryRun:           dryRun,
+			fs:               p.FS,
+			hashAlg:          hashAlgorithm(p),
+			inputs:           cp.inputs,
+			inputTypes:       cp.inputTypes,
+			outputHashes:     outputHashes,
+			outputSymlinks:   outputSymlinks,
+			includedFromDest: cp.includedFromDest,
+			skipIfExists:     cp.skipIfExists,
+			templateDir:      cp.templateDir,
+			varOverrides:     p.SetVars,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if !dryRun && p.Chown != nil {
+		if err := chownOutputs(p, cp.newDirs, outputHashes, manifestPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathSelection is the part of the output that's written to the destination
+// when --only-paths is given. A nil *pathSelection includes everything.
+type pathSelection struct {
+	// paths are the selected files and empty directories.
+	paths map[string]struct{}
+
+	// dirs are the directories that contain selected paths.
+	dirs map[string]struct{}
+}
+
+// includes reports whether the file or directory relPath, relative to the
+// scratch directory, is written to the destination. The scratch directory
+// itself, ".", always is.
+func (s *pathSelection) includes(relPath string, isDir bool) bool {
+	if s == nil || relPath == "." {
+		return true
+	}
+	if _, ok := s.paths[relPath]; ok {
+		return true
+	}
+	if isDir {
+		_, ok := s.dirs[relPath]
+		return ok
+	}
+	return false
+}
+
+// selectOnlyPaths returns the part of the output in scratchDir that's written
+// to the destination, as chosen by p.OnlyPaths, or nil if p.OnlyPaths is
+// empty. A file is selected if it or one of its parent directories matches
+// one of the globs. It's an error if nothing matches, since that's probably a
+// typo.
+func selectOnlyPaths(p *Params, scratchDir string) (*pathSelection, error) {
+	if len(p.OnlyPaths) == 0 {
+		return nil, nil
+	}
+	patterns := make([]model.String, 0, len(p.OnlyPaths))
+	for _, pattern := range p.OnlyPaths {
+		patterns = append(patterns, model.String{Val: pattern})
+	}
+
+	s := &pathSelection{paths: map[string]struct{}{}, dirs: map[string]struct{}{}}
+	matchedDirs := map[string]struct{}{}
+	if err := fs.WalkDir(p.FS, scratchDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if path == scratchDir {
+			return nil
+		}
+		relPath, err := filepath.Rel(scratchDir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", scratchDir, path, err)
+		}
 
-		if p.Manifest {
-			if err := writeManifest(ctx, &writeManifestParams{
-				clock:        p.Clock,
-				cwd:          p.Cwd,
-				dlMeta:       cp.dlMeta,
-				destDir:      p.DestDir,
-				dryRun:       dryRun,
-				fs:           p.FS,
-				inputs:       cp.inputs,
-				outputHashes: outputHashes,
-				templateDir:  cp.templateDir,
-			}); err != nil {
+		_, selected := matchedDirs[filepath.Dir(relPath)]
+		if !selected {
+			if selected, err = matchesAnyGlob(patterns, relPath); err != nil {
 				return err
 			}
 		}
+		if !selected {
+			return nil
+		}
+		if d.IsDir() {
+			// Everything in the directory is selected. The directory itself
+			// is only written if it's empty, or contains a selected file.
+			matchedDirs[relPath] = struct{}{}
+			entries, err := fs.ReadDir(p.FS, path)
+			if err != nil {
+				return fmt.Errorf("ReadDir(): %w", err)
+			}
+			if len(entries) > 0 {
+				return nil
+			}
+		}
+		s.paths[relPath] = struct{}{}
+		for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+			s.dirs[dir] = struct{}{}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed selecting the --only-paths: %w", err)
+	}
+
+	if len(s.paths) == 0 {
+		return nil, fmt.Errorf("--only-paths %s matched none of the output files", strings.Join(p.OnlyPaths, ","))
+	}
+	return s, nil
+}
+
+// missingDirs returns the directories in the destination that didn't exist
+// before the render but may be created by it: the destination itself, the
+// manifest directory, and those of the directories in scratchDir. lockCreated
+// are the directories that locking the destination created, which count as
+// missing.
+func missingDirs(p *Params, scratchDir string, lockCreated []string) ([]string, error) {
+	candidates := []string{p.DestDir}
+	if p.Manifest {
+		candidates = append(candidates, filepath.Join(p.DestDir, common.ABCInternalDir))
+	}
+	if err := fs.WalkDir(p.FS, scratchDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == scratchDir {
+			return nil
+		}
+		relPath, err := filepath.Rel(scratchDir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", scratchDir, path, err)
+		}
+		candidates = append(candidates, filepath.Join(p.DestDir, relPath))
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed walking the scratch directory: %w", err)
+	}
+
+	var out []string
+	for _, dir := range candidates {
+		if slices.Contains(lockCreated, dir) {
+			out = append(out, dir)
+			continue
+		}
+		if _, err := p.FS.Stat(dir); err != nil {
+			if !common.IsStatNotExistErr(err) {
+				return nil, fmt.Errorf("Stat(): %w", err)
+			}
+			out = append(out, dir)
+		}
+	}
+	return out, nil
+}
+
+// chownOutputs gives the owner p.Chown to the directories that the render
+// created, the output files, and the manifest, if there is one. Directories
+// that existed before the render keep their owner. Of newDirs, only those that
+// now exist are changed, since a directory whose files were all skipped isn't
+// created.
+func chownOutputs(p *Params, newDirs []string, outputHashes map[string][]byte, manifestPath string) error {
+	cfs, ok := p.FS.(common.ChownFS)
+	if !ok {
+		return fmt.Errorf("internal error: the filesystem doesn't implement common.ChownFS")
+	}
+
+	paths := make([]string, 0, len(newDirs)+len(outputHashes)+1)
+	for _, dir := range newDirs {
+		if _, err := p.FS.Stat(dir); err != nil {
+			if common.IsStatNotExistErr(err) {
+				continue
+			}
+			return fmt.Errorf("Stat(): %w", err)
+		}
+		paths = append(paths, dir)
+	}
+	for path := range outputHashes {
+		paths = append(paths, filepath.Join(p.DestDir, filepath.FromSlash(path)))
+	}
+	if manifestPath != "" {
+		paths = append(paths, manifestPath)
+	}
+	for _, path := range paths {
+		// Lchown, so that a preserved symlink itself is changed rather than
+		// its target, which may be outside the destination.
+		if err := cfs.Lchown(path, p.Chown.UID, p.Chown.GID); err != nil {
+			return fmt.Errorf("failed changing the owner of %q: %w", path, err)
+		}
 	}
 	return nil
 }
 
+// executePostRender runs the post_render steps in the destination directory,
+// after the output has been written there. Since those steps may change the
+// output files, like by formatting them, the files are hashed again, and the
+// new hashes are returned, keyed by the same paths as outputHashes. Symlinks
+// keep their hashes, which are of their targets.
+func executePostRender(ctx context.Context, p *Params, cp *commitParams, outputHashes map[string][]byte, outputSymlinks map[string]string) (map[string][]byte, error) {
+	paths := maps.Keys(outputHashes)
+	sort.Strings(paths)
+
+	postSP := *cp.stepParams
+	postSP.scratchDir = p.DestDir
+	postSP.debugDiffsDir = ""
+	postSP.renderedPaths = paths
+	postSP.phase = PhasePostRender
+	postSP.inDest = true
+	if err := executeSteps(ctx, cp.postRender, &postSP); err != nil {
+		return nil, fmt.Errorf("in post_render: %w", err)
+	}
+
+	out := make(map[string][]byte, len(outputHashes))
+	for _, path := range paths {
+		if _, ok := outputSymlinks[path]; ok {
+			out[path] = outputHashes[path]
+			continue
+		}
+		buf, err := p.FS.ReadFile(filepath.Join(p.DestDir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, fmt.Errorf("failed reading output file after post_render: %w", err)
+		}
+		h := hashAlgorithm(p).New()
+		h.Write(buf) // a hash.Hash never returns an error
+		out[path] = h.Sum(nil)
+	}
+	return out, nil
+}
+
 // commit copies the contents of scratchDir to rp.Dest. If dryRun==true, then
 // files are read but nothing is written to the destination. includedFromDest is
 // a set of files that were the subject of an "include" action that set "from:
-// destination".
+// destination". Files matching the skipIfExists patterns that already exist in
+// the destination are left alone. Other existing files are handled as decided
+// by conflicts. The permission bits of the output files are chosen by modes.
+// Only the files and directories included by only are written.
 //
-// The return value is a map containing a SHA256 hash of each file in
-// scratchDir. The keys are paths relative to scratchDir, using forward slashes
-// regardless of the OS.
-func commit(ctx context.Context, dryRun bool, p *Params, scratchDir string, includedFromDest map[string]struct{}) (map[string][]byte, error) {
+// The first return value is a map containing the hash of each file in
+// scratchDir, using the algorithm from hashAlgorithm(p). The second is a map
+// containing the target of each symlink that was preserved. The keys are paths
+// relative to scratchDir, using forward slashes regardless of the OS.
+func commit(ctx context.Context, dryRun bool, p *Params, scratchDir string, includedFromDest map[string]struct{}, skipIfExists []model.String, modes *modePolicy, only *pathSelection, protected *protect.List, conflicts *conflictResolver) (map[string][]byte, map[string]string, error) {
 	logger := logging.FromContext(ctx).With("logger", "commit")
 
 	if !dryRun {
@@ -534,20 +1794,74 @@ func commit(ctx context.Context, dryRun bool, p *Params, scratchDir string, incl
 		// no output files. In that case, the output directory should be created
 		// but empty.
 		if err := p.FS.MkdirAll(p.DestDir, common.OwnerRWXPerms); err != nil {
-			return nil, fmt.Errorf("failed creating template output directory: %w", err)
+			return nil, nil, fmt.Errorf("failed creating template output directory: %w", err)
 		}
 	}
 
-	visitor := func(relPath string, _ fs.DirEntry) (common.CopyHint, error) {
+	visitor := func(relPath string, de fs.DirEntry) (common.CopyHint, error) {
 		if common.IsReservedInDest(relPath) {
 			// Users aren't allowed to output to ".abc" in the destination root.
 			return common.CopyHint{}, fmt.Errorf("the destination path %q uses the reserved name %q",
 				relPath, common.ABCInternalDir)
 		}
 
+		if !only.includes(relPath, de.IsDir()) {
+			return common.CopyHint{Skip: true}, nil
+		}
+
+		if !de.IsDir() {
+			skip, err := existsAndSkipped(p, relPath, skipIfExists)
+			if err != nil {
+				return common.CopyHint{}, err
+			}
+			if skip {
+				if !dryRun {
+					logger.InfoContext(ctx, "not writing a file that matches skip_if_exists, because it already exists",
+						"path", relPath)
+					if p.Stats != nil {
+						p.Stats.FilesSkipped++
+					}
+				}
+				return common.CopyHint{Skip: true}, nil
+			}
+		}
+
 		_, ok := includedFromDest[relPath]
+		overwrite := ok || p.ForceOverwrite
+		if !ok && !de.IsDir() {
+			if _, err := p.FS.Stat(filepath.Join(p.DestDir, relPath)); err == nil {
+				var keep bool
+				overwrite, keep, err = conflicts.resolve(ctx, p.FS, scratchDir, p.DestDir, relPath)
+				if err != nil {
+					return common.CopyHint{}, err
+				}
+				if dryRun {
+					emit(p, &Event{Type: EventConflict, Path: filepath.ToSlash(relPath), Overwrite: overwrite, Keep: keep})
+				}
+				if keep {
+					if !dryRun {
+						logger.InfoContext(ctx, "keeping an existing file instead of overwriting it", "path", relPath)
+						if p.Stats != nil {
+							p.Stats.FilesSkipped++
+						}
+					}
+					return common.CopyHint{Skip: true}, nil
+				}
+			}
+		}
+		if err := checkProtected(p, protected, relPath, de); err != nil {
+			return common.CopyHint{}, err
+		}
+		var mode fs.FileMode
+		if !de.IsDir() {
+			var err error
+			if mode, err = modes.mode(p, filepath.Join(scratchDir, relPath), relPath, de); err != nil {
+				return common.CopyHint{}, err
+			}
+		}
 		return common.CopyHint{
 			BackupIfExists: p.Backups,
+			Mode:           mode,
 
 			// Special case: files that were "include"d from the
 			// *destination* directory (rather than the template directory),
@@ -556,7 +1870,7 @@ func commit(ctx context.Context, dryRun bool, p *Params, scratchDir string, incl
 			// ourself to write back to that file, even when
 			// --force-overwrite=false. When the template uses this feature,
 			// we know that the intent is to modify the files in place.
-			Overwrite: ok || p.ForceOverwrite,
+			Overwrite: overwrite,
 		}, nil
 	}
 
@@ -580,21 +1894,146 @@ func commit(ctx context.Context, dryRun bool, p *Params, scratchDir string, incl
 		BackupDirMaker: backupDirMaker,
 		DryRun:         dryRun,
 		DstRoot:        p.DestDir,
-		Hasher:         sha256.New,
+		Hasher:         hashAlgorithm(p).New,
 		OutHashes:      map[string][]byte{},
+		Limits:         p.Limits,
+		OutSymlinks:    map[string]string{},
 		SrcRoot:        scratchDir,
 		FS:             p.FS,
+		Symlinks:       p.Symlinks,
 		Visitor:        visitor,
 	}
 	if err := common.CopyRecursive(ctx, nil, params); err != nil {
-		return nil, fmt.Errorf("failed writing to --dest directory: %w", err)
+		return nil, nil, fmt.Errorf("failed writing to --dest directory: %w", err)
 	}
 	if dryRun {
 		logger.DebugContext(ctx, "template render (dry run) succeeded")
 	} else {
+		paths := maps.Keys(params.OutHashes)
+		sort.Strings(paths)
+		for _, path := range paths {
+			emit(p, &Event{Type: EventFileWritten, Path: path})
+		}
 		logger.InfoContext(ctx, "template render succeeded")
 	}
-	return params.OutHashes, nil
+	return params.OutHashes, params.OutSymlinks, nil
+}
+
+// hashAlgorithm returns the algorithm for the hashes in the manifest.
+func hashAlgorithm(p *Params) *hashalg.Algorithm {
+	if p.HashAlgorithm == nil {
+		return hashalg.Default
+	}
+	return p.HashAlgorithm
+}
+
+// checkProtected returns an error if writing the file or directory relPath
+// to the destination would create or modify a protected path. Directories
+// that already exist in the destination aren't changed by writing them, so
+// only their contents are checked.
+func checkProtected(p *Params, protected *protect.List, relPath string, de fs.DirEntry) error {
+	if relPath == "." {
+		return nil
+	}
+	if de.IsDir() {
+		if _, err := p.FS.Stat(filepath.Join(p.DestDir, relPath)); err == nil {
+			return nil
+		}
+	}
+	return protected.Check(relPath) //nolint:wrapcheck
+}
+
+// modePolicy chooses the permission bits of output files, as set by the
+// spec's file_modes and executable settings and by --file-modes.
+type modePolicy struct {
+	fileModes  common.FileModes
+	executable []model.String
+}
+
+// newModePolicy returns the modePolicy of a render. The --file-modes flag
+// takes precedence over the spec.
+func newModePolicy(p *Params, s *spec.Spec) (*modePolicy, error) {
+	fileModes := p.FileModes
+	if fileModes == "" {
+		var err error
+		if fileModes, err = common.ParseFileModes(s.FileModes.Val); err != nil {
+			return nil, s.FileModes.Pos.Errorf("%w", err)
+		}
+	}
+	return &modePolicy{fileModes: fileModes, executable: s.Executable}, nil
+}
+
+// mode returns the permission bits of the output file relPath, whose scratch
+// file is path, for common.CopyHint. It's zero, meaning the permission bits of
+// the scratch file are copied as usual, unless the template chose the mode.
+func (m *modePolicy) mode(p *Params, path, relPath string, de fs.DirEntry) (fs.FileMode, error) {
+	if de.Type()&fs.ModeSymlink != 0 && p.Symlinks == common.SymlinksPreserve {
+		// A preserved symlink has no mode of its own.
+		return 0, nil
+	}
+	executable, err := matchesAnyGlob(m.executable, relPath)
+	if err != nil {
+		return 0, err
+	}
+	if m.fileModes == common.FileModesPreserve && !executable {
+		return 0, nil
+	}
+	// Stat follows a symlink, which is copied like the file it points to.
+	info, err := p.FS.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("Stat(): %w", err)
+	}
+	return common.OutputMode(m.fileModes, info.Mode(), executable), nil
+}
+
+// existsAndSkipped reports whether the output file relPath matches one of the
+// skip_if_exists patterns and already exists in the destination, so it must
+// not be written.
+func existsAndSkipped(p *Params, relPath string, skipIfExists []model.String) (bool, error) {
+	matched, err := matchesAnyGlob(skipIfExists, relPath)
+	if err != nil || !matched {
+		return false, err
+	}
+	if _, err := p.FS.Stat(filepath.Join(p.DestDir, relPath)); err != nil {
+		if common.IsStatNotExistErr(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Stat(): %w", err)
+	}
+	return true, nil
+}
+
+// matchesAnyGlob reports whether relPath matches any of patterns, which use
+// forward slashes.
+func matchesAnyGlob(patterns []model.String, relPath string) (bool, error) {
+	for _, pattern := range patterns {
+		matched, err := common.MatchGlob(filepath.FromSlash(pattern.Val), relPath)
+		if err != nil {
+			return false, pattern.Pos.Errorf("failed matching path %q with pattern %q: %w", relPath, pattern.Val, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addOutputStats adds the number and total size of the files written to the
+// destination to p.Stats. outputHashes and outputSymlinks are as returned by
+// commit.
+func addOutputStats(p *Params, outputHashes map[string][]byte, outputSymlinks map[string]string) error {
+	p.Stats.FilesWritten += len(outputHashes)
+	for path := range outputHashes {
+		if _, ok := outputSymlinks[path]; ok {
+			continue
+		}
+		fi, err := p.FS.Stat(filepath.Join(p.DestDir, filepath.FromSlash(path)))
+		if err != nil {
+			return fmt.Errorf("Stat(): %w", err)
+		}
+		p.Stats.Bytes += fi.Size()
+	}
+	return nil
 }
 
 func sliceToSet[T comparable](vals []T) map[T]struct{} {
@@ -16,9 +16,14 @@ package render
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -27,12 +32,18 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 
+	"github.com/abcxyz/abc/internal/version"
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/audit"
 	"github.com/abcxyz/abc/templates/common/builtinvar"
+	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/policy"
+	"github.com/abcxyz/abc/templates/common/redact"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
 	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/spec/features"
 	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/cli"
@@ -96,6 +107,9 @@ steps:
 		flagSkipInputValidation bool
 		flagManifest            bool
 		flagDebugStepDiffs      bool
+		flagAllowUnmatched      bool
+		flagSetVars             map[string]string
+		flagStrictAPIVersion    bool
 		overrideBuiltinVars     map[string]string
 		removeAllErr            error
 		wantScratchContents     map[string]string
@@ -264,16 +278,51 @@ emoji_suffix: '🐈'`,
 			},
 		},
 		{
-			name:           "conflicting_input_files",
+			name:           "later_input_file_overrides_earlier",
 			inputFileNames: []string{"inputs.yaml", "other-inputs.yaml"},
 			inputFileContents: map[string]string{
-				"inputs.yaml":       `name_to_greet: 'Alice'`,
+				"inputs.yaml": `
+name_to_greet: 'Alice'
+emoji_suffix: '🐶'`,
+				"other-inputs.yaml": `name_to_greet: 'Bob'`,
+			},
+			templateContents: map[string]string{
+				"spec.yaml":            specContents,
+				"file1.txt":            "my favorite color is blue",
+				"dir1/file_in_dir.txt": "file_in_dir contents",
+				"dir2/file2.txt":       "file2 contents",
+			},
+			wantStdout: "Hello, Bob🐶.\n",
+			wantDestContents: map[string]string{
+				"file1.txt":            "my favorite color is red",
+				"dir1/file_in_dir.txt": "file_in_dir contents",
+				"dir2/file2.txt":       "file2 contents",
+			},
+		},
+		{
+			name: "input_flag_overrides_all_input_files",
+			flagInputs: map[string]string{
+				"name_to_greet": "Carol",
+			},
+			inputFileNames: []string{"inputs.yaml", "other-inputs.yaml"},
+			inputFileContents: map[string]string{
+				"inputs.yaml": `
+name_to_greet: 'Alice'
+emoji_suffix: '🐶'`,
 				"other-inputs.yaml": `name_to_greet: 'Bob'`,
 			},
 			templateContents: map[string]string{
-				"spec.yaml": specContents,
+				"spec.yaml":            specContents,
+				"file1.txt":            "my favorite color is blue",
+				"dir1/file_in_dir.txt": "file_in_dir contents",
+				"dir2/file2.txt":       "file2 contents",
+			},
+			wantStdout: "Hello, Carol🐶.\n",
+			wantDestContents: map[string]string{
+				"file1.txt":            "my favorite color is red",
+				"dir1/file_in_dir.txt": "file_in_dir contents",
+				"dir2/file2.txt":       "file2 contents",
 			},
-			wantErr: "input key \"name_to_greet\" appears in multiple input files",
 		},
 		{
 			name: "keep_temp_dirs_on_success_if_flag",
@@ -372,9 +421,33 @@ emoji_suffix: '🐈'`,
 			wantErr: "overwriting was not enabled",
 		},
 		{
-			name:                 "fs_error",
-			removeAllErr:         fmt.Errorf("fake removeAll error for testing"),
-			wantTemplateContents: map[string]string{},
+			name: "dest_locked_by_another_render_should_fail",
+			flagInputs: map[string]string{
+				"name_to_greet": "Bob",
+				"emoji_suffix":  "🐈",
+			},
+			existingDestContents: map[string]string{
+				".abc/lock": `pid 1234 on host "other-host" since 2024-03-01T12:00:00Z`,
+			},
+			templateContents: map[string]string{
+				"myfile.txt":           "Some random stuff",
+				"spec.yaml":            specContents,
+				"file1.txt":            "file1 contents",
+				"dir1/file_in_dir.txt": "file_in_dir contents",
+				"dir2/file2.txt":       "file2 contents",
+			},
+			// The lock is checked before any step runs.
+			wantDestContents: map[string]string{
+				".abc/lock": `pid 1234 on host "other-host" since 2024-03-01T12:00:00Z`,
+			},
+			wantErr: `locked by another render or upgrade (held by pid 1234 on host "other-host" since 2024-03-01T12:00:00Z)`,
+		},
+		{
+			name:         "fs_error",
+			removeAllErr: fmt.Errorf("fake removeAll error for testing"),
+			// The download can't be marked complete, so the marker is left
+			// in the template directory, which can't be removed either.
+			wantTemplateContents: map[string]string{templatesource.IncompleteDownloadMarker: ""},
 			wantErr:              "fake removeAll error for testing",
 		},
 		{
@@ -464,6 +537,239 @@ steps:
 				"subdir_b/file_b.txt": "purple is my favorite color",
 			},
 		},
+		{
+			name:         "destination_include_in_for_each_is_recorded_in_manifest",
+			flagManifest: true,
+			templateContents: map[string]string{
+				"new.txt": "new file",
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'my template'
+steps:
+  - desc: 'Modify each existing file'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'name'
+        values: ['a', 'b']
+      steps:
+        - desc: 'Include from destination'
+          action: 'include'
+          params:
+            paths: ['{{.name}}.txt']
+            from: 'destination'
+  - desc: 'Include from template'
+    action: 'include'
+    params:
+      paths: ['new.txt']
+  - desc: 'Replace "purple" with "red"'
+    action: 'string_replace'
+    params:
+      paths: ['a.txt', 'b.txt']
+      replacements:
+        - to_replace: 'purple'
+          with: 'red'`,
+			},
+			existingDestContents: map[string]string{
+				"a.txt": "purple",
+				"b.txt": "purple",
+			},
+			wantDestContents: map[string]string{
+				"a.txt":   "red",
+				"b.txt":   "red",
+				"new.txt": "new file",
+				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta5
+kind: Manifest
+creation_time: 2023-12-08T23:59:02.000000013Z
+modification_time: 2023-12-08T23:59:02.000000013Z
+template_location: ""
+location_type: ""
+template_version: ""
+template_dirhash: h1:V8pSvERF1tg/fwao2gbwn/m/d5hoe62RraZPyDaauxE=
+inputs: []
+output_hashes:
+    - file: a.txt
+      hash: h1:sfUaUR8doM00i4+FmNsy5hy5Y+X8aeK0FIW/mVkO11o=
+      included_from_dest: true
+    - file: b.txt
+      hash: h1:sfUaUR8doM00i4+FmNsy5hy5Y+X8aeK0FIW/mVkO11o=
+      included_from_dest: true
+    - file: new.txt
+      hash: h1:s30sv9h1iR6e0HP8vmHzWpkL7o7svdB/nvxRM51f/WY=
+`,
+			},
+			wantBackupContents: map[string]string{
+				"a.txt": "purple",
+				"b.txt": "purple",
+			},
+		},
+		{
+			name:                 "strict_api_version_latest",
+			flagStrictAPIVersion: true,
+			templateContents: map[string]string{
+				"file.txt": "hello",
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta5'
+kind: 'Template'
+desc: 'my template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['file.txt']`,
+			},
+			wantDestContents: map[string]string{
+				"file.txt": "hello",
+			},
+		},
+		{
+			name:                 "strict_api_version_alias_of_latest",
+			flagStrictAPIVersion: true,
+			templateContents: map[string]string{
+				"file.txt": "hello",
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'my template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['file.txt']`,
+			},
+			wantDestContents: map[string]string{
+				"file.txt": "hello",
+			},
+		},
+		{
+			name:                 "strict_api_version_older",
+			flagStrictAPIVersion: true,
+			templateContents: map[string]string{
+				"file.txt": "hello",
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta3'
+kind: 'Template'
+desc: 'my template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['file.txt']`,
+			},
+			wantErr: `the template's spec.yaml has api_version "cli.abcxyz.dev/v1beta3", but --strict-api-version requires the latest, "cli.abcxyz.dev/v1beta5"`,
+		},
+		{
+			name:               "skip_if_exists_keeps_existing_file",
+			flagForceOverwrite: true,
+			templateContents: map[string]string{
+				"config.yaml": "template config",
+				"main.go":     "template main",
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'my template'
+skip_if_exists: ['*.yaml']
+steps:
+  - desc: 'Include all'
+    action: 'include'
+    params:
+      paths: ['config.yaml', 'main.go']`,
+			},
+			existingDestContents: map[string]string{
+				"config.yaml": "user config",
+				"main.go":     "old main",
+			},
+			wantDestContents: map[string]string{
+				"config.yaml": "user config",
+				"main.go":     "template main",
+			},
+			wantBackupContents: map[string]string{
+				"main.go": "old main",
+			},
+		},
+		{
+			name:         "skip_if_exists_creates_missing_file_and_marks_manifest",
+			flagManifest: true,
+			templateContents: map[string]string{
+				"config.yaml": "template config",
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'my template'
+skip_if_exists: ['config.yaml']
+steps:
+  - desc: 'Include all'
+    action: 'include'
+    params:
+      paths: ['config.yaml']`,
+			},
+			wantDestContents: map[string]string{
+				"config.yaml": "template config",
+				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta5
+kind: Manifest
+creation_time: 2023-12-08T23:59:02.000000013Z
+modification_time: 2023-12-08T23:59:02.000000013Z
+template_location: ""
+location_type: ""
+template_version: ""
+template_dirhash: h1:Ud+G0z45QDcaGjkD8aFFdprFyKzDAFz3eI32WGmLhHk=
+inputs: []
+output_hashes:
+    - file: config.yaml
+      hash: h1:qd3RC6iv/9PwpTNN1B9935y35Nptu98GYch7kBciYTk=
+      skip_if_exists: true
+`,
+			},
+		},
+		{
+			name: "inline_files",
+			templateContents: map[string]string{
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'my template'
+files:
+  main.go: 'package main'
+  src/README.md: '# My blue app'
+steps:
+  - desc: 'Include all'
+    action: 'include'
+    params:
+      paths: ['main.go', 'src']
+  - desc: 'Replace "blue" with "red"'
+    action: 'string_replace'
+    params:
+      paths: ['.']
+      replacements:
+      - to_replace: 'blue'
+        with: 'red'`,
+			},
+			wantDestContents: map[string]string{
+				"main.go":       "package main",
+				"src/README.md": "# My red app",
+			},
+		},
+		{
+			name: "inline_file_also_in_template_dir",
+			templateContents: map[string]string{
+				"main.go": "package main",
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'my template'
+files:
+  main.go: 'package other'
+steps:
+  - desc: 'Include all'
+    action: 'include'
+    params:
+      paths: ['main.go']`,
+			},
+			wantErr: `at line 6 column 12: the file "main.go" in "files" is also in the template directory; remove one of them`,
+		},
 		{
 			name: "mix_of_destination_include_and_normal_include",
 			templateContents: map[string]string{
@@ -840,6 +1146,36 @@ module "cloud_run" {
 `, abctestutil.MinimalGitHeadSHA, abctestutil.MinimalGitHeadShortSHA, "v1.2.3"),
 			},
 		},
+		{
+			name: "git_commit_variables_are_in_scope",
+			templateContents: abctestutil.WithGitRepoAt("", map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'My template'
+steps:
+  - action: 'print'
+    desc: 'print commit details'
+    params:
+      message: '{{._git_commit_time}} {{._git_author_name}} <{{._git_author_email}}>'`,
+			}),
+			wantStdout: fmt.Sprintf("%s %s <%s>\n",
+				abctestutil.MinimalGitHeadCommitTime, abctestutil.MinimalGitHeadAuthorName, abctestutil.MinimalGitHeadAuthorEmail),
+			wantDestContents: map[string]string{},
+		},
+		{
+			name: "git_commit_variables_not_in_scope_on_old_api_version",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta3'
+kind: 'Template'
+desc: 'My template'
+steps:
+  - action: 'print'
+    desc: 'should fail'
+    params:
+      message: '{{._git_commit_time}}'`,
+			},
+			wantErr: `nonexistent variable name "_git_commit_time"`,
+		},
 		{
 			name: "git_metadata_variables_are_empty_string_when_unavailable",
 			templateContents: map[string]string{
@@ -892,6 +1228,44 @@ steps:
 			},
 			wantErr: `at line 7 column 9: the template referenced a nonexistent variable name "_git_tag"`,
 		},
+		{
+			name: "failed_step_is_named_in_error",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'My template'
+steps:
+  - desc: 'Include the source files'
+    action: 'include'
+    params:
+      paths: ['src']`,
+			},
+			wantErr: `step "Include the source files" (action "include") failed: at line 8 column 15: glob "src" did not match any files`,
+		},
+		{
+			name: "failed_nested_step_is_named_in_error",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'My template'
+steps:
+  - desc: 'Replace in each file'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'file'
+        values: ['a.txt']
+      steps:
+        - desc: 'Replace the placeholder'
+          action: 'regex_replace'
+          params:
+            paths: ['{{.file}}']
+            replacements:
+              - regex: '(unclosed'
+                with: 'x'`,
+			},
+			wantErr: `step "Replace the placeholder" (action "regex_replace") failed: at line 17 column 24: failed compiling regex`,
+		},
 		{
 			name:       "print_only_flags_are_in_scope_for_print_actions",
 			flagInputs: map[string]string{},
@@ -1073,186 +1447,2620 @@ steps:
 			},
 		},
 		{
-			name: "independent_rule_validation_valid_rules",
-			templateContents: abctestutil.WithGitRepoAt("", map[string]string{
-				".git/refs/tags/v1.2.3": abctestutil.MinimalGitHeadSHA,
+			name: "extends_base_template",
+			flagInputs: map[string]string{
+				"service": "billing",
+			},
+			templateContents: map[string]string{
 				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
 kind: 'Template'
-desc: 'My template'
-
-rules:
-  - rule: 'int(2) < int(10)'
-    message: 'rule validation'
-
+desc: 'A Go service'
+extends: './base'
+inputs:
+  - name: 'owner'
+    desc: 'The owning team, overridden to have a default'
+    default: 'payments'
+  - name: 'service'
+    desc: 'The service name'
 steps:
-  - desc: 'print a message' 
-    action: 'print'
+  - desc: 'Include the Go files'
+    action: 'include'
     params:
-      message: 'rule validation passed'
+      paths: ['main.go']
+  - desc: 'Fill in the service name everywhere, including base template files'
+    action: 'string_replace'
+    params:
+      paths: ['.']
+      replacements:
+        - to_replace: 'SERVICE'
+          with: '{{.service}}'
 `,
-			}),
-			wantStdout:       "rule validation passed\n",
-			wantDestContents: map[string]string{},
-		},
-		{
-			name: "independent_rule_validation_invalid_rules",
-			templateContents: abctestutil.WithGitRepoAt("", map[string]string{
-				".git/refs/tags/v1.2.3": abctestutil.MinimalGitHeadSHA,
-				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+				"main.go": "package SERVICE\n",
+				"base/spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
 kind: 'Template'
-desc: 'My template'
+desc: 'The org-wide base template'
+inputs:
+  - name: 'owner'
+    desc: 'The owning team'
+rules:
+  - rule: 'size(owner) > 0'
+steps:
+  - desc: 'Include the common files'
+    action: 'include'
+    params:
+      paths: ['CODEOWNERS', 'README.md']
+  - desc: 'Set the owner'
+    action: 'string_replace'
+    params:
+      paths: ['CODEOWNERS']
+      replacements:
+        - to_replace: 'OWNER'
+          with: '{{.owner}}'
+`,
+				"base/CODEOWNERS": "* @OWNER\n",
+				"base/README.md":  "# SERVICE\n",
+			},
+			wantDestContents: map[string]string{
+				"CODEOWNERS": "* @payments\n",
+				"README.md":  "# billing\n",
+				"main.go":    "package billing\n",
+			},
+		},
+		{
+			name: "extends_cycle",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template that extends itself'
+extends: '.'
+`,
+			},
+			wantErr: `extends itself, directly or indirectly`,
+		},
+		{
+			name: "extends_missing_base",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template that extends nothing'
+extends: './nonexistent'
+`,
+			},
+			wantErr: `invalid "extends"`,
+		},
+		{
+			name: "rendered_paths_lists_files_from_previous_steps",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template that writes an index of its output'
+steps:
+  - desc: 'Print before including anything'
+    action: 'print'
+    params:
+      message: 'before: [{{._rendered_paths}}]'
+  - desc: 'Include some files'
+    action: 'include'
+    params:
+      paths: ['b.txt', 'dir/a.txt']
+  - desc: 'Include the index template'
+    action: 'include'
+    params:
+      paths: ['index.txt']
+  - desc: 'Write an index of the included files'
+    action: 'go_template'
+    if: '_rendered_paths.split("\n").size() == 3'
+    params:
+      paths: ['index.txt']
+`,
+				"b.txt":     "b",
+				"dir/a.txt": "a",
+				"index.txt": "{{range split ._rendered_paths \"\\n\"}}{{.}}\n{{end}}",
+			},
+			wantStdout: "before: []\n",
+			wantDestContents: map[string]string{
+				"b.txt":     "b",
+				"dir/a.txt": "a",
+				"index.txt": "b.txt\ndir/a.txt\nindex.txt\n",
+			},
+		},
+		{
+			name:       "vars_are_computed",
+			flagInputs: map[string]string{"service": "billing"},
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with derived vars'
+inputs:
+  - name: 'service'
+    desc: 'The service name'
+vars:
+  - name: 'image'
+    desc: 'The container image name'
+    value: '"gcr.io/my-project/" + service'
+  - name: 'image_with_tag'
+    value: 'image + ":latest"'
+rules:
+  - rule: 'image.startsWith("gcr.io/")'
+    message: 'images must be in gcr.io'
+steps:
+  - desc: 'Print the image'
+    action: 'print'
+    params:
+      message: '{{.image_with_tag}}'
+`,
+			},
+			wantStdout:       "gcr.io/my-project/billing:latest\n",
+			wantDestContents: map[string]string{},
+		},
+		{
+			name:         "vars_overridden_with_set_are_recorded_in_manifest",
+			flagInputs:   map[string]string{"service": "billing"},
+			flagSetVars:  map[string]string{"image": "gcr.io/other-project/billing"},
+			flagManifest: true,
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with derived vars'
+inputs:
+  - name: 'service'
+    desc: 'The service name'
+vars:
+  - name: 'image'
+    desc: 'The container image name'
+    value: '"gcr.io/my-project/" + service'
+  - name: 'image_with_tag'
+    value: 'image + ":latest"'
+rules:
+  - rule: 'image.startsWith("gcr.io/")'
+    message: 'images must be in gcr.io'
+steps:
+  - desc: 'Print the image'
+    action: 'print'
+    params:
+      message: '{{.image_with_tag}}'
+`,
+			},
+			wantStdout: "gcr.io/other-project/billing:latest\n",
+			wantDestContents: map[string]string{
+				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta5
+kind: Manifest
+creation_time: 2023-12-08T23:59:02.000000013Z
+modification_time: 2023-12-08T23:59:02.000000013Z
+template_location: ""
+location_type: ""
+template_version: ""
+template_dirhash: h1:bETYMDNAXKN+luFgeO+upZ+c72t+pybAJCDLJLnlNYE=
+inputs:
+    - name: service
+      value: billing
+var_overrides:
+    - name: image
+      value: gcr.io/other-project/billing
+output_hashes: []
+`,
+			},
+		},
+		{
+			name: "typed_inputs_are_typed_in_cel_and_recorded_in_manifest",
+			flagInputs: map[string]string{
+				"enabled":  "yes",
+				"replicas": "3",
+				"regions":  "us-east1,us-west1",
+			},
+			flagManifest: true,
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with typed inputs'
+inputs:
+  - name: 'enabled'
+    desc: 'Whether to print anything'
+    type: 'bool'
+  - name: 'replicas'
+    desc: 'The number of replicas'
+    type: 'int'
+    rules:
+      - rule: 'replicas > 0 && replicas <= 10'
+  - name: 'regions'
+    desc: 'The regions to deploy to'
+    type: 'list'
+steps:
+  - desc: 'Print a summary'
+    action: 'print'
+    if: 'enabled && size(regions) == 2'
+    params:
+      message: '{{.replicas}} replicas, enabled={{.enabled}}'
+  - desc: 'Print each region'
+    action: 'for_each'
+    if: 'enabled'
+    params:
+      iterator:
+        key: 'region'
+        values_from: 'regions'
+      steps:
+        - desc: 'Print the region'
+          action: 'print'
+          params:
+            message: '{{.region}}'
+`,
+			},
+			wantStdout: "3 replicas, enabled=true\nus-east1\nus-west1\n",
+			wantDestContents: map[string]string{
+				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta5
+kind: Manifest
+creation_time: 2023-12-08T23:59:02.000000013Z
+modification_time: 2023-12-08T23:59:02.000000013Z
+template_location: ""
+location_type: ""
+template_version: ""
+template_dirhash: h1:UxQsbZBKJpSy2/bIGsThwAykE2ljOT49Iy/Tg0sHTEU=
+inputs:
+    - name: enabled
+      value: "true"
+      type: bool
+    - name: regions
+      value: '["us-east1","us-west1"]'
+      type: list
+    - name: replicas
+      value: "3"
+      type: int
+output_hashes: []
+`,
+			},
+		},
+		{
+			name:       "default_from_computes_defaults",
+			flagInputs: map[string]string{"project_id": "my-project", "regions": "us-east1,us-west1"},
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with computed defaults'
+inputs:
+  - name: 'project_id'
+    desc: 'The project ID'
+  - name: 'regions'
+    desc: 'The regions to deploy to'
+    type: 'list'
+  - name: 'service_account'
+    desc: 'The service account name'
+    default_from: 'project_id + "-sa"'
+  - name: 'replicas'
+    desc: 'The number of replicas'
+    type: 'int'
+    default_from: 'size(regions) * 2'
+  - name: 'version'
+    desc: 'The version to deploy'
+    default_from: '_git_tag == "" ? "latest" : _git_tag'
+steps:
+  - desc: 'Print'
+    action: 'print'
+    if: 'replicas == 4'
+    params:
+      message: '{{.service_account}} {{.replicas}} {{.version}}'
+`,
+			},
+			wantStdout:       "my-project-sa 4 latest\n",
+			wantDestContents: map[string]string{},
+		},
+		{
+			name: "default_from_refers_to_missing_input",
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with computed defaults'
+inputs:
+  - name: 'project_id'
+    desc: 'The project ID'
+  - name: 'service_account'
+    desc: 'The service account name'
+    default_from: 'project_id + "-sa"'
+steps:
+  - desc: 'Print'
+    action: 'print'
+    params:
+      message: '{{.service_account}}'
+`,
+			},
+			wantErr: "missing input(s): project_id, service_account",
+		},
+		{
+			name:       "default_from_with_wrong_type",
+			flagInputs: map[string]string{"project_id": "my-project"},
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with computed defaults'
+inputs:
+  - name: 'project_id'
+    desc: 'The project ID'
+  - name: 'replicas'
+    desc: 'The number of replicas'
+    type: 'int'
+    default_from: 'project_id + "-sa"'
+steps:
+  - desc: 'Print'
+    action: 'print'
+    params:
+      message: '{{.replicas}}'
+`,
+			},
+			wantErr: `failed evaluating default_from of input "replicas"`,
+		},
+		{
+			name:       "input_constraint_violated",
+			flagInputs: map[string]string{"gcs_bucket": "my-bucket", "s3_bucket": "my-other-bucket"},
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with alternative inputs'
+inputs:
+  - name: 'gcs_bucket'
+    desc: 'The GCS bucket'
+    default: ''
+  - name: 's3_bucket'
+    desc: 'The S3 bucket'
+    default: ''
+input_constraints:
+  - one_of: ['gcs_bucket', 's3_bucket']
+    message: 'Choose one storage backend'
+steps:
+  - desc: 'Print'
+    action: 'print'
+    params:
+      message: 'hello'
+`,
+			},
+			wantErr: `input validation failed:
+at line 12 column 5: exactly one of the inputs "gcs_bucket", "s3_bucket" must be set, but "gcs_bucket", "s3_bucket" were: Choose one storage backend`,
+		},
+		{
+			name:         "pre_render_and_post_render",
+			flagManifest: true,
+			templateContents: map[string]string{
+				"config.json": `{"name":   "{{.name}}"}`,
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with hooks'
+inputs:
+  - name: 'name'
+    desc: 'The name'
+    default: 'alice'
+pre_render:
+  - desc: 'Say hello'
+    action: 'print'
+    params:
+      message: 'Rendering {{.name}}'
+steps:
+  - desc: 'Include the config'
+    action: 'include'
+    params:
+      paths: ['config.json']
+  - desc: 'Fill in the config'
+    action: 'go_template'
+    params:
+      paths: ['config.json']
+post_render:
+  - desc: 'Format the config in the destination'
+    action: 'format'
+    params:
+      paths: ['.']
+  - desc: 'Print the next steps'
+    action: 'print'
+    params:
+      message: 'Wrote {{._rendered_paths}}'
+`,
+			},
+			existingDestContents: map[string]string{
+				"unrelated.json": `{"a":   1}`,
+			},
+			wantStdout: "Rendering alice\nWrote config.json\n",
+			wantDestContents: map[string]string{
+				"config.json":    "{\n  \"name\": \"alice\"\n}\n",
+				"unrelated.json": `{"a":   1}`,
+				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc templates" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta5
+kind: Manifest
+creation_time: 2023-12-08T23:59:02.000000013Z
+modification_time: 2023-12-08T23:59:02.000000013Z
+template_location: ""
+location_type: ""
+template_version: ""
+template_dirhash: h1:dcvax9AQSZQHvyZ+kSZ3qULW4I8MklYCp0ILI2JNYPE=
+inputs:
+    - name: name
+      value: alice
+output_hashes:
+    - file: config.json
+      hash: h1:QjUSu5+Gq48fvFzUiuOJ50dKTDcK3fEP1P8EGTyk208=
+`,
+			},
+		},
+		{
+			name: "base_path",
+			templateContents: map[string]string{
+				"services/frontend/main.go":  "package {{.svc}}\n",
+				"services/frontend/app.yaml": "name: foo\n",
+				"services/backend/main.go":   "package foo\n",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with several services'
+inputs:
+  - name: 'svc'
+    desc: 'The service to modify'
+    default: 'frontend'
+steps:
+  - desc: 'Include the services'
+    action: 'include'
+    params:
+      paths: ['services']
+  - desc: 'Fill in the service'
+    action: 'go_template'
+    base_path: 'services/{{.svc}}'
+    params:
+      paths: ['main.go']
+  - desc: 'Rename the service'
+    action: 'for_each'
+    base_path: 'services'
+    params:
+      iterator:
+        key: 'dir'
+        values: ['frontend', 'backend']
+      steps:
+        - desc: 'Replace foo'
+          action: 'string_replace'
+          base_path: '{{.dir}}'
+          params:
+            paths: ['.']
+            replacements:
+              - to_replace: 'foo'
+                with: 'bar'
+`,
+			},
+			wantDestContents: map[string]string{
+				"services/frontend/main.go":  "package frontend\n",
+				"services/frontend/app.yaml": "name: bar\n",
+				"services/backend/main.go":   "package bar\n",
+			},
+		},
+		{
+			name: "double_star_and_negated_globs",
+			templateContents: map[string]string{
+				"src/main.go":       "foo",
+				"src/main_test.go":  "foo",
+				"src/sub/lib.go":    "foo",
+				"src/sub/README.md": "foo",
+				"src/gen/gen.go":    "foo",
+				"docs/index.md":     "foo",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template using globs'
+steps:
+  - desc: 'Include the sources'
+    action: 'include'
+    params:
+      paths: ['src/**', '!**/*_test.go', '!**/*.md']
+  - desc: 'Replace foo in the non-generated go files'
+    action: 'string_replace'
+    params:
+      paths: ['**/*.go', '!src/gen']
+      replacements:
+        - to_replace: 'foo'
+          with: 'bar'
+`,
+			},
+			wantDestContents: map[string]string{
+				"src/main.go":    "bar",
+				"src/sub/lib.go": "bar",
+				"src/gen/gen.go": "foo",
+			},
+		},
+		{
+			// Older api_versions keep the filepath.Match meaning of "**",
+			// which is the same as "*".
+			name: "double_star_glob_v1beta2",
+			templateContents: map[string]string{
+				"a/y.txt":   "foo",
+				"a/b/x.txt": "foo",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta2'
+kind: 'Template'
+desc: 'A template using a double star glob'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['a']
+  - desc: 'Replace foo in text files'
+    action: 'string_replace'
+    params:
+      paths: ['**/*.txt']
+      replacements:
+        - to_replace: 'foo'
+          with: 'bar'
+`,
+			},
+			wantDestContents: map[string]string{
+				"a/y.txt":   "bar",
+				"a/b/x.txt": "foo",
+			},
+		},
+		{
+			// Older api_versions keep the filepath.Match meaning of "**",
+			// which is the same as "*".
+			name: "double_star_glob_v1beta3",
+			templateContents: map[string]string{
+				"a/y.txt":   "foo",
+				"a/b/x.txt": "foo",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta3'
+kind: 'Template'
+desc: 'A template using a double star glob'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['a']
+  - desc: 'Replace foo in text files'
+    action: 'string_replace'
+    params:
+      paths: ['**/*.txt']
+      replacements:
+        - to_replace: 'foo'
+          with: 'bar'
+`,
+			},
+			wantDestContents: map[string]string{
+				"a/y.txt":   "bar",
+				"a/b/x.txt": "foo",
+			},
+		},
+		{
+			// "**" matches any number of directories.
+			name: "double_star_glob_v1beta4",
+			templateContents: map[string]string{
+				"a/y.txt":   "foo",
+				"a/b/x.txt": "foo",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template using a double star glob'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['a']
+  - desc: 'Replace foo in text files'
+    action: 'string_replace'
+    params:
+      paths: ['**/*.txt']
+      replacements:
+        - to_replace: 'foo'
+          with: 'bar'
+`,
+			},
+			wantDestContents: map[string]string{
+				"a/y.txt":   "bar",
+				"a/b/x.txt": "bar",
+			},
+		},
+		{
+			// "**" matches any number of directories.
+			name: "double_star_glob_v1beta5",
+			templateContents: map[string]string{
+				"a/y.txt":   "foo",
+				"a/b/x.txt": "foo",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta5'
+kind: 'Template'
+desc: 'A template using a double star glob'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['a']
+  - desc: 'Replace foo in text files'
+    action: 'string_replace'
+    params:
+      paths: ['**/*.txt']
+      replacements:
+        - to_replace: 'foo'
+          with: 'bar'
+`,
+			},
+			wantDestContents: map[string]string{
+				"a/y.txt":   "bar",
+				"a/b/x.txt": "bar",
+			},
+		},
+		{
+			name: "path_with_no_files_is_an_error",
+			templateContents: map[string]string{
+				"a.txt":  "foo",
+				"b/c.md": "foo",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']
+  - desc: 'Replace foo'
+    action: 'string_replace'
+    params:
+      paths: ['a.txt', 'b', '!**/*.md']
+      replacements:
+        - to_replace: 'foo'
+          with: 'bar'
+`,
+			},
+			wantErr: `at line 12 column 24: path "b" did not match any files`,
+		},
+		{
+			name:               "path_with_no_files_is_allowed_with_flag",
+			flagAllowUnmatched: true,
+			templateContents: map[string]string{
+				"a.txt":  "foo",
+				"b/c.md": "foo",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']
+  - desc: 'Replace foo'
+    action: 'string_replace'
+    params:
+      paths: ['a.txt', 'b', 'nonexistent*.txt', '!**/*.md']
+      replacements:
+        - to_replace: 'foo'
+          with: 'bar'
+`,
+			},
+			wantDestContents: map[string]string{
+				"a.txt":  "bar",
+				"b/c.md": "foo",
+			},
+		},
+		{
+			name: "base_path_outside_scratch_dir",
+			templateContents: map[string]string{
+				"file.txt": "hello",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    base_path: '../..'
+    params:
+      paths: ['file.txt']
+`,
+			},
+			wantErr: `step "Include a file" (action "include") failed`,
+		},
+		{
+			name:       "typed_input_with_invalid_value",
+			flagInputs: map[string]string{"replicas": "three"},
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with typed inputs'
+inputs:
+  - name: 'replicas'
+    desc: 'The number of replicas'
+    type: 'int'
+steps:
+  - desc: 'Print'
+    action: 'print'
+    params:
+      message: '{{.replicas}}'
+`,
+			},
+			wantErr: `invalid value for input "replicas" of type int: "three" isn't an int`,
+		},
+		{
+			name:        "overridden_vars_are_checked_by_rules",
+			flagInputs:  map[string]string{"service": "billing"},
+			flagSetVars: map[string]string{"image": "docker.io/billing"},
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with derived vars'
+inputs:
+  - name: 'service'
+    desc: 'The service name'
+vars:
+  - name: 'image'
+    desc: 'The container image name'
+    value: '"gcr.io/my-project/" + service'
+  - name: 'image_with_tag'
+    value: 'image + ":latest"'
+rules:
+  - rule: 'image.startsWith("gcr.io/")'
+    message: 'images must be in gcr.io'
+steps:
+  - desc: 'Print the image'
+    action: 'print'
+    params:
+      message: '{{.image_with_tag}}'
+`,
+			},
+			wantErr: "images must be in gcr.io",
+		},
+		{
+			name:        "set_unknown_var",
+			flagInputs:  map[string]string{"service": "billing"},
+			flagSetVars: map[string]string{"service": "x", "nope": "y"},
+			templateContents: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with derived vars'
+inputs:
+  - name: 'service'
+    desc: 'The service name'
+vars:
+  - name: 'image'
+    desc: 'The container image name'
+    value: '"gcr.io/my-project/" + service'
+  - name: 'image_with_tag'
+    value: 'image + ":latest"'
+rules:
+  - rule: 'image.startsWith("gcr.io/")'
+    message: 'images must be in gcr.io'
+steps:
+  - desc: 'Print the image'
+    action: 'print'
+    params:
+      message: '{{.image_with_tag}}'
+`,
+			},
+			wantErr: "--set can only override the template's vars [image image_with_tag], but got unknown name(s) [nope service]",
+		},
+		{
+			name: "independent_rule_validation_valid_rules",
+			templateContents: abctestutil.WithGitRepoAt("", map[string]string{
+				".git/refs/tags/v1.2.3": abctestutil.MinimalGitHeadSHA,
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'My template'
+
+rules:
+  - rule: 'int(2) < int(10)'
+    message: 'rule validation'
+
+steps:
+  - desc: 'print a message' 
+    action: 'print'
+    params:
+      message: 'rule validation passed'
+`,
+			}),
+			wantStdout:       "rule validation passed\n",
+			wantDestContents: map[string]string{},
+		},
+		{
+			name: "independent_rule_validation_invalid_rules",
+			templateContents: abctestutil.WithGitRepoAt("", map[string]string{
+				".git/refs/tags/v1.2.3": abctestutil.MinimalGitHeadSHA,
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'My template'
+
+rules:
+  - rule: 'int(2) > int(10)'
+    message: 'invalid rule: 2 cannot be greater than 10'
+  - rule: '"abc".startsWith("z")'
+    message: 'invalid rule: abc does not start with z'
+
+steps:
+  - desc: 'print a message' 
+    action: 'print'
+    params:
+      message: 'rule validation passed'
+`,
+			}),
+			wantErr: "rules validation failed:\n\nRule:      int(2) > int(10)\nRule msg:  invalid rule: 2 cannot be greater than 10\n\nRule:      \"abc\".startsWith(\"z\")\nRule msg:  invalid rule: abc does not start with z\n",
+		},
+		{
+			name: "independent_rule_validation_built_in_vars_in_scope",
+			templateContents: abctestutil.WithGitRepoAt("", map[string]string{
+				".git/refs/tags/v1.2.3": abctestutil.MinimalGitHeadSHA,
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'My template'
+
+rules:
+  - rule: '_git_sha == "ahl8foqboh8ktqzxnymuvdcg91hvim0cfszlcstl"'
+    message: 'git sha must have specific value'
+  - rule: '_git_short_sha == "ahl8foq"'
+    message: 'git short sha must have specific value'
+  - rule: '_git_tag == "v1.2.3"'
+    message: 'git tag must have specific value'
+
+steps:
+  - desc: 'print a message' 
+    action: 'print'
+    params:
+      message: |-
+        git sha: {{._git_sha}}
+        git short sha: {{._git_short_sha}}
+        git tag: {{._git_tag}}
+`,
+			}),
+			overrideBuiltinVars: map[string]string{
+				"_git_sha":       "ahl8foqboh8ktqzxnymuvdcg91hvim0cfszlcstl",
+				"_git_short_sha": "ahl8foq",
+				"_git_tag":       "v1.2.3",
+			},
+			wantStdout:       "git sha: ahl8foqboh8ktqzxnymuvdcg91hvim0cfszlcstl\ngit short sha: ahl8foq\ngit tag: v1.2.3\n",
+			wantDestContents: map[string]string{},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			abctestutil.WriteAllDefaultMode(t, dest, tc.existingDestContents)
+
+			inputFilePaths := make([]string, 0, len(tc.inputFileNames))
+			for _, f := range tc.inputFileNames {
+				inputFileDir := filepath.Join(tempDir, "inputs")
+				abctestutil.WriteAllDefaultMode(t, inputFileDir, map[string]string{f: tc.inputFileContents[f]})
+				inputFilePaths = append(inputFilePaths, filepath.Join(inputFileDir, f))
+			}
+
+			backupDir := filepath.Join(tempDir, "backups")
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, tc.templateContents)
+			rfs := &common.RealFS{}
+			stdoutBuf := &strings.Builder{}
+			p := &Params{
+				AllowUnmatchedPaths: tc.flagAllowUnmatched,
+				Backups:             true,
+				BackupDir:           backupDir,
+				Clock:               clk,
+				DestDir:             dest,
+				Downloader:          &templatesource.LocalDownloader{SrcPath: sourceDir},
+				ForceOverwrite:      tc.flagForceOverwrite,
+				Inputs:              tc.flagInputs,
+				InputFiles:          inputFilePaths,
+				KeepTempDirs:        tc.flagKeepTempDirs,
+				Manifest:            tc.flagManifest,
+				OverrideBuiltinVars: tc.overrideBuiltinVars,
+				SkipInputValidation: tc.flagSkipInputValidation,
+				DebugStepDiffs:      tc.flagDebugStepDiffs,
+				SetVars:             tc.flagSetVars,
+				SourceForMessages:   sourceDir,
+				StrictAPIVersion:    tc.flagStrictAPIVersion,
+				FS: &common.ErrorFS{
+					FS:           rfs,
+					RemoveAllErr: tc.removeAllErr,
+				},
+				Stdout:      stdoutBuf,
+				TempDirBase: tempDir,
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, p)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if err != nil {
+				errStr := err.Error()
+				if strings.Count(errStr, "at line ") > 1 {
+					t.Errorf(`this error message reported the "at line" location more than once: %q`, errStr)
+				}
+			}
+
+			if diff := cmp.Diff(stdoutBuf.String(), tc.wantStdout); diff != "" {
+				t.Errorf("template output was not as expected; (-got,+want): %s", diff)
+			}
+
+			var gotTemplateContents map[string]string
+			templateDir, ok := abctestutil.TestMustGlob(t, filepath.Join(tempDir, tempdir.TemplateDirNamePart+"*")) // the * accounts for the random cookie added by mkdirtemp
+			if ok {
+				gotTemplateContents = abctestutil.LoadDirWithoutMode(t, templateDir)
+			}
+			if diff := cmp.Diff(gotTemplateContents, tc.wantTemplateContents); diff != "" {
+				t.Errorf("template directory contents were not as expected (-got,+want): %s", diff)
+			}
+
+			var gotScratchContents map[string]string
+			scratchDir, ok := abctestutil.TestMustGlob(t, filepath.Join(tempDir, tempdir.ScratchDirNamePart+"*"))
+			if ok {
+				gotScratchContents = abctestutil.LoadDirWithoutMode(t, scratchDir)
+			}
+			if diff := cmp.Diff(gotScratchContents, tc.wantScratchContents, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %s", diff)
+			}
+
+			gotDestContents := abctestutil.LoadDirWithoutMode(t, dest)
+			if diff := cmp.Diff(gotDestContents, tc.wantDestContents); diff != "" {
+				t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
+			}
+
+			var gotBackupContents map[string]string
+			backupSubdir, ok := abctestutil.TestMustGlob(t, filepath.Join(backupDir, "*")) // When a backup directory is created, an unpredictable timestamp is added, hence the "*"
+			if ok {
+				gotBackupContents = abctestutil.LoadDirWithoutMode(t, backupSubdir)
+			}
+			if diff := cmp.Diff(gotBackupContents, tc.wantBackupContents, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("backups directory contents were not as expected (-got,+want): %s", diff)
+			}
+
+			var gotDebugContents map[string]string
+			debugDir, ok := abctestutil.TestMustGlob(t, filepath.Join(tempDir, tempdir.DebugStepDiffsDirNamePart+"*"))
+			if ok {
+				gotDebugContents = abctestutil.LoadDirWithoutMode(t, debugDir)
+			}
+			gotDebugDirExists := len(gotDebugContents) > 0
+			if tc.flagDebugStepDiffs != gotDebugDirExists {
+				t.Errorf("debug directory existence is %t but should be %t", gotDebugDirExists, tc.flagDebugStepDiffs)
+			}
+		})
+	}
+}
+
+func TestRender_Symlinks(t *testing.T) {
+	t.Parallel()
+
+	template := abctestutil.Tree{
+		"spec.yaml": abctestutil.File(`api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template containing symlinks'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']
+  - desc: 'Modify every file'
+    action: 'string_replace'
+    params:
+      paths: ['.']
+      replacements:
+        - to_replace: 'hello'
+          with: 'goodbye'`),
+		"a.txt":      abctestutil.File("hello"),
+		"link.txt":   abctestutil.Symlink("a.txt"),
+		"dir/up.txt": abctestutil.Symlink("../a.txt"),
+	}
+
+	cases := []struct {
+		name     string
+		symlinks common.SymlinkMode
+		wantDest abctestutil.Tree
+		wantErr  string
+	}{
+		{
+			name: "follow_by_default",
+			wantDest: abctestutil.Tree{
+				"a.txt":      abctestutil.File("goodbye"),
+				"link.txt":   abctestutil.File("goodbye"),
+				"dir/up.txt": abctestutil.File("goodbye"),
+			},
+		},
+		{
+			name:     "preserve",
+			symlinks: common.SymlinksPreserve,
+			wantDest: abctestutil.Tree{
+				"a.txt":      abctestutil.File("goodbye"),
+				"link.txt":   abctestutil.Symlink("a.txt"),
+				"dir/up.txt": abctestutil.Symlink("../a.txt"),
+			},
+		},
+		{
+			name:     "reject",
+			symlinks: common.SymlinksReject,
+			wantErr:  "is a symlink, which isn't allowed",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteTree(t, sourceDir, template)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir, Symlinks: tc.symlinks},
+				FS:                &common.RealFS{},
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				Symlinks:          tc.symlinks,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(abctestutil.LoadTree(t, dest), tc.wantDest); diff != "" {
+				t.Errorf("dest directory was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_EmptyDirs(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	dest := filepath.Join(tempDir, "dest")
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteTree(t, sourceDir, abctestutil.Tree{
+		"spec.yaml": abctestutil.File(`api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template containing empty directories'
+steps:
+  - desc: 'Include empty directories'
+    action: 'include'
+    params:
+      paths:
+        - paths: ['a.txt', 'empty', 'nested']
+        - paths: ['empty']
+          as: ['renamed']
+        - paths: ['not_empty']
+          skip: ['not_empty/skip.txt']`),
+		"a.txt":              abctestutil.File("hello"),
+		"not_empty/skip.txt": abctestutil.File("skipped"),
+		"empty":              abctestutil.EmptyDir(),
+		"nested/empty":       abctestutil.EmptyDir(),
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		DestDir:           dest,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "not_empty" isn't created, because its only file was skipped.
+	wantDest := abctestutil.Tree{
+		"a.txt":        abctestutil.File("hello"),
+		"empty":        abctestutil.EmptyDir(),
+		"nested/empty": abctestutil.EmptyDir(),
+		"renamed":      abctestutil.EmptyDir(),
+	}
+	if diff := cmp.Diff(abctestutil.LoadTree(t, dest), wantDest); diff != "" {
+		t.Errorf("dest directory was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestRender_EmptyDirPathInModifyingAction(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		apiVersion string
+		wantErr    string
+	}{
+		{
+			// Older api_versions only log a warning.
+			apiVersion: "cli.abcxyz.dev/v1beta3",
+		},
+		{
+			apiVersion: "cli.abcxyz.dev/v1beta4",
+			wantErr:    `path "empty" did not match any files`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.apiVersion, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteTree(t, sourceDir, abctestutil.Tree{
+				"spec.yaml": abctestutil.File(`api_version: '` + tc.apiVersion + `'
+kind: 'Template'
+desc: 'A template that modifies an empty directory'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'empty']
+  - desc: 'Replace foo'
+    action: 'string_replace'
+    params:
+      paths: ['a.txt', 'empty']
+      replacements:
+        - to_replace: 'foo'
+          with: 'bar'`),
+				"a.txt": abctestutil.File("foo"),
+				"empty": abctestutil.EmptyDir(),
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			wantDest := abctestutil.Tree{
+				"a.txt": abctestutil.File("bar"),
+				"empty": abctestutil.EmptyDir(),
+			}
+			if diff := cmp.Diff(abctestutil.LoadTree(t, dest), wantDest); diff != "" {
+				t.Errorf("dest directory was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_DebugScope(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	dest := filepath.Join(tempDir, "dest")
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with a for_each'
+inputs:
+  - name: 'replicas'
+    desc: 'The number of replicas'
+    type: 'int'
+steps:
+  - desc: 'Print each environment'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'env'
+        values: ['dev', 'prod']
+      steps:
+        - desc: 'Print the environment'
+          action: 'print'
+          params:
+            message: '{{.env}}'`,
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	var got strings.Builder
+	err := Render(ctx, &Params{
+		Clock:               clock.NewMock(),
+		DebugScope:          &got,
+		DestDir:             dest,
+		Downloader:          &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                  &common.RealFS{},
+		Inputs:              map[string]string{"replicas": "3"},
+		OverrideBuiltinVars: map[string]string{"_git_tag": "v1.2.3", "_flag_dest": "my-dest"},
+		SourceForMessages:   sourceDir,
+		Stdout:              io.Discard,
+		TempDirBase:         tempDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `---
+action: for_each
+desc: Print each environment
+line: 9
+scope:
+    _git_tag: v1.2.3
+    _rendered_paths: ""
+    replicas: "3"
+types:
+    replicas: int
+---
+action: print
+desc: Print the environment
+line: 16
+scope:
+    _flag_dest: my-dest
+    _git_tag: v1.2.3
+    _rendered_paths: ""
+    env: dev
+    replicas: "3"
+types:
+    replicas: int
+---
+action: print
+desc: Print the environment
+line: 16
+scope:
+    _flag_dest: my-dest
+    _git_tag: v1.2.3
+    _rendered_paths: ""
+    env: prod
+    replicas: "3"
+types:
+    replicas: int
+`
+	if diff := cmp.Diff(got.String(), want); diff != "" {
+		t.Errorf("--debug-scope output was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestRender_Events(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	dest := filepath.Join(tempDir, "dest")
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteTree(t, sourceDir, abctestutil.Tree{
+		"spec.yaml": abctestutil.File(`api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with steps in every phase'
+pre_render:
+  - desc: 'Say hello'
+    action: 'print'
+    params:
+      message: 'hello'
+steps:
+  - desc: 'Include the files'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'b.txt']
+  - desc: 'Print twice'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'x'
+        values: ['1', '2']
+      steps:
+        - desc: 'Nested steps do not send events'
+          action: 'print'
+          params:
+            message: '{{.x}}'
+post_render:
+  - desc: 'Say goodbye'
+    action: 'print'
+    params:
+      message: 'goodbye'
+`),
+		"a.txt": abctestutil.File("a"),
+		"b.txt": abctestutil.File("b"),
+	})
+	abctestutil.WriteTree(t, dest, abctestutil.Tree{
+		"a.txt": abctestutil.File("old a"),
+	})
+
+	var got []*Event
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		DestDir:           dest,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		ForceOverwrite:    true,
+		FS:                &common.RealFS{},
+		OnEvent:           func(e *Event) { got = append(got, e) },
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Event{
+		{Type: EventDownloadStarted, Source: sourceDir},
+		{Type: EventDownloadFinished, Source: sourceDir},
+		{Type: EventStepStarted, Phase: PhasePreRender, Step: 1, StepCount: 1, Action: "print"},
+		{Type: EventStepStarted, Phase: PhaseSteps, Step: 1, StepCount: 2, Action: "include"},
+		{Type: EventStepStarted, Phase: PhaseSteps, Step: 2, StepCount: 2, Action: "for_each"},
+		{Type: EventConflict, Path: "a.txt", Overwrite: true},
+		{Type: EventFileWritten, Path: "a.txt"},
+		{Type: EventFileWritten, Path: "b.txt"},
+		{Type: EventStepStarted, Phase: PhasePostRender, Step: 1, StepCount: 1, Action: "print"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("events were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestRender_Policies(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		policies []policy.Checker
+		wantDest map[string]string
+		wantErr  string
+	}{
+		{
+			name: "no_violations",
+			policies: []policy.Checker{
+				&policy.File{RequiredFiles: []string{"CODEOWNERS"}, RequiredInputs: []string{"owner"}},
+			},
+			wantDest: map[string]string{
+				"CODEOWNERS":   "* @alice\n",
+				"src/main.go":  "package main\n",
+				"existing.txt": "old",
+			},
+		},
+		{
+			name: "violation_writes_nothing",
+			policies: []policy.Checker{
+				&policy.File{ForbiddenFiles: []string{"**/*.go"}},
+				policy.CheckerFunc(func(ctx context.Context, in *policy.Input) ([]*policy.Violation, error) {
+					if in.Inputs["owner"] != "alice" {
+						return nil, fmt.Errorf("unexpected inputs %v", in.Inputs)
+					}
+					if want := []string{"CODEOWNERS", "src/main.go"}; !slices.Equal(in.Files, want) {
+						return nil, fmt.Errorf("got files %v, want %v", in.Files, want)
+					}
+					return []*policy.Violation{{Policy: "custom", Message: "no go allowed"}}, nil
+				}),
+			},
+			wantDest: map[string]string{
+				"existing.txt": "old",
+			},
+			wantErr: `file "src/main.go" is forbidden by "**/*.go"` + "\n  custom: no go allowed",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'owner'
+    desc: 'the owner'
+steps:
+  - desc: 'Include the files'
+    action: 'include'
+    params:
+      paths: ['CODEOWNERS', 'src']
+  - desc: 'Set the owner'
+    action: 'go_template'
+    params:
+      paths: ['CODEOWNERS']
+`,
+				"CODEOWNERS":  "* @{{.owner}}\n",
+				"src/main.go": "package main\n",
+			})
+			abctestutil.WriteAllDefaultMode(t, dest, map[string]string{"existing.txt": "old"})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				Inputs:            map[string]string{"owner": "alice"},
+				Policies:          tc.policies,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.wantErr != "" && !errors.Is(err, errs.ErrPolicyViolation) {
+				t.Errorf("got error %v, want one that's an ErrPolicyViolation", err)
+			}
+
+			got := abctestutil.LoadDirWithoutMode(t, dest)
+			if diff := cmp.Diff(got, tc.wantDest); diff != "" {
+				t.Errorf("destination was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_AuditLog(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		inputs map[string]string
+		want   *audit.Entry
+	}{
+		{
+			name:   "success",
+			inputs: map[string]string{"name": "alice"},
+			want: &audit.Entry{
+				Command:    audit.CommandRender,
+				InputsHash: audit.HashInputs(map[string]string{"name": "alice"}),
+				Outcome:    audit.OutcomeSuccess,
+			},
+		},
+		{
+			name: "failure_before_inputs_are_known",
+			want: &audit.Entry{
+				Command: audit.CommandRender,
+				Outcome: audit.OutcomeFailure,
+				Error:   "missing input(s): name",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			auditLog := filepath.Join(tempDir, "audit", "audit.jsonl")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'name'
+    desc: 'a name'
+steps:
+  - desc: 'Include the file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+				"a.txt": "a",
+			})
+
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			renderErr := Render(ctx, &Params{
+				AuditLog:          auditLog,
+				Clock:             clk,
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				Inputs:            tc.inputs,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(renderErr, tc.want.Error); diff != "" {
+				t.Error(diff)
+			}
+
+			got, err := audit.Read(&common.RealFS{}, auditLog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := *tc.want
+			want.Time = clk.Now().UTC()
+			want.User = audit.CurrentUser()
+			want.Source = sourceDir
+			want.Dest = dest
+			want.ABCVersion = version.Version
+			if renderErr != nil {
+				// The whole message, including line numbers, is recorded.
+				want.Error = renderErr.Error()
+			}
+			if diff := cmp.Diff(got, []*audit.Entry{&want}); diff != "" {
+				t.Errorf("audit log was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_LineEndings(t *testing.T) {
+	t.Parallel()
+
+	specWith := func(extra string) string {
+		return `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with mixed line endings'
+` + extra + `
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']`
+	}
+	files := map[string]string{
+		"text.txt":   "\xef\xbb\xbfone\r\ntwo\n",
+		"binary.bin": "\x00one\r\ntwo\n",
+	}
+
+	cases := []struct {
+		name        string
+		specExtra   string
+		lineEndings common.LineEndings
+		stripBOM    bool
+		want        map[string]string
+	}{
+		{
+			name: "preserve_by_default",
+			want: map[string]string{
+				"text.txt":   "\xef\xbb\xbfone\r\ntwo\n",
+				"binary.bin": "\x00one\r\ntwo\n",
+			},
+		},
+		{
+			name:      "spec_crlf_and_strip_bom",
+			specExtra: "line_endings: 'crlf'\nstrip_bom: true",
+			want: map[string]string{
+				"text.txt":   "one\r\ntwo\r\n",
+				"binary.bin": "\x00one\r\ntwo\n",
+			},
+		},
+		{
+			name:        "flags_override_spec",
+			specExtra:   "line_endings: 'crlf'",
+			lineEndings: common.LineEndingsLF,
+			stripBOM:    true,
+			want: map[string]string{
+				"text.txt":   "one\ntwo\n",
+				"binary.bin": "\x00one\r\ntwo\n",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			templateContents := maps.Clone(files)
+			templateContents["spec.yaml"] = specWith(tc.specExtra)
+			abctestutil.WriteAllDefaultMode(t, sourceDir, templateContents)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				LineEndings:       tc.lineEndings,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				StripBOM:          tc.stripBOM,
+				TempDirBase:       tempDir,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, dest), tc.want); diff != "" {
+				t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_GeneratedMarker(t *testing.T) {
+	t.Parallel()
+
+	specWith := func(extra string) string {
+		return `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template whose output may be marked as generated'
+skip_if_exists: ['config.yaml']
+skip_generated_marker: ['docs/**']
+` + extra + `
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']`
+	}
+	files := map[string]string{
+		"main.go":        "package main\n",
+		"run.sh":         "#!/bin/sh\necho hi\n",
+		"config.yaml":    "replicas: 1\n",
+		"data.json":      "{}\n",
+		"docs/README.md": "# Hi\n",
+	}
+	marked := map[string]string{
+		"main.go":        "// Code generated by abc. DO NOT EDIT.\n\npackage main\n",
+		"run.sh":         "#!/bin/sh\n# Code generated by abc. DO NOT EDIT.\n\necho hi\n",
+		"config.yaml":    "replicas: 1\n",
+		"data.json":      "{}\n",
+		"docs/README.md": "# Hi\n",
+	}
+
+	cases := []struct {
+		name            string
+		specExtra       string
+		generatedMarker bool
+		want            map[string]string
+	}{
+		{
+			name: "unmarked_by_default",
+			want: files,
+		},
+		{
+			name:      "spec",
+			specExtra: "generated_marker: true",
+			want:      marked,
+		},
+		{
+			name:            "flag",
+			generatedMarker: true,
+			want:            marked,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			templateContents := maps.Clone(files)
+			templateContents["spec.yaml"] = specWith(tc.specExtra)
+			abctestutil.WriteAllDefaultMode(t, sourceDir, templateContents)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				GeneratedMarker:   tc.generatedMarker,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, dest), tc.want); diff != "" {
+				t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_EnvVars(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"MY_PROJECT": "my-project",
+		"SECRET":     "hunter2",
+	}
+
+	cases := []struct {
+		name                string
+		message             string
+		noLookupEnv         bool
+		overrideBuiltinVars map[string]string
+		wantStdout          string
+		wantErr             string
+	}{
+		{
+			name:       "declared_vars_are_read",
+			message:    "project={{._env_MY_PROJECT}} unset={{._env_UNSET}}",
+			wantStdout: "project=my-project unset=\n",
+		},
+		{
+			name:    "undeclared_var_is_not_in_scope",
+			message: "{{._env_SECRET}}",
+			wantErr: `the template referenced a nonexistent variable name "_env_SECRET"`,
+		},
+		{
+			name:                "overridden_builtins_dont_read_the_environment",
+			message:             "project={{._env_MY_PROJECT}} unset={{._env_UNSET}}",
+			overrideBuiltinVars: map[string]string{"_env_UNSET": "stubbed"},
+			wantStdout:          "project= unset=stubbed\n",
+		},
+		{
+			name:        "no_environment_without_lookup_env",
+			message:     "project={{._env_MY_PROJECT}} unset={{._env_UNSET}}",
+			noLookupEnv: true,
+			wantStdout:  "project= unset=\n",
+		},
+		{
+			name:                "undeclared_var_cant_be_overridden",
+			message:             "hello",
+			overrideBuiltinVars: map[string]string{"_env_SECRET": "stubbed"},
+			wantErr:             "these builtin override var names are unknown and therefore invalid: [_env_SECRET]",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template that reads environment variables'
+env_vars: ['MY_PROJECT', 'UNSET']
+steps:
+  - desc: 'Print a message'
+    action: 'print'
+    params:
+      message: '` + tc.message + `'`,
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			var stdout strings.Builder
+			lookupEnv := func(name string) (string, bool) {
+				v, ok := env[name]
+				return v, ok
+			}
+			if tc.noLookupEnv {
+				lookupEnv = nil
+			}
+			err := Render(ctx, &Params{
+				Clock:               clock.NewMock(),
+				DestDir:             dest,
+				Downloader:          &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                  &common.RealFS{},
+				LookupEnv:           lookupEnv,
+				OverrideBuiltinVars: tc.overrideBuiltinVars,
+				SourceForMessages:   sourceDir,
+				Stdout:              &stdout,
+				TempDirBase:         tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got := stdout.String(); got != tc.wantStdout {
+				t.Errorf("got stdout %q, want %q", got, tc.wantStdout)
+			}
+		})
+	}
+}
+
+func TestRender_FileModes(t *testing.T) {
+	t.Parallel()
+
+	specWith := func(extra string) string {
+		return `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with a script'
+` + extra + `
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']`
+	}
+	// Like a template authored on Windows, no file is executable, and the
+	// modes are whatever the download left them as.
+	files := map[string]abctestutil.ModeAndContents{
+		"run.sh":     {Mode: 0o600, Contents: "echo hello"},
+		"config.txt": {Mode: 0o600, Contents: "config"},
+	}
+
+	cases := []struct {
+		name         string
+		specExtra    string
+		fileModes    common.FileModes
+		existingDest map[string]abctestutil.ModeAndContents
+		want         map[string]abctestutil.ModeAndContents
+	}{
+		{
+			name: "preserve_by_default",
+			want: map[string]abctestutil.ModeAndContents{
+				"run.sh":     {Mode: 0o600, Contents: "echo hello"},
+				"config.txt": {Mode: 0o600, Contents: "config"},
+			},
+		},
+		{
+			name:      "executable_with_preserve",
+			specExtra: "executable: ['*.sh']",
+			want: map[string]abctestutil.ModeAndContents{
+				"run.sh":     {Mode: 0o700, Contents: "echo hello"},
+				"config.txt": {Mode: 0o600, Contents: "config"},
+			},
+		},
+		{
+			name:      "normalize",
+			specExtra: "file_modes: 'normalize'\nexecutable: ['*.sh']",
+			want: map[string]abctestutil.ModeAndContents{
+				"run.sh":     {Mode: common.ExecutableFileMode, Contents: "echo hello"},
+				"config.txt": {Mode: common.NormalFileMode, Contents: "config"},
+			},
+		},
+		{
+			name:      "flag_overrides_spec",
+			specExtra: "file_modes: 'preserve'",
+			fileModes: common.FileModesNormalize,
+			want: map[string]abctestutil.ModeAndContents{
+				"run.sh":     {Mode: common.NormalFileMode, Contents: "echo hello"},
+				"config.txt": {Mode: common.NormalFileMode, Contents: "config"},
+			},
+		},
+		{
+			name:      "existing_file_gets_the_mode",
+			specExtra: "file_modes: 'normalize'\nexecutable: ['*.sh']",
+			existingDest: map[string]abctestutil.ModeAndContents{
+				"run.sh": {Mode: 0o600, Contents: "echo old"},
+			},
+			want: map[string]abctestutil.ModeAndContents{
+				"run.sh":     {Mode: common.ExecutableFileMode, Contents: "echo hello"},
+				"config.txt": {Mode: common.NormalFileMode, Contents: "config"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			templateContents := maps.Clone(files)
+			templateContents["spec.yaml"] = abctestutil.ModeAndContents{Mode: 0o600, Contents: specWith(tc.specExtra)}
+			abctestutil.WriteAll(t, sourceDir, templateContents)
+			abctestutil.WriteAll(t, dest, tc.existingDest)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, &Params{
+				BackupDir:         filepath.Join(tempDir, "backups"),
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FileModes:         tc.fileModes,
+				ForceOverwrite:    true,
+				FS:                &common.RealFS{},
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(abctestutil.LoadDirContents(t, dest), tc.want); diff != "" {
+				t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_Chown(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	dest := filepath.Join(tempDir, "dest")
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'new_dir', 'existing_dir']`,
+		"a.txt":                  "a",
+		"new_dir/nested/b.txt":   "b",
+		"existing_dir/c.txt":     "c",
+		"existing_dir/other.txt": "skipped",
+	})
+	abctestutil.WriteAllDefaultMode(t, dest, map[string]string{
+		"existing_dir/other.txt": "kept",
+	})
+
+	fs := &chownRecorderFS{FS: &common.RealFS{}, owners: map[string]common.Owner{}}
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	err := Render(ctx, &Params{
+		Chown:             &common.Owner{UID: 1000, GID: -1},
+		Clock:             clock.NewMock(),
+		DestDir:           dest,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                fs,
+		Manifest:          true,
+		OnConflict:        ConflictKeep,
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The destination and existing_dir existed already, and
+	// existing_dir/other.txt was kept, so they keep their owners.
+	owner := common.Owner{UID: 1000, GID: -1}
+	want := map[string]common.Owner{
+		".abc": owner,
+		".abc/manifest_nolocation_1970-01-01T00:00:00Z.lock.yaml": owner,
+		"a.txt":                owner,
+		"existing_dir/c.txt":   owner,
+		"new_dir":              owner,
+		"new_dir/nested":       owner,
+		"new_dir/nested/b.txt": owner,
+	}
+	got := map[string]common.Owner{}
+	for path, o := range fs.owners {
+		rel, err := filepath.Rel(dest, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[filepath.ToSlash(rel)] = o
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("owners were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestRender_ChownUnsupported(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	err := Render(ctx, &Params{
+		Chown: &common.Owner{UID: 1000, GID: 1000},
+		FS:    &common.ErrorFS{FS: &common.RealFS{}},
+	})
+	if diff := testutil.DiffErrString(err, "changing the owner of the output files isn't supported by this filesystem"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// chownRecorderFS records the owner given to each path by Lchown instead of
+// changing it, since that needs root.
+type chownRecorderFS struct {
+	common.FS
+	owners map[string]common.Owner
+}
+
+func (c *chownRecorderFS) Lchown(name string, uid, gid int) error {
+	c.owners[name] = common.Owner{UID: uid, GID: gid}
+	return nil
+}
+
+func TestRender_OnlyPaths(t *testing.T) {
+	t.Parallel()
+
+	template := abctestutil.Tree{
+		"spec.yaml": abctestutil.File(`api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']`),
+		"a.txt":        abctestutil.File("new a"),
+		"ci/x.yml":     abctestutil.File("new x"),
+		"ci/sub/y.yml": abctestutil.File("new y"),
+		"src/main.go":  abctestutil.File("new main"),
+		"empty":        abctestutil.EmptyDir(),
+	}
+	existingDest := abctestutil.Tree{
+		"a.txt":       abctestutil.File("old a"),
+		"src/main.go": abctestutil.File("old main"),
+	}
+
+	cases := []struct {
+		name           string
+		onlyPaths      []string
+		forceOverwrite bool
+		want           abctestutil.Tree
+		wantErr        string
+	}{
+		{
+			name:      "file_glob",
+			onlyPaths: []string{"ci/*.yml"},
+			want: abctestutil.Tree{
+				"a.txt":       abctestutil.File("old a"),
+				"ci/x.yml":    abctestutil.File("new x"),
+				"src/main.go": abctestutil.File("old main"),
+			},
+		},
+		{
+			name:      "directory_includes_its_contents",
+			onlyPaths: []string{"ci"},
+			want: abctestutil.Tree{
+				"a.txt":        abctestutil.File("old a"),
+				"ci/x.yml":     abctestutil.File("new x"),
+				"ci/sub/y.yml": abctestutil.File("new y"),
+				"src/main.go":  abctestutil.File("old main"),
+			},
+		},
+		{
+			name:      "double_star_and_empty_dir",
+			onlyPaths: []string{"**/y.yml", "empty"},
+			want: abctestutil.Tree{
+				"a.txt":        abctestutil.File("old a"),
+				"ci/sub/y.yml": abctestutil.File("new y"),
+				"empty":        abctestutil.EmptyDir(),
+				"src/main.go":  abctestutil.File("old main"),
+			},
+		},
+		{
+			name:           "overwrite_one_existing_file",
+			onlyPaths:      []string{"src/main.go"},
+			forceOverwrite: true,
+			want: abctestutil.Tree{
+				"a.txt":       abctestutil.File("old a"),
+				"src/main.go": abctestutil.File("new main"),
+			},
+		},
+		{
+			name:      "existing_file_still_conflicts",
+			onlyPaths: []string{"src/main.go"},
+			wantErr:   "src/main.go",
+		},
+		{
+			name:      "no_match",
+			onlyPaths: []string{"docs/**"},
+			wantErr:   "--only-paths docs/** matched none of the output files",
+		},
+	}
 
-rules:
-  - rule: 'int(2) > int(10)'
-    message: 'invalid rule: 2 cannot be greater than 10'
-  - rule: '"abc".startsWith("z")'
-    message: 'invalid rule: abc does not start with z'
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteTree(t, sourceDir, template)
+			abctestutil.WriteTree(t, dest, existingDest)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, &Params{
+				BackupDir:         filepath.Join(tempDir, "backups"),
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				ForceOverwrite:    tc.forceOverwrite,
+				FS:                &common.RealFS{},
+				OnlyPaths:         tc.onlyPaths,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(abctestutil.LoadTree(t, dest), tc.want); diff != "" {
+				t.Errorf("dest directory was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_OnError(t *testing.T) {
+	t.Parallel()
 
+	// The for_each step includes b.txt, and then fails on a missing file.
+	specTemplate := `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with a step that fails'
 steps:
-  - desc: 'print a message' 
-    action: 'print'
+  - desc: 'Include a'
+    action: 'include'
     params:
-      message: 'rule validation passed'
-`,
-			}),
-			wantErr: "rules validation failed:\n\nRule:      int(2) > int(10)\nRule msg:  invalid rule: 2 cannot be greater than 10\n\nRule:      \"abc\".startsWith(\"z\")\nRule msg:  invalid rule: abc does not start with z\n",
+      paths: ['a.txt']
+  - desc: 'Include b and a missing file'
+    action: 'for_each'
+    ON_ERROR
+    params:
+      iterator:
+        key: 'file'
+        values: ['b.txt', 'missing.txt']
+      steps:
+        - desc: 'Include the file'
+          action: 'include'
+          params:
+            paths: ['{{.file}}']
+  - desc: 'Include c'
+    action: 'include'
+    params:
+      paths: ['c.txt']`
+
+	cases := []struct {
+		name            string
+		onError         string
+		want            abctestutil.Tree
+		wantFailedSteps []*FailedStep
+		wantErr         string
+	}{
+		{
+			name:    "default_fails",
+			wantErr: `glob "missing.txt" did not match any files`,
 		},
 		{
-			name: "independent_rule_validation_built_in_vars_in_scope",
-			templateContents: abctestutil.WithGitRepoAt("", map[string]string{
-				".git/refs/tags/v1.2.3": abctestutil.MinimalGitHeadSHA,
-				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
-kind: 'Template'
-desc: 'My template'
+			name:    "fail",
+			onError: "fail",
+			wantErr: `glob "missing.txt" did not match any files`,
+		},
+		{
+			name:    "retry_then_fail",
+			onError: "retry(2)",
+			wantErr: "failed 3 times, the last time with:",
+		},
+		{
+			name:    "continue_undoes_changes",
+			onError: "continue",
+			want: abctestutil.Tree{
+				"a.txt": abctestutil.File("a"),
+				"c.txt": abctestutil.File("c"),
+			},
+			wantFailedSteps: []*FailedStep{{
+				Desc:   "Include b and a missing file",
+				Action: "for_each",
+				Line:   9,
+				Error:  `glob "missing.txt" did not match any files`,
+			}},
+		},
+	}
 
-rules:
-  - rule: '_git_sha == "ahl8foqboh8ktqzxnymuvdcg91hvim0cfszlcstl"'
-    message: 'git sha must have specific value'
-  - rule: '_git_short_sha == "ahl8foq"'
-    message: 'git short sha must have specific value'
-  - rule: '_git_tag == "v1.2.3"'
-    message: 'git tag must have specific value'
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			onError := ""
+			if tc.onError != "" {
+				onError = fmt.Sprintf("on_error: '%s'", tc.onError)
+			}
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteTree(t, sourceDir, abctestutil.Tree{
+				"spec.yaml": abctestutil.File(strings.Replace(specTemplate, "ON_ERROR", onError, 1)),
+				"a.txt":     abctestutil.File("a"),
+				"b.txt":     abctestutil.File("b"),
+				"c.txt":     abctestutil.File("c"),
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			stats := &Stats{}
+			err := Render(ctx, &Params{
+				BackupDir:         filepath.Join(tempDir, "backups"),
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				SourceForMessages: sourceDir,
+				Stats:             stats,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			// The backups of the scratch directory are always removed.
+			entries, err2 := os.ReadDir(tempDir)
+			if err2 != nil {
+				t.Fatal(err2)
+			}
+			for _, e := range entries {
+				if strings.HasPrefix(e.Name(), tempdir.StepBackupDirNamePart) {
+					t.Errorf("temporary directory %q wasn't removed", e.Name())
+				}
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(abctestutil.LoadTree(t, dest), tc.want); diff != "" {
+				t.Errorf("dest directory was not as expected (-got,+want): %s", diff)
+			}
+			opt := cmpopts.IgnoreFields(FailedStep{}, "Error")
+			if diff := cmp.Diff(stats.FailedSteps, tc.wantFailedSteps, opt); diff != "" {
+				t.Errorf("failed steps were not as expected (-got,+want): %s", diff)
+			}
+			for i, f := range stats.FailedSteps {
+				if !strings.Contains(f.Error, tc.wantFailedSteps[i].Error) {
+					t.Errorf("failed step %d error = %q, want it to contain %q", i, f.Error, tc.wantFailedSteps[i].Error)
+				}
+			}
+		})
+	}
+}
+
+func TestRender_Protect(t *testing.T) {
+	t.Parallel()
 
+	template := abctestutil.Tree{
+		"spec.yaml": abctestutil.File(`api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
 steps:
-  - desc: 'print a message' 
-    action: 'print'
+  - desc: 'Include everything'
+    action: 'include'
     params:
-      message: |-
-        git sha: {{._git_sha}}
-        git short sha: {{._git_short_sha}}
-        git tag: {{._git_tag}}
-`,
-			}),
-			overrideBuiltinVars: map[string]string{
-				"_git_sha":       "ahl8foqboh8ktqzxnymuvdcg91hvim0cfszlcstl",
-				"_git_short_sha": "ahl8foq",
-				"_git_tag":       "v1.2.3",
+      paths: ['.']`),
+		"a.txt":         abctestutil.File("new a"),
+		"infra/main.tf": abctestutil.File("new main.tf"),
+		"docs/new.md":   abctestutil.File("new docs"),
+	}
+
+	cases := []struct {
+		name      string
+		protect   []string
+		onlyPaths []string
+		dest      abctestutil.Tree
+		want      abctestutil.Tree
+		wantErr   string
+	}{
+		{
+			name: "protect_file_modify",
+			dest: abctestutil.Tree{
+				".abc/protect.yaml": abctestutil.File("paths: ['infra/**']"),
+				"infra/main.tf":     abctestutil.File("old main.tf"),
+			},
+			wantErr: `the path "infra/main.tf" is protected by "infra/**" in `,
+		},
+		{
+			name:    "flag_create_dir",
+			protect: []string{"docs"},
+			wantErr: `the path "docs" is protected by "docs" in --protect`,
+		},
+		{
+			name:      "protected_path_not_written",
+			protect:   []string{"infra"},
+			onlyPaths: []string{"a.txt", "docs"},
+			want: abctestutil.Tree{
+				"a.txt":       abctestutil.File("new a"),
+				"docs/new.md": abctestutil.File("new docs"),
+			},
+		},
+		{
+			name:    "unrelated_glob",
+			protect: []string{"vendor/**"},
+			want: abctestutil.Tree{
+				"a.txt":         abctestutil.File("new a"),
+				"infra/main.tf": abctestutil.File("new main.tf"),
+				"docs/new.md":   abctestutil.File("new docs"),
 			},
-			wantStdout:       "git sha: ahl8foqboh8ktqzxnymuvdcg91hvim0cfszlcstl\ngit short sha: ahl8foq\ngit tag: v1.2.3\n",
-			wantDestContents: map[string]string{},
 		},
 	}
 
 	for _, tc := range cases {
 		tc := tc
+
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
 			tempDir := t.TempDir()
 			dest := filepath.Join(tempDir, "dest")
-			abctestutil.WriteAllDefaultMode(t, dest, tc.existingDestContents)
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteTree(t, sourceDir, template)
+			abctestutil.WriteTree(t, dest, tc.dest)
 
-			inputFilePaths := make([]string, 0, len(tc.inputFileNames))
-			for _, f := range tc.inputFileNames {
-				inputFileDir := filepath.Join(tempDir, "inputs")
-				abctestutil.WriteAllDefaultMode(t, inputFileDir, map[string]string{f: tc.inputFileContents[f]})
-				inputFilePaths = append(inputFilePaths, filepath.Join(inputFileDir, f))
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, &Params{
+				BackupDir:         filepath.Join(tempDir, "backups"),
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				ForceOverwrite:    true,
+				FS:                &common.RealFS{},
+				OnlyPaths:         tc.onlyPaths,
+				Protect:           tc.protect,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				if !errors.Is(err, errs.ErrConflict) {
+					t.Errorf("got error %v, want one in the conflict category", err)
+				}
+				// Nothing is written when a protected path would be.
+				tc.want = tc.dest
 			}
 
-			backupDir := filepath.Join(tempDir, "backups")
+			if diff := cmp.Diff(abctestutil.LoadTree(t, dest), tc.want); diff != "" {
+				t.Errorf("dest directory was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_ExtraDests(t *testing.T) {
+	t.Parallel()
+
+	template := map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A service whose infrastructure may live in another repo'
+destinations:
+  - name: 'infra'
+    desc: 'A checkout of the infrastructure repo'
+    paths:
+      - from: 'infra'
+        to: 'services/api'
+      - from: 'deploy.yaml'
+      - from: 'not_rendered.txt'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']`,
+		"main.go":        "package main\n",
+		"infra/main.tf":  "module {}\n",
+		"infra/vars.tf":  "variable {}\n",
+		"deploy.yaml":    "replicas: 1\n",
+		"docs/README.md": "# API\n",
+	}
+
+	cases := []struct {
+		name       string
+		extraDests map[string]string // relative to the temp dir
+		infra      map[string]string // the initial contents of the infra dir
+		wantDest   map[string]string
+		wantInfra  map[string]string
+		wantErr    string
+	}{
+		{
+			name: "all_in_dest_by_default",
+			wantDest: map[string]string{
+				"main.go":        "package main\n",
+				"infra/main.tf":  "module {}\n",
+				"infra/vars.tf":  "variable {}\n",
+				"deploy.yaml":    "replicas: 1\n",
+				"docs/README.md": "# API\n",
+			},
+		},
+		{
+			name:       "split",
+			extraDests: map[string]string{"infra": "infra"},
+			infra:      map[string]string{"README.md": "infra repo\n"},
+			wantDest: map[string]string{
+				"main.go":        "package main\n",
+				"docs/README.md": "# API\n",
+			},
+			wantInfra: map[string]string{
+				"README.md":            "infra repo\n",
+				"services/api/main.tf": "module {}\n",
+				"services/api/vars.tf": "variable {}\n",
+				"deploy.yaml":          "replicas: 1\n",
+			},
+		},
+		{
+			name:       "conflict_in_extra_dest_writes_nothing",
+			extraDests: map[string]string{"infra": "infra"},
+			infra:      map[string]string{"deploy.yaml": "replicas: 3\n"},
+			wantErr:    "deploy.yaml",
+			wantInfra:  map[string]string{"deploy.yaml": "replicas: 3\n"},
+		},
+		{
+			name:       "unknown_destination",
+			extraDests: map[string]string{"docs": "docs"},
+			wantErr:    `the template has no destination named "docs", given in --extra-dest; it has infra`,
+		},
+		{
+			name:       "same_dir_as_dest",
+			extraDests: map[string]string{"infra": "dest"},
+			wantErr:    `of the destination "infra" is also the directory of --dest`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			infra := filepath.Join(tempDir, "infra")
 			sourceDir := filepath.Join(tempDir, "source")
-			abctestutil.WriteAllDefaultMode(t, sourceDir, tc.templateContents)
-			rfs := &common.RealFS{}
-			stdoutBuf := &strings.Builder{}
-			p := &Params{
-				Backups:             true,
-				BackupDir:           backupDir,
-				Clock:               clk,
-				DestDir:             dest,
-				Downloader:          &templatesource.LocalDownloader{SrcPath: sourceDir},
-				ForceOverwrite:      tc.flagForceOverwrite,
-				Inputs:              tc.flagInputs,
-				InputFiles:          inputFilePaths,
-				KeepTempDirs:        tc.flagKeepTempDirs,
-				Manifest:            tc.flagManifest,
-				OverrideBuiltinVars: tc.overrideBuiltinVars,
-				SkipInputValidation: tc.flagSkipInputValidation,
-				DebugStepDiffs:      tc.flagDebugStepDiffs,
-				SourceForMessages:   sourceDir,
-				FS: &common.ErrorFS{
-					FS:           rfs,
-					RemoveAllErr: tc.removeAllErr,
-				},
-				Stdout:      stdoutBuf,
-				TempDirBase: tempDir,
+			abctestutil.WriteAllDefaultMode(t, sourceDir, template)
+			abctestutil.WriteAllDefaultMode(t, infra, tc.infra)
+
+			extraDests := make(map[string]string, len(tc.extraDests))
+			for name, dir := range tc.extraDests {
+				extraDests[name] = filepath.Join(tempDir, dir)
 			}
 
 			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
-			err := Render(ctx, p)
+			err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				ExtraDests:        extraDests,
+				FS:                &common.RealFS{},
+				Manifest:          true,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
-				t.Error(diff)
+				t.Fatal(diff)
+			}
+
+			gotDest, destManifest := withoutManifest(t, abctestutil.LoadDirWithoutMode(t, dest))
+			if diff := cmp.Diff(gotDest, tc.wantDest); diff != "" {
+				t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
+			}
+			gotInfra, infraManifest := withoutManifest(t, abctestutil.LoadDirWithoutMode(t, infra))
+			if diff := cmp.Diff(gotInfra, tc.wantInfra); diff != "" {
+				t.Errorf("infra directory contents were not as expected (-got,+want): %s", diff)
 			}
 			if err != nil {
-				errStr := err.Error()
-				if strings.Count(errStr, " at line ") > 1 {
-					t.Errorf(`this error message reported the "at line" location more than once: %q`, errStr)
+				return
+			}
+
+			// Each destination has a manifest of only its own files, and
+			// the one in infra is marked with the destination's name.
+			for _, f := range []string{"main.go", "docs/README.md"} {
+				if !strings.Contains(destManifest, "file: "+f+"\n") {
+					t.Errorf("the manifest in dest doesn't list %s:\n%s", f, destManifest)
+				}
+			}
+			if strings.Contains(destManifest, "destination:") {
+				t.Errorf("the manifest in dest is marked with a destination:\n%s", destManifest)
+			}
+			if tc.extraDests == nil {
+				if infraManifest != "" {
+					t.Errorf("got a manifest in infra, want none:\n%s", infraManifest)
+				}
+				return
+			}
+			if strings.Contains(destManifest, "deploy.yaml") {
+				t.Errorf("the manifest in dest lists files of another destination:\n%s", destManifest)
+			}
+			for _, want := range []string{"destination: infra\n", "file: deploy.yaml\n", "file: services/api/main.tf\n"} {
+				if !strings.Contains(infraManifest, want) {
+					t.Errorf("the manifest in infra doesn't contain %q:\n%s", want, infraManifest)
 				}
 			}
+			if strings.Contains(infraManifest, "README.md") {
+				t.Errorf("the manifest in infra lists a file that the render didn't write:\n%s", infraManifest)
+			}
+		})
+	}
+}
 
-			if diff := cmp.Diff(stdoutBuf.String(), tc.wantStdout); diff != "" {
-				t.Errorf("template output was not as expected; (-got,+want): %s", diff)
+// withoutManifest returns the directory contents in files without the
+// manifest, along with the manifest's contents, if there's exactly one.
+func withoutManifest(tb testing.TB, files map[string]string) (map[string]string, string) {
+	tb.Helper()
+
+	var manifest string
+	var out map[string]string
+	for path, contents := range files {
+		if strings.HasPrefix(path, ".abc/manifest_") {
+			if manifest != "" {
+				tb.Fatalf("got more than one manifest in %v", files)
 			}
+			manifest = contents
+			continue
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		out[path] = contents
+	}
+	return out, manifest
+}
+
+func TestRender_Limits(t *testing.T) {
+	t.Parallel()
+
+	templateContents := map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template with three files'
+steps:
+  - desc: 'Include the files'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'b.txt', 'dir/c.txt']`,
+		"a.txt":     "a",
+		"b.txt":     "b",
+		"dir/c.txt": "c",
+	}
+
+	cases := []struct {
+		name    string
+		limits  *common.Limits
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:   "within_limits",
+			limits: &common.Limits{MaxFiles: 3, MaxBytes: 3, MaxPathDepth: 2},
+			want: map[string]string{
+				"a.txt":     "a",
+				"b.txt":     "b",
+				"dir/c.txt": "c",
+			},
+		},
+		{
+			name:    "too_many_output_files",
+			limits:  &common.Limits{MaxFiles: 2},
+			wantErr: "failed writing to --dest directory: there are more than 2 files, which is the limit set by --max-files",
+		},
+		{
+			name:    "output_path_too_deep",
+			limits:  &common.Limits{MaxPathDepth: 1},
+			wantErr: `the path "dir/c.txt" is 2 levels deep, which is more than the limit of 1 set by --max-path-depth`,
+		},
+	}
 
-			var gotTemplateContents map[string]string
-			templateDir, ok := abctestutil.TestMustGlob(t, filepath.Join(tempDir, tempdir.TemplateDirNamePart+"*")) // the * accounts for the random cookie added by mkdirtemp
-			if ok {
-				gotTemplateContents = abctestutil.LoadDirWithoutMode(t, templateDir)
-			}
-			if diff := cmp.Diff(gotTemplateContents, tc.wantTemplateContents); diff != "" {
-				t.Errorf("template directory contents were not as expected (-got,+want): %s", diff)
-			}
+	for _, tc := range cases {
+		tc := tc
 
-			var gotScratchContents map[string]string
-			scratchDir, ok := abctestutil.TestMustGlob(t, filepath.Join(tempDir, tempdir.ScratchDirNamePart+"*"))
-			if ok {
-				gotScratchContents = abctestutil.LoadDirWithoutMode(t, scratchDir)
-			}
-			if diff := cmp.Diff(gotScratchContents, tc.wantScratchContents, cmpopts.EquateEmpty()); diff != "" {
-				t.Errorf("scratch directory contents were not as expected (-got,+want): %s", diff)
-			}
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
 
-			gotDestContents := abctestutil.LoadDirWithoutMode(t, dest)
-			if diff := cmp.Diff(gotDestContents, tc.wantDestContents); diff != "" {
-				t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
-			}
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, templateContents)
 
-			var gotBackupContents map[string]string
-			backupSubdir, ok := abctestutil.TestMustGlob(t, filepath.Join(backupDir, "*")) // When a backup directory is created, an unpredictable timestamp is added, hence the "*"
-			if ok {
-				gotBackupContents = abctestutil.LoadDirWithoutMode(t, backupSubdir)
-			}
-			if diff := cmp.Diff(gotBackupContents, tc.wantBackupContents, cmpopts.EquateEmpty()); diff != "" {
-				t.Errorf("backups directory contents were not as expected (-got,+want): %s", diff)
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				Limits:            tc.limits,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
 			}
 
-			var gotDebugContents map[string]string
-			debugDir, ok := abctestutil.TestMustGlob(t, filepath.Join(tempDir, tempdir.DebugStepDiffsDirNamePart+"*"))
-			if ok {
-				gotDebugContents = abctestutil.LoadDirWithoutMode(t, debugDir)
-			}
-			gotDebugDirExists := len(gotDebugContents) > 0
-			if tc.flagDebugStepDiffs != gotDebugDirExists {
-				t.Errorf("debug directory existence is %t but should be %t", gotDebugDirExists, tc.flagDebugStepDiffs)
+			// The limits are checked in the dry run, so nothing is written
+			// when they're exceeded.
+			if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, dest), tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("dest directory contents were not as expected (-got,+want): %s", diff)
 			}
 		})
 	}
@@ -1265,6 +4073,7 @@ func TestPromptDialog(t *testing.T) {
 		name          string
 		inputs        []*spec.Input
 		flagInputVals map[string]string // Simulates some inputs having already been provided by flags, like --input=foo=bar means we shouldn't prompt for "foo"
+		destContents  map[string]string // Files in the destination directory that input values may be inferred from
 		dialog        []abctestutil.DialogStep
 		want          map[string]string
 		wantErr       string
@@ -1514,6 +4323,176 @@ Enter value, or leave empty to accept default: `,
 				"animal": "",
 			},
 		},
+		{
+			name: "inferred_default_replaces_spec_default",
+			inputs: []*spec.Input{
+				{
+					Name:    model.String{Val: "module_path"},
+					Desc:    model.String{Val: "the Go module path"},
+					Default: &model.String{Val: "example.com/default"},
+					Infer: &spec.Infer{
+						File:  model.String{Val: "go.mod"},
+						Regex: model.String{Val: `(?m)^module\s+(\S+)`},
+					},
+				},
+			},
+			destContents: map[string]string{
+				"go.mod": "module github.com/my/project\n\ngo 1.21\n",
+			},
+			dialog: []abctestutil.DialogStep{
+				{
+					WaitForPrompt: `
+Input name:   module_path
+Description:  the Go module path
+Default:      github.com/my/project (inferred from go.mod)
+
+Enter value, or leave empty to accept default: `,
+					ThenRespond: "\n",
+				},
+			},
+			want: map[string]string{
+				"module_path": "github.com/my/project",
+			},
+		},
+		{
+			name: "spec_default_when_nothing_inferred",
+			inputs: []*spec.Input{
+				{
+					Name:    model.String{Val: "project_name"},
+					Desc:    model.String{Val: "the project name"},
+					Default: &model.String{Val: "my-project"},
+					Infer: &spec.Infer{
+						File:  model.String{Val: "package.json"},
+						Field: model.String{Val: "name"},
+					},
+				},
+			},
+			dialog: []abctestutil.DialogStep{
+				{
+					WaitForPrompt: `
+Input name:   project_name
+Description:  the project name
+Default:      my-project
+
+Enter value, or leave empty to accept default: `,
+					ThenRespond: "\n",
+				},
+			},
+			want: map[string]string{
+				"project_name": "my-project",
+			},
+		},
+		{
+			name: "bool_input_reprompts_until_valid",
+			inputs: []*spec.Input{
+				{
+					Name: model.String{Val: "enabled"},
+					Desc: model.String{Val: "whether the feature is enabled"},
+					Type: model.String{Val: "bool"},
+				},
+			},
+			dialog: []abctestutil.DialogStep{
+				{
+					WaitForPrompt: `
+Input name:   enabled
+Description:  whether the feature is enabled
+Type:         bool (y/n)
+
+Enter value: `,
+					ThenRespond: "maybe\n",
+				},
+				{
+					WaitForPrompt: `
+Invalid value: "maybe" isn't a bool, it must be true or false (or yes or no). Please try again.
+
+Enter value: `,
+					ThenRespond: "y\n",
+				},
+			},
+			want: map[string]string{
+				"enabled": "true",
+			},
+		},
+		{
+			name: "default_from_uses_earlier_answers",
+			inputs: []*spec.Input{
+				{
+					Name: model.String{Val: "project_id"},
+					Desc: model.String{Val: "the project ID"},
+				},
+				{
+					Name:        model.String{Val: "service_account"},
+					Desc:        model.String{Val: "the service account name"},
+					DefaultFrom: model.String{Val: `project_id + "-sa"`},
+				},
+			},
+			dialog: []abctestutil.DialogStep{
+				{
+					WaitForPrompt: `
+Input name:   project_id
+Description:  the project ID
+
+Enter value: `,
+					ThenRespond: "my-project\n",
+				},
+				{
+					WaitForPrompt: `
+Input name:   service_account
+Description:  the service account name
+Default:      my-project-sa
+
+Enter value, or leave empty to accept default: `,
+					ThenRespond: "\n",
+				},
+			},
+			want: map[string]string{
+				"project_id":      "my-project",
+				"service_account": "my-project-sa",
+			},
+		},
+		{
+			name: "typed_defaults_are_coerced",
+			inputs: []*spec.Input{
+				{
+					Name:    model.String{Val: "regions"},
+					Desc:    model.String{Val: "the regions"},
+					Type:    model.String{Val: "list"},
+					Default: &model.String{Val: "us-east1, us-west1"},
+				},
+				{
+					Name:    model.String{Val: "replicas"},
+					Desc:    model.String{Val: "the number of replicas"},
+					Type:    model.String{Val: "int"},
+					Default: &model.String{Val: "3"},
+				},
+			},
+			dialog: []abctestutil.DialogStep{
+				{
+					WaitForPrompt: `
+Input name:   regions
+Description:  the regions
+Type:         list (comma-separated)
+Default:      us-east1, us-west1
+
+Enter value, or leave empty to accept default: `,
+					ThenRespond: "\n",
+				},
+				{
+					WaitForPrompt: `
+Input name:   replicas
+Description:  the number of replicas
+Type:         int
+Default:      3
+
+Enter value, or leave empty to accept default: `,
+					ThenRespond: "5\n",
+				},
+			},
+			want: map[string]string{
+				"regions":  `["us-east1","us-west1"]`,
+				"replicas": "5",
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -1521,6 +4500,9 @@ Enter value, or leave empty to accept default: `,
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
+			destDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, destDir, tc.destContents)
+
 			cmd := &cli.BaseCommand{}
 
 			stdinReader, stdinWriter := io.Pipe()
@@ -1537,6 +4519,8 @@ Enter value, or leave empty to accept default: `,
 			go func() {
 				defer close(errCh)
 				params := &input.ResolveParams{
+					DestDir:            destDir,
+					FS:                 &common.RealFS{},
 					Inputs:             tc.flagInputVals,
 					Prompt:             true,
 					Prompter:           cmd,
@@ -1569,3 +4553,264 @@ Enter value, or leave empty to accept default: `,
 		})
 	}
 }
+
+func BenchmarkRender(b *testing.B) {
+	for _, numFiles := range abctestutil.BenchmarkSizes {
+		numFiles := numFiles
+
+		b.Run(abctestutil.BenchmarkName(numFiles), func(b *testing.B) {
+			ctx := abctestutil.BenchmarkContext()
+			tempDir := b.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			template := abctestutil.SyntheticTree(numFiles)
+			template["spec.yaml"] = abctestutil.File(`api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A large template'
+inputs:
+  - name: 'name'
+    desc: 'A name'
+    default: 'world'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']
+      skip: ['spec.yaml']
+  - desc: 'Replace a word in every file'
+    action: 'string_replace'
+    params:
+      paths: ['.']
+      replacements:
+        - to_replace: 'hello'
+          with: 'goodbye {{.name}}'
+  - desc: 'Render every file as a Go template'
+    action: 'go_template'
+    params:
+      paths: ['.']`)
+			abctestutil.WriteTree(b, sourceDir, template)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := Render(ctx, &Params{
+					Clock:             clock.NewMock(),
+					DestDir:           filepath.Join(tempDir, "dest", fmt.Sprint(i)),
+					Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+					FS:                &common.RealFS{},
+					SourceForMessages: sourceDir,
+					Stdout:            io.Discard,
+					TempDirBase:       tempDir,
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRender_Redact(t *testing.T) {
+	t.Parallel()
+
+	const secret = "hunter2-secret"
+
+	cases := []struct {
+		name    string
+		rule    string
+		wantErr string
+	}{
+		{
+			name: "success",
+			rule: "size(api_token) > 0",
+		},
+		{
+			name:    "error_message",
+			rule:    "size(api_token) > 100",
+			wantErr: "Input value:  " + redact.Placeholder,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "dest")
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAllDefaultMode(t, sourceDir, map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'name'
+    desc: 'a name'
+  - name: 'api_token'
+    desc: 'a token'
+    rules:
+      - rule: '` + tc.rule + `'
+steps:
+  - desc: 'Print the token'
+    action: 'print'
+    params:
+      message: '{{.name}} has token {{.api_token}}'
+  - desc: 'Include the file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+				"a.txt": "a",
+			})
+
+			logs := &strings.Builder{}
+			stdout := &strings.Builder{}
+			debugScope := &strings.Builder{}
+			ctx := logging.WithLogger(context.Background(),
+				logging.New(logs, slog.LevelDebug, logging.FormatText, true))
+			err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				DebugScope:        debugScope,
+				DestDir:           dest,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				Inputs:            map[string]string{"name": "alice", "api_token": secret},
+				Manifest:          true,
+				Redact:            []string{"*_token"},
+				SourceForMessages: sourceDir,
+				Stdout:            stdout,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil && strings.Contains(err.Error(), secret) {
+				t.Errorf("error %q contains the sensitive value", err)
+			}
+			for name, out := range map[string]string{"logs": logs.String(), "stdout": stdout.String(), "debug scope": debugScope.String()} {
+				if strings.Contains(out, secret) {
+					t.Errorf("%s contain the sensitive value: %s", name, out)
+				}
+			}
+			if err != nil {
+				return
+			}
+
+			if got, want := stdout.String(), "alice has token "+redact.Placeholder+"\n"; got != want {
+				t.Errorf("got stdout %q, want %q", got, want)
+			}
+			manifests, err := filepath.Glob(filepath.Join(dest, common.ABCInternalDir, "manifest*.yaml"))
+			if err != nil || len(manifests) != 1 {
+				t.Fatalf("got manifests %v (err %v), want exactly one", manifests, err)
+			}
+			buf, err := os.ReadFile(manifests[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(buf), "api_token") || strings.Contains(string(buf), secret) {
+				t.Errorf("manifest contains the sensitive input:\n%s", buf)
+			}
+			if !strings.Contains(string(buf), "alice") {
+				t.Errorf("manifest is missing the other inputs:\n%s", buf)
+			}
+		})
+	}
+}
+
+func TestNeedsRenderedPaths(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		step     *spec.Step
+		features features.Features
+		debug    bool
+		want     bool
+	}{
+		{
+			name: "unused",
+			step: &spec.Step{
+				Action: model.String{Val: "print"},
+				Print:  &spec.Print{Message: model.String{Val: "{{.person}}"}},
+			},
+			want: false,
+		},
+		{
+			name: "print_uses_it",
+			step: &spec.Step{
+				Action: model.String{Val: "print"},
+				Print:  &spec.Print{Message: model.String{Val: "{{._rendered_paths}}"}},
+			},
+			want: true,
+		},
+		{
+			name: "if_uses_it",
+			step: &spec.Step{
+				If:     model.String{Val: `_rendered_paths.contains("a.txt")`},
+				Action: model.String{Val: "print"},
+				Print:  &spec.Print{Message: model.String{Val: "hello"}},
+			},
+			want: true,
+		},
+		{
+			name: "nested_step_uses_it",
+			step: &spec.Step{
+				Action: model.String{Val: "for_each"},
+				ForEach: &spec.ForEach{
+					Iterator: &spec.ForEachIterator{
+						Key:    model.String{Val: "x"},
+						Values: []model.String{{Val: "a"}},
+					},
+					Steps: []*spec.Step{{
+						Action: model.String{Val: "print"},
+						Print:  &spec.Print{Message: model.String{Val: "{{._rendered_paths}}"}},
+					}},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "go_template_always",
+			step: &spec.Step{
+				Action:     model.String{Val: "go_template"},
+				GoTemplate: &spec.GoTemplate{Paths: []model.String{{Val: "index.txt"}}},
+			},
+			want: true,
+		},
+		{
+			name: "debug_scope_always",
+			step: &spec.Step{
+				Action: model.String{Val: "print"},
+				Print:  &spec.Print{Message: model.String{Val: "hello"}},
+			},
+			debug: true,
+			want:  true,
+		},
+		{
+			name: "old_api_version",
+			step: &spec.Step{
+				Action:     model.String{Val: "go_template"},
+				GoTemplate: &spec.GoTemplate{Paths: []model.String{{Val: "index.txt"}}},
+			},
+			features: features.Features{SkipRenderedPaths: true},
+			want:     false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sp := &stepParams{
+				features: tc.features,
+				rp:       &Params{},
+			}
+			if tc.debug {
+				sp.rp.DebugScope = io.Discard
+			}
+			if got := needsRenderedPaths(tc.step, sp); got != tc.want {
+				t.Errorf("needsRenderedPaths() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/redact"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// ResumeState is saved in a resume file when a render is interrupted before all
+// of its inputs are known, like when the user aborts a prompt or a slow
+// download. A later render with --resume reads it back, so the user doesn't
+// have to enter everything again.
+type ResumeState struct {
+	// Source is the template location to resume with. If a remote git
+	// template was downloaded before the interruption, this is pinned to the
+	// version that was downloaded, so that resuming doesn't pick up a newer
+	// "latest".
+	Source string `yaml:"source"`
+
+	// Inputs are the input values that were known at the time of the
+	// interruption, including answers to prompts.
+	Inputs map[string]string `yaml:"inputs,omitempty"`
+}
+
+// ResumeFilePath returns the path of the resume file for renders into destDir,
+// inside resumeDir (normally ~/.abc/resume). Each destination directory has
+// its own resume file, so interrupted renders into different directories
+// don't interfere with each other. destDir must be absolute.
+func ResumeFilePath(resumeDir, destDir string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(destDir)))
+	return filepath.Join(resumeDir, hex.EncodeToString(sum[:8])+".yaml")
+}
+
+// LoadResumeState reads a resume file that was saved by an interrupted render.
+// If there's no resume file, the error satisfies common.IsStatNotExistErr.
+func LoadResumeState(rfs common.FS, path string) (*ResumeState, error) {
+	buf, err := rfs.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading resume file: %w", err)
+	}
+	out := &ResumeState{}
+	if err := yaml.Unmarshal(buf, out); err != nil {
+		return nil, fmt.Errorf("failed parsing resume file %q: %w", path, err)
+	}
+	if out.Source == "" {
+		return nil, fmt.Errorf("resume file %q doesn't contain a template source", path)
+	}
+	return out, nil
+}
+
+// updateResumeFile is called at the end of a render to maintain
+// p.ResumeFile. A successful render removes it. A render that failed before its
+// inputs were resolved saves the progress so far in it, if the render was
+// interrupted or was prompting; other failures, like a missing input without
+// --prompt, aren't worth resuming.
+func updateResumeFile(ctx context.Context, p *Params, state *ResumeState, inputsResolved bool, renderErr error) error {
+	if p.ResumeFile == "" {
+		return nil
+	}
+	if renderErr == nil {
+		if err := p.FS.RemoveAll(p.ResumeFile); err != nil {
+			return fmt.Errorf("failed removing resume file: %w", err)
+		}
+		return nil
+	}
+	if inputsResolved || (ctx.Err() == nil && !p.Prompt) {
+		return nil
+	}
+	// Sensitive inputs aren't saved, so they're asked for again on resume.
+	redactor, err := redact.New(p.Redact, nil)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	saved := *state
+	saved.Inputs = redactor.Inputs(state.Inputs)
+	if err := saveResumeState(p.FS, p.ResumeFile, &saved); err != nil {
+		return err
+	}
+	// Use default log level.
+	logging.FromContext(ctx).WarnContext(ctx,
+		"the render didn't finish; the template source and the inputs entered so far were saved, run the same command with --resume to continue",
+		"resume_file", p.ResumeFile)
+	return nil
+}
+
+// saveResumeState writes state to the resume file at path, creating its parent
+// directory if needed.
+func saveResumeState(rfs common.FS, path string, state *ResumeState) error {
+	buf, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed marshaling resume state: %w", err)
+	}
+	if err := rfs.MkdirAll(filepath.Dir(path), common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("MkdirAll(): %w", err)
+	}
+	if err := rfs.WriteFile(path, buf, common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("failed writing resume file: %w", err)
+	}
+	return nil
+}
+
+// pinnedSource returns the source to save in a resume file, given the source
+// the user asked for and the metadata of the download. A remote git template
+// is pinned to the version that was downloaded.
+func pinnedSource(source string, dlMeta *templatesource.DownloadMetadata) string {
+	if dlMeta == nil || dlMeta.LocationType != templatesource.LocTypeRemoteGit || !dlMeta.HasVersion {
+		return source
+	}
+	return dlMeta.CanonicalSource + "@" + dlMeta.Version
+}
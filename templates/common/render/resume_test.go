@@ -0,0 +1,157 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+func TestUpdateResumeFile(t *testing.T) {
+	t.Parallel()
+
+	state := &ResumeState{
+		Source: "github.com/my-org/my-repo/my-template@v1.2.3",
+		Inputs: map[string]string{"first": "hello"},
+	}
+	renderErr := fmt.Errorf("fake render error")
+
+	cases := []struct {
+		name           string
+		prompt         bool
+		canceled       bool
+		inputsResolved bool
+		renderErr      error
+		existing       bool
+		wantState      *ResumeState
+	}{
+		{
+			name:      "prompt_failure_is_saved",
+			prompt:    true,
+			renderErr: renderErr,
+			wantState: state,
+		},
+		{
+			name:      "interruption_is_saved",
+			canceled:  true,
+			renderErr: renderErr,
+			wantState: state,
+		},
+		{
+			name:      "other_failure_is_not_saved",
+			renderErr: renderErr,
+		},
+		{
+			name:           "failure_after_inputs_resolved_is_not_saved",
+			prompt:         true,
+			canceled:       true,
+			inputsResolved: true,
+			renderErr:      renderErr,
+		},
+		{
+			name:           "success_removes_resume_file",
+			existing:       true,
+			inputsResolved: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(logging.WithLogger(context.Background(), logging.TestLogger(t)))
+			defer cancel()
+			if tc.canceled {
+				cancel()
+			}
+
+			rfs := &common.RealFS{}
+			resumeFile := filepath.Join(t.TempDir(), "resume", "file.yaml")
+			if tc.existing {
+				if err := saveResumeState(rfs, resumeFile, state); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			p := &Params{FS: rfs, Prompt: tc.prompt, ResumeFile: resumeFile}
+			if err := updateResumeFile(ctx, p, state, tc.inputsResolved, tc.renderErr); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadResumeState(rfs, resumeFile)
+			if err != nil && !common.IsStatNotExistErr(err) {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, tc.wantState); diff != "" {
+				t.Errorf("resume state was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestPinnedSource(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		dlMeta *templatesource.DownloadMetadata
+		want   string
+	}{
+		{
+			name: "remote_git_is_pinned",
+			dlMeta: &templatesource.DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "github.com/my-org/my-repo/my-template",
+				LocationType:    templatesource.LocTypeRemoteGit,
+				HasVersion:      true,
+				Version:         "v1.2.3",
+			},
+			want: "github.com/my-org/my-repo/my-template@v1.2.3",
+		},
+		{
+			name: "local_is_not_pinned",
+			dlMeta: &templatesource.DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "../my-template",
+				LocationType:    templatesource.LocTypeLocalGit,
+				HasVersion:      true,
+				Version:         "abcdef",
+			},
+			want: "github.com/my-org/my-repo/my-template@latest",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := pinnedSource("github.com/my-org/my-repo/my-template@latest", tc.dlMeta); got != tc.want {
+				t.Errorf("pinnedSource() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
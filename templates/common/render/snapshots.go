@@ -0,0 +1,102 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+)
+
+// StepSnapshots records the contents of the scratch directory after each step
+// of a single render, including the steps inside for_each actions and step
+// groups. Comparing the snapshots of two renders of the same template with
+// the same inputs shows the first step whose output was different, which is
+// how nondeterminism, like the use of the current time or random values, is
+// tracked down.
+type StepSnapshots struct {
+	// Snapshots are in the order that the steps ran.
+	Snapshots []*StepSnapshot
+}
+
+// StepSnapshot is the contents of the scratch directory after one step.
+type StepSnapshot struct {
+	// Template is empty for steps of the template being rendered. For steps
+	// of a base template, it's the "extends" value naming that template.
+	Template string
+
+	// Step is the step that just ran.
+	Step *spec.Step
+
+	// Hashes maps the path of each file in the scratch directory, relative to
+	// it and using forward slashes, to a hex-encoded hash of its contents.
+	Hashes map[string]string
+}
+
+// ChangedPaths returns the sorted paths of the files that are different
+// between s and other, including files that only one of them has.
+func (s *StepSnapshot) ChangedPaths(other *StepSnapshot) []string {
+	var out []string
+	for path, hash := range s.Hashes {
+		if other.Hashes[path] != hash {
+			out = append(out, path)
+		}
+	}
+	for path := range other.Hashes {
+		if _, ok := s.Hashes[path]; !ok {
+			out = append(out, path)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// record adds a snapshot of the scratch directory after the given step.
+func (s *StepSnapshots) record(sp *stepParams, step *spec.Step) error {
+	hashes := map[string]string{}
+	err := fs.WalkDir(sp.rp.FS, sp.scratchDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(sp.scratchDir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", sp.scratchDir, path, err)
+		}
+		buf, err := sp.rp.FS.ReadFile(path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		hash := sha256.Sum256(buf)
+		hashes[filepath.ToSlash(rel)] = hex.EncodeToString(hash[:])
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed taking a snapshot of the scratch directory: %w", err)
+	}
+	s.Snapshots = append(s.Snapshots, &StepSnapshot{
+		Template: sp.baseTemplate,
+		Step:     step,
+		Hashes:   hashes,
+	})
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStepSnapshot_ChangedPaths(t *testing.T) {
+	t.Parallel()
+
+	a := &StepSnapshot{Hashes: map[string]string{
+		"same.txt":    "1",
+		"changed.txt": "1",
+		"only_a.txt":  "1",
+	}}
+	b := &StepSnapshot{Hashes: map[string]string{
+		"same.txt":    "1",
+		"changed.txt": "2",
+		"only_b.txt":  "1",
+	}}
+	want := []string{"changed.txt", "only_a.txt", "only_b.txt"}
+	if diff := cmp.Diff(a.ChangedPaths(b), want); diff != "" {
+		t.Errorf("ChangedPaths() was not as expected (-got,+want): %s", diff)
+	}
+	if diff := cmp.Diff(b.ChangedPaths(a), want); diff != "" {
+		t.Errorf("ChangedPaths() in reverse was not as expected (-got,+want): %s", diff)
+	}
+}
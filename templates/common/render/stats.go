@@ -0,0 +1,111 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// Stats summarizes a successful render, for printing at the end of it and for
+// --stats-out. It's filled in by Render if Params.Stats is set.
+type Stats struct {
+	// Source is the location of the template, as in Params.SourceForMessages.
+	Source string `json:"source"`
+
+	// TemplateVersion is the version of the template that was rendered, like
+	// a git SHA, if it has one. Templates in a local directory that isn't a
+	// clean git workspace don't.
+	TemplateVersion string `json:"template_version,omitempty"`
+
+	// FilesWritten is the number of files and symlinks written to the
+	// destination, including ones that were overwritten.
+	FilesWritten int `json:"files_written"`
+
+	// FilesSkipped is the number of files in the template output that were
+	// left out of the destination rather than written.
+	FilesSkipped int `json:"files_skipped"`
+
+	// Bytes is the total size of the files written, after any post_render
+	// steps. Symlinks don't count.
+	Bytes int64 `json:"bytes"`
+
+	// Duration is how long the render took, from the start of the download
+	// until the output was written. It's marshaled to JSON as
+	// "duration_seconds".
+	Duration time.Duration `json:"-"`
+
+	// FailedSteps are the steps with on_error "continue" that failed, and
+	// whose changes were undone, in the order they ran.
+	FailedSteps []*FailedStep `json:"failed_steps,omitempty"`
+}
+
+// FailedStep is a step that failed, but didn't stop the render because of its
+// on_error field.
+type FailedStep struct {
+	Desc   string `json:"desc"`
+	Action string `json:"action"`
+
+	// Line is the line of the step in its spec.yaml.
+	Line int `json:"line"`
+
+	// Error is the step's error message.
+	Error string `json:"error"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *Stats) MarshalJSON() ([]byte, error) {
+	// The conversion to stats drops this method, so it isn't called again.
+	type stats Stats
+	return json.Marshal(&struct { //nolint:wrapcheck
+		*stats
+		DurationSeconds float64 `json:"duration_seconds"`
+	}{
+		stats:           (*stats)(s),
+		DurationSeconds: s.Duration.Seconds(),
+	})
+}
+
+// String returns a summary like "wrote 12 files (3.4 KiB) and skipped 1 file
+// in 1.2s, template version 5f1e6a4". If steps failed and were continued
+// past, it ends with how many, like "; 1 step failed and was skipped".
+func (s *Stats) String() string {
+	out := fmt.Sprintf("wrote %s (%s) and skipped %s in %s",
+		plural(s.FilesWritten, "file"),
+		common.FormatBytes(s.Bytes),
+		plural(s.FilesSkipped, "file"),
+		s.Duration.Round(100*time.Millisecond))
+	if s.TemplateVersion != "" {
+		out += ", template version " + s.TemplateVersion
+	}
+	switch n := len(s.FailedSteps); n {
+	case 0:
+	case 1:
+		out += "; 1 step failed and was skipped"
+	default:
+		out += fmt.Sprintf("; %d steps failed and were skipped", n)
+	}
+	return out
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
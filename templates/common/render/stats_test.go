@@ -0,0 +1,91 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		stats      *Stats
+		wantString string
+		wantJSON   string
+	}{
+		{
+			name: "with_version",
+			stats: &Stats{
+				Source:          "github.com/abcxyz/abc/t/rest_server@latest",
+				TemplateVersion: "5f1e6a4",
+				FilesWritten:    12,
+				FilesSkipped:    1,
+				Bytes:           3500,
+				Duration:        1234 * time.Millisecond,
+			},
+			wantString: "wrote 12 files (3.4 KiB) and skipped 1 file in 1.2s, template version 5f1e6a4",
+			wantJSON:   `{"source":"github.com/abcxyz/abc/t/rest_server@latest","template_version":"5f1e6a4","files_written":12,"files_skipped":1,"bytes":3500,"duration_seconds":1.234}`,
+		},
+		{
+			name: "local_template",
+			stats: &Stats{
+				Source:       "/my/template",
+				FilesWritten: 1,
+				Bytes:        10,
+			},
+			wantString: "wrote 1 file (10 B) and skipped 0 files in 0s",
+			wantJSON:   `{"source":"/my/template","files_written":1,"files_skipped":0,"bytes":10,"duration_seconds":0}`,
+		},
+		{
+			name: "failed_steps",
+			stats: &Stats{
+				Source:       "/my/template",
+				FilesWritten: 2,
+				Bytes:        20,
+				FailedSteps: []*FailedStep{
+					{Desc: "Format the Go code", Action: "format", Line: 12, Error: "gofmt failed"},
+					{Desc: "Edit go.mod", Action: "go_mod_edit", Line: 20, Error: "no go.mod"},
+				},
+			},
+			wantString: "wrote 2 files (20 B) and skipped 0 files in 0s; 2 steps failed and were skipped",
+			wantJSON: `{"source":"/my/template","files_written":2,"files_skipped":0,"bytes":20,` +
+				`"failed_steps":[{"desc":"Format the Go code","action":"format","line":12,"error":"gofmt failed"},` +
+				`{"desc":"Edit go.mod","action":"go_mod_edit","line":20,"error":"no go.mod"}],"duration_seconds":0}`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tc.stats.String(); got != tc.wantString {
+				t.Errorf("String() = %q, want %q", got, tc.wantString)
+			}
+			buf, err := json.Marshal(tc.stats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf); got != tc.wantJSON {
+				t.Errorf("json.Marshal() = %s, want %s", got, tc.wantJSON)
+			}
+		})
+	}
+}
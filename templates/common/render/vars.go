@@ -0,0 +1,74 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// resolveVars computes the value of each of the template's internal vars in
+// order, so each may reference the ones before it, and returns the scope with
+// the vars added. A var named in overrides (the --set flag) takes the given
+// value instead, and its expression isn't evaluated.
+func resolveVars(ctx context.Context, scope *common.Scope, vars []*spec.Var, overrides map[string]string) (*common.Scope, error) {
+	logger := logging.FromContext(ctx).With("logger", "resolveVars")
+
+	declared := make(map[string]struct{}, len(vars))
+	for _, v := range vars {
+		declared[v.Name.Val] = struct{}{}
+	}
+	var unknown []string
+	for name := range overrides {
+		if _, ok := declared[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		names := make([]string, 0, len(vars))
+		for _, v := range vars {
+			names = append(names, v.Name.Val)
+		}
+		return nil, fmt.Errorf("--set can only override the template's vars %v, but got unknown name(s) %v", names, unknown)
+	}
+
+	for _, v := range vars {
+		if val, ok := overrides[v.Name.Val]; ok {
+			// Overriding vars can break templates in ways their authors didn't
+			// anticipate, so always make it visible.
+			logger.WarnContext(ctx, "overriding template var with --set",
+				"name", v.Name.Val,
+				"value", val)
+			scope = scope.With(map[string]string{v.Name.Val: val})
+			continue
+		}
+
+		var val string
+		if err := common.CelCompileAndEval(ctx, scope, v.Value, &val); err != nil {
+			return nil, fmt.Errorf("failed computing var %q: %w", v.Name.Val, err)
+		}
+		logger.DebugContext(ctx, "computed template var",
+			"name", v.Name.Val,
+			"value", val)
+		scope = scope.With(map[string]string{v.Name.Val: val})
+	}
+	return scope, nil
+}
@@ -22,6 +22,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/ui"
 	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
 )
 
@@ -67,13 +68,13 @@ func ValidateRulesWithMessage(ctx context.Context, scope *common.Scope, rules []
 // rules in the list of rules; in that case, pass includeIndex=true and the index
 // value. If includeIndex is false, then index is ignored.
 func WriteRule(writer *tabwriter.Writer, rule *spec.Rule, includeIndex bool, index int) {
-	indexStr := ""
+	ruleLabel, msgLabel := ui.Msg(ui.MsgRule), ui.Msg(ui.MsgRuleMessage)
 	if includeIndex {
-		indexStr = fmt.Sprintf(" %d", index)
+		ruleLabel, msgLabel = ui.Msg(ui.MsgRuleIndexed, index), ui.Msg(ui.MsgRuleMessageIndexed, index)
 	}
 
-	fmt.Fprintf(writer, "\nRule%s:\t%s", indexStr, rule.Rule.Val)
+	fmt.Fprintf(writer, "\n%s\t%s", ruleLabel, rule.Rule.Val)
 	if rule.Message.Val != "" {
-		fmt.Fprintf(writer, "\nRule%s msg:\t%s", indexStr, rule.Message.Val)
+		fmt.Fprintf(writer, "\n%s\t%s", msgLabel, rule.Message.Val)
 	}
 }
@@ -22,10 +22,39 @@ import (
 )
 
 // SafeRelPath returns an error if the path contains a ".." traversal, and
-// converts it to a relative path by removing any leading "/".
+// converts it to a relative path by removing any leading "/". Paths in a
+// spec are relative to the template or destination directory, and they're
+// often the output of a go template, so they must not be trusted to stay
+// inside that directory.
 func SafeRelPath(pos *model.ConfigPos, p string) (string, error) {
 	if strings.Contains(p, "..") {
 		return "", pos.Errorf(`path %q must not contain ".."`, p)
 	}
-	return strings.TrimLeft(p, string(filepath.Separator)), nil
+	if strings.ContainsRune(p, 0) {
+		return "", pos.Errorf("path %q must not contain a NUL byte", p)
+	}
+	if vol := filepath.VolumeName(p); vol != "" {
+		// On Windows, "C:\x" or "\\host\share\x" can't be made relative by
+		// removing a leading separator.
+		return "", pos.Errorf("path %q must not have a volume name", p)
+	}
+	rel := strings.TrimLeft(p, string(filepath.Separator))
+	if rel != "" && !filepath.IsLocal(rel) {
+		return "", pos.Errorf("path %q must be a relative path that stays inside its directory", p)
+	}
+	return rel, nil
+}
+
+// JoinWithinRoot is like filepath.Join(root, rel), but returns an error if the
+// result isn't root or inside root. rel should already have been cleaned up
+// by SafeRelPath; this is the final check before a file is read or written,
+// so that no path computed by an action can escape the scratch or
+// destination directory.
+func JoinWithinRoot(pos *model.ConfigPos, root, rel string) (string, error) {
+	joined := filepath.Join(root, rel)
+	relToRoot, err := filepath.Rel(root, joined)
+	if err != nil || (relToRoot != "." && !filepath.IsLocal(relToRoot)) {
+		return "", pos.Errorf("path %q is outside of the directory %q", rel, root)
+	}
+	return joined, nil
 }
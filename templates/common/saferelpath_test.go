@@ -15,6 +15,7 @@
 package common
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/abcxyz/pkg/testutil"
@@ -79,6 +80,21 @@ func TestSafeRelPath(t *testing.T) {
 			in:      "..",
 			wantErr: "..",
 		},
+		{
+			name: "many_leading_slashes_stripped",
+			in:   "///etc/passwd",
+			want: "etc/passwd",
+		},
+		{
+			name: "dot_succeeds",
+			in:   ".",
+			want: ".",
+		},
+		{
+			name:    "nul_byte_fails",
+			in:      "a.txt\x00.md",
+			wantErr: "NUL byte",
+		},
 	}
 
 	for _, tc := range cases {
@@ -97,3 +113,74 @@ func TestSafeRelPath(t *testing.T) {
 		})
 	}
 }
+
+func TestJoinWithinRoot(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		root    string
+		rel     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "file_in_root",
+			root: "/scratch",
+			rel:  "a.txt",
+			want: "/scratch/a.txt",
+		},
+		{
+			name: "file_in_subdir",
+			root: "/scratch",
+			rel:  "a/b/c.txt",
+			want: "/scratch/a/b/c.txt",
+		},
+		{
+			name: "root_itself",
+			root: "/scratch",
+			rel:  ".",
+			want: "/scratch",
+		},
+		{
+			name: "empty",
+			root: "/scratch",
+			rel:  "",
+			want: "/scratch",
+		},
+		{
+			name: "dot_dot_that_stays_inside",
+			root: "/scratch",
+			rel:  "a/../b.txt",
+			want: "/scratch/b.txt",
+		},
+		{
+			name:    "dot_dot_escapes",
+			root:    "/scratch",
+			rel:     "a/../../b.txt",
+			wantErr: `path "a/../../b.txt" is outside of the directory "/scratch"`,
+		},
+		{
+			name:    "sibling_with_same_prefix",
+			root:    "/scratch",
+			rel:     "../scratch2/a.txt",
+			wantErr: "is outside of the directory",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := JoinWithinRoot(nil, filepath.FromSlash(tc.root), filepath.FromSlash(tc.rel))
+			if want := filepath.FromSlash(tc.want); got != want {
+				t.Errorf("JoinWithinRoot(%q, %q): got %q, want %q", tc.root, tc.rel, got, want)
+			}
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -25,8 +25,9 @@ import "golang.org/x/exp/maps"
 // variable that may previously exist of the same name. When the for_each loop
 // is finished, then the outer scope's variable becomes available again.
 type Scope struct {
-	vars    map[string]string // never nil
-	inherit *Scope            // is nil if this is the outermost scope.
+	vars    map[string]string  // never nil
+	types   map[string]VarType // the vars that aren't VarTypeString; may be nil
+	inherit *Scope             // is nil if this is the outermost scope.
 }
 
 func NewScope(m map[string]string) *Scope {
@@ -40,6 +41,15 @@ func NewScope(m map[string]string) *Scope {
 	}
 }
 
+// NewTypedScope is like NewScope, but the variables named in types have the
+// given type rather than VarTypeString. Their values in m must be in the
+// canonical form returned by CoerceValue.
+func NewTypedScope(m map[string]string, types map[string]VarType) *Scope {
+	s := NewScope(m)
+	s.types = maps.Clone(types)
+	return s
+}
+
 // Lookup returns the current value of a given variable name, or false.
 func (s *Scope) Lookup(name string) (string, bool) {
 	val, ok := s.vars[name]
@@ -55,6 +65,22 @@ func (s *Scope) Lookup(name string) (string, bool) {
 	return s.inherit.Lookup(name)
 }
 
+// Type returns the type of a given variable, which is VarTypeString unless
+// the variable was bound by NewTypedScope. A variable that isn't in scope
+// has VarTypeString.
+func (s *Scope) Type(name string) VarType {
+	if _, ok := s.vars[name]; ok {
+		if t, ok := s.types[name]; ok {
+			return t
+		}
+		return VarTypeString
+	}
+	if s.inherit == nil {
+		return VarTypeString
+	}
+	return s.inherit.Type(name)
+}
+
 // With returns a new scope containing a new set of variable values. It forwards
 // lookups to the previously existing scope if the lookup key is not found in m.
 func (s *Scope) With(m map[string]string) *Scope {
@@ -138,3 +138,23 @@ func TestScopeDeepNesting(t *testing.T) {
 		t.Errorf("output map wasn't as expected (-got,+want): %s", diff)
 	}
 }
+
+func TestScopeType(t *testing.T) {
+	t.Parallel()
+
+	scope := NewTypedScope(
+		map[string]string{"enabled": "true", "shadowed": "3", "name": "x"},
+		map[string]VarType{"enabled": VarTypeBool, "shadowed": VarTypeInt},
+	).With(map[string]string{"shadowed": "not an int"})
+
+	for name, want := range map[string]VarType{
+		"enabled":  VarTypeBool,
+		"shadowed": VarTypeString, // the inner scope's var isn't typed
+		"name":     VarTypeString,
+		"missing":  VarTypeString,
+	} {
+		if got := scope.Type(name); got != want {
+			t.Errorf("Type(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
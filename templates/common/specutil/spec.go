@@ -21,9 +21,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"text/tabwriter"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/decode"
 	spec "github.com/abcxyz/abc/templates/model/spec/v1beta4"
 )
@@ -36,6 +38,8 @@ const (
 	OutputDescriptionKey       = "Description"
 	OutputInputNameKey         = "Input name"
 	OutputInputDefaultValueKey = "Default"
+	OutputInputDefaultFromKey  = "Default from"
+	OutputInputTypeKey         = "Type"
 	OutputInputRuleKey         = "Rule"
 )
 
@@ -67,6 +71,9 @@ func AllInputAttrs(spec *spec.Spec) [][]string {
 func OneInputAttrs(input *spec.Input) [][]string {
 	l := make([][]string, 0)
 	l = append(l, []string{OutputInputNameKey, input.Name.Val}, []string{OutputDescriptionKey, input.Desc.Val})
+	if input.Type.Val != "" && input.Type.Val != "string" {
+		l = append(l, []string{OutputInputTypeKey, input.Type.Val})
+	}
 	if input.Default != nil {
 		defaultStr := input.Default.Val
 		if defaultStr == "" {
@@ -76,6 +83,9 @@ func OneInputAttrs(input *spec.Input) [][]string {
 		}
 		l = append(l, []string{OutputInputDefaultValueKey, defaultStr})
 	}
+	if input.DefaultFrom.Val != "" {
+		l = append(l, []string{OutputInputDefaultFromKey, input.DefaultFrom.Val})
+	}
 
 	for idx, rule := range input.Rules {
 		l = append(l, []string{fmt.Sprintf("%s %v", OutputInputRuleKey, idx), rule.Rule.Val})
@@ -136,3 +146,48 @@ func Load(ctx context.Context, fs common.FS, templateDir, source string) (*spec.
 
 	return spec, nil
 }
+
+// WriteInlineFiles writes the "files" of a spec into its template directory,
+// so the steps can use them like any other template file. It's only for
+// template directories that will be rendered, since a packaged or vendored
+// template must keep its files inline.
+func WriteInlineFiles(fs common.FS, templateDir string, s *spec.Spec) error {
+	paths := make([]string, 0, len(s.Files))
+	for p := range s.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		contents := s.Files[p]
+		dst := filepath.Join(templateDir, filepath.FromSlash(p))
+		if _, err := fs.Stat(dst); err == nil {
+			return contents.Pos.Errorf(`the file %q in "files" is also in the template directory; remove one of them`, p)
+		} else if !common.IsStatNotExistErr(err) {
+			return fmt.Errorf("Stat(): %w", err)
+		}
+		if err := fs.MkdirAll(filepath.Dir(dst), common.OwnerRWXPerms); err != nil {
+			return fmt.Errorf("MkdirAll(): %w", err)
+		}
+		if err := fs.WriteFile(dst, []byte(contents.Val), common.OwnerRWPerms); err != nil {
+			return fmt.Errorf("WriteFile(): %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadAPIVersion returns the api_version of the spec.yaml in the given
+// directory, as written in the file, before any upgrade by Load.
+func LoadAPIVersion(fs common.FS, templateDir string) (model.String, error) {
+	f, err := fs.Open(filepath.Join(templateDir, SpecFileName))
+	if err != nil {
+		return model.String{}, fmt.Errorf("error opening template spec: Open(): %w", err)
+	}
+	defer f.Close()
+
+	apiVersion, err := decode.APIVersion(f, SpecFileName)
+	if err != nil {
+		return model.String{}, fmt.Errorf("error reading template spec file: %w", err)
+	}
+	return apiVersion, nil
+}
@@ -156,6 +156,44 @@ func TestSingleSpecInputVarForDescribe(t *testing.T) {
 				{"Description", "desc1"},
 			},
 		},
+		{
+			name: "typed_input",
+			spec: &spec.Spec{
+				Desc: model.String{Val: "Test Description"},
+				Inputs: []*spec.Input{
+					{
+						Name:    model.String{Val: "name1"},
+						Desc:    model.String{Val: "desc1"},
+						Type:    model.String{Val: "bool"},
+						Default: &model.String{Val: "false"},
+					},
+				},
+			},
+			want: [][]string{
+				{"Input name", "name1"},
+				{"Description", "desc1"},
+				{"Type", "bool"},
+				{"Default", "false"},
+			},
+		},
+		{
+			name: "default_from",
+			spec: &spec.Spec{
+				Desc: model.String{Val: "Test Description"},
+				Inputs: []*spec.Input{
+					{
+						Name:        model.String{Val: "name1"},
+						Desc:        model.String{Val: "desc1"},
+						DefaultFrom: model.String{Val: `project_id + "-sa"`},
+					},
+				},
+			},
+			want: [][]string{
+				{"Input name", "name1"},
+				{"Description", "desc1"},
+				{"Default from", `project_id + "-sa"`},
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -0,0 +1,177 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkMode says what CopyRecursive does with a symlink in the source
+// directory tree.
+type SymlinkMode string
+
+const (
+	// SymlinksFollow copies the file or directory that a symlink points to, as
+	// if it were in the symlink's place. The target must resolve to somewhere
+	// inside the directory tree being copied. This is the default.
+	SymlinksFollow SymlinkMode = "follow"
+
+	// SymlinksPreserve creates a symlink with the same target in the
+	// destination. The target must be a relative path that stays inside the
+	// directory tree being copied.
+	SymlinksPreserve SymlinkMode = "preserve"
+
+	// SymlinksReject returns an error for any symlink.
+	SymlinksReject SymlinkMode = "reject"
+)
+
+// SymlinkModes are the valid values of SymlinkMode, as strings for use in
+// flag help and error messages.
+var SymlinkModes = []string{string(SymlinksFollow), string(SymlinksPreserve), string(SymlinksReject)}
+
+// ParseSymlinkMode converts a flag value to a SymlinkMode. The empty string
+// means SymlinksFollow.
+func ParseSymlinkMode(s string) (SymlinkMode, error) {
+	switch SymlinkMode(s) {
+	case "", SymlinksFollow:
+		return SymlinksFollow, nil
+	case SymlinksPreserve, SymlinksReject:
+		return SymlinkMode(s), nil
+	default:
+		return "", fmt.Errorf("invalid symlink mode %q, must be one of %s", s, strings.Join(SymlinkModes, ", "))
+	}
+}
+
+// maxSymlinkDepth is the maximum number of symlinked directories that may be
+// nested inside each other when following symlinks. This stops symlink cycles
+// from being copied forever. It's well under the OS limits on the number of
+// symlinks in a path, so that the error message can be clear.
+const maxSymlinkDepth = 20
+
+// maxSymlinkHops is the maximum number of symlinks that evalSymlinks follows
+// while resolving a single path, like the OS limit.
+const maxSymlinkHops = 255
+
+// SymlinkFS is implemented by filesystems that support symlinks. It's separate
+// from FS so that filesystems that don't have symlinks, like MemFS, don't
+// need to implement it.
+type SymlinkFS interface {
+	// These methods correspond to methods in the "os" package of the same name.
+	Lstat(string) (fs.FileInfo, error)
+	Readlink(string) (string, error)
+	Symlink(string, string) error
+}
+
+var _ SymlinkFS = (*RealFS)(nil)
+
+func (r *RealFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name) //nolint:wrapcheck
+}
+
+func (r *RealFS) Readlink(name string) (string, error) {
+	return os.Readlink(name) //nolint:wrapcheck
+}
+
+func (r *RealFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname) //nolint:wrapcheck
+}
+
+// ReadlinkIfSymlink returns the target of the symlink at the given path and
+// true. If the path isn't a symlink, or if rfs doesn't support symlinks, it
+// returns false.
+func ReadlinkIfSymlink(rfs FS, path string) (string, bool, error) {
+	sfs, ok := rfs.(SymlinkFS)
+	if !ok {
+		return "", false, nil
+	}
+	fi, err := sfs.Lstat(path)
+	if err != nil {
+		return "", false, fmt.Errorf("Lstat(): %w", err)
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		return "", false, nil
+	}
+	target, err := sfs.Readlink(path)
+	if err != nil {
+		return "", false, fmt.Errorf("Readlink(): %w", err)
+	}
+	return target, true, nil
+}
+
+// checkPreservedSymlink returns an error if a symlink at relPath (relative to
+// the root of the tree being copied) with the given target can't be preserved.
+// A preserved symlink that pointed outside the tree could be used to read or
+// write files elsewhere, so only relative targets inside the tree are allowed.
+func checkPreservedSymlink(relPath, target string) error {
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("symlink %q has an absolute target %q; only relative targets can be preserved", relPath, target)
+	}
+	if !filepath.IsLocal(filepath.Join(filepath.Dir(relPath), target)) {
+		return fmt.Errorf("symlink %q has target %q, which is outside the directory being copied", relPath, target)
+	}
+	return nil
+}
+
+// evalSymlinks is like filepath.EvalSymlinks, but reads the symlinks through
+// sfs. It returns the absolute path that path refers to, with no symlinks in
+// it.
+func evalSymlinks(sfs SymlinkFS, path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs(): %w", err)
+	}
+	sep := string(filepath.Separator)
+	vol := filepath.VolumeName(path)
+	resolved := vol + sep
+	remaining := strings.Split(path[len(vol):], sep)
+	for hops := 0; len(remaining) > 0; {
+		part := remaining[0]
+		remaining = remaining[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		fi, err := sfs.Lstat(next)
+		if err != nil {
+			return "", fmt.Errorf("Lstat(): %w", err)
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return "", fmt.Errorf("too many levels of symlinks in %q", path)
+		}
+		target, err := sfs.Readlink(next)
+		if err != nil {
+			return "", fmt.Errorf("Readlink(): %w", err)
+		}
+		if filepath.IsAbs(target) {
+			vol := filepath.VolumeName(target)
+			resolved, target = vol+sep, target[len(vol):]
+		}
+		remaining = append(strings.Split(target, sep), remaining...)
+	}
+	return resolved, nil
+}
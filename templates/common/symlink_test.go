@@ -0,0 +1,300 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/abc/templates/model"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestCopyRecursive_Symlinks(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name                  string
+		srcFiles              map[string]string
+		srcSymlinks           map[string]string
+		dstDirInitialContents map[string]string
+		dstInitialSymlinks    map[string]string
+		mode                  SymlinkMode
+		overwrite             bool
+		want                  map[string]string
+		wantSymlinks          map[string]string
+		wantOutSymlinks       map[string]string
+		wantHashesHex         map[string]string
+		wantErr               string
+	}{
+		{
+			name:     "follow_file",
+			srcFiles: map[string]string{"file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"link.txt": "file.txt",
+			},
+			want: map[string]string{
+				"file.txt": "contents",
+				"link.txt": "contents",
+			},
+		},
+		{
+			name:     "follow_dir",
+			srcFiles: map[string]string{"dir/file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"linkdir": "dir",
+			},
+			mode: SymlinksFollow,
+			want: map[string]string{
+				"dir/file.txt":     "contents",
+				"linkdir/file.txt": "contents",
+			},
+		},
+		{
+			name:     "follow_dir_outside_fails",
+			srcFiles: map[string]string{"file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"root": "/",
+			},
+			wantErr: `symlink "root" points to "/", which is outside the directory being copied`,
+		},
+		{
+			name:     "follow_file_outside_fails",
+			srcFiles: map[string]string{"dir/file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"dir/link.txt": "/dev/null",
+			},
+			wantErr: `symlink "dir/link.txt" points to "/dev/null", which is outside the directory being copied`,
+		},
+		{
+			name:     "follow_chain_outside_fails",
+			srcFiles: map[string]string{"dir/file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				// Each link's target is inside the tree, but the second one
+				// leads out of it.
+				"link":   "dir/up",
+				"dir/up": "../..",
+			},
+			wantErr: `symlink "dir/up" points to`,
+		},
+		{
+			name:     "follow_dangling_fails",
+			srcFiles: map[string]string{"file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"link.txt": "nonexistent.txt",
+			},
+			wantErr: `failed following symlink "link.txt"`,
+		},
+		{
+			name:     "follow_cycle_fails",
+			srcFiles: map[string]string{"dir/file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"dir/parent": "..",
+			},
+			wantErr: "too many levels of symlinked directories",
+		},
+		{
+			name:     "reject",
+			srcFiles: map[string]string{"file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"link.txt": "file.txt",
+			},
+			mode:    SymlinksReject,
+			wantErr: `"link.txt" is a symlink, which isn't allowed`,
+		},
+		{
+			name:     "preserve",
+			srcFiles: map[string]string{"dir/file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"dir/link.txt": "file.txt",
+				"linkdir":      "dir",
+				"dangling":     "nonexistent",
+			},
+			mode: SymlinksPreserve,
+			want: map[string]string{
+				"dir/file.txt": "contents",
+			},
+			wantSymlinks: map[string]string{
+				"dir/link.txt": "file.txt",
+				"linkdir":      "dir",
+				"dangling":     "nonexistent",
+			},
+			wantOutSymlinks: map[string]string{
+				"dir/link.txt": "file.txt",
+				"linkdir":      "dir",
+				"dangling":     "nonexistent",
+			},
+			wantHashesHex: map[string]string{
+				"dir/file.txt": "d1b2a59fbea7e20077af9f91b27e95e865061b270be03ff539ab3b73587882e8",
+				"dir/link.txt": "aadf327c8267c09d6fffd87a1a80ad3c798469ff332b7a57b9e8c045d46b2af7",
+				"linkdir":      "2b64c6d9afd8a34ed0dbf35f7de171a8825a50d9f42f05e98fe2b1addf00ab44",
+				"dangling":     "7945bc2d6e4fd0a0be5216460557bef483a80b6af0acbcdf06866f5c473b9367",
+			},
+		},
+		{
+			name:     "preserve_outside_target_fails",
+			srcFiles: map[string]string{"dir/file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"dir/link.txt": "../../outside.txt",
+			},
+			mode:    SymlinksPreserve,
+			wantErr: `symlink "dir/link.txt" has target "../../outside.txt", which is outside the directory being copied`,
+		},
+		{
+			name:     "preserve_absolute_target_fails",
+			srcFiles: map[string]string{"file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"link.txt": "/etc/passwd",
+			},
+			mode:    SymlinksPreserve,
+			wantErr: `symlink "link.txt" has an absolute target "/etc/passwd"`,
+		},
+		{
+			name:     "preserve_existing_dest_without_overwrite_fails",
+			srcFiles: map[string]string{"file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"link.txt": "file.txt",
+			},
+			dstDirInitialContents: map[string]string{"link.txt": "existing"},
+			mode:                  SymlinksPreserve,
+			wantErr:               "destination file link.txt already exists",
+		},
+		{
+			name:     "preserve_overwrites_existing_symlink",
+			srcFiles: map[string]string{"file.txt": "contents"},
+			srcSymlinks: map[string]string{
+				"link.txt": "file.txt",
+			},
+			dstInitialSymlinks: map[string]string{"link.txt": "other.txt"},
+			mode:               SymlinksPreserve,
+			overwrite:          true,
+			want: map[string]string{
+				"file.txt": "contents",
+			},
+			wantSymlinks: map[string]string{
+				"link.txt": "file.txt",
+			},
+			wantOutSymlinks: map[string]string{
+				"link.txt": "file.txt",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			fromDir := filepath.Join(tempDir, "from_dir")
+			toDir := filepath.Join(tempDir, "to_dir")
+			abctestutil.WriteAllDefaultMode(t, fromDir, tc.srcFiles)
+			abctestutil.WriteSymlinks(t, fromDir, tc.srcSymlinks)
+			abctestutil.WriteAllDefaultMode(t, toDir, tc.dstDirInitialContents)
+			abctestutil.WriteSymlinks(t, toDir, tc.dstInitialSymlinks)
+
+			var hashes map[string][]byte
+			if tc.wantHashesHex != nil {
+				hashes = map[string][]byte{}
+			}
+			outSymlinks := map[string]string{}
+
+			err := CopyRecursive(context.Background(), &model.ConfigPos{}, &CopyParams{
+				SrcRoot:     fromDir,
+				DstRoot:     toDir,
+				FS:          &RealFS{},
+				Hasher:      sha256.New,
+				OutHashes:   hashes,
+				OutSymlinks: outSymlinks,
+				Symlinks:    tc.mode,
+				Visitor: func(string, fs.DirEntry) (CopyHint, error) {
+					return CopyHint{Overwrite: tc.overwrite}, nil
+				},
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			gotSymlinks := abctestutil.LoadSymlinks(t, toDir)
+			if diff := cmp.Diff(gotSymlinks, tc.wantSymlinks, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("destination symlinks were not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(outSymlinks, tc.wantOutSymlinks, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("OutSymlinks was not as expected (-got,+want): %s", diff)
+			}
+
+			// The symlinks were already checked, and LoadDirWithoutMode would
+			// follow them, so remove them before checking the regular files.
+			for path := range gotSymlinks {
+				if err := os.Remove(filepath.Join(toDir, path)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := abctestutil.LoadDirWithoutMode(t, toDir)
+			if diff := cmp.Diff(got, tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("destination directory was not as expected (-got,+want): %s", diff)
+			}
+
+			if tc.wantHashesHex != nil {
+				gotHashesHex := map[string]string{}
+				for path, h := range hashes {
+					gotHashesHex[path] = hex.EncodeToString(h)
+				}
+				if diff := cmp.Diff(gotHashesHex, tc.wantHashesHex); diff != "" {
+					t.Errorf("hashes were not as expected (-got,+want): %s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSymlinkMode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in      string
+		want    SymlinkMode
+		wantErr string
+	}{
+		{in: "", want: SymlinksFollow},
+		{in: "follow", want: SymlinksFollow},
+		{in: "preserve", want: SymlinksPreserve},
+		{in: "reject", want: SymlinksReject},
+		{in: "bogus", wantErr: `invalid symlink mode "bogus", must be one of follow, preserve, reject`},
+	}
+
+	for _, tc := range cases {
+		got, err := ParseSymlinkMode(tc.in)
+		if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+			t.Errorf("ParseSymlinkMode(%q): %s", tc.in, diff)
+		}
+		if got != tc.want {
+			t.Errorf("ParseSymlinkMode(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
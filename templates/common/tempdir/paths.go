@@ -14,11 +14,59 @@
 
 package tempdir
 
+import (
+	"strings"
+)
+
 const (
 	// These will be used as part of the names of the temporary directories to
 	// make them identifiable.
+	AdoptRenderNamePart       = "adopt-"
+	ArchiveDirNamePart        = "archive-"
+	BaseTemplateDirNamePart   = "base-template-copy-"
+	BucketDownloadDirNamePart = "bucket-download-"
 	DebugStepDiffsDirNamePart = "debug-step-diffs-"
+	GitCloneDirNamePart       = "git-clone-"
 	GoldenTestRenderNamePart  = "golden-test-"
+	GoldenTestVerifyNamePart  = "golden-test-verify-"
+	LintRenderDirNamePart     = "lint-render-"
 	ScratchDirNamePart        = "scratch-"
+	StepBackupDirNamePart     = "step-backup-"
 	TemplateDirNamePart       = "template-copy-"
+	TestMatrixRenderNamePart  = "test-matrix-"
+	ToStdoutDirNamePart       = "to-stdout-"
 )
+
+// namePatterns are all the name parts above. Keep this in sync with them.
+var namePatterns = []string{
+	AdoptRenderNamePart,
+	ArchiveDirNamePart,
+	BaseTemplateDirNamePart,
+	BucketDownloadDirNamePart,
+	DebugStepDiffsDirNamePart,
+	GitCloneDirNamePart,
+	GoldenTestRenderNamePart,
+	GoldenTestVerifyNamePart,
+	LintRenderDirNamePart,
+	ScratchDirNamePart,
+	StepBackupDirNamePart,
+	TemplateDirNamePart,
+	TestMatrixRenderNamePart,
+	ToStdoutDirNamePart,
+}
+
+// IsTempDirName reports whether name looks like the name of a temporary
+// directory that abc created with one of the name parts above, which is the
+// name part followed by the digits that MkdirTemp adds.
+func IsTempDirName(name string) bool {
+	for _, part := range namePatterns {
+		suffix, ok := strings.CutPrefix(name, part)
+		if !ok || suffix == "" {
+			continue
+		}
+		if strings.Trim(suffix, "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
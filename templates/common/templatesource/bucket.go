@@ -0,0 +1,377 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/archive"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	LocTypeGCS = "gcs"
+	LocTypeS3  = "s3"
+)
+
+// bucketSourceRE matches template sources like "gs://my-bucket/my/template/"
+// or "s3://my-bucket/my-template.tar.gz".
+var bucketSourceRE = regexp.MustCompile(
+	`^` + // Anchor the start, must match the entire input
+		`(?P<scheme>gs|s3)://` +
+		`(?P<bucket>[a-z0-9][a-z0-9._-]*)` + // The bucket name rules of GCS and S3 are both a subset of this
+		`(/(?P<object>.*))?` + // Optional object name or prefix; the leading slash is not part of capturing group ${object}
+		`$`) // Anchor the end, must match the entire input
+
+// IsBucketSource returns whether the given template source is a location in a
+// Google Cloud Storage or Amazon S3 bucket, like "gs://my-bucket/my-template".
+func IsBucketSource(source string) bool {
+	return bucketSourceRE.MatchString(source)
+}
+
+var _ sourceParser = (*bucketSourceParser)(nil)
+
+// bucketSourceParser implements sourceParser for downloading templates from a
+// Google Cloud Storage or Amazon S3 bucket.
+type bucketSourceParser struct{}
+
+func (b *bucketSourceParser) sourceParse(ctx context.Context, params *ParseSourceParams) (Downloader, bool, error) {
+	return newBucketDownloader(params.Source, params.FS, params.Limits, params.Retry, params.Stats, os.LookupEnv)
+}
+
+// newBucketDownloader is a fancy constructor for bucketDownloader. It returns
+// false if source isn't a gs:// or s3:// location. The clients for the bucket
+// services are configured from environment variables read with lookupEnv.
+func newBucketDownloader(source string, fs common.FS, limits *common.Limits, retry *RetryPolicy, stats *DownloadStats, lookupEnv func(string) (string, bool)) (Downloader, bool, error) {
+	match := bucketSourceRE.FindStringSubmatch(source)
+	if match == nil {
+		return nil, false, nil
+	}
+	scheme := match[bucketSourceRE.SubexpIndex("scheme")]
+	bucket := match[bucketSourceRE.SubexpIndex("bucket")]
+	object := match[bucketSourceRE.SubexpIndex("object")]
+
+	if strings.Contains(object, "@") {
+		return nil, false, fmt.Errorf("template source %q has a version, but bucket template sources don't support versions; the latest objects are always used", source)
+	}
+	isArchive := archive.IsArchiveName(object)
+	if !isArchive && object != "" && !strings.HasSuffix(object, "/") {
+		// Treat the object as a directory-like prefix, and don't match
+		// objects that merely start with the same characters.
+		object += "/"
+	}
+	for _, part := range strings.Split(strings.TrimSuffix(object, "/"), "/") {
+		if part == "." || part == ".." {
+			return nil, false, fmt.Errorf("template source %q must not contain . or .. path components", source)
+		}
+	}
+
+	var client bucketClient
+	var locType string
+	switch scheme {
+	case "gs":
+		client = newGCSClient(lookupEnv)
+		locType = LocTypeGCS
+	case "s3":
+		client = newS3Client(lookupEnv)
+		locType = LocTypeS3
+	}
+
+	return &bucketDownloader{
+		canonicalSource: scheme + "://" + bucket + "/" + object,
+		locType:         locType,
+		bucket:          bucket,
+		object:          object,
+		isArchive:       isArchive,
+		client:          client,
+		fs:              fs,
+		limits:          limits,
+		retry:           retry,
+		stats:           stats,
+	}, true, nil
+}
+
+// bucketObject is an object in a bucket, as returned by a bucketClient.
+type bucketObject struct {
+	// The full name of the object, like "my/template/spec.yaml".
+	name string
+
+	// version identifies the contents of the object. For GCS, this is the
+	// object generation. For S3, it's the ETag.
+	version string
+}
+
+// bucketClient is the part of a cloud storage API that's needed to download
+// templates. It's implemented for GCS and S3.
+type bucketClient interface {
+	// list returns every object in bucket whose name starts with prefix.
+	list(ctx context.Context, bucket, prefix string) ([]*bucketObject, error)
+
+	// get returns the contents of obj. If maxBytes isn't negative and obj is
+	// larger than that, it stops reading and returns errObjectTooLarge.
+	get(ctx context.Context, bucket string, obj *bucketObject, maxBytes int64) ([]byte, error)
+}
+
+// errObjectTooLarge is returned by bucketClient.get when an object is larger
+// than the given maximum.
+var errObjectTooLarge = errors.New("the object is too large")
+
+// bucketDownloader implements Downloader for templates stored in a cloud
+// storage bucket, either as separate objects under a common prefix (like files
+// in a directory), or as a single archive object.
+type bucketDownloader struct {
+	canonicalSource string
+	locType         string
+
+	bucket string
+
+	// object is either the name of an archive object, or a prefix ending in
+	// "/" (or empty, for the whole bucket).
+	object    string
+	isArchive bool
+
+	client bucketClient
+
+	// fs is the filesystem that the template is downloaded into. If nil, the
+	// real filesystem is used.
+	fs common.FS
+
+	// limits is an optional limit on the size of the template. If nil, there
+	// are no limits.
+	limits *common.Limits
+
+	// retry controls how failed requests to the bucket service are retried.
+	// If nil, DefaultRetryPolicy is used.
+	retry *RetryPolicy
+
+	// stats is optional, and if non-nil, records the download.
+	stats *DownloadStats
+}
+
+// Download implements Downloader.
+func (b *bucketDownloader) Download(ctx context.Context, cwd, destDir string) (_ *DownloadMetadata, rErr error) {
+	logger := logging.FromContext(ctx).With("logger", "bucketDownloader.Download")
+
+	start := time.Now()
+	var objects []*bucketObject
+	if err := b.retry.retry(ctx, b.stats, "list "+b.canonicalSource, func() error {
+		var err error
+		objects, err = b.client.list(ctx, b.bucket, b.object)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if b.isArchive {
+		// Listing a prefix also returns objects whose names merely start with
+		// the archive's name, like "template.tar.gz.sig".
+		objects = filterObjects(objects, func(o *bucketObject) bool { return o.name == b.object })
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("there are no objects at %q", b.canonicalSource)
+	}
+	if !b.isArchive && b.limits != nil && b.limits.MaxFiles > 0 {
+		// Placeholder objects for empty "directories" aren't downloaded, so
+		// they don't count as files.
+		files := filterObjects(objects, func(o *bucketObject) bool { return !strings.HasSuffix(o.name, "/") })
+		if len(files) > b.limits.MaxFiles {
+			return nil, fmt.Errorf("there are more than %d objects at %q, which is the limit set by --max-files",
+				b.limits.MaxFiles, b.canonicalSource)
+		}
+	}
+
+	// The objects are written to a temporary directory on the real
+	// filesystem and then copied to destDir, so that the limits are enforced
+	// the same way as for other kinds of templates.
+	tempTracker := tempdir.NewDirTracker(&common.RealFS{}, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+	tmpDir, err := tempTracker.MkdirTempTracked("", tempdir.BucketDownloadDirNamePart)
+	if err != nil {
+		return nil, fmt.Errorf("MkdirTemp: %w", err)
+	}
+
+	var version string
+	var size int64
+	if b.isArchive {
+		obj := objects[0]
+		buf, err := b.get(ctx, obj, size)
+		if err != nil {
+			return nil, err
+		}
+		size = int64(len(buf))
+		if err := archive.Extract(ctx, &common.RealFS{}, obj.name, buf, tmpDir); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		version = obj.version
+	} else {
+		for _, obj := range objects {
+			rel := strings.TrimPrefix(obj.name, b.object)
+			if rel == "" || strings.HasSuffix(rel, "/") {
+				// A placeholder object for an empty "directory".
+				continue
+			}
+			if !filepath.IsLocal(filepath.FromSlash(rel)) {
+				return nil, fmt.Errorf("the object %q would be downloaded outside of the template directory", obj.name)
+			}
+			buf, err := b.get(ctx, obj, size)
+			if err != nil {
+				return nil, err
+			}
+			size += int64(len(buf))
+			dst := filepath.Join(tmpDir, filepath.FromSlash(rel))
+			if err := os.MkdirAll(filepath.Dir(dst), common.OwnerRWXPerms); err != nil {
+				return nil, fmt.Errorf("MkdirAll(): %w", err)
+			}
+			if err := os.WriteFile(dst, buf, common.OwnerRWPerms); err != nil {
+				return nil, fmt.Errorf("WriteFile(): %w", err)
+			}
+		}
+		version = prefixVersion(b.object, objects)
+	}
+
+	logger.DebugContext(ctx, "downloaded template from bucket",
+		"source", b.canonicalSource,
+		"objects", len(objects),
+		"version", version)
+	b.stats.addDownload(size, time.Since(start))
+
+	if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+		DstRoot: destDir,
+		SrcRoot: tmpDir,
+		FS:      fsOrReal(b.fs),
+		SrcFS:   &common.RealFS{},
+		Limits:  b.limits,
+	}); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return &DownloadMetadata{
+		IsCanonical:     true, // Bucket locations are the same for everybody.
+		CanonicalSource: b.canonicalSource,
+		LocationType:    b.locType,
+		HasVersion:      true,
+		Version:         version,
+	}, nil
+}
+
+// get returns the contents of obj, with retries. downloaded is the number of
+// bytes already downloaded, which counts toward --max-bytes along with obj, so
+// an object that's too large is rejected without reading all of it.
+func (b *bucketDownloader) get(ctx context.Context, obj *bucketObject, downloaded int64) ([]byte, error) {
+	maxBytes := int64(-1)
+	if b.limits != nil && b.limits.MaxBytes > 0 {
+		maxBytes = b.limits.MaxBytes - downloaded
+	}
+	var out []byte
+	err := b.retry.retry(ctx, b.stats, "get "+obj.name, func() error {
+		var err error
+		out, err = b.client.get(ctx, b.bucket, obj, maxBytes)
+		return err
+	})
+	if errors.Is(err, errObjectTooLarge) {
+		return nil, fmt.Errorf("the objects at %q total more than %d bytes, which is the limit set by --max-bytes (reached at %q)",
+			b.canonicalSource, b.limits.MaxBytes, obj.name)
+	}
+	return out, err
+}
+
+// prefixVersion computes a version for the template made of the given objects
+// under prefix. There's no single object generation or ETag for a group of
+// objects, so this is a fingerprint of all of their names and versions, which
+// changes whenever any object is added, removed, or changed.
+func prefixVersion(prefix string, objects []*bucketObject) string {
+	lines := make([]string, 0, len(objects))
+	for _, o := range objects {
+		lines = append(lines, strings.TrimPrefix(o.name, prefix)+" "+o.version)
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return "sha256-" + hex.EncodeToString(sum[:])[:16]
+}
+
+func filterObjects(objects []*bucketObject, keep func(*bucketObject) bool) []*bucketObject {
+	var out []*bucketObject
+	for _, o := range objects {
+		if keep(o) {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// bucketUpgradeDownloaderFactory returns a downloader for the latest objects
+// at a gs:// or s3:// canonical location from a manifest.
+func bucketUpgradeDownloaderFactory(ctx context.Context, canonicalLocation, gitProtocol, destDir string) (Downloader, error) {
+	downloader, ok, err := newBucketDownloader(canonicalLocation, nil, nil, nil, nil, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("failed parsing canonical location %q as a gs:// or s3:// location", canonicalLocation)
+	}
+	return downloader, nil
+}
+
+// doBucketRequest sends req and returns the response body, or an error that
+// includes the start of the body if the response status isn't 200. Errors
+// that might go away when the request is retried are marked as transient. If
+// maxBytes isn't negative and the body is longer than that, it stops reading
+// and returns errObjectTooLarge.
+func doBucketRequest(client *http.Client, req *http.Request, maxBytes int64) (_ []byte, rErr error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Redacted(), err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, resp.Body.Close())
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		const maxErrBody = 512
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrBody))
+		err := fmt.Errorf("%s %s: got status %q: %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(body)))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return nil, &transientError{err}
+		}
+		return nil, err
+	}
+
+	r := io.Reader(resp.Body)
+	if maxBytes >= 0 {
+		// Read one byte past the limit, to tell whether the body exceeds it.
+		r = io.LimitReader(r, maxBytes+1)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &transientError{fmt.Errorf("failed reading response to %s %s: %w", req.Method, req.URL.Redacted(), err)}
+	}
+	if maxBytes >= 0 && int64(len(body)) > maxBytes {
+		return nil, errObjectTooLarge
+	}
+	return body, nil
+}
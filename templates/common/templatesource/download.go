@@ -65,6 +65,12 @@ type DownloadMetadata struct {
 
 	// Values for template variables like _git_tag and _git_sha.
 	Vars DownloaderVars
+
+	// Dirhash is the common.HashTemplateDir of the downloaded template. A
+	// Downloader that knows what it should be, like from the annotations of a
+	// published package, can set it, and DownloadVerified fails if the
+	// download doesn't match. Otherwise DownloadVerified fills it in.
+	Dirhash string
 }
 
 // Values for template variables like _git_tag and _git_sha.
@@ -72,4 +78,10 @@ type DownloaderVars struct {
 	GitTag      string
 	GitSHA      string
 	GitShortSHA string
+
+	// GitCommitTime is the commit time of GitSHA, in UTC, formatted as RFC
+	// 3339, like "2024-01-02T15:04:05Z".
+	GitCommitTime  string
+	GitAuthorName  string
+	GitAuthorEmail string
 }
@@ -0,0 +1,129 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultGCSEndpoint = "https://storage.googleapis.com"
+
+var _ bucketClient = (*gcsClient)(nil)
+
+// gcsClient implements bucketClient using the Google Cloud Storage JSON API.
+type gcsClient struct {
+	// endpoint is the base URL of the API, like
+	// "https://storage.googleapis.com".
+	endpoint string
+
+	// token is an OAuth2 access token. If empty, requests are anonymous, which
+	// only works for public buckets.
+	token string
+
+	httpClient *http.Client
+}
+
+// newGCSClient configures a gcsClient from environment variables:
+//
+//   - GOOGLE_OAUTH_ACCESS_TOKEN is the access token, like the output of
+//     "gcloud auth print-access-token". Application Default Credentials
+//     aren't used, so without this, only public buckets can be read.
+//   - STORAGE_EMULATOR_HOST, if set, is the host:port of a GCS emulator to use
+//     instead of the real service.
+func newGCSClient(lookupEnv func(string) (string, bool)) *gcsClient {
+	c := &gcsClient{
+		endpoint:   defaultGCSEndpoint,
+		httpClient: http.DefaultClient,
+	}
+	if token, ok := lookupEnv("GOOGLE_OAUTH_ACCESS_TOKEN"); ok {
+		c.token = token
+	}
+	if host, ok := lookupEnv("STORAGE_EMULATOR_HOST"); ok && host != "" {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		c.endpoint = strings.TrimSuffix(host, "/")
+	}
+	return c
+}
+
+// list implements bucketClient.
+func (c *gcsClient) list(ctx context.Context, bucket, prefix string) ([]*bucketObject, error) {
+	var out []*bucketObject
+	pageToken := ""
+	for {
+		q := url.Values{}
+		q.Set("prefix", prefix)
+		q.Set("fields", "items(name,generation),nextPageToken")
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		u := fmt.Sprintf("%s/storage/v1/b/%s/o?%s", c.endpoint, url.PathEscape(bucket), q.Encode())
+
+		body, err := c.do(ctx, u, -1)
+		if err != nil {
+			return nil, fmt.Errorf("failed listing objects in GCS bucket %q: %w", bucket, err)
+		}
+		var page struct {
+			Items []struct {
+				Name       string `json:"name"`
+				Generation string `json:"generation"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("failed parsing the list of objects in GCS bucket %q: %w", bucket, err)
+		}
+		for _, item := range page.Items {
+			out = append(out, &bucketObject{name: item.Name, version: item.Generation})
+		}
+		if page.NextPageToken == "" {
+			return out, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// get implements bucketClient. The listed generation of the object is
+// requested, so all of a template's objects come from the same listing even if
+// they're changed while downloading.
+func (c *gcsClient) get(ctx context.Context, bucket string, obj *bucketObject, maxBytes int64) ([]byte, error) {
+	q := url.Values{}
+	q.Set("alt", "media")
+	q.Set("generation", obj.version)
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?%s", c.endpoint, url.PathEscape(bucket), url.PathEscape(obj.name), q.Encode())
+
+	body, err := c.do(ctx, u, maxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed downloading object %q from GCS bucket %q: %w", obj.name, bucket, err)
+	}
+	return body, nil
+}
+
+func (c *gcsClient) do(ctx context.Context, u string, maxBytes int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("NewRequest(): %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return doBucketRequest(c.httpClient, req, maxBytes)
+}
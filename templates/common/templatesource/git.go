@@ -29,6 +29,29 @@ const (
 	LocTypeRemoteGit = "remote_git"
 )
 
+// dirtySuffix is appended to the version of a template whose git workspace has
+// uncommitted changes, with --allow-dirty-template.
+const dirtySuffix = "-dirty"
+
+// dirtyMode says what gitCanonicalVersion does when the git workspace has
+// uncommitted changes.
+type dirtyMode int
+
+const (
+	// dirtyOmit means there's no version, since it wouldn't describe the
+	// template's actual contents.
+	dirtyOmit dirtyMode = iota
+
+	// dirtyMark means the version is the HEAD tag or SHA with dirtySuffix
+	// appended.
+	dirtyMark
+
+	// dirtyIgnore means the version is the HEAD tag or SHA, as if the workspace
+	// were clean. It's too hard in tests to generate a clean git repo, so this
+	// is only for tests.
+	dirtyIgnore
+)
+
 // gitCanonicalVersion examines a template directory and tries to determine the
 // "best" template version by looking at .git. The "best" template version is
 // defined as (in decreasing order of precedence):
@@ -40,12 +63,12 @@ const (
 // It returns false if:
 //
 //   - the given directory is not in a git workspace
-//   - the git workspace is not clean (uncommitted changes) (for testing, you
-//     can provide allowDirty=true to override this)
+//   - the git workspace is not clean (uncommitted changes), unless dirty is
+//     dirtyMark or dirtyIgnore
 //
 // It returns error only if something weird happened when running git commands.
 // The returned string is always empty if the boolean is false.
-func gitCanonicalVersion(ctx context.Context, dir string, allowDirty bool) (string, bool, error) {
+func gitCanonicalVersion(ctx context.Context, dir string, dirty dirtyMode) (string, bool, error) {
 	logger := logging.FromContext(ctx).With("logger", "CanonicalVersion")
 
 	_, ok, err := git.Workspace(ctx, dir)
@@ -56,12 +79,19 @@ func gitCanonicalVersion(ctx context.Context, dir string, allowDirty bool) (stri
 		return "", false, nil
 	}
 
-	if !allowDirty {
+	suffix := ""
+	if dirty != dirtyIgnore {
 		ok, err = git.IsClean(ctx, dir)
 		if err != nil {
 			return "", false, err //nolint:wrapcheck
 		}
-		if !ok {
+		switch {
+		case ok:
+		case dirty == dirtyMark:
+			logger.WarnContext(ctx, "the template git workspace is dirty, so its version is marked as dirty",
+				"source_git_workspace", dir)
+			suffix = dirtySuffix
+		default:
 			logger.WarnContext(ctx, "omitting template git version from manifest because the workspace is dirty",
 				"source_git_workspace", dir)
 			return "", false, nil
@@ -73,14 +103,14 @@ func gitCanonicalVersion(ctx context.Context, dir string, allowDirty bool) (stri
 		return "", false, err
 	}
 	if ok {
-		return tag, true, nil
+		return tag + suffix, true, nil
 	}
 
 	sha, err := git.CurrentSHA(ctx, dir)
 	if err != nil {
 		return "", false, err //nolint:wrapcheck
 	}
-	return sha, true, nil
+	return sha + suffix, true, nil
 }
 
 // bestHeadTag returns the tag that points to the current HEAD SHA. If there are
@@ -0,0 +1,371 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	defaultGitHubAPIEndpoint = "https://api.github.com"
+
+	// githubTagsPerPage is the largest page size that the GitHub API allows.
+	githubTagsPerPage = 100
+
+	githubMaxRetries     = 4
+	githubInitialBackoff = time.Second
+	githubMaxBackoff     = time.Minute
+)
+
+// githubRemoteRE matches the git remotes of repos on github.com, in either the
+// https or the ssh form that gitRemote creates.
+var githubRemoteRE = regexp.MustCompile(
+	`^(https://github\.com/|git@github\.com:)` +
+		`(?P<org>[a-zA-Z0-9_-]+)/(?P<repo>[a-zA-Z0-9_.-]+?)(\.git)?$`)
+
+// githubLinkNextRE finds the URL of the next page in a Link response header.
+var githubLinkNextRE = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// errGitHubRateLimited means that the GitHub API's rate limit was still
+// exceeded after retrying.
+var errGitHubRateLimited = errors.New("the GitHub API rate limit was exceeded")
+
+// githubTagsClient lists the tags of github.com repos using the GitHub REST
+// API. Unlike "git ls-remote", this can use conditional requests: the ETag of
+// each page of tags is saved in an on-disk cache, and a page that hasn't
+// changed comes back as "304 Not Modified", which doesn't count against the
+// API's rate limit. When the rate limit is exceeded anyway, requests are
+// retried with exponential backoff, and if that doesn't help, the cached tags
+// are used.
+type githubTagsClient struct {
+	// endpoint is the base URL of the API, like "https://api.github.com".
+	endpoint string
+
+	// token is a GitHub token. If empty, requests are anonymous, which have a
+	// much lower rate limit and only work for public repos.
+	token string
+
+	// cacheDir is the directory that the tags and ETags of each repo are
+	// saved in. If empty, nothing is cached.
+	cacheDir string
+
+	httpClient *http.Client
+
+	// sleep waits for d, or until ctx is done.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// newGitHubTagsClient configures a githubTagsClient. The token is read from
+// the GITHUB_TOKEN or GH_TOKEN environment variable with lookupEnv, and the
+// tags are cached in ~/.abc/cache/github-tags.
+func newGitHubTagsClient(lookupEnv func(string) (string, bool)) *githubTagsClient {
+	c := &githubTagsClient{
+		endpoint:   defaultGitHubAPIEndpoint,
+		httpClient: http.DefaultClient,
+		sleep:      sleepCtx,
+	}
+	for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token, ok := lookupEnv(name); ok && token != "" {
+			c.token = token
+			break
+		}
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		c.cacheDir = filepath.Join(homeDir, ".abc", "cache", "github-tags")
+	}
+	return c
+}
+
+// githubTagsCache is the cache file of one repo.
+type githubTagsCache struct {
+	// Pages are the pages of the tags listing, in order.
+	Pages []*githubTagsPage `json:"pages"`
+}
+
+type githubTagsPage struct {
+	ETag    string   `json:"etag"`
+	Tags    []string `json:"tags"`
+	HasNext bool     `json:"has_next"`
+}
+
+// tags returns the tags of the github.com repo org/repo.
+func (c *githubTagsClient) tags(ctx context.Context, org, repo string) ([]string, error) {
+	logger := logging.FromContext(ctx).With("logger", "githubTagsClient.tags")
+
+	cache := c.loadCache(ctx, org, repo)
+	fresh := &githubTagsCache{}
+	u := fmt.Sprintf("%s/repos/%s/%s/tags?per_page=%d", c.endpoint, org, repo, githubTagsPerPage)
+	for i := 0; u != ""; i++ {
+		var cached *githubTagsPage
+		if cache != nil && i < len(cache.Pages) {
+			cached = cache.Pages[i]
+		}
+		page, next, err := c.getPage(ctx, u, cached)
+		if err != nil {
+			if cache == nil {
+				return nil, err
+			}
+			// Old tags are better than none; at worst, "latest" is an older
+			// release.
+			logger.WarnContext(ctx, "failed listing tags with the GitHub API, using the cached tags instead",
+				"repo", org+"/"+repo,
+				"error", err)
+			return cache.allTags(), nil
+		}
+		fresh.Pages = append(fresh.Pages, page)
+		u = next
+	}
+
+	c.saveCache(ctx, org, repo, fresh)
+	return fresh.allTags(), nil
+}
+
+// getPage gets one page of tags from the URL u. If cached is non-nil, the
+// request is conditional on its ETag, and it's returned if the page hasn't
+// changed. The returned string is the URL of the next page, or empty if this
+// is the last one.
+func (c *githubTagsClient) getPage(ctx context.Context, u string, cached *githubTagsPage) (*githubTagsPage, string, error) {
+	resp, err := c.doWithRetries(ctx, u, cached)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		next := ""
+		if cached.HasNext {
+			next = nextPageURL(resp.Header)
+			if next == "" {
+				// Not every 304 has a Link header, so build it.
+				next = withPage(u, pageNumber(u)+1)
+			}
+		}
+		return cached, next, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, "", fmt.Errorf("GET %s: got status %q: %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tags []struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, "", fmt.Errorf("failed parsing the tags from %s: %w", u, err)
+	}
+	page := &githubTagsPage{ETag: resp.Header.Get("ETag")}
+	for _, t := range tags {
+		page.Tags = append(page.Tags, t.Name)
+	}
+	next := nextPageURL(resp.Header)
+	page.HasNext = next != ""
+	return page, next, nil
+}
+
+// doWithRetries sends a GET request for u, retrying with exponential backoff
+// when the rate limit is exceeded or the server has a temporary problem. The
+// caller must close the body of the returned response.
+func (c *githubTagsClient) doWithRetries(ctx context.Context, u string, cached *githubTagsPage) (*http.Response, error) {
+	logger := logging.FromContext(ctx).With("logger", "githubTagsClient.doWithRetries")
+
+	backoff := githubInitialBackoff
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, fmt.Errorf("NewRequest(): %w", err)
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if cached != nil && cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("GET %s: %w", u, err)
+		}
+		wait, retry := retryDelay(resp, backoff)
+		if !retry {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if attempt == githubMaxRetries {
+			if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+				return nil, fmt.Errorf("GET %s: %w", u, errGitHubRateLimited)
+			}
+			return nil, fmt.Errorf("GET %s: got status %q after %d retries", u, resp.Status, attempt)
+		}
+		logger.DebugContext(ctx, "retrying GitHub API request",
+			"url", u,
+			"status", resp.Status,
+			"wait", wait)
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		backoff = min(2*backoff, githubMaxBackoff)
+	}
+}
+
+// retryDelay returns true if resp should be retried, and how long to wait
+// first. A wait given by the server is used if it isn't too long, and
+// otherwise backoff.
+func retryDelay(resp *http.Response, backoff time.Duration) (time.Duration, bool) {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusForbidden && (resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""):
+		// The rate limit was exceeded. A 403 without these headers is a
+		// permissions problem, which retrying won't fix.
+	case resp.StatusCode >= 500:
+		return backoff, true
+	default:
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+		return min(time.Duration(secs)*time.Second, githubMaxBackoff), true
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		if wait := time.Until(time.Unix(reset, 0)); wait > 0 && wait <= githubMaxBackoff {
+			return wait, true
+		}
+	}
+	return backoff, true
+}
+
+// loadCache returns the cached tags of org/repo, or nil if there aren't any.
+func (c *githubTagsClient) loadCache(ctx context.Context, org, repo string) *githubTagsCache {
+	if c.cacheDir == "" {
+		return nil
+	}
+	buf, err := os.ReadFile(c.cachePath(org, repo))
+	if err != nil {
+		if !common.IsStatNotExistErr(err) {
+			logging.FromContext(ctx).WarnContext(ctx, "failed reading GitHub tags cache", "error", err)
+		}
+		return nil
+	}
+	out := &githubTagsCache{}
+	if err := json.Unmarshal(buf, out); err != nil || len(out.Pages) == 0 {
+		// A corrupt cache is just ignored, and replaced.
+		return nil
+	}
+	return out
+}
+
+// saveCache saves the tags of org/repo. The cache is only an optimization, so
+// failures are logged but otherwise ignored.
+func (c *githubTagsClient) saveCache(ctx context.Context, org, repo string, cache *githubTagsCache) {
+	if c.cacheDir == "" {
+		return
+	}
+	logger := logging.FromContext(ctx).With("logger", "githubTagsClient.saveCache")
+	buf, err := json.Marshal(cache)
+	if err != nil {
+		logger.WarnContext(ctx, "failed marshaling GitHub tags cache", "error", err)
+		return
+	}
+	if err := os.MkdirAll(c.cacheDir, common.OwnerRWXPerms); err != nil {
+		logger.WarnContext(ctx, "failed creating GitHub tags cache directory", "error", err)
+		return
+	}
+	// Write and rename, so concurrent abc processes never see a partial file.
+	path := c.cachePath(org, repo)
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, buf, common.OwnerRWPerms); err != nil {
+		logger.WarnContext(ctx, "failed writing GitHub tags cache", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		logger.WarnContext(ctx, "failed writing GitHub tags cache", "error", err)
+		_ = os.Remove(tmp)
+	}
+}
+
+func (c *githubTagsClient) cachePath(org, repo string) string {
+	// GitHub names are case insensitive.
+	sum := sha256.Sum256([]byte(strings.ToLower(org + "/" + repo)))
+	return filepath.Join(c.cacheDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+func (g *githubTagsCache) allTags() []string {
+	var out []string
+	for _, p := range g.Pages {
+		out = append(out, p.Tags...)
+	}
+	return out
+}
+
+// nextPageURL returns the URL of the next page from a Link header, or empty.
+func nextPageURL(h http.Header) string {
+	m := githubLinkNextRE.FindStringSubmatch(h.Get("Link"))
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+var pageParamRE = regexp.MustCompile(`([?&])page=(\d+)`)
+
+// pageNumber returns the page= parameter of u, which defaults to 1.
+func pageNumber(u string) int {
+	m := pageParamRE.FindStringSubmatch(u)
+	if m == nil {
+		return 1
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+// withPage returns u with its page= parameter set to n.
+func withPage(u string, n int) string {
+	if pageParamRE.MatchString(u) {
+		return pageParamRE.ReplaceAllString(u, "${1}page="+strconv.Itoa(n))
+	}
+	return u + "&page=" + strconv.Itoa(n)
+}
+
+// sleepCtx waits for d, or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeGitHub serves the tags of one repo, two per page, with ETags.
+type fakeGitHub struct {
+	mu sync.Mutex
+
+	tags []string
+
+	// rateLimited is the number of upcoming requests to reject with a rate
+	// limit error.
+	rateLimited int
+
+	// The number of requests, and of those, the number answered with 304.
+	requests    int
+	notModified int
+}
+
+func (f *fakeGitHub) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	if r.URL.Path != "/repos/my-org/my-repo/tags" {
+		http.NotFound(w, r)
+		return
+	}
+	if f.rateLimited > 0 {
+		f.rateLimited--
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("Retry-After", "3")
+		http.Error(w, "API rate limit exceeded", http.StatusForbidden)
+		return
+	}
+
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		page, _ = strconv.Atoi(p)
+	}
+	start := min(2*(page-1), len(f.tags))
+	end := min(start+2, len(f.tags))
+	pageTags := f.tags[start:end]
+	etag := fmt.Sprintf(`"%v"`, pageTags)
+
+	if end < len(f.tags) {
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s/repos/my-org/my-repo/tags?per_page=100&page=%d>; rel="next"`, r.Host, page+1))
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		f.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	out := make([]map[string]string, 0, len(pageTags))
+	for _, t := range pageTags {
+		out = append(out, map[string]string{"name": t})
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func TestGitHubTagsClient(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	fake := &fakeGitHub{tags: []string{"v1.0.0", "v1.1.0", "v1.2.0"}}
+	srv := httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(srv.Close)
+
+	var sleeps []time.Duration
+	client := &githubTagsClient{
+		endpoint:   srv.URL,
+		cacheDir:   t.TempDir(),
+		httpClient: srv.Client(),
+		sleep: func(ctx context.Context, d time.Duration) error {
+			sleeps = append(sleeps, d)
+			return nil
+		},
+	}
+
+	// The first listing fills the cache.
+	got, err := client.tags(ctx, "my-org", "my-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, fake.tags); diff != "" {
+		t.Errorf("tags were not as expected (-got,+want): %s", diff)
+	}
+	if fake.requests != 2 || fake.notModified != 0 {
+		t.Errorf("got %d requests with %d not modified, want 2 and 0", fake.requests, fake.notModified)
+	}
+
+	// Nothing changed, so every page is not modified.
+	if got, err = client.tags(ctx, "my-org", "my-repo"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, fake.tags); diff != "" {
+		t.Errorf("tags were not as expected (-got,+want): %s", diff)
+	}
+	if fake.notModified != 2 {
+		t.Errorf("got %d not modified responses, want 2", fake.notModified)
+	}
+
+	// A new tag on the last page, after being rate limited twice.
+	fake.tags = append(fake.tags, "v2.0.0")
+	fake.rateLimited = 2
+	if got, err = client.tags(ctx, "my-org", "my-repo"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, fake.tags); diff != "" {
+		t.Errorf("tags were not as expected (-got,+want): %s", diff)
+	}
+	if diff := cmp.Diff(sleeps, []time.Duration{3 * time.Second, 3 * time.Second}); diff != "" {
+		t.Errorf("waits between retries were not as expected (-got,+want): %s", diff)
+	}
+
+	// When the rate limit doesn't go away, the cached tags are used.
+	fake.tags = append(fake.tags, "v3.0.0")
+	fake.rateLimited = githubMaxRetries + 1
+	if got, err = client.tags(ctx, "my-org", "my-repo"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, []string{"v1.0.0", "v1.1.0", "v1.2.0", "v2.0.0"}); diff != "" {
+		t.Errorf("tags were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestGitHubTagsClient_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		rateLimited int
+		repo        string
+		wantErr     string
+	}{
+		{
+			name:        "rate_limited_without_cache",
+			rateLimited: githubMaxRetries + 1,
+			repo:        "my-repo",
+			wantErr:     errGitHubRateLimited.Error(),
+		},
+		{
+			name:    "not_found",
+			repo:    "other-repo",
+			wantErr: `got status "404 Not Found"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			fake := &fakeGitHub{tags: []string{"v1.0.0"}, rateLimited: tc.rateLimited}
+			srv := httptest.NewServer(http.HandlerFunc(fake.serve))
+			t.Cleanup(srv.Close)
+
+			client := &githubTagsClient{
+				endpoint:   srv.URL,
+				cacheDir:   t.TempDir(),
+				httpClient: srv.Client(),
+				sleep:      func(context.Context, time.Duration) error { return nil },
+			}
+			_, err := client.tags(ctx, "my-org", tc.repo)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		status    int
+		header    map[string]string
+		wantWait  time.Duration
+		wantRetry bool
+	}{
+		{
+			name:   "ok",
+			status: http.StatusOK,
+		},
+		{
+			name:   "forbidden_without_rate_limit",
+			status: http.StatusForbidden,
+		},
+		{
+			name:      "retry_after",
+			status:    http.StatusForbidden,
+			header:    map[string]string{"Retry-After": "7", "X-RateLimit-Remaining": "0"},
+			wantWait:  7 * time.Second,
+			wantRetry: true,
+		},
+		{
+			name:      "retry_after_too_long",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"Retry-After": "3600"},
+			wantWait:  githubMaxBackoff,
+			wantRetry: true,
+		},
+		{
+			name:      "reset_too_far_away_uses_backoff",
+			status:    http.StatusForbidden,
+			header:    map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)},
+			wantWait:  2 * time.Second,
+			wantRetry: true,
+		},
+		{
+			name:      "server_error",
+			status:    http.StatusBadGateway,
+			wantWait:  2 * time.Second,
+			wantRetry: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+			for k, v := range tc.header {
+				resp.Header.Set(k, v)
+			}
+			wait, retry := retryDelay(resp, 2*time.Second)
+			if wait != tc.wantWait || retry != tc.wantRetry {
+				t.Errorf("got (%v, %t), want (%v, %t)", wait, retry, tc.wantWait, tc.wantRetry)
+			}
+		})
+	}
+}
+
+func TestGitHubRemoteRE(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		remote    string
+		wantOrg   string
+		wantRepo  string
+		wantMatch bool
+	}{
+		{remote: "https://github.com/abcxyz/abc.git", wantOrg: "abcxyz", wantRepo: "abc", wantMatch: true},
+		{remote: "git@github.com:abcxyz/abc.git", wantOrg: "abcxyz", wantRepo: "abc", wantMatch: true},
+		{remote: "https://github.com/abcxyz/abc.go.git", wantOrg: "abcxyz", wantRepo: "abc.go", wantMatch: true},
+		{remote: "https://gitlab.com/abcxyz/abc.git"},
+		{remote: "https://github.com.evil.com/abcxyz/abc.git"},
+	}
+	for _, tc := range cases {
+		m := githubRemoteRE.FindStringSubmatch(tc.remote)
+		if (m != nil) != tc.wantMatch {
+			t.Errorf("%q: got match=%t, want %t", tc.remote, m != nil, tc.wantMatch)
+			continue
+		}
+		if m == nil {
+			continue
+		}
+		if org, repo := m[githubRemoteRE.SubexpIndex("org")], m[githubRemoteRE.SubexpIndex("repo")]; org != tc.wantOrg || repo != tc.wantRepo {
+			t.Errorf("%q: got %s/%s, want %s/%s", tc.remote, org, repo, tc.wantOrg, tc.wantRepo)
+		}
+	}
+}
@@ -18,8 +18,8 @@ package templatesource
 import (
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/git"
@@ -50,7 +50,7 @@ func (l *localSourceParser) sourceParse(ctx context.Context, params *ParseSource
 		absSource = filepath.Join(params.CWD, params.Source)
 	}
 
-	fi, err := os.Stat(absSource)
+	fi, err := fsOrReal(params.FS).Stat(absSource)
 	if err != nil {
 		if common.IsStatNotExistErr(err) {
 			logger.DebugContext(ctx, "will not treat template location as a local path because the path does not exist",
@@ -60,27 +60,75 @@ func (l *localSourceParser) sourceParse(ctx context.Context, params *ParseSource
 		return nil, false, fmt.Errorf("Stat(): %w", err)
 	}
 
+	singleFile := false
 	if !fi.IsDir() {
-		logger.WarnContext(ctx, "the template source won't be treated as a local path; that path exists as a regular file but a template location must be a directory",
-			"src", absSource)
-		return nil, false, nil
+		if !fi.Mode().IsRegular() || !isSpecFileName(absSource) {
+			logger.WarnContext(ctx, "the template source won't be treated as a local path; that path exists as a file but a template location must be a directory or a .yaml spec file",
+				"src", absSource)
+			return nil, false, nil
+		}
+		singleFile = true
 	}
 
-	logger.InfoContext(ctx, "treating src as a local path", "src", absSource)
+	logger.InfoContext(ctx, "treating src as a local path", "src", absSource, "single_file", singleFile)
 
 	return &LocalDownloader{
-		SrcPath: absSource,
+		SrcPath:    absSource,
+		SingleFile: singleFile,
+		FS:         params.FS,
+		Symlinks:   params.Symlinks,
+		Limits:     params.Limits,
+		AllowDirty: params.AllowDirty,
 	}, true, nil
 }
 
+// isSpecFileName returns whether path could be a single-file template, which
+// is a spec file that may have any name, as long as it's YAML.
+func isSpecFileName(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
 // LocalDownloader implements Downloader.
 type LocalDownloader struct {
 	// This path uses the OS-native file separator and is an absolute path.
 	SrcPath string
 
+	// SingleFile means that SrcPath is a spec file rather than a directory,
+	// for a template whose other files, if any, are inline in the spec's
+	// "files". It's copied into the destination directory as spec.yaml.
+	SingleFile bool
+
+	// FS is the filesystem containing both SrcPath and the destination
+	// directory. If nil, the real filesystem is used.
+	FS common.FS
+
+	// Symlinks says how symlinks in SrcPath are copied. The zero value means
+	// common.SymlinksFollow.
+	Symlinks common.SymlinkMode
+
+	// Limits is an optional limit on the size of the template. If nil, there
+	// are no limits.
+	Limits *common.Limits
+
+	// AllowDirty is the value of --allow-dirty-template. If true and SrcPath is
+	// in a git workspace with uncommitted changes, the manifest still gets a
+	// version, marked as dirty, instead of no version at all.
+	AllowDirty bool
+
 	// It's too hard in tests to generate a clean git repo, so we provide
 	// this option to just ignore the fact that the git repo is dirty.
-	allowDirty bool
+	ignoreDirty bool
+}
+
+// Dir returns the directory of the template: SrcPath, or the directory that
+// contains it if it's a single file. Relative paths in the template, like
+// that of "extends", are relative to it.
+func (l *LocalDownloader) Dir() string {
+	if l.SingleFile {
+		return filepath.Dir(l.SrcPath)
+	}
+	return l.SrcPath
 }
 
 func (l *LocalDownloader) Download(ctx context.Context, cwd, destDir string) (*DownloadMetadata, error) {
@@ -89,19 +137,32 @@ func (l *LocalDownloader) Download(ctx context.Context, cwd, destDir string) (*D
 	logger.DebugContext(ctx, "copying local template source",
 		"srcPath", l.SrcPath,
 		"destDir", destDir)
-	if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
-		SrcRoot: l.SrcPath,
-		DstRoot: destDir,
-		FS:      &common.RealFS{},
+	if l.SingleFile {
+		if err := l.copySpecFile(destDir); err != nil {
+			return nil, err
+		}
+	} else if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+		SrcRoot:  l.SrcPath,
+		DstRoot:  destDir,
+		FS:       fsOrReal(l.FS),
+		Symlinks: l.Symlinks,
+		Limits:   l.Limits,
 	}); err != nil {
 		return nil, err //nolint:wrapcheck
 	}
 
-	gitVars, err := gitTemplateVars(ctx, l.SrcPath)
+	gitVars, err := gitTemplateVars(ctx, l.Dir())
 	if err != nil {
 		return nil, err
 	}
-	canonicalSource, version, locType, err := canonicalize(ctx, cwd, l.SrcPath, destDir, l.allowDirty)
+	dirty := dirtyOmit
+	switch {
+	case l.ignoreDirty:
+		dirty = dirtyIgnore
+	case l.AllowDirty:
+		dirty = dirtyMark
+	}
+	canonicalSource, version, locType, err := canonicalize(ctx, cwd, l.SrcPath, l.Dir(), destDir, dirty)
 	if err != nil {
 		return nil, err
 	}
@@ -119,11 +180,32 @@ func (l *LocalDownloader) Download(ctx context.Context, cwd, destDir string) (*D
 	return dlMeta, nil
 }
 
+// copySpecFile copies the single-file template SrcPath into destDir as
+// spec.yaml.
+func (l *LocalDownloader) copySpecFile(destDir string) error {
+	fsys := fsOrReal(l.FS)
+	buf, err := fsys.ReadFile(l.SrcPath)
+	if err != nil {
+		return fmt.Errorf("ReadFile(): %w", err)
+	}
+	if l.Limits != nil && l.Limits.MaxBytes > 0 && int64(len(buf)) > l.Limits.MaxBytes {
+		return fmt.Errorf("the file %q is more than %d bytes, which is the limit set by --max-bytes", l.SrcPath, l.Limits.MaxBytes)
+	}
+	if err := fsys.MkdirAll(destDir, common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("MkdirAll(): %w", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(destDir, "spec.yaml"), buf, common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("WriteFile(): %w", err)
+	}
+	return nil
+}
+
 // canonicalize determines whether the given combination of src and dest
 // directories qualify as a canonical source, and if so, returns the
-// canonicalized version of the source. See the docs on DownloadMetadata for an
+// canonicalized version of the source. srcDir is src, or the directory that
+// contains it if it's a single file. See the docs on DownloadMetadata for an
 // explanation of canonical sources.
-func canonicalize(ctx context.Context, cwd, src, dest string, allowDirty bool) (canonicalSource, version, locType string, _ error) {
+func canonicalize(ctx context.Context, cwd, src, srcDir, dest string, dirty dirtyMode) (canonicalSource, version, locType string, _ error) {
 	logger := logging.FromContext(ctx).With("logger", "canonicalize")
 
 	absDest := dest
@@ -133,7 +215,7 @@ func canonicalize(ctx context.Context, cwd, src, dest string, allowDirty bool) (
 
 	// See the docs on DownloadMetadata for an explanation of why we compare the git
 	// workspaces to decide if source is canonical.
-	sourceGitWorkspace, templateIsGit, err := git.Workspace(ctx, src)
+	sourceGitWorkspace, templateIsGit, err := git.Workspace(ctx, srcDir)
 	if err != nil {
 		return "", "", "", err //nolint:wrapcheck
 	}
@@ -159,10 +241,40 @@ func canonicalize(ctx context.Context, cwd, src, dest string, allowDirty bool) (
 		return "", "", "", fmt.Errorf("filepath.Rel(%q,%q): %w", dest, src, err)
 	}
 
-	version, _, err = gitCanonicalVersion(ctx, sourceGitWorkspace, allowDirty)
+	// The workspace may contain submodules. If both the template and the
+	// destination are in the same submodule, the version is the submodule's
+	// commit. Otherwise, the version is the superproject's commit, which pins
+	// the commits of all of its submodules.
+	versionDir, err := commonRepo(ctx, srcDir, absDest, sourceGitWorkspace)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	version, _, err = gitCanonicalVersion(ctx, versionDir, dirty)
 	if err != nil {
 		return "", "", "", err
 	}
 
 	return filepath.ToSlash(out), version, LocTypeLocalGit, nil
 }
+
+// commonRepo returns the root of the innermost git repo that contains both
+// the directories a and b, which are inside the given git workspace. This is
+// a submodule of the workspace if they're both inside it, and otherwise it's
+// the workspace itself.
+func commonRepo(ctx context.Context, a, b, workspace string) (string, error) {
+	dir := a
+	for {
+		root, ok, err := git.Repo(ctx, dir)
+		if err != nil {
+			return "", err //nolint:wrapcheck
+		}
+		if !ok || root == workspace {
+			return workspace, nil
+		}
+		if rel, err := filepath.Rel(root, b); err == nil && filepath.IsLocal(rel) {
+			return root, nil
+		}
+		dir = filepath.Dir(root)
+	}
+}
@@ -34,6 +34,9 @@ func TestLocalDownloader_Download(t *testing.T) {
 		name            string
 		srcDir          string
 		destDir         string
+		checkDirty      bool
+		allowDirty      bool
+		singleFile      bool
 		initialContents map[string]string
 		wantNewFiles    map[string]string
 		wantDLMeta      *DownloadMetadata
@@ -55,6 +58,49 @@ func TestLocalDownloader_Download(t *testing.T) {
 				IsCanonical: false,
 			},
 		},
+		{
+			name:       "single_file",
+			srcDir:     "src/hello.yaml",
+			destDir:    "dst",
+			singleFile: true,
+			initialContents: map[string]string{
+				"src/hello.yaml": "spec contents",
+				"src/other.txt":  "not part of the template",
+			},
+			wantNewFiles: map[string]string{
+				"dst/spec.yaml": "spec contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical: false,
+			},
+		},
+		{
+			name:       "single_file_in_same_git_workspace",
+			srcDir:     "src/hello.yaml",
+			destDir:    "dst",
+			singleFile: true,
+			initialContents: abctestutil.WithGitRepoAt("",
+				map[string]string{
+					"src/hello.yaml": "spec contents",
+				}),
+			wantNewFiles: map[string]string{
+				"dst/spec.yaml": "spec contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "../src/hello.yaml",
+				LocationType:    "local_git",
+				HasVersion:      true,
+				Version:         abctestutil.MinimalGitHeadSHA,
+				Vars: DownloaderVars{
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+				},
+			},
+		},
 		{
 			name:    "nonexistent_source",
 			srcDir:  "nonexistent",
@@ -80,9 +126,67 @@ func TestLocalDownloader_Download(t *testing.T) {
 				HasVersion:      true,
 				Version:         abctestutil.MinimalGitHeadSHA,
 				Vars: DownloaderVars{
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
-					GitTag:      "",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "",
+				},
+			},
+		},
+		{
+			name:       "dirty_workspace_has_no_version",
+			srcDir:     "src",
+			destDir:    "dst",
+			checkDirty: true,
+			initialContents: abctestutil.WithGitRepoAt("",
+				map[string]string{
+					"src/spec.yaml": "file1 contents",
+				}),
+			wantNewFiles: map[string]string{
+				"dst/spec.yaml": "file1 contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "../src",
+				LocationType:    "local_git",
+				Vars: DownloaderVars{
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+				},
+			},
+		},
+		{
+			name:       "allow_dirty_marks_version",
+			srcDir:     "src",
+			destDir:    "dst",
+			checkDirty: true,
+			allowDirty: true,
+			initialContents: abctestutil.WithGitRepoAt("",
+				map[string]string{
+					".git/refs/tags/v1.2.3": abctestutil.MinimalGitHeadSHA,
+					"src/spec.yaml":         "file1 contents",
+				}),
+			wantNewFiles: map[string]string{
+				"dst/spec.yaml": "file1 contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "../src",
+				LocationType:    "local_git",
+				HasVersion:      true,
+				Version:         "v1.2.3-dirty",
+				Vars: DownloaderVars{
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "v1.2.3",
 				},
 			},
 		},
@@ -111,9 +215,12 @@ func TestLocalDownloader_Download(t *testing.T) {
 				HasVersion:      true,
 				Version:         "mytag",
 				Vars: DownloaderVars{
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
-					GitTag:      "mytag",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "mytag",
 				},
 			},
 		},
@@ -145,9 +252,12 @@ func TestLocalDownloader_Download(t *testing.T) {
 				HasVersion:      true,
 				Version:         abctestutil.MinimalGitHeadSHA,
 				Vars: DownloaderVars{
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
-					GitTag:      "",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "",
 				},
 			},
 		},
@@ -168,9 +278,12 @@ func TestLocalDownloader_Download(t *testing.T) {
 			wantDLMeta: &DownloadMetadata{
 				IsCanonical: false,
 				Vars: DownloaderVars{
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
-					GitTag:      "",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "",
 				},
 			},
 		},
@@ -190,9 +303,126 @@ func TestLocalDownloader_Download(t *testing.T) {
 			wantDLMeta: &DownloadMetadata{
 				IsCanonical: false,
 				Vars: DownloaderVars{
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
-					GitTag:      "",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "",
+				},
+			},
+		},
+		{
+			name:    "src_and_dest_in_same_linked_worktree",
+			srcDir:  "wt/src",
+			destDir: "wt/dst",
+			initialContents: abctestutil.WithGitRepoAt("main",
+				abctestutil.WithGitWorktreeAt("main", "wt",
+					map[string]string{
+						"main/.git/refs/tags/v1.0.0": abctestutil.MinimalGitHeadSHA,
+						"wt/src/spec.yaml":           "file1 contents",
+					})),
+			wantNewFiles: map[string]string{
+				"wt/dst/spec.yaml": "file1 contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "../src",
+				LocationType:    "local_git",
+				HasVersion:      true,
+				Version:         "v1.0.0",
+				Vars: DownloaderVars{
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "v1.0.0",
+				},
+			},
+		},
+		{
+			name:    "src_in_main_checkout_and_dest_in_linked_worktree",
+			srcDir:  "main/src",
+			destDir: "wt/dst",
+			initialContents: abctestutil.WithGitRepoAt("main",
+				abctestutil.WithGitWorktreeAt("main", "wt",
+					map[string]string{
+						"main/src/spec.yaml": "file1 contents",
+					})),
+			wantNewFiles: map[string]string{
+				"wt/dst/spec.yaml": "file1 contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical: false,
+				Vars: DownloaderVars{
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "",
+				},
+			},
+		},
+		{
+			name:    "src_in_submodule_and_dest_in_superproject",
+			srcDir:  "sub/src",
+			destDir: "dst",
+			initialContents: abctestutil.WithGitRepoAt("",
+				abctestutil.WithGitSubmoduleAt("", "sub",
+					map[string]string{
+						".git/refs/tags/v1.0.0":             abctestutil.MinimalGitHeadSHA,
+						".git/modules/sub/refs/tags/v2.0.0": abctestutil.MinimalGitHeadSHA,
+						"sub/src/spec.yaml":                 "file1 contents",
+					})),
+			wantNewFiles: map[string]string{
+				"dst/spec.yaml": "file1 contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "../sub/src",
+				LocationType:    "local_git",
+				HasVersion:      true,
+				// The superproject's version pins the submodule's commit.
+				Version: "v1.0.0",
+				Vars: DownloaderVars{
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "v2.0.0",
+				},
+			},
+		},
+		{
+			name:    "src_and_dest_in_same_submodule",
+			srcDir:  "sub/src",
+			destDir: "sub/dst",
+			initialContents: abctestutil.WithGitRepoAt("",
+				abctestutil.WithGitSubmoduleAt("", "sub",
+					map[string]string{
+						".git/refs/tags/v1.0.0":             abctestutil.MinimalGitHeadSHA,
+						".git/modules/sub/refs/tags/v2.0.0": abctestutil.MinimalGitHeadSHA,
+						"sub/src/spec.yaml":                 "file1 contents",
+					})),
+			wantNewFiles: map[string]string{
+				"sub/dst/spec.yaml": "file1 contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "../src",
+				LocationType:    "local_git",
+				HasVersion:      true,
+				Version:         "v2.0.0",
+				Vars: DownloaderVars{
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+					GitTag:         "v2.0.0",
 				},
 			},
 		},
@@ -225,8 +455,10 @@ func TestLocalDownloader_Download(t *testing.T) {
 			tmp := t.TempDir()
 			abctestutil.WriteAllDefaultMode(t, tmp, tc.initialContents)
 			dl := &LocalDownloader{
-				SrcPath:    filepath.Join(tmp, tc.srcDir),
-				allowDirty: true,
+				SrcPath:     filepath.Join(tmp, tc.srcDir),
+				SingleFile:  tc.singleFile,
+				AllowDirty:  tc.allowDirty,
+				ignoreDirty: !tc.checkDirty,
 			}
 			dest := filepath.Join(tmp, tc.destDir)
 			gotMeta, err := dl.Download(ctx, tmp, dest)
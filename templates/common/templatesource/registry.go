@@ -0,0 +1,139 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SourceParser can be implemented outside of this package to support other
+// kinds of template sources, like an internal artifact store or a cloud storage
+// bucket. Register it with RegisterSourceParser.
+type SourceParser interface {
+	// ParseSource looks at params.Source and decides whether this parser
+	// handles it. If it does, it returns true and a Downloader for the
+	// template. If it doesn't, it must return false and a nil error, so that
+	// the next parser gets a chance.
+	//
+	// An error means that the source was recognized but is unusable (for
+	// example, it's malformed), and it stops the search; no other parser is
+	// tried.
+	ParseSource(ctx context.Context, params *ParseSourceParams) (Downloader, bool, error)
+}
+
+// SourceParserFunc adapts a plain function to the SourceParser interface.
+type SourceParserFunc func(ctx context.Context, params *ParseSourceParams) (Downloader, bool, error)
+
+// ParseSource implements SourceParser.
+func (f SourceParserFunc) ParseSource(ctx context.Context, params *ParseSourceParams) (Downloader, bool, error) {
+	return f(ctx, params)
+}
+
+// SourceParserOrder says where a registered SourceParser goes relative to the
+// built-in parsers.
+type SourceParserOrder int
+
+const (
+	// BeforeBuiltins parsers are tried before the built-in ones, so they can
+	// handle sources that a built-in parser would otherwise accept, like a
+	// github.com location that should be read from a mirror instead.
+	BeforeBuiltins SourceParserOrder = iota
+
+	// AfterBuiltins parsers are only tried for sources that no built-in
+	// parser accepted. This is the safe choice for new kinds of sources, like
+	// "artifacts://name/version", because it can't change how existing
+	// sources are handled.
+	AfterBuiltins
+)
+
+// registeredParser is a SourceParser added with RegisterSourceParser.
+type registeredParser struct {
+	name   string
+	parser SourceParser
+}
+
+func (r *registeredParser) sourceParse(ctx context.Context, params *ParseSourceParams) (Downloader, bool, error) {
+	downloader, ok, err := r.parser.ParseSource(ctx, params)
+	if err != nil {
+		return nil, false, fmt.Errorf("source parser %q: %w", r.name, err)
+	}
+	return downloader, ok, nil
+}
+
+var (
+	registryMu sync.RWMutex
+
+	// The registered parsers, by order, in the order they were registered.
+	registered = map[SourceParserOrder][]*registeredParser{}
+)
+
+// RegisterSourceParser adds a SourceParser that ParseSource will try, for
+// programs that embed abc and need to support other kinds of template
+// sources. It's meant to be called during program initialization, before
+// ParseSource is used.
+//
+// ParseSource tries parsers in this order, and the first one that accepts the
+// source wins:
+//
+//  1. BeforeBuiltins parsers, in the order they were registered.
+//  2. The built-in parsers (remote git repos and local directories).
+//  3. AfterBuiltins parsers, in the order they were registered.
+//
+// Each parser must have a unique name, which is used in error messages.
+// Registering a second parser with the same name, or a nil parser, panics,
+// like database/sql.Register.
+//
+// Downloaders returned by registered parsers should set
+// DownloadMetadata.LocationType to a value of their own. Templates rendered
+// from those locations can't be upgraded with "abc templates upgrade", which
+// only knows about the built-in location types.
+func RegisterSourceParser(name string, order SourceParserOrder, parser SourceParser) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if parser == nil {
+		panic(fmt.Sprintf("templatesource: RegisterSourceParser parser %q is nil", name))
+	}
+	if order != BeforeBuiltins && order != AfterBuiltins {
+		panic(fmt.Sprintf("templatesource: RegisterSourceParser parser %q has unknown order %d", name, order))
+	}
+	for _, parsers := range registered {
+		for _, p := range parsers {
+			if p.name == name {
+				panic(fmt.Sprintf("templatesource: RegisterSourceParser called twice for parser %q", name))
+			}
+		}
+	}
+	registered[order] = append(registered[order], &registeredParser{name: name, parser: parser})
+}
+
+// allSourceParsers returns the registered and built-in parsers, in the order
+// they should be tried.
+func allSourceParsers() []sourceParser {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	out := make([]sourceParser, 0, len(registered[BeforeBuiltins])+len(realSourceParsers)+len(registered[AfterBuiltins]))
+	for _, p := range registered[BeforeBuiltins] {
+		out = append(out, p)
+	}
+	out = append(out, realSourceParsers...)
+	for _, p := range registered[AfterBuiltins] {
+		out = append(out, p)
+	}
+	return out
+}
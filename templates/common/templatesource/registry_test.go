@@ -0,0 +1,173 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakePluginDownloader is returned by the parsers registered in these tests.
+type fakePluginDownloader struct {
+	parser string
+	source string
+}
+
+func (f *fakePluginDownloader) Download(ctx context.Context, cwd, destDir string) (*DownloadMetadata, error) {
+	return &DownloadMetadata{}, nil
+}
+
+// prefixParser accepts sources starting with prefix.
+func prefixParser(name, prefix string) SourceParser {
+	return SourceParserFunc(func(ctx context.Context, params *ParseSourceParams) (Downloader, bool, error) {
+		if !strings.HasPrefix(params.Source, prefix) {
+			return nil, false, nil
+		}
+		if params.Source == prefix+"malformed" {
+			return nil, false, fmt.Errorf("malformed source")
+		}
+		return &fakePluginDownloader{parser: name, source: params.Source}, true, nil
+	})
+}
+
+// The registry is global, so the parsers registered here only accept sources
+// that no other test uses.
+func init() {
+	RegisterSourceParser("test-before", BeforeBuiltins, prefixParser("test-before", "github.com/registry-test-mirror/"))
+	RegisterSourceParser("test-before-2", BeforeBuiltins, prefixParser("test-before-2", "github.com/registry-test-"))
+	RegisterSourceParser("test-after", AfterBuiltins, prefixParser("test-after", "github.com/registry-after/"))
+	RegisterSourceParser("test-after-scheme", AfterBuiltins, prefixParser("test-after-scheme", "registry-test://"))
+}
+
+func TestParseSource_Registered(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		source  string
+		want    Downloader
+		wantErr string
+	}{
+		{
+			name:   "earlier_registration_wins",
+			source: "github.com/registry-test-mirror/repo@v1.2.3",
+			want:   &fakePluginDownloader{parser: "test-before", source: "github.com/registry-test-mirror/repo@v1.2.3"},
+		},
+		{
+			name:   "before_builtins_takes_precedence_over_builtin",
+			source: "github.com/registry-test-other/repo@v1.2.3",
+			want:   &fakePluginDownloader{parser: "test-before-2", source: "github.com/registry-test-other/repo@v1.2.3"},
+		},
+		{
+			name:   "after_builtins_only_sees_unclaimed_sources",
+			source: "github.com/registry-after/repo@v1.2.3",
+			want: &remoteGitDownloader{
+				canonicalSource: "github.com/registry-after/repo",
+				remote:          "https://github.com/registry-after/repo.git",
+				version:         "v1.2.3",
+				cloner:          &realCloner{},
+				tagser:          &realTagser{},
+			},
+		},
+		{
+			name:   "after_builtins_new_scheme",
+			source: "registry-test://bucket/template",
+			want:   &fakePluginDownloader{parser: "test-after-scheme", source: "registry-test://bucket/template"},
+		},
+		{
+			name:    "parser_error_stops_search",
+			source:  "registry-test://malformed",
+			wantErr: `source parser "test-after-scheme": malformed source`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseSource(context.Background(), &ParseSourceParams{
+				CWD:         t.TempDir(),
+				Source:      tc.source,
+				GitProtocol: "https",
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			opts := []cmp.Option{
+				cmp.AllowUnexported(remoteGitDownloader{}, fakePluginDownloader{}),
+			}
+			if diff := cmp.Diff(got, tc.want, opts...); diff != "" {
+				t.Errorf("downloader was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRegisterSourceParser_Panics(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		parser    string
+		order     SourceParserOrder
+		sp        SourceParser
+		wantPanic string
+	}{
+		{
+			name:      "duplicate_name",
+			parser:    "test-before",
+			order:     AfterBuiltins,
+			sp:        prefixParser("dup", "registry-dup://"),
+			wantPanic: `RegisterSourceParser called twice for parser "test-before"`,
+		},
+		{
+			name:      "nil_parser",
+			parser:    "test-nil",
+			order:     AfterBuiltins,
+			wantPanic: `RegisterSourceParser parser "test-nil" is nil`,
+		},
+		{
+			name:      "unknown_order",
+			parser:    "test-bad-order",
+			order:     SourceParserOrder(7),
+			sp:        prefixParser("bad-order", "registry-bad-order://"),
+			wantPanic: `RegisterSourceParser parser "test-bad-order" has unknown order 7`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			defer func() {
+				got := fmt.Sprint(recover())
+				if !strings.Contains(got, tc.wantPanic) {
+					t.Errorf("got panic %q, want a panic containing %q", got, tc.wantPanic)
+				}
+			}()
+			RegisterSourceParser(tc.parser, tc.order, tc.sp)
+		})
+	}
+}
@@ -21,11 +21,13 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"golang.org/x/exp/slices"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/common/git"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/pkg/logging"
@@ -66,6 +68,10 @@ func (g *remoteGitSourceParser) sourceParse(ctx context.Context, params *ParseSo
 		input:          params.Source,
 		gitProtocol:    params.GitProtocol,
 		defaultVersion: g.defaultVersion,
+		fs:             params.FS,
+		limits:         params.Limits,
+		retry:          params.Retry,
+		stats:          params.Stats,
 	})
 }
 
@@ -76,9 +82,13 @@ type newRemoteGitDownloaderParams struct {
 	// will be used if the "re" regular expression either doesn't have a
 	// matching group named "version", or
 	defaultVersion string
+	fs             common.FS
 	gitProtocol    string
 	input          string
+	limits         *common.Limits
 	re             *regexp.Regexp
+	retry          *RetryPolicy
+	stats          *DownloadStats
 }
 
 // newRemoteGitDownloader is basically a fancy constructor for
@@ -110,7 +120,11 @@ func newRemoteGitDownloader(p *newRemoteGitDownloaderParams) (Downloader, bool,
 	return &remoteGitDownloader{
 		canonicalSource: canonicalSource,
 		cloner:          &realCloner{},
+		fs:              p.fs,
+		limits:          p.limits,
 		remote:          remote,
+		retry:           p.retry,
+		stats:           p.stats,
 		subdir:          subdir,
 		tagser:          &realTagser{},
 		version:         version,
@@ -133,9 +147,25 @@ type remoteGitDownloader struct {
 	cloner cloner
 	tagser tagser
 
+	// fs is the filesystem that the template is downloaded into. The git clone
+	// itself always happens on the real filesystem, since it's done by the git
+	// CLI. If nil, the real filesystem is used.
+	fs common.FS
+
+	// limits is an optional limit on the size of the template, enforced when
+	// copying it out of the clone. If nil, there are no limits.
+	limits *common.Limits
+
+	// retry controls how a failed clone or tag listing is retried. If nil,
+	// DefaultRetryPolicy is used.
+	retry *RetryPolicy
+
+	// stats is optional, and if non-nil, records the download.
+	stats *DownloadStats
+
 	// It's too hard in tests to generate a clean git repo, so we provide
 	// this option to just ignore the fact that the git repo is dirty.
-	allowDirty bool
+	ignoreDirty bool
 }
 
 // Download implements Downloader.
@@ -148,7 +178,9 @@ func (g *remoteGitDownloader) Download(ctx context.Context, cwd, destDir string)
 		return nil, fmt.Errorf("invalid subdirectory: %w", err)
 	}
 
-	versionToDownload, err := resolveVersion(ctx, g.tagser, g.remote, g.version)
+	start := time.Now()
+	tagser := &retryingTagser{tagser: g.tagser, retry: g.retry, stats: g.stats}
+	versionToDownload, err := resolveVersion(ctx, tagser, g.remote, g.version)
 	if err != nil {
 		return nil, err
 	}
@@ -161,20 +193,32 @@ func (g *remoteGitDownloader) Download(ctx context.Context, cwd, destDir string)
 	// for a subdirectory, e.g. "github.com/my-org/my-repo/my-subdir@v1.2.3".
 	tempTracker := tempdir.NewDirTracker(&common.RealFS{}, false)
 	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
-	tmpDir, err := tempTracker.MkdirTempTracked("", "git-clone-")
+	tmpDir, err := tempTracker.MkdirTempTracked("", tempdir.GitCloneDirNamePart)
 	if err != nil {
 		return nil, fmt.Errorf("MkdirTemp: %w", err)
 	}
 	subdirToCopy := filepath.Join(tmpDir, subdir)
 
-	if err := g.cloner.Clone(ctx, g.remote, versionToDownload, tmpDir); err != nil {
+	if err := g.retry.retry(ctx, g.stats, "git clone "+g.remote, func() error {
+		// A failed clone may leave a partial repo behind, which would make
+		// the next "git clone" fail.
+		if err := emptyDir(tmpDir); err != nil {
+			return err
+		}
+		return g.cloner.Clone(ctx, g.remote, versionToDownload, tmpDir)
+	}); err != nil {
 		return nil, fmt.Errorf("Clone(): %w", err)
 	}
+	size, err := dirSize(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	g.stats.addDownload(size, time.Since(start))
 
 	fi, err := os.Stat(subdirToCopy)
 	if err != nil {
 		if common.IsStatNotExistErr(err) {
-			return nil, fmt.Errorf(`the repo %q at tag %q doesn't contain a subdirectory named %q; it's possible that the template exists in the "main" branch but is not part of the release %q`, g.remote, versionToDownload, subdir, versionToDownload)
+			return nil, errs.Wrap(errs.ErrSourceNotFound, fmt.Errorf(`the repo %q at tag %q doesn't contain a subdirectory named %q; it's possible that the template exists in the "main" branch but is not part of the release %q`, g.remote, versionToDownload, subdir, versionToDownload))
 		}
 		return nil, err //nolint:wrapcheck // Stat() returns a decently informative error
 	}
@@ -190,7 +234,9 @@ func (g *remoteGitDownloader) Download(ctx context.Context, cwd, destDir string)
 	if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
 		DstRoot: destDir,
 		SrcRoot: subdirToCopy,
-		FS:      &common.RealFS{},
+		FS:      fsOrReal(g.fs),
+		SrcFS:   &common.RealFS{},
+		Limits:  g.limits,
 		Visitor: func(relPath string, de fs.DirEntry) (common.CopyHint, error) {
 			return common.CopyHint{
 				Skip: relPath == ".git",
@@ -208,7 +254,11 @@ func (g *remoteGitDownloader) Download(ctx context.Context, cwd, destDir string)
 	//   - The user may have specified a branch name, but we don't allow branches
 	//     to be used as template versions in manifests because they change
 	//     frequently.
-	canonicalVersion, ok, err := gitCanonicalVersion(ctx, tmpDir, g.allowDirty)
+	dirty := dirtyOmit
+	if g.ignoreDirty {
+		dirty = dirtyIgnore
+	}
+	canonicalVersion, ok, err := gitCanonicalVersion(ctx, tmpDir, dirty)
 	if err != nil {
 		return nil, err
 	}
@@ -259,10 +309,18 @@ func gitTemplateVars(ctx context.Context, srcDir string) (*DownloaderVars, error
 		return nil, err
 	}
 
+	commit, err := git.CurrentCommit(ctx, srcDir)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
 	return &DownloaderVars{
-		GitSHA:      sha,
-		GitShortSHA: sha[:7],
-		GitTag:      tag,
+		GitSHA:         sha,
+		GitShortSHA:    sha[:7],
+		GitTag:         tag,
+		GitCommitTime:  commit.Time.Format(time.RFC3339),
+		GitAuthorName:  commit.AuthorName,
+		GitAuthorEmail: commit.AuthorEmail,
 	}, nil
 }
 
@@ -293,33 +351,50 @@ func resolveLatest(ctx context.Context, t tagser, remote, version string) (strin
 	if err != nil {
 		return "", fmt.Errorf("Tags(): %w", err)
 	}
-	versions := make([]*semver.Version, 0, len(tags))
+
+	// Only tags that look like vN.N.N (with no suffix like "-alpha") are
+	// eligible to be considered "latest". This avoids somebody accidentally
+	// getting a template that wasn't intended to be released.
+	versions := semverTags(ctx, tags, false)
+	if len(versions) == 0 {
+		return "", errs.Wrap(errs.ErrSourceNotFound, fmt.Errorf(`the template source requested the "latest" release, but there were no semver-formatted tags beginning with "v" in %q. Available tags were: %v`, remote, tags))
+	}
+
+	return versions[0], nil
+}
+
+// semverTags returns the tags that are semver versions beginning with "v",
+// from highest to lowest. Tags with a prerelease or metadata suffix, like
+// "v1.2.3-alpha", are only included if prereleases is true.
+func semverTags(ctx context.Context, tags []string, prereleases bool) []string {
+	logger := logging.FromContext(ctx).With("logger", "semverTags")
+
+	type tagVersion struct {
+		tag string
+		sv  *semver.Version
+	}
+	versions := make([]tagVersion, 0, len(tags))
 	for _, t := range tags {
 		sv, err := git.ParseSemverTag(t)
 		if err != nil {
 			logger.DebugContext(ctx, "ignoring non-semver-formatted tag", "tag", t)
 			continue // This is not a semver release tag
 		}
-
-		// Only tags that look like vN.N.N (with no suffix like "-alpha") are
-		// eligible to be considered "latest". This avoids somebody accidentally
-		// getting a template that wasn't intended to be released.
-		if len(sv.Prerelease()) > 0 || len(sv.Metadata()) > 0 {
+		if !prereleases && (len(sv.Prerelease()) > 0 || len(sv.Metadata()) > 0) {
 			logger.DebugContext(ctx, "ignoring tag that has extra prelease or metadata suffixes", "tag", t)
 			continue
 		}
-		versions = append(versions, sv)
-	}
-
-	if len(versions) == 0 {
-		return "", fmt.Errorf(`the template source requested the "latest" release, but there were no semver-formatted tags beginning with "v" in %q. Available tags were: %v`, remote, tags)
+		versions = append(versions, tagVersion{tag: t, sv: sv})
 	}
 
-	max := slices.MaxFunc(versions, func(l, r *semver.Version) int {
-		return l.Compare(r)
+	slices.SortStableFunc(versions, func(l, r tagVersion) int {
+		return r.sv.Compare(l.sv)
 	})
-
-	return "v" + max.Original(), nil
+	out := make([]string, 0, len(versions))
+	for _, v := range versions {
+		out = append(out, v.tag)
+	}
+	return out
 }
 
 // A fakeable interface around the lower-level git Clone function, for testing.
@@ -340,10 +415,73 @@ type tagser interface {
 
 type realTagser struct{}
 
+// retryingTagser retries the tag listing of another tagser.
+type retryingTagser struct {
+	tagser tagser
+	retry  *RetryPolicy
+	stats  *DownloadStats
+}
+
+func (r *retryingTagser) Tags(ctx context.Context, remote string) ([]string, error) {
+	var out []string
+	err := r.retry.retry(ctx, r.stats, "list tags of "+remote, func() error {
+		var err error
+		out, err = r.tagser.Tags(ctx, remote)
+		return err
+	})
+	return out, err
+}
+
+// Tags lists the tags of a github.com repo with the GitHub API, which
+// supports caching, and falls back to "git ls-remote" for other hosts, or if
+// the API can't be used, like for a private repo without a GITHUB_TOKEN.
 func (r *realTagser) Tags(ctx context.Context, remote string) ([]string, error) {
+	return remoteTags(ctx, newGitHubTagsClient(os.LookupEnv), remote)
+}
+
+func remoteTags(ctx context.Context, gh *githubTagsClient, remote string) ([]string, error) {
+	if m := githubRemoteRE.FindStringSubmatch(remote); m != nil {
+		org := m[githubRemoteRE.SubexpIndex("org")]
+		repo := m[githubRemoteRE.SubexpIndex("repo")]
+		tags, err := gh.tags(ctx, org, repo)
+		if err == nil {
+			return tags, nil
+		}
+		logging.FromContext(ctx).DebugContext(ctx, "failed listing tags with the GitHub API, falling back to git ls-remote",
+			"remote", remote,
+			"error", err)
+	}
 	return git.RemoteTags(ctx, remote) //nolint:wrapcheck
 }
 
+// emptyDir removes everything inside dir, but not dir itself.
+func emptyDir(dir string) error {
+	return emptyDirFS(&common.RealFS{}, dir)
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var out int64
+	err := filepath.WalkDir(dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		fi, err := de.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		out += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed computing the size of %q: %w", dir, err)
+	}
+	return out, nil
+}
+
 // gitRemote returns a git remote string (see "man git-remote") for the given
 // remote git repo.
 //
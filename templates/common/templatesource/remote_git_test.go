@@ -43,7 +43,7 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 		{
 			name: "no_subdir",
 			dl: &remoteGitDownloader{
-				allowDirty:      true,
+				ignoreDirty:     true,
 				canonicalSource: "mysource",
 				remote:          "fake-remote",
 				subdir:          "",
@@ -64,16 +64,19 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 				HasVersion:      true,
 				Version:         "v1.2.3",
 				Vars: DownloaderVars{
-					GitTag:      "v1.2.3",
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
+					GitTag:         "v1.2.3",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
 				},
 			},
 		},
 		{
 			name: "latest_version_lookup",
 			dl: &remoteGitDownloader{
-				allowDirty:      true,
+				ignoreDirty:     true,
 				canonicalSource: "mysource",
 				remote:          "fake-remote",
 				subdir:          "",
@@ -102,16 +105,19 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 				HasVersion:      true,
 				Version:         "v1.2.3",
 				Vars: DownloaderVars{
-					GitTag:      "v1.2.3",
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
+					GitTag:         "v1.2.3",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
 				},
 			},
 		},
 		{
 			name: "with_subdir",
 			dl: &remoteGitDownloader{
-				allowDirty:      true,
+				ignoreDirty:     true,
 				canonicalSource: "mysource",
 				remote:          "fake-remote",
 				subdir:          "my-subdir",
@@ -137,16 +143,19 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 				HasVersion:      true,
 				Version:         "v1.2.3",
 				Vars: DownloaderVars{
-					GitTag:      "v1.2.3",
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
+					GitTag:         "v1.2.3",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
 				},
 			},
 		},
 		{
 			name: "with_deep_subdir",
 			dl: &remoteGitDownloader{
-				allowDirty:      true,
+				ignoreDirty:     true,
 				canonicalSource: "mysource",
 				remote:          "fake-remote",
 				subdir:          "my/deep",
@@ -172,9 +181,12 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 				HasVersion:      true,
 				Version:         "v1.2.3",
 				Vars: DownloaderVars{
-					GitTag:      "v1.2.3",
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
+					GitTag:         "v1.2.3",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
 				},
 			},
 		},
@@ -223,7 +235,7 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 		{
 			name: "clone_by_sha",
 			dl: &remoteGitDownloader{
-				allowDirty:      true,
+				ignoreDirty:     true,
 				canonicalSource: "mysource",
 				remote:          "fake-remote",
 				subdir:          "",
@@ -243,16 +255,19 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 				HasVersion:      true,
 				Version:         abctestutil.MinimalGitHeadSHA,
 				Vars: DownloaderVars{
-					GitTag:      "",
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
+					GitTag:         "",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
 				},
 			},
 		},
 		{
 			name: "clone_by_sha_with_detected_tag",
 			dl: &remoteGitDownloader{
-				allowDirty:      true,
+				ignoreDirty:     true,
 				canonicalSource: "mysource",
 				remote:          "fake-remote",
 				subdir:          "",
@@ -273,9 +288,12 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 				HasVersion:      true,
 				Version:         "v1.2.3",
 				Vars: DownloaderVars{
-					GitTag:      "v1.2.3",
-					GitSHA:      abctestutil.MinimalGitHeadSHA,
-					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
+					GitTag:         "v1.2.3",
+					GitSHA:         abctestutil.MinimalGitHeadSHA,
+					GitShortSHA:    abctestutil.MinimalGitHeadShortSHA,
+					GitCommitTime:  abctestutil.MinimalGitHeadCommitTime,
+					GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+					GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
 				},
 			},
 		},
@@ -466,3 +484,176 @@ func (f *fakeTagser) Tags(ctx context.Context, remote string) ([]string, error)
 	}
 	return f.out, nil
 }
+
+func TestRemoteGitDownloader_Download_FakeRemote(t *testing.T) {
+	t.Parallel()
+
+	remote := abctestutil.NewFakeGitRemote(t)
+	v1SHA := remote.Commit(t, "v1", map[string]string{
+		"spec.yaml":      "v1",
+		"subdir/a.txt":   "one",
+		"subdir/b/c.txt": "one",
+	})
+	remote.Tag(t, "v1.0.0", v1SHA)
+	v11SHA := remote.Commit(t, "v1.1", map[string]string{
+		"spec.yaml":    "v1.1",
+		"subdir/a.txt": "two",
+	})
+	remote.Tag(t, "v1.1.0", v11SHA)
+	alphaSHA := remote.Commit(t, "v2 alpha", map[string]string{
+		"spec.yaml": "v2",
+	})
+	remote.Tag(t, "v2.0.0-alpha", alphaSHA)
+	remote.Branch(t, "dev")
+	devSHA := remote.Commit(t, "dev", map[string]string{
+		"spec.yaml": "dev",
+	})
+
+	vars := func(sha, tag string) DownloaderVars {
+		return DownloaderVars{
+			GitSHA:         sha,
+			GitShortSHA:    sha[:7],
+			GitTag:         tag,
+			GitCommitTime:  "2024-01-02T03:04:05Z",
+			GitAuthorName:  abctestutil.MinimalGitHeadAuthorName,
+			GitAuthorEmail: abctestutil.MinimalGitHeadAuthorEmail,
+		}
+	}
+
+	cases := []struct {
+		name        string
+		subdir      string
+		version     string
+		want        map[string]string
+		wantVersion string
+		wantVars    DownloaderVars
+		wantErr     string
+	}{
+		{
+			// Prerelease tags are never the latest.
+			name:        "latest",
+			version:     "latest",
+			want:        map[string]string{"spec.yaml": "v1.1", "subdir/a.txt": "two"},
+			wantVersion: "v1.1.0",
+			wantVars:    vars(v11SHA, "v1.1.0"),
+		},
+		{
+			name:        "tag",
+			version:     "v1.0.0",
+			want:        map[string]string{"spec.yaml": "v1", "subdir/a.txt": "one", "subdir/b/c.txt": "one"},
+			wantVersion: "v1.0.0",
+			wantVars:    vars(v1SHA, "v1.0.0"),
+		},
+		{
+			name:        "sha_with_tag_uses_tag",
+			version:     v1SHA,
+			want:        map[string]string{"spec.yaml": "v1", "subdir/a.txt": "one", "subdir/b/c.txt": "one"},
+			wantVersion: "v1.0.0",
+			wantVars:    vars(v1SHA, "v1.0.0"),
+		},
+		{
+			name:        "branch_without_tag_uses_sha",
+			version:     "dev",
+			want:        map[string]string{"spec.yaml": "dev"},
+			wantVersion: devSHA,
+			wantVars:    vars(devSHA, ""),
+		},
+		{
+			name:        "subdir",
+			subdir:      "subdir",
+			version:     "v1.0.0",
+			want:        map[string]string{"a.txt": "one", "b/c.txt": "one"},
+			wantVersion: "v1.0.0",
+			wantVars:    vars(v1SHA, "v1.0.0"),
+		},
+		{
+			name:    "missing_subdir",
+			subdir:  "subdir",
+			version: "dev",
+			wantErr: `doesn't contain a subdirectory named "subdir"`,
+		},
+		{
+			name:    "missing_tag",
+			version: "v9.9.9",
+			wantErr: "Clone()",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dl := &remoteGitDownloader{
+				canonicalSource: "example.com/org/repo",
+				cloner:          &realCloner{},
+				remote:          remote.URL,
+				retry:           &RetryPolicy{},
+				subdir:          tc.subdir,
+				tagser:          &realTagser{},
+				version:         tc.version,
+			}
+
+			ctx := context.Background()
+			tempDir := t.TempDir()
+			gotDLMeta, err := dl.Download(ctx, "", tempDir)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+			got := abctestutil.LoadDirWithoutMode(t, tempDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("output files were not as expected (-got, +want): %s", diff)
+			}
+			wantDLMeta := &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "example.com/org/repo",
+				LocationType:    "remote_git",
+				HasVersion:      true,
+				Version:         tc.wantVersion,
+				Vars:            tc.wantVars,
+			}
+			if diff := cmp.Diff(gotDLMeta, wantDLMeta); diff != "" {
+				t.Errorf("DownloadMetadata was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestSemverTags(t *testing.T) {
+	t.Parallel()
+
+	tags := []string{"v1.2.0", "not-semver", "v1.10.0", "1.11.0", "v2.0.0-rc1", "v1.9.0+build", "v0.1.0"}
+
+	cases := []struct {
+		name        string
+		prereleases bool
+		want        []string
+	}{
+		{
+			name: "releases",
+			want: []string{"v1.10.0", "v1.2.0", "v0.1.0"},
+		},
+		{
+			name:        "with_prereleases",
+			prereleases: true,
+			want:        []string{"v2.0.0-rc1", "v1.10.0", "v1.9.0+build", "v1.2.0", "v0.1.0"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := semverTags(context.Background(), tags, tc.prereleases)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("semverTags() was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// DefaultDownloadRetries is the default number of times that a remote
+	// download that failed with a transient error is retried.
+	DefaultDownloadRetries = 3
+
+	defaultRetryInitialDelay = time.Second
+	defaultRetryMaxDelay     = 30 * time.Second
+)
+
+// RetryPolicy controls how downloads from remote locations, like a git clone
+// or fetching objects from a bucket, are retried when they fail with a
+// transient error, like a dropped connection or a "503 Service Unavailable".
+// Other errors, like a template that doesn't exist, are never retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of times to retry a failed download. Zero
+	// means that downloads are tried only once.
+	MaxRetries int
+
+	// InitialDelay is the wait before the first retry, which doubles for each
+	// following retry, up to MaxDelay. A random jitter of up to half of the
+	// delay is subtracted, so that many CI jobs that failed at the same time
+	// don't retry at the same time. If zero, defaults are used.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+
+	// sleep waits between retries. It's replaced in tests.
+	sleep func(context.Context, time.Duration) error
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is given.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{MaxRetries: DefaultDownloadRetries}
+}
+
+// retry calls fn until it succeeds, fails with an error that isn't transient,
+// or the retries run out. A nil policy is the default policy. what describes
+// the operation in log messages, and every retry is counted in stats, which
+// may be nil.
+func (p *RetryPolicy) retry(ctx context.Context, stats *DownloadStats, what string, fn func() error) error {
+	if p == nil {
+		p = DefaultRetryPolicy()
+	}
+	delay := p.InitialDelay
+	if delay <= 0 {
+		delay = defaultRetryInitialDelay
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = sleepCtx
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxRetries || ctx.Err() != nil || !isTransient(err) {
+			return err
+		}
+
+		wait := jitter(min(delay, maxDelay))
+		logging.FromContext(ctx).WarnContext(ctx, "retrying after a transient download error",
+			"operation", what,
+			"attempt", attempt+1,
+			"wait", wait,
+			"error", err)
+		stats.addRetry()
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// jitter returns a random duration between half of d and d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d - time.Duration(rand.Int63n(int64(d/2)+1)) //nolint:gosec // not security sensitive
+}
+
+// transientError marks an error as transient, meaning that the same request
+// might succeed if it's retried.
+type transientError struct {
+	err error
+}
+
+func (t *transientError) Error() string {
+	return t.err.Error()
+}
+
+func (t *transientError) Unwrap() error {
+	return t.err
+}
+
+// gitTransientMessages are parts of the error output of git commands that mean
+// the network or the server had a problem, rather than the repo or version
+// not existing.
+var gitTransientMessages = []string{
+	"could not resolve host",
+	"connection timed out",
+	"connection reset",
+	"connection refused",
+	"operation timed out",
+	"early eof",
+	"rpc failed",
+	"the remote end hung up unexpectedly",
+	"gnutls_handshake() failed",
+	"tls connection was non-properly terminated",
+	"the requested url returned error: 429",
+	"the requested url returned error: 500",
+	"the requested url returned error: 502",
+	"the requested url returned error: 503",
+	"the requested url returned error: 504",
+}
+
+// isTransient returns true if err might go away if the operation that caused
+// it is retried.
+func isTransient(err error) bool {
+	var te *transientError
+	if errors.As(err, &te) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range gitTransientMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// DownloadStats adds up the remote downloads done while rendering templates,
+// so that a summary can be printed at the end of a long run like a golden
+// test. A nil *DownloadStats records nothing. It's safe for concurrent use.
+type DownloadStats struct {
+	mu        sync.Mutex
+	downloads int
+	retries   int
+	bytes     int64
+	elapsed   time.Duration
+}
+
+// addDownload records one template downloaded from a remote location.
+func (s *DownloadStats) addDownload(bytes int64, elapsed time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.downloads++
+	s.bytes += bytes
+	s.elapsed += elapsed
+}
+
+func (s *DownloadStats) addRetry() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries++
+}
+
+// Downloads returns the number of templates downloaded from remote locations.
+func (s *DownloadStats) Downloads() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.downloads
+}
+
+// String returns a summary like "downloaded 2 templates (1.5 MiB) in 3.2s with
+// 1 retry".
+func (s *DownloadStats) String() string {
+	if s == nil {
+		return "downloaded 0 templates"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("downloaded %s (%s) in %s with %s",
+		plural(s.downloads, "template"),
+		common.FormatBytes(s.bytes),
+		s.elapsed.Round(100*time.Millisecond),
+		plural(s.retries, "retry"))
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	if strings.HasSuffix(noun, "y") {
+		noun = strings.TrimSuffix(noun, "y") + "ie"
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,316 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRetryPolicy_Retry(t *testing.T) {
+	t.Parallel()
+
+	transient := &transientError{errors.New("503 Service Unavailable")}
+
+	cases := []struct {
+		name        string
+		maxRetries  int
+		errs        []error
+		wantCalls   int
+		wantRetries int
+		wantErr     string
+	}{
+		{
+			name:       "success",
+			maxRetries: 3,
+			wantCalls:  1,
+		},
+		{
+			name:        "transient_then_success",
+			maxRetries:  3,
+			errs:        []error{transient, transient},
+			wantCalls:   3,
+			wantRetries: 2,
+		},
+		{
+			name:        "retries_run_out",
+			maxRetries:  2,
+			errs:        []error{transient, transient, transient, transient},
+			wantCalls:   3,
+			wantRetries: 2,
+			wantErr:     "503 Service Unavailable",
+		},
+		{
+			name:       "permanent_error_is_not_retried",
+			maxRetries: 3,
+			errs:       []error{errors.New("repository not found")},
+			wantCalls:  1,
+			wantErr:    "repository not found",
+		},
+		{
+			name:       "no_retries",
+			maxRetries: 0,
+			errs:       []error{transient},
+			wantCalls:  1,
+			wantErr:    "503 Service Unavailable",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			var sleeps []time.Duration
+			p := &RetryPolicy{
+				MaxRetries:   tc.maxRetries,
+				InitialDelay: 4 * time.Second,
+				MaxDelay:     10 * time.Second,
+				sleep: func(ctx context.Context, d time.Duration) error {
+					sleeps = append(sleeps, d)
+					return nil
+				},
+			}
+			stats := &DownloadStats{}
+			calls := 0
+			err := p.retry(ctx, stats, "test", func() error {
+				calls++
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, tc.wantCalls)
+			}
+			if stats.retries != tc.wantRetries || len(sleeps) != tc.wantRetries {
+				t.Errorf("got %d retries and %d waits, want %d", stats.retries, len(sleeps), tc.wantRetries)
+			}
+
+			// The delay doubles, up to the maximum, minus up to half for
+			// jitter.
+			wantMax := []time.Duration{4 * time.Second, 8 * time.Second, 10 * time.Second}
+			for i, d := range sleeps {
+				if d > wantMax[i] || d < wantMax[i]/2 {
+					t.Errorf("wait %d was %v, want between %v and %v", i, d, wantMax[i]/2, wantMax[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Retry_Canceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(logging.WithLogger(context.Background(), logging.TestLogger(t)))
+	p := &RetryPolicy{
+		MaxRetries: 3,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			cancel()
+			return ctx.Err()
+		},
+	}
+	calls := 0
+	err := p.retry(ctx, nil, "test", func() error {
+		calls++
+		return &transientError{errors.New("connection reset")}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "marked_transient",
+			err:  fmt.Errorf("wrapped: %w", &transientError{errors.New("boom")}),
+			want: true,
+		},
+		{
+			name: "net_error",
+			err:  fmt.Errorf("GET: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+			want: true,
+		},
+		{
+			name: "unexpected_eof",
+			err:  fmt.Errorf("reading: %w", io.ErrUnexpectedEOF),
+			want: true,
+		},
+		{
+			name: "git_dns_failure",
+			err:  errors.New("exec of [git clone] failed\nstderr: fatal: unable to access 'https://github.com/a/b.git/': Could not resolve host: github.com"),
+			want: true,
+		},
+		{
+			name: "git_server_error",
+			err:  errors.New("stderr: fatal: unable to access 'https://github.com/a/b.git/': The requested URL returned error: 503"),
+			want: true,
+		},
+		{
+			name: "git_early_eof",
+			err:  errors.New("stderr: error: RPC failed; curl 18 transfer closed\nfatal: early EOF"),
+			want: true,
+		},
+		{
+			name: "git_missing_branch",
+			err:  errors.New("stderr: warning: Could not find remote branch v9.9.9 to clone."),
+		},
+		{
+			name: "git_not_found",
+			err:  errors.New("stderr: remote: Repository not found.\nfatal: repository 'https://github.com/a/b.git/' not found"),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := isTransient(tc.err); got != tc.want {
+				t.Errorf("isTransient(%q) = %t, want %t", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDownloadStats_String(t *testing.T) {
+	t.Parallel()
+
+	var nilStats *DownloadStats
+	nilStats.addDownload(1, time.Second)
+	nilStats.addRetry()
+
+	s := &DownloadStats{}
+	s.addDownload(1024, 1200*time.Millisecond)
+	s.addDownload(512, 2*time.Second)
+	s.addRetry()
+
+	cases := []struct {
+		name  string
+		stats *DownloadStats
+		want  string
+	}{
+		{
+			name:  "nil",
+			stats: nilStats,
+			want:  "downloaded 0 templates",
+		},
+		{
+			name:  "some",
+			stats: s,
+			want:  "downloaded 2 templates (1.5 KiB) in 3.2s with 1 retry",
+		},
+		{
+			name:  "empty",
+			stats: &DownloadStats{},
+			want:  "downloaded 0 templates (0 B) in 0s with 0 retries",
+		},
+	}
+
+	for _, tc := range cases {
+		if got := tc.stats.String(); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// flakyCloner fails its first "failures" clones with a network error, after
+// leaving a partially cloned repo behind, and then uses cloner.
+type flakyCloner struct {
+	cloner   cloner
+	failures int
+}
+
+func (f *flakyCloner) Clone(ctx context.Context, remote, version, outDir string) error {
+	if f.failures > 0 {
+		f.failures--
+		if err := os.WriteFile(filepath.Join(outDir, "partial.txt"), []byte("partial"), common.OwnerRWPerms); err != nil {
+			return err //nolint:wrapcheck
+		}
+		return fmt.Errorf("stderr: error: RPC failed; curl 56 GnuTLS recv error (-54)\nfatal: early EOF")
+	}
+	return f.cloner.Clone(ctx, remote, version, outDir)
+}
+
+func TestRemoteGitDownloader_DownloadRetries(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	files := map[string]string{"spec.yaml": "my spec"}
+	stats := &DownloadStats{}
+	dl := &remoteGitDownloader{
+		ignoreDirty:     true,
+		canonicalSource: "mysource",
+		remote:          "fake-remote",
+		version:         "v1.2.3",
+		cloner: &flakyCloner{
+			failures: 2,
+			cloner: &fakeCloner{
+				t:           t,
+				addTag:      "v1.2.3",
+				out:         files,
+				wantRemote:  "fake-remote",
+				wantVersion: "v1.2.3",
+			},
+		},
+		retry: &RetryPolicy{
+			MaxRetries: 2,
+			sleep:      func(context.Context, time.Duration) error { return nil },
+		},
+		stats: stats,
+	}
+
+	destDir := t.TempDir()
+	if _, err := dl.Download(ctx, "", destDir); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, destDir), files); diff != "" {
+		t.Errorf("output files were not as expected (-got,+want): %s", diff)
+	}
+	if stats.downloads != 1 || stats.retries != 2 || stats.bytes == 0 {
+		t.Errorf("got %d downloads of %d bytes with %d retries, want 1 download of more than 0 bytes with 2 retries",
+			stats.downloads, stats.bytes, stats.retries)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+
+	// emptyPayloadHash is the hex SHA-256 of an empty request body, which is
+	// what every request sent by s3Client has.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var _ bucketClient = (*s3Client)(nil)
+
+// s3Client implements bucketClient using the Amazon S3 REST API. Requests are
+// signed with AWS Signature Version 4 if there are credentials.
+type s3Client struct {
+	region string
+
+	// endpoint, if set, is the base URL of an S3-compatible service, which is
+	// addressed with path-style URLs like "<endpoint>/<bucket>/<key>".
+	// Otherwise, the virtual-hosted style
+	// "https://<bucket>.s3.<region>.amazonaws.com/<key>" is used.
+	endpoint string
+
+	// If accessKeyID is empty, requests are anonymous, which only works for
+	// public buckets.
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+
+	httpClient *http.Client
+
+	// now is the clock used for signing.
+	now func() time.Time
+}
+
+// newS3Client configures an s3Client from the same environment variables as
+// the AWS CLI: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN,
+// AWS_REGION (or AWS_DEFAULT_REGION), and AWS_ENDPOINT_URL_S3 (or
+// AWS_ENDPOINT_URL).
+func newS3Client(lookupEnv func(string) (string, bool)) *s3Client {
+	getenv := func(names ...string) string {
+		for _, name := range names {
+			if v, ok := lookupEnv(name); ok && v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	c := &s3Client{
+		region:          getenv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		endpoint:        strings.TrimSuffix(getenv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"), "/"),
+		accessKeyID:     getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    getenv("AWS_SESSION_TOKEN"),
+		httpClient:      http.DefaultClient,
+		now:             time.Now,
+	}
+	if c.region == "" {
+		c.region = defaultS3Region
+	}
+	return c
+}
+
+// list implements bucketClient, using ListObjectsV2.
+func (c *s3Client) list(ctx context.Context, bucket, prefix string) ([]*bucketObject, error) {
+	var out []*bucketObject
+	continuationToken := ""
+	for {
+		q := map[string]string{
+			"list-type": "2",
+			"prefix":    prefix,
+		}
+		if continuationToken != "" {
+			q["continuation-token"] = continuationToken
+		}
+
+		body, err := c.do(ctx, bucket, "", q, -1)
+		if err != nil {
+			return nil, fmt.Errorf("failed listing objects in S3 bucket %q: %w", bucket, err)
+		}
+		var page struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				ETag string `xml:"ETag"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("failed parsing the list of objects in S3 bucket %q: %w", bucket, err)
+		}
+		for _, item := range page.Contents {
+			out = append(out, &bucketObject{name: item.Key, version: strings.Trim(item.ETag, `"`)})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return out, nil
+		}
+		continuationToken = page.NextContinuationToken
+	}
+}
+
+// get implements bucketClient.
+func (c *s3Client) get(ctx context.Context, bucket string, obj *bucketObject, maxBytes int64) ([]byte, error) {
+	body, err := c.do(ctx, bucket, obj.name, nil, maxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed downloading object %q from S3 bucket %q: %w", obj.name, bucket, err)
+	}
+	return body, nil
+}
+
+func (c *s3Client) do(ctx context.Context, bucket, key string, query map[string]string, maxBytes int64) ([]byte, error) {
+	var base, escapedPath string
+	if c.endpoint != "" {
+		base = c.endpoint
+		escapedPath = "/" + awsURIEncode(bucket, false) + "/" + awsURIEncode(key, true)
+	} else {
+		base = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, c.region)
+		escapedPath = "/" + awsURIEncode(key, true)
+	}
+
+	u := base + escapedPath
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("NewRequest(): %w", err)
+	}
+	if c.accessKeyID != "" {
+		c.sign(req, c.now())
+	}
+	return doBucketRequest(c.httpClient, req, maxBytes)
+}
+
+// sign adds AWS Signature Version 4 headers to req, which must have no body.
+// Every header already on req is signed, along with the Host header. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html.
+func (c *s3Client) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, vals := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(vals, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalURI := req.URL.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretAccessKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters the way Signature Version 4 requires:
+// sorted by name, with every value present, and URI-encoded.
+func canonicalQuery(query map[string]string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, awsURIEncode(name, false)+"="+awsURIEncode(query[name], false))
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes every byte of s except the RFC 3986 unreserved
+// characters, and except "/" if keepSlash is true. This is stricter than
+// url.PathEscape and url.QueryEscape, and is what Signature Version 4 requires.
+func awsURIEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && keepSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
@@ -20,6 +20,8 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/common/specutil"
 )
 
@@ -54,6 +56,10 @@ var realSourceParsers = []sourceParser{
 
 	&localSourceParser{}, // Handles a template source that's a local directory.
 
+	// Handles template sources like "gs://my-bucket/my-template/" and
+	// "s3://my-bucket/my-template.tar.gz".
+	&bucketSourceParser{},
+
 	&remoteGitSourceParser{
 		// This source parser recognizes template sources like
 		// github.com/abcxyz/abc.git//t/react_template?ref=latest.
@@ -95,6 +101,38 @@ type ParseSourceParams struct {
 
 	// The value of --git-protocol.
 	GitProtocol string
+
+	// FS is the filesystem that local templates are read from and that
+	// templates are downloaded into. If nil, the real filesystem is used.
+	FS common.FS
+
+	// The value of --symlinks. This controls how symlinks in a local template
+	// directory are copied. Templates in remote git repos may never contain
+	// symlinks.
+	Symlinks common.SymlinkMode
+
+	// The values of --max-files, --max-bytes, and --max-path-depth, which
+	// limit the size of the downloaded template. If nil, there are no limits.
+	Limits *common.Limits
+
+	// VendorDir is an absolute path to a directory that templates were
+	// vendored into with "abc templates vendor". If it's non-empty and
+	// Source was vendored there, the vendored copy is used instead of
+	// downloading the template.
+	VendorDir string
+
+	// Retry controls how downloads from remote locations are retried when
+	// they fail with a transient error. If nil, DefaultRetryPolicy is used.
+	Retry *RetryPolicy
+
+	// Stats is optional, and if non-nil, adds up the downloads from remote
+	// locations.
+	Stats *DownloadStats
+
+	// The value of --allow-dirty-template. If true, a local template in a git
+	// workspace with uncommitted changes gets a version in the manifest that's
+	// marked as dirty, rather than no version.
+	AllowDirty bool
 }
 
 // ParseSource maps the input template source to a particular kind of
@@ -103,15 +141,26 @@ type ParseSourceParams struct {
 // source is a template location, like "github.com/foo/bar@v1.2.3". protocol is
 // the value of the --protocol flag, like "https".
 //
-// A list of sourceParsers is accepted as input for the purpose of testing,
-// rather than hardcoding the real list of sourceParsers.
+// Besides the built-in kinds of sources, the parsers added with
+// RegisterSourceParser are tried; see there for the order. A template that was
+// vendored into params.VendorDir takes precedence over all of them.
 func ParseSource(ctx context.Context, params *ParseSourceParams) (Downloader, error) {
 	if strings.HasSuffix(params.Source, specutil.SpecFileName) {
 		return nil, fmt.Errorf("the template source argument should be the name of a directory *containing* %s; it should not be the full path to %s",
 			specutil.SpecFileName, specutil.SpecFileName)
 	}
 
-	for _, sp := range realSourceParsers {
+	if params.VendorDir != "" {
+		downloader, ok, err := vendoredSource(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return downloader, nil
+		}
+	}
+
+	for _, sp := range allSourceParsers() {
 		downloader, ok, err := sp.sourceParse(ctx, params)
 		if err != nil {
 			return nil, err //nolint:wrapcheck
@@ -120,5 +169,32 @@ func ParseSource(ctx context.Context, params *ParseSourceParams) (Downloader, er
 			return downloader, nil
 		}
 	}
-	return nil, fmt.Errorf(`template source %q isn't a valid template name or doesn't exist; examples of valid names are: "github.com/myorg/myrepo/subdir@v1.2.3", "github.com/myorg/myrepo/subdir@latest", "./my-local-directory"`, params.Source)
+	return nil, errs.Wrap(errs.ErrSourceNotFound, fmt.Errorf(`template source %q isn't a valid template name or doesn't exist; examples of valid names are: "github.com/myorg/myrepo/subdir@v1.2.3", "github.com/myorg/myrepo/subdir@latest", "./my-local-directory", "gs://my-bucket/my-template"`, params.Source))
+}
+
+// RemoteGitHost returns the host that the given template source would be
+// cloned from if it's a remote git repo, like "github.com", and false if it
+// isn't in any of the remote git formats. It doesn't check whether source is
+// also a local directory, which ParseSource would prefer.
+func RemoteGitHost(source string) (string, bool) {
+	for _, sp := range realSourceParsers {
+		gsp, ok := sp.(*remoteGitSourceParser)
+		if !ok {
+			continue
+		}
+		match := gsp.re.FindStringSubmatchIndex(source)
+		if match == nil {
+			continue
+		}
+		return string(gsp.re.ExpandString(nil, "${host}", source, match)), true
+	}
+	return "", false
+}
+
+// fsOrReal returns the given filesystem, or the real filesystem if it's nil.
+func fsOrReal(f common.FS) common.FS {
+	if f == nil {
+		return &common.RealFS{}
+	}
+	return f
 }
@@ -157,6 +157,17 @@ func TestParseSource(t *testing.T) {
 			// A warning will be logged too, that's not shown here.
 			wantErr: "isn't a valid template name or doesn't exist",
 		},
+		{
+			name:   "yaml_file_is_single_file_template",
+			source: "./my/dir/hello.yaml",
+			tempDirContents: map[string]string{
+				"my/dir/hello.yaml": "my spec file contents",
+			},
+			want: &LocalDownloader{
+				SrcPath:    "my/dir/hello.yaml",
+				SingleFile: true,
+			},
+		},
 
 		{
 			name:   "dot_slash_forces_treating_as_local_dir",
@@ -295,7 +306,7 @@ func TestParseSource(t *testing.T) {
 				cmp.Comparer(func(a, b LocalDownloader) bool {
 					l := strings.TrimPrefix(a.SrcPath, tempDir+string(filepath.Separator))
 					r := strings.TrimPrefix(b.SrcPath, tempDir+string(filepath.Separator))
-					return l == r
+					return l == r && a.SingleFile == b.SingleFile
 				}),
 			}
 			if diff := cmp.Diff(got, tc.want, opts...); diff != "" {
@@ -309,12 +320,12 @@ func TestGitCanonicalVersion(t *testing.T) {
 	t.Parallel()
 
 	cases := []struct {
-		name       string
-		dir        string
-		allowDirty bool
-		files      map[string]string
-		want       string
-		wantErr    string
+		name    string
+		dir     string
+		dirty   dirtyMode
+		files   map[string]string
+		want    string
+		wantErr string
 	}{
 		{
 			name:  "simple_success_no_tag",
@@ -382,22 +393,50 @@ func TestGitCanonicalVersion(t *testing.T) {
 			files: nil,
 		},
 		{
-			name:       "dirty_workspace_not_allowed",
-			dir:        ".",
-			allowDirty: false,
+			name:  "dirty_workspace_omitted",
+			dir:   ".",
+			dirty: dirtyOmit,
 			files: abctestutil.WithGitRepoAt("", map[string]string{
 				"my_file.txt": "my contents",
 			}),
 		},
 		{
-			name:       "dirty_workspace_allowed",
-			dir:        ".",
-			allowDirty: true,
+			name:  "dirty_workspace_ignored",
+			dir:   ".",
+			dirty: dirtyIgnore,
 			files: abctestutil.WithGitRepoAt("", map[string]string{
 				"my_file.txt": "my contents",
 			}),
 			want: abctestutil.MinimalGitHeadSHA,
 		},
+		{
+			name:  "dirty_workspace_marked",
+			dir:   ".",
+			dirty: dirtyMark,
+			files: abctestutil.WithGitRepoAt("", map[string]string{
+				"my_file.txt": "my contents",
+			}),
+			want: abctestutil.MinimalGitHeadSHA + "-dirty",
+		},
+		{
+			name:  "dirty_workspace_marked_with_tag",
+			dir:   ".",
+			dirty: dirtyMark,
+			files: abctestutil.WithGitRepoAt("", map[string]string{
+				".git/refs/tags/v1.2.3": abctestutil.MinimalGitHeadSHA,
+				"my_file.txt":           "my contents",
+			}),
+			want: "v1.2.3-dirty",
+		},
+		{
+			name:  "clean_workspace_not_marked",
+			dir:   ".",
+			dirty: dirtyMark,
+			files: abctestutil.WithGitRepoAt("", map[string]string{
+				".git/refs/tags/v1.2.3": abctestutil.MinimalGitHeadSHA,
+			}),
+			want: "v1.2.3",
+		},
 	}
 
 	for _, tc := range cases {
@@ -409,7 +448,7 @@ func TestGitCanonicalVersion(t *testing.T) {
 			tmp := t.TempDir()
 			abctestutil.WriteAllDefaultMode(t, tmp, tc.files)
 			ctx := context.Background()
-			got, gotOK, err := gitCanonicalVersion(ctx, filepath.Join(tmp, tc.dir), tc.allowDirty)
+			got, gotOK, err := gitCanonicalVersion(ctx, filepath.Join(tmp, tc.dir), tc.dirty)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Error(diff)
 			}
@@ -424,3 +463,33 @@ func TestGitCanonicalVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoteGitHost(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		source   string
+		wantHost string
+		wantOK   bool
+	}{
+		{source: "github.com/abcxyz/abc/t/rest_server@latest", wantHost: "github.com", wantOK: true},
+		{source: "gitlab.com/myorg/myrepo@v1.2.3", wantHost: "gitlab.com", wantOK: true},
+		{source: "github.com/abcxyz/abc.git//t/rest_server?ref=v1.2.3", wantHost: "github.com", wantOK: true},
+		{source: "git.internal.example.com/myorg/myrepo.git", wantHost: "git.internal.example.com", wantOK: true},
+		{source: "./my-local-directory"},
+		{source: "gs://my-bucket/my-template"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.source, func(t *testing.T) {
+			t.Parallel()
+
+			host, ok := RemoteGitHost(tc.source)
+			if host != tc.wantHost || ok != tc.wantOK {
+				t.Errorf("RemoteGitHost(%q) = (%q, %t), want (%q, %t)", tc.source, host, ok, tc.wantHost, tc.wantOK)
+			}
+		})
+	}
+}
@@ -17,7 +17,9 @@ package templatesource
 import (
 	"context"
 	"fmt"
+	"os"
 	"regexp"
+	"strings"
 
 	"github.com/abcxyz/abc/templates/common/git"
 )
@@ -30,6 +32,8 @@ var (
 	upgradeDownloaderFactories = map[string]upgradeDownloaderFactory{
 		LocTypeRemoteGit: remoteGitUpgradeDownloaderFactory,
 		LocTypeLocalGit:  localGitUpgradeDownloaderFactory,
+		LocTypeGCS:       bucketUpgradeDownloaderFactory,
+		LocTypeS3:        bucketUpgradeDownloaderFactory,
 	}
 
 	// Used only when location type is remote_git. Parses a string like
@@ -77,6 +81,47 @@ func remoteGitUpgradeDownloaderFactory(ctx context.Context, canonicalLocation, g
 	return downloader, nil
 }
 
+// LatestVersion returns the latest released version of the template at the
+// canonical location from a manifest file, which is its highest semver tag.
+// It returns false if the location type has no released versions, which is
+// the case for everything except remote_git.
+func LatestVersion(ctx context.Context, canonicalLocation, locType, gitProtocol string) (string, bool, error) {
+	if locType != LocTypeRemoteGit {
+		return "", false, nil
+	}
+	downloader, err := remoteGitUpgradeDownloaderFactory(ctx, canonicalLocation, gitProtocol, "")
+	if err != nil {
+		return "", false, err
+	}
+	g := downloader.(*remoteGitDownloader) //nolint:forcetypeassert
+	latest, err := resolveLatest(ctx, &retryingTagser{tagser: g.tagser, retry: g.retry, stats: g.stats}, g.remote, "latest")
+	if err != nil {
+		return "", false, err
+	}
+	return latest, true, nil
+}
+
+// ListVersions returns the versions of the template in a remote git repo at
+// location, like "github.com/org/repo/subdir", from highest to lowest. The
+// versions are the repo's semver tags, which are listed without cloning it,
+// so this is fast even for a huge repo. The highest version without a
+// prerelease suffix is the one that "@latest" resolves to. Versions with a
+// prerelease suffix, like "v1.2.3-rc1", are only included if prereleases is
+// true. An "@version" at the end of location is ignored.
+func ListVersions(ctx context.Context, location, gitProtocol string, prereleases bool) ([]string, error) {
+	location, _, _ = strings.Cut(location, "@")
+	downloader, err := remoteGitUpgradeDownloaderFactory(ctx, location, gitProtocol, "")
+	if err != nil {
+		return nil, err
+	}
+	g := downloader.(*remoteGitDownloader) //nolint:forcetypeassert
+	tags, err := (&retryingTagser{tagser: g.tagser, retry: g.retry, stats: g.stats}).Tags(ctx, g.remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing the tags of %q: %w", g.remote, err)
+	}
+	return semverTags(ctx, tags, prereleases), nil
+}
+
 func localGitUpgradeDownloaderFactory(ctx context.Context, canonicalLocation, gitProtocol, destDir string) (Downloader, error) {
 	// When upgrading from a local directory, we enforce that the upgrade source
 	// and destination dirs are in the same git workspace. This is a security
@@ -85,7 +130,14 @@ func localGitUpgradeDownloaderFactory(ctx context.Context, canonicalLocation, gi
 	// the git workspace that it's in.
 	//
 	// We could relax this in the future if we encounter a legitimate use case.
-	sourceGitWorkspace, ok, err := git.Workspace(ctx, canonicalLocation)
+	downloader := &LocalDownloader{
+		SrcPath: canonicalLocation,
+	}
+	if fi, err := os.Stat(canonicalLocation); err == nil && fi.Mode().IsRegular() && isSpecFileName(canonicalLocation) {
+		downloader.SingleFile = true
+	}
+
+	sourceGitWorkspace, ok, err := git.Workspace(ctx, downloader.Dir())
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
@@ -103,7 +155,5 @@ func localGitUpgradeDownloaderFactory(ctx context.Context, canonicalLocation, gi
 		return nil, fmt.Errorf("for now, when upgrading, the template source and destination directories must be in the same git workspace, but they are %q and %q respectively", sourceGitWorkspace, destGitWorkspace)
 	}
 
-	return &LocalDownloader{
-		SrcPath: canonicalLocation,
-	}, nil
+	return downloader, nil
 }
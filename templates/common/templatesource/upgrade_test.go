@@ -187,3 +187,30 @@ func TestForCanonical(t *testing.T) {
 		})
 	}
 }
+
+func TestLatestVersion_NoRemote(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// Only remote_git locations have released versions.
+	for _, locType := range []string{LocTypeLocalGit, LocTypeGCS, LocTypeS3} {
+		if got, ok, err := LatestVersion(ctx, "some/location", locType, "https"); err != nil || ok || got != "" {
+			t.Errorf("LatestVersion(%q) = (%q, %t, %v), want no version", locType, got, ok, err)
+		}
+	}
+
+	_, _, err := LatestVersion(ctx, "example.com/not/github", LocTypeRemoteGit, "https")
+	if diff := testutil.DiffErrString(err, "failed parsing canonical location"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestListVersions_BadLocation(t *testing.T) {
+	t.Parallel()
+
+	_, err := ListVersions(context.Background(), "example.com/not/github@v1.2.3", "https", false)
+	if diff := testutil.DiffErrString(err, `failed parsing canonical location "example.com/not/github"`); diff != "" {
+		t.Error(diff)
+	}
+}
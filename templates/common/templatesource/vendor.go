@@ -0,0 +1,220 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// DefaultVendorDir is where "abc templates vendor" puts templates,
+	// relative to the root of the git workspace.
+	DefaultVendorDir = "third_party/templates"
+
+	// VendorIndexFileName is the name of the file in a vendor directory that
+	// records where each vendored template came from.
+	VendorIndexFileName = "vendor.yaml"
+)
+
+// VendorIndex is the contents of the vendor.yaml file in a vendor directory.
+type VendorIndex struct {
+	// Templates are the vendored templates, sorted by name.
+	Templates []*VendorEntry `yaml:"templates"`
+}
+
+// VendorEntry is the provenance of one vendored template.
+type VendorEntry struct {
+	// Name is the subdirectory of the vendor directory that contains the
+	// template.
+	Name string `yaml:"name"`
+
+	// Source is the template location that was given when the template was
+	// vendored, like "github.com/foo/bar@v1.2.3" or "github.com/foo/bar@latest".
+	Source string `yaml:"source"`
+
+	// CanonicalSource, LocationType, and Version are the DownloadMetadata of
+	// the upstream template, so that rendering the vendored copy records the
+	// same thing in the manifest as rendering the upstream template would.
+	CanonicalSource string `yaml:"canonical_source"`
+	LocationType    string `yaml:"location_type"`
+	Version         string `yaml:"version"`
+
+	// GitSHA and GitTag are the upstream values of _git_sha and _git_tag, if
+	// the template came from a git repo.
+	GitSHA string `yaml:"git_sha,omitempty"`
+	GitTag string `yaml:"git_tag,omitempty"`
+
+	// GitCommitTime, GitAuthorName, and GitAuthorEmail are the upstream
+	// values of _git_commit_time, _git_author_name, and _git_author_email.
+	GitCommitTime  string `yaml:"git_commit_time,omitempty"`
+	GitAuthorName  string `yaml:"git_author_name,omitempty"`
+	GitAuthorEmail string `yaml:"git_author_email,omitempty"`
+
+	// Dirhash is the hash of the template directory when it was vendored, as
+	// computed by common.HashTemplateDir. It's used to detect vendored copies
+	// that were changed by hand.
+	Dirhash string `yaml:"dirhash"`
+}
+
+// LoadVendorIndex reads the vendor.yaml file in vendorDir. If the file
+// doesn't exist, an empty index is returned.
+func LoadVendorIndex(rfs common.FS, vendorDir string) (*VendorIndex, error) {
+	path := filepath.Join(vendorDir, VendorIndexFileName)
+	buf, err := rfs.ReadFile(path)
+	if err != nil {
+		if common.IsStatNotExistErr(err) {
+			return &VendorIndex{}, nil
+		}
+		return nil, fmt.Errorf("failed reading vendor index: %w", err)
+	}
+	out := &VendorIndex{}
+	if err := yaml.Unmarshal(buf, out); err != nil {
+		return nil, fmt.Errorf("failed parsing vendor index %q: %w", path, err)
+	}
+	return out, nil
+}
+
+// SaveVendorIndex writes idx to the vendor.yaml file in vendorDir, sorting
+// the entries by name so the file has a stable order.
+func SaveVendorIndex(rfs common.FS, vendorDir string, idx *VendorIndex) error {
+	sort.Slice(idx.Templates, func(i, j int) bool {
+		return idx.Templates[i].Name < idx.Templates[j].Name
+	})
+	buf, err := yaml.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed marshaling vendor index: %w", err)
+	}
+	buf = append([]byte("# Generated by \"abc templates vendor\". DO NOT EDIT.\n"), buf...)
+	if err := rfs.MkdirAll(vendorDir, common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("MkdirAll(): %w", err)
+	}
+	if err := rfs.WriteFile(filepath.Join(vendorDir, VendorIndexFileName), buf, common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("failed writing vendor index: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the entry for the template that was vendored from source,
+// or nil. A source matches an entry if it's the same as the source that was
+// vendored, or if it names the exact version that was vendored, like
+// "github.com/foo/bar@v1.2.3" for a template that was vendored from
+// "github.com/foo/bar@latest".
+func (v *VendorIndex) Lookup(source string) *VendorEntry {
+	for _, e := range v.Templates {
+		if source == e.Source || source == e.CanonicalSource+"@"+e.Version {
+			return e
+		}
+	}
+	return nil
+}
+
+// vendoredSource returns a downloader for the vendored copy of
+// params.Source, if there is one in params.VendorDir.
+func vendoredSource(ctx context.Context, params *ParseSourceParams) (Downloader, bool, error) {
+	logger := logging.FromContext(ctx).With("logger", "vendoredSource")
+
+	idx, err := LoadVendorIndex(fsOrReal(params.FS), params.VendorDir)
+	if err != nil {
+		return nil, false, err
+	}
+	entry := idx.Lookup(params.Source)
+	if entry == nil {
+		return nil, false, nil
+	}
+
+	logger.InfoContext(ctx, "using vendored copy of template",
+		"source", params.Source,
+		"vendor_dir", params.VendorDir,
+		"name", entry.Name)
+
+	return &vendoredDownloader{
+		dir:      filepath.Join(params.VendorDir, entry.Name),
+		entry:    entry,
+		fs:       params.FS,
+		symlinks: params.Symlinks,
+		limits:   params.Limits,
+	}, true, nil
+}
+
+// vendoredDownloader implements Downloader for a template that was vendored
+// with "abc templates vendor".
+type vendoredDownloader struct {
+	// dir is the directory containing the vendored template.
+	dir string
+
+	// entry is the vendor.yaml entry for the template.
+	entry *VendorEntry
+
+	fs       common.FS
+	symlinks common.SymlinkMode
+	limits   *common.Limits
+}
+
+// Download implements Downloader.
+func (v *vendoredDownloader) Download(ctx context.Context, cwd, destDir string) (*DownloadMetadata, error) {
+	// Refuse to render a vendored template that doesn't match what was
+	// downloaded, since the manifest would claim that it came from upstream.
+	// The hash is computed with the algorithm that the vendor index used.
+	alg, err := hashalg.Of(v.entry.Dirhash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dirhash for %q in %s: %w", v.dir, VendorIndexFileName, err)
+	}
+	dirhash, err := common.HashTemplateDirWith(ctx, fsOrReal(v.fs), v.dir, alg)
+	if err != nil {
+		return nil, fmt.Errorf("failed hashing vendored template %q: %w", v.dir, err)
+	}
+	if dirhash != v.entry.Dirhash {
+		return nil, fmt.Errorf("the vendored template in %q was changed after it was vendored (its dirhash is %s, but %s says %s); run \"abc templates vendor\" again to restore it",
+			v.dir, dirhash, VendorIndexFileName, v.entry.Dirhash)
+	}
+
+	if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+		SrcRoot:  v.dir,
+		DstRoot:  destDir,
+		FS:       fsOrReal(v.fs),
+		Symlinks: v.symlinks,
+		Limits:   v.limits,
+	}); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	vars := DownloaderVars{
+		GitSHA:         v.entry.GitSHA,
+		GitTag:         v.entry.GitTag,
+		GitCommitTime:  v.entry.GitCommitTime,
+		GitAuthorName:  v.entry.GitAuthorName,
+		GitAuthorEmail: v.entry.GitAuthorEmail,
+	}
+	if len(vars.GitSHA) >= 7 {
+		vars.GitShortSHA = vars.GitSHA[:7]
+	}
+	return &DownloadMetadata{
+		IsCanonical:     true,
+		CanonicalSource: v.entry.CanonicalSource,
+		LocationType:    v.entry.LocationType,
+		HasVersion:      true,
+		Version:         v.entry.Version,
+		Vars:            vars,
+	}, nil
+}
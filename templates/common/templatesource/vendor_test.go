@@ -0,0 +1,268 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestVendorIndex_Lookup(t *testing.T) {
+	t.Parallel()
+
+	entry := &VendorEntry{
+		Name:            "foo",
+		Source:          "github.com/myorg/myrepo/foo@latest",
+		CanonicalSource: "github.com/myorg/myrepo/foo",
+		Version:         "v1.2.3",
+	}
+	idx := &VendorIndex{Templates: []*VendorEntry{entry}}
+
+	cases := []struct {
+		source string
+		want   *VendorEntry
+	}{
+		{source: "github.com/myorg/myrepo/foo@latest", want: entry},
+		{source: "github.com/myorg/myrepo/foo@v1.2.3", want: entry},
+		{source: "github.com/myorg/myrepo/foo@v1.2.4"},
+		{source: "github.com/myorg/myrepo/foo"},
+		{source: "foo"},
+	}
+	for _, tc := range cases {
+		if got := idx.Lookup(tc.source); got != tc.want {
+			t.Errorf("Lookup(%q) got %v, want %v", tc.source, got, tc.want)
+		}
+	}
+}
+
+func TestLoadSaveVendorIndex(t *testing.T) {
+	t.Parallel()
+
+	fs := &common.RealFS{}
+	vendorDir := filepath.Join(t.TempDir(), "third_party", "templates")
+
+	got, err := LoadVendorIndex(fs, vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, &VendorIndex{}); diff != "" {
+		t.Errorf("a missing vendor index wasn't empty (-got,+want): %s", diff)
+	}
+
+	want := &VendorIndex{Templates: []*VendorEntry{
+		{Name: "a", Source: "github.com/myorg/myrepo/a@v1", CanonicalSource: "github.com/myorg/myrepo/a", LocationType: LocTypeRemoteGit, Version: "v1", GitSHA: "abc123", Dirhash: "h1:a"},
+		{Name: "b", Source: "gs://bucket/b", CanonicalSource: "gs://bucket/b/", LocationType: LocTypeGCS, Version: "12345", Dirhash: "h1:b"},
+	}}
+	if err := SaveVendorIndex(fs, vendorDir, &VendorIndex{Templates: []*VendorEntry{want.Templates[1], want.Templates[0]}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = LoadVendorIndex(fs, vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("vendor index was not as expected after a round trip (-got,+want): %s", diff)
+	}
+}
+
+func TestParseSource_Vendored(t *testing.T) {
+	t.Parallel()
+
+	templateFiles := map[string]string{
+		"spec.yaml": "spec contents",
+		"a.txt":     "a contents",
+	}
+
+	cases := []struct {
+		name         string
+		source       string
+		modify       map[string]string
+		alg          *hashalg.Algorithm // of the vendor.yaml dirhash; defaults to hashalg.Default
+		wantVendored bool
+		want         *DownloadMetadata
+		wantErr      string
+	}{
+		{
+			name:         "vendored",
+			source:       "github.com/myorg/myrepo/foo@v1.2.3",
+			wantVendored: true,
+			want: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "github.com/myorg/myrepo/foo",
+				LocationType:    LocTypeRemoteGit,
+				HasVersion:      true,
+				Version:         "v1.2.3",
+				Vars: DownloaderVars{
+					GitSHA:      "5b5e3fa0b4cae8dc2e2b5d8b0b8a4c1b1f0b2c3d",
+					GitShortSHA: "5b5e3fa",
+					GitTag:      "v1.2.3",
+				},
+			},
+		},
+		{
+			name:         "vendored_with_other_hash_algorithm",
+			source:       "github.com/myorg/myrepo/foo@v1.2.3",
+			alg:          hashalg.SHA512,
+			wantVendored: true,
+			want: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "github.com/myorg/myrepo/foo",
+				LocationType:    LocTypeRemoteGit,
+				HasVersion:      true,
+				Version:         "v1.2.3",
+				Vars: DownloaderVars{
+					GitSHA:      "5b5e3fa0b4cae8dc2e2b5d8b0b8a4c1b1f0b2c3d",
+					GitShortSHA: "5b5e3fa",
+					GitTag:      "v1.2.3",
+				},
+			},
+		},
+		{
+			name:   "other_version_not_vendored",
+			source: "github.com/myorg/myrepo/foo@v1.2.4",
+		},
+		{
+			name:         "modified",
+			source:       "github.com/myorg/myrepo/foo@v1.2.3",
+			modify:       map[string]string{"a.txt": "changed"},
+			wantVendored: true,
+			wantErr:      "was changed after it was vendored",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			vendorDir := t.TempDir()
+			abctestutil.WriteAllDefaultMode(t, filepath.Join(vendorDir, "foo"), templateFiles)
+			alg := tc.alg
+			if alg == nil {
+				alg = hashalg.Default
+			}
+			dirhash, err := common.HashTemplateDirWith(ctx, &common.RealFS{}, filepath.Join(vendorDir, "foo"), alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := SaveVendorIndex(&common.RealFS{}, vendorDir, &VendorIndex{Templates: []*VendorEntry{{
+				Name:            "foo",
+				Source:          "github.com/myorg/myrepo/foo@v1.2.3",
+				CanonicalSource: "github.com/myorg/myrepo/foo",
+				LocationType:    LocTypeRemoteGit,
+				Version:         "v1.2.3",
+				GitSHA:          "5b5e3fa0b4cae8dc2e2b5d8b0b8a4c1b1f0b2c3d",
+				GitTag:          "v1.2.3",
+				Dirhash:         dirhash,
+			}}}); err != nil {
+				t.Fatal(err)
+			}
+			abctestutil.WriteAllDefaultMode(t, filepath.Join(vendorDir, "foo"), tc.modify)
+
+			downloader, err := ParseSource(ctx, &ParseSourceParams{
+				CWD:         t.TempDir(),
+				Source:      tc.source,
+				GitProtocol: "https",
+				VendorDir:   vendorDir,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := downloader.(*vendoredDownloader); ok != tc.wantVendored {
+				t.Fatalf("got downloader %T, want vendored=%t", downloader, tc.wantVendored)
+			}
+			if !tc.wantVendored {
+				return
+			}
+
+			dest := t.TempDir()
+			got, err := downloader.Download(ctx, t.TempDir(), dest)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("DownloadMetadata was not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(abctestutil.LoadDirWithoutMode(t, dest), templateFiles); diff != "" {
+				t.Errorf("downloaded files were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestParseSource_VendoredMemFS(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	mfs := &common.MemFS{}
+	if err := mfs.MkdirAll("/vendor/foo", common.OwnerRWXPerms); err != nil {
+		t.Fatal(err)
+	}
+	if err := mfs.WriteFile("/vendor/foo/spec.yaml", []byte("spec contents"), common.OwnerRWPerms); err != nil {
+		t.Fatal(err)
+	}
+	dirhash, err := common.HashTemplateDirWith(ctx, mfs, "/vendor/foo", hashalg.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveVendorIndex(mfs, "/vendor", &VendorIndex{Templates: []*VendorEntry{{
+		Name:            "foo",
+		Source:          "github.com/myorg/myrepo/foo@v1.2.3",
+		CanonicalSource: "github.com/myorg/myrepo/foo",
+		LocationType:    LocTypeRemoteGit,
+		Version:         "v1.2.3",
+		Dirhash:         dirhash,
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	downloader, err := ParseSource(ctx, &ParseSourceParams{
+		CWD:         "/",
+		FS:          mfs,
+		Source:      "github.com/myorg/myrepo/foo@v1.2.3",
+		GitProtocol: "https",
+		VendorDir:   "/vendor",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mfs.MkdirAll("/dest", common.OwnerRWXPerms); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := downloader.Download(ctx, "/", "/dest"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := mfs.ReadFile("/dest/spec.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "spec contents"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
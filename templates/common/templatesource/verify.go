@@ -0,0 +1,145 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// IncompleteDownloadMarker is the name of the file that DownloadVerified
+// creates in the destination directory while a download is in progress. If
+// it's there before a download starts, an earlier download into the same
+// directory stopped partway, and its files are removed first.
+const IncompleteDownloadMarker = ".abc-download-incomplete"
+
+// DownloadVerifiedParams are the arguments to DownloadVerified.
+type DownloadVerifiedParams struct {
+	// Downloader provides the template.
+	Downloader Downloader
+
+	// Cwd and DestDir are passed to Downloader.Download.
+	Cwd     string
+	DestDir string
+
+	// FS is the filesystem that DestDir is in.
+	FS common.FS
+
+	// Stats is optional, and if non-nil, counts a download that was tried
+	// again as a retry.
+	Stats *DownloadStats
+}
+
+// DownloadVerified downloads the template into p.DestDir, which is normally an
+// empty temporary directory, and checks the download before it's used.
+//
+// A download that fails partway with a transient error, after any retries by
+// the Downloader itself, is cleaned up and started over once. The
+// IncompleteDownloadMarker file marks a download in progress, so that the
+// files of an interrupted one are never mistaken for a whole template.
+//
+// Once the download succeeds, its dirhash is computed. If the Downloader said
+// what the dirhash should be, it's computed with the same hash algorithm, and a
+// mismatch is an error; either way, the returned DownloadMetadata.Dirhash is
+// the verified hash.
+func DownloadVerified(ctx context.Context, p *DownloadVerifiedParams) (*DownloadMetadata, error) {
+	logger := logging.FromContext(ctx).With("logger", "DownloadVerified")
+
+	var dlMeta *DownloadMetadata
+	var err error
+	for attempt := 0; ; attempt++ {
+		dlMeta, err = downloadOnce(ctx, p)
+		if err == nil || attempt > 0 || ctx.Err() != nil || !isTransient(err) {
+			break
+		}
+		logger.WarnContext(ctx, "the download failed partway; removing what was downloaded and starting over",
+			"dir", p.DestDir,
+			"error", err)
+		p.Stats.addRetry()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	alg := hashalg.Default
+	if dlMeta.Dirhash != "" {
+		if alg, err = hashalg.Of(dlMeta.Dirhash); err != nil {
+			return nil, fmt.Errorf("can't verify the downloaded template: %w", err)
+		}
+	}
+	dirhash, err := common.HashTemplateDirWith(ctx, p.FS, p.DestDir, alg)
+	if err != nil {
+		return nil, fmt.Errorf("failed hashing the downloaded template: %w", err)
+	}
+	if dlMeta.Dirhash != "" && dlMeta.Dirhash != dirhash {
+		return nil, fmt.Errorf("the downloaded template's dirhash is %s, but it should be %s; the download may be corrupt or the template may have been tampered with",
+			dirhash, dlMeta.Dirhash)
+	}
+	dlMeta.Dirhash = dirhash
+	return dlMeta, nil
+}
+
+// downloadOnce makes one attempt at the download, first removing the files of
+// an earlier attempt that didn't finish.
+func downloadOnce(ctx context.Context, p *DownloadVerifiedParams) (*DownloadMetadata, error) {
+	marker := filepath.Join(p.DestDir, IncompleteDownloadMarker)
+	_, err := p.FS.Stat(marker)
+	switch {
+	case err == nil:
+		logging.FromContext(ctx).DebugContext(ctx, "removing an incomplete download",
+			"dir", p.DestDir)
+		if err := emptyDirFS(p.FS, p.DestDir); err != nil {
+			return nil, fmt.Errorf("failed removing an incomplete download: %w", err)
+		}
+	case !common.IsStatNotExistErr(err):
+		return nil, fmt.Errorf("Stat(): %w", err)
+	}
+
+	if err := p.FS.MkdirAll(p.DestDir, common.OwnerRWXPerms); err != nil {
+		return nil, fmt.Errorf("MkdirAll(): %w", err)
+	}
+	if err := p.FS.WriteFile(marker, nil, common.OwnerRWPerms); err != nil {
+		return nil, fmt.Errorf("failed writing %s: %w", IncompleteDownloadMarker, err)
+	}
+	dlMeta, err := p.Downloader.Download(ctx, p.Cwd, p.DestDir)
+	if err != nil {
+		// The marker is left behind, so the next attempt cleans up.
+		return nil, err //nolint:wrapcheck
+	}
+	if err := p.FS.RemoveAll(marker); err != nil {
+		return nil, fmt.Errorf("failed removing %s: %w", IncompleteDownloadMarker, err)
+	}
+	return dlMeta, nil
+}
+
+// emptyDirFS removes everything inside dir, but not dir itself.
+func emptyDirFS(rfs common.FS, dir string) error {
+	entries, err := fs.ReadDir(rfs, dir)
+	if err != nil {
+		return fmt.Errorf("ReadDir(): %w", err)
+	}
+	for _, e := range entries {
+		if err := rfs.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return fmt.Errorf("RemoveAll(): %w", err)
+		}
+	}
+	return nil
+}
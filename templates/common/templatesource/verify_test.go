@@ -0,0 +1,248 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/hashalg"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeVerifyDownloader writes files into the destination directory. Each
+// call writes partial and then returns the next of errs, until they run out.
+type fakeVerifyDownloader struct {
+	files   map[string]string
+	partial map[string]string
+	errs    []error
+	dirhash string
+
+	calls int
+	// sawMarker records, for each call, whether the incomplete download
+	// marker was there when the download started.
+	sawMarker []bool
+}
+
+func (f *fakeVerifyDownloader) Download(ctx context.Context, cwd, destDir string) (*DownloadMetadata, error) {
+	f.calls++
+	_, err := (&common.RealFS{}).Stat(filepath.Join(destDir, IncompleteDownloadMarker))
+	f.sawMarker = append(f.sawMarker, err == nil)
+
+	if f.calls <= len(f.errs) {
+		if err := writeFiles(destDir, f.partial); err != nil {
+			return nil, err
+		}
+		return nil, f.errs[f.calls-1]
+	}
+	if err := writeFiles(destDir, f.files); err != nil {
+		return nil, err
+	}
+	return &DownloadMetadata{Dirhash: f.dirhash}, nil
+}
+
+func writeFiles(dir string, files map[string]string) error {
+	rfs := &common.RealFS{}
+	for path, contents := range files {
+		path = filepath.Join(dir, path)
+		if err := rfs.MkdirAll(filepath.Dir(path), common.OwnerRWXPerms); err != nil {
+			return err //nolint:wrapcheck
+		}
+		if err := rfs.WriteFile(path, []byte(contents), common.OwnerRWPerms); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	return nil
+}
+
+func TestDownloadVerified(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"spec.yaml":  "some yaml",
+		"a/file.txt": "hello",
+	}
+	// The dirhash of files, as computed by common.HashTemplateDirWith.
+	dirhashWith := func(t *testing.T, alg *hashalg.Algorithm) string {
+		t.Helper()
+		dir := t.TempDir()
+		abctestutil.WriteAllDefaultMode(t, dir, files)
+		h, err := common.HashTemplateDirWith(context.Background(), &common.RealFS{}, dir, alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	wantDirhash := dirhashWith(t, hashalg.Default)
+	wantDirhash512 := dirhashWith(t, hashalg.SHA512)
+
+	transient := &transientError{errors.New("connection reset")}
+
+	cases := []struct {
+		name string
+		// existing are the files in the destination directory before the
+		// download.
+		existing     map[string]string
+		errs         []error
+		partial      map[string]string
+		dirhash      string
+		wantDirhash  string // defaults to wantDirhash
+		wantCalls    int
+		wantMarkers  []bool
+		wantRetries  int
+		wantContents map[string]string
+		wantErr      string
+	}{
+		{
+			name:         "success",
+			wantCalls:    1,
+			wantMarkers:  []bool{true},
+			wantContents: files,
+		},
+		{
+			name:         "expected_dirhash_matches",
+			dirhash:      wantDirhash,
+			wantCalls:    1,
+			wantMarkers:  []bool{true},
+			wantContents: files,
+		},
+		{
+			name:         "expected_dirhash_with_other_algorithm",
+			dirhash:      wantDirhash512,
+			wantDirhash:  wantDirhash512,
+			wantCalls:    1,
+			wantMarkers:  []bool{true},
+			wantContents: files,
+		},
+		{
+			name:        "expected_dirhash_with_other_algorithm_mismatch",
+			dirhash:     "sha512:bm90IHRoZSByaWdodCBoYXNo",
+			wantCalls:   1,
+			wantMarkers: []bool{true},
+			wantErr:     "the download may be corrupt",
+		},
+		{
+			name:        "expected_dirhash_with_unknown_algorithm",
+			dirhash:     "future:bm90IHRoZSByaWdodCBoYXNo",
+			wantCalls:   1,
+			wantMarkers: []bool{true},
+			wantErr:     `can't verify the downloaded template: the hash "future:bm90IHRoZSByaWdodCBoYXNo" was made with an unknown algorithm "future"`,
+		},
+		{
+			name:        "expected_dirhash_mismatch",
+			dirhash:     "h1:bm90IHRoZSByaWdodCBoYXNo",
+			wantCalls:   1,
+			wantMarkers: []bool{true},
+			wantErr:     "the download may be corrupt",
+		},
+		{
+			name: "earlier_incomplete_download_is_removed",
+			existing: map[string]string{
+				IncompleteDownloadMarker: "",
+				"stale.txt":              "left over",
+			},
+			wantCalls:    1,
+			wantMarkers:  []bool{true},
+			wantContents: files,
+		},
+		{
+			name:         "transient_error_starts_over",
+			errs:         []error{transient},
+			partial:      map[string]string{"half.txt": "half"},
+			wantCalls:    2,
+			wantMarkers:  []bool{true, true},
+			wantRetries:  1,
+			wantContents: files,
+		},
+		{
+			name:        "started_over_only_once",
+			errs:        []error{transient, transient},
+			partial:     map[string]string{"half.txt": "half"},
+			wantCalls:   2,
+			wantMarkers: []bool{true, true},
+			wantRetries: 1,
+			wantErr:     "connection reset",
+		},
+		{
+			name:        "permanent_error_not_retried",
+			errs:        []error{errors.New("repository not found")},
+			wantCalls:   1,
+			wantMarkers: []bool{true},
+			wantErr:     "repository not found",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			destDir := filepath.Join(t.TempDir(), "template")
+			if tc.existing != nil {
+				abctestutil.WriteAllDefaultMode(t, destDir, tc.existing)
+			}
+			dl := &fakeVerifyDownloader{
+				files:   files,
+				partial: tc.partial,
+				errs:    tc.errs,
+				dirhash: tc.dirhash,
+			}
+			stats := &DownloadStats{}
+
+			dlMeta, err := DownloadVerified(ctx, &DownloadVerifiedParams{
+				Downloader: dl,
+				DestDir:    destDir,
+				FS:         &common.RealFS{},
+				Stats:      stats,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if dl.calls != tc.wantCalls {
+				t.Errorf("got %d downloads, want %d", dl.calls, tc.wantCalls)
+			}
+			if diff := cmp.Diff(dl.sawMarker, tc.wantMarkers); diff != "" {
+				t.Errorf("incomplete download markers were not as expected (-got,+want): %s", diff)
+			}
+			if stats.retries != tc.wantRetries {
+				t.Errorf("got %d retries, want %d", stats.retries, tc.wantRetries)
+			}
+			if err != nil {
+				return
+			}
+
+			want := tc.wantDirhash
+			if want == "" {
+				want = wantDirhash
+			}
+			if dlMeta.Dirhash != want {
+				t.Errorf("got dirhash %q, want %q", dlMeta.Dirhash, want)
+			}
+			got := abctestutil.LoadDirWithoutMode(t, destDir)
+			if diff := cmp.Diff(got, tc.wantContents); diff != "" {
+				t.Errorf("downloaded files were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ui contains helpers for presenting output to the user, shared by all
+// the commands.
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+// ColorMode says when to use color in output. It's the value of the --color
+// flag.
+type ColorMode string
+
+const (
+	// ColorAuto uses color only when writing to a terminal, and only if the
+	// NO_COLOR environment variable isn't set. This is the default.
+	ColorAuto ColorMode = "auto"
+
+	// ColorAlways always uses color, even when the output isn't a terminal
+	// or NO_COLOR is set.
+	ColorAlways ColorMode = "always"
+
+	// ColorNever never uses color.
+	ColorNever ColorMode = "never"
+)
+
+// ColorModes are the valid values of ColorMode, as strings for use in flag help
+// and error messages.
+var ColorModes = []string{string(ColorAuto), string(ColorAlways), string(ColorNever)}
+
+// ParseColorMode converts a flag value to a ColorMode. The empty string means
+// ColorAuto.
+func ParseColorMode(s string) (ColorMode, error) {
+	switch ColorMode(s) {
+	case "", ColorAuto:
+		return ColorAuto, nil
+	case ColorAlways, ColorNever:
+		return ColorMode(s), nil
+	default:
+		return "", fmt.Errorf("invalid color mode %q, must be one of %s", s, strings.Join(ColorModes, ", "))
+	}
+}
+
+// Colors decorates text with ANSI colors, or leaves it alone if color is
+// disabled. The zero value, and a nil *Colors, never use color.
+type Colors struct {
+	enabled bool
+}
+
+// NewColors decides whether to use color for output written to w, which is
+// normally the command's configured stdout. lookupEnv is used to check the
+// NO_COLOR environment variable (see https://no-color.org); it's normally
+// cli.BaseCommand.LookupEnv.
+func NewColors(mode ColorMode, w io.Writer, lookupEnv func(string) (string, bool)) *Colors {
+	switch mode {
+	case ColorAlways:
+		return &Colors{enabled: true}
+	case ColorNever:
+		return &Colors{}
+	}
+	if v, ok := lookupEnv("NO_COLOR"); ok && v != "" {
+		return &Colors{}
+	}
+	return &Colors{enabled: isTerminal(w)}
+}
+
+// isTerminal returns true if w is a terminal. Writers other than *os.File, like
+// the buffers used in tests, are never terminals.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// Enabled returns true if color is used.
+func (c *Colors) Enabled() bool {
+	return c != nil && c.enabled
+}
+
+// Red returns the text of a, formatted like fmt.Sprint, in red.
+func (c *Colors) Red(a ...any) string {
+	return c.sprint(color.FgRed, a)
+}
+
+// Green returns the text of a, formatted like fmt.Sprint, in green.
+func (c *Colors) Green(a ...any) string {
+	return c.sprint(color.FgGreen, a)
+}
+
+// Bold returns the text of a, formatted like fmt.Sprint, in bold.
+func (c *Colors) Bold(a ...any) string {
+	return c.sprint(color.Bold, a)
+}
+
+func (c *Colors) sprint(attr color.Attribute, a []any) string {
+	if !c.Enabled() {
+		return fmt.Sprint(a...)
+	}
+	// The color package makes its own decision about whether to use color
+	// based on the process's real stdout, so it's overridden here.
+	col := color.New(attr)
+	col.EnableColor()
+	return col.Sprint(a...)
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestNewColors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		mode ColorMode
+		env  map[string]string
+		want bool
+	}{
+		{
+			name: "auto_not_a_terminal",
+			mode: ColorAuto,
+			want: false,
+		},
+		{
+			name: "always",
+			mode: ColorAlways,
+			want: true,
+		},
+		{
+			name: "always_overrides_no_color",
+			mode: ColorAlways,
+			env:  map[string]string{"NO_COLOR": "1"},
+			want: true,
+		},
+		{
+			name: "never",
+			mode: ColorNever,
+			want: false,
+		},
+		{
+			name: "auto_with_no_color",
+			mode: ColorAuto,
+			env:  map[string]string{"NO_COLOR": "1"},
+			want: false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := NewColors(tc.mode, &bytes.Buffer{}, cli.MapLookuper(tc.env))
+			if got := c.Enabled(); got != tc.want {
+				t.Errorf("Enabled() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestColors_Sprint(t *testing.T) {
+	t.Parallel()
+
+	var nilColors *Colors
+	if got, want := nilColors.Red("a", 1), "a1"; got != want {
+		t.Errorf("nil Colors Red() = %q, want %q", got, want)
+	}
+	off := &Colors{}
+	if got, want := off.Green("text"), "text"; got != want {
+		t.Errorf("disabled Green() = %q, want %q", got, want)
+	}
+	on := &Colors{enabled: true}
+	if got, want := on.Red("text"), "\x1b[31mtext\x1b[0m"; got != want {
+		t.Errorf("enabled Red() = %q, want %q", got, want)
+	}
+	if got, want := on.Bold("text"), "\x1b[1mtext\x1b[22m"; got != want {
+		t.Errorf("enabled Bold() = %q, want %q", got, want)
+	}
+}
+
+func TestParseColorMode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in      string
+		want    ColorMode
+		wantErr string
+	}{
+		{in: "", want: ColorAuto},
+		{in: "auto", want: ColorAuto},
+		{in: "always", want: ColorAlways},
+		{in: "never", want: ColorNever},
+		{in: "sometimes", wantErr: `invalid color mode "sometimes", must be one of auto, always, never`},
+	}
+
+	for _, tc := range cases {
+		got, err := ParseColorMode(tc.in)
+		if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+			t.Errorf("ParseColorMode(%q): %s", tc.in, diff)
+		}
+		if got != tc.want {
+			t.Errorf("ParseColorMode(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
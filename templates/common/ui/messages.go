@@ -0,0 +1,145 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MessageID identifies a user-facing message, like a prompt or a phrase in a
+// test report.
+type MessageID string
+
+// These are the IDs of the messages in the catalog. The comment on each one
+// shows the arguments that its format string receives, in order; a
+// replacement format string must use the same verbs in the same order.
+const (
+	// Labels in input prompts and input validation failures.
+	MsgInputName                MessageID = "input.name"                   // no arguments
+	MsgInputValue               MessageID = "input.value"                  // no arguments
+	MsgInputDescription         MessageID = "input.description"            // no arguments
+	MsgInputType                MessageID = "input.type"                   // no arguments
+	MsgInputTypeBool            MessageID = "input.type_bool"              // no arguments
+	MsgInputTypeList            MessageID = "input.type_list"              // no arguments
+	MsgInputInvalidValue        MessageID = "input.invalid_value"          // error message
+	MsgInputDefault             MessageID = "input.default"                // no arguments
+	MsgInputInferredFrom        MessageID = "input.inferred_from"          // inferred value, file name
+	MsgInputEnterValue          MessageID = "input.enter_value"            // no arguments
+	MsgInputEnterValueOrDefault MessageID = "input.enter_value_or_default" // no arguments
+	MsgRule                     MessageID = "rule.rule"                    // no arguments
+	MsgRuleIndexed              MessageID = "rule.rule_indexed"            // rule index
+	MsgRuleMessage              MessageID = "rule.message"                 // no arguments
+	MsgRuleMessageIndexed       MessageID = "rule.message_indexed"         // rule index
+
+	// Phrases in the report of "golden-test verify".
+	MsgVerifyReportHeader    MessageID = "verify.report_header"    // no arguments
+	MsgVerifyNotRecorded     MessageID = "verify.not_recorded"     // file path
+	MsgVerifyMissing         MessageID = "verify.missing"          // file path
+	MsgVerifyContentMismatch MessageID = "verify.content_mismatch" // file path
+	MsgVerifySymlinkMismatch MessageID = "verify.symlink_mismatch" // file path, description of the mismatch
+	MsgVerifyStdoutMismatch  MessageID = "verify.stdout_mismatch"  // no arguments
+	MsgVerifyStepFailed      MessageID = "verify.step_failed"      // step description, error message
+	MsgVerifyRecordHint      MessageID = "verify.record_hint"      // test name
+	MsgVerifyTestFails       MessageID = "verify.test_fails"       // test name
+	MsgVerifyTestSucceeds    MessageID = "verify.test_succeeds"    // test name
+)
+
+// defaultMessages are the built-in format strings for each MessageID.
+var defaultMessages = map[MessageID]string{
+	MsgInputName:                "Input name:",
+	MsgInputValue:               "Input value:",
+	MsgInputDescription:         "Description:",
+	MsgInputType:                "Type:",
+	MsgInputTypeBool:            "bool (y/n)",
+	MsgInputTypeList:            "list (comma-separated)",
+	MsgInputInvalidValue:        "Invalid value: %s. Please try again.",
+	MsgInputDefault:             "Default:",
+	MsgInputInferredFrom:        "%s (inferred from %s)",
+	MsgInputEnterValue:          "Enter value: ",
+	MsgInputEnterValueOrDefault: "Enter value, or leave empty to accept default: ",
+	MsgRule:                     "Rule:",
+	MsgRuleIndexed:              "Rule %d:",
+	MsgRuleMessage:              "Rule msg:",
+	MsgRuleMessageIndexed:       "Rule %d msg:",
+
+	MsgVerifyReportHeader:    "Test Report:",
+	MsgVerifyNotRecorded:     "-- [%s] generated, however not recorded in test data",
+	MsgVerifyMissing:         "-- [%s] expected, however missing",
+	MsgVerifyContentMismatch: "-- [%s] file content mismatch",
+	MsgVerifySymlinkMismatch: "-- [%s] %s",
+	MsgVerifyStdoutMismatch:  "the printed messages differ between the recorded golden output and the actual output",
+	MsgVerifyStepFailed:      "-- verify step [%s] failed: %s",
+	MsgVerifyRecordHint:      "golden test [%s] didn't match actual output, you might need to run 'record' command to capture it as the new expected output",
+	MsgVerifyTestFails:       "[x] golden test %s fails",
+	MsgVerifyTestSucceeds:    "[✓] golden test %s succeeds",
+}
+
+// Catalog provides the text of user-facing messages. A downstream fork can
+// brand or translate the CLI by installing its own Catalog with SetCatalog,
+// without patching the commands that print the messages.
+type Catalog interface {
+	// Message returns the format string for id, or false to use the
+	// built-in one.
+	Message(id MessageID) (string, bool)
+}
+
+// MapCatalog is a Catalog backed by a map. Messages that aren't in the map use
+// the built-in text.
+type MapCatalog map[MessageID]string
+
+// Message implements Catalog.
+func (m MapCatalog) Message(id MessageID) (string, bool) {
+	s, ok := m[id]
+	return s, ok
+}
+
+var (
+	catalogMu sync.RWMutex
+	catalog   Catalog
+)
+
+// SetCatalog replaces the message catalog used by Msg. A nil catalog restores
+// the built-in messages. This is meant to be called once at startup, before
+// any command runs.
+func SetCatalog(c Catalog) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	catalog = c
+}
+
+// Msg returns the text of the message id, formatted with args like
+// fmt.Sprintf.
+func Msg(id MessageID, args ...any) string {
+	catalogMu.RLock()
+	c := catalog
+	catalogMu.RUnlock()
+
+	format, ok := "", false
+	if c != nil {
+		format, ok = c.Message(id)
+	}
+	if !ok {
+		if format, ok = defaultMessages[id]; !ok {
+			// This is a bug, but it's better to show something than to
+			// fail.
+			format = string(id)
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
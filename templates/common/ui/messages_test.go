@@ -0,0 +1,88 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import "testing"
+
+// These tests aren't parallel because SetCatalog changes global state.
+
+func TestMsg(t *testing.T) {
+	cases := []struct {
+		name    string
+		catalog Catalog
+		id      MessageID
+		args    []any
+		want    string
+	}{
+		{
+			name: "default_without_args",
+			id:   MsgInputName,
+			want: "Input name:",
+		},
+		{
+			name: "default_with_args",
+			id:   MsgVerifyTestFails,
+			args: []any{"my_test"},
+			want: "[x] golden test my_test fails",
+		},
+		{
+			name:    "override",
+			catalog: MapCatalog{MsgVerifyTestFails: "[x] prueba %s falló"},
+			id:      MsgVerifyTestFails,
+			args:    []any{"my_test"},
+			want:    "[x] prueba my_test falló",
+		},
+		{
+			name:    "missing_override_falls_back_to_default",
+			catalog: MapCatalog{MsgVerifyTestFails: "[x] prueba %s falló"},
+			id:      MsgVerifyTestSucceeds,
+			args:    []any{"my_test"},
+			want:    "[✓] golden test my_test succeeds",
+		},
+		{
+			name: "unknown_id",
+			id:   "no.such.message",
+			want: "no.such.message",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			SetCatalog(tc.catalog)
+			t.Cleanup(func() { SetCatalog(nil) })
+
+			if got := Msg(tc.id, tc.args...); got != tc.want {
+				t.Errorf("Msg(%q) = %q, want %q", tc.id, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDefaultMessages_Complete(t *testing.T) {
+	ids := []MessageID{
+		MsgInputName, MsgInputValue, MsgInputDescription, MsgInputDefault,
+		MsgInputType, MsgInputTypeBool, MsgInputTypeList, MsgInputInvalidValue,
+		MsgInputInferredFrom, MsgInputEnterValue, MsgInputEnterValueOrDefault,
+		MsgRule, MsgRuleIndexed, MsgRuleMessage, MsgRuleMessageIndexed,
+		MsgVerifyReportHeader, MsgVerifyNotRecorded, MsgVerifyMissing,
+		MsgVerifyContentMismatch, MsgVerifySymlinkMismatch, MsgVerifyStdoutMismatch,
+		MsgVerifyRecordHint, MsgVerifyTestFails, MsgVerifyTestSucceeds,
+	}
+	for _, id := range ids {
+		if _, ok := defaultMessages[id]; !ok {
+			t.Errorf("message %q has no default text", id)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+)
+
+// VarType is the type of a template input. Values of every type are passed
+// around as strings, in the canonical form returned by CoerceValue, so they
+// can be given as flags, saved in manifests, and used in Go templates. They're
+// only converted to their real type in CEL expressions.
+type VarType string
+
+const (
+	// VarTypeString is the default type, used when a type isn't given.
+	VarTypeString VarType = "string"
+
+	// VarTypeBool is true or false.
+	VarTypeBool VarType = "bool"
+
+	// VarTypeInt is a 64-bit signed integer.
+	VarTypeInt VarType = "int"
+
+	// VarTypeList is a list of strings. Its canonical form is a JSON array,
+	// like `["a","b"]`.
+	VarTypeList VarType = "list"
+)
+
+// boolWords are the accepted spellings of bool values, in lower case.
+var boolWords = map[string]bool{
+	"true":  true,
+	"yes":   true,
+	"y":     true,
+	"on":    true,
+	"1":     true,
+	"false": false,
+	"no":    false,
+	"n":     false,
+	"off":   false,
+	"0":     false,
+}
+
+// CoerceValue converts a value from a flag, an input file, a prompt, or a
+// default into the canonical form of the given type:
+//
+//   - bool: "true" or "false". The values yes/no, y/n, on/off, and 1/0 are also
+//     accepted, in any case.
+//   - int: a base-10 integer, like "42".
+//   - list: a JSON array of strings. A JSON or YAML array like `[a, b]` is
+//     accepted, as is a comma-separated list like "a, b".
+//   - string, or the empty VarType: the value, unchanged.
+func CoerceValue(t VarType, val string) (string, error) {
+	switch t {
+	case "", VarTypeString:
+		return val, nil
+	case VarTypeBool:
+		b, ok := boolWords[strings.ToLower(strings.TrimSpace(val))]
+		if !ok {
+			return "", fmt.Errorf("%q isn't a bool, it must be true or false (or yes or no)", val)
+		}
+		return strconv.FormatBool(b), nil
+	case VarTypeInt:
+		i, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q isn't an int", val)
+		}
+		return strconv.FormatInt(i, 10), nil
+	case VarTypeList:
+		l, err := parseList(val)
+		if err != nil {
+			return "", err
+		}
+		buf, err := json.Marshal(l)
+		if err != nil {
+			return "", fmt.Errorf("internal error: json.Marshal(): %w", err)
+		}
+		return string(buf), nil
+	default:
+		return "", fmt.Errorf("internal error: unknown type %q", t)
+	}
+}
+
+// parseList parses a list value in any of the forms accepted by CoerceValue.
+// The returned slice is never nil.
+func parseList(val string) ([]string, error) {
+	trimmed := strings.TrimSpace(val)
+	out := []string{}
+	if trimmed == "" {
+		return out, nil
+	}
+	if strings.HasPrefix(trimmed, "[") {
+		if err := yaml.Unmarshal([]byte(trimmed), &out); err != nil {
+			return nil, fmt.Errorf("%q isn't a list of strings: %w", val, err)
+		}
+		if out == nil {
+			out = []string{}
+		}
+		return out, nil
+	}
+	for _, elem := range strings.Split(trimmed, ",") {
+		out = append(out, strings.TrimSpace(elem))
+	}
+	return out, nil
+}
+
+// celType returns the CEL type of a variable of the given type.
+func celType(t VarType) *cel.Type {
+	switch t {
+	case VarTypeBool:
+		return cel.BoolType
+	case VarTypeInt:
+		return cel.IntType
+	case VarTypeList:
+		return cel.ListType(cel.StringType)
+	default:
+		return cel.StringType
+	}
+}
+
+// celValue converts a value in the canonical form of the given type to the Go
+// type that CEL expects for celType(t).
+func celValue(t VarType, val string) (any, error) {
+	switch t {
+	case VarTypeBool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a bool", val)
+		}
+		return b, nil
+	case VarTypeInt:
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't an int", val)
+		}
+		return i, nil
+	case VarTypeList:
+		return parseList(val)
+	default:
+		return val, nil
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestCoerceValue(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		typ     VarType
+		val     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "untyped",
+			val:  " Yes ",
+			want: " Yes ",
+		},
+		{
+			name: "string",
+			typ:  VarTypeString,
+			val:  "1,2",
+			want: "1,2",
+		},
+		{
+			name: "bool_true",
+			typ:  VarTypeBool,
+			val:  "true",
+			want: "true",
+		},
+		{
+			name: "bool_yes",
+			typ:  VarTypeBool,
+			val:  " Y ",
+			want: "true",
+		},
+		{
+			name: "bool_off",
+			typ:  VarTypeBool,
+			val:  "OFF",
+			want: "false",
+		},
+		{
+			name:    "bool_invalid",
+			typ:     VarTypeBool,
+			val:     "maybe",
+			wantErr: `"maybe" isn't a bool, it must be true or false (or yes or no)`,
+		},
+		{
+			name: "int",
+			typ:  VarTypeInt,
+			val:  " -0042 ",
+			want: "-42",
+		},
+		{
+			name:    "int_invalid",
+			typ:     VarTypeInt,
+			val:     "4.2",
+			wantErr: `"4.2" isn't an int`,
+		},
+		{
+			name: "list_comma_separated",
+			typ:  VarTypeList,
+			val:  "us-east1, us-west1",
+			want: `["us-east1","us-west1"]`,
+		},
+		{
+			name: "list_json",
+			typ:  VarTypeList,
+			val:  `["a,b", "c"]`,
+			want: `["a,b","c"]`,
+		},
+		{
+			name: "list_yaml_flow",
+			typ:  VarTypeList,
+			val:  `[a, b]`,
+			want: `["a","b"]`,
+		},
+		{
+			name: "list_empty",
+			typ:  VarTypeList,
+			val:  "",
+			want: `[]`,
+		},
+		{
+			name:    "list_of_lists",
+			typ:     VarTypeList,
+			val:     `[[a]]`,
+			wantErr: `"[[a]]" isn't a list of strings`,
+		},
+		{
+			name:    "unknown_type",
+			typ:     "float",
+			val:     "1.5",
+			wantErr: `unknown type "float"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := CoerceValue(tc.typ, tc.val)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got != tc.want {
+				t.Errorf("CoerceValue(%q, %q) = %q, want %q", tc.typ, tc.val, got, tc.want)
+			}
+
+			if err != nil {
+				return
+			}
+			// The canonical form is stable.
+			again, err := CoerceValue(tc.typ, got)
+			if err != nil || again != got {
+				t.Errorf("CoerceValue(%q, %q) = %q, %v, want it unchanged", tc.typ, got, again, err)
+			}
+		})
+	}
+}
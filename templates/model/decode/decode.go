@@ -134,24 +134,11 @@ func Decode(r io.Reader, filename, requireKind string, isReleaseBuild bool) (mod
 		return nil, "", fmt.Errorf("error reading file %s: %w", filename, err)
 	}
 
-	cf := &header.Fields{}
-	if err := yaml.Unmarshal(buf, cf); err != nil {
-		return nil, "", fmt.Errorf("error parsing file %s: %w", filename, err)
-	}
-
-	var apiVersion string
-	if cf.NewStyleAPIVersion.Val != "" && cf.OldStyleAPIVersion.Val != "" {
-		return nil, "", cf.OldStyleAPIVersion.Pos.Errorf("must not set both apiVersion and api_version, please use api_version only")
-	}
-	if cf.NewStyleAPIVersion.Val == "" && cf.OldStyleAPIVersion.Val == "" {
-		return nil, "", fmt.Errorf(`file %s must set the field "api_version"`, filename)
-	}
-	if cf.NewStyleAPIVersion.Val != "" {
-		apiVersion = cf.NewStyleAPIVersion.Val
-	}
-	if cf.OldStyleAPIVersion.Val != "" {
-		apiVersion = cf.OldStyleAPIVersion.Val
+	cf, apiVersionField, err := decodeHeader(buf, filename)
+	if err != nil {
+		return nil, "", err
 	}
+	apiVersion := apiVersionField.Val
 
 	if cf.Kind.Val == "" {
 		return nil, "", fmt.Errorf(`file %s must set the field "kind"`, filename)
@@ -188,6 +175,42 @@ func Decode(r io.Reader, filename, requireKind string, isReleaseBuild bool) (mod
 	return nil, "", err
 }
 
+// APIVersion returns the api_version of the given YAML file contents, as
+// written in the file, with its position, without decoding or validating the
+// rest of it. The given filename is used only for error messages.
+func APIVersion(r io.Reader, filename string) (model.String, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return model.String{}, fmt.Errorf("error reading file %s: %w", filename, err)
+	}
+	_, apiVersion, err := decodeHeader(buf, filename)
+	return apiVersion, err
+}
+
+// decodeHeader parses the header fields of the given YAML file contents, and
+// returns them along with the api_version, whichever of its names was used.
+func decodeHeader(buf []byte, filename string) (*header.Fields, model.String, error) {
+	cf := &header.Fields{}
+	if err := yaml.Unmarshal(buf, cf); err != nil {
+		return nil, model.String{}, fmt.Errorf("error parsing file %s: %w", filename, err)
+	}
+
+	var apiVersion model.String
+	if cf.NewStyleAPIVersion.Val != "" && cf.OldStyleAPIVersion.Val != "" {
+		return nil, model.String{}, cf.OldStyleAPIVersion.Pos.Errorf("must not set both apiVersion and api_version, please use api_version only")
+	}
+	if cf.NewStyleAPIVersion.Val == "" && cf.OldStyleAPIVersion.Val == "" {
+		return nil, model.String{}, fmt.Errorf(`file %s must set the field "api_version"`, filename)
+	}
+	if cf.NewStyleAPIVersion.Val != "" {
+		apiVersion = cf.NewStyleAPIVersion
+	}
+	if cf.OldStyleAPIVersion.Val != "" {
+		apiVersion = cf.OldStyleAPIVersion
+	}
+	return cf, apiVersion, nil
+}
+
 // DecodeValidateUpgrade parses the given YAML contents of r into a struct,
 // then repeatedly calls Upgrade() and Validate() on it until it's the newest version, then
 // returns it. requireKind has the same meaning as in Decode().
@@ -240,7 +263,14 @@ func decodeFromVersionKind(filename, apiVersion, kind string, buf []byte) (model
 		return nil, fmt.Errorf("internal error: type-assertion to ValidatorUpgrader failed")
 	}
 
-	if err := yaml.Unmarshal(buf, vu); err != nil {
+	var root yaml.Node
+	if err := yaml.Unmarshal(buf, &root); err != nil {
+		return nil, fmt.Errorf("error parsing YAML file %s: %w", filename, err)
+	}
+	if err := rejectEmptyListEntries(&root); err != nil {
+		return nil, fmt.Errorf("error parsing YAML file %s: %w", filename, err)
+	}
+	if err := root.Decode(vu); err != nil {
 		return nil, fmt.Errorf("error parsing YAML file %s: %w", filename, err)
 	}
 
@@ -251,6 +281,30 @@ func decodeFromVersionKind(filename, apiVersion, kind string, buf []byte) (model
 	return vu, nil
 }
 
+// rejectEmptyListEntries returns an error for the first list entry that's
+// empty, like a "-" on a line by itself. None of the lists in our YAML files
+// can have empty entries, and they would otherwise be decoded as nil pointers.
+func rejectEmptyListEntries(n *yaml.Node) error {
+	if n.Kind == yaml.SequenceNode {
+		for _, elem := range n.Content {
+			if elem.Kind == yaml.ScalarNode && elem.Tag == "!!null" {
+				return model.YAMLPos(elem).Errorf("a list entry is empty; remove the \"-\" or give the entry a value")
+			}
+		}
+	}
+	if n.Kind == yaml.AliasNode {
+		// The anchored node is checked where it's defined. Following aliases
+		// could loop forever.
+		return nil
+	}
+	for _, child := range n.Content {
+		if err := rejectEmptyListEntries(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // LatestSupportedAPIVersion is the most up-to-date API version. It's
 // in the format "cli.abcxyz.dev/v1beta4".
 //
@@ -274,3 +328,26 @@ func LatestSupportedAPIVersion(isReleaseBuild bool) string {
 	// it will never fail on a user's machine.
 	panic("internal error: there are no apiVersions that are marked as released")
 }
+
+// OutdatedAPIVersion returns whether a spec file with the given api_version
+// behaves differently than one with the api_version latest, because it's
+// older. api_versions are compared by their position in the list of
+// supported api_versions, and one that's only an alias of latest, like
+// v1beta4 is of v1beta5, isn't outdated. Unknown api_versions aren't outdated
+// either, since they fail to decode anyway.
+func OutdatedAPIVersion(apiVersion, latest string) bool {
+	idx := apiVersionIndex(apiVersion)
+	latestIdx := apiVersionIndex(latest)
+	if idx < 0 || latestIdx < 0 || idx >= latestIdx {
+		return false
+	}
+	return reflect.TypeOf(apiVersions[idx].kinds[KindTemplate]) != reflect.TypeOf(apiVersions[latestIdx].kinds[KindTemplate])
+}
+
+// apiVersionIndex returns the position of apiVersion in apiVersions, or -1 if
+// it isn't there.
+func apiVersionIndex(apiVersion string) int {
+	return slices.IndexFunc(apiVersions, func(v apiVersionDef) bool {
+		return v.apiVersion == apiVersion
+	})
+}
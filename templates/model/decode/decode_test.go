@@ -233,6 +233,19 @@ steps:
 			fileContents: `*&^*&^*&^`,
 			wantErr:      "error parsing file file.yaml: yaml: ",
 		},
+		{
+			name: "empty_list_entry",
+			fileContents: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'mydesc'
+steps:
+  - action: 'include'
+    desc: 'include all files'
+    params:
+      paths: ['.']
+  -`,
+			wantErr: `error parsing YAML file file.yaml: at line 9 column 4: a list entry is empty`,
+		},
 		{
 			name:         "missing_api_version",
 			fileContents: `kind: 'Template'`,
@@ -392,8 +405,12 @@ steps:
 			want: &specv1beta4.Spec{
 				Desc: model.String{Val: "mydesc"},
 				Features: features.Features{
-					SkipGlobs:   true,
-					SkipGitVars: true,
+					SkipGlobs:               true,
+					SkipGitVars:             true,
+					SkipRenderedPaths:       true,
+					SkipGitCommitVars:       true,
+					SkipDoubleStarGlobs:     true,
+					SkipUnmatchedPathErrors: true,
 				},
 				Steps: []*specv1beta4.Step{
 					{
@@ -472,8 +489,12 @@ steps:
 			want: &specv1beta4.Spec{
 				Desc: model.String{Val: "mydesc"},
 				Features: features.Features{
-					SkipGlobs:   true,
-					SkipGitVars: true,
+					SkipGlobs:               true,
+					SkipGitVars:             true,
+					SkipRenderedPaths:       true,
+					SkipGitCommitVars:       true,
+					SkipDoubleStarGlobs:     true,
+					SkipUnmatchedPathErrors: true,
 				},
 				Inputs: []*specv1beta4.Input{
 					{
@@ -611,3 +632,72 @@ func TestLatestSupportedAPIVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestOutdatedAPIVersion(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		apiVersion string
+		latest     string
+		want       bool
+	}{
+		{apiVersion: "cli.abcxyz.dev/v1beta3", latest: "cli.abcxyz.dev/v1beta5", want: true},
+		{apiVersion: "cli.abcxyz.dev/v1alpha1", latest: "cli.abcxyz.dev/v1beta3", want: true},
+		{apiVersion: "cli.abcxyz.dev/v1beta4", latest: "cli.abcxyz.dev/v1beta5", want: false}, // an alias
+		{apiVersion: "cli.abcxyz.dev/v1beta5", latest: "cli.abcxyz.dev/v1beta5", want: false},
+		{apiVersion: "cli.abcxyz.dev/v1beta5", latest: "cli.abcxyz.dev/v1beta3", want: false},
+		{apiVersion: "cli.abcxyz.dev/v1beta10", latest: "cli.abcxyz.dev/v1beta5", want: false}, // unknown
+	}
+
+	for _, tc := range cases {
+		if got := OutdatedAPIVersion(tc.apiVersion, tc.latest); got != tc.want {
+			t.Errorf("OutdatedAPIVersion(%q, %q)=%t, want %t", tc.apiVersion, tc.latest, got, tc.want)
+		}
+	}
+}
+
+func TestAPIVersion(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		fileContents string
+		want         string
+		wantErr      string
+	}{
+		{
+			name: "new_style",
+			fileContents: `api_version: 'cli.abcxyz.dev/v1beta3'
+kind: 'Template'
+desc: 'not validated'`,
+			want: "cli.abcxyz.dev/v1beta3",
+		},
+		{
+			name: "old_style",
+			fileContents: `apiVersion: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'`,
+			want: "cli.abcxyz.dev/v1alpha1",
+		},
+		{
+			name:         "missing",
+			fileContents: `kind: 'Template'`,
+			wantErr:      `file spec.yaml must set the field "api_version"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := APIVersion(strings.NewReader(tc.fileContents), "spec.yaml")
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got.Val != tc.want {
+				t.Errorf("APIVersion()=%q, want %q", got.Val, tc.want)
+			}
+		})
+	}
+}
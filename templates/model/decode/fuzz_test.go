@@ -0,0 +1,156 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decode
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// The seeds below, plus the inputs saved in testdata/fuzz by earlier fuzzing
+// runs, are run as regular tests by "go test". To fuzz for new crashes:
+//
+//	$ go test ./templates/model/decode -run '^$' -fuzz FuzzDecode -fuzztime 1m
+var fuzzSeeds = []string{
+	`api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+desc: 'mydesc'
+steps:
+  - action: 'include'
+    desc: 'include all files'
+    params:
+      paths: ['.']`,
+	`api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+desc: 'A template using most features'
+features:
+  skip_globs: false
+inputs:
+  - name: 'name'
+    desc: 'A name'
+    default: 'alice'
+    rules:
+      - rule: 'size(name) > 1'
+        message: 'too short'
+  - name: 'count'
+    desc: 'A count'
+    type: 'int'
+    default: '1'
+rules:
+  - rule: 'count < 10'
+steps:
+  - desc: 'Include files'
+    action: 'include'
+    if: 'count > 0'
+    params:
+      paths:
+        - paths: ['a.txt', 'dir/**', '!dir/skip.txt']
+          as: []
+          skip: ['x']
+  - desc: 'Append'
+    action: 'append'
+    params:
+      paths: ['a.txt']
+      with: 'more'
+      skip_ensure_newline: true
+  - desc: 'Replace strings'
+    action: 'string_replace'
+    params:
+      paths: ['a.txt']
+      replacements:
+        - to_replace: 'a'
+          with: '{{.name}}'
+  - desc: 'Replace regexes'
+    action: 'regex_replace'
+    params:
+      paths: ['a.txt']
+      replacements:
+        - regex: '(?P<x>a+)'
+          with: '${x}b'
+          subgroup_to_replace: 'x'
+  - desc: 'Render templates'
+    action: 'go_template'
+    params:
+      paths: ['a.txt']
+  - desc: 'Loop'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'env'
+        values: ['dev', 'prod']
+      steps:
+        - desc: 'Print'
+          action: 'print'
+          params:
+            message: 'Hello, {{.env}}'`,
+	`api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'GoldenTest'
+inputs:
+  - name: 'foo'
+    value: 'bar'`,
+	`api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'GoldenTest'
+inputs:
+  - name: 'foo'
+    value: 'bar'
+builtin_vars:
+  - name: '_git_tag'
+    value: 'v1.2.3'
+stdout:
+  sort_lines: true
+  replacements:
+    - regex: '[0-9]+'
+      with: 'N'`,
+	`api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Manifest'
+creation_time: '2023-12-08T23:59:02.000000013Z'
+modification_time: '2023-12-08T23:59:02.000000013Z'
+template_location: 'github.com/foo/bar'
+location_type: 'remote_git'
+template_version: 'v1.2.3'
+template_dirhash: 'h1:abc'
+inputs:
+  - name: 'foo'
+    value: 'bar'
+output_hashes:
+  - file: 'a.txt'
+    hash: 'h1:def'
+  - file: 'link'
+    symlink_target: 'a.txt'`,
+	"",
+	"api_version: 'cli.abcxyz.dev/v1beta4'\nkind: 'Template'\nsteps: [[[",
+	"api_version: ['a']\nkind: {'b': 'c'}",
+	"apiVersion: 'cli.abcxyz.dev/v1alpha1'\nkind: 'Template'\nsteps:\n  - action: 'for_each'\n    params:\n      steps: ~",
+	"--- &a\n- *a\n",
+}
+
+// FuzzDecode checks that no input can crash the decoders of spec.yaml,
+// test.yaml, and manifest files. Errors are expected; panics aren't.
+func FuzzDecode(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, kind := range []string{"", KindTemplate, KindGoldenTest, KindManifest} {
+			_, _, _ = Decode(bytes.NewReader(data), "fuzz.yaml", kind, false)
+		}
+
+		// Upgrading to the latest api_version is the other half of loading a
+		// file, and may hit fields that Decode didn't.
+		_, _ = DecodeValidateUpgrade(context.Background(), bytes.NewReader(data), "fuzz.yaml", "")
+	})
+}
@@ -16,6 +16,10 @@ package goldentest
 
 import (
 	"errors"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
@@ -46,6 +50,202 @@ func (i *VarValue) Validate() error {
 	)
 }
 
+// Stdout controls how the messages printed by a template are normalized before
+// being recorded, and before being compared with the recorded messages. This is
+// useful when the printed messages aren't deterministic, like when a for_each
+// prints lines in an unpredictable order.
+//
+// The normalizations are applied in the order: replacements, then
+// trim_trailing_whitespace, then sort_lines.
+type Stdout struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// SortLines sorts the printed lines.
+	SortLines model.Bool `yaml:"sort_lines,omitempty"`
+
+	// TrimTrailingWhitespace removes whitespace from the end of each line.
+	TrimTrailingWhitespace model.Bool `yaml:"trim_trailing_whitespace,omitempty"`
+
+	// Replacements replace each match of a regex, like a timestamp, with a
+	// fixed string.
+	Replacements []*StdoutReplacement `yaml:"replacements,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *Stdout) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, s, &s.Pos) //nolint:wrapcheck
+}
+
+// Validate implements model.Validator.
+func (s *Stdout) Validate() error {
+	return model.ValidateEach(s.Replacements)
+}
+
+// StdoutReplacement is one of the entries in the "replacements" list of Stdout.
+type StdoutReplacement struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Regex is an RE2 regular expression.
+	Regex model.String `yaml:"regex"`
+
+	// With is the string that replaces each match of Regex. It may use
+	// $1-style references to subgroups, like regexp.ReplaceAllString.
+	With model.String `yaml:"with"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *StdoutReplacement) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, r, &r.Pos) //nolint:wrapcheck
+}
+
+// Validate implements model.Validator.
+func (r *StdoutReplacement) Validate() error {
+	var regexErr error
+	if r.Regex.Val != "" {
+		if _, err := regexp.Compile(r.Regex.Val); err != nil {
+			regexErr = r.Regex.Pos.Errorf("invalid regex %q: %w", r.Regex.Val, err)
+		}
+	}
+	return errors.Join(
+		model.NotZeroModel(&r.Pos, r.Regex, "regex"),
+		regexErr,
+	)
+}
+
+// DestFile is a file that exists in the destination directory before the
+// template is rendered. It's used to test templates that modify existing
+// files.
+type DestFile struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Path is the location of the file relative to the destination directory,
+	// using forward slashes.
+	Path model.String `yaml:"path"`
+
+	// Contents are the contents of the file. May be empty.
+	Contents model.String `yaml:"contents"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *DestFile) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, d, &d.Pos) //nolint:wrapcheck
+}
+
+// Validate implements model.Validator.
+func (d *DestFile) Validate() error {
+	var pathErr error
+	if d.Path.Val != "" {
+		clean := path.Clean(d.Path.Val)
+		switch {
+		case path.IsAbs(d.Path.Val) || clean == ".." || strings.HasPrefix(clean, "../"):
+			pathErr = d.Path.Pos.Errorf("path %q must be relative to the destination directory, and must not contain \"..\"", d.Path.Val)
+		case clean == ".abc" || strings.HasPrefix(clean, ".abc/"):
+			pathErr = d.Path.Pos.Errorf("path %q is in the .abc directory, which is reserved", d.Path.Val)
+		}
+	}
+	return errors.Join(
+		model.NotZeroModel(&d.Pos, d.Path, "path"),
+		pathErr,
+	)
+}
+
+// Phase is an earlier render into the same destination directory, before the
+// test's own render. A sequence of phases can set up the destination the way
+// an earlier version of a template, or earlier inputs, would have left it, to
+// test upgrades or re-rendering.
+type Phase struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Template is the template to render in this phase, in any form accepted
+	// by "abc templates render", like a different version of the template
+	// being tested. Relative paths are relative to the template being tested.
+	// If empty, the template being tested is rendered.
+	Template model.String `yaml:"template,omitempty"`
+
+	// Inputs are the inputs for this phase's render. Inputs of the test that
+	// aren't given here are inherited.
+	Inputs []*VarValue `yaml:"inputs,omitempty"`
+
+	// ForceOverwrite lets this phase overwrite files that already exist in the
+	// destination.
+	ForceOverwrite model.Bool `yaml:"force_overwrite,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (p *Phase) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, p, &p.Pos) //nolint:wrapcheck
+}
+
+// Validate implements model.Validator.
+func (p *Phase) Validate() error {
+	return model.ValidateEach(p.Inputs)
+}
+
+// VerifyStep is a command that's run in a copy of a test's output after it's
+// rendered, like "go build ./...", to check that the generated project
+// actually works, not just that it matches the recorded files. Verify steps
+// are only run by "golden-test verify", and only with --allow-exec.
+type VerifyStep struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Desc describes the step in failure messages. Optional.
+	Desc model.String `yaml:"desc,omitempty"`
+
+	// Command is the program to run and its arguments. It's run directly,
+	// not by a shell, with the copy of the output as its working directory.
+	Command []model.String `yaml:"command"`
+
+	// Timeout is how long the command may run before it's killed, as a Go
+	// duration like "5m". The default is one minute.
+	Timeout model.String `yaml:"timeout,omitempty"`
+
+	// Env are the names of environment variables that are passed to the
+	// command. The command doesn't see the rest of the environment, other
+	// than PATH, HOME, and the variables that name the temp directory.
+	Env []model.String `yaml:"env,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (v *VerifyStep) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, v, &v.Pos) //nolint:wrapcheck
+}
+
+// Validate implements model.Validator.
+func (v *VerifyStep) Validate() error {
+	var timeoutErr error
+	if v.Timeout.Val != "" {
+		if d, err := time.ParseDuration(v.Timeout.Val); err != nil || d <= 0 {
+			timeoutErr = v.Timeout.Pos.Errorf(`invalid timeout %q, must be a positive duration like "5m"`, v.Timeout.Val)
+		}
+	}
+	var envErr error
+	for _, e := range v.Env {
+		if e.Val == "" || strings.Contains(e.Val, "=") {
+			envErr = errors.Join(envErr, e.Pos.Errorf("invalid environment variable name %q", e.Val))
+		}
+	}
+	return errors.Join(
+		model.NonEmptySlice(&v.Pos, v.Command, "command"),
+		timeoutErr,
+		envErr,
+	)
+}
+
+// TimeoutOrDefault returns the parsed Timeout, or def if it's empty. It must
+// only be called after Validate succeeds.
+func (v *VerifyStep) TimeoutOrDefault(def time.Duration) time.Duration {
+	if v.Timeout.Val == "" {
+		return def
+	}
+	d, _ := time.ParseDuration(v.Timeout.Val)
+	return d
+}
+
 // Test represents a parsed test.yaml describing test configs.
 type Test struct {
 	// Pos is the YAML file location where this object started.
@@ -53,15 +253,70 @@ type Test struct {
 
 	Inputs      []*VarValue `yaml:"inputs,omitempty"`
 	BuiltinVars []*VarValue `yaml:"builtin_vars,omitempty"`
+	Stdout      *Stdout     `yaml:"stdout,omitempty"`
+
+	// DestContents are files that exist in the destination directory before
+	// the template is rendered.
+	DestContents []*DestFile `yaml:"dest_contents,omitempty"`
+
+	// Phases are renders that happen in order before the test's own render,
+	// into the same destination directory. The golden data is captured after
+	// the test's own render.
+	Phases []*Phase `yaml:"phases,omitempty"`
+
+	// ForceOverwrite lets the test's own render overwrite files that already
+	// exist in the destination, like those created by Phases.
+	ForceOverwrite model.Bool `yaml:"force_overwrite,omitempty"`
+
+	// Symlinks is how symlinks in the template and its output are handled,
+	// like the --symlinks flag of "abc templates render". Symlinks in the
+	// output are recorded as symlinks in the golden data.
+	Symlinks model.String `yaml:"symlinks,omitempty"`
+
+	// Verify are commands that are run in a copy of the output after the
+	// test's own render, by "golden-test verify" with --allow-exec.
+	Verify []*VerifyStep `yaml:"verify,omitempty"`
 }
 
+// SymlinkModes are the valid values of Test.Symlinks, other than the empty
+// string.
+var SymlinkModes = []string{"follow", "preserve", "reject"}
+
 // Validate implements model.Validator.
 func (t *Test) Validate() error {
 	return errors.Join(
 		model.ValidateEach(t.Inputs),
+		model.ValidateUnlessNil(t.Stdout),
+		model.ValidateEach(t.DestContents),
+		validateDestContentPaths(t.DestContents),
+		model.ValidateEach(t.Phases),
+		t.validateSymlinks(),
+		model.ValidateEach(t.Verify),
 	)
 }
 
+func (t *Test) validateSymlinks() error {
+	if t.Symlinks.Val == "" {
+		return nil
+	}
+	return model.OneOf(&t.Pos, t.Symlinks, SymlinkModes, "symlinks")
+}
+
+// validateDestContentPaths returns an error if two entries of dest_contents are
+// for the same file.
+func validateDestContentPaths(files []*DestFile) error {
+	seen := make(map[string]struct{}, len(files))
+	var merr error
+	for _, f := range files {
+		clean := path.Clean(f.Path.Val)
+		if _, ok := seen[clean]; ok {
+			merr = errors.Join(merr, f.Path.Pos.Errorf("duplicate dest_contents path %q", f.Path.Val))
+		}
+		seen[clean] = struct{}{}
+	}
+	return merr
+}
+
 // UnmarshalYAML implements yaml.Unmarshaler.
 func (t *Test) UnmarshalYAML(n *yaml.Node) error {
 	return model.UnmarshalPlain(n, t, &t.Pos, "api_version", "apiVersion", "kind") //nolint:wrapcheck
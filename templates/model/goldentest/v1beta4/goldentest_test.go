@@ -65,6 +65,164 @@ func TestTestUnmarshal(t *testing.T) {
 - name: 'person_name'`,
 			wantErr: `at line 2 column 3: field "value" is required`,
 		},
+		{
+			name: "stdout_normalization_should_succeed",
+			in: `stdout:
+  sort_lines: true
+  trim_trailing_whitespace: true
+  replacements:
+  - regex: '[0-9]+ms'
+    with: '<duration>'`,
+			want: &Test{
+				Stdout: &Stdout{
+					SortLines:              model.Bool{Val: true},
+					TrimTrailingWhitespace: model.Bool{Val: true},
+					Replacements: []*StdoutReplacement{
+						{
+							Regex: model.String{Val: "[0-9]+ms"},
+							With:  model.String{Val: "<duration>"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "stdout_invalid_regex_should_fail",
+			in: `stdout:
+  replacements:
+  - regex: '[unclosed'
+    with: 'x'`,
+			wantErr: `at line 3 column 12: invalid regex "[unclosed"`,
+		},
+		{
+			name: "dest_contents_should_succeed",
+			in: `dest_contents:
+- path: 'src/main.go'
+  contents: 'package main'
+- path: 'empty.txt'`,
+			want: &Test{
+				DestContents: []*DestFile{
+					{
+						Path:     model.String{Val: "src/main.go"},
+						Contents: model.String{Val: "package main"},
+					},
+					{
+						Path: model.String{Val: "empty.txt"},
+					},
+				},
+			},
+		},
+		{
+			name: "dest_contents_path_traversal_should_fail",
+			in: `dest_contents:
+- path: '../outside.txt'
+  contents: 'x'`,
+			wantErr: `must be relative to the destination directory`,
+		},
+		{
+			name: "dest_contents_reserved_path_should_fail",
+			in: `dest_contents:
+- path: '.abc/manifest.yaml'
+  contents: 'x'`,
+			wantErr: `is in the .abc directory, which is reserved`,
+		},
+		{
+			name: "dest_contents_duplicate_path_should_fail",
+			in: `dest_contents:
+- path: 'a.txt'
+  contents: 'x'
+- path: './a.txt'
+  contents: 'y'`,
+			wantErr: `duplicate dest_contents path "./a.txt"`,
+		},
+		{
+			name: "phases_should_succeed",
+			in: `phases:
+- template: '../v1'
+  inputs:
+  - name: 'person_name'
+    value: 'iron_man'
+- force_overwrite: true
+force_overwrite: true`,
+			want: &Test{
+				Phases: []*Phase{
+					{
+						Template: model.String{Val: "../v1"},
+						Inputs: []*VarValue{
+							{
+								Name:  model.String{Val: "person_name"},
+								Value: model.String{Val: "iron_man"},
+							},
+						},
+					},
+					{
+						ForceOverwrite: model.Bool{Val: true},
+					},
+				},
+				ForceOverwrite: model.Bool{Val: true},
+			},
+		},
+		{
+			name: "phase_input_missing_name_should_fail",
+			in: `phases:
+- inputs:
+  - value: 'iron_man'`,
+			wantErr: `at line 3 column 5: field "name" is required`,
+		},
+		{
+			name: "symlinks_should_succeed",
+			in:   `symlinks: 'preserve'`,
+			want: &Test{
+				Symlinks: model.String{Val: "preserve"},
+			},
+		},
+		{
+			name:    "invalid_symlinks_should_fail",
+			in:      `symlinks: 'ignore'`,
+			wantErr: `at line 1 column 11: field "symlinks" value was "ignore" but must be one of [follow preserve reject]`,
+		},
+		{
+			name: "verify_should_succeed",
+			in: `verify:
+- desc: 'Build the generated code'
+  command: ['go', 'build', './...']
+  timeout: '5m'
+  env: ['GOPROXY']
+- command: ['true']`,
+			want: &Test{
+				Verify: []*VerifyStep{
+					{
+						Desc:    model.String{Val: "Build the generated code"},
+						Command: []model.String{{Val: "go"}, {Val: "build"}, {Val: "./..."}},
+						Timeout: model.String{Val: "5m"},
+						Env:     []model.String{{Val: "GOPROXY"}},
+					},
+					{
+						Command: []model.String{{Val: "true"}},
+					},
+				},
+			},
+		},
+		{
+			name: "verify_missing_command_should_fail",
+			in: `verify:
+- desc: 'Nothing to run'`,
+			wantErr: `at line 2 column 3: field "command" is required`,
+		},
+		{
+			name: "verify_invalid_timeout_should_fail",
+			in: `verify:
+- command: ['go', 'build', './...']
+  timeout: 'forever'`,
+			wantErr: `at line 3 column 12: invalid timeout "forever", must be a positive duration like "5m"`,
+		},
+		{
+			name: "verify_invalid_env_should_fail",
+			in: `verify:
+- command: ['go', 'build', './...']
+  env: ['A=B']`,
+			wantErr: `invalid environment variable name "A=B"`,
+		},
 		{
 			name: "unknown_field_should_fail",
 			in: `inputs:
@@ -54,12 +54,23 @@ type Manifest struct {
 
 	// The dirhash (https://pkg.go.dev/golang.org/x/mod/sumdb/dirhash) of the
 	// template source tree (not the output). This shows exactly what version of
-	// the template was installed.
+	// the template was installed. The part before the ":" names the hash
+	// algorithm, like "h1" for SHA-256 or "sha512"; see package hashalg.
 	TemplateDirhash model.String `yaml:"template_dirhash"`
 
 	// The input values that were supplied by the user when rendering the template.
 	Inputs []*Input `yaml:"inputs"`
 
+	// The template vars whose values were overridden with --set when rendering
+	// the template, rather than being computed by the template.
+	VarOverrides []*Input `yaml:"var_overrides,omitempty"`
+
+	// The name of the template's destination (see "destinations" in the
+	// spec) whose output files are described by this manifest, if they were
+	// written to a directory of their own with --extra-dest. It's empty for
+	// the rest of the output, in the main destination directory.
+	Destination model.String `yaml:"destination,omitempty"`
+
 	// The hash of each output file created by the template.
 	OutputHashes []*OutputHash `yaml:"output_hashes"`
 }
@@ -87,6 +98,7 @@ func (m *Manifest) Validate() error {
 		model.NotZeroModel(&m.Pos, m.TemplateLocation, "template_location"),
 		model.NotZeroModel(&m.Pos, m.TemplateDirhash, "template_dirhash"),
 		model.ValidateEach(m.Inputs),
+		model.ValidateEach(m.VarOverrides),
 		model.ValidateEach(m.OutputHashes),
 	)
 }
@@ -100,6 +112,13 @@ type Input struct {
 	Name model.String `yaml:"name"`
 	// The value of the template input, e.g. "foo@iam.gserviceaccount.com".
 	Value model.String `yaml:"value"`
+	// The type of the template input, if it's not a string, e.g. "bool". The
+	// value is in the canonical form for the type, e.g. "true".
+	Type model.String `yaml:"type,omitempty"`
+	// AcceptedDefault is true if the input wasn't given, and its default was
+	// used without asking for it because of --accept-defaults. This records
+	// that nobody chose the value, for auditing.
+	AcceptedDefault model.Bool `yaml:"accepted_default,omitempty"`
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler.
@@ -123,8 +142,27 @@ type OutputHash struct {
 	// The path, relative to the destination directory, of this file.
 	File model.String `yaml:"file"`
 	// The dirhash-style hash (see https://pkg.go.dev/golang.org/x/mod/sumdb/dirhash)
-	// of this file. The format looks like "h1:0a1b2c3d...".
+	// of this file. The format looks like "h1:0a1b2c3d...", where the part
+	// before the ":" names the hash algorithm, which may differ from one entry
+	// to the next. For a symlink, this is the hash of its target.
 	Hash model.String `yaml:"hash"`
+
+	// If this file is a symlink that was created with --symlinks=preserve,
+	// this is its target, using forward slashes.
+	SymlinkTarget model.String `yaml:"symlink_target,omitempty"`
+
+	// IncludedFromDest is true if this file already existed in the
+	// destination directory, and the template modified it in place by
+	// including it with "from: destination". The hash is of the file as the
+	// template left it. Since the template didn't create the file, it belongs
+	// to the user even if a later version of the template stops modifying it.
+	IncludedFromDest model.Bool `yaml:"included_from_dest,omitempty"`
+
+	// SkipIfExists is true if this file matches one of the template's
+	// skip_if_exists patterns, so it's only created if it doesn't exist. A
+	// later render or upgrade must not overwrite it, even if its hash no
+	// longer matches.
+	SkipIfExists model.Bool `yaml:"skip_if_exists,omitempty"`
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler.
@@ -53,11 +53,31 @@ func YAMLPos(n *yaml.Node) *ConfigPos {
 //	Wrapping an error: c.Errorf("foo(): %w", err)
 //
 //	Creating an error: c.Errorf("something went wrong doing action %s", action)
+//
+// If the position is known, the returned error is a *PosError.
 func (c *ConfigPos) Errorf(fmtStr string, args ...any) error {
 	err := fmt.Errorf(fmtStr, args...)
 	if c == nil || c.IsZero() {
 		return err
 	}
 
-	return fmt.Errorf("at line %d column %d: %w", c.Line, c.Column, err)
+	return &PosError{Pos: *c, Err: err}
+}
+
+// PosError is an error at a known position in a YAML file, as returned by
+// ConfigPos.Errorf. Tools that show errors next to the YAML, like an editor,
+// can find it with errors.As.
+type PosError struct {
+	Pos ConfigPos
+	Err error
+}
+
+// Error implements error.
+func (p *PosError) Error() string {
+	return fmt.Sprintf("at line %d column %d: %v", p.Pos.Line, p.Pos.Column, p.Err)
+}
+
+// Unwrap returns the error without its position.
+func (p *PosError) Unwrap() error {
+	return p.Err
 }
@@ -29,4 +29,133 @@ type Features struct {
 	// SkipGitVars determines whether to create builtin variables for _git_sha,
 	// _git_short_sha, and _git_tag. New in v1beta3.
 	SkipGitVars bool
+
+	// SkipRenderedPaths determines whether to create the builtin variable
+	// _rendered_paths for each step. New in v1beta4.
+	SkipRenderedPaths bool
+
+	// SkipGitCommitVars determines whether to create builtin variables for
+	// _git_commit_time, _git_author_name, and _git_author_email. New in
+	// v1beta4.
+	SkipGitCommitVars bool
+
+	// SkipDoubleStarGlobs determines whether globs use the syntax of
+	// filepath.Match, where "**" is the same as "*", rather than matching any
+	// number of directories, and whether paths starting with "!" are literal
+	// rather than excluding files. New in v1beta4.
+	SkipDoubleStarGlobs bool
+
+	// SkipUnmatchedPathErrors determines whether a path in an action that
+	// modifies files, which exists but has no files in it that the action can
+	// modify, like an empty directory, is only logged as a warning rather than
+	// being an error. New in v1beta4.
+	SkipUnmatchedPathErrors bool
+}
+
+// Migration describes a behavior that a spec keeps from its older
+// api_version, where a newer api_version would behave differently.
+type Migration struct {
+	// Feature is the name of the Features field that's set, like "SkipGlobs".
+	Feature string
+
+	// Since is the api_version that introduced the new behavior, like
+	// "cli.abcxyz.dev/v1beta2".
+	Since string
+
+	// Assumed is a short description of the old behavior that's kept.
+	Assumed string
+
+	// Explanation describes how the behavior changes when the spec's
+	// api_version is changed to Since or later, and what to check before
+	// doing so.
+	Explanation string
+}
+
+// migrations are the Features fields and what they mean, in the order they
+// were introduced. Keep this in sync with the fields above.
+var migrations = []struct {
+	skip func(Features) bool
+	m    Migration
+}{
+	{
+		skip: func(f Features) bool { return f.SkipGlobs },
+		m: Migration{
+			Feature: "SkipGlobs",
+			Since:   "cli.abcxyz.dev/v1beta2",
+			Assumed: "paths in steps are literal file names, not globs",
+			Explanation: "Starting in cli.abcxyz.dev/v1beta2, the paths of actions like include and string_replace are globs, " +
+				"so a path containing *, ?, or [ matches every file that fits the pattern. Check that none of the paths in " +
+				"this spec contain those characters, or escape them, before upgrading.",
+		},
+	},
+	{
+		skip: func(f Features) bool { return f.SkipGitVars },
+		m: Migration{
+			Feature: "SkipGitVars",
+			Since:   "cli.abcxyz.dev/v1beta3",
+			Assumed: "the builtin variables _git_sha, _git_short_sha, and _git_tag aren't defined",
+			Explanation: "Starting in cli.abcxyz.dev/v1beta3, _git_sha, _git_short_sha, and _git_tag are set from the git " +
+				"repo that the template was downloaded from, and are empty if it wasn't in one. Nothing changes for " +
+				"templates that don't use them.",
+		},
+	},
+	{
+		skip: func(f Features) bool { return f.SkipRenderedPaths },
+		m: Migration{
+			Feature: "SkipRenderedPaths",
+			Since:   "cli.abcxyz.dev/v1beta4",
+			Assumed: "the builtin variable _rendered_paths isn't defined",
+			Explanation: "Starting in cli.abcxyz.dev/v1beta4, each step can use _rendered_paths, which lists the files " +
+				"that the earlier steps have written. Nothing changes for templates that don't use it.",
+		},
+	},
+	{
+		skip: func(f Features) bool { return f.SkipGitCommitVars },
+		m: Migration{
+			Feature: "SkipGitCommitVars",
+			Since:   "cli.abcxyz.dev/v1beta4",
+			Assumed: "the builtin variables _git_commit_time, _git_author_name, and _git_author_email aren't defined",
+			Explanation: "Starting in cli.abcxyz.dev/v1beta4, _git_commit_time, _git_author_name, and _git_author_email " +
+				"are set from the commit of the template's git repo, and are empty if it wasn't in one. Nothing changes " +
+				"for templates that don't use them.",
+		},
+	},
+	{
+		skip: func(f Features) bool { return f.SkipDoubleStarGlobs },
+		m: Migration{
+			Feature: "SkipDoubleStarGlobs",
+			Since:   "cli.abcxyz.dev/v1beta4",
+			Assumed: `"**" in a glob matches a single path element, like "*", and a path starting with "!" is literal`,
+			Explanation: "Starting in cli.abcxyz.dev/v1beta4, a \"**\" path element in a glob matches any number of " +
+				"directories, so \"**/*.txt\" matches text files at every depth rather than one directory down, and a " +
+				"path starting with \"!\" excludes the files it matches from the step. Check the paths, ignore patterns, " +
+				"and skip patterns in this spec that contain \"**\" or start with \"!\" before upgrading.",
+		},
+	},
+	{
+		skip: func(f Features) bool { return f.SkipUnmatchedPathErrors },
+		m: Migration{
+			Feature: "SkipUnmatchedPathErrors",
+			Since:   "cli.abcxyz.dev/v1beta4",
+			Assumed: "a path in an action that modifies files may match only empty directories",
+			Explanation: "Starting in cli.abcxyz.dev/v1beta4, it's an error when a path in an action that modifies files, " +
+				"like string_replace or go_template, has no files in it that the action can modify, like an empty " +
+				"directory, rather than just a warning. Render the template with the inputs it's used with, and check " +
+				"for \"didn't match any files\" warnings, before upgrading.",
+		},
+	},
+}
+
+// Migrations returns the old behaviors that f keeps, one for each feature
+// that it skips, in the order the features were introduced. It's empty for
+// the latest api_version.
+func (f Features) Migrations() []*Migration {
+	var out []*Migration
+	for _, mig := range migrations {
+		if mig.skip(f) {
+			m := mig.m
+			out = append(out, &m)
+		}
+	}
+	return out
 }
@@ -0,0 +1,84 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package features
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMigrations(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		features Features
+		want     []string
+	}{
+		{
+			name: "latest",
+		},
+		{
+			name:     "v1beta1",
+			features: Features{SkipGlobs: true, SkipGitVars: true, SkipRenderedPaths: true, SkipGitCommitVars: true, SkipDoubleStarGlobs: true, SkipUnmatchedPathErrors: true},
+			want:     []string{"SkipGlobs", "SkipGitVars", "SkipRenderedPaths", "SkipGitCommitVars", "SkipDoubleStarGlobs", "SkipUnmatchedPathErrors"},
+		},
+		{
+			name:     "v1beta3",
+			features: Features{SkipRenderedPaths: true, SkipGitCommitVars: true, SkipDoubleStarGlobs: true, SkipUnmatchedPathErrors: true},
+			want:     []string{"SkipRenderedPaths", "SkipGitCommitVars", "SkipDoubleStarGlobs", "SkipUnmatchedPathErrors"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, m := range tc.features.Migrations() {
+				got = append(got, m.Feature)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("migrations were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+// TestMigrations_AllFeatures checks that every field of Features has a
+// migration, so that lint can explain it.
+func TestMigrations_AllFeatures(t *testing.T) {
+	t.Parallel()
+
+	typ := reflect.TypeOf(Features{})
+	for i := 0; i < typ.NumField(); i++ {
+		name := typ.Field(i).Name
+		var f Features
+		reflect.ValueOf(&f).Elem().Field(i).SetBool(true)
+
+		got := f.Migrations()
+		if len(got) != 1 || got[0].Feature != name {
+			t.Errorf("Features{%s: true}.Migrations() = %v, want one migration for %s; add it to the migrations list", name, got, name)
+			continue
+		}
+		if got[0].Since == "" || got[0].Assumed == "" || got[0].Explanation == "" {
+			t.Errorf("the migration for %s must have Since, Assumed, and Explanation set, got %+v", name, got[0])
+		}
+	}
+}
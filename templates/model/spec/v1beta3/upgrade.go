@@ -38,5 +38,11 @@ func (s *Spec) Upgrade(ctx context.Context) (model.ValidatorUpgrader, error) {
 	// that weren't supported in its declared api_version.
 	out.Features = s.Features
 
+	// Features introduced in v1beta4:
+	out.Features.SkipRenderedPaths = true
+	out.Features.SkipGitCommitVars = true
+	out.Features.SkipDoubleStarGlobs = true
+	out.Features.SkipUnmatchedPathErrors = true
+
 	return &out, nil
 }
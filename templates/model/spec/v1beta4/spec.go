@@ -17,11 +17,17 @@ package v1beta4
 
 import (
 	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"golang.org/x/exp/slices"
 	"gopkg.in/yaml.v3"
 
+	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/spec/features"
 )
@@ -36,6 +42,92 @@ type Spec struct {
 	Rules  []*Rule      `yaml:"rules"`
 	Steps  []*Step      `yaml:"steps"`
 
+	// InputConstraints are checks on combinations of inputs, like "exactly one
+	// of these inputs must be set", which are validated along with the inputs'
+	// rules.
+	InputConstraints []*InputConstraint `yaml:"input_constraints"`
+
+	// Vars are internal variables whose values are computed from CEL
+	// expressions after the inputs are known.
+	Vars []*Var `yaml:"vars"`
+
+	// StepGroups are named sequences of steps that may be run any number of
+	// times by "call_step_group" actions.
+	StepGroups []*StepGroup `yaml:"step_groups"`
+
+	// PreRender are steps that run before the main steps, including the steps
+	// of any base templates.
+	PreRender []*Step `yaml:"pre_render"`
+
+	// PostRender are steps that run after the output has been written to the
+	// destination directory, and before the manifest is written. Their paths
+	// are relative to the destination directory. Only the actions in
+	// PostRenderActions are allowed.
+	PostRender []*Step `yaml:"post_render"`
+
+	// Extends is the optional location of a base template, in any form
+	// accepted by "abc templates render". The base template's inputs, rules
+	// and steps are combined with this template's; see the extends package.
+	Extends model.String `yaml:"extends"`
+
+	// LineEndings is one of "preserve" (the default), "lf", or "crlf". It
+	// converts the line endings of every text file in the output just before
+	// it's written to the destination.
+	LineEndings model.String `yaml:"line_endings"`
+
+	// StripBOM removes a leading UTF-8 byte order mark from every text file in
+	// the output just before it's written to the destination.
+	StripBOM model.Bool `yaml:"strip_bom"`
+
+	// FileModes is one of "preserve" (the default) or "normalize". It says
+	// whether the permission bits of output files are copied from the
+	// template files, which depend on the OS the template was authored or
+	// downloaded on, or are always rw-r--r--, or rwxr-xr-x for Executable
+	// files.
+	FileModes model.String `yaml:"file_modes"`
+
+	// Executable are glob patterns, relative to the destination directory, of
+	// output files that must be executable, like shell scripts, whatever the
+	// permission bits of the template files they came from.
+	Executable []model.String `yaml:"executable"`
+
+	// SkipIfExists are glob patterns, relative to the destination directory,
+	// of output files that are only written if they don't already exist
+	// there, like config files that users are expected to edit. A render
+	// never overwrites them, even with --force-overwrite, and they're marked
+	// in the manifest so upgrades leave them alone too.
+	SkipIfExists []model.String `yaml:"skip_if_exists"`
+
+	// GeneratedMarker adds a comment to the top of each output file saying
+	// that it was generated by abc from this template, and mustn't be edited.
+	// Upgrades regenerate the files that still have the comment, even if
+	// they've been changed.
+	GeneratedMarker model.Bool `yaml:"generated_marker"`
+
+	// SkipGeneratedMarker are glob patterns, relative to the destination
+	// directory, of output files that don't get the GeneratedMarker comment,
+	// like files that users are expected to edit.
+	SkipGeneratedMarker []model.String `yaml:"skip_generated_marker"`
+
+	// Destinations are named directories, other than the destination
+	// directory, that parts of the output are written to instead, like a
+	// checkout of a separate infrastructure repo. Each is given a directory
+	// with --extra-dest when the template is rendered; if it isn't, its files
+	// are written to the destination directory like the rest of the output.
+	Destinations []*Destination `yaml:"destinations"`
+
+	// Files are the contents of template files, keyed by their slash-separated
+	// paths relative to the template directory. They're written into the
+	// template directory before the template is rendered, as if they'd been
+	// there all along, so a small template can be a single spec file.
+	Files map[string]model.String `yaml:"files"`
+
+	// EnvVars are the names of the environment variables that the template
+	// may read. Each is in scope as a builtin var named with the prefix
+	// "_env_", like _env_GOOGLE_CLOUD_PROJECT, and is empty if the variable
+	// isn't set. No other environment variables are visible to the template.
+	EnvVars []model.String `yaml:"env_vars"`
+
 	// Optional ignore section, adopting gitignore-like path matching.
 	// Please be ware that there are some patterns that are always ignored such
 	// as: '.DS_Store, '.bin', '.ssh'.
@@ -57,14 +149,393 @@ func (s *Spec) UnmarshalYAML(n *yaml.Node) error {
 
 // Validate implements Validator.
 func (s *Spec) Validate() error {
+	// A template that extends another may consist only of new inputs, or of
+	// overrides of the base template's inputs.
+	var stepsErr error
+	if s.Extends.Val == "" {
+		stepsErr = model.NonEmptySlice(&s.Pos, s.Steps, "steps")
+	}
 	return errors.Join(
 		model.NotZeroModel(&s.Pos, s.Desc, "desc"),
-		model.NonEmptySlice(&s.Pos, s.Steps, "steps"),
+		stepsErr,
 		model.ValidateEach(s.Inputs),
+		model.ValidateEach(s.InputConstraints),
+		s.validateInputConstraintNames(),
+		model.ValidateEach(s.Vars),
+		validateVarNames(s.Inputs, s.Vars),
 		model.ValidateEach(s.Steps),
+		model.ValidateEach(s.PreRender),
+		model.ValidateEach(s.PostRender),
+		validatePostRenderActions(s.PostRender),
+		model.ValidateEach(s.StepGroups),
+		model.ValidateEach(s.Destinations),
+		s.validateDestinations(),
+		validateStepGroupCalls(s.StepGroups, append(append([]*Step{}, s.PreRender...), s.Steps...)),
+		s.validateLineEndings(),
+		s.validateFileModes(),
+		s.validateGlobs(),
+		s.validateFiles(),
+		s.validateEnvVars(),
 	)
 }
 
+// envVarNameRE matches the names of environment variables that can be
+// declared in env_vars. They must also be valid in the names of vars.
+var envVarNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateEnvVars checks that EnvVars are valid, unique environment variable
+// names.
+func (s *Spec) validateEnvVars() error {
+	seen := make(map[string]struct{}, len(s.EnvVars))
+	var merr error
+	for _, e := range s.EnvVars {
+		if !envVarNameRE.MatchString(e.Val) {
+			merr = errors.Join(merr, e.Pos.Errorf("invalid environment variable name %q in env_vars; it must have only letters, digits, and underscores, and not start with a digit", e.Val))
+		}
+		if _, ok := seen[e.Val]; ok {
+			merr = errors.Join(merr, e.Pos.Errorf("duplicate environment variable %q in env_vars", e.Val))
+		}
+		seen[e.Val] = struct{}{}
+	}
+	return merr
+}
+
+// EnvVarNames returns the values of EnvVars.
+func (s *Spec) EnvVarNames() []string {
+	out := make([]string, 0, len(s.EnvVars))
+	for _, e := range s.EnvVars {
+		out = append(out, e.Val)
+	}
+	return out
+}
+
+// validateFiles checks that the paths of Files are inside the template
+// directory. The map keys don't have positions, so errors are reported at the
+// file contents.
+func (s *Spec) validateFiles() error {
+	paths := make([]string, 0, len(s.Files))
+	for p := range s.Files {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	var merr error
+	for _, p := range paths {
+		contents := s.Files[p]
+		switch {
+		case p == "" || p == "." || path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") || strings.Contains(p, `\`):
+			merr = errors.Join(merr, contents.Pos.Errorf(`the path %q in "files" must be a clean, slash-separated path inside the template directory, like "src/main.go"`, p))
+		case p == "spec.yaml":
+			merr = errors.Join(merr, contents.Pos.Errorf(`"files" can't contain spec.yaml`))
+		}
+	}
+	return merr
+}
+
+// validateDestinations checks that the names of Destinations are unique, and
+// that no output path is sent to more than one of them, which happens if the
+// "from" of one is the same as, or inside, the "from" of another.
+func (s *Spec) validateDestinations() error {
+	seen := make(map[string]struct{}, len(s.Destinations))
+	var froms []model.String
+	var merr error
+	for _, d := range s.Destinations {
+		if _, ok := seen[d.Name.Val]; ok {
+			merr = errors.Join(merr, d.Name.Pos.Errorf("duplicate destination name %q", d.Name.Val))
+		}
+		seen[d.Name.Val] = struct{}{}
+		for _, dp := range d.Paths {
+			for _, other := range froms {
+				if pathContains(other.Val, dp.From.Val) || pathContains(dp.From.Val, other.Val) {
+					merr = errors.Join(merr, dp.From.Pos.Errorf(`the path %q overlaps the path %q at line %d; an output path can only be sent to one destination`,
+						dp.From.Val, other.Val, other.Pos.Line))
+				}
+			}
+			froms = append(froms, dp.From)
+		}
+	}
+	return merr
+}
+
+// pathContains returns whether the slash-separated path p is dir or is inside
+// it.
+func pathContains(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// isCleanRelPath returns whether p is a clean, slash-separated relative path
+// that doesn't leave the directory it's relative to.
+func isCleanRelPath(p string) bool {
+	return p != "" && !path.IsAbs(p) && path.Clean(p) == p && p != ".." && !strings.HasPrefix(p, "../") && !strings.Contains(p, `\`)
+}
+
+// validateGlobs checks the path patterns of every step, and the ignore
+// patterns, so that a malformed pattern is reported when the spec is loaded
+// rather than when the step runs. Older api_versions either don't interpret
+// paths as globs or use the plain syntax of filepath.Match, so their paths
+// aren't checked.
+func (s *Spec) validateGlobs() error {
+	if s.Features.SkipGlobs || s.Features.SkipDoubleStarGlobs {
+		return nil
+	}
+	steps := append(append(append([]*Step{}, s.PreRender...), s.Steps...), s.PostRender...)
+	for _, g := range s.StepGroups {
+		steps = append(steps, g.Steps...)
+	}
+	return errors.Join(
+		validateGlobList(s.Ignore, "in ignore"),
+		validateGlobList(s.SkipIfExists, "in skip_if_exists"),
+		validateGlobList(s.SkipGeneratedMarker, "in skip_generated_marker"),
+		validateGlobList(s.Executable, "in executable"),
+		validateStepGlobs(steps),
+	)
+}
+
+// validateStepGlobs checks the path patterns of each step, including those
+// nested inside for_each actions.
+func validateStepGlobs(steps []*Step) error {
+	var merr error
+	for _, s := range steps {
+		switch {
+		case s.Append != nil:
+			merr = errors.Join(merr, validateGlobList(s.Append.Paths, ""))
+		case s.Format != nil:
+			merr = errors.Join(merr, validateGlobList(s.Format.Paths, ""))
+		case s.GoTemplate != nil:
+			merr = errors.Join(merr, validateGlobList(s.GoTemplate.Paths, ""))
+		case s.HCLEdit != nil:
+			merr = errors.Join(merr, validateGlobList(s.HCLEdit.Paths, ""))
+		case s.RegexNameLookup != nil:
+			merr = errors.Join(merr, validateGlobList(s.RegexNameLookup.Paths, ""))
+		case s.RegexReplace != nil:
+			merr = errors.Join(merr, validateGlobList(s.RegexReplace.Paths, ""))
+		case s.StringReplace != nil:
+			merr = errors.Join(merr, validateGlobList(s.StringReplace.Paths, ""))
+		case s.Include != nil:
+			for _, p := range s.Include.Paths {
+				var asErr string
+				if len(p.As) > 0 {
+					asErr = `with "as"`
+				}
+				merr = errors.Join(merr,
+					validateGlobList(p.Paths, asErr),
+					validateGlobList(p.Skip, "in skip"))
+			}
+		case s.ForEach != nil:
+			merr = errors.Join(merr, validateStepGlobs(s.ForEach.Steps))
+		}
+	}
+	return merr
+}
+
+// validateGlobList checks that each path is a well-formed glob. A path may
+// start with "!" to exclude the files it matches from those matched by the
+// other paths, as long as at least one path isn't negated. If noNegated isn't
+// empty, negated paths aren't allowed, and it says where, like "in skip".
+func validateGlobList(paths []model.String, noNegated string) error {
+	var merr error
+	positive := false
+	for _, p := range paths {
+		pattern, negated := strings.CutPrefix(p.Val, "!")
+		switch {
+		case !negated:
+			positive = true
+		case noNegated != "":
+			merr = errors.Join(merr, p.Pos.Errorf("negated paths like %q can't be used %s", p.Val, noNegated))
+			continue
+		}
+		if err := common.ValidateGlob(pattern); err != nil {
+			merr = errors.Join(merr, p.Pos.Errorf("invalid glob: %w", err))
+		}
+	}
+	if len(paths) > 0 && !positive && merr == nil {
+		merr = paths[0].Pos.Errorf(`at least one path must not start with "!"; negated paths only exclude files matched by the other paths`)
+	}
+	return merr
+}
+
+// PostRenderActions are the actions allowed in Spec.PostRender. Other actions
+// would change the destination directory in ways that the manifest can't
+// account for, like creating new files.
+var PostRenderActions = []string{"print", "format"}
+
+// validatePostRenderActions checks that the post_render steps only use
+// PostRenderActions.
+func validatePostRenderActions(steps []*Step) error {
+	var merr error
+	for _, s := range steps {
+		if s.Action.Val != "" && !slices.Contains(PostRenderActions, s.Action.Val) {
+			merr = errors.Join(merr, s.Action.Pos.Errorf("action %q isn't allowed in post_render; it must be one of %v", s.Action.Val, PostRenderActions))
+		}
+	}
+	return merr
+}
+
+// LineEndingsValues are the valid values of Spec.LineEndings, other than the
+// empty string.
+var LineEndingsValues = []string{"preserve", "lf", "crlf"}
+
+func (s *Spec) validateLineEndings() error {
+	if s.LineEndings.Val == "" {
+		return nil
+	}
+	return model.OneOf(&s.Pos, s.LineEndings, LineEndingsValues, "line_endings")
+}
+
+// FileModesValues are the valid values of Spec.FileModes, other than the empty
+// string.
+var FileModesValues = []string{"preserve", "normalize"}
+
+func (s *Spec) validateFileModes() error {
+	if s.FileModes.Val == "" {
+		return nil
+	}
+	return model.OneOf(&s.Pos, s.FileModes, FileModesValues, "file_modes")
+}
+
+// validateInputConstraintNames checks that input constraints only name inputs
+// that exist. A template that extends another may name the base template's
+// inputs, which aren't known here, so it isn't checked.
+func (s *Spec) validateInputConstraintNames() error {
+	if s.Extends.Val != "" {
+		return nil
+	}
+	inputNames := make(map[string]struct{}, len(s.Inputs))
+	for _, i := range s.Inputs {
+		inputNames[i.Name.Val] = struct{}{}
+	}
+	var merr error
+	for _, c := range s.InputConstraints {
+		for _, name := range c.Inputs() {
+			if _, ok := inputNames[name.Val]; !ok {
+				merr = errors.Join(merr, name.Pos.Errorf("input constraint refers to an input %q that doesn't exist", name.Val))
+			}
+		}
+	}
+	return merr
+}
+
+// validateVarNames checks that var names are unique, and don't collide with
+// input names.
+func validateVarNames(inputs []*Input, vars []*Var) error {
+	inputNames := make(map[string]struct{}, len(inputs))
+	for _, i := range inputs {
+		inputNames[i.Name.Val] = struct{}{}
+	}
+	varNames := make(map[string]struct{}, len(vars))
+	var merr error
+	for _, v := range vars {
+		if _, ok := inputNames[v.Name.Val]; ok {
+			merr = errors.Join(merr, v.Name.Pos.Errorf("var %q has the same name as an input", v.Name.Val))
+		}
+		if _, ok := varNames[v.Name.Val]; ok {
+			merr = errors.Join(merr, v.Name.Pos.Errorf("duplicate var name %q", v.Name.Val))
+		}
+		varNames[v.Name.Val] = struct{}{}
+	}
+	return merr
+}
+
+// validateStepGroupCalls checks that every call_step_group action, whether in
+// the main steps or in a step group, names a step group that exists and passes
+// it valid params. It also checks that no step group calls itself, directly
+// or indirectly, which would never terminate.
+func validateStepGroupCalls(groups []*StepGroup, steps []*Step) error {
+	byName := make(map[string]*StepGroup, len(groups))
+	var merr error
+	for _, g := range groups {
+		if _, ok := byName[g.Name.Val]; ok {
+			merr = errors.Join(merr, g.Name.Pos.Errorf("duplicate step group name %q", g.Name.Val))
+			continue
+		}
+		byName[g.Name.Val] = g
+	}
+
+	checkCall := func(c *CallStepGroup) error {
+		g, ok := byName[c.Name.Val]
+		if !ok {
+			return c.Pos.Errorf("there's no step group named %q", c.Name.Val)
+		}
+		declared := make(map[string]struct{}, len(g.Params))
+		var callErr error
+		for _, p := range g.Params {
+			declared[p.Name.Val] = struct{}{}
+			if _, ok := c.With[p.Name.Val]; !ok && p.Default == nil {
+				callErr = errors.Join(callErr, c.Pos.Errorf("step group %q requires the param %q", g.Name.Val, p.Name.Val))
+			}
+		}
+		names := make([]string, 0, len(c.With))
+		for name := range c.With {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if _, ok := declared[name]; !ok {
+				callErr = errors.Join(callErr, c.Pos.Errorf("step group %q has no param named %q", g.Name.Val, name))
+			}
+		}
+		return callErr
+	}
+
+	merr = errors.Join(merr, visitStepGroupCalls(steps, checkCall))
+	for _, g := range groups {
+		merr = errors.Join(merr, visitStepGroupCalls(g.Steps, checkCall))
+	}
+	if merr != nil {
+		// Don't look for cycles through calls that are already known to be
+		// invalid.
+		return merr
+	}
+
+	// Look for cycles with a depth-first search, tracking which groups are on
+	// the current path.
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make(map[string]int, len(groups))
+	var visit func(g *StepGroup) error
+	visit = func(g *StepGroup) error {
+		state[g.Name.Val] = onPath
+		err := visitStepGroupCalls(g.Steps, func(c *CallStepGroup) error {
+			switch state[c.Name.Val] {
+			case onPath:
+				return c.Pos.Errorf("step group %q calls itself, directly or indirectly", c.Name.Val)
+			case unvisited:
+				return visit(byName[c.Name.Val])
+			}
+			return nil
+		})
+		state[g.Name.Val] = done
+		return err
+	}
+	for _, g := range groups {
+		if state[g.Name.Val] == unvisited {
+			if err := visit(g); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// visitStepGroupCalls calls f for each call_step_group action in steps,
+// including those nested inside for_each actions, and returns the joined
+// errors.
+func visitStepGroupCalls(steps []*Step, f func(*CallStepGroup) error) error {
+	var merr error
+	for _, s := range steps {
+		switch {
+		case s.CallStepGroup != nil:
+			merr = errors.Join(merr, f(s.CallStepGroup))
+		case s.ForEach != nil:
+			merr = errors.Join(merr, visitStepGroupCalls(s.ForEach.Steps, f))
+		}
+	}
+	return merr
+}
+
 // Input represents one of the parsed "input" fields from the spec.yaml file.
 type Input struct {
 	// Pos is the YAML file location where this object started.
@@ -75,9 +546,30 @@ type Input struct {
 	Default *model.String `yaml:"default,omitempty"`
 	Rules   []*Rule       `yaml:"rules"`
 
+	// DefaultFrom is a CEL expression that computes the default value of this
+	// input, like `project_id + "-sa"`. It may refer to built-in vars and to
+	// the inputs before this one. It's evaluated just before the default is
+	// needed, so when prompting, the user sees the computed value. At most one
+	// of Default and DefaultFrom may be set.
+	DefaultFrom model.String `yaml:"default_from,omitempty"`
+
+	// Infer optionally says how to guess a default value for this input by
+	// reading a file in the destination directory, like the module name in
+	// go.mod. An inferred value takes precedence over Default; if nothing can
+	// be inferred, Default is used as usual.
+	Infer *Infer `yaml:"infer,omitempty"`
+
+	// Type is the type of the input's value, one of InputTypes. The default is
+	// "string". Values from flags, input files, prompts, and defaults are
+	// converted to the type, and the input has that type in CEL expressions.
+	Type model.String `yaml:"type,omitempty"`
+
 	// TODO(tyroneclay): add your new field here
 }
 
+// InputTypes are the valid values of Input.Type, other than the empty string.
+var InputTypes = []string{"string", "bool", "int", "list"}
+
 // UnmarshalYAML implements yaml.Unmarshaler.
 func (i *Input) UnmarshalYAML(n *yaml.Node) error {
 	return model.UnmarshalPlain(n, i, &i.Pos)
@@ -90,11 +582,177 @@ func (i *Input) Validate() error {
 		reservedNameErr = i.Name.Pos.Errorf("input names beginning with _ are reserved")
 	}
 
+	var defaultErr error
+	if i.Default != nil && i.DefaultFrom.Val != "" {
+		defaultErr = i.DefaultFrom.Pos.Errorf(`"default" and "default_from" can't both be given`)
+	}
+
 	return errors.Join(
 		model.NotZeroModel(&i.Pos, i.Name, "name"),
 		model.NotZeroModel(&i.Pos, i.Desc, "desc"),
 		reservedNameErr,
+		defaultErr,
 		model.ValidateEach(i.Rules),
+		validateInfer(i.Infer),
+		i.validateType(),
+	)
+}
+
+func (i *Input) validateType() error {
+	if i.Type.Val == "" {
+		return nil
+	}
+	return model.OneOf(&i.Pos, i.Type, InputTypes, "type")
+}
+
+// validateInfer validates an optional Infer.
+func validateInfer(i *Infer) error {
+	if i == nil {
+		return nil
+	}
+	return i.Validate()
+}
+
+// Infer describes how to guess the default value of an input from a file in the
+// destination directory.
+type Infer struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// File is the path of the file to read, relative to the destination
+	// directory, like "go.mod" or "package.json".
+	File model.String `yaml:"file"`
+
+	// Exactly one of the following fields must be set.
+
+	// Regex is a regular expression that's matched against the contents of
+	// File. If it has a capturing group, the first group is the inferred
+	// value; otherwise the whole match is. For example, "(?m)^module\s+(\S+)"
+	// gets the module name from a go.mod file.
+	Regex model.String `yaml:"regex"`
+
+	// Field is a dot-separated path to a scalar value in File, which is
+	// parsed as JSON or YAML. For example, "name" gets the project name from a
+	// package.json file.
+	Field model.String `yaml:"field"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *Infer) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos)
+}
+
+// Validate implements Validator.
+func (i *Infer) Validate() error {
+	var fileErr error
+	if i.File.Val != "" && !filepath.IsLocal(filepath.FromSlash(i.File.Val)) {
+		fileErr = i.File.Pos.Errorf("the infer file %q must be a relative path inside the destination directory", i.File.Val)
+	}
+
+	var exclusivityErr error
+	if (i.Regex.Val == "") == (i.Field.Val == "") {
+		exclusivityErr = i.Pos.Errorf(`exactly one of the fields "regex" or "field" must be set`)
+	}
+
+	var regexErr error
+	if i.Regex.Val != "" {
+		if _, err := regexp.Compile(i.Regex.Val); err != nil {
+			regexErr = i.Regex.Pos.Errorf("invalid infer regex: %w", err)
+		}
+	}
+
+	return errors.Join(
+		model.NotZeroModel(&i.Pos, i.File, "file"),
+		fileErr,
+		exclusivityErr,
+		regexErr,
+	)
+}
+
+// InputConstraint is a check on a group of inputs, for the common case of
+// inputs that are alternatives to each other, like a choice of backends. An
+// input counts as set if its value isn't the zero value of its type: the empty
+// string, false, 0, or the empty list.
+type InputConstraint struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Exactly one of the following fields must be set.
+
+	// OneOf names inputs of which exactly one must be set.
+	OneOf []model.String `yaml:"one_of"`
+
+	// Conflicts names inputs of which at most one may be set.
+	Conflicts []model.String `yaml:"conflicts"`
+
+	// Message is an optional message to show to the user if the constraint
+	// isn't satisfied.
+	Message model.String `yaml:"message"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *InputConstraint) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, c, &c.Pos)
+}
+
+// Validate implements Validator.
+func (c *InputConstraint) Validate() error {
+	if (len(c.OneOf) == 0) == (len(c.Conflicts) == 0) {
+		return c.Pos.Errorf(`exactly one of the fields "one_of" or "conflicts" must be set`)
+	}
+	if len(c.Inputs()) < 2 {
+		return c.Pos.Errorf("an input constraint must name at least two inputs")
+	}
+	seen := make(map[string]struct{}, len(c.Inputs()))
+	var merr error
+	for _, name := range c.Inputs() {
+		if _, ok := seen[name.Val]; ok {
+			merr = errors.Join(merr, name.Pos.Errorf("input %q is named more than once", name.Val))
+		}
+		seen[name.Val] = struct{}{}
+	}
+	return merr
+}
+
+// Inputs returns the names of the inputs in the constraint, from whichever of
+// OneOf or Conflicts is set.
+func (c *InputConstraint) Inputs() []model.String {
+	if len(c.OneOf) > 0 {
+		return c.OneOf
+	}
+	return c.Conflicts
+}
+
+// Var is an internal variable, derived from the inputs. Unlike an input, the
+// user doesn't normally provide its value, but it can be overridden at render
+// time with --set.
+type Var struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Name model.String `yaml:"name"`
+	Desc model.String `yaml:"desc"`
+
+	// Value is a CEL expression returning a string. It may reference inputs
+	// and vars declared earlier in the list.
+	Value model.String `yaml:"value"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (v *Var) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, v, &v.Pos)
+}
+
+// Validate implements Validator.
+func (v *Var) Validate() error {
+	var reservedNameErr error
+	if strings.HasPrefix(v.Name.Val, "_") {
+		reservedNameErr = v.Name.Pos.Errorf("var names beginning with _ are reserved")
+	}
+	return errors.Join(
+		model.NotZeroModel(&v.Pos, v.Name, "name"),
+		model.NotZeroModel(&v.Pos, v.Value, "value"),
+		reservedNameErr,
 	)
 }
 
@@ -116,6 +774,93 @@ func (i *Rule) Validate() error {
 	return model.NotZeroModel(&i.Pos, i.Rule, "rule")
 }
 
+// destinationNameRE matches the names of destinations, which are given
+// directories with --extra-dest=name=dir.
+var destinationNameRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// Destination is a named directory, other than the destination directory,
+// that part of the output is written to.
+type Destination struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Name identifies the destination in --extra-dest, like "infra".
+	Name model.String `yaml:"name"`
+	Desc model.String `yaml:"desc"`
+
+	// Paths are the parts of the output that are written to the destination,
+	// and where.
+	Paths []*DestinationPath `yaml:"paths"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Destination) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, d, &d.Pos)
+}
+
+// Validate implements Validator.
+func (d *Destination) Validate() error {
+	var nameErr error
+	if d.Name.Val != "" && !destinationNameRE.MatchString(d.Name.Val) {
+		nameErr = d.Name.Pos.Errorf("invalid destination name %q; it must start with a letter, and have only letters, digits, underscores, and hyphens", d.Name.Val)
+	}
+	return errors.Join(
+		model.NotZeroModel(&d.Pos, d.Name, "name"),
+		nameErr,
+		model.NotZeroModel(&d.Pos, d.Desc, "desc"),
+		model.NonEmptySlice(&d.Pos, d.Paths, "paths"),
+		model.ValidateEach(d.Paths),
+	)
+}
+
+// DestinationPath sends an output file or directory to a Destination.
+type DestinationPath struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// From is the path of an output file or directory, relative to the root
+	// of the output, like "infra".
+	From model.String `yaml:"from"`
+
+	// To is the path that From is written to, relative to the destination's
+	// directory. It's "." to write the contents of a directory to the root of
+	// the destination. If it's empty, From is used.
+	To model.String `yaml:"to"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *DestinationPath) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, d, &d.Pos)
+}
+
+// Validate implements Validator.
+func (d *DestinationPath) Validate() error {
+	var merr error
+	if d.From.Val != "" && (!isCleanRelPath(d.From.Val) || d.From.Val == ".") {
+		merr = errors.Join(merr, d.From.Pos.Errorf(`the path %q in "from" must be a clean, slash-separated path inside the output, like "infra"`, d.From.Val))
+	}
+	if d.To.Val != "" && !isCleanRelPath(d.To.Val) {
+		merr = errors.Join(merr, d.To.Pos.Errorf(`the path %q in "to" must be a clean, slash-separated path inside the destination, like "services/api" or "."`, d.To.Val))
+	}
+	for _, p := range []model.String{d.From, d.To} {
+		if pathContains(common.ABCInternalDir, p.Val) {
+			merr = errors.Join(merr, p.Pos.Errorf("the path %q uses the reserved name %q", p.Val, common.ABCInternalDir))
+		}
+	}
+	return errors.Join(
+		model.NotZeroModel(&d.Pos, d.From, "from"),
+		merr,
+	)
+}
+
+// Target returns the path that From is written to in the destination.
+func (d *DestinationPath) Target() string {
+	if d.To.Val == "" {
+		return d.From.Val
+	}
+	return d.To.Val
+}
+
 // Step represents one of the work steps involved in rendering a template.
 type Step struct {
 	// Pos is the YAML file location where this object started.
@@ -125,10 +870,28 @@ type Step struct {
 	If     model.String `yaml:"if"`
 	Action model.String `yaml:"action"`
 
+	// BasePath is an optional directory in the scratch directory, like
+	// "services/frontend", that the action's paths and globs are relative to,
+	// instead of the root of the scratch directory. It may contain template
+	// expressions. The base path of a step inside a for_each or step group is
+	// relative to that of its parent.
+	BasePath model.String `yaml:"base_path"`
+
+	// OnError is what happens when the step fails. It's optional, and is one
+	// of "fail", the default, which stops the render; "continue", which undoes
+	// the step's changes and goes on with the next step; or "retry(n)", which
+	// undoes the step's changes and runs it again, up to n more times, before
+	// failing. See ParseOnError.
+	OnError model.String `yaml:"on_error"`
+
 	// Each action type has a field below. Only one of these will be set.
 	Append          *Append          `yaml:"-"`
+	CallStepGroup   *CallStepGroup   `yaml:"-"`
 	ForEach         *ForEach         `yaml:"-"`
+	Format          *Format          `yaml:"-"`
+	GoModEdit       *GoModEdit       `yaml:"-"`
 	GoTemplate      *GoTemplate      `yaml:"-"`
+	HCLEdit         *HCLEdit         `yaml:"-"`
 	Include         *Include         `yaml:"-"`
 	Print           *Print           `yaml:"-"`
 	RegexNameLookup *RegexNameLookup `yaml:"-"`
@@ -150,14 +913,30 @@ func (s *Step) UnmarshalYAML(n *yaml.Node) error {
 		s.Append = new(Append)
 		unmarshalInto = s.Append
 		s.Append.Pos = s.Pos
+	case "call_step_group":
+		s.CallStepGroup = new(CallStepGroup)
+		unmarshalInto = s.CallStepGroup
+		s.CallStepGroup.Pos = s.Pos
 	case "for_each":
 		s.ForEach = new(ForEach)
 		unmarshalInto = s.ForEach
 		s.ForEach.Pos = s.Pos
+	case "format":
+		s.Format = new(Format)
+		unmarshalInto = s.Format
+		s.Format.Pos = s.Pos
+	case "go_mod_edit":
+		s.GoModEdit = new(GoModEdit)
+		unmarshalInto = s.GoModEdit
+		s.GoModEdit.Pos = s.Pos
 	case "go_template":
 		s.GoTemplate = new(GoTemplate)
 		unmarshalInto = s.GoTemplate
 		s.GoTemplate.Pos = s.Pos
+	case "hcl_edit":
+		s.HCLEdit = new(HCLEdit)
+		unmarshalInto = s.HCLEdit
+		s.HCLEdit.Pos = s.Pos
 	case "include":
 		s.Include = new(Include)
 		unmarshalInto = s.Include
@@ -201,9 +980,14 @@ func (s *Step) Validate() error {
 	// The "action" field is implicitly validated by UnmarshalYAML, so not included here.
 	return errors.Join(
 		model.NotZeroModel(&s.Pos, s.Desc, "desc"),
+		s.validateOnError(),
 		model.ValidateUnlessNil(s.Append),
+		model.ValidateUnlessNil(s.CallStepGroup),
 		model.ValidateUnlessNil(s.ForEach),
+		model.ValidateUnlessNil(s.Format),
+		model.ValidateUnlessNil(s.GoModEdit),
 		model.ValidateUnlessNil(s.GoTemplate),
+		model.ValidateUnlessNil(s.HCLEdit),
 		model.ValidateUnlessNil(s.Include),
 		model.ValidateUnlessNil(s.Print),
 		model.ValidateUnlessNil(s.RegexNameLookup),
@@ -212,6 +996,51 @@ func (s *Step) Validate() error {
 	)
 }
 
+func (s *Step) validateOnError() error {
+	if s.OnError.Val == "" {
+		return nil
+	}
+	if _, err := ParseOnError(s.OnError.Val); err != nil {
+		return s.OnError.Pos.Errorf("%w", err)
+	}
+	return nil
+}
+
+// MaxStepRetries is the largest n in an on_error of "retry(n)".
+const MaxStepRetries = 10
+
+var onErrorRetryRE = regexp.MustCompile(`^retry\((\d+)\)$`)
+
+// OnError is the parsed on_error field of a step.
+type OnError struct {
+	// Continue is whether to go on with the next step if the step still
+	// fails after its retries.
+	Continue bool
+
+	// Retries is how many more times to run the step after it fails.
+	Retries int
+}
+
+// ParseOnError parses the on_error field of a step. An empty value is the
+// same as "fail".
+func ParseOnError(s string) (*OnError, error) {
+	switch s {
+	case "", "fail":
+		return &OnError{}, nil
+	case "continue":
+		return &OnError{Continue: true}, nil
+	}
+	m := onErrorRetryRE.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf(`on_error must be one of "fail", "continue", or "retry(n)", but got %q`, s)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n < 1 || n > MaxStepRetries {
+		return nil, fmt.Errorf("the number of retries in on_error %q must be from 1 to %d", s, MaxStepRetries)
+	}
+	return &OnError{Retries: n}, nil
+}
+
 // Print is an action that prints a message to standard output.
 type Print struct {
 	// Pos is the YAML file location where this object started.
@@ -302,6 +1131,13 @@ type IncludePath struct {
 	OnConflict model.String   `yaml:"on_conflict"`
 	Paths      []model.String `yaml:"paths"`
 	Skip       []model.String `yaml:"skip"`
+
+	// StripPrefix is an optional directory, like "src", that's removed from
+	// the front of each included path to get its path in the output, so
+	// "src/app/main.go" is written to "app/main.go". Every included path must
+	// be inside it. It may contain template expressions, and can't be
+	// combined with "as".
+	StripPrefix model.String `yaml:"strip_prefix"`
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler.
@@ -317,6 +1153,11 @@ func (i *IncludePath) Validate() error {
 			len(i.As), len(i.Paths))
 	}
 
+	var stripPrefixErr error
+	if i.StripPrefix.Val != "" && len(i.As) != 0 {
+		stripPrefixErr = i.StripPrefix.Pos.Errorf(`"strip_prefix" can't be combined with "as"`)
+	}
+
 	var fromErr error
 	validFrom := []string{"destination"}
 	if i.From.Val != "" && !slices.Contains(validFrom, i.From.Val) {
@@ -326,6 +1167,7 @@ func (i *IncludePath) Validate() error {
 	return errors.Join(
 		model.NonEmptySlice(&i.Pos, i.Paths, "paths"),
 		exclusivityErr,
+		stripPrefixErr,
 		fromErr,
 	)
 }
@@ -475,6 +1317,304 @@ func (s *StringReplacement) UnmarshalYAML(n *yaml.Node) error {
 	return model.UnmarshalPlain(n, s, &s.Pos)
 }
 
+// StepGroup is a named sequence of steps, like a function, that can be run by
+// "call_step_group" actions.
+type StepGroup struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Name   model.String      `yaml:"name"`
+	Desc   model.String      `yaml:"desc"`
+	Params []*StepGroupParam `yaml:"params"`
+	Steps  []*Step           `yaml:"steps"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (g *StepGroup) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, g, &g.Pos)
+}
+
+// Validate implements Validator.
+func (g *StepGroup) Validate() error {
+	seen := make(map[string]struct{}, len(g.Params))
+	var dupErr error
+	for _, p := range g.Params {
+		if _, ok := seen[p.Name.Val]; ok {
+			dupErr = errors.Join(dupErr, p.Name.Pos.Errorf("duplicate param name %q", p.Name.Val))
+		}
+		seen[p.Name.Val] = struct{}{}
+	}
+	return errors.Join(
+		model.NotZeroModel(&g.Pos, g.Name, "name"),
+		model.NonEmptySlice(&g.Pos, g.Steps, "steps"),
+		dupErr,
+		model.ValidateEach(g.Params),
+		model.ValidateEach(g.Steps),
+	)
+}
+
+// StepGroupParam is a parameter of a StepGroup. Inside the group's steps, the
+// param's value is accessed like a template input, e.g. {{.my_param}}.
+type StepGroupParam struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Name model.String `yaml:"name"`
+	Desc model.String `yaml:"desc"`
+
+	// Default is used when a call doesn't give a value. If nil, every call
+	// must give a value.
+	Default *model.String `yaml:"default,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (p *StepGroupParam) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, p, &p.Pos)
+}
+
+// Validate implements Validator.
+func (p *StepGroupParam) Validate() error {
+	var reservedNameErr error
+	if strings.HasPrefix(p.Name.Val, "_") {
+		reservedNameErr = p.Name.Pos.Errorf("param names beginning with _ are reserved")
+	}
+	return errors.Join(
+		model.NotZeroModel(&p.Pos, p.Name, "name"),
+		reservedNameErr,
+	)
+}
+
+// CallStepGroup is an action that runs the steps of a StepGroup.
+type CallStepGroup struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Name is the name of the StepGroup to run.
+	Name model.String `yaml:"name"`
+
+	// With holds the values of the step group's params, keyed by param name.
+	With map[string]model.String `yaml:"with"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *CallStepGroup) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, c, &c.Pos)
+}
+
+// Validate implements Validator.
+func (c *CallStepGroup) Validate() error {
+	// Whether the step group exists and the params are valid is checked by
+	// Spec.Validate, which can see all the step groups.
+	return model.NotZeroModel(&c.Pos, c.Name, "name")
+}
+
+// Formatters are the built-in formatters that may be named in a Format action.
+var Formatters = []string{"go", "json", "yaml"}
+
+// Format is an action that reformats files into their canonical form.
+type Format struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Paths are the files and directories to format.
+	Paths []model.String `yaml:"paths"`
+
+	// Formatter is one of the built-in Formatters. If empty, the formatter is
+	// chosen by file extension, and files with other extensions are skipped.
+	Formatter model.String `yaml:"formatter"`
+
+	// Command is an external formatter to run instead of a built-in one. It
+	// reads a file on stdin and writes the formatted file to stdout.
+	Command []model.String `yaml:"command"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (f *Format) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, f, &f.Pos)
+}
+
+// Validate implements Validator.
+func (f *Format) Validate() error {
+	var formatterErr error
+	if f.Formatter.Val != "" {
+		formatterErr = model.OneOf(&f.Pos, f.Formatter, Formatters, "formatter")
+		if len(f.Command) > 0 {
+			formatterErr = errors.Join(formatterErr, f.Pos.Errorf(`"formatter" and "command" can't both be given`))
+		}
+	}
+	return errors.Join(
+		model.NonEmptySlice(&f.Pos, f.Paths, "paths"),
+		formatterErr,
+	)
+}
+
+// GoModEdit is an action that edits go.mod files using the same library as
+// the "go mod edit" command, so the output is always formatted the way the Go
+// toolchain expects.
+type GoModEdit struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Paths are the go.mod files to edit. If one doesn't exist and Module is
+	// set, it's created.
+	Paths []model.String `yaml:"paths"`
+
+	// Module is the module path to set, like "github.com/my-org/my-service".
+	Module model.String `yaml:"module"`
+
+	// Go is the go version directive to set, like "1.22".
+	Go model.String `yaml:"go"`
+
+	// Toolchain is the toolchain directive to set, like "go1.22.1".
+	Toolchain model.String `yaml:"toolchain"`
+
+	// Require adds requirements, or changes the version of existing ones.
+	Require []*GoModRequire `yaml:"require"`
+
+	// DropRequire is a list of module paths whose requirements are removed.
+	DropRequire []model.String `yaml:"drop_require"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (g *GoModEdit) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, g, &g.Pos)
+}
+
+// Validate implements Validator.
+func (g *GoModEdit) Validate() error {
+	// The module paths and versions are validated during execution, after
+	// template expressions have been executed.
+	var emptyErr error
+	if g.Module.Val == "" && g.Go.Val == "" && g.Toolchain.Val == "" && len(g.Require) == 0 && len(g.DropRequire) == 0 {
+		emptyErr = g.Pos.Errorf(`at least one of "module", "go", "toolchain", "require" or "drop_require" must be given`)
+	}
+	return errors.Join(
+		model.NonEmptySlice(&g.Pos, g.Paths, "paths"),
+		emptyErr,
+		model.ValidateEach(g.Require),
+	)
+}
+
+// GoModRequire is a requirement to add in a go_mod_edit action.
+type GoModRequire struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Path    model.String `yaml:"path"`
+	Version model.String `yaml:"version"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (g *GoModRequire) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, g, &g.Pos)
+}
+
+// Validate implements Validator.
+func (g *GoModRequire) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&g.Pos, g.Path, "path"),
+		model.NotZeroModel(&g.Pos, g.Version, "version"),
+	)
+}
+
+// HCLEdit is an action that edits attributes and blocks in files written in
+// the HCL native syntax, like Terraform .tf files. Unlike string_replace and
+// regex_replace, it understands the structure of the file, and everything
+// that isn't edited keeps its formatting and comments.
+type HCLEdit struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths []model.String  `yaml:"paths"`
+	Edits []*HCLEditEntry `yaml:"edits"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (h *HCLEdit) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, h, &h.Pos)
+}
+
+// Validate implements Validator.
+func (h *HCLEdit) Validate() error {
+	// Some validation happens later during execution:
+	//  - Parsing the block headers
+	//  - Checking that the attribute names and values are valid HCL
+	return errors.Join(
+		model.NonEmptySlice(&h.Pos, h.Paths, "paths"),
+		model.NonEmptySlice(&h.Pos, h.Edits, "edits"),
+		model.ValidateEach(h.Edits),
+	)
+}
+
+// HCLEditEntry is a group of edits to a single block in an hcl_edit action.
+type HCLEditEntry struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Block is the path to the block to edit, as a list of block headers
+	// starting from the top level of the file, like
+	// ['terraform', 'required_providers']. If empty, the top level of the
+	// file is edited.
+	Block []model.String `yaml:"block"`
+
+	// CreateBlock creates the blocks in Block if they don't already exist,
+	// instead of failing.
+	CreateBlock model.Bool `yaml:"create_block"`
+
+	// Set adds attributes, or replaces the value of existing ones.
+	Set []*HCLAttribute `yaml:"set"`
+
+	// Remove is a list of attribute names to remove.
+	Remove []model.String `yaml:"remove"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (h *HCLEditEntry) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, h, &h.Pos)
+}
+
+// Validate implements Validator.
+func (h *HCLEditEntry) Validate() error {
+	var emptyErr error
+	if len(h.Set) == 0 && len(h.Remove) == 0 && !h.CreateBlock.Val {
+		emptyErr = h.Pos.Errorf(`at least one of "set", "remove" or "create_block" must be given`)
+	}
+	var createErr error
+	if h.CreateBlock.Val && len(h.Block) == 0 {
+		createErr = h.CreateBlock.Pos.Errorf(`"create_block" requires "block" to be set`)
+	}
+	return errors.Join(
+		emptyErr,
+		createErr,
+		model.ValidateEach(h.Set),
+	)
+}
+
+// HCLAttribute is an attribute to set in an hcl_edit action.
+type HCLAttribute struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Name model.String `yaml:"name"`
+
+	// Value is an HCL expression, like '"a string"', 'var.foo' or '[1, 2]'.
+	// Note that string values must include their quotes.
+	Value model.String `yaml:"value"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (h *HCLAttribute) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, h, &h.Pos)
+}
+
+// Validate implements Validator.
+func (h *HCLAttribute) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&h.Pos, h.Name, "name"),
+		model.NotZeroModel(&h.Pos, h.Value, "value"),
+	)
+}
+
 // Append is an action that appends some output to the end of the file.
 type Append struct {
 	// Pos is the YAML file location where this object started.
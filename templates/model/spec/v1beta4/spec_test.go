@@ -121,6 +121,730 @@ steps:
     message: 'Hello, {{.or .person_name "World"}}'`,
 			wantValidateErr: []string{`at line 3 column 3: field "desc" is required`},
 		},
+		{
+			name: "extends_without_steps_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A base template with a different default'
+extends: 'github.com/my-org/templates/base@v1.2.3'
+inputs:
+- name: 'region'
+  desc: 'The region to deploy to'
+  default: 'us-west1'`,
+			want: &Spec{
+				Desc:    model.String{Val: "A base template with a different default"},
+				Extends: model.String{Val: "github.com/my-org/templates/base@v1.2.3"},
+				Inputs: []*Input{
+					{
+						Name:    model.String{Val: "region"},
+						Desc:    model.String{Val: "The region to deploy to"},
+						Default: &model.String{Val: "us-west1"},
+					},
+				},
+			},
+		},
+		{
+			name: "line_endings_and_strip_bom_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with Windows line endings'
+line_endings: 'crlf'
+strip_bom: true
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			want: &Spec{
+				Desc:        model.String{Val: "A template with Windows line endings"},
+				Extends:     model.String{Val: "github.com/my-org/templates/base@v1.2.3"},
+				LineEndings: model.String{Val: "crlf"},
+				StripBOM:    model.Bool{Val: true},
+			},
+		},
+		{
+			name: "invalid_line_endings_should_fail",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with invalid line endings'
+line_endings: 'cr'
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			wantValidateErr: []string{`at line 5 column 15: field "line_endings" value was "cr" but must be one of [preserve lf crlf]`},
+		},
+		{
+			name: "skip_if_exists_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with files the user owns after creation'
+skip_if_exists: ['config/*.yaml', 'README.md']
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			want: &Spec{
+				Desc:    model.String{Val: "A template with files the user owns after creation"},
+				Extends: model.String{Val: "github.com/my-org/templates/base@v1.2.3"},
+				SkipIfExists: []model.String{
+					{Val: "config/*.yaml"},
+					{Val: "README.md"},
+				},
+			},
+		},
+		{
+			name: "generated_marker_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template whose output is marked as generated'
+generated_marker: true
+skip_generated_marker: ['config/*.yaml']
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			want: &Spec{
+				Desc:            model.String{Val: "A template whose output is marked as generated"},
+				Extends:         model.String{Val: "github.com/my-org/templates/base@v1.2.3"},
+				GeneratedMarker: model.Bool{Val: true},
+				SkipGeneratedMarker: []model.String{
+					{Val: "config/*.yaml"},
+				},
+			},
+		},
+		{
+			name: "destinations_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with infrastructure in another repo'
+destinations:
+  - name: 'infra'
+    desc: 'A checkout of the infrastructure repo'
+    paths:
+      - from: 'infra'
+        to: 'services/api'
+      - from: 'deploy.yaml'
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			want: &Spec{
+				Desc:    model.String{Val: "A template with infrastructure in another repo"},
+				Extends: model.String{Val: "github.com/my-org/templates/base@v1.2.3"},
+				Destinations: []*Destination{
+					{
+						Name: model.String{Val: "infra"},
+						Desc: model.String{Val: "A checkout of the infrastructure repo"},
+						Paths: []*DestinationPath{
+							{From: model.String{Val: "infra"}, To: model.String{Val: "services/api"}},
+							{From: model.String{Val: "deploy.yaml"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid_destinations_should_fail",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with bad destinations'
+destinations:
+  - name: 'infra'
+    desc: 'infra'
+    paths:
+      - from: 'infra'
+      - from: '../outside'
+      - from: 'src'
+        to: '/abs'
+  - name: 'infra'
+    desc: 'again'
+    paths:
+      - from: 'infra/modules'
+  - name: '1bad'
+    desc: 'bad name'
+    paths:
+      - from: '.abc/x'
+  - name: 'empty'
+    desc: 'no paths'
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			wantValidateErr: []string{
+				`at line 10 column 15: the path "../outside" in "from" must be a clean, slash-separated path inside the output`,
+				`at line 12 column 13: the path "/abs" in "to" must be a clean, slash-separated path inside the destination`,
+				`at line 13 column 11: duplicate destination name "infra"`,
+				`at line 16 column 15: the path "infra/modules" overlaps the path "infra" at line 9`,
+				`at line 17 column 11: invalid destination name "1bad"`,
+				`at line 20 column 15: the path ".abc/x" uses the reserved name ".abc"`,
+				`at line 21 column 5: field "paths" is required`,
+			},
+		},
+		{
+			name: "files_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A single-file template'
+files:
+  main.go: 'package main'
+  src/README.md: '# Hello'
+steps:
+  - desc: 'Include the files'
+    action: 'include'
+    params:
+      paths: ['.']`,
+			want: &Spec{
+				Desc: model.String{Val: "A single-file template"},
+				Files: map[string]model.String{
+					"main.go":       {Val: "package main"},
+					"src/README.md": {Val: "# Hello"},
+				},
+				Steps: []*Step{
+					{
+						Desc:   model.String{Val: "Include the files"},
+						Action: model.String{Val: "include"},
+						Include: &Include{
+							Paths: []*IncludePath{
+								{Paths: []model.String{{Val: "."}}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid_files_should_fail",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A single-file template with bad paths'
+files:
+  ../outside.txt: 'nope'
+  /etc/passwd: 'nope'
+  a//b.txt: 'nope'
+  spec.yaml: 'nope'
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			wantValidateErr: []string{
+				`at line 6 column 19: the path "../outside.txt" in "files" must be a clean, slash-separated path inside the template directory`,
+				`at line 7 column 16: the path "/etc/passwd" in "files" must be`,
+				`at line 8 column 13: the path "a//b.txt" in "files" must be`,
+				`at line 9 column 14: "files" can't contain spec.yaml`,
+			},
+		},
+		{
+			name: "env_vars_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template that reads the environment'
+env_vars: ['GOOGLE_CLOUD_PROJECT', '_private']
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			want: &Spec{
+				Desc:    model.String{Val: "A template that reads the environment"},
+				Extends: model.String{Val: "github.com/my-org/templates/base@v1.2.3"},
+				EnvVars: []model.String{
+					{Val: "GOOGLE_CLOUD_PROJECT"},
+					{Val: "_private"},
+				},
+			},
+		},
+		{
+			name: "invalid_env_vars_should_fail",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with bad env_vars'
+env_vars: ['1ABC', 'MY-VAR', 'HOME', 'HOME']
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			wantValidateErr: []string{
+				`at line 5 column 12: invalid environment variable name "1ABC" in env_vars`,
+				`at line 5 column 20: invalid environment variable name "MY-VAR" in env_vars`,
+				`at line 5 column 38: duplicate environment variable "HOME" in env_vars`,
+			},
+		},
+		{
+			name: "file_modes_and_executable_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with scripts'
+file_modes: 'normalize'
+executable: ['scripts/*.sh', 'gradlew']
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			want: &Spec{
+				Desc:      model.String{Val: "A template with scripts"},
+				Extends:   model.String{Val: "github.com/my-org/templates/base@v1.2.3"},
+				FileModes: model.String{Val: "normalize"},
+				Executable: []model.String{
+					{Val: "scripts/*.sh"},
+					{Val: "gradlew"},
+				},
+			},
+		},
+		{
+			name: "invalid_file_modes_and_executable_should_fail",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with bad file modes'
+file_modes: 'windows'
+executable: ['!run.sh']
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			wantValidateErr: []string{
+				`at line 5 column 13: field "file_modes" value was "windows" but must be one of [preserve normalize]`,
+				`negated paths like "!run.sh" can't be used in executable`,
+			},
+		},
+		{
+			name: "negated_skip_if_exists_should_fail",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with a negated skip_if_exists'
+skip_if_exists: ['!config.yaml']
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			wantValidateErr: []string{`negated paths like "!config.yaml" can't be used in skip_if_exists`},
+		},
+		{
+			name: "input_infer_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template that infers its inputs'
+inputs:
+- name: 'module_path'
+  desc: 'The Go module path'
+  infer:
+    file: 'go.mod'
+    regex: '(?m)^module\s+(\S+)'
+- name: 'project_name'
+  desc: 'The project name'
+  default: 'my-project'
+  infer:
+    file: 'package.json'
+    field: 'name'
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			want: &Spec{
+				Desc:    model.String{Val: "A template that infers its inputs"},
+				Extends: model.String{Val: "github.com/my-org/templates/base@v1.2.3"},
+				Inputs: []*Input{
+					{
+						Name: model.String{Val: "module_path"},
+						Desc: model.String{Val: "The Go module path"},
+						Infer: &Infer{
+							File:  model.String{Val: "go.mod"},
+							Regex: model.String{Val: `(?m)^module\s+(\S+)`},
+						},
+					},
+					{
+						Name:    model.String{Val: "project_name"},
+						Desc:    model.String{Val: "The project name"},
+						Default: &model.String{Val: "my-project"},
+						Infer: &Infer{
+							File:  model.String{Val: "package.json"},
+							Field: model.String{Val: "name"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid_input_infer_should_fail",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with a bad infer block'
+inputs:
+- name: 'module_path'
+  desc: 'The Go module path'
+  infer:
+    file: '../go.mod'
+    regex: '(unclosed'
+    field: 'name'
+extends: 'github.com/my-org/templates/base@v1.2.3'`,
+			wantValidateErr: []string{
+				`the infer file "../go.mod" must be a relative path inside the destination directory`,
+				`exactly one of the fields "regex" or "field" must be set`,
+				"invalid infer regex: error parsing regexp: missing closing ): `(unclosed`",
+			},
+		},
+		{
+			name: "step_groups_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with a step group'
+step_groups:
+- name: 'component'
+  desc: 'Adds a component'
+  params:
+  - name: 'component_name'
+  - name: 'port'
+    default: '8080'
+  steps:
+  - desc: 'Include the component'
+    action: 'include'
+    params:
+      paths: ['components/{{.component_name}}']
+steps:
+- desc: 'Add the frontend'
+  action: 'call_step_group'
+  params:
+    name: 'component'
+    with:
+      component_name: 'frontend'
+      port: '3000'`,
+			want: &Spec{
+				Desc: model.String{Val: "A template with a step group"},
+				StepGroups: []*StepGroup{
+					{
+						Name: model.String{Val: "component"},
+						Desc: model.String{Val: "Adds a component"},
+						Params: []*StepGroupParam{
+							{Name: model.String{Val: "component_name"}},
+							{Name: model.String{Val: "port"}, Default: &model.String{Val: "8080"}},
+						},
+						Steps: []*Step{
+							{
+								Desc:   model.String{Val: "Include the component"},
+								Action: model.String{Val: "include"},
+								Include: &Include{
+									Paths: []*IncludePath{
+										{Paths: []model.String{{Val: "components/{{.component_name}}"}}},
+									},
+								},
+							},
+						},
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   model.String{Val: "Add the frontend"},
+						Action: model.String{Val: "call_step_group"},
+						CallStepGroup: &CallStepGroup{
+							Name: model.String{Val: "component"},
+							With: map[string]model.String{
+								"component_name": {Val: "frontend"},
+								"port":           {Val: "3000"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "step_group_call_errors",
+			in: `desc: 'A template with bad step group calls'
+step_groups:
+- name: 'component'
+  params:
+  - name: 'component_name'
+  steps:
+  - desc: 'Print'
+    action: 'print'
+    params:
+      message: '{{.component_name}}'
+steps:
+- desc: 'Unknown group'
+  action: 'call_step_group'
+  params:
+    name: 'nope'
+- desc: 'Bad params, inside a for_each'
+  action: 'for_each'
+  params:
+    iterator:
+      key: 'x'
+      values: ['a']
+    steps:
+    - desc: 'call'
+      action: 'call_step_group'
+      params:
+        name: 'component'
+        with:
+          typo: 'x'`,
+			wantValidateErr: []string{
+				`there's no step group named "nope"`,
+				`step group "component" requires the param "component_name"`,
+				`step group "component" has no param named "typo"`,
+			},
+		},
+		{
+			name: "step_group_recursion",
+			in: `desc: 'A template with recursive step groups'
+step_groups:
+- name: 'a'
+  steps:
+  - desc: 'call b'
+    action: 'call_step_group'
+    params:
+      name: 'b'
+- name: 'b'
+  steps:
+  - desc: 'call a'
+    action: 'call_step_group'
+    params:
+      name: 'a'
+steps:
+- desc: 'call a'
+  action: 'call_step_group'
+  params:
+    name: 'a'`,
+			wantValidateErr: []string{`calls itself, directly or indirectly`},
+		},
+		{
+			name: "vars_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with a derived var'
+inputs:
+- name: 'service'
+  desc: 'The service name'
+vars:
+- name: 'image'
+  desc: 'The container image'
+  value: '"gcr.io/my-project/" + service'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: '{{.image}}'`,
+			want: &Spec{
+				Desc: model.String{Val: "A template with a derived var"},
+				Inputs: []*Input{
+					{
+						Name: model.String{Val: "service"},
+						Desc: model.String{Val: "The service name"},
+					},
+				},
+				Vars: []*Var{
+					{
+						Name:  model.String{Val: "image"},
+						Desc:  model.String{Val: "The container image"},
+						Value: model.String{Val: `"gcr.io/my-project/" + service`},
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   model.String{Val: "Print a message"},
+						Action: model.String{Val: "print"},
+						Print: &Print{
+							Message: model.String{Val: "{{.image}}"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "var_name_errors",
+			in: `desc: 'A template with bad vars'
+inputs:
+- name: 'service'
+  desc: 'The service name'
+vars:
+- name: 'service'
+  value: '"x"'
+- name: 'image'
+  value: '"x"'
+- name: 'image'
+  value: '"y"'
+- name: '_reserved'
+  value: '"z"'
+- name: 'no_value'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{
+				`var "service" has the same name as an input`,
+				`duplicate var name "image"`,
+				`var names beginning with _ are reserved`,
+				`field "value" is required`,
+			},
+		},
+		{
+			name: "input_constraints_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with alternative inputs'
+inputs:
+- name: 'gcs_bucket'
+  desc: 'The GCS bucket'
+  default: ''
+- name: 's3_bucket'
+  desc: 'The S3 bucket'
+  default: ''
+input_constraints:
+- one_of: ['gcs_bucket', 's3_bucket']
+  message: 'Choose one storage backend'
+- conflicts: ['gcs_bucket', 's3_bucket']
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			want: &Spec{
+				Desc: model.String{Val: "A template with alternative inputs"},
+				Inputs: []*Input{
+					{
+						Name:    model.String{Val: "gcs_bucket"},
+						Desc:    model.String{Val: "The GCS bucket"},
+						Default: &model.String{Val: ""},
+					},
+					{
+						Name:    model.String{Val: "s3_bucket"},
+						Desc:    model.String{Val: "The S3 bucket"},
+						Default: &model.String{Val: ""},
+					},
+				},
+				InputConstraints: []*InputConstraint{
+					{
+						OneOf:   []model.String{{Val: "gcs_bucket"}, {Val: "s3_bucket"}},
+						Message: model.String{Val: "Choose one storage backend"},
+					},
+					{
+						Conflicts: []model.String{{Val: "gcs_bucket"}, {Val: "s3_bucket"}},
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   model.String{Val: "Print a message"},
+						Action: model.String{Val: "print"},
+						Print: &Print{
+							Message: model.String{Val: "Hello"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "input_constraint_errors",
+			in: `desc: 'A template with bad input constraints'
+inputs:
+- name: 'a'
+  desc: 'An input'
+- name: 'b'
+  desc: 'Another input'
+input_constraints:
+- one_of: ['a', 'b']
+  conflicts: ['a', 'b']
+- one_of: ['a']
+- conflicts: ['a', 'a']
+- one_of: ['a', 'nonexistent']
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{
+				`at line 8 column 3: exactly one of the fields "one_of" or "conflicts" must be set`,
+				`at line 10 column 3: an input constraint must name at least two inputs`,
+				`at line 11 column 20: input "a" is named more than once`,
+				`at line 12 column 17: input constraint refers to an input "nonexistent" that doesn't exist`,
+			},
+		},
+		{
+			name: "hooks_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1beta4'
+kind: 'Template'
+
+desc: 'A template with hooks'
+pre_render:
+- desc: 'Say hello'
+  action: 'print'
+  params:
+    message: 'Hello'
+steps:
+- desc: 'Include a file'
+  action: 'include'
+  params:
+    paths: ['a.txt']
+post_render:
+- desc: 'Format the output'
+  action: 'format'
+  params:
+    paths: ['.']`,
+			want: &Spec{
+				Desc: model.String{Val: "A template with hooks"},
+				PreRender: []*Step{
+					{
+						Desc:   model.String{Val: "Say hello"},
+						Action: model.String{Val: "print"},
+						Print: &Print{
+							Message: model.String{Val: "Hello"},
+						},
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   model.String{Val: "Include a file"},
+						Action: model.String{Val: "include"},
+						Include: &Include{
+							Paths: []*IncludePath{
+								{
+									Paths: []model.String{{Val: "a.txt"}},
+								},
+							},
+						},
+					},
+				},
+				PostRender: []*Step{
+					{
+						Desc:   model.String{Val: "Format the output"},
+						Action: model.String{Val: "format"},
+						Format: &Format{
+							Paths: []model.String{{Val: "."}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "post_render_disallowed_action",
+			in: `desc: 'A template with hooks'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'
+post_render:
+- desc: 'Include a file'
+  action: 'include'
+  params:
+    paths: ['a.txt']`,
+			wantValidateErr: []string{
+				`at line 9 column 11: action "include" isn't allowed in post_render; it must be one of [print format]`,
+			},
+		},
+		{
+			name: "invalid_globs",
+			in: `desc: 'A template with bad globs'
+ignore: ['[x']
+steps:
+- desc: 'Include some files'
+  action: 'include'
+  params:
+    paths: ['src/a**', '!*.md']
+    skip: ['!b.txt']
+- desc: 'Include renamed files'
+  action: 'include'
+  params:
+    paths: ['a.txt', '!b.txt']
+    as: ['c.txt', 'd.txt']
+- desc: 'Only negated paths'
+  action: 'for_each'
+  params:
+    iterator:
+      key: 'x'
+      values: ['y']
+    steps:
+    - desc: 'Replace'
+      action: 'string_replace'
+      params:
+        paths: ['!*.md']
+        replacements:
+        - to_replace: 'a'
+          with: 'b'`,
+			wantValidateErr: []string{
+				`at line 2 column 10: invalid glob: syntax error in pattern`,
+				`at line 7 column 13: invalid glob: "**" can only be used as a whole path element`,
+				`at line 8 column 12: negated paths like "!b.txt" can't be used in skip`,
+				`at line 12 column 22: negated paths like "!b.txt" can't be used with "as"`,
+				`at line 24 column 17: at least one path must not start with "!"`,
+			},
+		},
 		{
 			name: "check_required_fields",
 			in:   "inputs:",
@@ -232,6 +956,45 @@ nonexistent_field: 'oops'`,
 name: '_name_with_leading_underscore'`,
 			wantValidateErr: "are reserved",
 		},
+		{
+			name: "typed_input",
+			in: `name: 'replicas'
+desc: 'The number of replicas'
+type: 'int'
+default: '3'`,
+			want: &Input{
+				Name:    model.String{Val: "replicas"},
+				Desc:    model.String{Val: "The number of replicas"},
+				Type:    model.String{Val: "int"},
+				Default: &model.String{Val: "3"},
+			},
+		},
+		{
+			name: "invalid_type",
+			in: `name: 'ratio'
+desc: 'A ratio'
+type: 'float'`,
+			wantValidateErr: `at line 3 column 7: field "type" value was "float" but must be one of [string bool int list]`,
+		},
+		{
+			name: "default_from",
+			in: `name: 'service_account'
+desc: 'The service account name'
+default_from: 'project_id + "-sa"'`,
+			want: &Input{
+				Name:        model.String{Val: "service_account"},
+				Desc:        model.String{Val: "The service account name"},
+				DefaultFrom: model.String{Val: `project_id + "-sa"`},
+			},
+		},
+		{
+			name: "default_and_default_from",
+			in: `name: 'service_account'
+desc: 'The service account name'
+default: 'my-sa'
+default_from: 'project_id + "-sa"'`,
+			wantValidateErr: `at line 4 column 15: "default" and "default_from" can't both be given`,
+		},
 		{
 			name: "validation_rule",
 			in: `desc: 'foo'
@@ -650,6 +1413,51 @@ params:
 			},
 			wantValidateErr: `the size of "as" (3) must be the same as the size of "paths" (2)`,
 		},
+		{
+			name: "include_with_strip_prefix",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths:
+    - paths: ['src/app']
+      strip_prefix: 'src'`,
+			want: &Step{
+				Desc:   model.String{Val: "mydesc"},
+				Action: model.String{Val: "include"},
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths:       []model.String{{Val: "src/app"}},
+							StripPrefix: model.String{Val: "src"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "strip_prefix_with_as",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths:
+    - paths: ['src/app']
+      as: ['app']
+      strip_prefix: 'src'`,
+			want: &Step{
+				Desc:   model.String{Val: "mydesc"},
+				Action: model.String{Val: "include"},
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths:       []model.String{{Val: "src/app"}},
+							As:          []model.String{{Val: "app"}},
+							StripPrefix: model.String{Val: "src"},
+						},
+					},
+				},
+			},
+			wantValidateErr: `"strip_prefix" can't be combined with "as"`,
+		},
 		{
 			name: "missing_action_field_should_fail",
 			in: `desc: 'mydesc'
@@ -849,6 +1657,178 @@ params:
     with: 'def'`,
 			wantValidateErr: `at line 4 column 3: field "paths" is required`,
 		},
+		{
+			name: "hcl_edit_success",
+			in: `desc: 'mydesc'
+action: 'hcl_edit'
+params:
+  paths: ['main.tf']
+  edits:
+  - block: ['terraform', 'backend "gcs"']
+    create_block: true
+    set:
+    - name: 'bucket'
+      value: '"my-bucket"'
+    remove: ['prefix']`,
+			want: &Step{
+				Desc:   model.String{Val: "mydesc"},
+				Action: model.String{Val: "hcl_edit"},
+				HCLEdit: &HCLEdit{
+					Paths: []model.String{{Val: "main.tf"}},
+					Edits: []*HCLEditEntry{
+						{
+							Block: []model.String{
+								{Val: "terraform"},
+								{Val: `backend "gcs"`},
+							},
+							CreateBlock: model.Bool{Val: true},
+							Set: []*HCLAttribute{
+								{
+									Name:  model.String{Val: "bucket"},
+									Value: model.String{Val: `"my-bucket"`},
+								},
+							},
+							Remove: []model.String{{Val: "prefix"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "hcl_edit_entry_without_changes_should_fail",
+			in: `desc: 'mydesc'
+action: 'hcl_edit'
+params:
+  paths: ['main.tf']
+  edits:
+  - block: ['terraform']`,
+			wantValidateErr: `at least one of "set", "remove" or "create_block" must be given`,
+		},
+		{
+			name: "hcl_edit_create_block_without_block_should_fail",
+			in: `desc: 'mydesc'
+action: 'hcl_edit'
+params:
+  paths: ['main.tf']
+  edits:
+  - create_block: true`,
+			wantValidateErr: `"create_block" requires "block" to be set`,
+		},
+		{
+			name: "hcl_edit_missing_value_should_fail",
+			in: `desc: 'mydesc'
+action: 'hcl_edit'
+params:
+  paths: ['main.tf']
+  edits:
+  - set:
+    - name: 'a'`,
+			wantValidateErr: `field "value" is required`,
+		},
+		{
+			name: "format_success",
+			in: `desc: 'mydesc'
+action: 'format'
+params:
+  paths: ['config']
+  formatter: 'json'`,
+			want: &Step{
+				Desc:   model.String{Val: "mydesc"},
+				Action: model.String{Val: "format"},
+				Format: &Format{
+					Paths:     []model.String{{Val: "config"}},
+					Formatter: model.String{Val: "json"},
+				},
+			},
+		},
+		{
+			name: "format_command_success",
+			in: `desc: 'mydesc'
+action: 'format'
+params:
+  paths: ['main.tf']
+  command: ['terraform', 'fmt', '-']`,
+			want: &Step{
+				Desc:   model.String{Val: "mydesc"},
+				Action: model.String{Val: "format"},
+				Format: &Format{
+					Paths: []model.String{{Val: "main.tf"}},
+					Command: []model.String{
+						{Val: "terraform"},
+						{Val: "fmt"},
+						{Val: "-"},
+					},
+				},
+			},
+		},
+		{
+			name: "format_unknown_formatter_should_fail",
+			in: `desc: 'mydesc'
+action: 'format'
+params:
+  paths: ['a.toml']
+  formatter: 'toml'`,
+			wantValidateErr: `field "formatter" value was "toml" but must be one of [go json yaml]`,
+		},
+		{
+			name: "format_formatter_and_command_should_fail",
+			in: `desc: 'mydesc'
+action: 'format'
+params:
+  paths: ['a.json']
+  formatter: 'json'
+  command: ['jq', '.']`,
+			wantValidateErr: `"formatter" and "command" can't both be given`,
+		},
+		{
+			name: "go_mod_edit_success",
+			in: `desc: 'mydesc'
+action: 'go_mod_edit'
+params:
+  paths: ['go.mod']
+  module: 'github.com/{{.org}}/{{.name}}'
+  go: '1.22'
+  toolchain: 'go1.22.1'
+  require:
+  - path: 'github.com/abcxyz/pkg'
+    version: 'v1.0.0'
+  drop_require: ['github.com/old/dep']`,
+			want: &Step{
+				Desc:   model.String{Val: "mydesc"},
+				Action: model.String{Val: "go_mod_edit"},
+				GoModEdit: &GoModEdit{
+					Paths:     []model.String{{Val: "go.mod"}},
+					Module:    model.String{Val: "github.com/{{.org}}/{{.name}}"},
+					Go:        model.String{Val: "1.22"},
+					Toolchain: model.String{Val: "go1.22.1"},
+					Require: []*GoModRequire{
+						{
+							Path:    model.String{Val: "github.com/abcxyz/pkg"},
+							Version: model.String{Val: "v1.0.0"},
+						},
+					},
+					DropRequire: []model.String{{Val: "github.com/old/dep"}},
+				},
+			},
+		},
+		{
+			name: "go_mod_edit_without_changes_should_fail",
+			in: `desc: 'mydesc'
+action: 'go_mod_edit'
+params:
+  paths: ['go.mod']`,
+			wantValidateErr: `at least one of "module", "go", "toolchain", "require" or "drop_require" must be given`,
+		},
+		{
+			name: "go_mod_edit_require_missing_version_should_fail",
+			in: `desc: 'mydesc'
+action: 'go_mod_edit'
+params:
+  paths: ['go.mod']
+  require:
+  - path: 'github.com/abcxyz/pkg'`,
+			wantValidateErr: `field "version" is required`,
+		},
 		{
 			name: "go_template_success",
 			in: `desc: 'mydesc'
@@ -1089,6 +2069,64 @@ params:
 				},
 			},
 		},
+		{
+			name: "include_with_base_path",
+			in: `desc: 'mydesc'
+action: 'include'
+base_path: 'services/{{.service}}'
+params:
+  paths: ['main.go']
+`,
+			want: &Step{
+				Desc:     model.String{Val: "mydesc"},
+				Action:   model.String{Val: "include"},
+				BasePath: model.String{Val: "services/{{.service}}"},
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths: []model.String{{Val: "main.go"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "on_error_retry",
+			in: `desc: 'mydesc'
+action: 'print'
+on_error: 'retry(3)'
+params:
+  message: 'Hello'
+`,
+			want: &Step{
+				Desc:    model.String{Val: "mydesc"},
+				Action:  model.String{Val: "print"},
+				OnError: model.String{Val: "retry(3)"},
+				Print: &Print{
+					Message: model.String{Val: "Hello"},
+				},
+			},
+		},
+		{
+			name: "on_error_invalid",
+			in: `desc: 'mydesc'
+action: 'print'
+on_error: 'ignore'
+params:
+  message: 'Hello'
+`,
+			wantValidateErr: `on_error must be one of "fail", "continue", or "retry(n)", but got "ignore"`,
+		},
+		{
+			name: "on_error_too_many_retries",
+			in: `desc: 'mydesc'
+action: 'print'
+on_error: 'retry(11)'
+params:
+  message: 'Hello'
+`,
+			wantValidateErr: `the number of retries in on_error "retry(11)" must be from 1 to 10`,
+		},
 	}
 
 	for _, tc := range cases {
@@ -1120,3 +2158,38 @@ params:
 		})
 	}
 }
+
+func TestParseOnError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in      string
+		want    *OnError
+		wantErr string
+	}{
+		{in: "", want: &OnError{}},
+		{in: "fail", want: &OnError{}},
+		{in: "continue", want: &OnError{Continue: true}},
+		{in: "retry(1)", want: &OnError{Retries: 1}},
+		{in: "retry(10)", want: &OnError{Retries: 10}},
+		{in: "retry(0)", wantErr: "must be from 1 to 10"},
+		{in: "retry()", wantErr: `on_error must be one of`},
+		{in: "retry(2) ", wantErr: `on_error must be one of`},
+		{in: "Continue", wantErr: `on_error must be one of`},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseOnError(tc.in)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("ParseOnError(%q) returned an unexpected value (-got,+want): %s", tc.in, diff)
+			}
+		})
+	}
+}
@@ -140,10 +140,15 @@ func ValidateUnlessNil(v Validator) error {
 }
 
 // ValidateEach calls Validate() on each element of the input and returns all
-// errors encountered.
+// errors encountered. A nil element is an error, since it has no position to
+// point at.
 func ValidateEach[T Validator](s []T) error {
 	var merr error
-	for _, v := range s {
+	for i, v := range s {
+		if rv := reflect.ValueOf(v); !rv.IsValid() || (rv.Kind() == reflect.Pointer && rv.IsNil()) {
+			merr = errors.Join(merr, fmt.Errorf("entry %d of a list is empty", i+1))
+			continue
+		}
 		merr = errors.Join(merr, v.Validate())
 	}
 
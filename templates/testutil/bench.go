@@ -0,0 +1,56 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// BenchmarkSizes are the numbers of files in the synthetic trees that the
+// render pipeline benchmarks run with. Each size is a sub-benchmark, like
+// "BenchmarkRender/files=10000".
+var BenchmarkSizes = []int{100, 1000, 10000}
+
+// BenchmarkName is the name of the sub-benchmark for a tree of numFiles
+// files.
+func BenchmarkName(numFiles int) string {
+	return fmt.Sprintf("files=%d", numFiles)
+}
+
+// BenchmarkContext returns a context with a logger that discards everything,
+// so that the benchmarks measure the work rather than the logging of it.
+func BenchmarkContext() context.Context {
+	return logging.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// SyntheticTree returns a Tree of numFiles small text files for benchmarks,
+// spread over nested directories with at most 100 files each, like
+// "d3/d1/f42.txt". Every file contains the word "hello" so that replacement
+// actions have something to do.
+func SyntheticTree(numFiles int) Tree {
+	const perDir = 100
+	out := make(Tree, numFiles)
+	for i := 0; i < numFiles; i++ {
+		dir := i / perDir
+		path := fmt.Sprintf("d%d/d%d/f%d.txt", dir/perDir, dir%perDir, i%perDir)
+		out[path] = File(fmt.Sprintf("hello from file %d\nsome more text to make the file a bit bigger\n", i))
+	}
+	return out
+}
@@ -16,12 +16,17 @@
 package testutil
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -43,6 +48,12 @@ var (
 	// This is the SHA of the only commit in the repo above.
 	MinimalGitHeadSHA      = "5597fc600ead69ad92c81a22b58c9e551cd86b9a"
 	MinimalGitHeadShortSHA = MinimalGitHeadSHA[:7]
+
+	// The commit time (in UTC) and author of the only commit in the repo
+	// above.
+	MinimalGitHeadCommitTime  = "2023-12-14T23:53:04Z"
+	MinimalGitHeadAuthorName  = "Dave Revell"
+	MinimalGitHeadAuthorEmail = "revell@google.com"
 )
 
 type ModeAndContents struct {
@@ -85,6 +96,108 @@ func WriteAll(t *testing.T, root string, files map[string]ModeAndContents) {
 	}
 }
 
+// WriteSymlinks creates the given symlinks under root. The keys are the paths
+// of the symlinks relative to root, and the values are their targets.
+func WriteSymlinks(t *testing.T, root string, links map[string]string) {
+	t.Helper()
+
+	for path, target := range links {
+		fullPath := filepath.Join(root, path)
+		dir := filepath.Dir(fullPath)
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			t.Fatalf("MkdirAll(%q): %v", dir, err)
+		}
+		if err := os.Symlink(target, fullPath); err != nil {
+			t.Fatalf("Symlink(%q): %v", fullPath, err)
+		}
+	}
+}
+
+// LoadSymlinks finds all the symlinks recursively under "dir", returning their
+// targets as a map[filename]->target. Symlinked directories are not followed.
+// Returns nil if there are no symlinks.
+func LoadSymlinks(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	var out map[string]string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("Readlink(): %w", err)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("Rel(): %w", err)
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		out[filepath.ToSlash(rel)] = target
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// WriteEmptyDirs creates the given directories under root, with no files in
+// them. Paths are relative to root and use slash separators.
+func WriteEmptyDirs(t *testing.T, root string, dirs []string) {
+	t.Helper()
+
+	for _, dir := range dirs {
+		fullPath := filepath.Join(root, filepath.FromSlash(dir))
+		if err := os.MkdirAll(fullPath, 0o700); err != nil {
+			t.Fatalf("MkdirAll(%q): %v", fullPath, err)
+		}
+	}
+}
+
+// LoadEmptyDirs finds all the empty directories recursively under "dir",
+// returning their paths relative to dir in lexical order. The paths use slash
+// separators. Returns nil if there are no empty directories, or if dir doesn't
+// exist.
+func LoadEmptyDirs(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var out []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() || path == dir {
+			return nil
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return fmt.Errorf("ReadDir(): %w", err)
+		}
+		if len(entries) > 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("Rel(): %w", err)
+		}
+		out = append(out, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
 // LoadDirContents reads all the files recursively under "dir", returning their contents as a
 // map[filename]->contents. Returns nil if dir doesn't exist. Keys use slash separators, not
 // native.
@@ -173,6 +286,63 @@ func WithGitRepoAt(prefix string, m map[string]string) map[string]string {
 	return out
 }
 
+// WithGitSubmoduleAt adds "files" to the given map containing a minimal git
+// repo as a submodule at the path "sub" of the git repo at the path "super",
+// which must also be added, e.g. with WithGitRepoAt. Like a real submodule, it
+// has a .git file pointing into the .git directory of the superproject.
+//
+// Like WithGitRepoAt, existing keys in the input map are not overwritten.
+func WithGitSubmoduleAt(super, sub string, m map[string]string) map[string]string {
+	gitDir := path.Join(super, ".git/modules", sub)
+	rel := strings.Repeat("../", strings.Count(sub, "/")+1) + ".git/modules/" + sub
+	return withGitFile(path.Join(super, sub), rel, gitDir, nil, m)
+}
+
+// WithGitWorktreeAt adds "files" to the given map containing a linked worktree
+// (as created by "git worktree add") at the path "worktree" of the minimal git
+// repo at the path "main", which must also be added with WithGitRepoAt. The
+// worktree has the same HEAD commit as the main repo.
+//
+// Like WithGitRepoAt, existing keys in the input map are not overwritten.
+func WithGitWorktreeAt(main, worktree string, m map[string]string) map[string]string {
+	name := path.Base(worktree)
+	gitDir := path.Join(main, ".git/worktrees", name)
+	rel, err := filepath.Rel(filepath.FromSlash(worktree), filepath.FromSlash(gitDir))
+	if err != nil {
+		panic(err)
+	}
+	worktreeFiles := map[string]string{
+		"HEAD":      MinimalGitHeadSHA,
+		"commondir": "../..",
+	}
+	return withGitFile(worktree, filepath.ToSlash(rel), gitDir, worktreeFiles, m)
+}
+
+// withGitFile adds a .git file in dir pointing to the relative path gitDirRel,
+// plus the given files in gitDir, which default to the minimal git repo.
+func withGitFile(dir, gitDirRel, gitDir string, gitDirFiles, m map[string]string) map[string]string {
+	out := maps.Clone(m)
+	if out == nil {
+		out = map[string]string{}
+	}
+	add := func(k, v string) {
+		if _, ok := out[k]; !ok {
+			out[k] = v
+		}
+	}
+	add(path.Join(dir, ".git"), "gitdir: "+gitDirRel+"\n")
+	if gitDirFiles == nil {
+		gitDirFiles = make(map[string]string, len(minimalGitRepoFiles))
+		for k, v := range minimalGitRepoFiles {
+			gitDirFiles[strings.TrimPrefix(k, ".git/")] = v
+		}
+	}
+	for k, v := range gitDirFiles {
+		add(path.Join(gitDir, k), v)
+	}
+	return out
+}
+
 func mustHexDecode(s string) []byte {
 	out, err := hex.DecodeString(s)
 	if err != nil {
@@ -197,3 +367,63 @@ func TestMustGlob(t *testing.T, glob string) (string, bool) {
 	t.Fatalf("got %d matches for glob %q, wanted 1: %s", len(matches), glob, matches)
 	panic("unreachable") // silence compiler warning for "missing return"
 }
+
+// ReadTar reads every regular file in the given tar stream into a map keyed
+// by the path inside the archive.
+func ReadTar(t *testing.T, r io.Reader) map[string]ModeAndContents {
+	t.Helper()
+
+	out := map[string]ModeAndContents{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("tar Next(): %v", err)
+		}
+		contents, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("ReadAll(%s): %v", hdr.Name, err)
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			// Represent symlinks the same way as ReadZip does.
+			contents = []byte(hdr.Linkname)
+		}
+		out[hdr.Name] = ModeAndContents{
+			Mode:     hdr.FileInfo().Mode(),
+			Contents: string(contents),
+		}
+	}
+}
+
+// ReadZip reads every file in the given zip archive into a map keyed by the
+// path inside the archive. The contents of a symlink are its target.
+func ReadZip(t *testing.T, b []byte) map[string]ModeAndContents {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("zip.NewReader(): %v", err)
+	}
+	out := map[string]ModeAndContents{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Open(%s): %v", f.Name, err)
+		}
+		contents, err := io.ReadAll(rc)
+		if closeErr := rc.Close(); closeErr != nil {
+			t.Fatalf("Close(%s): %v", f.Name, closeErr)
+		}
+		if err != nil {
+			t.Fatalf("ReadAll(%s): %v", f.Name, err)
+		}
+		out[f.Name] = ModeAndContents{
+			Mode:     f.Mode(),
+			Contents: string(contents),
+		}
+	}
+	return out
+}
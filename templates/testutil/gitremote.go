@@ -0,0 +1,165 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// FakeGitRemoteBranch is the default branch of a FakeGitRemote.
+const FakeGitRemoteBranch = "main"
+
+// fakeGitRemoteEnv makes commits reproducible, so the same sequence of calls
+// always creates the same SHAs, and keeps the git config of the machine
+// running the tests from changing anything.
+var fakeGitRemoteEnv = []string{
+	"GIT_AUTHOR_NAME=" + MinimalGitHeadAuthorName,
+	"GIT_AUTHOR_EMAIL=" + MinimalGitHeadAuthorEmail,
+	"GIT_AUTHOR_DATE=2024-01-02T03:04:05Z",
+	"GIT_COMMITTER_NAME=" + MinimalGitHeadAuthorName,
+	"GIT_COMMITTER_EMAIL=" + MinimalGitHeadAuthorEmail,
+	"GIT_COMMITTER_DATE=2024-01-02T03:04:05Z",
+	"GIT_CONFIG_GLOBAL=" + os.DevNull,
+	"GIT_CONFIG_NOSYSTEM=1",
+	"GIT_TERMINAL_PROMPT=0",
+}
+
+// FakeGitRemote is a git repo in a temporary directory that can be used as a
+// remote by "git clone" and "git ls-remote" through a file:// URL. It lets
+// tests of remote git downloads, "latest" version resolution, and upgrades
+// run without the network.
+//
+// The git CLI must be installed.
+type FakeGitRemote struct {
+	// URL is the file:// URL of the repo, usable anywhere a git remote like
+	// https://github.com/abcxyz/abc.git is.
+	URL string
+
+	dir string
+}
+
+// NewFakeGitRemote creates an empty FakeGitRemote that's removed when the test
+// ends. Use Commit to add files to it.
+func NewFakeGitRemote(tb testing.TB) *FakeGitRemote {
+	tb.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		tb.Skipf("skipping test because the git CLI isn't installed: %v", err)
+	}
+
+	dir := tb.TempDir()
+	r := &FakeGitRemote{
+		URL: fileURL(dir),
+		dir: dir,
+	}
+	r.git(tb, "init", "--quiet", "--initial-branch="+FakeGitRemoteBranch)
+	return r
+}
+
+// Commit replaces the contents of the current branch with files, a map of
+// slash-separated paths to contents, and commits them. Returns the full SHA
+// of the new commit.
+func (r *FakeGitRemote) Commit(tb testing.TB, msg string, files map[string]string) string {
+	tb.Helper()
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() == ".git" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(r.dir, e.Name())); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	for path, contents := range files {
+		full := filepath.Join(r.dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0o700); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(contents), 0o600); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	r.git(tb, "add", "--all")
+	r.git(tb, "commit", "--quiet", "--allow-empty", "--no-gpg-sign", "--message", msg)
+	return r.git(tb, "rev-parse", "HEAD")
+}
+
+// Tag creates a lightweight tag named tag pointing to the commit ref, which
+// may be a SHA, a branch, or another tag.
+func (r *FakeGitRemote) Tag(tb testing.TB, tag, ref string) {
+	tb.Helper()
+	r.git(tb, "tag", tag, ref)
+}
+
+// AnnotatedTag is like Tag, but creates an annotated tag, which is a git
+// object of its own that points to the commit.
+func (r *FakeGitRemote) AnnotatedTag(tb testing.TB, tag, ref string) {
+	tb.Helper()
+	r.git(tb, "tag", "--annotate", "--no-sign", "--message", tag, tag, ref)
+}
+
+// Branch switches to the branch with the given name, creating it at the
+// current commit if it doesn't exist. Later commits are added to it.
+func (r *FakeGitRemote) Branch(tb testing.TB, branch string) {
+	tb.Helper()
+	if r.gitOK("rev-parse", "--verify", "--quiet", "refs/heads/"+branch) {
+		r.git(tb, "checkout", "--quiet", branch)
+		return
+	}
+	r.git(tb, "checkout", "--quiet", "-b", branch)
+}
+
+// git runs a git command in the repo and returns its trimmed stdout, failing
+// the test if it fails.
+func (r *FakeGitRemote) git(tb testing.TB, args ...string) string {
+	tb.Helper()
+	cmd := r.command(args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		tb.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitOK runs a git command in the repo and returns whether it succeeded.
+func (r *FakeGitRemote) gitOK(args ...string) bool {
+	return r.command(args...).Run() == nil
+}
+
+func (r *FakeGitRemote) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	cmd.Env = append(os.Environ(), fakeGitRemoteEnv...)
+	return cmd
+}
+
+// fileURL returns the file:// URL of the absolute path dir.
+func fileURL(dir string) string {
+	slashed := filepath.ToSlash(dir)
+	if !strings.HasPrefix(slashed, "/") {
+		// A Windows path like C:/foo becomes file:///C:/foo.
+		slashed = "/" + slashed
+	}
+	return "file://" + slashed
+}
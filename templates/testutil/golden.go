@@ -0,0 +1,119 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// update is registered in every test binary that imports this package. When
+// it's set, the golden assertions below rewrite their expected files instead
+// of comparing against them:
+//
+//	$ go test ./... -update
+var update = flag.Bool("update", false, "rewrite the expected files of golden assertions (like AssertDirsEqual) with the actual output, instead of comparing them")
+
+// AssertDirsEqual fails the test if the contents of gotDir are different from
+// the expected contents in wantDir, which is usually under testdata. Files,
+// symlinks, and empty directories are compared. Only the executable bit of
+// file modes is compared, since the other permission bits aren't preserved by
+// git.
+//
+// If the test is run with -update, wantDir is replaced with a copy of gotDir
+// instead, and the test passes.
+func AssertDirsEqual(tb testing.TB, gotDir, wantDir string) {
+	tb.Helper()
+
+	got := normalizeGoldenTree(LoadTree(tb, gotDir))
+	if *update {
+		if err := os.RemoveAll(wantDir); err != nil {
+			tb.Fatalf("RemoveAll(%q): %v", wantDir, err)
+		}
+		if err := os.MkdirAll(wantDir, 0o700); err != nil {
+			tb.Fatalf("MkdirAll(%q): %v", wantDir, err)
+		}
+		WriteTree(tb, wantDir, got)
+		tb.Logf("updated the golden directory %q", wantDir)
+		return
+	}
+
+	want := normalizeGoldenTree(LoadTree(tb, wantDir))
+	if want == nil {
+		tb.Fatalf("the golden directory %q doesn't exist, run the test with -update to create it", wantDir)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		tb.Errorf("the contents of %q didn't match the golden directory %q, run the test with -update if the change is expected (-got,+want): %s", gotDir, wantDir, diff)
+	}
+}
+
+// AssertFileEqual is like AssertDirsEqual, but for a single file. With
+// -update, the file wantFile is replaced with the contents of gotFile.
+func AssertFileEqual(tb testing.TB, gotFile, wantFile string) {
+	tb.Helper()
+
+	got, err := os.ReadFile(gotFile)
+	if err != nil {
+		tb.Fatalf("ReadFile(%q): %v", gotFile, err)
+	}
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(wantFile), 0o700); err != nil {
+			tb.Fatalf("MkdirAll(%q): %v", filepath.Dir(wantFile), err)
+		}
+		if err := os.WriteFile(wantFile, got, 0o600); err != nil {
+			tb.Fatalf("WriteFile(%q): %v", wantFile, err)
+		}
+		tb.Logf("updated the golden file %q", wantFile)
+		return
+	}
+
+	want, err := os.ReadFile(wantFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			tb.Fatalf("the golden file %q doesn't exist, run the test with -update to create it", wantFile)
+		}
+		tb.Fatalf("ReadFile(%q): %v", wantFile, err)
+	}
+	if diff := cmp.Diff(string(got), string(want)); diff != "" {
+		tb.Errorf("the contents of %q didn't match the golden file %q, run the test with -update if the change is expected (-got,+want): %s", gotFile, wantFile, diff)
+	}
+}
+
+// normalizeGoldenTree sets the permissions of every file to 0600, or 0700 if
+// it's executable, and of every empty directory to 0700.
+func normalizeGoldenTree(tree Tree) Tree {
+	if tree == nil {
+		return nil
+	}
+	out := make(Tree, len(tree))
+	for path, e := range tree {
+		switch {
+		case e.Mode&fs.ModeSymlink != 0:
+		case e.Mode.IsDir():
+			e.Mode = fs.ModeDir | 0o700
+		case e.Mode&0o111 != 0:
+			e.Mode = 0o700
+		default:
+			e.Mode = 0o600
+		}
+		out[path] = e
+	}
+	return out
+}
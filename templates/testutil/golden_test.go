@@ -0,0 +1,85 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Not parallel, because it sets the -update flag.
+func TestAssertDirsEqual(t *testing.T) { //nolint:paralleltest
+	tempDir := t.TempDir()
+	gotDir := filepath.Join(tempDir, "got")
+	wantDir := filepath.Join(tempDir, "testdata", "golden")
+	WriteTree(t, gotDir, Tree{
+		"a.txt":   File("a"),
+		"run.sh":  FileMode("#!/bin/sh", 0o750),
+		"link":    Symlink("a.txt"),
+		"dir/one": EmptyDir(),
+	})
+
+	// The golden directory doesn't exist yet, so -update creates it.
+	*update = true
+	AssertDirsEqual(t, gotDir, wantDir)
+	*update = false
+	AssertDirsEqual(t, gotDir, wantDir)
+
+	// Permissions that git doesn't preserve are ignored.
+	if err := os.Chmod(filepath.Join(wantDir, "a.txt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	AssertDirsEqual(t, gotDir, wantDir)
+
+	WriteTree(t, gotDir, Tree{"b.txt": File("b")})
+	fake := &fakeTB{TB: t}
+	AssertDirsEqual(fake, gotDir, wantDir)
+	if len(fake.errors) != 1 {
+		t.Errorf("got %d errors for a missing golden file, want 1: %v", len(fake.errors), fake.errors)
+	}
+}
+
+// Not parallel, because it sets the -update flag.
+func TestAssertFileEqual(t *testing.T) { //nolint:paralleltest
+	tempDir := t.TempDir()
+	gotFile := filepath.Join(tempDir, "got.txt")
+	wantFile := filepath.Join(tempDir, "testdata", "want.txt")
+	WriteTree(t, tempDir, Tree{"got.txt": File("hello")})
+
+	*update = true
+	AssertFileEqual(t, gotFile, wantFile)
+	*update = false
+	AssertFileEqual(t, gotFile, wantFile)
+
+	WriteTree(t, tempDir, Tree{"testdata/want.txt": File("goodbye")})
+	fake := &fakeTB{TB: t}
+	AssertFileEqual(fake, gotFile, wantFile)
+	if len(fake.errors) != 1 {
+		t.Errorf("got %d errors for a changed golden file, want 1: %v", len(fake.errors), fake.errors)
+	}
+}
+
+// fakeTB records the errors of a failed assertion instead of failing the
+// test.
+type fakeTB struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
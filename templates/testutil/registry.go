@@ -0,0 +1,178 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FakeRegistryParams configures NewFakeRegistry.
+type FakeRegistryParams struct {
+	// Auth is "" for anonymous access, "basic" to require HTTP basic auth, or
+	// "bearer" to require a token from the fake registry's token server.
+	Auth string
+
+	// The only accepted credentials, if Auth isn't "".
+	Username string
+	Password string
+}
+
+// FakeRegistry is an in-memory OCI registry that supports just enough of the
+// distribution API to push and check for images.
+type FakeRegistry struct {
+	// Host is the host:port of the registry, which is served over plain HTTP.
+	Host string
+
+	params *FakeRegistryParams
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte // keyed by "<repo>:<tag>"
+	uploads   int
+}
+
+var fakeRegistryPathRE = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs)/(.+)$`)
+
+const fakeRegistryToken = "fake-registry-token"
+
+// NewFakeRegistry starts a FakeRegistry that's stopped when the test ends.
+func NewFakeRegistry(tb testing.TB, params *FakeRegistryParams) *FakeRegistry {
+	tb.Helper()
+
+	r := &FakeRegistry{
+		params:    params,
+		blobs:     map[string][]byte{},
+		manifests: map[string][]byte{},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(r.serve))
+	tb.Cleanup(srv.Close)
+	r.Host = strings.TrimPrefix(srv.URL, "http://")
+	return r
+}
+
+// Manifest returns the manifest that was pushed to repo with tag, or nil.
+func (r *FakeRegistry) Manifest(repo, tag string) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.manifests[repo+":"+tag]
+}
+
+// Blob returns the blob with the given digest, or nil.
+func (r *FakeRegistry) Blob(digest string) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.blobs[digest]
+}
+
+// Uploads returns the number of blob uploads so far.
+func (r *FakeRegistry) Uploads() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.uploads
+}
+
+func (r *FakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		user, pass, _ := req.BasicAuth()
+		if user != r.params.Username || pass != r.params.Password {
+			http.Error(w, "bad credentials", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": fakeRegistryToken})
+		return
+	}
+
+	if !r.authorized(req) {
+		switch r.params.Auth {
+		case "basic":
+			w.Header().Set("WWW-Authenticate", `Basic realm="fake"`)
+		case "bearer":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="fake"`, req.Host))
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.URL.Path == "/v2/" {
+		return
+	}
+	m := fakeRegistryPathRE.FindStringSubmatch(req.URL.Path)
+	if m == nil {
+		http.NotFound(w, req)
+		return
+	}
+	repo, kind, ref := m[1], m[2], m[3]
+
+	switch {
+	case kind == "manifests" && req.Method == http.MethodHead:
+		if _, ok := r.manifests[repo+":"+ref]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case kind == "manifests" && req.Method == http.MethodPut:
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.manifests[repo+":"+ref] = body
+		w.WriteHeader(http.StatusCreated)
+	case kind == "blobs" && req.Method == http.MethodHead:
+		if _, ok := r.blobs[ref]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case kind == "blobs" && ref == "uploads/" && req.Method == http.MethodPost:
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/session-%d?state=fake", repo, r.uploads))
+		w.WriteHeader(http.StatusAccepted)
+	case kind == "blobs" && strings.HasPrefix(ref, "uploads/") && req.Method == http.MethodPut:
+		if req.URL.Query().Get("state") != "fake" {
+			http.Error(w, "lost the upload state", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.blobs[req.URL.Query().Get("digest")] = body
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *FakeRegistry) authorized(req *http.Request) bool {
+	switch r.params.Auth {
+	case "basic":
+		user, pass, ok := req.BasicAuth()
+		return ok && user == r.params.Username && pass == r.params.Password
+	case "bearer":
+		return req.Header.Get("Authorization") == "Bearer "+fakeRegistryToken
+	default:
+		return true
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tree declares the contents of a directory for a test: regular files with
+// their modes, symlinks, and empty directories, in a single map. The keys are
+// paths relative to the root of the tree, using slash separators.
+//
+// For example:
+//
+//	abctestutil.WriteTree(t, dir, abctestutil.Tree{
+//		"spec.yaml":       abctestutil.File("..."),
+//		"bin/run.sh":      abctestutil.FileMode("#!/bin/sh", 0o700),
+//		"logo.png":        abctestutil.Binary([]byte{0x89, 'P', 'N', 'G'}),
+//		"link.txt":        abctestutil.Symlink("spec.yaml"),
+//		"placeholder/dir": abctestutil.EmptyDir(),
+//	})
+type Tree map[string]TreeEntry
+
+// TreeEntry is one file, symlink, or empty directory in a Tree. Use the File,
+// FileMode, Binary, Symlink, and EmptyDir functions to create them.
+type TreeEntry struct {
+	// Mode is the permission bits of a file or empty directory, or
+	// fs.ModeSymlink for a symlink. Directories also have fs.ModeDir.
+	Mode fs.FileMode
+
+	// Contents is the contents of a file, which may be binary, or the target
+	// of a symlink.
+	Contents string
+}
+
+// File is a regular file with mode 0600.
+func File(contents string) TreeEntry {
+	return FileMode(contents, 0o600)
+}
+
+// FileMode is a regular file with the given permission bits.
+func FileMode(contents string, mode fs.FileMode) TreeEntry {
+	return TreeEntry{Mode: mode.Perm(), Contents: contents}
+}
+
+// Binary is a regular file with mode 0600 and non-text contents.
+func Binary(contents []byte) TreeEntry {
+	return File(string(contents))
+}
+
+// Symlink is a symlink pointing to target, which is usually relative to the
+// directory containing the symlink.
+func Symlink(target string) TreeEntry {
+	return TreeEntry{Mode: fs.ModeSymlink, Contents: target}
+}
+
+// EmptyDir is a directory with mode 0700 and nothing in it.
+func EmptyDir() TreeEntry {
+	return TreeEntry{Mode: fs.ModeDir | 0o700}
+}
+
+// WriteTree creates every entry of tree under root. Parent directories are
+// created as needed with mode 0700. Modes are set with chmod, so they aren't
+// affected by the umask.
+func WriteTree(tb testing.TB, root string, tree Tree) {
+	tb.Helper()
+
+	for path, e := range tree {
+		fullPath := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o700); err != nil {
+			tb.Fatalf("MkdirAll(%q): %v", filepath.Dir(fullPath), err)
+		}
+		switch {
+		case e.Mode&fs.ModeSymlink != 0:
+			if err := os.Symlink(e.Contents, fullPath); err != nil {
+				tb.Fatalf("Symlink(%q): %v", fullPath, err)
+			}
+		case e.Mode.IsDir():
+			if err := os.MkdirAll(fullPath, e.Mode.Perm()); err != nil {
+				tb.Fatalf("MkdirAll(%q): %v", fullPath, err)
+			}
+			if err := os.Chmod(fullPath, e.Mode.Perm()); err != nil {
+				tb.Fatalf("Chmod(%q): %v", fullPath, err)
+			}
+		default:
+			if err := os.WriteFile(fullPath, []byte(e.Contents), e.Mode.Perm()); err != nil {
+				tb.Fatalf("WriteFile(%q): %v", fullPath, err)
+			}
+			if err := os.Chmod(fullPath, e.Mode.Perm()); err != nil {
+				tb.Fatalf("Chmod(%q): %v", fullPath, err)
+			}
+		}
+	}
+}
+
+// LoadTree reads everything under root into a Tree, so it can be compared
+// with the Tree a test expects. Symlinks aren't followed. Directories are only
+// included if they're empty. Returns nil if root doesn't exist.
+func LoadTree(tb testing.TB, root string) Tree {
+	tb.Helper()
+
+	if _, err := os.Stat(root); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		tb.Fatal(err)
+	}
+	out := Tree{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("Rel(): %w", err)
+		}
+		rel = filepath.ToSlash(rel)
+		fi, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("Info(): %w", err)
+		}
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("Readlink(): %w", err)
+			}
+			out[rel] = Symlink(target)
+		case d.IsDir():
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return fmt.Errorf("ReadDir(): %w", err)
+			}
+			if len(entries) == 0 {
+				out[rel] = TreeEntry{Mode: fs.ModeDir | fi.Mode().Perm()}
+			}
+		default:
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("ReadFile(): %w", err)
+			}
+			out[rel] = FileMode(string(contents), fi.Mode())
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatalf("WalkDir(): %v", err)
+	}
+	return out
+}